@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"weeklysec/internal/config"
+	"weeklysec/internal/operator"
+	"weeklysec/internal/store"
+)
+
+// runCommand handles the maintenance subcommands. It returns false when
+// args name none, in which case the server starts as usual.
+//
+//	export FILE              write an archive of the data store
+//	import [-overwrite] FILE load an archive into the data store
+//	crawl                    register a registry's images as targets once
+//	crds                     print the operator CRDs and the ClusterRoles
+func runCommand(cfg *config.Config, args []string) bool {
+	if len(args) == 0 {
+		return false
+	}
+	var err error
+	switch args[0] {
+	case "export":
+		err = exportArchive(cfg, args[1:])
+	case "import":
+		err = importArchive(cfg, args[1:])
+	case "crawl":
+		err = crawlRegistry(cfg)
+	case "crds":
+		_, err = os.Stdout.Write(operator.Manifests())
+	default:
+		return false
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", args[0], err)
+		os.Exit(1)
+	}
+	return true
+}
+
+func exportArchive(cfg *config.Config, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: export FILE")
+	}
+	st, err := openStore(cfg)
+	if err != nil {
+		return err
+	}
+	defer st.Close()
+
+	f, err := os.Create(args[0])
+	if err != nil {
+		return err
+	}
+	m, err := st.Export(context.Background(), f)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	return printJSON(m)
+}
+
+func importArchive(cfg *config.Config, args []string) error {
+	overwrite := len(args) > 0 && args[0] == "-overwrite"
+	if overwrite {
+		args = args[1:]
+	}
+	if len(args) != 1 {
+		return fmt.Errorf("usage: import [-overwrite] FILE")
+	}
+	st, err := openStore(cfg)
+	if err != nil {
+		return err
+	}
+	defer st.Close()
+
+	f, err := os.Open(args[0])
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	res, err := st.Import(context.Background(), f, overwrite)
+	if err != nil {
+		return err
+	}
+	return printJSON(res)
+}
+
+// crawlRegistry runs one registry crawl and prints its result.
+func crawlRegistry(cfg *config.Config) error {
+	if cfg.RegistryCrawlURL == "" {
+		return fmt.Errorf("REGISTRY_CRAWL_URL is not set")
+	}
+	st, err := openStore(cfg)
+	if err != nil {
+		return err
+	}
+	defer st.Close()
+
+	c, err := openCrawler(cfg, st)
+	if err != nil {
+		return err
+	}
+	res, err := c.Crawl(context.Background())
+	if err != nil {
+		return err
+	}
+	return printJSON(res)
+}
+
+func openStore(cfg *config.Config) (*store.Store, error) {
+	blobs, err := openBlobs(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return store.Open(store.Options{
+		Dir:     cfg.DataDir,
+		Backend: cfg.StoreBackend,
+		DSN:     cfg.DatabaseURL,
+		Blobs:   blobs,
+	})
+}
+
+func printJSON(v any) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
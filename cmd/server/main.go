@@ -1,38 +1,1053 @@
 package main
 
 import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/url"
 	"os"
 	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+	"weeklysec/internal/agent"
+	"weeklysec/internal/alert"
+	"weeklysec/internal/allowlist"
 	"weeklysec/internal/api"
+	"weeklysec/internal/attest"
+	"weeklysec/internal/certs"
+	"weeklysec/internal/cluster"
+	"weeklysec/internal/config"
+	"weeklysec/internal/cosign"
+	"weeklysec/internal/crawler"
+	"weeklysec/internal/defectdojo"
+	"weeklysec/internal/deptrack"
+	"weeklysec/internal/email"
+	"weeklysec/internal/experiment"
+	"weeklysec/internal/failure"
+	"weeklysec/internal/gate"
+	"weeklysec/internal/github"
+	"weeklysec/internal/i18n"
+	"weeklysec/internal/jira"
+	"weeklysec/internal/jobs"
+	"weeklysec/internal/kev"
+	"weeklysec/internal/kube"
+	"weeklysec/internal/labels"
+	"weeklysec/internal/llm"
+	"weeklysec/internal/notify"
+	"weeklysec/internal/operator"
+	"weeklysec/internal/policy"
+	"weeklysec/internal/queue"
+	"weeklysec/internal/quota"
+	"weeklysec/internal/registry"
+	"weeklysec/internal/report"
+	"weeklysec/internal/retention"
+	"weeklysec/internal/scheduler"
+	"weeklysec/internal/scoring"
+	"weeklysec/internal/secrets"
+	"weeklysec/internal/servicenow"
+	"weeklysec/internal/store"
+	"weeklysec/internal/tenant"
+	"weeklysec/internal/tickets"
+	"weeklysec/internal/tracing"
+	"weeklysec/internal/trivy"
+	"weeklysec/internal/webhook"
+	"weeklysec/internal/workspace"
 
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
+	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 )
 
 func main() {
-	// Load env variables if .env file exists
-	_ = godotenv.Load()
+	// Load env variables if the env file exists
+	_ = godotenv.Load(cmp.Or(os.Getenv("CONFIG_FILE"), ".env"))
 
-	// Check if Trivy is available
-	if _, err := exec.LookPath("trivy"); err != nil {
-		log.Fatal().Msg("Trivy CLI not found in PATH. Please install Trivy to continue.")
+	// Loggers taken from a context without one fall back to the global logger
+	zerolog.DefaultContextLogger = &log.Logger
+
+	cfg := config.Load()
+
+	// Settings naming a secret get the secret's value
+	sec, err := openSecrets(cfg)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Invalid secrets configuration")
+	}
+	if err := sec.ResolveEnv(context.Background()); err != nil {
+		log.Fatal().Err(err).Msg("Failed to resolve secrets")
+	}
+	cfg = config.Load()
+
+	// Maintenance subcommands run against the store and exit
+	if runCommand(cfg, os.Args[1:]) {
+		return
+	}
+
+	// Synthetic scans replay fixtures and need no Trivy
+	if cfg.SyntheticScanFixtures != "" {
+		if err := trivy.SetFixtures(cfg.SyntheticScanFixtures, cfg.SyntheticScanLatency); err != nil {
+			log.Fatal().Err(err).Msg("Invalid SYNTHETIC_SCAN_FIXTURES")
+		}
+		log.Warn().Strs("fixtures", trivy.Fixtures()).Msg("Synthetic scan mode: scans replay stored reports instead of running Trivy")
+	} else if _, err := exec.LookPath("trivy"); err != nil {
+		// Download Trivy when allowed
+		if !cfg.TrivyInstall {
+			log.Fatal().Msg("Trivy CLI not found in PATH. Please install Trivy or set TRIVY_INSTALL=true to continue.")
+		}
+		if err := installTrivy(cfg); err != nil {
+			log.Fatal().Err(err).Msg("Failed to install Trivy")
+		}
+	}
+
+	trivy.SetLimits(trivy.Limits{
+		MaxOutputBytes:    cfg.TrivyMaxOutputBytes,
+		MaxRawOutputBytes: cfg.TrivyMaxRawOutputBytes,
+	})
+	trivy.SetCacheDir(cmp.Or(cfg.TrivyCacheDir, filepath.Join(cfg.DataDir, "trivy-cache")))
+	sandbox := trivy.Sandbox{
+		User:           cfg.SandboxUser,
+		MaxMemoryBytes: cfg.SandboxMaxMemoryBytes,
+		MaxCPUTime:     cfg.SandboxMaxCPUTime,
+		MaxOpenFiles:   cfg.SandboxMaxOpenFiles,
+		MaxFileBytes:   cfg.SandboxMaxFileBytes,
+		Isolate:        cfg.SandboxIsolate,
+		Env:            cfg.SandboxEnv,
+	}
+	if sandbox.Env == nil {
+		sandbox.Env = trivy.DefaultSandboxEnv
+	}
+	if err := trivy.SetSandbox(sandbox); err != nil {
+		log.Fatal().Err(err).Msg("Invalid scanner sandbox")
+	}
+	if cfg.TrivyDBRefreshInterval > 0 && cfg.SyntheticScanFixtures == "" {
+		go trivy.RefreshDB(cfg.TrivyDBRefreshInterval, nil)
+	}
+
+	if cfg.TracingEnabled {
+		shutdown, err := tracing.Setup(context.Background(), cfg.TracingServiceName)
+		if err != nil {
+			log.Fatal().Err(err).Msg("Failed to set up tracing")
+		}
+		defer func() { _ = shutdown(context.Background()) }()
+	}
+
+	// Open the scan store
+	st, err := openStore(cfg)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to open data store")
+	}
+	defer st.Close()
+
+	llm.SetClientOptions(llm.ClientOptions{
+		MaxIdleConns:    cfg.LLMMaxIdleConns,
+		IdleConnTimeout: cfg.LLMIdleConnTimeout,
+		AttemptTimeout:  cfg.LLMAttemptTimeout,
+		Timeout:         cfg.LLMTimeout,
+		Attempts:        cfg.LLMAttempts,
+	})
+	llm.SetLocal(llm.LocalOptions{URL: cfg.LLMLocalURL, APIKey: cfg.LLMLocalAPIKey, Models: cfg.LLMLocalModels})
+	if cfg.LLMMock {
+		llm.UseMock(cfg.LLMMockLatency)
+		log.Warn().Msg("LLM_MOCK is set: LLM steps get canned answers")
+	}
+	if cfg.PromptDir != "" {
+		prompts, err := llm.LoadPrompts(cfg.PromptDir)
+		if err != nil {
+			log.Fatal().Err(err).Msg("Invalid PROMPT_DIR")
+		}
+		llm.SetPrompts(prompts)
+	}
+	locales, err := loadLocales(cfg)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Invalid LOCALE_DIR or REPORT_LOCALE")
+	}
+	i18n.Set(locales)
+	templates, err := loadTemplates(cfg)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Invalid REPORT_TEMPLATE_DIR")
+	}
+	report.SetTemplates(templates)
+	branding, err := loadBranding(cfg)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Invalid REPORT_LOGO")
+	}
+	report.SetBranding(branding)
+
+	ag := agent.New(agent.AgentConfig{
+		Model:              cfg.LLMModel,
+		PriorityThreshold:  cfg.PriorityThreshold,
+		TokenBudget:        cfg.TokenBudget,
+		MaxVulnerabilities: cfg.MaxVulnerabilities,
+		MinimizeData:       cfg.LLMMinimizeData,
+	})
+
+	// Configuration saved through the admin API overrides the environment
+	var saved agent.AgentConfig
+	switch err := st.GetSetting(api.AgentConfigSetting, &saved); {
+	case err == nil:
+		if err := ag.SetConfig(saved); err != nil {
+			log.Warn().Err(err).Msg("Ignoring invalid saved agent configuration")
+		}
+	case !errors.Is(err, store.ErrNotFound):
+		log.Warn().Err(err).Msg("Failed to load saved agent configuration")
+	}
+
+	experiments, err := openExperiments(cfg, st)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Invalid prompt experiments")
+	}
+	ag.SetExperiments(experiments)
+
+	hooks, err := openScoring(cfg, st)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Invalid scoring hooks")
+	}
+	ag.SetScoring(hooks)
+
+	if len(cfg.CosignKeys) > 0 || len(cfg.CosignIdentities) > 0 {
+		verifier, err := openVerifier(cfg)
+		if err != nil {
+			log.Fatal().Err(err).Msg("Invalid cosign configuration")
+		}
+		if _, err := exec.LookPath("cosign"); err != nil {
+			log.Warn().Msg("Cosign CLI not found in PATH; image signatures will be reported as errors")
+		}
+		ag.SetVerifier(verifier)
+	}
+
+	if cfg.DeltaScans && cfg.SyntheticScanFixtures == "" {
+		var clients []*registry.Client
+		if cfg.RegistryCrawlURL != "" {
+			client, err := registry.New(cfg.RegistryCrawlURL, cfg.RegistryCrawlUsername, cfg.RegistryCrawlPassword)
+			if err != nil {
+				log.Fatal().Err(err).Msg("Invalid REGISTRY_CRAWL_URL")
+			}
+			clients = append(clients, client)
+		}
+		ag.SetLayerResolver(registry.NewImages(clients...))
+	}
+
+	// Bound agent runs and the Trivy processes within them
+	runQueue := queue.New("agent", cfg.MaxConcurrentAgents, cfg.AgentQueueSize, cfg.AgentQueueWaitTimeout)
+	scanQueue := queue.New("scan", cfg.ScanWorkers, 0, 0)
+	ag.SetQueues(runQueue, scanQueue)
+
+	jobQueue, err := openJobs(cfg)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to open job queue")
+	}
+
+	webhookSecrets, err := webhook.ParseSecrets(cfg.WebhookSecrets)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Invalid WEBHOOK_SECRETS")
+	}
+	webhooks := webhook.NewDispatcher(webhook.Config{
+		URLs:        cfg.WebhookURLs,
+		Secret:      cfg.WebhookSecret,
+		Secrets:     webhookSecrets,
+		SummaryOnly: cfg.WebhookSummaryOnly,
+		MaxRetries:  cfg.WebhookMaxRetries,
+		Timeout:     cfg.WebhookTimeout,
+	})
+
+	var jwt *tenant.JWTVerifier
+	if cfg.JWTSecret != "" {
+		jwt = tenant.NewJWTVerifier(cfg.JWTSecret, cfg.JWTIssuer, cfg.JWTAudience)
+	}
+	tenants, err := tenant.NewResolver(cfg.APIKeys, jwt)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Invalid API key configuration")
+	}
+	if cfg.AuthRequired && !tenants.Enabled() {
+		log.Fatal().Msg("AUTH_REQUIRED is set but neither API_KEYS nor JWT_SECRET is configured")
+	}
+
+	if cfg.RegistryWebhookTenant != "" {
+		if _, err := tenant.Parse(cfg.RegistryWebhookTenant); err != nil {
+			log.Fatal().Err(err).Msg("Invalid REGISTRY_WEBHOOK_TENANT")
+		}
 	}
 
 	// Create Gin engine
-	r := gin.Default()
+	r := gin.New()
+	r.Use(api.RequestID(), api.AccessLog(), gin.Recovery())
+	if cfg.TracingEnabled {
+		r.Use(tracing.Middleware())
+	}
+	if len(cfg.CORSAllowedOrigins) > 0 {
+		if cfg.CORSAllowCredentials && slices.Contains(cfg.CORSAllowedOrigins, "*") {
+			log.Fatal().Msg("CORS_ALLOW_CREDENTIALS needs explicit CORS_ALLOWED_ORIGINS, not \"*\"")
+		}
+		r.Use(api.CORS(cfg))
+	}
+
+	// Scheduled scans go through the same path as API-triggered ones
+	var h *api.Handler
+	var sched *scheduler.Scheduler
+	if cfg.SchedulerEnabled {
+		sched, err = scheduler.New(st, func(ctx context.Context, t store.Target) error {
+			return h.ScheduledScan(ctx, t)
+		}, cfg.ScheduleDefault, cfg.SchedulerSelector, cfg.SchedulerConcurrency)
+		if err != nil {
+			log.Fatal().Err(err).Msg("Invalid SCHEDULE_DEFAULT or SCHEDULER_SELECTOR")
+		}
+		sched.SetRetry(scheduler.RetryPolicy{
+			MaxAttempts: cfg.QueueMaxAttempts,
+			Backoff:     cfg.QueueRetryBackoff,
+			Retryable:   failure.Retryable,
+		})
+	}
+
+	purger := retention.New(st, retention.Policy{
+		RawOutput: cfg.RetentionRawOutput,
+		Scans:     cfg.RetentionScans,
+	})
+	if cfg.RetentionInterval > 0 {
+		go purger.Run(cfg.RetentionInterval, nil)
+	}
+
+	workspaces, err := workspace.New(cmp.Or(cfg.WorkspaceDir, filepath.Join(cfg.DataDir, "workspaces")), cfg.WorkspaceTTL, cfg.WorkspaceMaxBytes)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to open workspaces")
+	}
+	if cfg.WorkspaceSweepInterval > 0 {
+		go workspaces.Run(cfg.WorkspaceSweepInterval, nil)
+	}
+
+	if cfg.RegistryCrawlURL != "" {
+		crawl, err := openCrawler(cfg, st)
+		if err != nil {
+			log.Fatal().Err(err).Msg("Invalid registry crawler configuration")
+		}
+		if cfg.RegistryCrawlInterval > 0 {
+			go crawl.Run(cfg.RegistryCrawlInterval, nil)
+		}
+	}
+
+	if cfg.OperatorEnabled {
+		op, err := openOperator(cfg, st, func(ctx context.Context, t store.Target) error {
+			return h.ScanTarget(ctx, t)
+		})
+		if err != nil {
+			log.Fatal().Err(err).Msg("Invalid operator configuration")
+		}
+		if !cfg.SchedulerEnabled {
+			log.Warn().Msg("OPERATOR_ENABLED is set but SCHEDULER_ENABLED is not; ScanTargets are scanned only once")
+		}
+		go op.Run(cfg.OperatorResync, nil)
+		log.Info().Str("namespace", cfg.OperatorNamespace).Msg("Operator started")
+	}
+
+	var fleet *cluster.Scanner
+	if cfg.ClusterScanEnabled {
+		fleet, err = openClusterScanner(cfg, func(ctx context.Context, ref string) (*store.Scan, error) {
+			return h.ScanClusterImage(ctx, ref)
+		})
+		if err != nil {
+			log.Fatal().Err(err).Msg("Invalid cluster scan configuration")
+		}
+	}
+
+	if err := (gate.Policy{FailOn: cfg.GateFailOn, MaxRiskScore: cfg.GateMaxRiskScore}).Validate(); err != nil {
+		log.Fatal().Err(err).Msg("Invalid GATE_FAIL_ON or GATE_MAX_RISK_SCORE")
+	}
+
+	trackers, err := openTrackers(cfg, st)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Invalid issue tracker configuration")
+	}
+
+	notifiers, err := openNotifiers(cfg)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Invalid notification configuration")
+	}
+
+	rules, err := openPolicy(cfg, st)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Invalid policy")
+	}
+	meter, err := openQuota(cfg, st)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Invalid quotas")
+	}
+
+	catalog := kev.New(cmp.Or(cfg.KEVURL, kev.DefaultURL), filepath.Join(cfg.DataDir, "kev.json"))
+	alerter, err := openAlerter(cfg, st, catalog)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Invalid alerting configuration")
+	}
+	if (alerter != nil || rules != nil) && cfg.KEVRefreshInterval > 0 {
+		go catalog.Run(cfg.KEVRefreshInterval, nil)
+	}
+
+	var dojo *defectdojo.Exporter
+	if cfg.DefectDojoURL != "" {
+		if cfg.DefectDojoAPIKey == "" {
+			log.Fatal().Msg("DEFECTDOJO_URL requires DEFECTDOJO_API_KEY")
+		}
+		dojo = defectdojo.NewExporter(defectdojo.New(cfg.DefectDojoURL, cfg.DefectDojoAPIKey),
+			cfg.DefectDojoProductType, cfg.DefectDojoEngagement, defectdojo.Options{
+				MinimumSeverity:  cfg.DefectDojoMinimumSeverity,
+				CloseOldFindings: cfg.DefectDojoCloseOldFindings,
+			})
+	}
+
+	var dt *deptrack.Client
+	if cfg.DependencyTrackURL != "" {
+		if cfg.DependencyTrackAPIKey == "" {
+			log.Fatal().Msg("DEPENDENCY_TRACK_URL requires DEPENDENCY_TRACK_API_KEY")
+		}
+		if !cfg.SBOMEnabled {
+			log.Warn().Msg("DEPENDENCY_TRACK_URL is set but SBOM_ENABLED is not; no SBOMs will be uploaded")
+		}
+		dt = deptrack.New(cfg.DependencyTrackURL, cfg.DependencyTrackAPIKey)
+	}
+
+	var attester *attest.Signer
+	if cfg.AttestationKey != "" {
+		attester, err = attest.LoadSigner(cfg.AttestationKey)
+		if err != nil {
+			log.Fatal().Err(err).Msg("Invalid ATTESTATION_KEY")
+		}
+		if _, err := exec.LookPath("cosign"); cfg.AttestationAttach && err != nil {
+			log.Warn().Msg("ATTESTATION_ATTACH is set but the cosign CLI is not in PATH; attestations cannot be attached")
+		}
+	} else if cfg.AttestationAttach {
+		log.Fatal().Msg("ATTESTATION_ATTACH requires ATTESTATION_KEY")
+	}
+
+	tokenGrants, err := github.ParseGrants(cfg.GitHubTokenRepos)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Invalid GITHUB_TOKEN_REPOS")
+	}
+
+	var mailer *email.Mailer
+	recipients, err := email.ParseRoutes(cfg.EmailRecipients)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Invalid EMAIL_RECIPIENTS")
+	}
+	if cfg.SMTPHost != "" {
+		mailer, err = email.New(email.Config{
+			Host:     cfg.SMTPHost,
+			Port:     cfg.SMTPPort,
+			Username: cfg.SMTPUsername,
+			Password: cfg.SMTPPassword,
+			From:     cfg.SMTPFrom,
+			TLS:      cfg.SMTPTLS,
+		})
+		if err != nil {
+			log.Fatal().Err(err).Msg("Invalid SMTP configuration")
+		}
+	}
+
+	allow, err := allowlist.New(cfg.ScanFileRoots, cfg.ScanImageRegistries)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Invalid SCAN_FILE_ROOTS")
+	}
+	if len(cfg.ScanFileRoots) == 0 {
+		log.Warn().Msg("SCAN_FILE_ROOTS is not set; file scans may read any path on this host")
+	}
+
+	hub := notify.NewHub(cfg.PublicURL, notifiers...)
 
 	// Setup routes
-	routes := api.SetupRoutes()
-	routes(r)
+	h = api.NewHandler(cfg, api.Deps{
+		Store:           st,
+		Agent:           ag,
+		Webhooks:        webhooks,
+		Tenants:         tenants,
+		Scheduler:       sched,
+		Purger:          purger,
+		Workspaces:      workspaces,
+		Trackers:        trackers,
+		Notify:          hub,
+		Alerter:         alerter,
+		DefectDojo:      dojo,
+		DependencyTrack: dt,
+		Cluster:         fleet,
+		Attester:        attester,
+		RunQueue:        runQueue,
+		ScanQueue:       scanQueue,
+		Jobs:            jobQueue,
+		Allowlist:       allow,
+		Policy:          rules,
+		KEV:             catalog,
+		Quota:           meter,
+
+		Mailer:     mailer,
+		Recipients: recipients,
+
+		TokenGrants: tokenGrants,
+	})
+	api.SetupRoutes(h)(r)
+
+	if jobQueue != nil {
+		jobQueue.Start(cfg.QueueWorkers, h.RunJob, nil)
+	}
+
+	if sched != nil {
+		if err := sched.AddJob(cfg.DigestSchedule, "digest", h.SendDigests); err != nil {
+			log.Fatal().Err(err).Msg("Invalid DIGEST_SCHEDULE")
+		}
+		if err := sched.AddJob(cfg.WatchSchedule, "watch", h.CheckWatches); err != nil {
+			log.Fatal().Err(err).Msg("Invalid WATCH_SCHEDULE")
+		}
+		if err := sched.AddJob(cfg.ReportDeliverySchedule, "report-delivery", h.DeliverReports); err != nil {
+			log.Fatal().Err(err).Msg("Invalid REPORT_DELIVERY_SCHEDULE")
+		}
+		if err := sched.AddJob(cfg.FreshnessSchedule, "freshness", h.CheckFreshness); err != nil {
+			log.Fatal().Err(err).Msg("Invalid FRESHNESS_SCHEDULE")
+		}
+		if fleet != nil {
+			if err := sched.AddJob(cfg.ClusterScanSchedule, "cluster-scan", h.ScanCluster); err != nil {
+				log.Fatal().Err(err).Msg("Invalid CLUSTER_SCAN_SCHEDULE")
+			}
+		}
+		if cfg.ServiceNowURL != "" {
+			if err := sched.AddJob(cfg.ServiceNowSyncSchedule, "ticket-sync", h.SyncTickets); err != nil {
+				log.Fatal().Err(err).Msg("Invalid SERVICENOW_SYNC_SCHEDULE")
+			}
+		}
+		sched.Start(cfg.SchedulerSyncInterval, nil)
+		log.Info().Str("default", cfg.ScheduleDefault).Msg("Scheduler started")
+	}
+
+	reload := newReloader(cfg, st, ag, sched, hub, h, sec)
+	if cfg.ConfigReloadInterval > 0 {
+		go reload.Watch(cfg.ConfigReloadInterval, nil)
+	}
+	if cfg.SecretsRefreshInterval > 0 {
+		go sec.Watch(cfg.SecretsRefreshInterval, nil, reload.SecretsRotated)
+	}
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			reload.Reload()
+		}
+	}()
 
 	// Start server
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
+	srv := &http.Server{
+		Addr:    ":" + cfg.Port,
+		Handler: r,
+	}
+
+	if cfg.TLSEnabled() {
+		clientAuth, err := certs.ParseClientAuth(cfg.TLSClientAuth)
+		if err != nil {
+			log.Fatal().Err(err).Msg("Invalid TLS configuration")
+		}
+		reloader, err := certs.NewReloader(cfg.TLSCertFile, cfg.TLSKeyFile, cfg.TLSClientCAFile, clientAuth)
+		if err != nil {
+			log.Fatal().Err(err).Msg("Failed to load TLS certificate")
+		}
+		if cfg.TLSReloadInterval > 0 {
+			go reloader.Watch(cfg.TLSReloadInterval, nil)
+		}
+		srv.TLSConfig = reloader.TLSConfig()
+
+		log.Info().Msgf("Starting HTTPS server on port %s", cfg.Port)
+		if err := srv.ListenAndServeTLS("", ""); err != nil {
+			log.Fatal().Err(err).Msg("Failed to start server")
+		}
+		return
 	}
-	log.Info().Msgf("Starting server on port %s", port)
-	if err := r.Run(":" + port); err != nil {
+
+	log.Info().Msgf("Starting server on port %s", cfg.Port)
+	if err := srv.ListenAndServe(); err != nil {
 		log.Fatal().Err(err).Msg("Failed to start server")
 	}
 }
+
+// installTrivy downloads the pinned Trivy release, or reuses an earlier
+// download.
+func installTrivy(cfg *config.Config) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Minute)
+	defer cancel()
+	path, err := trivy.Install(ctx, trivy.InstallOptions{
+		Dir:         cmp.Or(cfg.TrivyInstallDir, filepath.Join(cfg.DataDir, "trivy")),
+		Version:     cfg.TrivyVersion,
+		DownloadURL: cfg.TrivyDownloadURL,
+		SHA256:      cfg.TrivySHA256,
+	})
+	if err != nil {
+		return err
+	}
+	trivy.SetBinary(path)
+	log.Info().Str("path", path).Msg("Using downloaded Trivy")
+	return nil
+}
+
+// openJobs connects to the shared job queue, or returns nil to run
+// background scans on this replica.
+func openJobs(cfg *config.Config) (*jobs.Queue, error) {
+	switch cfg.QueueBackend {
+	case "", "memory":
+		return nil, nil
+	case "redis":
+		// Replicas taking each other's jobs must see the same targets.
+		if cfg.StoreBackend != store.BackendPostgres {
+			return nil, fmt.Errorf("QUEUE_BACKEND=redis needs STORE_BACKEND=postgres, which the replicas share")
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		q, err := jobs.Open(ctx, jobs.Options{
+			URL:          cfg.RedisURL,
+			Prefix:       cfg.QueuePrefix,
+			MaxAttempts:  cfg.QueueMaxAttempts,
+			RetryBackoff: cfg.QueueRetryBackoff,
+		})
+		if err != nil {
+			return nil, err
+		}
+		log.Info().Str("prefix", cfg.QueuePrefix).Msg("Using the Redis job queue")
+		return q, nil
+	default:
+		return nil, fmt.Errorf("unknown QUEUE_BACKEND %q; use memory or redis", cfg.QueueBackend)
+	}
+}
+
+// openBlobs returns the configured blob store, or nil to keep blobs inline.
+func openBlobs(cfg *config.Config) (store.BlobStore, error) {
+	s3 := store.S3Config{
+		Endpoint:        cfg.BlobEndpoint,
+		Region:          cfg.BlobRegion,
+		Bucket:          cfg.BlobBucket,
+		Prefix:          cfg.BlobPrefix,
+		AccessKeyID:     cfg.BlobAccessKey,
+		SecretAccessKey: cfg.BlobSecretKey,
+		Insecure:        cfg.BlobInsecure,
+	}
+
+	switch cfg.BlobBackend {
+	case "":
+		return nil, nil
+	case "file":
+		return store.NewFileBlobs(filepath.Join(cfg.DataDir, "blobs")), nil
+	case "s3":
+		if s3.Endpoint == "" {
+			s3.Endpoint = "s3.amazonaws.com"
+		}
+		return store.NewS3Blobs(s3)
+	case "gcs":
+		if s3.Endpoint == "" {
+			s3.Endpoint = "storage.googleapis.com"
+		}
+		return store.NewS3Blobs(s3)
+	default:
+		return nil, fmt.Errorf("unknown BLOB_BACKEND %q", cfg.BlobBackend)
+	}
+}
+
+// openTrackers returns a filer for every configured issue tracker.
+func openTrackers(cfg *config.Config, st *store.Store) ([]*tickets.Filer, error) {
+	var filers []*tickets.Filer
+	if cfg.GitHubIssuesRepo != "" {
+		if err := github.ValidateRepo(cfg.GitHubIssuesRepo); err != nil {
+			return nil, fmt.Errorf("GITHUB_ISSUES_REPO: %w", err)
+		}
+		if cfg.GitHubToken == "" {
+			return nil, fmt.Errorf("GITHUB_ISSUES_REPO requires GITHUB_TOKEN")
+		}
+		f, err := tickets.New(st, &tickets.GitHub{
+			Client:    github.New(cfg.GitHubAPIURL, cfg.GitHubToken),
+			Repo:      cfg.GitHubIssuesRepo,
+			Labels:    cfg.GitHubIssuesLabels,
+			Assignees: cfg.GitHubIssuesAssignees,
+		}, tickets.Options{
+			MaxPriority:  cfg.GitHubIssuesMaxPriority,
+			Title:        cfg.GitHubIssuesTitle,
+			BodyTemplate: cfg.GitHubIssuesTemplate,
+		})
+		if err != nil {
+			return nil, err
+		}
+		filers = append(filers, f)
+	}
+
+	if cfg.JiraURL != "" {
+		if cfg.JiraProject == "" {
+			return nil, fmt.Errorf("JIRA_URL requires JIRA_PROJECT")
+		}
+		overrides, err := parsePairs("JIRA_PRIORITIES", cfg.JiraPriorities)
+		if err != nil {
+			return nil, err
+		}
+		priorities := maps.Clone(tickets.DefaultJiraPriorities)
+		for sev, name := range overrides {
+			priorities[strings.ToUpper(sev)] = name
+		}
+		var custom map[string]any
+		if cfg.JiraCustomFields != "" {
+			if err := json.Unmarshal([]byte(cfg.JiraCustomFields), &custom); err != nil {
+				return nil, fmt.Errorf("JIRA_CUSTOM_FIELDS must be a JSON object: %w", err)
+			}
+		}
+		f, err := tickets.New(st, &tickets.Jira{
+			Client:       jira.New(cfg.JiraURL, cfg.JiraUser, cfg.JiraToken),
+			Project:      cfg.JiraProject,
+			IssueType:    cfg.JiraIssueType,
+			Priorities:   priorities,
+			Labels:       cfg.JiraLabels,
+			CustomFields: custom,
+		}, tickets.Options{
+			MaxPriority:  cfg.JiraMaxPriority,
+			Title:        cfg.JiraTitle,
+			BodyTemplate: cfg.JiraTemplate,
+		})
+		if err != nil {
+			return nil, err
+		}
+		filers = append(filers, f)
+	}
+
+	if cfg.ServiceNowURL != "" {
+		if err := scheduler.Validate(cfg.ServiceNowSyncSchedule); err != nil {
+			return nil, fmt.Errorf("SERVICENOW_SYNC_SCHEDULE: %w", err)
+		}
+		levels, err := parseServiceNowLevels(cfg.ServiceNowLevels)
+		if err != nil {
+			return nil, err
+		}
+		var custom map[string]any
+		if cfg.ServiceNowFields != "" {
+			if err := json.Unmarshal([]byte(cfg.ServiceNowFields), &custom); err != nil {
+				return nil, fmt.Errorf("SERVICENOW_FIELDS must be a JSON object: %w", err)
+			}
+		}
+		f, err := tickets.New(st, &tickets.ServiceNow{
+			Client: servicenow.New(cfg.ServiceNowURL, cfg.ServiceNowUser, cfg.ServiceNowPassword, cfg.ServiceNowToken),
+			Table:  cfg.ServiceNowTable,
+			Levels: levels,
+			Fields: custom,
+		}, tickets.Options{
+			MaxPriority:  cfg.ServiceNowMaxPriority,
+			Title:        cfg.ServiceNowTitle,
+			BodyTemplate: cfg.ServiceNowTemplate,
+		})
+		if err != nil {
+			return nil, err
+		}
+		filers = append(filers, f)
+	}
+	return filers, nil
+}
+
+// parseServiceNowLevels applies "PRIORITY=urgency/impact" overrides to the
+// default mapping.
+func parseServiceNowLevels(list []string) (map[int]tickets.Levels, error) {
+	pairs, err := parsePairs("SERVICENOW_LEVELS", list)
+	if err != nil {
+		return nil, err
+	}
+	levels := maps.Clone(tickets.DefaultServiceNowLevels)
+	for k, v := range pairs {
+		priority, err := strconv.Atoi(strings.TrimPrefix(strings.ToUpper(k), "P"))
+		u, i, ok := strings.Cut(v, "/")
+		var l tickets.Levels
+		if ok {
+			l.Urgency, _ = strconv.Atoi(u)
+			l.Impact, _ = strconv.Atoi(i)
+		}
+		if err != nil || l.Urgency < 1 || l.Urgency > 3 || l.Impact < 1 || l.Impact > 3 {
+			return nil, fmt.Errorf("SERVICENOW_LEVELS: %q is not PRIORITY=urgency/impact with levels 1 to 3", k+"="+v)
+		}
+		levels[priority] = l
+	}
+	return levels, nil
+}
+
+// openNotifiers returns the configured chat notifiers.
+func openNotifiers(cfg *config.Config) ([]notify.Notifier, error) {
+	var notifiers []notify.Notifier
+	if cfg.SlackWebhookURL != "" || cfg.SlackBotToken != "" {
+		if cfg.SlackBotToken != "" && cfg.SlackChannel == "" {
+			return nil, fmt.Errorf("SLACK_BOT_TOKEN requires SLACK_CHANNEL")
+		}
+		routes, err := parsePairs("SLACK_TEAM_CHANNELS", cfg.SlackTeamChannels)
+		if err != nil {
+			return nil, err
+		}
+		notifiers = append(notifiers, &notify.Slack{
+			WebhookURL: cfg.SlackWebhookURL,
+			Token:      cfg.SlackBotToken,
+			Channel:    cfg.SlackChannel,
+			Routes:     routes,
+			RouteLabel: cfg.SlackChannelLabel,
+			APIURL:     cfg.SlackAPIURL,
+		})
+	}
+	if cfg.TeamsWebhookURL != "" {
+		notifiers = append(notifiers, &notify.Teams{WebhookURL: cfg.TeamsWebhookURL})
+	}
+	if cfg.DiscordWebhookURL != "" {
+		notifiers = append(notifiers, &notify.Discord{WebhookURL: cfg.DiscordWebhookURL})
+	}
+
+	commands, err := parsePairs("NOTIFY_EXEC", cfg.NotifyExec)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range slices.Sorted(maps.Keys(commands)) {
+		args := strings.Fields(commands[name])
+		if len(args) == 0 {
+			return nil, fmt.Errorf("NOTIFY_EXEC: %s has no command", name)
+		}
+		notifiers = append(notifiers, &notify.Exec{Label: name, Command: args, Timeout: cfg.NotifyExecTimeout, Env: cfg.NotifyExecEnv})
+	}
+	urls, err := parsePairs("NOTIFY_WEBHOOKS", cfg.NotifyWebhooks)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range slices.Sorted(maps.Keys(urls)) {
+		if _, err := url.ParseRequestURI(urls[name]); err != nil {
+			return nil, fmt.Errorf("NOTIFY_WEBHOOKS: %s: %w", name, err)
+		}
+		notifiers = append(notifiers, &notify.HTTP{Label: name, URL: urls[name]})
+	}
+	return notifiers, nil
+}
+
+// openPolicy returns the policy rules saved through the admin API, else
+// those of POLICY_FILE, or nil without rules.
+func openPolicy(cfg *config.Config, st *store.Store) (*policy.Engine, error) {
+	var rules policy.Rules
+	switch err := st.GetSetting(api.PolicySetting, &rules); {
+	case err == nil:
+	case !errors.Is(err, store.ErrNotFound):
+		return nil, err
+	case cfg.PolicyFile != "":
+		if rules, err = policy.Load(cfg.PolicyFile); err != nil {
+			return nil, err
+		}
+	}
+	if len(rules.Rules) == 0 {
+		return nil, nil
+	}
+	return policy.Compile(rules)
+}
+
+// openExperiments returns the prompt experiments saved through the admin
+// API, else those of EXPERIMENTS_FILE, or nil without any.
+func openExperiments(cfg *config.Config, st *store.Store) (*experiment.Set, error) {
+	var c experiment.Config
+	switch err := st.GetSetting(api.ExperimentsSetting, &c); {
+	case err == nil:
+	case !errors.Is(err, store.ErrNotFound):
+		return nil, err
+	case cfg.ExperimentsFile != "":
+		if c, err = experiment.Load(cfg.ExperimentsFile); err != nil {
+			return nil, err
+		}
+	}
+	if len(c.Experiments) == 0 {
+		return nil, nil
+	}
+	return experiment.Compile(c)
+}
+
+// openScoring returns the scoring hooks saved through the admin API, else
+// those of SCORING_FILE, or nil without any.
+func openScoring(cfg *config.Config, st *store.Store) (*scoring.Engine, error) {
+	var h scoring.Hooks
+	switch err := st.GetSetting(api.ScoringSetting, &h); {
+	case err == nil:
+	case !errors.Is(err, store.ErrNotFound):
+		return nil, err
+	case cfg.ScoringFile != "":
+		if h, err = scoring.Load(cfg.ScoringFile); err != nil {
+			return nil, err
+		}
+	}
+	if len(h.Hooks) == 0 {
+		return nil, nil
+	}
+	return scoring.Compile(h)
+}
+
+// openQuota returns the quota meter with the budgets saved through the
+// admin API.
+func openQuota(cfg *config.Config, st *store.Store) (*quota.Meter, error) {
+	m := quota.New(st, cfg.QuotaCostPer1KTokens)
+	var c quota.Config
+	switch err := st.GetSetting(api.QuotasSetting, &c); {
+	case err == nil:
+	case !errors.Is(err, store.ErrNotFound):
+		return nil, err
+	}
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	m.SetBudgets(c)
+	return m, nil
+}
+
+// openAlerter returns the on-call alerter, or nil when no pager is
+// configured.
+func openAlerter(cfg *config.Config, st *store.Store, catalog *kev.Catalog) (*alert.Alerter, error) {
+	var pagers []alert.Pager
+	if cfg.PagerDutyRoutingKey != "" {
+		pagers = append(pagers, &alert.PagerDuty{RoutingKey: cfg.PagerDutyRoutingKey, URL: cfg.PagerDutyURL})
+	}
+	if cfg.OpsgenieAPIKey != "" {
+		pagers = append(pagers, &alert.Opsgenie{APIKey: cfg.OpsgenieAPIKey, URL: cfg.OpsgenieURL, Tags: cfg.OpsgenieTags})
+	}
+	if len(pagers) == 0 {
+		return nil, nil
+	}
+	if !slices.Contains(trivy.Severities, strings.ToUpper(cfg.AlertMinSeverity)) {
+		return nil, fmt.Errorf("ALERT_MIN_SEVERITY: unknown severity %q", cfg.AlertMinSeverity)
+	}
+	return alert.New(st, catalog, alert.Options{
+		MinSeverity:   cfg.AlertMinSeverity,
+		CVSSThreshold: cfg.AlertCVSSThreshold,
+		PublicURL:     cfg.PublicURL,
+	}, pagers...), nil
+}
+
+func openCrawler(cfg *config.Config, st *store.Store) (*crawler.Crawler, error) {
+	owner, err := tenant.Parse(cfg.RegistryCrawlTenant)
+	if err != nil {
+		return nil, fmt.Errorf("REGISTRY_CRAWL_TENANT: %w", err)
+	}
+	if err := scheduler.Validate(cfg.RegistryCrawlSchedule); err != nil {
+		return nil, fmt.Errorf("REGISTRY_CRAWL_SCHEDULE: %w", err)
+	}
+	extra, err := parsePairs("REGISTRY_CRAWL_LABELS", cfg.RegistryCrawlLabels)
+	if err != nil {
+		return nil, err
+	}
+	if err := labels.Validate(extra); err != nil {
+		return nil, fmt.Errorf("REGISTRY_CRAWL_LABELS: %w", err)
+	}
+	client, err := registry.New(cfg.RegistryCrawlURL, cfg.RegistryCrawlUsername, cfg.RegistryCrawlPassword)
+	if err != nil {
+		return nil, err
+	}
+	return crawler.New(st, client, crawler.Options{
+		Org:      owner.Org,
+		Project:  owner.Project,
+		Include:  cfg.RegistryCrawlInclude,
+		Exclude:  cfg.RegistryCrawlExclude,
+		MaxTags:  cfg.RegistryCrawlMaxTags,
+		Schedule: cfg.RegistryCrawlSchedule,
+		Labels:   extra,
+		Prune:    cfg.RegistryCrawlPrune,
+	})
+}
+
+// openSecrets returns a resolver for the configured secret stores.
+// Kubernetes secrets are read through the API only when referenced, so a
+// server outside a cluster needs no Kubernetes access.
+func openSecrets(cfg *config.Config) (*secrets.Resolver, error) {
+	providers := map[string]secrets.Provider{
+		secrets.SchemeFile: secrets.File{},
+		secrets.SchemeAWS:  secrets.AWS{},
+	}
+	if cfg.VaultAddr != "" {
+		vault, err := secrets.NewVault(secrets.VaultOptions{
+			Addr:      cfg.VaultAddr,
+			Namespace: cfg.VaultNamespace,
+			Token:     cfg.VaultToken,
+			Role:      cfg.VaultRole,
+			AuthPath:  cfg.VaultAuthPath,
+		})
+		if err != nil {
+			return nil, err
+		}
+		providers[secrets.SchemeVault] = vault
+	}
+	for _, kv := range os.Environ() {
+		_, value, _ := strings.Cut(kv, "=")
+		if scheme, _, _, ok := secrets.Parse(value); ok && scheme == secrets.SchemeKube {
+			client, err := openKube(cfg)
+			if err != nil {
+				return nil, err
+			}
+			providers[secrets.SchemeKube] = secrets.Kube{Client: client, Namespace: secrets.KubeNamespace()}
+			break
+		}
+	}
+	return secrets.NewResolver(providers), nil
+}
+
+func openKube(cfg *config.Config) (*kube.Client, error) {
+	if cfg.KubeAPIURL != "" {
+		return kube.New(cfg.KubeAPIURL, cfg.KubeToken, cfg.KubeCAFile)
+	}
+	return kube.InCluster()
+}
+
+func openOperator(cfg *config.Config, st *store.Store, scan scheduler.ScanFunc) (*operator.Operator, error) {
+	if cfg.OperatorResync <= 0 {
+		return nil, fmt.Errorf("OPERATOR_RESYNC must be positive")
+	}
+	if _, err := tenant.Parse(cfg.OperatorOrg + "/default"); err != nil {
+		return nil, fmt.Errorf("OPERATOR_ORG: %w", err)
+	}
+	client, err := openKube(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return operator.New(st, client, scan, operator.Options{
+		Namespace: cfg.OperatorNamespace,
+		Org:       cfg.OperatorOrg,
+	}), nil
+}
+
+func openClusterScanner(cfg *config.Config, scan cluster.ScanFunc) (*cluster.Scanner, error) {
+	if _, err := tenant.Parse(cfg.ClusterScanTenant); err != nil {
+		return nil, fmt.Errorf("CLUSTER_SCAN_TENANT: %w", err)
+	}
+	if err := scheduler.Validate(cfg.ClusterScanSchedule); err != nil {
+		return nil, fmt.Errorf("CLUSTER_SCAN_SCHEDULE: %w", err)
+	}
+	client, err := openKube(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return cluster.NewScanner(client, scan, cluster.DiscoverOptions{
+		Namespace:         cfg.ClusterScanNamespace,
+		ExcludeNamespaces: cfg.ClusterScanExcludeNamespaces,
+		OwnerLabel:        cfg.ClusterScanOwnerLabel,
+	}, cfg.ClusterScanConcurrency), nil
+}
+
+func openVerifier(cfg *config.Config) (*cosign.Verifier, error) {
+	v := &cosign.Verifier{
+		Keys:            cfg.CosignKeys,
+		AttestationType: cfg.CosignAttestationType,
+		Timeout:         cfg.CosignTimeout,
+	}
+	for _, s := range cfg.CosignIdentities {
+		id, err := cosign.ParseIdentity(s)
+		if err != nil {
+			return nil, fmt.Errorf("COSIGN_IDENTITIES: %w", err)
+		}
+		v.Identities = append(v.Identities, id)
+	}
+	return v, nil
+}
+
+// parsePairs reads "key=value" list entries.
+func parsePairs(name string, list []string) (map[string]string, error) {
+	out := make(map[string]string, len(list))
+	for _, pair := range list {
+		k, v, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("%s: %q is not key=value", name, pair)
+		}
+		out[strings.TrimSpace(k)] = strings.TrimSpace(v)
+	}
+	return out, nil
+}
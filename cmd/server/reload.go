@@ -0,0 +1,351 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+	"weeklysec/internal/agent"
+	"weeklysec/internal/api"
+	"weeklysec/internal/config"
+	"weeklysec/internal/email"
+	"weeklysec/internal/i18n"
+	"weeklysec/internal/llm"
+	"weeklysec/internal/notify"
+	"weeklysec/internal/report"
+	"weeklysec/internal/scheduler"
+	"weeklysec/internal/secrets"
+	"weeklysec/internal/store"
+
+	"github.com/joho/godotenv"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+// Settings the reloader applies without a restart, by what they affect.
+// The LLM client reads OPENROUTER_API_KEY and LLM_MODEL from the
+// environment on every call, so updating the environment applies them.
+var (
+	agentKeys    = []string{"LLM_MODEL", "AGENT_PRIORITY_THRESHOLD", "AGENT_TOKEN_BUDGET", "AGENT_MAX_VULNERABILITIES", "LLM_MINIMIZE_DATA"}
+	scheduleKeys = []string{"SCHEDULE_DEFAULT", "DIGEST_SCHEDULE", "WATCH_SCHEDULE", "REPORT_DELIVERY_SCHEDULE", "FRESHNESS_SCHEDULE"}
+	brandingKeys = []string{"REPORT_ORG_NAME", "REPORT_LOGO", "REPORT_CLASSIFICATION", "REPORT_FOOTER"}
+	notifierKeys = []string{
+		"SLACK_WEBHOOK_URL", "SLACK_BOT_TOKEN", "SLACK_CHANNEL", "SLACK_TEAM_CHANNELS",
+		"SLACK_CHANNEL_LABEL", "SLACK_API_URL", "TEAMS_WEBHOOK_URL", "DISCORD_WEBHOOK_URL",
+		"NOTIFY_EXEC", "NOTIFY_EXEC_TIMEOUT", "NOTIFY_WEBHOOKS",
+	}
+	liveKeys = slices.Concat(agentKeys, scheduleKeys, brandingKeys, notifierKeys,
+		[]string{"OPENROUTER_API_KEY", "EMAIL_RECIPIENTS", "PROMPT_DIR", "REPORT_LOCALE", "LOCALE_DIR", "REPORT_TEMPLATE_DIR"})
+)
+
+// reloader applies edits to the env file and the prompt, locale and report
+// template directories while the server runs. Settings without a live
+// setter are logged as needing a restart.
+type reloader struct {
+	st      *store.Store
+	agent   *agent.Agent
+	sched   *scheduler.Scheduler // optional
+	hub     *notify.Hub
+	handler *api.Handler
+	secrets *secrets.Resolver
+
+	mu      sync.Mutex
+	cfg     *config.Config
+	values  map[string]string // the env file as last read
+	pinned  map[string]bool   // set in the process environment, which wins over the file
+	modTime time.Time
+}
+
+func newReloader(cfg *config.Config, st *store.Store, ag *agent.Agent, sched *scheduler.Scheduler, hub *notify.Hub, h *api.Handler, sec *secrets.Resolver) *reloader {
+	r := &reloader{st: st, agent: ag, sched: sched, hub: hub, handler: h, secrets: sec, cfg: cfg, pinned: map[string]bool{}}
+	r.values, _ = godotenv.Read(cfg.ConfigFile)
+	for k, v := range r.values {
+		// A reference in the file holds the secret it was resolved to.
+		if os.Getenv(k) != v && sec.Ref(k) != v {
+			r.pinned[k] = true
+		}
+	}
+	r.modTime, _ = r.latestModTime()
+	return r
+}
+
+// Watch polls the env file and the prompt, locale and report template
+// directories every interval and reloads when they change. It returns when stop is closed.
+func (r *reloader) Watch(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			r.mu.Lock()
+			modTime, err := r.latestModTime()
+			changed := err == nil && !modTime.Equal(r.modTime)
+			if changed {
+				r.modTime = modTime
+			}
+			r.mu.Unlock()
+			if err != nil {
+				log.Warn().Err(err).Msg("Failed to stat configuration files")
+			}
+			if changed {
+				r.Reload()
+			}
+		}
+	}
+}
+
+// Reload re-reads the env file and the prompt, locale and report template
+// directories and applies what changed. A setting that fails to apply keeps its previous
+// value.
+func (r *reloader) Reload() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	values, err := godotenv.Read(r.cfg.ConfigFile)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		log.Error().Err(err).Str("file", r.cfg.ConfigFile).Msg("Failed to read configuration, keeping the current one")
+		return
+	}
+	var changed []string
+	for k := range joinKeys(r.values, values) {
+		if r.pinned[k] || r.values[k] == values[k] {
+			continue
+		}
+		if v, ok := values[k]; ok {
+			if _, err := r.secrets.Track(context.Background(), k, v); err != nil {
+				log.Error().Err(err).Msg("Failed to resolve secret, keeping the current value")
+				values[k] = r.values[k]
+				continue
+			}
+		} else {
+			_ = os.Unsetenv(k)
+		}
+		changed = append(changed, k)
+	}
+	slices.Sort(changed)
+	r.values = values
+	r.apply(changed)
+}
+
+// SecretsRotated applies secrets the resolver updated in the environment.
+func (r *reloader) SecretsRotated(keys []string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.apply(keys)
+}
+
+// apply applies the changed environment variables, with r.mu held.
+func (r *reloader) apply(changed []string) {
+	var err error
+	cfg := config.Load()
+	var applied, restart []string
+	for _, k := range changed {
+		if slices.Contains(liveKeys, k) {
+			applied = append(applied, k)
+		} else {
+			restart = append(restart, k)
+		}
+	}
+
+	if touches(changed, agentKeys) {
+		r.applyAgent(cfg)
+	}
+	if r.sched != nil && slices.Contains(changed, "SCHEDULE_DEFAULT") {
+		if err := r.sched.SetDefault(cfg.ScheduleDefault); err != nil {
+			log.Error().Err(err).Msg("Invalid SCHEDULE_DEFAULT, keeping the current schedule")
+			cfg.ScheduleDefault = r.cfg.ScheduleDefault
+		}
+	}
+	if r.sched != nil && slices.Contains(changed, "DIGEST_SCHEDULE") {
+		if err := r.sched.AddJob(cfg.DigestSchedule, "digest", r.handler.SendDigests); err != nil {
+			log.Error().Err(err).Msg("Invalid DIGEST_SCHEDULE, digests are not scheduled")
+		}
+	}
+	if r.sched != nil && slices.Contains(changed, "WATCH_SCHEDULE") {
+		if err := r.sched.AddJob(cfg.WatchSchedule, "watch", r.handler.CheckWatches); err != nil {
+			log.Error().Err(err).Msg("Invalid WATCH_SCHEDULE, watches are not checked")
+		}
+	}
+	if r.sched != nil && slices.Contains(changed, "REPORT_DELIVERY_SCHEDULE") {
+		if err := r.sched.AddJob(cfg.ReportDeliverySchedule, "report-delivery", r.handler.DeliverReports); err != nil {
+			log.Error().Err(err).Msg("Invalid REPORT_DELIVERY_SCHEDULE, report schedules are not delivered")
+		}
+	}
+	if r.sched != nil && slices.Contains(changed, "FRESHNESS_SCHEDULE") {
+		if err := r.sched.AddJob(cfg.FreshnessSchedule, "freshness", r.handler.CheckFreshness); err != nil {
+			log.Error().Err(err).Msg("Invalid FRESHNESS_SCHEDULE, target freshness is not checked")
+		}
+	}
+	if touches(changed, notifierKeys) {
+		if notifiers, err := openNotifiers(cfg); err != nil {
+			log.Error().Err(err).Msg("Invalid notification configuration, keeping the current notifiers")
+		} else {
+			r.hub.SetNotifiers(notifiers...)
+		}
+	}
+	if touches(changed, brandingKeys) {
+		if b, err := loadBranding(cfg); err != nil {
+			log.Error().Err(err).Msg("Invalid report branding, keeping the current one")
+		} else {
+			report.SetBranding(b)
+		}
+	}
+	if slices.Contains(changed, "EMAIL_RECIPIENTS") {
+		if routes, err := email.ParseRoutes(cfg.EmailRecipients); err != nil {
+			log.Error().Err(err).Msg("Invalid EMAIL_RECIPIENTS, keeping the current recipients")
+		} else {
+			r.handler.SetRecipients(routes)
+		}
+	}
+
+	// Prompt files are re-read on every reload; they are small.
+	prompts := llm.DefaultPrompts()
+	if cfg.PromptDir != "" {
+		prompts, err = llm.LoadPrompts(cfg.PromptDir)
+	}
+	if err != nil {
+		log.Error().Err(err).Str("dir", cfg.PromptDir).Msg("Failed to load prompts, keeping the current ones")
+	} else {
+		llm.SetPrompts(prompts)
+		if cfg.PromptDir != "" {
+			applied = append(applied, "prompts")
+		}
+	}
+
+	// So are locale files.
+	if locales, err := loadLocales(cfg); err != nil {
+		log.Error().Err(err).Str("dir", cfg.LocaleDir).Msg("Failed to load locales, keeping the current ones")
+	} else {
+		i18n.Set(locales)
+		if cfg.LocaleDir != "" || slices.Contains(changed, "REPORT_LOCALE") {
+			applied = append(applied, "locales")
+		}
+	}
+
+	// And report templates.
+	if templates, err := loadTemplates(cfg); err != nil {
+		log.Error().Err(err).Str("dir", cfg.ReportTemplateDir).Msg("Failed to load report templates, keeping the current ones")
+	} else {
+		report.SetTemplates(templates)
+		if cfg.ReportTemplateDir != "" {
+			applied = append(applied, "report templates")
+		}
+	}
+
+	r.cfg = cfg
+	level := zerolog.InfoLevel
+	if len(restart) > 0 {
+		level = zerolog.WarnLevel
+	}
+	log.WithLevel(level).Strs("applied", applied).Strs("restart_required", restart).Msg("Reloaded configuration")
+}
+
+// applyAgent updates the agent's model, threshold, budget and data
+// minimization, unless an admin has saved a configuration, which takes
+// precedence as at startup.
+func (r *reloader) applyAgent(cfg *config.Config) {
+	var saved agent.AgentConfig
+	switch err := r.st.GetSetting(api.AgentConfigSetting, &saved); {
+	case err == nil:
+		log.Warn().Msg("Agent configuration is managed through the admin API; ignoring the environment")
+		return
+	case !errors.Is(err, store.ErrNotFound):
+		log.Error().Err(err).Msg("Failed to load saved agent configuration")
+		return
+	}
+	ac := r.agent.Config()
+	ac.Model, ac.PriorityThreshold, ac.TokenBudget = cfg.LLMModel, cfg.PriorityThreshold, cfg.TokenBudget
+	ac.MaxVulnerabilities, ac.MinimizeData = cfg.MaxVulnerabilities, cfg.LLMMinimizeData
+	if err := r.agent.SetConfig(ac); err != nil {
+		log.Error().Err(err).Msg("Invalid agent configuration, keeping the current one")
+	}
+}
+
+// loadLocales reads the locales of LOCALE_DIR, if set, over the built-in
+// ones and sets REPORT_LOCALE as their default.
+func loadLocales(cfg *config.Config) (*i18n.Catalog, error) {
+	catalog := i18n.Builtin()
+	if cfg.LocaleDir != "" {
+		var err error
+		if catalog, err = i18n.Load(cfg.LocaleDir); err != nil {
+			return nil, err
+		}
+	}
+	return catalog, catalog.SetDefault(cfg.ReportLocale)
+}
+
+// loadTemplates reads the custom report templates of REPORT_TEMPLATE_DIR,
+// if set.
+func loadTemplates(cfg *config.Config) (*report.Templates, error) {
+	if cfg.ReportTemplateDir == "" {
+		return &report.Templates{}, nil
+	}
+	return report.LoadTemplates(cfg.ReportTemplateDir)
+}
+
+// loadBranding reads the branding of reports from REPORT_ORG_NAME and the
+// like.
+func loadBranding(cfg *config.Config) (report.Branding, error) {
+	return report.NewBranding(cfg.ReportOrgName, cfg.ReportLogo, cfg.ReportClassification, cfg.ReportFooter)
+}
+
+// latestModTime is the newest modification time of the env file and the
+// files in the prompt, locale and report template directories.
+func (r *reloader) latestModTime() (time.Time, error) {
+	files := []string{r.cfg.ConfigFile}
+	dirs := []string{r.cfg.PromptDir, r.cfg.LocaleDir}
+	if r.cfg.ReportTemplateDir != "" {
+		for _, kind := range report.TemplateKinds {
+			dirs = append(dirs, filepath.Join(r.cfg.ReportTemplateDir, kind))
+		}
+	}
+	for _, dir := range dirs {
+		if dir == "" {
+			continue
+		}
+		entries, err := os.ReadDir(dir)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return time.Time{}, err
+		}
+		for _, e := range entries {
+			files = append(files, filepath.Join(dir, e.Name()))
+		}
+	}
+	var latest time.Time
+	for _, f := range files {
+		info, err := os.Stat(f)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return time.Time{}, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+func joinKeys(a, b map[string]string) map[string]bool {
+	keys := map[string]bool{}
+	for k := range a {
+		keys[k] = true
+	}
+	for k := range b {
+		keys[k] = true
+	}
+	return keys
+}
+
+// touches reports whether any of keys changed.
+func touches(changed, keys []string) bool {
+	return slices.ContainsFunc(changed, func(k string) bool { return slices.Contains(keys, k) })
+}
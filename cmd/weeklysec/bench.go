@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"weeklysec/internal/agent"
+	"weeklysec/internal/config"
+	"weeklysec/internal/llm"
+	"weeklysec/internal/trivy"
+)
+
+// benchResult is what bench reports.
+type benchResult struct {
+	Runs        int                `json:"runs"`
+	Concurrency int                `json:"concurrency"`
+	Completed   int                `json:"completed"`
+	Partial     int                `json:"partial"`
+	Failed      int                `json:"failed"`
+	Seconds     float64            `json:"seconds"`
+	RunsPerSec  float64            `json:"runs_per_second"`
+	Latency     latency            `json:"latency_ms"`
+	Steps       map[string]latency `json:"steps_ms"`
+	Errors      map[string]int     `json:"errors,omitempty"` // by message
+	Fixtures    []string           `json:"fixtures"`
+}
+
+// latency summarizes durations in milliseconds.
+type latency struct {
+	P50 float64 `json:"p50"`
+	P90 float64 `json:"p90"`
+	P99 float64 `json:"p99"`
+	Max float64 `json:"max"`
+}
+
+func summarize(ms []float64) latency {
+	if len(ms) == 0 {
+		return latency{}
+	}
+	slices.Sort(ms)
+	at := func(q float64) float64 {
+		return ms[int(math.Ceil(q*float64(len(ms))))-1]
+	}
+	return latency{P50: at(0.5), P90: at(0.9), P99: at(0.99), Max: ms[len(ms)-1]}
+}
+
+// benchCommand replays Trivy fixtures through the agent pipeline with the
+// mock LLM and reports throughput and latency, for capacity planning.
+func benchCommand(ctx context.Context, opts options, args []string) error {
+	fs := flag.NewFlagSet("bench", flag.ContinueOnError)
+	fixtureDir := fs.String("fixtures", "", "directory of Trivy JSON reports to replay")
+	runs := fs.Int("runs", 100, "pipeline runs in total")
+	concurrency := fs.Int("concurrency", 4, "runs in flight at once")
+	scanLatency := fs.Duration("scan-latency", 0, "simulated time per scan")
+	llmLatency := fs.Duration("llm-latency", 500*time.Millisecond, "simulated time per LLM call")
+	summarizeRuns := fs.Bool("summarize", true, "run the summary step")
+	remediation := fs.Bool("remediation", true, "run the remediation step")
+	if err := fs.Parse(args); err != nil {
+		return errors.Join(errUsage, err)
+	}
+	if *fixtureDir == "" || *runs < 1 || *concurrency < 1 {
+		return fmt.Errorf("%w: -fixtures is required, and -runs and -concurrency must be positive", errUsage)
+	}
+	if err := trivy.SetFixtures(*fixtureDir, *scanLatency); err != nil {
+		return err
+	}
+	llm.UseMock(*llmLatency)
+
+	cfg := config.Load()
+	ag := agent.New(agent.AgentConfig{
+		PriorityThreshold:  cfg.PriorityThreshold,
+		TokenBudget:        cfg.TokenBudget,
+		MaxVulnerabilities: cfg.MaxVulnerabilities,
+	})
+	fixtures := trivy.Fixtures()
+
+	var (
+		mu     sync.Mutex
+		totals []float64
+		steps  = map[string][]float64{}
+		res    = benchResult{Runs: *runs, Concurrency: *concurrency, Errors: map[string]int{}, Fixtures: fixtures}
+		next   atomic.Int64
+		wg     sync.WaitGroup
+	)
+	start := time.Now()
+	for range *concurrency {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				i := int(next.Add(1)) - 1
+				if i >= *runs || ctx.Err() != nil {
+					return
+				}
+				began := time.Now()
+				resp, _, err := ag.Run(ctx, agent.Request{
+					TargetType:  "image",
+					Target:      fixtures[i%len(fixtures)],
+					Summarize:   *summarizeRuns,
+					Remediation: *remediation,
+				})
+				took := time.Since(began)
+
+				mu.Lock()
+				totals = append(totals, float64(took.Microseconds())/1000)
+				switch {
+				case err != nil:
+					res.Failed++
+					res.Errors[err.Error()]++
+				case resp.Status == agent.StatusPartial:
+					res.Partial++
+				default:
+					res.Completed++
+				}
+				if resp != nil {
+					for _, s := range resp.StepResults {
+						if s.Status == agent.StepSucceeded {
+							steps[s.Step] = append(steps[s.Step], float64(s.DurationMS))
+						}
+						if s.Status == agent.StepFailed && err == nil {
+							res.Errors[s.Step+": "+s.Error]++
+						}
+					}
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	elapsed := time.Since(start)
+	res.Seconds = elapsed.Seconds()
+	res.RunsPerSec = float64(len(totals)) / elapsed.Seconds()
+	res.Latency = summarize(totals)
+	res.Steps = make(map[string]latency, len(steps))
+	for name, ms := range steps {
+		res.Steps[name] = summarize(ms)
+	}
+
+	if opts.format == formatJSON {
+		return printJSON(res)
+	}
+	fmt.Printf("%d runs of %d fixtures, %d at a time, in %.1fs: %.2f runs/s\n",
+		res.Runs, len(fixtures), res.Concurrency, res.Seconds, res.RunsPerSec)
+	fmt.Printf("completed %d  partial %d  failed %d\n\n", res.Completed, res.Partial, res.Failed)
+	fmt.Printf("%-12s %9s %9s %9s %9s\n", "latency ms", "p50", "p90", "p99", "max")
+	row := func(name string, l latency) {
+		fmt.Printf("%-12s %9.1f %9.1f %9.1f %9.1f\n", name, l.P50, l.P90, l.P99, l.Max)
+	}
+	row("run", res.Latency)
+	for _, name := range []string{agent.StepScan, agent.StepAnalyze, agent.StepPrioritize, agent.StepRemediation, agent.StepSummarize} {
+		if l, ok := res.Steps[name]; ok {
+			row(name, l)
+		}
+	}
+	if len(res.Errors) > 0 {
+		fmt.Println("\nerrors:")
+		for msg, n := range res.Errors {
+			fmt.Printf("  %5d  %s\n", n, strings.ReplaceAll(msg, "\n", " "))
+		}
+	}
+	return nil
+}
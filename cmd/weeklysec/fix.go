@@ -0,0 +1,217 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"weeklysec/internal/agent"
+	"weeklysec/internal/fixer"
+	"weeklysec/pkg/client"
+)
+
+// stringList is a repeatable flag.
+type stringList []string
+
+func (l *stringList) String() string     { return strings.Join(*l, ",") }
+func (l *stringList) Set(v string) error { *l = append(*l, v); return nil }
+
+// fixCommand walks through a scan's fixes, letting the user accept, reject
+// or change the version of each, then applies the accepted set to local
+// manifests or opens a pull request with it through the server.
+func fixCommand(ctx context.Context, b backend, opts options, args []string) error {
+	var manifests stringList
+	fs := flag.NewFlagSet("fix", flag.ContinueOnError)
+	fs.Var(&manifests, "manifest", "dependency manifest to preview and patch; repeatable")
+	yes := fs.Bool("yes", false, "accept every fix without asking")
+	repo := fs.String("pr", "", "open a pull request against owner/name instead of editing the manifests")
+	base := fs.String("base", "", "pull request base branch; defaults to the repository's default")
+	branch := fs.String("branch", "", "pull request branch; defaults to weeklysec/fix-<scan id>")
+	if err := fs.Parse(args); err != nil {
+		return errors.Join(errUsage, err)
+	}
+	if fs.NArg() != 1 {
+		return fmt.Errorf("%w: want exactly one SCAN_ID", errUsage)
+	}
+	for _, m := range manifests {
+		if !fixer.Supported(m) {
+			return fmt.Errorf("%w: %s is not a supported manifest", errUsage, m)
+		}
+	}
+	scanID := fs.Arg(0)
+
+	resp, err := b.report(ctx, scanID)
+	if err != nil {
+		return err
+	}
+	if resp.Remediation == nil || len(resp.Remediation.Fixes) == 0 {
+		return errors.New("the scan has no fixes")
+	}
+
+	// Previews read the manifests from disk even for pull requests, where
+	// they are the local checkout of the repository.
+	files := map[string][]byte{}
+	for _, m := range manifests {
+		content, err := os.ReadFile(m)
+		if err != nil && (*repo == "" || !errors.Is(err, os.ErrNotExist)) {
+			return err
+		}
+		files[m] = content
+	}
+
+	accepted := resp.Remediation.Fixes
+	if !*yes {
+		r := &reviewer{in: bufio.NewReader(os.Stdin), out: os.Stdout, manifests: manifests, files: files}
+		accepted = r.review(resp.Remediation.Fixes)
+	}
+	if len(accepted) == 0 {
+		fmt.Println("No fixes accepted.")
+		return nil
+	}
+
+	switch {
+	case *repo != "":
+		pr, err := b.pullRequest(ctx, scanID, client.PullRequestRequest{Repo: *repo, Paths: manifests, Base: *base, Branch: *branch, Fixes: accepted})
+		if err != nil {
+			return err
+		}
+		if opts.format == formatJSON {
+			return printJSON(pr)
+		}
+		fmt.Printf("Opened pull request %s#%d: %s\n", pr.Repo, pr.Number, pr.URL)
+	case len(manifests) > 0:
+		updated := false
+		for _, m := range manifests {
+			out, applied, rejected := fixer.Apply(m, files[m], accepted)
+			for _, r := range rejected {
+				fmt.Fprintf(os.Stderr, "weeklysec: skipped %s %s in %s: %s\n", r.PkgName, r.RecommendedVersion, m, r.Reason)
+			}
+			if len(applied) == 0 {
+				continue
+			}
+			updated = true
+			if err := os.WriteFile(m, out, 0o644); err != nil {
+				return err
+			}
+			names := make([]string, len(applied))
+			for i, f := range applied {
+				names[i] = f.PkgName
+			}
+			fmt.Printf("Updated %s: %s\n", m, strings.Join(names, ", "))
+		}
+		if !updated {
+			fmt.Println("None of the accepted fixes are pinned in the manifests.")
+		}
+	default:
+		// Without manifests or a repository the accepted set is the output,
+		// e.g. for a later -pr run or another tool.
+		if opts.format == formatJSON {
+			return printJSON(accepted)
+		}
+		fmt.Println("Accepted fixes:")
+		for _, f := range accepted {
+			fmt.Printf("- %s\n", f.Description)
+		}
+	}
+	return nil
+}
+
+// reviewer asks about one fix at a time.
+type reviewer struct {
+	in        *bufio.Reader
+	out       io.Writer
+	manifests []string
+	files     map[string][]byte
+}
+
+// review returns the fixes the user accepted, with any versions they
+// changed. End of input rejects the remaining fixes.
+func (r *reviewer) review(fixes []agent.Fix) []agent.Fix {
+	var accepted []agent.Fix
+	for i := 0; i < len(fixes); i++ {
+		fix := fixes[i]
+		for decided := false; !decided; {
+			fmt.Fprintf(r.out, "\n[%d/%d] P%d %s\n", i+1, len(fixes), fix.Priority, fix.Description)
+			r.preview(fix)
+			answer, ok := r.prompt("Accept? [y]es, [n]o, [e]dit version, [a]ll remaining, [q]uit: ")
+			if !ok {
+				return accepted
+			}
+			switch strings.ToLower(answer) {
+			case "y", "yes":
+				accepted = append(accepted, fix)
+				decided = true
+			case "n", "no":
+				decided = true
+			case "e", "edit":
+				version, ok := r.prompt(fmt.Sprintf("Recommended version [%s]: ", fix.RecommendedVersion))
+				if !ok {
+					return accepted
+				}
+				if version != "" {
+					fix.RecommendedVersion = version
+					fix.Description = agent.DescribeFix(fix)
+				}
+			case "a", "all":
+				return append(append(accepted, fix), fixes[i+1:]...)
+			case "q", "quit":
+				return accepted
+			}
+		}
+	}
+	return accepted
+}
+
+// preview shows the lines of each manifest the fix would change, or the
+// version change when no manifest pins the package.
+func (r *reviewer) preview(fix agent.Fix) {
+	shown := false
+	for _, m := range r.manifests {
+		out, applied, rejected := fixer.Apply(m, r.files[m], []agent.Fix{fix})
+		for _, rj := range rejected {
+			fmt.Fprintf(r.out, "  (would break %s: %s)\n", m, rj.Reason)
+			shown = true
+		}
+		if len(applied) == 0 {
+			continue
+		}
+		for _, line := range lineDiff(m, r.files[m], out) {
+			fmt.Fprintln(r.out, "  "+line)
+		}
+		shown = true
+	}
+	if !shown {
+		if len(r.manifests) > 0 {
+			fmt.Fprintf(r.out, "  (not pinned in %s)\n", strings.Join(r.manifests, ", "))
+		}
+		fmt.Fprintf(r.out, "  - %s %s\n  + %s %s\n", fix.PkgName, fix.CurrentVersion, fix.PkgName, fix.RecommendedVersion)
+	}
+}
+
+// prompt reads one trimmed line; false means the input ended.
+func (r *reviewer) prompt(question string) (string, bool) {
+	fmt.Fprint(r.out, question)
+	line, err := r.in.ReadString('\n')
+	if err != nil && line == "" {
+		fmt.Fprintln(r.out)
+		return "", false
+	}
+	return strings.TrimSpace(line), true
+}
+
+// lineDiff lists the changed lines of a manifest. The fixer rewrites lines
+// in place, so lines are compared by position.
+func lineDiff(name string, before, after []byte) []string {
+	old, cur := strings.Split(string(before), "\n"), strings.Split(string(after), "\n")
+	var out []string
+	for i := 0; i < min(len(old), len(cur)); i++ {
+		if old[i] != cur[i] {
+			out = append(out, fmt.Sprintf("%s:%d", name, i+1), "- "+strings.TrimSpace(old[i]), "+ "+strings.TrimSpace(cur[i]))
+		}
+	}
+	return out
+}
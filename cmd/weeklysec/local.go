@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"weeklysec/internal/agent"
+	"weeklysec/internal/config"
+	"weeklysec/internal/digest"
+	"weeklysec/internal/gate"
+	"weeklysec/internal/llm"
+	"weeklysec/internal/store"
+	"weeklysec/internal/tenant"
+	"weeklysec/internal/trivy"
+	"weeklysec/pkg/client"
+)
+
+// local runs the pipeline in-process. Scans are kept under the default
+// tenant of a store in the data directory, so report and history work
+// offline. LLM steps use the same environment as the server.
+type local struct {
+	store *store.Store
+	agent *agent.Agent
+}
+
+func newLocal(dataDir string) (*local, error) {
+	if _, err := exec.LookPath("trivy"); err != nil {
+		return nil, errors.New("trivy CLI not found in PATH; install Trivy or use -server")
+	}
+	st, err := store.Open(store.Options{Dir: dataDir})
+	if err != nil {
+		return nil, err
+	}
+	cfg := config.Load()
+	llm.SetLocal(llm.LocalOptions{URL: cfg.LLMLocalURL, APIKey: cfg.LLMLocalAPIKey, Models: cfg.LLMLocalModels})
+	return &local{
+		store: st,
+		agent: agent.New(agent.AgentConfig{
+			Model:              cfg.LLMModel,
+			PriorityThreshold:  cfg.PriorityThreshold,
+			TokenBudget:        cfg.TokenBudget,
+			MaxVulnerabilities: cfg.MaxVulnerabilities,
+			MinimizeData:       cfg.LLMMinimizeData,
+		}),
+	}, nil
+}
+
+func (l *local) close() {
+	_ = l.store.Close()
+}
+
+func (l *local) scan(ctx context.Context, req scanRequest) (*agent.AgentResponse, *gate.Verdict, error) {
+	t := tenant.Default
+	var src *agent.Source
+	if req.Source != "" {
+		var err error
+		if src, err = agent.ReadSource(req.Source); err != nil {
+			return nil, nil, err
+		}
+	}
+	suppressions, err := l.store.ListSuppressions(t.Org, t.Project, false)
+	if err != nil {
+		return nil, nil, err
+	}
+	overrides, err := l.store.ListSeverityOverrides(t.Org, t.Project)
+	if err != nil {
+		return nil, nil, err
+	}
+	resp, raw, err := l.agent.Run(ctx, agent.Request{
+		TargetType:        req.TargetType,
+		Target:            req.Target,
+		Summarize:         req.Summarize,
+		Remediation:       req.Remediation,
+		Explain:           req.Explain,
+		Suppressions:      suppressions,
+		SeverityOverrides: overrides,
+		Source:            src,
+		Progress:          req.Progress,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	scan := &store.Scan{
+		ID:              store.NewID(),
+		Org:             t.Org,
+		Project:         t.Project,
+		TargetType:      req.TargetType,
+		Target:          req.Target,
+		Summary:         resp.Summary,
+		Vulnerabilities: resp.Vulnerabilities,
+		RawOutput:       raw,
+		Response:        resp,
+		Exchanges:       resp.Exchanges,
+	}
+	resp.ScanID = scan.ID
+	if err := l.store.SaveScan(scan); err != nil {
+		return nil, nil, fmt.Errorf("failed to store scan: %w", err)
+	}
+
+	if len(req.FailOn) == 0 {
+		return resp, nil, nil
+	}
+	return resp, gate.Evaluate(scan, nil, gate.Policy{FailOn: req.FailOn}), nil
+}
+
+func (l *local) report(_ context.Context, scanID string) (*agent.AgentResponse, error) {
+	scan, err := l.store.GetScan(scanID)
+	if errors.Is(err, store.ErrNotFound) {
+		return nil, fmt.Errorf("scan %s not found in the local history", scanID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return scan.Response, nil
+}
+
+func (l *local) history(_ context.Context, target string, limit int) ([]historyEntry, error) {
+	scans, err := l.store.ListScans(store.ScanFilter{Target: target, Limit: limit})
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]historyEntry, 0, len(scans))
+	for _, s := range scans {
+		e := historyEntry{
+			ID:         s.ID,
+			TargetType: s.TargetType,
+			Target:     s.Target,
+			CreatedAt:  s.CreatedAt,
+			RiskScore:  digest.RiskScore(s),
+			Counts:     map[string]int{},
+		}
+		for _, sev := range trivy.Severities {
+			e.Counts[sev] = 0
+		}
+		for _, v := range digest.Open(s) {
+			e.Counts[strings.ToUpper(v.Severity)]++
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+func (l *local) pullRequest(context.Context, string, client.PullRequestRequest) (*agent.PullRequest, error) {
+	return nil, errors.New("opening pull requests needs a server; use -server, or -manifest to patch files locally")
+}
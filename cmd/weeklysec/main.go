@@ -0,0 +1,329 @@
+// Command weeklysec scans images and config files from a terminal or a CI
+// job. With a server it goes through the weeklysec API; without one it runs
+// the same scan and agent pipeline in-process and keeps its history in a
+// local data directory.
+package main
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+	"weeklysec/internal/agent"
+	"weeklysec/internal/gate"
+	"weeklysec/internal/i18n"
+	"weeklysec/internal/report"
+	"weeklysec/internal/trivy"
+	"weeklysec/pkg/client"
+
+	"github.com/joho/godotenv"
+)
+
+const usage = `Usage: weeklysec [flags] <command> [command flags]
+
+Commands:
+  scan [-type image|file] [-summarize] [-remediation] [-fail-on SEVERITIES] TARGET
+        scan a target; exits 3 when findings at a -fail-on severity are open
+  report SCAN_ID
+        print a stored scan
+  fix [-manifest PATH]... [-yes] [-pr OWNER/NAME [-base BRANCH] [-branch BRANCH]] SCAN_ID
+        review a scan's fixes one by one, then patch the manifests or open a
+        pull request with the accepted ones
+  history [-target TARGET] [-limit N]
+        list past scans, newest first
+  tui [-type image|file] [-summarize] [-remediation] TARGET | tui -scan SCAN_ID
+        run a scan, or open a stored one, in a full-screen dashboard
+  bench -fixtures DIR [-runs N] [-concurrency N] [-scan-latency D] [-llm-latency D]
+        replay stored Trivy reports through the pipeline with a mock LLM and
+        report throughput and latency
+
+Flags:
+`
+
+// Exit codes.
+const (
+	exitError = 1 // the command failed
+	exitUsage = 2 // invalid arguments
+	exitGate  = 3 // the scan failed the -fail-on policy
+)
+
+// Output formats.
+const (
+	formatText     = "text"
+	formatJSON     = "json"
+	formatMarkdown = "markdown"
+)
+
+// errUsage marks argument errors.
+var errUsage = errors.New("invalid arguments")
+
+// errGate is returned by scan when the target fails the -fail-on policy.
+var errGate = errors.New("gate failed")
+
+// options are the global flags.
+type options struct {
+	server  string
+	apiKey  string
+	dataDir string
+	format  string
+	locale  *i18n.Locale // of the fixed strings of text and Markdown output
+}
+
+// backend runs commands either against a server or in-process.
+type backend interface {
+	scan(ctx context.Context, req scanRequest) (*agent.AgentResponse, *gate.Verdict, error)
+	report(ctx context.Context, scanID string) (*agent.AgentResponse, error)
+	history(ctx context.Context, target string, limit int) ([]historyEntry, error)
+	pullRequest(ctx context.Context, scanID string, req client.PullRequestRequest) (*agent.PullRequest, error)
+}
+
+type scanRequest struct {
+	TargetType  string
+	Target      string
+	Summarize   bool
+	Remediation bool
+	Explain     bool     // record the rationale of each step
+	Source      string   // Dockerfile or manifest of an image target
+	FailOn      []string // severities; empty skips the gate
+
+	// Progress gets live step updates; only local scans send them.
+	Progress func(agent.StepResult)
+}
+
+// historyEntry is one past scan.
+type historyEntry struct {
+	ID         string         `json:"id"`
+	TargetType string         `json:"target_type"`
+	Target     string         `json:"target"`
+	CreatedAt  time.Time      `json:"created_at"`
+	RiskScore  float64        `json:"risk_score"`
+	Counts     map[string]int `json:"counts"`
+}
+
+func main() {
+	_ = godotenv.Load()
+	os.Exit(run(os.Args[1:]))
+}
+
+func run(args []string) int {
+	home, _ := os.UserHomeDir()
+	var opts options
+	fs := flag.NewFlagSet("weeklysec", flag.ContinueOnError)
+	fs.StringVar(&opts.server, "server", os.Getenv("WEEKLYSEC_SERVER"), "weeklysec server URL; runs locally when empty (env WEEKLYSEC_SERVER)")
+	fs.StringVar(&opts.apiKey, "api-key", os.Getenv("WEEKLYSEC_API_KEY"), "API key or token for the server (env WEEKLYSEC_API_KEY)")
+	fs.StringVar(&opts.dataDir, "data-dir", cmp.Or(os.Getenv("WEEKLYSEC_DATA_DIR"), filepath.Join(home, ".weeklysec")), "local scan history (env WEEKLYSEC_DATA_DIR)")
+	fs.StringVar(&opts.format, "format", formatText, "output format: text, json or markdown")
+	lang := fs.String("lang", cmp.Or(os.Getenv("WEEKLYSEC_LANG"), os.Getenv("LC_ALL"), os.Getenv("LC_MESSAGES"), os.Getenv("LANG")),
+		"language of text and markdown output, e.g. de (env WEEKLYSEC_LANG, then LC_ALL, LC_MESSAGES and LANG)")
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), usage)
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	if !slices.Contains([]string{formatText, formatJSON, formatMarkdown}, opts.format) {
+		fmt.Fprintf(os.Stderr, "weeklysec: -format must be text, json or markdown\n")
+		return exitUsage
+	}
+	// A system locale without a translation, such as C.UTF-8, is English;
+	// only -lang and WEEKLYSEC_LANG must name a known one.
+	explicit := os.Getenv("WEEKLYSEC_LANG") != ""
+	fs.Visit(func(f *flag.Flag) { explicit = explicit || f.Name == "lang" })
+	catalog := i18n.Builtin()
+	var ok bool
+	if opts.locale, ok = catalog.Lookup(*lang); !ok && explicit {
+		fmt.Fprintf(os.Stderr, "weeklysec: -lang must be one of %s\n", strings.Join(catalog.Tags(), ", "))
+		return exitUsage
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return exitUsage
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	cmd, cmdArgs := fs.Arg(0), fs.Args()[1:]
+	var b backend
+	switch {
+	case cmd == "bench":
+		// Runs in-process with neither a server nor a store.
+	case opts.server != "":
+		b = newRemote(opts.server, opts.apiKey)
+	default:
+		l, err := newLocal(opts.dataDir)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "weeklysec: %v\n", err)
+			return exitError
+		}
+		defer l.close()
+		b = l
+	}
+
+	var err error
+	switch cmd {
+	case "scan":
+		err = scanCommand(ctx, b, opts, cmdArgs)
+	case "report":
+		err = reportCommand(ctx, b, opts, cmdArgs)
+	case "history":
+		err = historyCommand(ctx, b, opts, cmdArgs)
+	case "fix":
+		err = fixCommand(ctx, b, opts, cmdArgs)
+	case "tui":
+		err = tuiCommand(ctx, b, cmdArgs)
+	case "bench":
+		err = benchCommand(ctx, opts, cmdArgs)
+	default:
+		err = fmt.Errorf("%w: unknown command %q", errUsage, cmd)
+	}
+	switch {
+	case err == nil:
+		return 0
+	case errors.Is(err, errGate):
+		return exitGate
+	case errors.Is(err, errUsage), errors.Is(err, flag.ErrHelp):
+		if !errors.Is(err, flag.ErrHelp) {
+			fmt.Fprintf(os.Stderr, "weeklysec %s: %v\n", cmd, err)
+		}
+		return exitUsage
+	default:
+		fmt.Fprintf(os.Stderr, "weeklysec %s: %v\n", cmd, err)
+		return exitError
+	}
+}
+
+func scanCommand(ctx context.Context, b backend, opts options, args []string) error {
+	var req scanRequest
+	var failOn string
+	fs := flag.NewFlagSet("scan", flag.ContinueOnError)
+	fs.StringVar(&req.TargetType, "type", "image", "target type: image or file")
+	fs.BoolVar(&req.Summarize, "summarize", false, "add an LLM summary")
+	fs.BoolVar(&req.Remediation, "remediation", false, "add an LLM remediation package")
+	fs.BoolVar(&req.Explain, "explain", false, "record why each finding was ranked and each fix chosen")
+	fs.StringVar(&req.Source, "source", "", "Dockerfile or manifest the image is built or deployed from, to anchor fixes to its lines")
+	fs.StringVar(&failOn, "fail-on", "", "comma-separated severities that fail the scan, e.g. CRITICAL,HIGH")
+	if err := fs.Parse(args); err != nil {
+		return errors.Join(errUsage, err)
+	}
+	if fs.NArg() != 1 {
+		return fmt.Errorf("%w: want exactly one TARGET", errUsage)
+	}
+	req.Target = fs.Arg(0)
+	if req.TargetType != "image" && req.TargetType != "file" {
+		return fmt.Errorf("%w: -type must be image or file", errUsage)
+	}
+	if req.Source != "" && req.TargetType != "image" {
+		return fmt.Errorf("%w: -source needs -type image", errUsage)
+	}
+	for _, sev := range strings.Split(failOn, ",") {
+		if sev = strings.ToUpper(strings.TrimSpace(sev)); sev != "" {
+			if !slices.Contains(trivy.Severities, sev) {
+				return fmt.Errorf("%w: unknown severity %q", errUsage, sev)
+			}
+			req.FailOn = append(req.FailOn, sev)
+		}
+	}
+
+	resp, verdict, err := b.scan(ctx, req)
+	if err != nil {
+		return err
+	}
+	if err := printResponse(opts, resp, verdict); err != nil {
+		return err
+	}
+	if resp.Status == agent.StatusFailed {
+		return errors.New(resp.Error)
+	}
+	if verdict != nil && !verdict.Pass {
+		fmt.Fprintf(os.Stderr, "weeklysec: %s\n", strings.Join(verdict.Reasons, "; "))
+		return errGate
+	}
+	return nil
+}
+
+func reportCommand(ctx context.Context, b backend, opts options, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("%w: want exactly one SCAN_ID", errUsage)
+	}
+	resp, err := b.report(ctx, args[0])
+	if err != nil {
+		return err
+	}
+	return printResponse(opts, resp, nil)
+}
+
+func historyCommand(ctx context.Context, b backend, opts options, args []string) error {
+	fs := flag.NewFlagSet("history", flag.ContinueOnError)
+	target := fs.String("target", "", "only scans of this target")
+	limit := fs.Int("limit", 20, "number of scans to list")
+	if err := fs.Parse(args); err != nil {
+		return errors.Join(errUsage, err)
+	}
+	entries, err := b.history(ctx, *target, *limit)
+	if err != nil {
+		return err
+	}
+
+	l := opts.locale
+	switch opts.format {
+	case formatJSON:
+		return printJSON(entries)
+	case formatMarkdown:
+		fmt.Printf("| %s | %s | %s | %s | %s | %s |\n|---|---|---|---|---|---|\n", l.T("Scan"), l.T("Target"), l.T("Scanned"), l.T("Risk"), l.T("Critical"), l.T("High"))
+		for _, e := range entries {
+			fmt.Printf("| %s | `%s` | %s | %.1f | %d | %d |\n", e.ID, e.Target, e.CreatedAt.Format(time.RFC3339), e.RiskScore, e.Counts["CRITICAL"], e.Counts["HIGH"])
+		}
+	default:
+		for _, e := range entries {
+			fmt.Printf("%s  %s  %s %5.1f  %s %d  %s %d  %s (%s)\n", e.ID, e.CreatedAt.Local().Format("2006-01-02 15:04"),
+				l.T("risk"), e.RiskScore, l.T("critical"), e.Counts["CRITICAL"], l.T("high"), e.Counts["HIGH"], e.Target, e.TargetType)
+		}
+	}
+	return nil
+}
+
+// printResponse writes a run in the chosen format and language, followed by
+// the gate verdict when there is one.
+func printResponse(opts options, resp *agent.AgentResponse, verdict *gate.Verdict) error {
+	switch opts.format {
+	case formatJSON:
+		if verdict != nil {
+			return printJSON(struct {
+				*agent.AgentResponse
+				Gate *gate.Verdict `json:"gate"`
+			}{resp, verdict})
+		}
+		return printJSON(resp)
+	case formatMarkdown:
+		fmt.Print(report.Markdown(resp, opts.locale))
+		if verdict != nil {
+			fmt.Print("\n" + gate.Markdown(verdict))
+		}
+	default:
+		fmt.Print(report.Text(resp, opts.locale))
+		if verdict != nil {
+			result := "PASS"
+			if !verdict.Pass {
+				result = "FAIL"
+			}
+			fmt.Printf("\n%s: %s (%s)\n", opts.locale.T("Gate"), result, opts.locale.T("fail on %s", strings.Join(verdict.Policy.FailOn, ", ")))
+		}
+	}
+	return nil
+}
+
+func printJSON(v any) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"weeklysec/internal/agent"
+	"weeklysec/internal/gate"
+	"weeklysec/pkg/client"
+)
+
+// remote runs commands through a weeklysec server.
+type remote struct {
+	c *client.Client
+}
+
+func newRemote(baseURL, apiKey string) *remote {
+	return &remote{c: client.New(baseURL, client.WithToken(apiKey), client.WithUserAgent("weeklysec-cli"))}
+}
+
+func (r *remote) scan(ctx context.Context, req scanRequest) (*agent.AgentResponse, *gate.Verdict, error) {
+	sr := client.ScanRequest{TargetType: req.TargetType, Target: req.Target, Summarize: req.Summarize, Explain: req.Explain, Source: req.Source}
+	if len(req.FailOn) == 0 {
+		resp, err := r.c.Scan(ctx, sr)
+		return resp, nil, err
+	}
+
+	// The gate endpoint scans and judges in one call; the report is then
+	// read back from the stored scan.
+	g, err := r.c.Gate(ctx, client.GateRequest{ScanRequest: sr, Policy: &gate.Policy{FailOn: req.FailOn}})
+	if err != nil {
+		return nil, nil, err
+	}
+	resp, err := r.report(ctx, g.ScanID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return resp, g.Verdict, nil
+}
+
+func (r *remote) report(ctx context.Context, scanID string) (*agent.AgentResponse, error) {
+	return r.c.GetScan(ctx, scanID)
+}
+
+func (r *remote) pullRequest(ctx context.Context, scanID string, req client.PullRequestRequest) (*agent.PullRequest, error) {
+	return r.c.OpenPullRequest(ctx, scanID, req)
+}
+
+func (r *remote) history(ctx context.Context, target string, limit int) ([]historyEntry, error) {
+	scans, err := r.c.Scans(ctx, client.ScanQuery{Target: target, Limit: limit})
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]historyEntry, 0, len(scans))
+	for _, s := range scans {
+		entries = append(entries, historyEntry{
+			ID:         s.ID,
+			TargetType: s.TargetType,
+			Target:     s.Target,
+			CreatedAt:  s.CreatedAt,
+			RiskScore:  s.RiskScore,
+			Counts: map[string]int{
+				"CRITICAL": s.SeverityCounts.Critical,
+				"HIGH":     s.SeverityCounts.High,
+				"MEDIUM":   s.SeverityCounts.Medium,
+				"LOW":      s.SeverityCounts.Low,
+				"UNKNOWN":  s.SeverityCounts.Unknown,
+			},
+		})
+	}
+	return entries, nil
+}
@@ -0,0 +1,20 @@
+//go:build !unix
+
+package main
+
+import (
+	"errors"
+	"os"
+)
+
+type terminal struct{}
+
+func openTerminal() (*terminal, error) {
+	return nil, errors.New("the terminal UI is not supported on this platform")
+}
+
+func (t *terminal) restore() {}
+
+func (t *terminal) size() (rows, cols int) { return 24, 80 }
+
+func resizeSignals() []os.Signal { return nil }
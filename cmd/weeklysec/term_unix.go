@@ -0,0 +1,63 @@
+//go:build unix
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+)
+
+// terminal is the controlling terminal switched to raw mode. Modes are set
+// with stty so the CLI needs no terminal library.
+type terminal struct {
+	saved string
+}
+
+func openTerminal() (*terminal, error) {
+	if !isTerminal(os.Stdin) || !isTerminal(os.Stdout) {
+		return nil, fmt.Errorf("%w: the terminal UI needs an interactive terminal", errUsage)
+	}
+	saved, err := stty("-g")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := stty("raw", "-echo"); err != nil {
+		return nil, err
+	}
+	return &terminal{saved: saved}, nil
+}
+
+// restore puts the terminal back the way openTerminal found it.
+func (t *terminal) restore() {
+	_, _ = stty(t.saved)
+}
+
+// size returns the terminal's rows and columns, or 24x80 when unknown.
+func (t *terminal) size() (rows, cols int) {
+	out, err := stty("size")
+	if err != nil {
+		return 24, 80
+	}
+	if _, err := fmt.Sscan(out, &rows, &cols); err != nil || rows == 0 || cols == 0 {
+		return 24, 80
+	}
+	return rows, cols
+}
+
+// resizeSignals are the signals sent when the terminal is resized.
+func resizeSignals() []os.Signal {
+	return []os.Signal{syscall.SIGWINCH}
+}
+
+func stty(args ...string) (string, error) {
+	cmd := exec.Command("stty", args...)
+	cmd.Stdin = os.Stdin
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("stty %s: %w", strings.Join(args, " "), err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
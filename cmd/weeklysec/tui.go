@@ -0,0 +1,390 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+	"weeklysec/internal/agent"
+	"weeklysec/internal/trivy"
+)
+
+// stepOrder is the order the pipeline runs its steps in.
+var stepOrder = []string{
+	agent.StepVerify, agent.StepScan, agent.StepAnalyze, agent.StepPrioritize,
+	agent.StepHarden, agent.StepRemediation, agent.StepSummarize, agent.StepPullRequest,
+}
+
+// severityColors are the ANSI colors of each severity.
+var severityColors = map[string]string{
+	"CRITICAL": "\x1b[1;31m",
+	"HIGH":     "\x1b[31m",
+	"MEDIUM":   "\x1b[33m",
+	"LOW":      "\x1b[34m",
+	"UNKNOWN":  "\x1b[90m",
+}
+
+const spinner = `|/-\`
+
+// Events handled by the TUI loop.
+type (
+	keyEvent  string
+	stepEvent agent.StepResult
+	doneEvent struct {
+		resp *agent.AgentResponse
+		err  error
+	}
+)
+
+// tuiCommand runs a scan, or opens a stored one, full screen: live step
+// status, the severity breakdown and a list of fixes to move through.
+func tuiCommand(ctx context.Context, b backend, args []string) error {
+	var req scanRequest
+	fs := flag.NewFlagSet("tui", flag.ContinueOnError)
+	fs.StringVar(&req.TargetType, "type", "image", "target type: image or file")
+	fs.BoolVar(&req.Summarize, "summarize", false, "add an LLM summary")
+	fs.BoolVar(&req.Remediation, "remediation", false, "add an LLM remediation package")
+	scanID := fs.String("scan", "", "open a stored scan instead of running one")
+	if err := fs.Parse(args); err != nil {
+		return errors.Join(errUsage, err)
+	}
+	switch {
+	case *scanID != "" && fs.NArg() != 0:
+		return fmt.Errorf("%w: -scan takes no TARGET", errUsage)
+	case *scanID == "" && fs.NArg() != 1:
+		return fmt.Errorf("%w: want exactly one TARGET or -scan SCAN_ID", errUsage)
+	case *scanID == "" && req.TargetType != "image" && req.TargetType != "file":
+		return fmt.Errorf("%w: -type must be image or file", errUsage)
+	}
+	req.Target = fs.Arg(0)
+
+	term, err := openTerminal()
+	if err != nil {
+		return err
+	}
+	defer term.restore()
+	fmt.Print("\x1b[?1049h\x1b[?25l")
+	defer fmt.Print("\x1b[?25h\x1b[?1049l")
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	events := make(chan any, 16)
+	send := func(ev any) {
+		select {
+		case events <- ev:
+		case <-ctx.Done():
+		}
+	}
+
+	// In raw mode Ctrl-C arrives as a key, not a signal.
+	go func() {
+		buf := make([]byte, 16)
+		for {
+			n, err := os.Stdin.Read(buf)
+			if err != nil {
+				return
+			}
+			send(keyEvent(buf[:n]))
+		}
+	}()
+
+	v := &view{target: req.Target, targetType: req.TargetType, steps: map[string]agent.StepResult{}, running: true, started: time.Now()}
+	v.rows, v.cols = term.size()
+	go func() {
+		var ev doneEvent
+		if *scanID != "" {
+			ev.resp, ev.err = b.report(ctx, *scanID)
+		} else {
+			// Steps are reported live for local scans; a server only answers
+			// once the run is over.
+			req.Progress = func(r agent.StepResult) { send(stepEvent(r)) }
+			ev.resp, _, ev.err = b.scan(ctx, req)
+		}
+		// The done event must arrive even after a quit cancelled ctx.
+		events <- ev
+	}()
+
+	resize := make(chan os.Signal, 1)
+	if sigs := resizeSignals(); len(sigs) > 0 {
+		signal.Notify(resize, sigs...)
+		defer signal.Stop(resize)
+	}
+	tick := time.NewTicker(150 * time.Millisecond)
+	defer tick.Stop()
+
+	for {
+		v.render()
+		select {
+		case <-tick.C:
+			v.frame++
+		case <-resize:
+			v.rows, v.cols = term.size()
+		case ev := <-events:
+			switch ev := ev.(type) {
+			case stepEvent:
+				v.steps[ev.Step] = agent.StepResult(ev)
+			case doneEvent:
+				v.running = false
+				if v.quitting {
+					return nil
+				}
+				v.setResult(ev.resp, ev.err)
+			case keyEvent:
+				if v.key(string(ev)) {
+					if !v.running {
+						return nil
+					}
+					// Wait for the cancelled scan to wind down so the local
+					// store is not closed under it.
+					v.quitting = true
+					cancel()
+				}
+			}
+		}
+	}
+}
+
+// view is the TUI state. It is only touched by the loop in tuiCommand.
+type view struct {
+	target, targetType string
+	steps              map[string]agent.StepResult
+	resp               *agent.AgentResponse
+	err                error
+
+	running, quitting bool
+	started           time.Time
+	frame             int
+
+	fixes    []agent.Fix
+	selected int
+	offset   int // first fix shown
+
+	rows, cols int
+}
+
+func (v *view) setResult(resp *agent.AgentResponse, err error) {
+	v.resp, v.err = resp, err
+	if resp == nil {
+		return
+	}
+	v.target, v.targetType = resp.Target, resp.TargetType
+	for _, r := range resp.StepResults {
+		v.steps[r.Step] = r
+	}
+	if resp.Remediation != nil {
+		v.fixes = resp.Remediation.Fixes
+	}
+}
+
+// key handles one key press and reports whether it asks to quit.
+func (v *view) key(k string) bool {
+	page := max(v.fixRows()-1, 1)
+	switch k {
+	case "q", "Q", "\x03", "\x1b":
+		return true
+	case "j", "\x1b[B":
+		v.selected++
+	case "k", "\x1b[A":
+		v.selected--
+	case "\x1b[6~", " ":
+		v.selected += page
+	case "\x1b[5~":
+		v.selected -= page
+	case "g", "\x1b[H":
+		v.selected = 0
+	case "G", "\x1b[F":
+		v.selected = len(v.fixes) - 1
+	}
+	v.selected = max(min(v.selected, len(v.fixes)-1), 0)
+	return false
+}
+
+// fixRows is how many fixes fit on screen next to the other panes.
+func (v *view) fixRows() int {
+	used := 3 + 2 + v.stepRows() + 2 + len(trivy.Severities) + 2 + 5 + 2
+	return max(v.rows-used, 3)
+}
+
+func (v *view) stepRows() int {
+	n := 0
+	for _, s := range stepOrder {
+		if v.showStep(s) {
+			n++
+		}
+	}
+	return n
+}
+
+// showStep hides the steps that only run for some targets until they do.
+func (v *view) showStep(step string) bool {
+	_, seen := v.steps[step]
+	return seen || (step != agent.StepVerify && step != agent.StepPullRequest)
+}
+
+func (v *view) render() {
+	var lines []string
+	add := func(format string, args ...any) {
+		lines = append(lines, fit(fmt.Sprintf(format, args...), v.cols))
+	}
+
+	add("\x1b[1mweeklysec\x1b[0m  %s (%s)", v.target, v.targetType)
+	switch {
+	case v.quitting:
+		add("Cancelling...")
+	case v.running:
+		add("%c Running for %s", spinner[v.frame%len(spinner)], time.Since(v.started).Round(time.Second))
+	case v.err != nil:
+		add("\x1b[31mError:\x1b[0m %s", firstLine(v.err.Error()))
+	case v.resp != nil:
+		status := v.resp.Status
+		if v.resp.Error != "" {
+			status += ": " + firstLine(v.resp.Error)
+		}
+		add("Status: %s  Scan: %s", status, v.resp.ScanID)
+	}
+	add("")
+
+	add("\x1b[1mSteps\x1b[0m")
+	for _, s := range stepOrder {
+		if !v.showStep(s) {
+			continue
+		}
+		r, ok := v.steps[s]
+		switch {
+		case !ok:
+			add("  %-12s \x1b[90mpending\x1b[0m", s)
+		case r.Status == agent.StepRunning:
+			add("  %-12s %c running", s, spinner[v.frame%len(spinner)])
+		case r.Status == agent.StepSucceeded:
+			add("  %-12s \x1b[32mok\x1b[0m %s", s, time.Duration(r.DurationMS)*time.Millisecond)
+		case r.Status == agent.StepSkipped:
+			add("  %-12s \x1b[90mskipped\x1b[0m", s)
+		default:
+			add("  %-12s \x1b[31m%s\x1b[0m %s", s, r.Status, firstLine(r.Error))
+		}
+	}
+	add("")
+
+	add("\x1b[1mSeverity\x1b[0m")
+	var a *agent.Analysis
+	if v.resp != nil {
+		a = v.resp.Analysis
+	}
+	if a == nil {
+		for range len(trivy.Severities) + 1 {
+			add("")
+		}
+	} else {
+		top := 1
+		for _, n := range a.BySeverity {
+			top = max(top, n)
+		}
+		width := max(min(v.cols-24, 40), 1)
+		for _, sev := range trivy.Severities {
+			n := a.BySeverity[sev]
+			bar := strings.Repeat("#", (n*width+top-1)/top)
+			add("  %s%-9s\x1b[0m %5d %s%s\x1b[0m", severityColors[sev], sev, n, severityColors[sev], bar)
+		}
+		add("  Risk score %.1f / 100, %d of %d fixable", a.RiskScore, a.Fixable, a.TotalVulnerabilities)
+	}
+	add("")
+
+	add("\x1b[1mFixes\x1b[0m (%d)", len(v.fixes))
+	rows := v.fixRows()
+	if v.selected < v.offset {
+		v.offset = v.selected
+	}
+	if v.selected >= v.offset+rows {
+		v.offset = v.selected - rows + 1
+	}
+	for i := v.offset; i < v.offset+rows; i++ {
+		if i >= len(v.fixes) {
+			add("")
+			continue
+		}
+		f := v.fixes[i]
+		line := fmt.Sprintf(" P%d %-30s %s -> %s (%d)", f.Priority, f.PkgName, f.CurrentVersion, f.RecommendedVersion, len(f.Resolves))
+		if i == v.selected {
+			add("\x1b[7m>%s\x1b[0m", line)
+		} else {
+			add(" %s", line)
+		}
+	}
+	add("")
+
+	// Details of the selected fix.
+	if v.selected < len(v.fixes) {
+		f := v.fixes[v.selected]
+		add("%s", f.Description)
+		add("Package:  %s", f.PkgName)
+		add("Upgrade:  %s -> %s", f.CurrentVersion, f.RecommendedVersion)
+		add("Resolves: %s", strings.Join(f.Resolves, ", "))
+	} else {
+		for range 4 {
+			add("")
+		}
+	}
+	add("")
+
+	help := "up/down move  pgup/pgdn page  q quit"
+	if v.resp != nil && v.resp.ScanID != "" && len(v.fixes) > 0 {
+		help += "  |  weeklysec fix " + v.resp.ScanID + " to apply"
+	}
+	add("\x1b[90m%s\x1b[0m", help)
+
+	// Redraw in place rather than clearing, which flickers.
+	var b strings.Builder
+	b.WriteString("\x1b[H")
+	for i, line := range lines {
+		if i >= v.rows {
+			break
+		}
+		b.WriteString(line)
+		b.WriteString("\x1b[K")
+		if i < len(lines)-1 && i < v.rows-1 {
+			b.WriteString("\r\n")
+		}
+	}
+	b.WriteString("\x1b[J")
+	fmt.Print(b.String())
+}
+
+// fit cuts s to width visible columns, skipping ANSI escapes when counting
+// and resetting attributes when it cuts.
+func fit(s string, width int) string {
+	var b strings.Builder
+	n := 0
+	esc := false
+	for _, r := range s {
+		switch {
+		case esc:
+			esc = r != 'm'
+		case r == '\x1b':
+			esc = true
+		default:
+			if n == width {
+				b.WriteString("\x1b[0m")
+				return b.String()
+			}
+			n++
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+func firstLine(s string) string {
+	if i := strings.IndexByte(s, '\n'); i >= 0 {
+		return s[:i]
+	}
+	return s
+}
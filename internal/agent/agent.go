@@ -0,0 +1,666 @@
+package agent
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+	"weeklysec/internal/cosign"
+	"weeklysec/internal/errcode"
+	"weeklysec/internal/experiment"
+	"weeklysec/internal/llm"
+	"weeklysec/internal/queue"
+	"weeklysec/internal/registry"
+	"weeklysec/internal/requestid"
+	"weeklysec/internal/scoring"
+	"weeklysec/internal/tracing"
+	"weeklysec/internal/trivy"
+
+	"github.com/rs/zerolog"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// Pipeline step names, in execution order.
+const (
+	StepVerify      = "verify"
+	StepScan        = "scan"
+	StepAnalyze     = "analyze"
+	StepPrioritize  = "prioritize"
+	StepHarden      = "harden" // file targets holding Kubernetes manifests only
+	StepRemediation = "remediation"
+	StepSummarize   = "summarize"
+
+	// StepPullRequest is run by the API after the pipeline when a pull
+	// request was asked for.
+	StepPullRequest = "pull_request"
+)
+
+// ErrBudgetExceeded is returned by an LLM step that would push the run over
+// its token budget.
+var ErrBudgetExceeded = errcode.New(errcode.BudgetExceeded, "LLM token budget exceeded")
+
+// AgentConfig tunes the agent pipeline. It can be replaced at runtime.
+type AgentConfig struct {
+	Model             string `json:"model"`              // LLM model; empty uses LLM_MODEL
+	PriorityThreshold string `json:"priority_threshold"` // lowest severity that gets prioritized
+	TokenBudget       int    `json:"token_budget"`       // estimated prompt tokens per run; 0 is unlimited
+	// MaxVulnerabilities caps the findings sent to the LLM per prompt; the
+	// most severe are kept. 0 sends them all.
+	MaxVulnerabilities int `json:"max_vulnerabilities"`
+	// Explain records the rationale of every step with the results, and
+	// asks the LLM for its reasoning, so reviewers can audit a run.
+	Explain bool `json:"explain"`
+	// MinimizeData sends models that are not local (see llm.IsLocal) only
+	// the derived facts of findings: IDs, packages, versions and
+	// severities, never the Trivy report or the target's name.
+	MinimizeData bool `json:"minimize_data"`
+
+	IgnorePolicy IgnorePolicy `json:"ignore_policy"`
+}
+
+// IgnorePolicy drops findings before analysis.
+type IgnorePolicy struct {
+	VulnerabilityIDs []string `json:"vulnerability_ids,omitempty"`
+	Packages         []string `json:"packages,omitempty"`
+	Unfixed          bool     `json:"unfixed,omitempty"` // ignore findings without a fixed version
+}
+
+// Validate checks the config and normalizes its fields.
+func (c *AgentConfig) Validate() error {
+	if c.PriorityThreshold == "" {
+		c.PriorityThreshold = "HIGH"
+	}
+	c.PriorityThreshold = strings.ToUpper(c.PriorityThreshold)
+	if !slices.Contains(trivy.Severities, c.PriorityThreshold) {
+		return fmt.Errorf("priority_threshold must be one of %s", strings.Join(trivy.Severities, ", "))
+	}
+	if c.TokenBudget < 0 {
+		return fmt.Errorf("token_budget must not be negative")
+	}
+	if c.MaxVulnerabilities < 0 {
+		return fmt.Errorf("max_vulnerabilities must not be negative")
+	}
+	return nil
+}
+
+// Ignores reports whether the policy drops v.
+func (p IgnorePolicy) Ignores(v trivy.Vulnerability) bool {
+	return slices.Contains(p.VulnerabilityIDs, v.VulnerabilityID) ||
+		slices.Contains(p.Packages, v.PkgName) ||
+		(p.Unfixed && v.FixedVersion == "")
+}
+
+// Request describes a single agent run.
+type Request struct {
+	TargetType string
+	Target     string
+
+	Summarize   bool // run the LLM summary step
+	Remediation bool // run the LLM remediation package step
+
+	// Suppressions that apply to the target's tenant.
+	Suppressions []Suppression
+
+	// Severity overrides that apply to the target's tenant.
+	SeverityOverrides []SeverityOverride
+
+	// Triage is what the tenant's team decided on findings before;
+	// findings it called noise are left out of prioritization.
+	Triage []TriageDecision
+
+	// Guidance of the target's org and project for the remediation
+	// prompts, org-wide first.
+	Guidance []Guidance
+
+	// Source is the Dockerfile or manifest of an image target, if the
+	// caller sent one; fixes are anchored to its lines.
+	Source *Source
+
+	// Images, when set, are the images of the application named by
+	// Target. They are scanned at once in its place and their findings
+	// analyzed as one report.
+	Images []string
+
+	// TargetInfo is the tenant and inventory metadata of the target that
+	// scoring hooks see; its TargetType and Target are filled in from the
+	// request.
+	TargetInfo scoring.Target
+
+	// Per-run overrides of the agent configuration; empty keeps the default.
+	Model             string
+	PriorityThreshold string
+
+	// Explain turns on explain mode for this run; see AgentConfig.Explain.
+	Explain bool
+
+	// SkipLLM, when set, skips the LLM steps that were asked for and
+	// records it as their error, e.g. when a quota is used up.
+	SkipLLM error
+
+	// Progress, when set, is called as each step starts and again with its
+	// result, for live displays. It runs on the pipeline's goroutine.
+	Progress func(StepResult)
+}
+
+// LayerResolver looks an image up in its registry without pulling it.
+type LayerResolver interface {
+	Image(ctx context.Context, ref string) (registry.Image, error)
+}
+
+// Agent runs a scan and turns its output into an AgentResponse.
+type Agent struct {
+	mu       sync.RWMutex
+	cfg      AgentConfig
+	verifier *cosign.Verifier
+	layers   LayerResolver
+	runs     *queue.Pool
+	scans    *queue.Pool
+
+	experiments *experiment.Set
+	scoring     *scoring.Engine
+}
+
+func New(cfg AgentConfig) *Agent {
+	if cfg.PriorityThreshold == "" {
+		cfg.PriorityThreshold = "HIGH"
+	}
+	return &Agent{cfg: cfg}
+}
+
+// Config returns the agent's current configuration.
+func (a *Agent) Config() AgentConfig {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.cfg
+}
+
+// SetConfig replaces the configuration. Runs already in progress keep the
+// configuration they started with.
+func (a *Agent) SetConfig(cfg AgentConfig) error {
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.cfg = cfg
+	return nil
+}
+
+// SetVerifier makes runs over images verify their signatures first. Images
+// without a trusted signature have their findings moved up in priority.
+func (a *Agent) SetVerifier(v *cosign.Verifier) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.verifier = v
+}
+
+// SetLayerResolver turns on delta scanning of images: their layers are
+// looked up first, and an image whose layers were all scanned before
+// against the current DB reuses those findings instead of running Trivy.
+func (a *Agent) SetLayerResolver(l LayerResolver) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.layers = l
+}
+
+// SetExperiments routes a share of runs to the prompt and model variants of
+// their LLM steps; nil turns experiments off.
+func (a *Agent) SetExperiments(s *experiment.Set) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.experiments = s
+}
+
+// Experiments returns the experiments in effect, nil without any.
+func (a *Agent) Experiments() *experiment.Set {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.experiments
+}
+
+// SetScoring runs hooks over the prioritized findings of every run; nil
+// turns them off.
+func (a *Agent) SetScoring(e *scoring.Engine) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.scoring = e
+}
+
+// Scoring returns the scoring hooks in effect, nil without any.
+func (a *Agent) Scoring() *scoring.Engine {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.scoring
+}
+
+// SetQueues bounds how many runs, and how many Trivy scans within them,
+// execute at once. Without queues every run starts right away.
+func (a *Agent) SetQueues(runs, scans *queue.Pool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.runs, a.scans = runs, scans
+}
+
+func (a *Agent) queues() (runs, scans *queue.Pool) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.runs, a.scans
+}
+
+// Run scans the target and analyzes the result. The returned raw output is the
+// Trivy JSON report, kept so callers can persist it. A scan failure is
+// reported both in the response and as the returned error.
+func (a *Agent) Run(ctx context.Context, req Request) (_ *AgentResponse, _ string, err error) {
+	ctx, span := tracing.Start(ctx, "agent.run", targetAttrs(req)...)
+	defer func() { tracing.End(span, err) }()
+
+	r := a.newRun(ctx, req)
+	runs, scans := a.queues()
+
+	var result *trivy.ScanResult
+	err = runs.Do(ctx, func(ctx context.Context) error {
+		r.verify(ctx)
+		err := r.step(ctx, StepScan, func(ctx context.Context) (err error) {
+			if len(req.Images) > 0 {
+				result, err = r.scanImages(ctx, scans)
+				return err
+			}
+			result, r.resp.Layers, err = r.scanTarget(ctx, scans, req.TargetType, req.Target)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		r.analyzeReport(ctx, result.Report, "")
+		return nil
+	})
+	if err != nil {
+		r.fail(err)
+		return r.resp, "", err
+	}
+	return r.resp, result.RawOutput, nil
+}
+
+// Analyze runs every step after the scan against an existing Trivy report.
+func (a *Agent) Analyze(ctx context.Context, req Request, raw string) *AgentResponse {
+	ctx, span := tracing.Start(ctx, "agent.analyze", targetAttrs(req)...)
+	defer span.End()
+
+	r := a.newRun(ctx, req)
+	runs, _ := a.queues()
+	err := runs.Do(ctx, func(ctx context.Context) error {
+		r.verify(ctx)
+		r.analyzeReport(ctx, nil, raw)
+		return nil
+	})
+	if err != nil {
+		r.fail(err)
+	}
+	return r.resp
+}
+
+// run holds the state of one pipeline execution.
+type run struct {
+	cfg         AgentConfig
+	verifier    *cosign.Verifier
+	layers      LayerResolver
+	experiments *experiment.Set
+	choices     map[string]experiment.Choice
+	scoring     *scoring.Engine
+	rescored    map[string][]string // hooks that re-ranked a finding, by "CVE@package"
+	req         Request
+	resp        *AgentResponse
+}
+
+func (a *Agent) newRun(ctx context.Context, req Request) *run {
+	a.mu.RLock()
+	cfg, verifier, layers, experiments, hooks := a.cfg, a.verifier, a.layers, a.experiments, a.scoring
+	a.mu.RUnlock()
+	if req.Model != "" {
+		cfg.Model = req.Model
+	}
+	if req.PriorityThreshold != "" {
+		cfg.PriorityThreshold = strings.ToUpper(req.PriorityThreshold)
+	}
+	cfg.Explain = cfg.Explain || req.Explain
+	return &run{
+		cfg:         cfg,
+		verifier:    verifier,
+		layers:      layers,
+		experiments: experiments,
+		choices:     map[string]experiment.Choice{},
+		scoring:     hooks,
+		rescored:    map[string][]string{},
+		req:         req,
+		resp: &AgentResponse{
+			RequestID:  requestid.FromContext(ctx),
+			TargetType: req.TargetType,
+			Target:     req.Target,
+			Model:      cfg.Model,
+			Status:     StatusCompleted,
+			StartedAt:  time.Now().UTC(),
+			LLMUsage:   &LLMUsage{},
+		},
+	}
+}
+
+func (r *run) fail(err error) {
+	r.resp.Status = StatusFailed
+	r.resp.Error = err.Error()
+	r.resp.ErrorCode = errcode.Of(err)
+	r.resp.CompletedAt = time.Now().UTC()
+}
+
+// verify checks the signature of an image target when a verifier is set.
+// The outcome lands in the response either way; the step fails only when
+// verification could not run.
+func (r *run) verify(ctx context.Context) {
+	if r.verifier == nil || r.req.TargetType != "image" {
+		return
+	}
+	_ = r.step(ctx, StepVerify, func(ctx context.Context) error {
+		r.resp.Signature = r.verifier.Verify(ctx, r.req.Target)
+		if r.resp.Signature.Status == cosign.StatusError {
+			return errcode.Wrap(errcode.SignatureCheckFailed, errors.New(r.resp.Signature.Error))
+		}
+		return nil
+	})
+}
+
+// scanTarget runs Trivy over one target, or reuses the findings of an
+// image's layers when delta scanning is on. stats is set when it is.
+func (r *run) scanTarget(ctx context.Context, scans *queue.Pool, targetType, target string) (result *trivy.ScanResult, stats *trivy.LayerStats, err error) {
+	img := r.imageLayers(ctx, targetType, target)
+	if img != nil {
+		var s trivy.LayerStats
+		result, s = trivy.CachedScan(target, *img)
+		stats = &s
+		if result != nil {
+			return result, stats, nil
+		}
+	}
+	// The run already holds a slot, so the scan waits for a free worker
+	// rather than failing.
+	err = scans.Do(queue.WithWait(ctx), func(ctx context.Context) (err error) {
+		result, err = trivy.RunScanContext(ctx, targetType, target)
+		return err
+	})
+	if err == nil && img != nil {
+		if err := trivy.SaveLayers(result); err != nil {
+			zerolog.Ctx(ctx).Warn().Err(err).Msg("Failed to save image layers")
+		}
+	}
+	return result, stats, err
+}
+
+// imageLayers looks up the layers of an image for delta scanning. It
+// returns nil when that is off, target is not an image or the registry
+// could not tell, and the image is then scanned in full.
+func (r *run) imageLayers(ctx context.Context, targetType, target string) *trivy.ImageLayers {
+	if r.layers == nil || targetType != "image" || trivy.CacheDir() == "" {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	img, err := r.layers.Image(ctx, target)
+	if err != nil {
+		zerolog.Ctx(ctx).Debug().Err(err).Str("target", target).Msg("Could not look up image layers; scanning in full")
+		return nil
+	}
+	return &trivy.ImageLayers{
+		ImageID:    img.ConfigDigest,
+		RepoDigest: registry.Parse(target).Repository + "@" + img.Digest,
+		DiffIDs:    img.DiffIDs,
+	}
+}
+
+// analyzeReport runs the steps after the scan over report, parsing raw
+// first when report is nil.
+func (r *run) analyzeReport(ctx context.Context, report *trivy.Report, raw string) {
+	resp := r.resp
+
+	var vulns []trivy.Vulnerability
+	var misconfigs []trivy.Misconfiguration
+	var secrets []trivy.Secret
+	err := r.step(ctx, StepAnalyze, func(context.Context) error {
+		if report == nil {
+			var err error
+			if report, err = trivy.ParseReport([]byte(raw)); err != nil {
+				return err
+			}
+		}
+		for _, v := range report.Vulnerabilities() {
+			if r.cfg.IgnorePolicy.Ignores(v) {
+				resp.Ignored++
+				continue
+			}
+			vulns = append(vulns, v)
+		}
+		resp.Overridden = applySeverityOverrides(r.req.Target, vulns, r.req.SeverityOverrides)
+		resp.Vulnerabilities = vulns
+		resp.Analysis = analyze(vulns)
+		misconfigs = report.Misconfigurations()
+		addMisconfigs(resp.Analysis, misconfigs)
+		secrets = report.Secrets()
+		addSecrets(resp.Analysis, secrets)
+		if r.cfg.Explain {
+			r.explainAnalysis(len(vulns) + resp.Ignored)
+		}
+		return nil
+	})
+	if err != nil {
+		r.fail(err)
+		return
+	}
+
+	_ = r.step(ctx, StepPrioritize, func(context.Context) error {
+		open, accepted := applySuppressions(r.req.Target, vulns, r.req.Suppressions, time.Now())
+		resp.AcceptedRisk = accepted
+		open, resp.LearnedNoise = applyTriage(r.req.Target, open, r.req.Triage)
+		resp.Prioritized = prioritize(open, r.cfg.PriorityThreshold)
+		markOverridden(resp.Prioritized, resp.Overridden)
+		unsigned := ""
+		if sig := resp.Signature; sig != nil && (sig.Status == cosign.StatusUnsigned || sig.Status == cosign.StatusUntrusted) {
+			unsigned = sig.Status
+			escalateUnsigned(resp.Prioritized, unsigned)
+		}
+		r.applyScoring()
+		resp.Misconfigs = prioritizeMisconfigs(misconfigs, r.cfg.PriorityThreshold)
+		resp.Remediation = &RemediationPackage{
+			Fixes:       buildFixes(resp.Prioritized),
+			ConfigFixes: buildConfigFixes(resp.Misconfigs),
+			Runbooks:    buildRunbooks(secrets, r.req.TargetType == "image" || len(r.req.Images) > 0),
+		}
+		r.anchorFixes(resp.Remediation.Fixes)
+		if r.cfg.Explain {
+			r.explainPriorities(unsigned)
+		}
+		return nil
+	})
+
+	r.harden(ctx)
+	r.llmStep(ctx, StepRemediation, r.req.Remediation && resp.Remediation.Actionable(), r.writeRemediation)
+	r.llmStep(ctx, StepSummarize, r.req.Summarize, func(ctx context.Context) error {
+		// The compact report leaves out the fields nothing reads, which
+		// would only spend tokens.
+		trimmed, omitted := trimReport(report, r.cfg.MaxVulnerabilities)
+		r.omit(omitted)
+		report := trimmed.JSON()
+		if r.minimized(StepSummarize) {
+			report = minimalReport(trimmed)
+		}
+		if r.cfg.Explain && omitted > 0 {
+			r.explanation(StepSummarize).Rationale = fmt.Sprintf(
+				"The summary was written from the %d most severe findings; %d lower-ranked ones were left out of the prompt.",
+				r.cfg.MaxVulnerabilities, omitted)
+		}
+		summary, err := r.chat(ctx, StepSummarize, llm.SummaryMessagesWith(r.choose(StepSummarize).Prompts, report, omitted))
+		if err == nil && omitted > 0 {
+			summary = strings.TrimRight(summary, "\n") + fmt.Sprintf(
+				"\n\nNote: this summary covers the %d most severe findings; %d more were left out.",
+				r.cfg.MaxVulnerabilities, omitted)
+		}
+		resp.Summary = summary
+		return err
+	})
+
+	resp.CompletedAt = time.Now().UTC()
+}
+
+// omit records that n findings were left out of a prompt.
+func (r *run) omit(n int) {
+	r.resp.LLMUsage.OmittedFindings = max(r.resp.LLMUsage.OmittedFindings, n)
+}
+
+// chat sends messages to the LLM for step, enforcing the run's token
+// budget, and records the exchange.
+func (r *run) chat(ctx context.Context, step string, messages []llm.Message) (string, error) {
+	tokens := llm.EstimateTokens(messages)
+	usage := r.resp.LLMUsage
+	if r.cfg.TokenBudget > 0 && usage.EstimatedTokens+tokens > r.cfg.TokenBudget {
+		return "", fmt.Errorf("%w: %d of %d tokens used, next call needs %d",
+			ErrBudgetExceeded, usage.EstimatedTokens, r.cfg.TokenBudget, tokens)
+	}
+
+	usage.Calls++
+	usage.EstimatedTokens += tokens
+	choice := r.choose(step)
+	model := r.model(step)
+	start := time.Now()
+	var content, reasoning string
+	var err error
+	if r.cfg.Explain {
+		content, reasoning, err = llm.ChatReasoning(ctx, model, messages)
+		if reasoning != "" {
+			r.explanation(step).Reasoning = reasoning
+		}
+	} else {
+		content, err = llm.Chat(ctx, model, messages)
+	}
+	ex := Exchange{
+		Step:       step,
+		Variant:    choice.Variant,
+		Model:      model,
+		Messages:   messages,
+		Response:   content,
+		Reasoning:  reasoning,
+		Valid:      err == nil && strings.TrimSpace(content) != "",
+		DurationMS: time.Since(start).Milliseconds(),
+		Tokens:     tokens + llm.EstimateTokens([]llm.Message{{Content: content}}),
+		At:         start.UTC(),
+	}
+	if err != nil {
+		ex.Error = err.Error()
+	}
+	r.resp.Exchanges = append(r.resp.Exchanges, ex)
+	return content, err
+}
+
+// model returns the model step is sent to.
+func (r *run) model(step string) string {
+	return cmp.Or(r.choose(step).Model, r.cfg.Model)
+}
+
+// minimized reports whether the prompt of step must hold only derived
+// metadata, and records in the usage that it does.
+func (r *run) minimized(step string) bool {
+	if !r.cfg.MinimizeData || llm.IsLocal(r.model(step)) {
+		return false
+	}
+	r.resp.LLMUsage.Minimized = true
+	return true
+}
+
+// choose returns the experiment variant of step for this run, picked on
+// first use. Runs asking for a model stay out of experiments.
+func (r *run) choose(step string) experiment.Choice {
+	if c, ok := r.choices[step]; ok {
+		return c
+	}
+	c := experiment.Choice{Variant: experiment.Control, Prompts: llm.CurrentPrompts()}
+	if r.req.Model == "" {
+		c = r.experiments.Pick(step, c.Prompts)
+	}
+	r.choices[step] = c
+	if c.Variant != experiment.Control {
+		if r.resp.LLMUsage.Variants == nil {
+			r.resp.LLMUsage.Variants = map[string]string{}
+		}
+		r.resp.LLMUsage.Variants[step] = c.Variant
+	}
+	return c
+}
+
+// llmStep runs fn when enabled and the LLM is configured. A failure degrades
+// the run to partial rather than failing it, since the scan data is intact.
+func (r *run) llmStep(ctx context.Context, name string, enabled bool, fn func(context.Context) error) {
+	if !enabled {
+		r.record(StepResult{Step: name, Status: StepSkipped})
+		return
+	}
+	if err := r.req.SkipLLM; err != nil {
+		r.record(StepResult{Step: name, Status: StepSkipped, Error: err.Error(), ErrorCode: errcode.Of(err)})
+		return
+	}
+	err := r.step(ctx, name, fn)
+	switch {
+	case err == nil:
+	case errors.Is(err, llm.ErrNotConfigured):
+		last := &r.resp.StepResults[len(r.resp.StepResults)-1]
+		last.Status = StepSkipped
+		r.progress(*last)
+	default:
+		r.resp.Status = StatusPartial
+	}
+}
+
+func (r *run) step(ctx context.Context, name string, fn func(context.Context) error) error {
+	r.progress(StepResult{Step: name, Status: StepRunning})
+	ctx, span := tracing.Start(ctx, "agent.step."+name, attribute.String("agent.step", name))
+	start := time.Now()
+	err := fn(ctx)
+	tracing.End(span, err)
+
+	logger := zerolog.Ctx(ctx).With().Str("step", name).Str("target", r.resp.Target).Logger()
+	if err != nil {
+		logger.Warn().Err(err).Dur("duration", time.Since(start)).Msg("Agent step failed")
+	} else {
+		logger.Debug().Dur("duration", time.Since(start)).Msg("Agent step finished")
+	}
+
+	result := StepResult{
+		Step:       name,
+		Status:     StepSucceeded,
+		DurationMS: time.Since(start).Milliseconds(),
+	}
+	if err != nil {
+		result.Status = StepFailed
+		result.Error = err.Error()
+		result.ErrorCode = errcode.Of(err)
+	}
+	r.record(result)
+	return err
+}
+
+// record adds a finished step to the response.
+func (r *run) record(result StepResult) {
+	r.resp.StepResults = append(r.resp.StepResults, result)
+	r.progress(result)
+}
+
+func (r *run) progress(result StepResult) {
+	if r.req.Progress != nil {
+		r.req.Progress(result)
+	}
+}
+
+func targetAttrs(req Request) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		attribute.String("scan.target_type", req.TargetType),
+		attribute.String("scan.target", req.Target),
+	}
+}
@@ -0,0 +1,258 @@
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+	"strings"
+	"weeklysec/internal/trivy"
+)
+
+// severityWeights feed the risk score; 100 is the ceiling.
+var severityWeights = map[string]float64{
+	"CRITICAL": 10,
+	"HIGH":     5,
+	"MEDIUM":   2,
+	"LOW":      0.5,
+}
+
+// SeverityWeight is what one finding of severity sev adds to a risk score.
+func SeverityWeight(sev string) float64 {
+	return severityWeights[normalizeSeverity(sev)]
+}
+
+func analyze(vulns []trivy.Vulnerability) *Analysis {
+	a := &Analysis{
+		TotalVulnerabilities: len(vulns),
+		BySeverity:           make(map[string]int, len(trivy.Severities)),
+	}
+	for _, s := range trivy.Severities {
+		a.BySeverity[s] = 0
+	}
+
+	var score float64
+	for _, v := range vulns {
+		sev := normalizeSeverity(v.Severity)
+		a.BySeverity[sev]++
+		if v.FixedVersion != "" {
+			a.Fixable++
+		}
+		score += severityWeights[sev]
+	}
+	a.RiskScore = math.Min(100, math.Round(score*10)/10)
+	return a
+}
+
+// prioritize ranks vulnerabilities at or above threshold. Severity sets the
+// baseline and an available fix moves a finding up, since it can be acted on
+// right away. Duplicate CVE/package pairs are reported once.
+func prioritize(vulns []trivy.Vulnerability, threshold string) []PrioritizedFinding {
+	limit := trivy.SeverityRank(threshold)
+	seen := make(map[string]bool)
+
+	var out []PrioritizedFinding
+	for _, v := range vulns {
+		sev := normalizeSeverity(v.Severity)
+		if trivy.SeverityRank(sev) > limit {
+			continue
+		}
+		key := v.VulnerabilityID + "|" + v.PkgName
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		priority, reason := rank(sev, v.FixedVersion != "")
+		out = append(out, PrioritizedFinding{
+			Priority:         priority,
+			VulnerabilityID:  v.VulnerabilityID,
+			PkgName:          v.PkgName,
+			InstalledVersion: v.InstalledVersion,
+			FixedVersion:     v.FixedVersion,
+			Severity:         sev,
+			CVSSScore:        v.Score(),
+			Title:            v.Title,
+			Reason:           reason,
+			Images:           v.Artifacts,
+		})
+	}
+
+	sort.SliceStable(out, func(i, j int) bool {
+		if out[i].Priority != out[j].Priority {
+			return out[i].Priority < out[j].Priority
+		}
+		return out[i].CVSSScore > out[j].CVSSScore
+	})
+	return out
+}
+
+// escalateUnsigned moves findings of an image without a trusted signature
+// up one priority: its provenance is unknown, so the findings are less
+// likely to be the only problem with it.
+func escalateUnsigned(findings []PrioritizedFinding, status string) {
+	for i := range findings {
+		findings[i].Priority = max(findings[i].Priority-1, 1)
+		findings[i].Reason += ", image is " + status
+	}
+}
+
+func rank(severity string, fixable bool) (int, string) {
+	fix := "no fix available yet"
+	if fixable {
+		fix = "a fixed version is available"
+	}
+
+	priority := trivy.SeverityRank(severity) + 1
+	if !fixable {
+		priority++
+	}
+	priority = min(max(priority, 1), 4)
+
+	return priority, fmt.Sprintf("%s severity, %s", strings.ToLower(severity), fix)
+}
+
+// buildFixes groups prioritized findings by package into upgrade actions.
+func buildFixes(findings []PrioritizedFinding) []Fix {
+	byPkg := make(map[string]*Fix)
+	var order []string
+
+	for _, f := range findings {
+		if f.FixedVersion == "" {
+			continue
+		}
+		key := f.PkgName + "@" + f.InstalledVersion
+		fix, ok := byPkg[key]
+		if !ok {
+			fix = &Fix{
+				PkgName:            f.PkgName,
+				CurrentVersion:     f.InstalledVersion,
+				RecommendedVersion: firstVersion(f.FixedVersion),
+				Priority:           f.Priority,
+			}
+			byPkg[key] = fix
+			order = append(order, key)
+		}
+		fix.Resolves = append(fix.Resolves, f.VulnerabilityID)
+		fix.Priority = min(fix.Priority, f.Priority)
+		for _, img := range f.Images {
+			if !slices.Contains(fix.Images, img) {
+				fix.Images = append(fix.Images, img)
+			}
+		}
+	}
+
+	fixes := make([]Fix, 0, len(order))
+	for _, key := range order {
+		fix := byPkg[key]
+		fix.Description = DescribeFix(*fix)
+		fixes = append(fixes, *fix)
+	}
+	sort.SliceStable(fixes, func(i, j int) bool { return fixes[i].Priority < fixes[j].Priority })
+	return fixes
+}
+
+// DescribeFix returns the one-line description of an upgrade.
+func DescribeFix(fix Fix) string {
+	return fmt.Sprintf("Upgrade %s from %s to %s to resolve %s",
+		fix.PkgName, fix.CurrentVersion, fix.RecommendedVersion, strings.Join(fix.Resolves, ", "))
+}
+
+// firstVersion picks the first entry of Trivy's comma-separated FixedVersion.
+func firstVersion(v string) string {
+	first, _, _ := strings.Cut(v, ",")
+	return strings.TrimSpace(first)
+}
+
+func normalizeSeverity(s string) string {
+	return trivy.Severities[trivy.SeverityRank(s)]
+}
+
+// trimReport returns report cut down to its n most severe findings, by
+// severity and then CVSS score, and how many were left out. n <= 0 keeps
+// them all.
+func trimReport(report *trivy.Report, n int) (*trivy.Report, int) {
+	type ranked struct {
+		result int
+		v      trivy.Vulnerability
+	}
+	var all []ranked
+	for i, res := range report.Results {
+		for _, v := range res.Vulnerabilities {
+			all = append(all, ranked{i, v})
+		}
+	}
+	if n <= 0 || len(all) <= n {
+		return report, 0
+	}
+
+	sort.SliceStable(all, func(i, j int) bool {
+		a, b := all[i].v, all[j].v
+		if ra, rb := trivy.SeverityRank(a.Severity), trivy.SeverityRank(b.Severity); ra != rb {
+			return ra < rb
+		}
+		if sa, sb := a.Score(), b.Score(); sa != sb {
+			return sa > sb
+		}
+		if a.VulnerabilityID != b.VulnerabilityID {
+			return a.VulnerabilityID < b.VulnerabilityID
+		}
+		return a.PkgName < b.PkgName
+	})
+
+	trimmed := *report
+	trimmed.Results = make([]trivy.Result, len(report.Results))
+	for i, res := range report.Results {
+		res.Vulnerabilities = nil
+		trimmed.Results[i] = res
+	}
+	for _, r := range all[:n] {
+		res := &trimmed.Results[r.result]
+		res.Vulnerabilities = append(res.Vulnerabilities, r.v)
+	}
+	return &trimmed, len(all) - n
+}
+
+// findingFacts is the derived metadata of a finding, all that leaves the
+// host in data-minimization mode.
+type findingFacts struct {
+	VulnerabilityID  string `json:"vulnerability_id"`
+	PkgName          string `json:"pkg_name"`
+	InstalledVersion string `json:"installed_version"`
+	FixedVersion     string `json:"fixed_version,omitempty"`
+	Severity         string `json:"severity"`
+}
+
+// misconfigFacts is the derived metadata of a failed configuration check.
+type misconfigFacts struct {
+	ID       string `json:"id"`
+	Severity string `json:"severity"`
+}
+
+// minimalReport renders the facts of report's findings as JSON, leaving out
+// the target, file paths, descriptions and everything else Trivy reports.
+func minimalReport(report *trivy.Report) string {
+	var out struct {
+		Findings          []findingFacts   `json:"findings"`
+		Misconfigurations []misconfigFacts `json:"misconfigurations,omitempty"`
+	}
+	out.Findings = []findingFacts{}
+	for _, v := range report.Vulnerabilities() {
+		out.Findings = append(out.Findings, findingFacts{
+			VulnerabilityID:  v.VulnerabilityID,
+			PkgName:          v.PkgName,
+			InstalledVersion: v.InstalledVersion,
+			FixedVersion:     v.FixedVersion,
+			Severity:         normalizeSeverity(v.Severity),
+		})
+	}
+	for _, m := range report.Misconfigurations() {
+		out.Misconfigurations = append(out.Misconfigurations, misconfigFacts{
+			ID:       m.CheckID(),
+			Severity: normalizeSeverity(m.Severity),
+		})
+	}
+	data, _ := json.Marshal(out)
+	return string(data)
+}
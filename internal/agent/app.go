@@ -0,0 +1,72 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"weeklysec/internal/errcode"
+	"weeklysec/internal/queue"
+	"weeklysec/internal/trivy"
+)
+
+// appScanWorkers bounds the images of one application scanned at once; the
+// scan queue still bounds the server as a whole.
+const appScanWorkers = 4
+
+// ImageResult is how the scan of one image of an application went.
+type ImageResult struct {
+	Image           string            `json:"image"`
+	Status          string            `json:"status"` // StatusCompleted or StatusFailed
+	Error           string            `json:"error,omitempty"`
+	ErrorCode       errcode.Code      `json:"error_code,omitempty"`
+	Vulnerabilities int               `json:"vulnerabilities"` // found in the image, shared ones included
+	Layers          *trivy.LayerStats `json:"layers,omitempty"`
+}
+
+// scanImages scans the images of an application at once and merges their
+// reports into one named after it; see trivy.Merge. An image that failed is
+// reported in the response and leaves the run partial. The scan fails only
+// when every image did.
+func (r *run) scanImages(ctx context.Context, scans *queue.Pool) (*trivy.ScanResult, error) {
+	images := r.req.Images
+	results := make([]*trivy.ScanResult, len(images))
+	errs := make([]error, len(images))
+	r.resp.Images = make([]ImageResult, len(images))
+
+	sem := make(chan struct{}, appScanWorkers)
+	var wg sync.WaitGroup
+	for i, image := range images {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			result, stats, err := r.scanTarget(ctx, scans, "image", image)
+			res := ImageResult{Image: image, Status: StatusCompleted, Layers: stats}
+			if err != nil {
+				res.Status, res.Error, res.ErrorCode = StatusFailed, err.Error(), errcode.Of(err)
+			} else {
+				result.Report.ArtifactName = image
+				res.Vulnerabilities = len(result.Report.Vulnerabilities())
+			}
+			results[i], errs[i], r.resp.Images[i] = result, err, res
+		}()
+	}
+	wg.Wait()
+
+	var reports []*trivy.Report
+	for i, result := range results {
+		if errs[i] == nil {
+			reports = append(reports, result.Report)
+		}
+	}
+	if len(reports) == 0 {
+		return nil, fmt.Errorf("no image of %s could be scanned: %s: %w", r.req.Target, images[0], errs[0])
+	}
+	if len(reports) < len(images) {
+		r.resp.Status = StatusPartial
+	}
+	report := trivy.Merge(r.req.Target, reports)
+	return &trivy.ScanResult{RawOutput: report.JSON(), Report: report}, nil
+}
@@ -0,0 +1,139 @@
+package agent
+
+import (
+	"fmt"
+	"strings"
+	"weeklysec/internal/trivy"
+)
+
+// Explanation is the rationale behind one step's outcome, recorded in
+// explain mode so reviewers can audit why a finding was ranked as it was
+// or why a fix was chosen.
+type Explanation struct {
+	Step      string          `json:"step"`
+	Rationale string          `json:"rationale,omitempty"`
+	Reasoning string          `json:"reasoning,omitempty"` // the model's own, from models that return it
+	Items     []ExplainedItem `json:"items,omitempty"`
+}
+
+// ExplainedItem is the rationale for one finding or fix.
+type ExplainedItem struct {
+	ID        string `json:"id"` // "CVE@package" for findings, "package@version" for fixes
+	Rationale string `json:"rationale"`
+}
+
+// ExplanationFor returns the explanation of step, if the run recorded one.
+func ExplanationFor(explanations []Explanation, step string) *Explanation {
+	for i := range explanations {
+		if explanations[i].Step == step {
+			return &explanations[i]
+		}
+	}
+	return nil
+}
+
+// explanation returns the run's explanation of step, adding it on first
+// use. The pointer is only good until the next one is added.
+func (r *run) explanation(step string) *Explanation {
+	if e := ExplanationFor(r.resp.Explanations, step); e != nil {
+		return e
+	}
+	r.resp.Explanations = append(r.resp.Explanations, Explanation{Step: step})
+	return &r.resp.Explanations[len(r.resp.Explanations)-1]
+}
+
+func (r *run) explainAnalysis(parsed int) {
+	resp := r.resp
+	why := fmt.Sprintf("%d findings were parsed from the Trivy report", parsed)
+	if resp.Ignored > 0 {
+		why += fmt.Sprintf("; %d were dropped by the ignore policy", resp.Ignored)
+	}
+	if n := len(resp.Overridden); n > 0 {
+		why += fmt.Sprintf("; %d were re-rated by the tenant's severity rules", n)
+	}
+	if a := resp.Analysis; a != nil && a.Misconfigurations > 0 {
+		why += fmt.Sprintf("; %d configuration checks failed and count towards the risk score", a.Misconfigurations)
+	}
+	if a := resp.Analysis; a != nil && a.Secrets > 0 {
+		why += fmt.Sprintf("; %d leaked secrets were found, each with a rotation runbook", a.Secrets)
+	}
+	r.explanation(StepAnalyze).Rationale = why + "."
+}
+
+// explainPriorities explains the ranking and the fixes built from it;
+// unsigned is the signature status that escalated the findings, if any.
+func (r *run) explainPriorities(unsigned string) {
+	resp := r.resp
+	why := fmt.Sprintf("Findings at %s severity or above are ranked: severity sets the priority, "+
+		"a missing fix lowers it one level, and a CVE is counted once per package.",
+		strings.ToLower(r.cfg.PriorityThreshold))
+	if ar := resp.AcceptedRisk; ar != nil && ar.Count > 0 {
+		why += fmt.Sprintf(" %d findings under accepted risk were left out.", ar.Count)
+	}
+	if ln := resp.LearnedNoise; ln != nil {
+		why += fmt.Sprintf(" %d findings the team triaged as noise in earlier scans were left out.", ln.Count)
+	}
+	if n := len(resp.Filtered); n > 0 {
+		why += fmt.Sprintf(" %d findings were dropped by scoring hooks.", n)
+	}
+	if unsigned != "" {
+		why += fmt.Sprintf(" The image is %s, so every finding moves up one level.", unsigned)
+	}
+
+	e := r.explanation(StepPrioritize)
+	e.Rationale = why
+	for _, f := range resp.Prioritized {
+		e.Items = append(e.Items, ExplainedItem{
+			ID:        f.VulnerabilityID + "@" + f.PkgName,
+			Rationale: explainFinding(f, unsigned, r.rescored[f.VulnerabilityID+"@"+f.PkgName]),
+		})
+	}
+
+	fixes := r.explanation(StepRemediation)
+	fixes.Items = nil
+	for _, fix := range resp.Remediation.Fixes {
+		fixes.Items = append(fixes.Items, ExplainedItem{
+			ID:        fix.PkgName + "@" + fix.CurrentVersion,
+			Rationale: explainFix(fix, resp.Prioritized),
+		})
+	}
+}
+
+// explainFinding retraces how rank, escalateUnsigned and the scoring
+// hooks arrived at f's priority.
+func explainFinding(f PrioritizedFinding, unsigned string, hooks []string) string {
+	base := min(trivy.SeverityRank(f.Severity)+1, 4)
+	sev := strings.ToLower(f.Severity)
+	if f.OriginalSeverity != "" {
+		sev += fmt.Sprintf(" (re-rated from %s by a tenant rule)", strings.ToLower(f.OriginalSeverity))
+	}
+	parts := []string{fmt.Sprintf("%s severity sets P%d", sev, base)}
+	if f.FixedVersion != "" {
+		parts = append(parts, fmt.Sprintf("a fixed version (%s) is available, so it can be acted on now", f.FixedVersion))
+	} else {
+		parts = append(parts, "no fix is available yet, which lowers it one level")
+	}
+	if unsigned != "" {
+		parts = append(parts, "the image is "+unsigned+", which raises it one level")
+	}
+	if len(hooks) > 0 {
+		parts = append(parts, "the scoring hooks "+strings.Join(hooks, ", ")+" re-ranked it")
+	}
+	return fmt.Sprintf("%s; ranked P%d.", strings.Join(parts, "; "), f.Priority)
+}
+
+// explainFix says why fix upgrades to the version it does.
+func explainFix(fix Fix, findings []PrioritizedFinding) string {
+	why := fmt.Sprintf("Upgrades to %s, the first version Trivy lists as fixing it", fix.RecommendedVersion)
+	for _, f := range findings {
+		if f.PkgName == fix.PkgName && f.InstalledVersion == fix.CurrentVersion && strings.Contains(f.FixedVersion, ",") {
+			why += fmt.Sprintf(" (of %s)", f.FixedVersion)
+			break
+		}
+	}
+	why = fmt.Sprintf("%s; resolves %d findings, the most urgent at P%d.", why, len(fix.Resolves), fix.Priority)
+	if src := fix.Source; src != nil {
+		why += fmt.Sprintf(" It applies to line %d of %s (%s).", src.Line, src.File, strings.ReplaceAll(src.Kind, "_", " "))
+	}
+	return why
+}
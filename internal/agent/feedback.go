@@ -0,0 +1,68 @@
+package agent
+
+import (
+	"time"
+	"weeklysec/internal/llm"
+)
+
+// Feedback subjects: what a rating is about.
+const (
+	FeedbackSummary = "summary" // the scan's summary
+	FeedbackFix     = "fix"     // one fix of the remediation package, or the package as a whole
+	FeedbackFinding = "finding" // one finding: rated down as noise, up as a real issue
+)
+
+// FeedbackSubjects lists the feedback subjects.
+var FeedbackSubjects = []string{FeedbackSummary, FeedbackFix, FeedbackFinding}
+
+// Feedback ratings.
+const (
+	RatingUp   = "up"
+	RatingDown = "down"
+)
+
+// Exchange is one LLM call of a run: the prompt sent and the answer.
+type Exchange struct {
+	Step       string        `json:"step"`    // StepRemediation or StepSummarize
+	Variant    string        `json:"variant"` // the experiment variant, or experiment.Control
+	Model      string        `json:"model,omitempty"`
+	Messages   []llm.Message `json:"messages"`
+	Response   string        `json:"response"`
+	Reasoning  string        `json:"reasoning,omitempty"` // returned by reasoning models in explain mode
+	Error      string        `json:"error,omitempty"`
+	Valid      bool          `json:"valid"` // the answer was usable
+	DurationMS int64         `json:"duration_ms"`
+	Tokens     int           `json:"tokens"` // estimated, prompt and answer
+	At         time.Time     `json:"at"`
+}
+
+// Feedback is a user's rating of generated text, kept with the exchange
+// that produced it so it can be used to tune prompts or models, or of a
+// finding, which teaches later scans what the team considers noise.
+type Feedback struct {
+	ID              string    `json:"id"`
+	Org             string    `json:"org"`
+	Project         string    `json:"project"`
+	ScanID          string    `json:"scan_id"`
+	Target          string    `json:"target"`
+	Subject         string    `json:"subject"`
+	PkgName         string    `json:"pkg_name,omitempty"`         // the fix or finding rated; empty for all
+	VulnerabilityID string    `json:"vulnerability_id,omitempty"` // the finding rated
+	Fix             *Fix      `json:"fix,omitempty"`
+	Rating          string    `json:"rating,omitempty"` // up, down or empty for a comment only
+	Comment         string    `json:"comment,omitempty"`
+	Exchange        *Exchange `json:"exchange,omitempty"` // unset when the text was not generated by the LLM
+	CreatedBy       string    `json:"created_by,omitempty"`
+	CreatedAt       time.Time `json:"created_at"`
+}
+
+// ExchangeFor returns the exchange of step, if the run made one.
+func ExchangeFor(exchanges []Exchange, step string) *Exchange {
+	for i := len(exchanges) - 1; i >= 0; i-- {
+		if exchanges[i].Step == step {
+			e := exchanges[i]
+			return &e
+		}
+	}
+	return nil
+}
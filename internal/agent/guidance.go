@@ -0,0 +1,65 @@
+package agent
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// MaxGuidance bounds the text of one tenant's guidance, which is sent with
+// every remediation prompt.
+const MaxGuidance = 4000
+
+// Guidance is a tenant's house style for generated fixes: its stack
+// conventions, base images it does not allow and how it patches. It is
+// added to the remediation prompts of the tenant's runs. Project "*"
+// applies to every project of the org.
+type Guidance struct {
+	Org                 string    `json:"org"`
+	Project             string    `json:"project"`
+	Conventions         string    `json:"conventions,omitempty"`           // tech stack and coding conventions
+	ForbiddenBaseImages []string  `json:"forbidden_base_images,omitempty"` // never recommend these
+	PatchingPolicy      string    `json:"patching_policy,omitempty"`       // e.g. "minor upgrades only, no major bumps"
+	Instructions        string    `json:"instructions,omitempty"`          // anything else about the output
+	UpdatedBy           string    `json:"updated_by,omitempty"`
+	UpdatedAt           time.Time `json:"updated_at"`
+}
+
+// Key identifies g among the guidance of every tenant.
+func (g Guidance) Key() string {
+	return g.Org + "/" + g.Project
+}
+
+// Size is the length of g's text, checked against MaxGuidance.
+func (g Guidance) Size() int {
+	n := len(g.Conventions) + len(g.PatchingPolicy) + len(g.Instructions)
+	for _, img := range g.ForbiddenBaseImages {
+		n += len(img)
+	}
+	return n
+}
+
+// guidancePrompt renders the guidance of a run for the system prompt,
+// org-wide guidance first; empty without any.
+func guidancePrompt(guidance []Guidance) string {
+	var b strings.Builder
+	for _, g := range guidance {
+		if g.Conventions != "" {
+			fmt.Fprintf(&b, "- Conventions: %s\n", g.Conventions)
+		}
+		if len(g.ForbiddenBaseImages) > 0 {
+			fmt.Fprintf(&b, "- Never recommend these base images: %s\n", strings.Join(g.ForbiddenBaseImages, ", "))
+		}
+		if g.PatchingPolicy != "" {
+			fmt.Fprintf(&b, "- Patching policy: %s\n", g.PatchingPolicy)
+		}
+		if g.Instructions != "" {
+			fmt.Fprintf(&b, "- %s\n", g.Instructions)
+		}
+	}
+	if b.Len() == 0 {
+		return ""
+	}
+	return "\n\nThe organization asks that its house style be followed:\n" + b.String() +
+		"Follow it unless it conflicts with the JSON format asked for."
+}
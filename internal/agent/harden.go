@@ -0,0 +1,47 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"weeklysec/internal/hardening"
+)
+
+// harden reviews the Kubernetes manifests of a file target and adds its
+// recommendations to the remediation package, whether or not the scan
+// found anything. Targets without manifests skip the step.
+func (r *run) harden(ctx context.Context) {
+	if r.req.TargetType != "file" || r.resp.Remediation == nil {
+		return
+	}
+	manifests, err := hardening.Manifests(r.req.Target)
+	if err == nil && len(manifests) == 0 {
+		return
+	}
+	_ = r.step(ctx, StepHarden, func(context.Context) error {
+		if err != nil {
+			return fmt.Errorf("failed to read manifests: %w", err)
+		}
+		recs, err := hardening.Review(manifests)
+		if err != nil {
+			return err
+		}
+		r.resp.Remediation.Hardening = recs
+		if r.cfg.Explain {
+			r.explanation(StepHarden).Rationale = fmt.Sprintf(
+				"%d manifests were checked for container security contexts, resource limits, host access, "+
+					"network policies and RBAC grants; %d resources or containers need changes.", len(manifests), len(recs))
+		}
+		return nil
+	})
+}
+
+// minimalHardening strips recommendations down to their category,
+// severity and issues; files, resource names and patches stay on the host
+// in data-minimization mode.
+func minimalHardening(recs []hardening.Recommendation) []hardening.Recommendation {
+	out := make([]hardening.Recommendation, len(recs))
+	for i, rec := range recs {
+		out[i] = hardening.Recommendation{Category: rec.Category, Severity: rec.Severity, Issues: rec.Issues}
+	}
+	return out
+}
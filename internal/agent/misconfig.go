@@ -0,0 +1,159 @@
+package agent
+
+import (
+	"cmp"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"weeklysec/internal/trivy"
+)
+
+// Misconfiguration is a failed configuration check ranked for remediation.
+// Unlike a vulnerability it has no package or fixed version: it is fixed by
+// editing File as Resolution says.
+type Misconfiguration struct {
+	Priority   int    `json:"priority"`
+	ID         string `json:"id"`    // AVD ID, e.g. AVD-DS-0002
+	Check      string `json:"check"` // the check's title
+	Severity   string `json:"severity"`
+	File       string `json:"file"`
+	StartLine  int    `json:"start_line,omitempty"`
+	EndLine    int    `json:"end_line,omitempty"`
+	Resource   string `json:"resource,omitempty"` // e.g. a Kubernetes object or Terraform block
+	Message    string `json:"message,omitempty"`
+	Resolution string `json:"resolution,omitempty"`
+	URL        string `json:"url,omitempty"`
+	Reason     string `json:"reason"`
+}
+
+// ConfigFix is the edit resolving one check in one file, possibly at
+// several places.
+type ConfigFix struct {
+	File        string `json:"file,omitempty"`
+	ID          string `json:"id"`
+	Lines       []int  `json:"lines,omitempty"` // start lines of the failing blocks
+	Priority    int    `json:"priority"`
+	Description string `json:"description"`
+}
+
+// prioritizeMisconfigs ranks misconfigurations at or above threshold by
+// severity alone: every check comes with its resolution, so there is no
+// missing fix to lower it. A check failing twice at the same place is
+// reported once.
+func prioritizeMisconfigs(ms []trivy.Misconfiguration, threshold string) []Misconfiguration {
+	limit := trivy.SeverityRank(threshold)
+	seen := make(map[string]bool)
+
+	var out []Misconfiguration
+	for _, m := range ms {
+		sev := normalizeSeverity(m.Severity)
+		if trivy.SeverityRank(sev) > limit {
+			continue
+		}
+		key := fmt.Sprintf("%s|%s|%d", m.CheckID(), m.File, m.CauseMetadata.StartLine)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		out = append(out, Misconfiguration{
+			Priority:   min(trivy.SeverityRank(sev)+1, 4),
+			ID:         m.CheckID(),
+			Check:      m.Title,
+			Severity:   sev,
+			File:       m.File,
+			StartLine:  m.CauseMetadata.StartLine,
+			EndLine:    m.CauseMetadata.EndLine,
+			Resource:   m.CauseMetadata.Resource,
+			Message:    m.Message,
+			Resolution: m.Resolution,
+			URL:        m.PrimaryURL,
+			Reason:     strings.ToLower(sev) + " severity configuration check",
+		})
+	}
+
+	sort.SliceStable(out, func(i, j int) bool {
+		if out[i].Priority != out[j].Priority {
+			return out[i].Priority < out[j].Priority
+		}
+		if out[i].File != out[j].File {
+			return out[i].File < out[j].File
+		}
+		return out[i].StartLine < out[j].StartLine
+	})
+	return out
+}
+
+// buildConfigFixes groups ranked misconfigurations by file and check into
+// edits.
+func buildConfigFixes(ms []Misconfiguration) []ConfigFix {
+	byKey := make(map[string]*ConfigFix)
+	var order []string
+
+	for _, m := range ms {
+		key := m.File + "|" + m.ID
+		fix, ok := byKey[key]
+		if !ok {
+			fix = &ConfigFix{
+				File:        m.File,
+				ID:          m.ID,
+				Priority:    m.Priority,
+				Description: DescribeConfigFix(m),
+			}
+			byKey[key] = fix
+			order = append(order, key)
+		}
+		if m.StartLine > 0 {
+			fix.Lines = append(fix.Lines, m.StartLine)
+		}
+		fix.Priority = min(fix.Priority, m.Priority)
+	}
+
+	fixes := make([]ConfigFix, 0, len(order))
+	for _, key := range order {
+		fixes = append(fixes, *byKey[key])
+	}
+	sort.SliceStable(fixes, func(i, j int) bool { return fixes[i].Priority < fixes[j].Priority })
+	return fixes
+}
+
+// DescribeConfigFix returns the one-line description of the edit resolving
+// m.
+func DescribeConfigFix(m Misconfiguration) string {
+	what := strings.TrimSuffix(cmp.Or(m.Resolution, m.Check), ".")
+	return fmt.Sprintf("%s in %s to resolve %s", what, m.File, m.ID)
+}
+
+// addMisconfigs counts ms into a and weighs them into its risk score like
+// vulnerabilities of the same severity.
+func addMisconfigs(a *Analysis, ms []trivy.Misconfiguration) {
+	if len(ms) == 0 {
+		return
+	}
+	a.Misconfigurations = len(ms)
+	a.MisconfigsBySeverity = make(map[string]int, len(trivy.Severities))
+	score := a.RiskScore
+	for _, m := range ms {
+		sev := normalizeSeverity(m.Severity)
+		a.MisconfigsBySeverity[sev]++
+		score += severityWeights[sev]
+	}
+	a.RiskScore = min(100, math.Round(score*10)/10)
+}
+
+// Actionable reports whether p holds any upgrade, configuration fix,
+// rotation runbook or hardening recommendation.
+func (p *RemediationPackage) Actionable() bool {
+	return p != nil && (len(p.Fixes) > 0 || len(p.ConfigFixes) > 0 || len(p.Runbooks) > 0 || len(p.Hardening) > 0)
+}
+
+// minimalConfigFixes strips fixes down to their check IDs and priorities;
+// file paths and descriptions stay on the host in data-minimization mode.
+func minimalConfigFixes(fixes []ConfigFix) []ConfigFix {
+	out := make([]ConfigFix, len(fixes))
+	for i, f := range fixes {
+		out[i] = ConfigFix{ID: f.ID, Priority: f.Priority, Description: "resolve " + f.ID}
+	}
+	return out
+}
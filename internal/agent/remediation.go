@@ -0,0 +1,117 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"weeklysec/internal/errcode"
+	"weeklysec/internal/llm"
+)
+
+// ErrInvalidJSON is returned when the LLM does not answer with the JSON
+// object a step asked for.
+var ErrInvalidJSON = errcode.New(errcode.LLMInvalidJSON, "LLM returned invalid JSON")
+
+func (r *run) writeRemediation(ctx context.Context) error {
+	resp := r.resp
+	// Past the cap, only the fixes of the most urgent findings are
+	// described; the pull request still applies every fix.
+	list, note := resp.Remediation.Fixes, ""
+	if n := r.cfg.MaxVulnerabilities; n > 0 && len(resp.Prioritized) > n {
+		list = buildFixes(resp.Prioritized[:n])
+		r.anchorFixes(list)
+		r.omit(len(resp.Prioritized) - n)
+		note = fmt.Sprintf("\nOnly the fixes for the %d most urgent of %d findings are listed.\n", n, len(resp.Prioritized))
+	}
+
+	target, configFixes, src := resp.Target, resp.Remediation.ConfigFixes, r.req.Source
+	hardening, runbooks := resp.Remediation.Hardening, resp.Remediation.Runbooks
+	if r.minimized(StepRemediation) {
+		target = "withheld"
+		configFixes = minimalConfigFixes(configFixes)
+		hardening = minimalHardening(hardening)
+		runbooks = minimalRunbooks(runbooks)
+		src = nil
+		list = withoutSources(list)
+	}
+	fixes, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal fixes: %w", err)
+	}
+	prompt := fmt.Sprintf("Target: %s (%s)\n\nFixes:\n%s\n%s", target, resp.TargetType, fixes, note)
+	if src != nil {
+		prompt += fmt.Sprintf("\nSource (%s):\n%s\nFixes with a \"source\" apply to that line. Reference those lines and "+
+			"quote their instructions as they are written above instead of guessing the file's contents.\n", src.Path, src.numbered())
+	}
+	if len(configFixes) > 0 {
+		data, err := json.MarshalIndent(configFixes, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal configuration fixes: %w", err)
+		}
+		prompt += fmt.Sprintf("\nConfiguration fixes:\n%s\n", data)
+	}
+	if len(runbooks) > 0 {
+		data, err := json.MarshalIndent(runbooks, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal rotation runbooks: %w", err)
+		}
+		prompt += fmt.Sprintf("\nLeaked secrets and their rotation runbooks:\n%s\n", data)
+	}
+	if len(hardening) > 0 {
+		data, err := json.MarshalIndent(hardening, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal hardening recommendations: %w", err)
+		}
+		prompt += fmt.Sprintf("\nHardening recommendations:\n%s\n", data)
+	}
+	if r.cfg.Explain {
+		prompt += "\nAlso include a \"rationale\" key: a short paragraph for a security reviewer on why these fixes were chosen and ordered as they are.\n"
+	}
+
+	system := r.choose(StepRemediation).Prompts.RemediationSystem + guidancePrompt(r.req.Guidance)
+	if r.cfg.Explain && len(r.req.Guidance) > 0 {
+		r.explanation(StepRemediation).Rationale = "The prompt included the organization's guidance on conventions, base images and patching."
+	}
+
+	content, err := r.chat(ctx, StepRemediation, []llm.Message{
+		{Role: "system", Content: system},
+		{Role: "user", Content: prompt},
+	})
+	if err != nil {
+		return err
+	}
+
+	var out struct {
+		CommitMessage string `json:"commit_message"`
+		PRTitle       string `json:"pr_title"`
+		PRDescription string `json:"pr_description"`
+		Rationale     string `json:"rationale"`
+	}
+	if err := decodeJSONObject(content, &out); err != nil {
+		r.resp.Exchanges[len(r.resp.Exchanges)-1].Valid = false
+		return err
+	}
+
+	resp.Remediation.CommitMessage = out.CommitMessage
+	resp.Remediation.PRTitle = out.PRTitle
+	resp.Remediation.PRDescription = out.PRDescription
+	if r.cfg.Explain && out.Rationale != "" {
+		r.explanation(StepRemediation).Rationale = out.Rationale
+	}
+	return nil
+}
+
+// decodeJSONObject decodes the outermost JSON object in content, tolerating
+// code fences or prose around it.
+func decodeJSONObject(content string, v any) error {
+	start := strings.Index(content, "{")
+	end := strings.LastIndex(content, "}")
+	if start < 0 || end < start {
+		return ErrInvalidJSON
+	}
+	if err := json.Unmarshal([]byte(content[start:end+1]), v); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidJSON, err)
+	}
+	return nil
+}
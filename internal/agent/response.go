@@ -0,0 +1,179 @@
+package agent
+
+import (
+	"time"
+	"weeklysec/internal/cosign"
+	"weeklysec/internal/errcode"
+	"weeklysec/internal/hardening"
+	"weeklysec/internal/policy"
+	"weeklysec/internal/trivy"
+)
+
+// Run statuses.
+const (
+	StatusCompleted = "completed" // every step succeeded or was skipped on purpose
+	StatusPartial   = "partial"   // the scan succeeded but an LLM step or some images of an application failed
+	StatusFailed    = "failed"    // the scan itself failed
+)
+
+// Step statuses. StepRunning is only seen by Request.Progress.
+const (
+	StepRunning   = "running"
+	StepSucceeded = "succeeded"
+	StepFailed    = "failed"
+	StepSkipped   = "skipped"
+)
+
+// AgentResponse is the result of one agent run over a scan target.
+type AgentResponse struct {
+	RequestID   string       `json:"request_id,omitempty"`
+	ScanID      string       `json:"scan_id,omitempty"`
+	TargetType  string       `json:"target_type"`
+	Target      string       `json:"target"`
+	Model       string       `json:"model,omitempty"`
+	Status      string       `json:"status"`
+	Error       string       `json:"error,omitempty"`
+	ErrorCode   errcode.Code `json:"error_code,omitempty"`
+	StartedAt   time.Time    `json:"started_at"`
+	CompletedAt time.Time    `json:"completed_at"`
+
+	Analysis     *Analysis            `json:"analysis,omitempty"`
+	Prioritized  []PrioritizedFinding `json:"prioritized,omitempty"`
+	Misconfigs   []Misconfiguration   `json:"misconfigurations,omitempty"` // ranked failed configuration checks
+	Remediation  *RemediationPackage  `json:"remediation,omitempty"`
+	AcceptedRisk *AcceptedRisk        `json:"accepted_risk,omitempty"`
+	LearnedNoise *LearnedNoise        `json:"learned_noise,omitempty"`      // findings triaged as noise before
+	Overridden   []OverriddenFinding  `json:"severity_overrides,omitempty"` // findings whose severity a tenant rule changed
+	Summary      string               `json:"summary,omitempty"`
+	Ignored      int                  `json:"ignored,omitempty"`  // findings dropped by the ignore policy
+	Filtered     []FilteredFinding    `json:"filtered,omitempty"` // findings dropped by scoring hooks
+	LLMUsage     *LLMUsage            `json:"llm_usage,omitempty"`
+	PullRequest  *PullRequest         `json:"pull_request,omitempty"`
+	Signature    *cosign.Result       `json:"signature,omitempty"` // set when signature verification ran
+	Layers       *trivy.LayerStats    `json:"layers,omitempty"`    // set for images scanned with delta scanning
+	Images       []ImageResult        `json:"images,omitempty"`    // set for applications scanned image by image
+	Policy       *policy.Verdict      `json:"policy,omitempty"`    // set when policy rules are configured
+
+	// ScoringErrors lists the scoring hooks that failed to evaluate and
+	// were skipped.
+	ScoringErrors []string `json:"scoring_errors,omitempty"`
+
+	StepResults []StepResult `json:"step_results"`
+
+	// Explanations hold the rationale of each step in explain mode.
+	Explanations []Explanation `json:"explanations,omitempty"`
+
+	// Vulnerabilities holds the parsed findings so callers can persist them
+	// without re-parsing the raw report.
+	Vulnerabilities []trivy.Vulnerability `json:"-"`
+
+	// Exchanges holds the run's LLM calls, stored with the scan for
+	// feedback rather than returned.
+	Exchanges []Exchange `json:"-"`
+}
+
+// Analysis is the deterministic breakdown of a scan's findings.
+type Analysis struct {
+	TotalVulnerabilities int            `json:"total_vulnerabilities"`
+	BySeverity           map[string]int `json:"by_severity"`
+	Fixable              int            `json:"fixable"`
+	RiskScore            float64        `json:"risk_score"` // 0-100
+
+	// Misconfigurations counts the failed configuration checks of config
+	// scans, which also weigh into the risk score.
+	Misconfigurations    int            `json:"misconfigurations,omitempty"`
+	MisconfigsBySeverity map[string]int `json:"misconfigurations_by_severity,omitempty"`
+
+	// Secrets counts the leaked credentials found, which weigh in the same
+	// way.
+	Secrets int `json:"secrets,omitempty"`
+}
+
+// PrioritizedFinding is a vulnerability ranked for remediation. Priority 1 is
+// the most urgent.
+type PrioritizedFinding struct {
+	Priority         int      `json:"priority"`
+	VulnerabilityID  string   `json:"vulnerability_id"`
+	PkgName          string   `json:"pkg_name"`
+	InstalledVersion string   `json:"installed_version"`
+	FixedVersion     string   `json:"fixed_version,omitempty"`
+	Severity         string   `json:"severity"`
+	OriginalSeverity string   `json:"original_severity,omitempty"` // Trivy's severity, when overridden
+	CVSSScore        float64  `json:"cvss_score,omitempty"`
+	Title            string   `json:"title,omitempty"`
+	Reason           string   `json:"reason"`
+	Tags             []string `json:"tags,omitempty"`   // added by scoring hooks
+	Images           []string `json:"images,omitempty"` // of an application, those the finding was found in
+}
+
+// Fix is a single remediation action, usually a package upgrade that
+// resolves one or more vulnerabilities.
+type Fix struct {
+	PkgName            string      `json:"pkg_name"`
+	CurrentVersion     string      `json:"current_version"`
+	RecommendedVersion string      `json:"recommended_version"`
+	Resolves           []string    `json:"resolves"`
+	Priority           int         `json:"priority"`
+	Description        string      `json:"description"`
+	Source             *SourceLine `json:"source,omitempty"` // set when the request came with a source file
+	Images             []string    `json:"images,omitempty"` // of an application, those to rebuild with the fix
+}
+
+// RemediationPackage bundles the fixes with the text needed to ship them.
+type RemediationPackage struct {
+	Fixes       []Fix       `json:"fixes"`
+	ConfigFixes []ConfigFix `json:"config_fixes,omitempty"`
+
+	// Runbooks say how to rotate each kind of leaked credential.
+	Runbooks []RotationRunbook `json:"rotation_runbooks,omitempty"`
+
+	// Hardening holds the manifest changes of the harden step.
+	Hardening     []hardening.Recommendation `json:"hardening,omitempty"`
+	CommitMessage string                     `json:"commit_message,omitempty"`
+	PRTitle       string                     `json:"pr_title,omitempty"`
+	PRDescription string                     `json:"pr_description,omitempty"`
+}
+
+// PullRequest is a remediation pull request opened from the run's fixes.
+type PullRequest struct {
+	Repo     string    `json:"repo"`
+	Number   int       `json:"number"`
+	URL      string    `json:"url"`
+	Branch   string    `json:"branch"`
+	Base     string    `json:"base"`
+	Files    []string  `json:"files"`
+	Packages []string  `json:"packages"`        // packages bumped
+	Scans    []string  `json:"scans,omitempty"` // every scan a repository pull request combines
+	OpenedAt time.Time `json:"opened_at"`
+
+	// Rejected lists the fixes left out because the edited file would not
+	// have parsed.
+	Rejected []RejectedFix `json:"rejected_fixes,omitempty"`
+}
+
+// RejectedFix is a fix that was not applied to a file because the result
+// failed validation.
+type RejectedFix struct {
+	Path               string `json:"path"`
+	PkgName            string `json:"pkg_name"`
+	RecommendedVersion string `json:"recommended_version"`
+	Reason             string `json:"reason"`
+}
+
+// LLMUsage counts the LLM calls made during a run.
+type LLMUsage struct {
+	Calls           int               `json:"calls"`
+	EstimatedTokens int               `json:"estimated_tokens"`
+	OmittedFindings int               `json:"omitted_findings,omitempty"` // left out of prompts by max_vulnerabilities
+	Variants        map[string]string `json:"variants,omitempty"`         // experiment variant of each step, when one ran
+	Minimized       bool              `json:"minimized,omitempty"`        // prompts held only derived metadata
+}
+
+// StepResult records how one pipeline step went.
+type StepResult struct {
+	Step       string       `json:"step"`
+	Status     string       `json:"status"`
+	DurationMS int64        `json:"duration_ms"`
+	Error      string       `json:"error,omitempty"`
+	ErrorCode  errcode.Code `json:"error_code,omitempty"`
+}
@@ -0,0 +1,52 @@
+package agent
+
+import (
+	"fmt"
+	"sort"
+	"weeklysec/internal/trivy"
+)
+
+// Rollup combines the runs over the parts of one target, such as the
+// components of a repository, into a single analysis and remediation
+// package. A finding shared by several parts counts once; its most
+// urgent priority wins.
+func Rollup(target string, parts []*AgentResponse) (*Analysis, []PrioritizedFinding, *RemediationPackage) {
+	seenVuln := map[string]bool{}
+	var vulns []trivy.Vulnerability
+	byKey := map[string]int{}
+	var findings []PrioritizedFinding
+	for _, resp := range parts {
+		if resp == nil {
+			continue
+		}
+		for _, v := range resp.Vulnerabilities {
+			key := v.VulnerabilityID + "|" + v.PkgName + "|" + v.InstalledVersion
+			if !seenVuln[key] {
+				seenVuln[key] = true
+				vulns = append(vulns, v)
+			}
+		}
+		for _, f := range resp.Prioritized {
+			key := f.VulnerabilityID + "|" + f.PkgName + "|" + f.InstalledVersion
+			if i, ok := byKey[key]; ok {
+				findings[i].Priority = min(findings[i].Priority, f.Priority)
+				continue
+			}
+			byKey[key] = len(findings)
+			findings = append(findings, f)
+		}
+	}
+	sort.SliceStable(findings, func(i, j int) bool {
+		if findings[i].Priority != findings[j].Priority {
+			return findings[i].Priority < findings[j].Priority
+		}
+		return findings[i].CVSSScore > findings[j].CVSSScore
+	})
+
+	rem := &RemediationPackage{Fixes: buildFixes(findings)}
+	if len(rem.Fixes) > 0 {
+		rem.PRTitle = fmt.Sprintf("Fix vulnerable dependencies in %s", target)
+		rem.CommitMessage = rem.PRTitle
+	}
+	return analyze(vulns), findings, rem
+}
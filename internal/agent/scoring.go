@@ -0,0 +1,66 @@
+package agent
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"weeklysec/internal/scoring"
+)
+
+// FilteredFinding is a prioritized finding a scoring hook dropped.
+type FilteredFinding struct {
+	VulnerabilityID string `json:"vulnerability_id"`
+	PkgName         string `json:"pkg_name"`
+	Hook            string `json:"hook"`
+}
+
+// applyScoring runs the scoring hooks over the prioritized findings,
+// dropping, re-ranking and tagging them, and keeps the ranking sorted.
+func (r *run) applyScoring() {
+	if r.scoring == nil {
+		return
+	}
+	resp := r.resp
+	target := r.req.TargetInfo
+	target.TargetType, target.Target = r.req.TargetType, r.req.Target
+
+	kept := resp.Prioritized[:0]
+	for _, f := range resp.Prioritized {
+		out := r.scoring.Apply(target, scoring.Finding{
+			ID:               f.VulnerabilityID,
+			Package:          f.PkgName,
+			InstalledVersion: f.InstalledVersion,
+			FixedVersion:     f.FixedVersion,
+			Severity:         f.Severity,
+			CVSS:             f.CVSSScore,
+			Title:            f.Title,
+			Priority:         f.Priority,
+		})
+		for _, e := range out.Errors {
+			if !slices.Contains(resp.ScoringErrors, e) {
+				resp.ScoringErrors = append(resp.ScoringErrors, e)
+			}
+		}
+		if out.Drop {
+			resp.Filtered = append(resp.Filtered, FilteredFinding{
+				VulnerabilityID: f.VulnerabilityID,
+				PkgName:         f.PkgName,
+				Hook:            out.Applied[len(out.Applied)-1],
+			})
+			continue
+		}
+		if out.Priority != f.Priority {
+			f.Reason += fmt.Sprintf(", set to P%d by %s", out.Priority, strings.Join(out.Applied, ", "))
+			f.Priority = out.Priority
+			r.rescored[f.VulnerabilityID+"@"+f.PkgName] = out.Applied
+		}
+		f.Tags = out.Tags
+		kept = append(kept, f)
+	}
+	resp.Prioritized = kept
+
+	sort.SliceStable(resp.Prioritized, func(i, j int) bool {
+		return resp.Prioritized[i].Priority < resp.Prioritized[j].Priority
+	})
+}
@@ -0,0 +1,213 @@
+package agent
+
+import (
+	"cmp"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"weeklysec/internal/trivy"
+)
+
+// RotationRunbook is the procedure for rotating one kind of leaked
+// credential: where the target references it, how to replace it and how
+// to confirm the old one is dead.
+type RotationRunbook struct {
+	Credential string            `json:"credential"` // e.g. "AWS Access Key ID"
+	RuleID     string            `json:"rule_id"`
+	Category   string            `json:"category"`
+	Severity   string            `json:"severity"`
+	References []SecretReference `json:"references"`
+	Rotate     []string          `json:"rotate"`
+	Cleanup    []string          `json:"cleanup"`
+	Verify     []string          `json:"verify"`
+}
+
+// SecretReference is a place a leaked credential was found.
+type SecretReference struct {
+	File      string `json:"file"`
+	Line      int    `json:"line,omitempty"`
+	CreatedBy string `json:"created_by,omitempty"` // the Dockerfile instruction of the image layer that added it
+}
+
+// rotation holds the issuer-specific steps of a runbook.
+type rotation struct {
+	rotate []string
+	verify []string
+}
+
+// rotations are keyed by Trivy's secret rule category. Placeholders in
+// angle brackets are for the operator to fill in.
+var rotations = map[string]rotation{
+	"AWS": {
+		rotate: []string{
+			"aws iam list-access-keys --user-name <user>  # find the user that owns the key",
+			"aws iam create-access-key --user-name <user>",
+			"Store the new key in the secret manager and roll every consumer onto it",
+			"aws iam update-access-key --user-name <user> --access-key-id <old key id> --status Inactive",
+			"aws iam delete-access-key --user-name <user> --access-key-id <old key id>",
+		},
+		verify: []string{
+			"AWS_ACCESS_KEY_ID=<old key id> AWS_SECRET_ACCESS_KEY=<old secret> aws sts get-caller-identity  # must fail with InvalidClientTokenId",
+			"aws cloudtrail lookup-events --lookup-attributes AttributeKey=AccessKeyId,AttributeValue=<old key id>  # review what the key did while exposed",
+		},
+	},
+	"GitHub": {
+		rotate: []string{
+			"Revoke the token under Settings > Developer settings > Personal access tokens, or the app's settings for OAuth and app tokens",
+			"Create a fine-grained token limited to the repositories and permissions the consumer needs",
+			"gh secret set <NAME> --repo <owner/repo>  # for tokens used by Actions",
+		},
+		verify: []string{
+			"curl -s -o /dev/null -w '%{http_code}' -H 'Authorization: Bearer <old token>' https://api.github.com/user  # must print 401",
+			"Review the organization audit log for use of the token while it was exposed",
+		},
+	},
+	"GitLab": {
+		rotate: []string{
+			"Revoke the token under User Settings > Access Tokens, or the project's or group's access tokens",
+			"Create a replacement with the narrowest scopes and an expiry date",
+			"glab variable update <NAME> --value <new token>  # for tokens used by CI",
+		},
+		verify: []string{
+			"curl -s -o /dev/null -w '%{http_code}' --header 'PRIVATE-TOKEN: <old token>' https://gitlab.com/api/v4/user  # must print 401",
+		},
+	},
+	"Slack": {
+		rotate: []string{
+			"curl -X POST -H 'Authorization: Bearer <old token>' https://slack.com/api/auth.revoke",
+			"Reinstall the app or regenerate the webhook URL to get a new credential",
+		},
+		verify: []string{
+			"curl -s -H 'Authorization: Bearer <old token>' https://slack.com/api/auth.test  # must return invalid_auth",
+		},
+	},
+	"Stripe": {
+		rotate: []string{
+			"Roll the key under Developers > API keys in the Stripe dashboard, expiring the old one now",
+			"Prefer a restricted key with only the permissions the consumer needs",
+		},
+		verify: []string{
+			"curl -s -o /dev/null -w '%{http_code}' -u <old key>: https://api.stripe.com/v1/balance  # must print 401",
+		},
+	},
+	"Google": {
+		rotate: []string{
+			"gcloud iam service-accounts keys list --iam-account <service account>  # find the leaked key's ID",
+			"gcloud iam service-accounts keys create <new key>.json --iam-account <service account>",
+			"Store the new key in the secret manager, or move the consumer to workload identity and drop keys",
+			"gcloud iam service-accounts keys delete <old key id> --iam-account <service account>",
+		},
+		verify: []string{
+			"gcloud iam service-accounts keys list --iam-account <service account>  # the old key ID must be gone",
+			"gcloud logging read 'protoPayload.authenticationInfo.serviceAccountKeyName:<old key id>'  # review its use while exposed",
+		},
+	},
+	"AsymmetricPrivateKey": {
+		rotate: []string{
+			"ssh-keygen -t ed25519 -f <new key>  # or openssl genpkey for TLS keys",
+			"Install the new public key or certificate wherever the old one is trusted: authorized_keys, deploy keys, load balancers",
+			"Remove the old public key and revoke the old certificate with its CA",
+		},
+		verify: []string{
+			"ssh -i <old key> -o IdentitiesOnly=yes <host>  # must be refused; for TLS, check the old certificate shows as revoked",
+		},
+	},
+}
+
+// genericRotation covers credentials without issuer-specific steps.
+var genericRotation = rotation{
+	rotate: []string{
+		"Revoke the credential with its issuer",
+		"Issue a replacement with the least privilege the consumer needs and store it in the secret manager",
+		"kubectl create secret generic <name> --from-literal=<key>=<new value> --dry-run=client -o yaml | kubectl apply -f -  # for Kubernetes consumers",
+	},
+	verify: []string{
+		"Call the issuer's API with the old credential; it must be rejected",
+		"Review the issuer's access logs for use of the credential while it was exposed",
+	},
+}
+
+// buildRunbooks turns the secrets of a scan into a runbook per rule, the
+// most severe first.
+func buildRunbooks(secrets []trivy.Secret, image bool) []RotationRunbook {
+	byRule := make(map[string]*RotationRunbook)
+	var order []string
+	for _, s := range secrets {
+		rb, ok := byRule[s.RuleID]
+		if !ok {
+			rb = &RotationRunbook{
+				Credential: cmp.Or(s.Title, s.RuleID),
+				RuleID:     s.RuleID,
+				Category:   s.Category,
+				Severity:   normalizeSeverity(s.Severity),
+			}
+			byRule[s.RuleID] = rb
+			order = append(order, s.RuleID)
+		}
+		if trivy.SeverityRank(s.Severity) < trivy.SeverityRank(rb.Severity) {
+			rb.Severity = normalizeSeverity(s.Severity)
+		}
+		rb.References = append(rb.References, SecretReference{File: s.File, Line: s.StartLine, CreatedBy: s.Layer.CreatedBy})
+	}
+
+	out := make([]RotationRunbook, 0, len(order))
+	for _, id := range order {
+		rb := byRule[id]
+		steps, ok := rotations[rb.Category]
+		if !ok {
+			steps = genericRotation
+		}
+		rb.Rotate, rb.Verify = steps.rotate, steps.verify
+		rb.Cleanup = cleanupSteps(rb.References, image)
+		out = append(out, *rb)
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		return trivy.SeverityRank(out[i].Severity) < trivy.SeverityRank(out[j].Severity)
+	})
+	return out
+}
+
+// cleanupSteps removes the credential from where it was found. Rotation
+// comes first: the secret stays readable in published image layers and
+// git history until they are rewritten.
+func cleanupSteps(refs []SecretReference, image bool) []string {
+	files := make([]string, 0, len(refs))
+	for _, ref := range refs {
+		if ref.Line > 0 {
+			files = append(files, fmt.Sprintf("%s:%d", ref.File, ref.Line))
+		} else {
+			files = append(files, ref.File)
+		}
+	}
+	steps := []string{fmt.Sprintf("Remove the credential from %s and read it from the environment or a mounted secret instead", strings.Join(files, ", "))}
+	if image {
+		steps = append(steps,
+			"Rebuild the image without the secret; use a build secret (RUN --mount=type=secret) where the build needs it",
+			"Delete the affected tags from the registry, since their layers still hold the secret")
+	} else {
+		steps = append(steps, "Purge the secret from git history (git filter-repo) if it was ever committed")
+	}
+	return steps
+}
+
+// addSecrets counts secrets into a and weighs them into its risk score
+// like vulnerabilities of the same severity.
+func addSecrets(a *Analysis, secrets []trivy.Secret) {
+	a.Secrets = len(secrets)
+	score := a.RiskScore
+	for _, s := range secrets {
+		score += severityWeights[normalizeSeverity(s.Severity)]
+	}
+	a.RiskScore = min(100, math.Round(score*10)/10)
+}
+
+// minimalRunbooks strips runbooks down to the credential kind; file paths
+// stay on the host in data-minimization mode.
+func minimalRunbooks(runbooks []RotationRunbook) []RotationRunbook {
+	out := make([]RotationRunbook, len(runbooks))
+	for i, rb := range runbooks {
+		out[i] = RotationRunbook{Credential: rb.Credential, RuleID: rb.RuleID, Category: rb.Category, Severity: rb.Severity}
+	}
+	return out
+}
@@ -0,0 +1,131 @@
+package agent
+
+import (
+	"path"
+	"time"
+	"weeklysec/internal/trivy"
+)
+
+// SeverityOverride is a tenant's rule that replaces the severity Trivy
+// reports for matching findings, such as "anything in openssl is CRITICAL"
+// or "CVE-2023-1234 is LOW on internal tools". Overrides apply before
+// analysis and prioritization and are reported under
+// AgentResponse.SeverityOverrides.
+type SeverityOverride struct {
+	ID              string    `json:"id"`
+	Org             string    `json:"org"`
+	Project         string    `json:"project"`
+	VulnerabilityID string    `json:"vulnerability_id,omitempty"` // empty matches all
+	Package         string    `json:"package,omitempty"`          // exact name or glob; empty matches all
+	Target          string    `json:"target,omitempty"`           // exact target or glob; empty matches all
+	Severity        string    `json:"severity"`
+	Reason          string    `json:"reason"`
+	CreatedBy       string    `json:"created_by,omitempty"`
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+// Matches reports whether the rule covers v found in target.
+func (o SeverityOverride) Matches(target string, v trivy.Vulnerability) bool {
+	if o.VulnerabilityID != "" && o.VulnerabilityID != v.VulnerabilityID {
+		return false
+	}
+	return globMatch(o.Package, v.PkgName) && globMatch(o.Target, target)
+}
+
+// globMatch reports whether s is pattern or matches it; an empty pattern
+// matches everything.
+func globMatch(pattern, s string) bool {
+	if pattern == "" || pattern == s {
+		return true
+	}
+	ok, _ := path.Match(pattern, s)
+	return ok
+}
+
+// OverriddenFinding is a finding whose severity an override changed.
+type OverriddenFinding struct {
+	VulnerabilityID  string `json:"vulnerability_id"`
+	PkgName          string `json:"pkg_name"`
+	OriginalSeverity string `json:"original_severity"`
+	Severity         string `json:"severity"`
+	OverrideID       string `json:"override_id"`
+	Reason           string `json:"reason"`
+}
+
+// applySeverityOverrides rewrites the severity of the vulns matched by a
+// rule, the most specific first: a rule naming the vulnerability beats one
+// naming only a package or target.
+func applySeverityOverrides(target string, vulns []trivy.Vulnerability, rules []SeverityOverride) []OverriddenFinding {
+	if len(rules) == 0 {
+		return nil
+	}
+	var out []OverriddenFinding
+	for i, v := range vulns {
+		rule, ok := matchOverride(target, v, rules)
+		if !ok {
+			continue
+		}
+		original := normalizeSeverity(v.Severity)
+		if original == rule.Severity {
+			continue
+		}
+		vulns[i].Severity = rule.Severity
+		out = append(out, OverriddenFinding{
+			VulnerabilityID:  v.VulnerabilityID,
+			PkgName:          v.PkgName,
+			OriginalSeverity: original,
+			Severity:         rule.Severity,
+			OverrideID:       rule.ID,
+			Reason:           rule.Reason,
+		})
+	}
+	return out
+}
+
+func matchOverride(target string, v trivy.Vulnerability, rules []SeverityOverride) (SeverityOverride, bool) {
+	var best SeverityOverride
+	found := false
+	for _, rule := range rules {
+		if !rule.Matches(target, v) {
+			continue
+		}
+		if !found || specificity(rule) > specificity(best) {
+			best, found = rule, true
+		}
+	}
+	return best, found
+}
+
+func specificity(o SeverityOverride) int {
+	n := 0
+	if o.VulnerabilityID != "" {
+		n += 4
+	}
+	if o.Package != "" {
+		n += 2
+	}
+	if o.Target != "" {
+		n++
+	}
+	return n
+}
+
+// markOverridden notes on each prioritized finding the severity it had
+// before an override.
+func markOverridden(findings []PrioritizedFinding, overridden []OverriddenFinding) {
+	if len(overridden) == 0 {
+		return
+	}
+	byKey := make(map[string]OverriddenFinding, len(overridden))
+	for _, o := range overridden {
+		byKey[o.VulnerabilityID+"|"+o.PkgName] = o
+	}
+	for i := range findings {
+		f := &findings[i]
+		if o, ok := byKey[f.VulnerabilityID+"|"+f.PkgName]; ok {
+			f.OriginalSeverity = o.OriginalSeverity
+			f.Reason += ", severity overridden from " + o.OriginalSeverity
+		}
+	}
+}
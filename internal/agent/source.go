@@ -0,0 +1,190 @@
+package agent
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// MaxSource bounds the size of a source file, which is sent whole with the
+// remediation prompt.
+const MaxSource = 64 << 10
+
+// Source is the Dockerfile or Kubernetes manifest an image target is built
+// or deployed from. Fixes are anchored to its lines so the remediation
+// step can point at the real FROM line or install command.
+type Source struct {
+	Path    string
+	Content string
+}
+
+// ReadSource reads the source file at path.
+func ReadSource(path string) (*Source, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read source: %w", err)
+	}
+	defer f.Close()
+	data, err := io.ReadAll(io.LimitReader(f, MaxSource+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read source: %w", err)
+	}
+	if len(data) > MaxSource {
+		return nil, fmt.Errorf("source %s exceeds %d bytes", path, MaxSource)
+	}
+	return &Source{Path: path, Content: string(data)}, nil
+}
+
+// What a source line does for a fix.
+const (
+	SourceInstall   = "install"    // installs the package
+	SourceBaseImage = "base_image" // FROM of the final stage, which brought the package in
+	SourceImageRef  = "image_ref"  // references the image in a manifest
+)
+
+// SourceLine is the line of the source file a fix applies to.
+type SourceLine struct {
+	File string `json:"file"`
+	Line int    `json:"line"`
+	Text string `json:"text"`
+	Kind string `json:"kind"`
+}
+
+// installCommand matches the package manager commands of a RUN line.
+var installCommand = regexp.MustCompile(`\b(apk add|apt-get install|apt install|yum install|dnf install|microdnf install|zypper install|pip3? install|npm install|npm i|yarn add|gem install|go install|cargo install)\b`)
+
+// instruction is one logical line of a source file, continuations joined,
+// with the number of its first physical line.
+type instruction struct {
+	line int
+	text string
+}
+
+func (s *Source) instructions() []instruction {
+	var out []instruction
+	var cur *instruction
+	for i, l := range strings.Split(s.Content, "\n") {
+		l = strings.TrimSpace(l)
+		if cur == nil {
+			if l == "" || strings.HasPrefix(l, "#") {
+				continue
+			}
+			cur = &instruction{line: i + 1}
+		}
+		text, more := strings.CutSuffix(l, "\\")
+		cur.text = strings.TrimSpace(cur.text + " " + text)
+		if !more {
+			out = append(out, *cur)
+			cur = nil
+		}
+	}
+	if cur != nil {
+		out = append(out, *cur)
+	}
+	return out
+}
+
+// isDockerfile tells a Dockerfile from a manifest by its name.
+func (s *Source) isDockerfile() bool {
+	base := strings.ToLower(filepath.Base(s.Path))
+	return strings.Contains(base, "dockerfile") || strings.Contains(base, "containerfile")
+}
+
+// anchor finds the line fix applies to. In a Dockerfile that is the install
+// command of the package in the final stage or, failing that, the stage's
+// FROM line; in a manifest, the line referencing image. Nil when nothing
+// matches.
+func (s *Source) anchor(fix Fix, image string) *SourceLine {
+	var match *instruction
+	var kind string
+	if s.isDockerfile() {
+		for _, in := range s.instructions() {
+			keyword, _, _ := strings.Cut(in.text, " ")
+			switch strings.ToUpper(keyword) {
+			case "FROM":
+				match, kind = &in, SourceBaseImage
+			case "RUN":
+				if installCommand.MatchString(in.text) && installs(in.text, fix.PkgName) {
+					match, kind = &in, SourceInstall
+				}
+			}
+		}
+	} else {
+		repo := repository(image)
+		for _, in := range s.instructions() {
+			if strings.Contains(in.text, "image:") && strings.Contains(in.text, repo) {
+				match, kind = &in, SourceImageRef
+				break
+			}
+		}
+	}
+	if match == nil {
+		return nil
+	}
+	text := match.text
+	if len(text) > 200 {
+		text = text[:200] + "..."
+	}
+	return &SourceLine{File: s.Path, Line: match.line, Text: text, Kind: kind}
+}
+
+// installs reports whether the install command cmd names pkg, with or
+// without a version pin.
+func installs(cmd, pkg string) bool {
+	for _, word := range strings.FieldsFunc(cmd, func(r rune) bool { return strings.ContainsRune(" \t;&|", r) }) {
+		word = strings.Trim(word, `"'`)
+		if i := strings.IndexAny(word, "=<>~!["); i > 0 {
+			word = word[:i]
+		}
+		if i := strings.LastIndex(word, "@"); i > 0 {
+			word = word[:i]
+		}
+		if strings.EqualFold(word, pkg) {
+			return true
+		}
+	}
+	return false
+}
+
+// repository strips the tag and digest from an image reference.
+func repository(ref string) string {
+	ref, _, _ = strings.Cut(ref, "@")
+	if i := strings.LastIndex(ref, ":"); i > strings.LastIndex(ref, "/") {
+		return ref[:i]
+	}
+	return ref
+}
+
+// numbered renders the source with line numbers for the remediation prompt.
+func (s *Source) numbered() string {
+	var b strings.Builder
+	for i, l := range strings.Split(strings.TrimRight(s.Content, "\n"), "\n") {
+		fmt.Fprintf(&b, "%4d  %s\n", i+1, l)
+	}
+	return b.String()
+}
+
+// anchorFixes points each of fixes at its line of the run's source, if it
+// has one.
+func (r *run) anchorFixes(fixes []Fix) {
+	if r.req.Source == nil {
+		return
+	}
+	for i := range fixes {
+		fixes[i].Source = r.req.Source.anchor(fixes[i], r.req.Target)
+	}
+}
+
+// withoutSources copies fixes without their source lines, which stay on
+// the host in data-minimization mode.
+func withoutSources(fixes []Fix) []Fix {
+	out := make([]Fix, len(fixes))
+	for i, f := range fixes {
+		f.Source = nil
+		out[i] = f
+	}
+	return out
+}
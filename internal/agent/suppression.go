@@ -0,0 +1,124 @@
+package agent
+
+import (
+	"path"
+	"time"
+	"weeklysec/internal/trivy"
+)
+
+// ExpiryWarning is how far ahead accepted risks are flagged as expiring.
+const ExpiryWarning = 14 * 24 * time.Hour
+
+// Suppression is a risk-acceptance rule. Matching findings are left out of
+// prioritization and fixes and reported under AgentResponse.AcceptedRisk.
+type Suppression struct {
+	ID              string     `json:"id"`
+	Org             string     `json:"org"`
+	Project         string     `json:"project"`
+	VulnerabilityID string     `json:"vulnerability_id"`
+	Target          string     `json:"target,omitempty"`  // exact target or glob; empty matches all
+	Package         string     `json:"package,omitempty"` // empty matches all
+	Justification   string     `json:"justification"`
+	Approver        string     `json:"approver"`
+	ExpiresAt       *time.Time `json:"expires_at,omitempty"`
+	CreatedBy       string     `json:"created_by,omitempty"`
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+
+	// VEXJustification, one of the VEX not_affected justifications, marks
+	// matching findings as not applicable rather than an accepted risk.
+	VEXJustification string `json:"vex_justification,omitempty"`
+}
+
+// Active reports whether the rule applies at now.
+func (s Suppression) Active(now time.Time) bool {
+	return s.ExpiresAt == nil || now.Before(*s.ExpiresAt)
+}
+
+// Matches reports whether the rule covers v found in target.
+func (s Suppression) Matches(target string, v trivy.Vulnerability) bool {
+	if s.VulnerabilityID != v.VulnerabilityID {
+		return false
+	}
+	if s.Package != "" && s.Package != v.PkgName {
+		return false
+	}
+	if s.Target != "" && s.Target != target {
+		if ok, _ := path.Match(s.Target, target); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// AcceptedRisk summarizes findings covered by suppressions.
+type AcceptedRisk struct {
+	Count    int               `json:"count"`
+	Expiring int               `json:"expiring"` // rules expiring within ExpiryWarning
+	Findings []AcceptedFinding `json:"findings"`
+}
+
+type AcceptedFinding struct {
+	VulnerabilityID string     `json:"vulnerability_id"`
+	PkgName         string     `json:"pkg_name"`
+	Severity        string     `json:"severity"`
+	SuppressionID   string     `json:"suppression_id"`
+	Justification   string     `json:"justification"`
+	Approver        string     `json:"approver"`
+	ExpiresAt       *time.Time `json:"expires_at,omitempty"`
+	ExpiringSoon    bool       `json:"expiring_soon,omitempty"`
+
+	VEXJustification string `json:"vex_justification,omitempty"`
+}
+
+// applySuppressions splits vulns into those still needing action and the
+// accepted ones.
+func applySuppressions(target string, vulns []trivy.Vulnerability, rules []Suppression, now time.Time) ([]trivy.Vulnerability, *AcceptedRisk) {
+	if len(rules) == 0 {
+		return vulns, nil
+	}
+
+	accepted := &AcceptedRisk{Findings: []AcceptedFinding{}}
+	expiring := make(map[string]bool)
+	var open []trivy.Vulnerability
+
+	for _, v := range vulns {
+		rule, ok := matchRule(target, v, rules, now)
+		if !ok {
+			open = append(open, v)
+			continue
+		}
+		soon := rule.ExpiresAt != nil && rule.ExpiresAt.Sub(now) < ExpiryWarning
+		if soon {
+			expiring[rule.ID] = true
+		}
+		accepted.Findings = append(accepted.Findings, AcceptedFinding{
+			VulnerabilityID: v.VulnerabilityID,
+			PkgName:         v.PkgName,
+			Severity:        normalizeSeverity(v.Severity),
+			SuppressionID:   rule.ID,
+			Justification:   rule.Justification,
+			Approver:        rule.Approver,
+			ExpiresAt:       rule.ExpiresAt,
+			ExpiringSoon:    soon,
+
+			VEXJustification: rule.VEXJustification,
+		})
+	}
+
+	if len(accepted.Findings) == 0 {
+		return open, nil
+	}
+	accepted.Count = len(accepted.Findings)
+	accepted.Expiring = len(expiring)
+	return open, accepted
+}
+
+func matchRule(target string, v trivy.Vulnerability, rules []Suppression, now time.Time) (Suppression, bool) {
+	for _, rule := range rules {
+		if rule.Active(now) && rule.Matches(target, v) {
+			return rule, true
+		}
+	}
+	return Suppression{}, false
+}
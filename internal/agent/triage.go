@@ -0,0 +1,105 @@
+package agent
+
+import (
+	"path"
+	"sort"
+	"time"
+	"weeklysec/internal/trivy"
+)
+
+// Where a triage decision was learned from.
+const (
+	TriageSuppression = "suppression" // a lapsed not-affected suppression
+	TriageFeedback    = "feedback"    // a finding rated through the feedback API
+)
+
+// TriageDecision is an earlier call the team made on a finding: noise, or
+// confirmed as a real issue.
+type TriageDecision struct {
+	VulnerabilityID string
+	PkgName         string // empty matches every package
+	Target          string // exact target or glob; empty matches all
+	Noise           bool
+	Source          string
+	Reason          string
+	At              time.Time
+}
+
+// Matches reports whether the decision was about v found in target.
+func (d TriageDecision) Matches(target string, v trivy.Vulnerability) bool {
+	if d.VulnerabilityID != v.VulnerabilityID || d.PkgName != "" && d.PkgName != v.PkgName {
+		return false
+	}
+	if d.Target != "" && d.Target != target {
+		if ok, _ := path.Match(d.Target, target); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// LearnedNoise lists the findings left out of prioritization because the
+// team triaged them as noise in earlier scans.
+type LearnedNoise struct {
+	Count    int            `json:"count"`
+	Findings []NoiseFinding `json:"findings"`
+}
+
+// NoiseFinding is a finding left out as learned noise.
+type NoiseFinding struct {
+	VulnerabilityID string    `json:"vulnerability_id"`
+	PkgName         string    `json:"pkg_name"`
+	Severity        string    `json:"severity"`
+	Votes           int       `json:"votes"`  // noise decisions less confirmations
+	Source          string    `json:"source"` // of the latest noise decision
+	Reason          string    `json:"reason,omitempty"`
+	TriagedAt       time.Time `json:"triaged_at"`
+}
+
+// applyTriage splits vulns into those still needing action and those the
+// team called noise more often than real. A tie keeps the finding.
+func applyTriage(target string, vulns []trivy.Vulnerability, decisions []TriageDecision) ([]trivy.Vulnerability, *LearnedNoise) {
+	if len(decisions) == 0 {
+		return vulns, nil
+	}
+	noise := &LearnedNoise{Findings: []NoiseFinding{}}
+	var open []trivy.Vulnerability
+	for _, v := range vulns {
+		votes := 0
+		var latest *TriageDecision
+		for i, d := range decisions {
+			if !d.Matches(target, v) {
+				continue
+			}
+			if !d.Noise {
+				votes--
+				continue
+			}
+			votes++
+			if latest == nil || d.At.After(latest.At) {
+				latest = &decisions[i]
+			}
+		}
+		if votes <= 0 {
+			open = append(open, v)
+			continue
+		}
+		noise.Findings = append(noise.Findings, NoiseFinding{
+			VulnerabilityID: v.VulnerabilityID,
+			PkgName:         v.PkgName,
+			Severity:        normalizeSeverity(v.Severity),
+			Votes:           votes,
+			Source:          latest.Source,
+			Reason:          latest.Reason,
+			TriagedAt:       latest.At,
+		})
+	}
+	if len(noise.Findings) == 0 {
+		return open, nil
+	}
+	sort.SliceStable(noise.Findings, func(i, j int) bool {
+		return trivy.SeverityRank(noise.Findings[i].Severity) < trivy.SeverityRank(noise.Findings[j].Severity)
+	})
+	noise.Count = len(noise.Findings)
+	return open, noise
+}
@@ -0,0 +1,307 @@
+// Package alert pages on-call for findings that cannot wait for the next
+// digest: vulnerabilities in CISA's KEV catalog and those above a CVSS
+// threshold, and violations of policy rules that ask to alert. Each target
+// and CVE or rule pages once; the alert is resolved when a later scan of
+// the target no longer has the finding or violation.
+package alert
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+	"weeklysec/internal/agent"
+	"weeklysec/internal/digest"
+	"weeklysec/internal/kev"
+	"weeklysec/internal/policy"
+	"weeklysec/internal/store"
+	"weeklysec/internal/trivy"
+
+	"github.com/rs/zerolog"
+)
+
+var httpClient = &http.Client{Timeout: 15 * time.Second}
+
+// Alert is one page.
+type Alert struct {
+	DedupKey         string
+	Summary          string
+	Org              string
+	Project          string
+	TargetType       string
+	Target           string
+	VulnerabilityID  string
+	PkgName          string
+	InstalledVersion string
+	FixedVersion     string
+	Severity         string
+	CVSSScore        float64
+	KEV              *kev.Entry // set when the CVE is known to be exploited
+	Rule             string     // the violated policy rule, for policy alerts
+	ScanID           string
+	URL              string // link to the scan, if PublicURL is set
+}
+
+// Details returns the alert's fields as flat key/value pairs for the
+// pager's custom details.
+func (a Alert) Details() map[string]string {
+	d := map[string]string{
+		"org":               a.Org,
+		"project":           a.Project,
+		"target":            a.Target,
+		"target_type":       a.TargetType,
+		"vulnerability_id":  a.VulnerabilityID,
+		"package":           a.PkgName,
+		"installed_version": a.InstalledVersion,
+		"severity":          a.Severity,
+		"scan_id":           a.ScanID,
+	}
+	if a.Rule != "" {
+		d["policy_rule"] = a.Rule
+	}
+	if a.FixedVersion != "" {
+		d["fixed_version"] = a.FixedVersion
+	}
+	if a.CVSSScore > 0 {
+		d["cvss_score"] = fmt.Sprintf("%.1f", a.CVSSScore)
+	}
+	if a.KEV != nil {
+		d["kev_date_added"] = a.KEV.DateAdded
+		d["kev_due_date"] = a.KEV.DueDate
+		d["kev_required_action"] = a.KEV.RequiredAction
+		d["kev_ransomware"] = a.KEV.KnownRansomwareCampaignUse
+	}
+	if a.URL != "" {
+		d["scan_url"] = a.URL
+	}
+	return d
+}
+
+// Pager raises and resolves incidents in an on-call system.
+type Pager interface {
+	// Name is the store.Ticket tracker name.
+	Name() string
+	Trigger(ctx context.Context, a Alert) error
+	Resolve(ctx context.Context, dedupKey string) error
+}
+
+// Options decide which findings page.
+type Options struct {
+	MinSeverity   string  // lowest severity paged for KEV findings; CRITICAL when empty
+	CVSSThreshold float64 // findings scoring at least this page too; 0 disables
+	PublicURL     string  // base URL for scan links
+}
+
+// Alerter pages for scans.
+type Alerter struct {
+	store   *store.Store
+	catalog *kev.Catalog
+	pagers  []Pager
+	opts    Options
+
+	mu sync.Mutex // serializes Check so concurrent scans do not page twice
+}
+
+// New returns an Alerter sending to pagers.
+func New(st *store.Store, catalog *kev.Catalog, opts Options, pagers ...Pager) *Alerter {
+	if opts.MinSeverity == "" {
+		opts.MinSeverity = "CRITICAL"
+	}
+	opts.MinSeverity = strings.ToUpper(opts.MinSeverity)
+	opts.PublicURL = strings.TrimRight(opts.PublicURL, "/")
+	return &Alerter{store: st, catalog: catalog, pagers: pagers, opts: opts}
+}
+
+// Check pages for every alerting finding of scan not already paged for its
+// target, and resolves the target's alerts whose finding is gone. It returns
+// how many alerts were triggered. A failing pager does not stop the others.
+func (a *Alerter) Check(ctx context.Context, scan *store.Scan) (int, error) {
+	if a == nil || len(a.pagers) == 0 {
+		return 0, nil
+	}
+	if scan.Response != nil && scan.Response.Status == agent.StatusFailed {
+		return 0, nil
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	targetKey := scan.TargetKey()
+	present := map[string]bool{}
+	alerts := map[string]Alert{}
+	for _, v := range digest.Open(scan) {
+		present[v.VulnerabilityID] = true
+		if al, ok := a.alertFor(scan, v); ok {
+			// Keep the worst package per CVE
+			if prev, seen := alerts[v.VulnerabilityID]; !seen || al.CVSSScore > prev.CVSSScore {
+				alerts[v.VulnerabilityID] = al
+			}
+		}
+	}
+	if scan.Response != nil && scan.Response.Policy != nil {
+		for _, x := range scan.Response.Policy.Violations {
+			if x.Alert {
+				key := policyKey(x.Rule)
+				present[key] = true
+				alerts[key] = a.policyAlert(scan, x)
+			}
+		}
+	}
+
+	triggered := 0
+	var errs []error
+	for _, p := range a.pagers {
+		n, err := a.sync(ctx, p, scan, targetKey, present, alerts)
+		triggered += n
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", p.Name(), err))
+		}
+	}
+	return triggered, errors.Join(errs...)
+}
+
+func (a *Alerter) sync(ctx context.Context, p Pager, scan *store.Scan, targetKey string, present map[string]bool, alerts map[string]Alert) (int, error) {
+	logger := zerolog.Ctx(ctx)
+	triggered := 0
+	for cve, al := range alerts {
+		id := store.TicketID(p.Name(), targetKey, cve)
+		if _, err := a.store.GetTicket(id); err == nil {
+			continue
+		}
+		if err := p.Trigger(ctx, al); err != nil {
+			return triggered, err
+		}
+		triggered++
+		logger.Info().Str("pager", p.Name()).Str("vulnerability_id", cve).Str("target", scan.Target).Msg("Paged on-call")
+
+		now := time.Now().UTC()
+		if err := a.store.SaveTicket(store.Ticket{
+			ID:              id,
+			Tracker:         p.Name(),
+			Org:             scan.Org,
+			Project:         scan.Project,
+			TargetKey:       targetKey,
+			Target:          scan.Target,
+			VulnerabilityID: cve,
+			Key:             al.DedupKey,
+			URL:             al.URL,
+			ScanID:          scan.ID,
+			CreatedAt:       now,
+			UpdatedAt:       now,
+		}); err != nil {
+			return triggered, err
+		}
+	}
+
+	tickets, err := a.store.ListTickets(scan.Org, scan.Project, p.Name())
+	if err != nil {
+		return triggered, err
+	}
+	for _, t := range tickets {
+		if t.TargetKey != targetKey || present[t.VulnerabilityID] {
+			continue
+		}
+		if err := p.Resolve(ctx, t.Key); err != nil {
+			return triggered, err
+		}
+		logger.Info().Str("pager", p.Name()).Str("vulnerability_id", t.VulnerabilityID).Str("target", scan.Target).Msg("Resolved alert")
+		if err := a.store.DeleteTicket(t.ID); err != nil {
+			return triggered, err
+		}
+	}
+	return triggered, nil
+}
+
+// alertFor returns the alert for v if it should page.
+func (a *Alerter) alertFor(scan *store.Scan, v trivy.Vulnerability) (Alert, bool) {
+	score := v.Score()
+	entry, inKEV := a.catalog.Lookup(v.VulnerabilityID)
+	kevHit := inKEV && trivy.SeverityRank(v.Severity) <= trivy.SeverityRank(a.opts.MinSeverity)
+	cvssHit := a.opts.CVSSThreshold > 0 && score >= a.opts.CVSSThreshold
+	if !kevHit && !cvssHit {
+		return Alert{}, false
+	}
+
+	al := Alert{
+		DedupKey:         "weeklysec-" + store.TicketID("alert", scan.TargetKey(), v.VulnerabilityID),
+		Org:              scan.Org,
+		Project:          scan.Project,
+		TargetType:       scan.TargetType,
+		Target:           scan.Target,
+		VulnerabilityID:  v.VulnerabilityID,
+		PkgName:          v.PkgName,
+		InstalledVersion: v.InstalledVersion,
+		FixedVersion:     v.FixedVersion,
+		Severity:         v.Severity,
+		CVSSScore:        score,
+		ScanID:           scan.ID,
+	}
+	why := fmt.Sprintf("CVSS %.1f", score)
+	if inKEV {
+		al.KEV = &entry
+		why = "known exploited"
+	}
+	al.Summary = fmt.Sprintf("%s (%s, %s) in %s %s on %s", v.VulnerabilityID, v.Severity, why, v.PkgName, v.InstalledVersion, scan.Target)
+	if a.opts.PublicURL != "" {
+		al.URL = a.opts.PublicURL + "/api/v1/scans/" + url.PathEscape(scan.ID) + "?format=markdown"
+	}
+	return al, true
+}
+
+// policyKey identifies a rule among the CVEs a target's alerts are kept by.
+func policyKey(rule string) string {
+	return "policy:" + rule
+}
+
+// policyAlert returns the alert for a violated rule.
+func (a *Alerter) policyAlert(scan *store.Scan, x policy.Violation) Alert {
+	al := Alert{
+		DedupKey:   "weeklysec-" + store.TicketID("alert", scan.TargetKey(), policyKey(x.Rule)),
+		Org:        scan.Org,
+		Project:    scan.Project,
+		TargetType: scan.TargetType,
+		Target:     scan.Target,
+		Severity:   "HIGH",
+		Rule:       x.Rule,
+		ScanID:     scan.ID,
+	}
+	al.Summary = fmt.Sprintf("Policy %s violated on %s", x.Rule, scan.Target)
+	if x.Description != "" {
+		al.Summary += ": " + x.Description
+	}
+	if a.opts.PublicURL != "" {
+		al.URL = a.opts.PublicURL + "/api/v1/scans/" + url.PathEscape(scan.ID) + "?format=markdown"
+	}
+	return al
+}
+
+// post sends body as JSON and fails on any non-2xx answer.
+func post(ctx context.Context, service, endpoint string, header http.Header, body any) error {
+	b, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s: %w", service, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("%s: unexpected status %s", service, resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package alert
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+	"weeklysec/internal/store"
+)
+
+// Opsgenie raises alerts through the Alert API.
+type Opsgenie struct {
+	APIKey string
+	URL    string // API base URL; https://api.opsgenie.com when empty (use api.eu.opsgenie.com for EU accounts)
+	Tags   []string
+}
+
+// Name implements Pager.
+func (o *Opsgenie) Name() string { return store.TrackerOpsgenie }
+
+// Trigger implements Pager.
+func (o *Opsgenie) Trigger(ctx context.Context, a Alert) error {
+	body := map[string]any{
+		"message":     truncate(a.Summary, 130),
+		"alias":       a.DedupKey,
+		"description": truncate(a.Summary, 15000),
+		"priority":    opsgeniePriority(a.Severity),
+		"source":      "weeklysec",
+		"entity":      a.Target,
+		"details":     a.Details(),
+	}
+	if len(o.Tags) > 0 {
+		body["tags"] = o.Tags
+	}
+	return post(ctx, "opsgenie", o.base()+"/v2/alerts", o.header(), body)
+}
+
+// Resolve implements Pager.
+func (o *Opsgenie) Resolve(ctx context.Context, dedupKey string) error {
+	endpoint := o.base() + "/v2/alerts/" + url.PathEscape(dedupKey) + "/close?identifierType=alias"
+	return post(ctx, "opsgenie", endpoint, o.header(), map[string]string{
+		"source": "weeklysec",
+		"note":   "Finding no longer present in the latest scan",
+	})
+}
+
+func (o *Opsgenie) base() string {
+	if o.URL == "" {
+		return "https://api.opsgenie.com"
+	}
+	return strings.TrimRight(o.URL, "/")
+}
+
+func (o *Opsgenie) header() http.Header {
+	return http.Header{"Authorization": {"GenieKey " + o.APIKey}}
+}
+
+func opsgeniePriority(sev string) string {
+	switch strings.ToUpper(sev) {
+	case "CRITICAL":
+		return "P1"
+	case "HIGH":
+		return "P2"
+	case "MEDIUM":
+		return "P3"
+	default:
+		return "P4"
+	}
+}
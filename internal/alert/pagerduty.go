@@ -0,0 +1,76 @@
+package alert
+
+import (
+	"context"
+	"strings"
+	"weeklysec/internal/store"
+)
+
+// PagerDuty raises incidents through the Events API v2.
+type PagerDuty struct {
+	RoutingKey string // integration key of the service
+	URL        string // events endpoint; the public one when empty
+}
+
+const pagerDutyURL = "https://events.pagerduty.com/v2/enqueue"
+
+// Name implements Pager.
+func (p *PagerDuty) Name() string { return store.TrackerPagerDuty }
+
+// Trigger implements Pager.
+func (p *PagerDuty) Trigger(ctx context.Context, a Alert) error {
+	event := map[string]any{
+		"routing_key":  p.RoutingKey,
+		"event_action": "trigger",
+		"dedup_key":    a.DedupKey,
+		"payload": map[string]any{
+			"summary":        truncate(a.Summary, 1024),
+			"source":         a.Target,
+			"severity":       pagerDutySeverity(a.Severity),
+			"component":      a.PkgName,
+			"group":          a.Org + "/" + a.Project,
+			"class":          "vulnerability",
+			"custom_details": a.Details(),
+		},
+	}
+	if a.URL != "" {
+		event["links"] = []map[string]string{{"href": a.URL, "text": "Scan report"}}
+	}
+	return post(ctx, "pagerduty", p.url(), nil, event)
+}
+
+// Resolve implements Pager.
+func (p *PagerDuty) Resolve(ctx context.Context, dedupKey string) error {
+	return post(ctx, "pagerduty", p.url(), nil, map[string]any{
+		"routing_key":  p.RoutingKey,
+		"event_action": "resolve",
+		"dedup_key":    dedupKey,
+	})
+}
+
+func (p *PagerDuty) url() string {
+	if p.URL == "" {
+		return pagerDutyURL
+	}
+	return p.URL
+}
+
+func pagerDutySeverity(sev string) string {
+	switch strings.ToUpper(sev) {
+	case "CRITICAL":
+		return "critical"
+	case "HIGH":
+		return "error"
+	case "MEDIUM":
+		return "warning"
+	default:
+		return "info"
+	}
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n]
+}
@@ -0,0 +1,131 @@
+// Package allowlist restricts what the server scans: file targets to paths
+// under configured root directories, and image targets to configured
+// registries.
+package allowlist
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"weeklysec/internal/errcode"
+	"weeklysec/internal/registry"
+)
+
+// ErrNotAllowed is returned for targets outside the allowlist.
+var ErrNotAllowed = errcode.New(errcode.TargetNotAllowed, "target is not allowed")
+
+// Allowlist checks scan targets. The zero value, and a nil one, allow
+// every path and image but still reject path traversal.
+type Allowlist struct {
+	roots      []string // canonical directories
+	registries []string // "host/" or "host/path/" prefixes of repositories
+}
+
+// New returns an allowlist of files under roots and images from registries.
+// A registry entry is a host such as "ghcr.io", optionally followed by a
+// path such as "ghcr.io/acme" to allow only repositories below it. Empty
+// lists leave that target type unrestricted.
+func New(roots, registries []string) (*Allowlist, error) {
+	a := &Allowlist{}
+	for _, root := range roots {
+		dir, err := filepath.Abs(root)
+		if err != nil {
+			return nil, err
+		}
+		// Resolve the root itself so canonical targets compare against it.
+		if dir, err = filepath.EvalSymlinks(dir); err != nil {
+			return nil, fmt.Errorf("scan root %s: %w", root, err)
+		}
+		a.roots = append(a.roots, dir)
+	}
+	for _, r := range registries {
+		r = strings.Trim(strings.ToLower(strings.TrimSpace(r)), "/")
+		if r == "" {
+			continue
+		}
+		if r == "index.docker.io" || r == "registry-1.docker.io" {
+			r = "docker.io"
+		}
+		a.registries = append(a.registries, r+"/")
+	}
+	return a, nil
+}
+
+// Roots returns the canonical root directories.
+func (a *Allowlist) Roots() []string {
+	if a == nil {
+		return nil
+	}
+	return slices.Clone(a.roots)
+}
+
+// Check validates a target of targetType ("file" or "image") and returns
+// it canonicalized: files as a clean absolute path, with symlinks
+// resolved under roots.
+func (a *Allowlist) Check(targetType, target string) (string, error) {
+	switch targetType {
+	case "file":
+		return a.File(target)
+	case "image":
+		return target, a.Image(target)
+	}
+	return target, nil
+}
+
+// File returns path as a clean absolute path, rejecting ".." elements and,
+// with roots, anything that is not under one of them once symlinks are
+// resolved. With roots the resolved path is returned, so a link swapped
+// after the check cannot redirect the scan. Paths outside the roots are
+// rejected before the filesystem is touched, so they cannot be probed.
+func (a *Allowlist) File(path string) (string, error) {
+	if slices.Contains(strings.Split(filepath.ToSlash(path), "/"), "..") {
+		return "", errcode.Wrap(errcode.InvalidRequest, errors.New("'target' must not contain '..' path elements"))
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", errcode.Wrap(errcode.InvalidRequest, fmt.Errorf("'target' is not a valid path: %w", err))
+	}
+	if a == nil || len(a.roots) == 0 {
+		return abs, nil
+	}
+	if !a.underRoot(abs) {
+		return "", fmt.Errorf("%w: %s is outside the allowed scan roots", ErrNotAllowed, abs)
+	}
+	resolved, err := filepath.EvalSymlinks(abs)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", errcode.Wrap(errcode.InvalidRequest, fmt.Errorf("'target' %s does not exist", abs))
+	}
+	if err != nil {
+		return "", errcode.Wrap(errcode.InvalidRequest, fmt.Errorf("'target' %s cannot be resolved: %w", abs, err))
+	}
+	if !a.underRoot(resolved) {
+		return "", fmt.Errorf("%w: %s links outside the allowed scan roots", ErrNotAllowed, abs)
+	}
+	return resolved, nil
+}
+
+func (a *Allowlist) underRoot(path string) bool {
+	for _, root := range a.roots {
+		if rel, err := filepath.Rel(root, path); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Image rejects images outside the allowed registries, when there are any.
+func (a *Allowlist) Image(ref string) error {
+	if a == nil || len(a.registries) == 0 {
+		return nil
+	}
+	repo := registry.Parse(ref).Repository + "/"
+	for _, r := range a.registries {
+		if strings.HasPrefix(repo, r) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s is not from an allowed registry", ErrNotAllowed, ref)
+}
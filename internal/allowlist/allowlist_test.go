@@ -0,0 +1,111 @@
+package allowlist
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"weeklysec/internal/errcode"
+)
+
+// tree makes a root with a file, a link to it, a link out of the root and
+// a file outside it, and returns the root and the outside directory.
+func tree(t *testing.T) (root, outside string) {
+	t.Helper()
+	base, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	root = filepath.Join(base, "root")
+	outside = filepath.Join(base, "outside")
+	for _, dir := range []string{filepath.Join(root, "app"), outside} {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, f := range []string{filepath.Join(root, "app", "go.mod"), filepath.Join(outside, "secret")} {
+		if err := os.WriteFile(f, nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink(filepath.Join(root, "app"), filepath.Join(root, "current")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(outside, filepath.Join(root, "escape")); err != nil {
+		t.Fatal(err)
+	}
+	return root, outside
+}
+
+func TestFile(t *testing.T) {
+	root, outside := tree(t)
+	a, err := New([]string{root}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		allow    *Allowlist
+		path     string
+		want     string
+		wantCode errcode.Code
+	}{
+		{"under the root", a, filepath.Join(root, "app"), filepath.Join(root, "app"), ""},
+		{"unclean path under the root", a, root + "/./app/", filepath.Join(root, "app"), ""},
+		{"link within the root", a, filepath.Join(root, "current"), filepath.Join(root, "app"), ""},
+		{"file behind a link", a, filepath.Join(root, "current", "go.mod"), filepath.Join(root, "app", "go.mod"), ""},
+		{"outside the root", a, outside, "", errcode.TargetNotAllowed},
+		{"link out of the root", a, filepath.Join(root, "escape", "secret"), "", errcode.TargetNotAllowed},
+		{"dot-dot element", a, filepath.Join(root, "app") + "/../../outside", "", errcode.InvalidRequest},
+		{"missing under the root", a, filepath.Join(root, "missing"), "", errcode.InvalidRequest},
+		{"no roots", &Allowlist{}, outside, outside, ""},
+		{"nil allowlist", nil, outside + "/", outside, ""},
+		{"nil allowlist, dot-dot element", nil, "../etc", "", errcode.InvalidRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.allow.File(tt.path)
+			if tt.wantCode != "" {
+				if code := errcode.Of(err); code != tt.wantCode {
+					t.Fatalf("File(%q) error = %v (%s), want %s", tt.path, err, code, tt.wantCode)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Fatalf("File(%q) = %q, %v, want %q", tt.path, got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestImage(t *testing.T) {
+	a, err := New(nil, []string{"ghcr.io/acme", " Index.Docker.io/ "})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		ref  string
+		want bool
+	}{
+		{"ghcr.io/acme/web:1.0", true},
+		{"ghcr.io/acme/team/api@sha256:abc", true},
+		{"ghcr.io/acmecorp/web", false},
+		{"ghcr.io/other/web", false},
+		{"nginx", true},
+		{"library/nginx:1.25", true},
+		{"quay.io/acme/web", false},
+	}
+	for _, tt := range tests {
+		err := a.Image(tt.ref)
+		if got := err == nil; got != tt.want {
+			t.Errorf("Image(%q) = %v, want allowed %v", tt.ref, err, tt.want)
+		}
+		if err != nil && !errors.Is(err, ErrNotAllowed) {
+			t.Errorf("Image(%q) = %v, want ErrNotAllowed", tt.ref, err)
+		}
+	}
+	if err := (*Allowlist)(nil).Image("quay.io/acme/web"); err != nil {
+		t.Errorf("nil allowlist rejected an image: %v", err)
+	}
+}
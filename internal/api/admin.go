@@ -0,0 +1,191 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"weeklysec/internal/agent"
+	"weeklysec/internal/errcode"
+	"weeklysec/internal/queue"
+	"weeklysec/internal/requestid"
+	"weeklysec/internal/store"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog"
+)
+
+// AgentConfigSetting is the store key of the runtime agent configuration.
+const AgentConfigSetting = "agent_config"
+
+// GetAgentConfigHandler returns the agent configuration currently in effect.
+func (h *Handler) GetAgentConfigHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, h.agent.Config())
+}
+
+// UpdateAgentConfigHandler applies a new agent configuration. PUT replaces the
+// whole configuration; PATCH merges the supplied fields into the current one.
+func (h *Handler) UpdateAgentConfigHandler(c *gin.Context) {
+	before := h.agent.Config()
+
+	var next agent.AgentConfig
+	if c.Request.Method == http.MethodPatch {
+		next = before
+	}
+
+	dec := json.NewDecoder(c.Request.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&next); err != nil {
+		abortWithError(c, errcode.InvalidRequest, "Invalid request body", err.Error())
+		return
+	}
+	if err := next.Validate(); err != nil {
+		abortWithError(c, errcode.InvalidRequest, "Invalid configuration", err.Error())
+		return
+	}
+
+	if err := h.store.PutSetting(AgentConfigSetting, next); err != nil {
+		abortWithErr(c, err, "Failed to save configuration")
+		return
+	}
+	// Validated above, so this cannot fail.
+	_ = h.agent.SetConfig(next)
+
+	h.audit(c, "agent_config.update", before, next)
+	c.JSON(http.StatusOK, next)
+}
+
+// AuditLogHandler lists admin changes, newest first.
+func (h *Handler) AuditLogHandler(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "100"))
+
+	entries, err := h.store.ListAudit(limit)
+	if err != nil {
+		abortWithErr(c, err, "Failed to read audit log")
+		return
+	}
+	if entries == nil {
+		entries = []store.AuditEntry{}
+	}
+	c.JSON(http.StatusOK, gin.H{"entries": entries})
+}
+
+// QueuesHandler reports the depth and totals of the agent's work queues
+// and, when there is one, of the job queue shared with other replicas.
+func (h *Handler) QueuesHandler(c *gin.Context) {
+	queues := []queue.Stats{}
+	for _, p := range []*queue.Pool{h.runs, h.scans} {
+		if p != nil {
+			queues = append(queues, p.Stats())
+		}
+	}
+	body := gin.H{"queues": queues}
+	if h.jobs != nil {
+		stats, err := h.jobs.Stats(c.Request.Context())
+		if err != nil {
+			abortWithErr(c, err, "Failed to read the job queue")
+			return
+		}
+		body["jobs"] = stats
+	}
+	c.JSON(http.StatusOK, body)
+}
+
+// writeQueueMetrics writes the load of the agent's work queues.
+func (h *Handler) writeQueueMetrics(b *strings.Builder) {
+	var stats []queue.Stats
+	for _, p := range []*queue.Pool{h.runs, h.scans} {
+		if p != nil {
+			stats = append(stats, p.Stats())
+		}
+	}
+	metric := func(name, kind, help string, value func(queue.Stats) int64) {
+		fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+		for _, s := range stats {
+			fmt.Fprintf(b, "%s{pool=%q} %d\n", name, s.Name, value(s))
+		}
+	}
+	metric("weeklysec_queue_queued", "gauge", "Jobs waiting for a worker.", func(s queue.Stats) int64 { return s.Queued })
+	metric("weeklysec_queue_running", "gauge", "Jobs being worked on.", func(s queue.Stats) int64 { return s.Running })
+	metric("weeklysec_queue_rejected_total", "counter", "Jobs turned away by a full queue or a wait timeout.", func(s queue.Stats) int64 { return s.Rejected })
+}
+
+// audit records an admin change. Failures are logged; the change itself has
+// already been applied.
+// RetentionStatusHandler reports the retention policy and the latest purge.
+func (h *Handler) RetentionStatusHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, h.purger.Status())
+}
+
+// PurgeHandler starts a retention purge and answers 202, or 409 if one is
+// already running.
+func (h *Handler) PurgeHandler(c *gin.Context) {
+	if !h.purger.Trigger("admin") {
+		abortWithError(c, errcode.Conflict, "A purge is already running", nil)
+		return
+	}
+	h.audit(c, "retention.purge", nil, h.purger.Status().Policy)
+	c.JSON(http.StatusAccepted, h.purger.Status())
+}
+
+// ExportHandler streams every stored scan, suppression, target and finding
+// as a gzipped tar archive.
+func (h *Handler) ExportHandler(c *gin.Context) {
+	name := "weeklysec-" + time.Now().UTC().Format("20060102-150405") + ".tar.gz"
+	c.Header("Content-Type", "application/gzip")
+	c.Header("Content-Disposition", `attachment; filename="`+name+`"`)
+
+	// Headers are already sent once streaming starts, so a failure can only
+	// be logged; the truncated archive will not decompress cleanly.
+	m, err := h.store.Export(c.Request.Context(), c.Writer)
+	if err != nil {
+		zerolog.Ctx(c.Request.Context()).Error().Err(err).Msg("Export failed")
+		return
+	}
+	h.audit(c, "store.export", nil, m)
+}
+
+// ImportHandler loads an archive produced by ExportHandler. Existing records
+// are skipped unless overwrite=true.
+func (h *Handler) ImportHandler(c *gin.Context) {
+	res, err := h.store.Import(c.Request.Context(), c.Request.Body, c.Query("overwrite") == "true")
+	if err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			abortWithError(c, errcode.RequestTooLarge, "Archive too large", gin.H{"max_bytes": maxErr.Limit})
+			return
+		}
+		abortWithError(c, errcode.InvalidRequest, "Import failed", gin.H{"error": err.Error(), "imported": res})
+		return
+	}
+	h.audit(c, "store.import", nil, res)
+	c.JSON(http.StatusOK, res)
+}
+
+func (h *Handler) audit(c *gin.Context, action string, before, after any) {
+	entry := store.AuditEntry{
+		Actor:     identity(c),
+		Action:    action,
+		RequestID: requestid.FromContext(c.Request.Context()),
+		Before:    mustJSON(before),
+		After:     mustJSON(after),
+	}
+	if err := h.store.AppendAudit(entry); err != nil {
+		zerolog.Ctx(c.Request.Context()).Error().Err(err).Str("action", action).Msg("Failed to write audit entry")
+	}
+}
+
+func mustJSON(v any) json.RawMessage {
+	if v == nil {
+		return nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil || bytes.Equal(data, []byte("null")) {
+		return nil
+	}
+	return data
+}
@@ -0,0 +1,21 @@
+package api
+
+import (
+	"context"
+	"weeklysec/internal/store"
+
+	"github.com/rs/zerolog"
+)
+
+// pageOnCall raises and resolves on-call alerts for scan in the background.
+func (h *Handler) pageOnCall(ctx context.Context, scan *store.Scan) {
+	if h.alerter == nil {
+		return
+	}
+	ctx = context.WithoutCancel(ctx)
+	go func() {
+		if _, err := h.alerter.Check(ctx, scan); err != nil {
+			zerolog.Ctx(ctx).Error().Err(err).Str("scan_id", scan.ID).Msg("Failed to page on-call")
+		}
+	}()
+}
@@ -0,0 +1,113 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"unicode"
+	"weeklysec/internal/agent"
+	"weeklysec/internal/allowlist"
+	"weeklysec/internal/errcode"
+	"weeklysec/internal/webhook"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TargetTypeApp is the target type of application scans, whose target is
+// the application's name.
+const TargetTypeApp = "app"
+
+// AppScanRequest is the body accepted by POST /api/v1/app-scans.
+type AppScanRequest struct {
+	Name          string   `json:"name"`   // the application, the target of the scan
+	Images        []string `json:"images"` // the images it is made of
+	Project       string   `json:"project"`
+	Explain       bool     `json:"explain"`
+	WebhookURL    string   `json:"webhook_url"`
+	WebhookSecret string   `json:"webhook_secret"`
+}
+
+// Validate checks the request, each image as ScanRequest.Validate would,
+// and drops repeated images.
+func (r *AppScanRequest) Validate(maxTargetLength, maxImages int, allow *allowlist.Allowlist) error {
+	r.Name = strings.TrimSpace(r.Name)
+	switch {
+	case r.Name == "":
+		return fmt.Errorf("'name' is required")
+	case len(r.Name) > maxTargetLength:
+		return fmt.Errorf("'name' exceeds the maximum length of %d characters", maxTargetLength)
+	case strings.ContainsFunc(r.Name, unicode.IsControl):
+		return fmt.Errorf("'name' must not contain control characters")
+	case len(r.Images) == 0:
+		return fmt.Errorf("'images' is required")
+	case maxImages > 0 && len(r.Images) > maxImages:
+		return fmt.Errorf("'images' has more than %d images; scan the application in parts", maxImages)
+	}
+
+	var images []string
+	for i, image := range r.Images {
+		req := ScanRequest{TargetType: TargetTypeImage, Target: image}
+		if err := req.Validate(maxTargetLength, allow); err != nil {
+			return fmt.Errorf("'images[%d]': %w", i, err)
+		}
+		if !slices.Contains(images, req.Target) {
+			images = append(images, req.Target)
+		}
+	}
+	r.Images = images
+
+	if r.WebhookURL != "" {
+		return webhook.ValidateEndpoint(r.WebhookURL)
+	}
+	return nil
+}
+
+// ScanAppHandler scans the images of one application at once and runs the
+// agent pipeline once over their merged findings, so a finding shared by
+// several images counts once and the remediation package covers the whole
+// stack. The scan is stored with the application's name as its target.
+func (h *Handler) ScanAppHandler(c *gin.Context) {
+	format, ok := negotiateFormat(c)
+	if !ok {
+		return
+	}
+	var body AppScanRequest
+	if err := c.ShouldBindJSON(&body); err != nil {
+		abortWithError(c, errcode.InvalidRequest, "Invalid request body", err.Error())
+		return
+	}
+	if err := body.Validate(h.cfg.MaxTargetLength, h.cfg.AppScanMaxImages, h.allow); err != nil {
+		abortInvalid(c, err)
+		return
+	}
+	t, err := writeTenant(c, body.Project)
+	if err != nil {
+		abortWithError(c, errcode.Forbidden, "Forbidden", err.Error())
+		return
+	}
+
+	req := ScanRequest{
+		TargetType:    TargetTypeApp,
+		Target:        body.Name,
+		Project:       body.Project,
+		Explain:       body.Explain,
+		WebhookURL:    body.WebhookURL,
+		WebhookSecret: body.WebhookSecret,
+		tenant:        t,
+		caller:        identity(c),
+	}
+	resp, _, err := h.runAgent(c.Request.Context(), req, agent.Request{
+		TargetType:  TargetTypeApp,
+		Target:      body.Name,
+		Images:      body.Images,
+		Summarize:   true,
+		Remediation: true,
+		Explain:     body.Explain,
+	})
+	if err != nil {
+		abortWithRun(c, format, resp, "Scan failed")
+		return
+	}
+	renderResponse(c, http.StatusOK, format, resp)
+}
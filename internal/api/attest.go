@@ -0,0 +1,146 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+	"weeklysec/internal/attest"
+	"weeklysec/internal/cosign"
+	"weeklysec/internal/errcode"
+	"weeklysec/internal/store"
+	"weeklysec/internal/trivy"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog"
+)
+
+// attachTimeout bounds pushing one attestation to a registry.
+const attachTimeout = 2 * time.Minute
+
+// AttestationHandler returns a scan's results as a signed in-toto
+// attestation in a DSSE envelope, verifiable with the key served by
+// AttestationKeyHandler.
+func (h *Handler) AttestationHandler(c *gin.Context) {
+	if h.attester == nil {
+		abortWithError(c, errcode.InvalidRequest, "Attestations are not configured", nil)
+		return
+	}
+	scan, ok := h.loadScan(c)
+	if !ok {
+		return
+	}
+	env, _, err := h.attestation(c.Request.Context(), scan)
+	if err != nil {
+		abortWithErr(c, err, "Failed to create attestation")
+		return
+	}
+	c.JSON(http.StatusOK, env)
+}
+
+// AttachAttestationHandler signs a scan's attestation and attaches it to
+// the scanned image in its registry.
+func (h *Handler) AttachAttestationHandler(c *gin.Context) {
+	if h.attester == nil {
+		abortWithError(c, errcode.InvalidRequest, "Attestations are not configured", nil)
+		return
+	}
+	scan, ok := h.loadScan(c)
+	if !ok {
+		return
+	}
+	ref, err := h.attach(c.Request.Context(), scan)
+	if err != nil {
+		abortWithErr(c, err, "Failed to attach attestation")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"scan_id": scan.ID, "image": ref, "predicate_type": attest.PredicateType})
+}
+
+// AttestationKeyHandler serves the PEM public key attestations are signed
+// with, for cosign verify-attestation --key or an admission policy.
+func (h *Handler) AttestationKeyHandler(c *gin.Context) {
+	if h.attester == nil {
+		abortWithError(c, errcode.InvalidRequest, "Attestations are not configured", nil)
+		return
+	}
+	c.Data(http.StatusOK, "application/x-pem-file", h.attester.PublicKey())
+}
+
+// attestScan archives the attestation of a stored image scan in the
+// background, and attaches it to the image when ATTESTATION_ATTACH is set.
+func (h *Handler) attestScan(ctx context.Context, scan *store.Scan) {
+	if h.attester == nil || scan.TargetType != "image" {
+		return
+	}
+	ctx = context.WithoutCancel(ctx)
+	go func() {
+		logger := zerolog.Ctx(ctx).With().Str("scan_id", scan.ID).Logger()
+		if h.cfg.AttestationAttach {
+			ref, err := h.attach(ctx, scan)
+			if err != nil {
+				logger.Error().Err(err).Msg("Failed to attach attestation")
+				return
+			}
+			logger.Info().Str("image", ref).Msg("Attached attestation")
+			return
+		}
+		if _, _, err := h.attestation(ctx, scan); err != nil {
+			logger.Warn().Err(err).Msg("Failed to create attestation")
+		}
+	}()
+}
+
+// attach signs the attestation of scan and attaches it to the image,
+// returning the image reference it went to.
+func (h *Handler) attach(ctx context.Context, scan *store.Scan) (string, error) {
+	env, subject, err := h.attestation(ctx, scan)
+	if err != nil {
+		return "", err
+	}
+	data, err := json.Marshal(env)
+	if err != nil {
+		return "", err
+	}
+	ctx, cancel := context.WithTimeout(ctx, attachTimeout)
+	defer cancel()
+	if err := cosign.AttachAttestation(ctx, subject.Ref(), data); err != nil {
+		return "", err
+	}
+	return subject.Ref(), nil
+}
+
+// attestation signs a statement about scan and archives it next to the
+// report.
+func (h *Handler) attestation(ctx context.Context, scan *store.Scan) (*attest.Envelope, attest.Subject, error) {
+	raw, err := h.store.RawOutput(ctx, scan)
+	if err != nil {
+		return nil, attest.Subject{}, err
+	}
+	subject, err := attest.SubjectOf(scan, raw)
+	if err != nil {
+		return nil, attest.Subject{}, errcode.Wrap(errcode.InvalidRequest, err)
+	}
+
+	// The scanner version is best effort; the statement records "unknown"
+	// without it.
+	version, _ := trivy.Version(ctx)
+	var uri string
+	if h.cfg.PublicURL != "" {
+		uri = strings.TrimRight(h.cfg.PublicURL, "/") + "/api/v1/scans/" + scan.ID
+	}
+	env, err := h.attester.Sign(attest.New(scan, subject, version, uri))
+	if err != nil {
+		return nil, attest.Subject{}, err
+	}
+
+	data, err := json.Marshal(env)
+	if err != nil {
+		return nil, attest.Subject{}, err
+	}
+	if err := h.archiveReport(ctx, scan.ID, "attestation.intoto.jsonl", "application/vnd.dsse.envelope.v1+json", data); err != nil {
+		zerolog.Ctx(ctx).Error().Err(err).Str("scan_id", scan.ID).Msg("Failed to archive attestation")
+	}
+	return env, subject, nil
+}
@@ -0,0 +1,60 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"weeklysec/internal/errcode"
+	"weeklysec/internal/tenant"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestAuthenticateWriteTenant(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	resolver, err := tenant.NewResolver([]string{"web=acme/web", "org=acme"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := gin.New()
+	r.POST("/records", Authenticate(resolver, true), func(c *gin.Context) {
+		owner, err := writeTenant(c, c.Query("project"))
+		if err != nil {
+			abortWithError(c, errcode.Forbidden, "Forbidden", err.Error())
+			return
+		}
+		c.String(http.StatusOK, owner.String())
+	})
+
+	tests := []struct {
+		name       string
+		key        string
+		project    string
+		wantStatus int
+		wantOwner  string
+	}{
+		{"no credentials", "", "", http.StatusUnauthorized, ""},
+		{"unknown key", "nope", "", http.StatusUnauthorized, ""},
+		{"project key, own project", "web", "web", http.StatusOK, "acme/web"},
+		{"project key, no project", "web", "", http.StatusOK, "acme/web"},
+		{"project key, other project", "web", "api", http.StatusForbidden, ""},
+		{"org key, any project", "org", "api", http.StatusOK, "acme/api"},
+		{"org key, no project", "org", "", http.StatusOK, "acme/default"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/records?project="+tt.project, nil)
+			if tt.key != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.key)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+			}
+			if tt.wantOwner != "" && w.Body.String() != tt.wantOwner {
+				t.Fatalf("owner = %q, want %q", w.Body, tt.wantOwner)
+			}
+		})
+	}
+}
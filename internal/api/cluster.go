@@ -0,0 +1,126 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"weeklysec/internal/agent"
+	"weeklysec/internal/cluster"
+	"weeklysec/internal/errcode"
+	"weeklysec/internal/queue"
+	"weeklysec/internal/store"
+	"weeklysec/internal/tenant"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog"
+)
+
+// ClusterReportSetting is the store key of the latest cluster scan report.
+const ClusterReportSetting = "cluster_report"
+
+// ClusterScanHandler lists the images running in the cluster and scans
+// them in the background, answering 202 with the images found. The scans
+// belong to the cluster scan tenant, which the caller must have access to.
+func (h *Handler) ClusterScanHandler(c *gin.Context) {
+	if !h.allowsCluster(c) {
+		return
+	}
+	ctx := c.Request.Context()
+	images, err := h.cluster.Discover(ctx)
+	if err != nil {
+		abortWithErr(c, err, "Failed to list cluster images")
+		return
+	}
+	run, err := h.cluster.Start()
+	if err != nil {
+		abortWithError(c, errcode.Conflict, "A cluster scan is already running", nil)
+		return
+	}
+
+	// Detach from the request so the scans outlive it, keeping its logger
+	// and request ID.
+	ctx = context.WithoutCancel(ctx)
+	go func() { h.finishClusterScan(ctx, run(ctx, images)) }()
+
+	c.JSON(http.StatusAccepted, gin.H{"images": images, "count": len(images)})
+}
+
+// ClusterReportHandler returns the report of the latest cluster scan.
+func (h *Handler) ClusterReportHandler(c *gin.Context) {
+	if !h.allowsCluster(c) {
+		return
+	}
+	var report cluster.Report
+	err := h.store.GetSetting(ClusterReportSetting, &report)
+	if errors.Is(err, store.ErrNotFound) {
+		abortWithError(c, errcode.NotFound, "No cluster scan has finished yet", nil)
+		return
+	}
+	if err != nil {
+		abortWithErr(c, err, "Failed to load cluster report")
+		return
+	}
+	report.Running = h.cluster.Running()
+	c.JSON(http.StatusOK, report)
+}
+
+// ScanCluster runs a cluster scan, for the scheduler. It does nothing
+// while another one runs.
+func (h *Handler) ScanCluster(ctx context.Context) {
+	logger := zerolog.Ctx(ctx)
+	images, err := h.cluster.Discover(ctx)
+	if err != nil {
+		logger.Error().Err(err).Msg("Failed to list cluster images")
+		return
+	}
+	run, err := h.cluster.Start()
+	if err != nil {
+		logger.Warn().Err(err).Msg("Skipping scheduled cluster scan")
+		return
+	}
+	h.finishClusterScan(ctx, run(ctx, images))
+}
+
+// ScanClusterImage scans one discovered image for the cluster scan tenant.
+func (h *Handler) ScanClusterImage(ctx context.Context, ref string) (*store.Scan, error) {
+	owner, err := tenant.Parse(h.cfg.ClusterScanTenant)
+	if err != nil {
+		return nil, err
+	}
+	req := ScanRequest{TargetType: TargetTypeImage, Target: ref, Summarize: true, tenant: owner}
+	// A fleet crawl yields to scans someone is waiting on.
+	_, scan, err := h.runAgent(queue.WithPriority(ctx, queue.PriorityScheduled), req, agent.Request{
+		TargetType:  TargetTypeImage,
+		Target:      ref,
+		Summarize:   true,
+		Remediation: true,
+	})
+	return scan, err
+}
+
+func (h *Handler) finishClusterScan(ctx context.Context, report *cluster.Report) {
+	logger := zerolog.Ctx(ctx)
+	if err := h.store.PutSetting(ClusterReportSetting, report); err != nil {
+		logger.Error().Err(err).Msg("Failed to save cluster report")
+	}
+	logger.Info().
+		Int("images", len(report.Images)).
+		Int("scanned", report.Scanned).
+		Int("failed", report.Failed).
+		Msg("Cluster scan finished")
+}
+
+// allowsCluster checks that cluster scanning is on and that the caller
+// may see the cluster scan tenant's data.
+func (h *Handler) allowsCluster(c *gin.Context) bool {
+	if h.cluster == nil {
+		abortWithError(c, errcode.InvalidRequest, "Cluster scanning is not configured", nil)
+		return false
+	}
+	owner, err := tenant.Parse(h.cfg.ClusterScanTenant)
+	if err != nil || !tenant.FromContext(c.Request.Context()).Allows(owner.Org, owner.Project) {
+		abortWithError(c, errcode.NotFound, "Cluster scanning is not available to this tenant", nil)
+		return false
+	}
+	return true
+}
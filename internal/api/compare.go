@@ -0,0 +1,78 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+	"weeklysec/internal/envcompare"
+	"weeklysec/internal/errcode"
+	"weeklysec/internal/report"
+	"weeklysec/internal/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CompareHandler compares the caller's applications between two
+// environments, highlighting the findings open in `to` that `from` has
+// already fixed. Query parameters: from and to (required, e.g. staging and
+// prod), by ("environment", the default, or "label:<key>" to compare
+// clusters or any other label), application (one application only) and
+// selector (a label selector narrowing the targets).
+func (h *Handler) CompareHandler(c *gin.Context) {
+	format, ok := negotiateFormat(c)
+	if !ok {
+		return
+	}
+
+	opts := envcompare.Options{
+		By:           c.DefaultQuery("by", "environment"),
+		From:         c.Query("from"),
+		To:           c.Query("to"),
+		ServiceLabel: h.cfg.ServiceLabel,
+	}
+	switch key, isLabel := strings.CutPrefix(opts.By, "label:"); {
+	case opts.By != "environment" && (!isLabel || key == ""):
+		abortWithError(c, errcode.InvalidRequest, "Invalid request", "'by' must be environment or label:<key>")
+		return
+	case opts.From == "" || opts.To == "":
+		abortWithError(c, errcode.InvalidRequest, "Invalid request", "'from' and 'to' are required")
+		return
+	case opts.From == opts.To:
+		abortWithError(c, errcode.InvalidRequest, "Invalid request", "'from' and 'to' must differ")
+		return
+	}
+
+	f, ok := targetFilter(c, TargetSelector{Selector: c.Query("selector")})
+	if !ok {
+		return
+	}
+	app := c.Query("application")
+	all, err := h.store.ListTargets(f)
+	if err != nil {
+		abortWithErr(c, err, "Failed to list targets")
+		return
+	}
+	var targets []store.Target
+	for _, t := range all {
+		if app == "" || opts.Application(t) == app {
+			targets = append(targets, t)
+		}
+	}
+	latest, ok := h.latestScans(c, map[string][]store.Target{"": targets})
+	if !ok {
+		return
+	}
+	r := envcompare.Build(opts, targets, latest)
+
+	switch format {
+	case formatText:
+		l := negotiateLocale(c)
+		c.Header("Content-Language", l.Lang())
+		c.String(http.StatusOK, report.CompareText(r, l))
+	case formatMarkdown:
+		l := negotiateLocale(c)
+		c.Header("Content-Language", l.Lang())
+		c.Data(http.StatusOK, "text/markdown; charset=utf-8", []byte(report.CompareMarkdown(r, l)))
+	default:
+		c.JSON(http.StatusOK, r)
+	}
+}
@@ -0,0 +1,58 @@
+package api
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"weeklysec/internal/config"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CORS answers preflight requests and sets the CORS response headers for
+// origins in the configured allowlist. "*" allows any origin, but never
+// with credentials: the server refuses to start with both.
+func CORS(cfg *config.Config) gin.HandlerFunc {
+	allowAny := slices.Contains(cfg.CORSAllowedOrigins, "*")
+	methods := strings.Join(cfg.CORSAllowedMethods, ", ")
+	headers := strings.Join(cfg.CORSAllowedHeaders, ", ")
+	maxAge := strconv.Itoa(int(cfg.CORSMaxAge.Seconds()))
+
+	return func(c *gin.Context) {
+		origin := c.GetHeader("Origin")
+		if origin == "" {
+			c.Next()
+			return
+		}
+
+		c.Writer.Header().Add("Vary", "Origin")
+		if !allowAny && !slices.Contains(cfg.CORSAllowedOrigins, origin) {
+			if c.Request.Method == http.MethodOptions {
+				c.AbortWithStatus(http.StatusForbidden)
+				return
+			}
+			c.Next()
+			return
+		}
+
+		if allowAny {
+			c.Header("Access-Control-Allow-Origin", "*")
+		} else {
+			c.Header("Access-Control-Allow-Origin", origin)
+		}
+		if cfg.CORSAllowCredentials && !allowAny {
+			c.Header("Access-Control-Allow-Credentials", "true")
+		}
+
+		if c.Request.Method == http.MethodOptions && c.GetHeader("Access-Control-Request-Method") != "" {
+			c.Header("Access-Control-Allow-Methods", methods)
+			c.Header("Access-Control-Allow-Headers", headers)
+			c.Header("Access-Control-Max-Age", maxAge)
+			c.AbortWithStatus(http.StatusNoContent)
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -0,0 +1,60 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"weeklysec/internal/errcode"
+	"weeklysec/internal/store"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog"
+)
+
+// ExportDefectDojoHandler pushes a stored scan's open findings into
+// DefectDojo and returns the test they landed in.
+func (h *Handler) ExportDefectDojoHandler(c *gin.Context) {
+	if h.dojo == nil {
+		abortWithError(c, errcode.InvalidRequest, "DefectDojo export is not configured", nil)
+		return
+	}
+	scan, ok := h.loadScan(c)
+	if !ok {
+		return
+	}
+	res, err := h.dojo.Export(c.Request.Context(), scan, h.targetOf(scan))
+	if err != nil {
+		abortWithErr(c, err, "Failed to export to DefectDojo")
+		return
+	}
+	c.JSON(http.StatusOK, res)
+}
+
+// exportDefectDojo pushes scan to DefectDojo in the background when
+// automatic export is on.
+func (h *Handler) exportDefectDojo(ctx context.Context, scan *store.Scan) {
+	if h.dojo == nil || !h.cfg.DefectDojoAutoExport {
+		return
+	}
+	ctx = context.WithoutCancel(ctx)
+	go func() {
+		logger := zerolog.Ctx(ctx)
+		res, err := h.dojo.Export(ctx, scan, h.targetOf(scan))
+		if err != nil {
+			logger.Error().Err(err).Str("scan_id", scan.ID).Msg("Failed to export to DefectDojo")
+			return
+		}
+		logger.Info().Str("scan_id", scan.ID).Int("test_id", res.TestID).Msg("Exported to DefectDojo")
+	}()
+}
+
+// targetOf returns the inventory entry scan belongs to, if any.
+func (h *Handler) targetOf(scan *store.Scan) *store.Target {
+	if scan.TargetID == "" {
+		return nil
+	}
+	t, err := h.store.GetTarget(scan.TargetID)
+	if err != nil {
+		return nil
+	}
+	return &t
+}
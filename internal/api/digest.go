@@ -0,0 +1,225 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+	"weeklysec/internal/digest"
+	"weeklysec/internal/email"
+	"weeklysec/internal/errcode"
+	"weeklysec/internal/i18n"
+	"weeklysec/internal/report"
+	"weeklysec/internal/store"
+	"weeklysec/internal/tenant"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog"
+)
+
+// DigestHandler returns the digest of the caller's targets. Query
+// parameters: period (a duration, default DIGEST_PERIOD), end (RFC 3339,
+// default now), selector (a label selector narrowing the targets) and
+// template (a custom digest template to render it with).
+func (h *Handler) DigestHandler(c *gin.Context) {
+	format, ok := negotiateFormat(c)
+	if !ok {
+		return
+	}
+
+	tmpl, ok := negotiateTemplate(c, report.TemplateDigest)
+	if !ok {
+		return
+	}
+	d, ok := h.digestFromQuery(c)
+	if !ok {
+		return
+	}
+	if tmpl != nil {
+		renderTemplate(c, http.StatusOK, tmpl, report.TemplateData{Digest: d})
+		return
+	}
+
+	switch format {
+	case formatText:
+		l := negotiateLocale(c)
+		c.Header("Content-Language", l.Lang())
+		c.String(http.StatusOK, report.DigestText(d, l))
+	case formatMarkdown:
+		l := negotiateLocale(c)
+		c.Header("Content-Language", l.Lang())
+		c.Data(http.StatusOK, "text/markdown; charset=utf-8", []byte(report.DigestMarkdown(d, l)))
+	default:
+		c.JSON(http.StatusOK, d)
+	}
+}
+
+// SendDigests sends every org's digest for the configured period to the
+// webhooks and chat notifiers, and emails the org, project and team digests
+// to their recipients. It is run by the scheduler.
+func (h *Handler) SendDigests(ctx context.Context) {
+	logger := zerolog.Ctx(ctx)
+	orgs, err := h.store.Orgs()
+	if err != nil {
+		logger.Error().Err(err).Msg("Failed to list orgs for digests")
+		return
+	}
+
+	end := time.Now().UTC()
+	for _, org := range orgs {
+		d, err := h.buildDigest(store.TargetFilter{Org: org, Project: tenant.AllProjects}, end, h.cfg.DigestPeriod)
+		if err != nil {
+			logger.Error().Err(err).Str("org", org).Msg("Failed to build digest")
+			continue
+		}
+		if d.TargetsScanned == 0 && d.TargetsMissed == 0 {
+			continue
+		}
+		logger.Info().Str("org", org).Int("targets", d.TargetsScanned).Msg("Sending digest")
+		h.webhooks.Notify(h.webhooks.NewDigestEvent(d))
+		h.notify.Digest(ctx, d)
+		h.mailDigests(ctx, org, d, end)
+	}
+}
+
+// mailDigests emails org's digest d to the org's recipients, and builds and
+// emails the project and team digests that have recipients of their own.
+func (h *Handler) mailDigests(ctx context.Context, org string, d *digest.Digest, end time.Time) {
+	if h.mailer == nil {
+		return
+	}
+	logger := zerolog.Ctx(ctx)
+	recipients := h.emailRoutes()
+
+	h.mailDigest(ctx, org, d, append(recipients["*"], recipients[org]...))
+
+	scoped := func(scope string, f store.TargetFilter) {
+		d, err := h.buildDigest(f, end, h.cfg.DigestPeriod)
+		if err != nil {
+			logger.Error().Err(err).Str("scope", scope).Msg("Failed to build digest")
+			return
+		}
+		if d.TargetsScanned > 0 || d.TargetsMissed > 0 {
+			h.mailDigest(ctx, scope, d, recipients[scope])
+		}
+	}
+	for _, project := range recipients.Projects(org) {
+		scoped(org+"/"+project, store.TargetFilter{Org: org, Project: project})
+	}
+	for _, team := range recipients.Teams() {
+		scoped("team:"+team, store.TargetFilter{Org: org, Project: tenant.AllProjects, Team: team})
+	}
+}
+
+func (h *Handler) mailDigest(ctx context.Context, scope string, d *digest.Digest, to []string) {
+	if len(to) == 0 {
+		return
+	}
+	if err := h.sendDigestMail(ctx, scope, d, to, ReportFormatHTML, i18n.Current().Fallback()); err != nil {
+		zerolog.Ctx(ctx).Error().Err(err).Str("scope", scope).Msg("Failed to email digest")
+	}
+}
+
+// sendDigestMail emails digest d of scope to the addresses to, rendered in
+// one of the report formats with its fixed strings in l. HTML mails carry a
+// PDF too with EMAIL_ATTACH_PDF.
+func (h *Handler) sendDigestMail(ctx context.Context, scope string, d *digest.Digest, to []string, format string, l *i18n.Locale) error {
+	name := "digest-" + d.PeriodEnd.Format("2006-01-02")
+	msg := email.Message{
+		To:      to,
+		Subject: l.T("Security digest for %s: %s to %s", scope, d.PeriodStart.Format("2006-01-02"), d.PeriodEnd.Format("2006-01-02")),
+		Text:    report.DigestText(d, l),
+	}
+	switch format {
+	case ReportFormatHTML:
+		link := ""
+		if h.cfg.PublicURL != "" {
+			link = strings.TrimRight(h.cfg.PublicURL, "/") + "/api/v1/digest?format=markdown"
+		}
+		html, err := report.DigestHTML(d, link, l)
+		if err != nil {
+			return fmt.Errorf("failed to render digest: %w", err)
+		}
+		msg.HTML = html
+		if h.cfg.EmailAttachPDF {
+			msg.Attachments = append(msg.Attachments, email.Attachment{Name: name + ".pdf", ContentType: "application/pdf", Data: report.DigestPDF(d, l)})
+		}
+	case ReportFormatMarkdown:
+		msg.Text = report.DigestMarkdown(d, l)
+	case ReportFormatPDF:
+		msg.Attachments = append(msg.Attachments, email.Attachment{Name: name + ".pdf", ContentType: "application/pdf", Data: report.DigestPDF(d, l)})
+	case ReportFormatJSON:
+		data, err := json.MarshalIndent(d, "", "  ")
+		if err != nil {
+			return err
+		}
+		msg.Attachments = append(msg.Attachments, email.Attachment{Name: name + ".json", ContentType: "application/json", Data: data})
+	}
+	if err := h.mailer.Send(ctx, msg); err != nil {
+		return err
+	}
+	zerolog.Ctx(ctx).Info().Str("scope", scope).Int("recipients", len(to)).Msg("Emailed digest")
+	return nil
+}
+
+// digestFromQuery builds the digest of the caller's targets for the
+// period, end and selector query parameters.
+func (h *Handler) digestFromQuery(c *gin.Context) (*digest.Digest, bool) {
+	period := h.cfg.DigestPeriod
+	if v := c.Query("period"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			abortWithError(c, errcode.InvalidRequest, "Invalid request", "'period' must be a positive duration such as 168h")
+			return nil, false
+		}
+		period = d
+	}
+	end := time.Now().UTC()
+	if v := c.Query("end"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			abortWithError(c, errcode.InvalidRequest, "Invalid request", "'end' must be an RFC 3339 timestamp")
+			return nil, false
+		}
+		end = t
+	}
+
+	f, ok := targetFilter(c, TargetSelector{Selector: c.Query("selector")})
+	if !ok {
+		return nil, false
+	}
+	d, err := h.buildDigest(f, end, period)
+	if err != nil {
+		abortWithErr(c, err, "Failed to build digest")
+		return nil, false
+	}
+	return d, true
+}
+
+// buildDigest covers the targets matching f. With a team or label selector,
+// scans of unregistered targets are left out since they have no owner.
+func (h *Handler) buildDigest(f store.TargetFilter, end time.Time, period time.Duration) (*digest.Digest, error) {
+	scans, err := h.store.ListScans(store.ScanFilter{Org: f.Org, Project: f.Project})
+	if err != nil {
+		return nil, err
+	}
+	targets, err := h.store.ListTargets(f)
+	if err != nil {
+		return nil, err
+	}
+	if f.Team != "" || !f.Selector.Empty() {
+		scans = scansOfTargets(scans, targets)
+	}
+	for i, t := range targets {
+		if t.Team == "" {
+			targets[i].Team = t.Labels[h.cfg.OwnerLabel]
+		}
+	}
+	findings, err := h.store.ListFindings(store.FindingFilter{Org: f.Org, Project: f.Project})
+	if err != nil {
+		return nil, err
+	}
+	return digest.Build(f.Org, f.Project, scans, targets, findings, end, period, h.cfg.SLA()), nil
+}
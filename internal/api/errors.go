@@ -0,0 +1,95 @@
+package api
+
+import (
+	"net/http"
+	"weeklysec/internal/agent"
+	"weeklysec/internal/errcode"
+	"weeklysec/internal/requestid"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ErrorBody is the typed error envelope returned by every endpoint:
+//
+//	{"error": {"code": "TARGET_UNREACHABLE", "message": "...", "details": ..., "request_id": "..."}}
+type ErrorBody struct {
+	Code      errcode.Code `json:"code"`
+	Message   string       `json:"message"`
+	Details   any          `json:"details,omitempty"`
+	RequestID string       `json:"request_id,omitempty"`
+}
+
+// codeStatus maps error codes to HTTP statuses. Unlisted codes are 500.
+var codeStatus = map[errcode.Code]int{
+	errcode.InvalidRequest:       http.StatusBadRequest,
+	errcode.RequestTooLarge:      http.StatusRequestEntityTooLarge,
+	errcode.TooManyRequests:      http.StatusTooManyRequests,
+	errcode.NotAcceptable:        http.StatusNotAcceptable,
+	errcode.Unauthorized:         http.StatusUnauthorized,
+	errcode.Forbidden:            http.StatusForbidden,
+	errcode.NotFound:             http.StatusNotFound,
+	errcode.Conflict:             http.StatusConflict,
+	errcode.TargetNotAllowed:     http.StatusForbidden,
+	errcode.TrivyNotFound:        http.StatusServiceUnavailable,
+	errcode.TargetUnreachable:    http.StatusUnprocessableEntity,
+	errcode.InvalidReport:        http.StatusBadGateway,
+	errcode.SignatureCheckFailed: http.StatusBadGateway,
+	errcode.AttestationFailed:    http.StatusBadGateway,
+	errcode.LLMNotConfigured:     http.StatusServiceUnavailable,
+	errcode.LLMRateLimited:       http.StatusTooManyRequests,
+	errcode.LLMInvalidJSON:       http.StatusBadGateway,
+	errcode.LLMUnavailable:       http.StatusBadGateway,
+	errcode.BudgetExceeded:       http.StatusPaymentRequired,
+	errcode.QuotaExceeded:        http.StatusTooManyRequests,
+	errcode.GitHubError:          http.StatusBadGateway,
+	errcode.JiraError:            http.StatusBadGateway,
+	errcode.DefectDojoError:      http.StatusBadGateway,
+	errcode.DependencyTrackError: http.StatusBadGateway,
+	errcode.KubernetesError:      http.StatusBadGateway,
+	errcode.ServiceNowError:      http.StatusBadGateway,
+	errcode.Timeout:              http.StatusGatewayTimeout,
+}
+
+func statusFor(code errcode.Code) int {
+	if status, ok := codeStatus[code]; ok {
+		return status
+	}
+	return http.StatusInternalServerError
+}
+
+// abortWithError writes the error envelope with the status matching code.
+func abortWithError(c *gin.Context, code errcode.Code, message string, details any) {
+	retryLater(c, code)
+	c.AbortWithStatusJSON(statusFor(code), gin.H{"error": ErrorBody{
+		Code:      code,
+		Message:   message,
+		Details:   details,
+		RequestID: requestid.FromContext(c.Request.Context()),
+	}})
+}
+
+// abortWithErr classifies err and writes the error envelope, using err's text
+// as the details.
+func abortWithErr(c *gin.Context, err error, message string) {
+	abortWithError(c, errcode.Of(err), message, err.Error())
+}
+
+// abortWithRun reports a failed agent run. JSON clients get the error envelope
+// with the response in the details; text and Markdown clients get the report.
+func abortWithRun(c *gin.Context, format string, resp *agent.AgentResponse, message string) {
+	if format != formatJSON {
+		retryLater(c, resp.ErrorCode)
+		renderResponse(c, statusFor(resp.ErrorCode), format, resp)
+		c.Abort()
+		return
+	}
+	abortWithError(c, resp.ErrorCode, message, gin.H{"error": resp.Error, "response": resp})
+}
+
+// retryLater tells clients turned away by a full queue when to come back,
+// unless the handler already did.
+func retryLater(c *gin.Context, code errcode.Code) {
+	if code == errcode.TooManyRequests && c.Writer.Header().Get("Retry-After") == "" {
+		c.Header("Retry-After", "5")
+	}
+}
@@ -0,0 +1,55 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"weeklysec/internal/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+// scanETag identifies one representation of a stored scan. A scan only
+// changes when it is re-analyzed, which replaces the response, so the
+// response's completion time stands in for its content; the format,
+// field selection, template and report language are mixed in because
+// they change the body.
+func scanETag(c *gin.Context, scan *store.Scan, format string) string {
+	var version int64
+	if scan.Response != nil {
+		version = scan.Response.CompletedAt.UnixNano()
+	}
+	fields, _ := selectedFields(c)
+
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\x00%d\x00%d\x00%s\x00%s\x00%s\x00%s", scan.ID, version, len(scan.History), format, strings.Join(fields, ","), c.Query("template"), negotiateLocale(c).Lang())
+	return `"` + hex.EncodeToString(h.Sum(nil)[:16]) + `"`
+}
+
+// notModified sets the validator headers and, when the client's
+// If-None-Match already matches etag, writes a 304 and returns true.
+func notModified(c *gin.Context, etag string) bool {
+	c.Header("ETag", etag)
+	c.Header("Cache-Control", "private, no-cache")
+	c.Writer.Header().Add("Vary", "Accept, Accept-Language")
+
+	if matchesETag(c.GetHeader("If-None-Match"), etag) {
+		c.Status(http.StatusNotModified)
+		return true
+	}
+	return false
+}
+
+// matchesETag reports whether an If-None-Match header lists etag. The
+// comparison is weak, as RFC 9110 requires for If-None-Match.
+func matchesETag(header, etag string) bool {
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" || strings.TrimPrefix(tag, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
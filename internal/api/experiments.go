@@ -0,0 +1,116 @@
+package api
+
+import (
+	"cmp"
+	"encoding/json"
+	"net/http"
+	"time"
+	"weeklysec/internal/agent"
+	"weeklysec/internal/errcode"
+	"weeklysec/internal/experiment"
+	"weeklysec/internal/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ExperimentsSetting is the store key of the prompt experiments set through
+// the admin API, which take precedence over EXPERIMENTS_FILE.
+const ExperimentsSetting = "experiments"
+
+// defaultExperimentPeriod is how far back results look by default.
+const defaultExperimentPeriod = 30 * 24 * time.Hour
+
+// GetExperimentsHandler returns the prompt experiments in effect.
+func (h *Handler) GetExperimentsHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, h.agent.Experiments().Config())
+}
+
+// UpdateExperimentsHandler replaces the prompt experiments. Runs already
+// in progress keep the variants they got.
+func (h *Handler) UpdateExperimentsHandler(c *gin.Context) {
+	var next experiment.Config
+	dec := json.NewDecoder(c.Request.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&next); err != nil {
+		abortWithError(c, errcode.InvalidRequest, "Invalid request body", err.Error())
+		return
+	}
+	set, err := experiment.Compile(next)
+	if err != nil {
+		abortWithError(c, errcode.InvalidRequest, "Invalid experiments", err.Error())
+		return
+	}
+	if err := h.store.PutSetting(ExperimentsSetting, set.Config()); err != nil {
+		abortWithErr(c, err, "Failed to save experiments")
+		return
+	}
+	before := h.agent.Experiments().Config()
+	if len(next.Experiments) == 0 {
+		set = nil
+	}
+	h.agent.SetExperiments(set)
+
+	h.audit(c, "experiments.update", before, set.Config())
+	c.JSON(http.StatusOK, set.Config())
+}
+
+// ExperimentResultsHandler compares the variants of each step over the
+// LLM calls of scans stored in the last period (default 720h): how often
+// their answers were usable, their latency, tokens and estimated cost, and
+// the feedback they got.
+func (h *Handler) ExperimentResultsHandler(c *gin.Context) {
+	period := defaultExperimentPeriod
+	if v := c.Query("period"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			abortWithError(c, errcode.InvalidRequest, "Invalid request", "'period' must be a positive duration such as 168h")
+			return
+		}
+		period = d
+	}
+	since := time.Now().UTC().Add(-period)
+
+	scans, err := h.store.ListScans(store.ScanFilter{Since: since})
+	if err != nil {
+		abortWithErr(c, err, "Failed to list scans")
+		return
+	}
+	var samples []experiment.Sample
+	for _, s := range scans {
+		for _, ex := range s.Exchanges {
+			samples = append(samples, experiment.Sample{
+				Step:       ex.Step,
+				Variant:    exchangeVariant(&ex),
+				Valid:      ex.Valid,
+				DurationMS: ex.DurationMS,
+				Tokens:     ex.Tokens,
+			})
+		}
+	}
+	feedback, err := h.store.ListFeedback(store.FeedbackFilter{})
+	if err != nil {
+		abortWithErr(c, err, "Failed to list feedback")
+		return
+	}
+	var ratings []experiment.Rating
+	for _, fb := range feedback {
+		if fb.Exchange == nil || fb.Rating == "" || fb.CreatedAt.Before(since) {
+			continue
+		}
+		ratings = append(ratings, experiment.Rating{
+			Step:    fb.Exchange.Step,
+			Variant: exchangeVariant(fb.Exchange),
+			Up:      fb.Rating == agent.RatingUp,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"since":   since,
+		"results": experiment.Results(h.agent.Experiments(), samples, ratings),
+	})
+}
+
+// exchangeVariant counts calls made before experiments as the control.
+func exchangeVariant(ex *agent.Exchange) string {
+	return cmp.Or(ex.Variant, experiment.Control)
+}
@@ -0,0 +1,103 @@
+package api
+
+import (
+	"cmp"
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+	"weeklysec/internal/errcode"
+	"weeklysec/internal/failure"
+	"weeklysec/internal/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+// defaultFailureWindow is how far back ScanFailuresHandler looks by default.
+const defaultFailureWindow = 7 * 24 * time.Hour
+
+// ScanFailuresHandler sums up how the scans of the caller's registered
+// targets failed, by failure class, and lists the targets failing now.
+// Query parameters: since (RFC3339, default a week ago), class, and the
+// filters of ListTargetsHandler.
+func (h *Handler) ScanFailuresHandler(c *gin.Context) {
+	until := time.Now().UTC()
+	since := until.Add(-defaultFailureWindow)
+	if v := c.Query("since"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			abortWithError(c, errcode.InvalidRequest, "Invalid request", "'since' must be an RFC3339 time")
+			return
+		}
+		since = t
+	}
+	class := c.Query("class")
+	if class != "" && !slices.Contains(failure.Classes, class) {
+		abortWithError(c, errcode.InvalidRequest, "Invalid request", "'class' must be one of "+strings.Join(failure.Classes, ", "))
+		return
+	}
+	f, ok := targetFilter(c, selectorFromQuery(c))
+	if !ok {
+		return
+	}
+	targets, err := h.ownedTargets(f)
+	if err != nil {
+		abortWithErr(c, err, "Failed to list targets")
+		return
+	}
+	statuses, err := h.store.ScanStatuses()
+	if err != nil {
+		abortWithErr(c, err, "Failed to load scan statuses")
+		return
+	}
+	c.JSON(http.StatusOK, failure.Summarize(targets, statuses, since, until, class))
+}
+
+// ownedTargets lists the targets matching f, with the team taken from the
+// owner label of those without one.
+func (h *Handler) ownedTargets(f store.TargetFilter) ([]store.Target, error) {
+	targets, err := h.store.ListTargets(f)
+	if err != nil {
+		return nil, err
+	}
+	for i, t := range targets {
+		if t.Team == "" {
+			targets[i].Team = t.Labels[h.cfg.OwnerLabel]
+		}
+	}
+	return targets, nil
+}
+
+// writeFailureMetrics writes the targets whose last scan attempt failed,
+// by failure class, for MetricsHandler.
+func (h *Handler) writeFailureMetrics(b *strings.Builder) error {
+	statuses, err := h.store.ScanStatuses()
+	if err != nil {
+		return err
+	}
+	targets, err := h.store.ListTargets(store.TargetFilter{})
+	if err != nil {
+		return err
+	}
+	type key struct{ org, project, class string }
+	failing := map[key]int{}
+	for _, t := range targets {
+		st, ok := statuses[t.ID]
+		if !ok || st.Failures == 0 {
+			continue
+		}
+		class := cmp.Or(st.LastClass, failure.Classify(errcode.Code(st.LastErrorCode), st.LastError))
+		failing[key{t.Org, t.Project, class}]++
+	}
+	const name = "weeklysec_failing_targets"
+	fmt.Fprintf(b, "# HELP %s Registered targets whose last scan attempt failed, by failure class.\n# TYPE %s gauge\n", name, name)
+	keys := slices.SortedFunc(maps.Keys(failing), func(a, b key) int {
+		return cmp.Or(cmp.Compare(a.org, b.org), cmp.Compare(a.project, b.project), cmp.Compare(a.class, b.class))
+	})
+	for _, k := range keys {
+		fmt.Fprintf(b, "%s{org=%q,project=%q,class=%q} %d\n", name, k.org, k.project, k.class, failing[k])
+	}
+	return nil
+}
@@ -0,0 +1,316 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+	"weeklysec/internal/agent"
+	"weeklysec/internal/errcode"
+	"weeklysec/internal/llm"
+	"weeklysec/internal/store"
+	"weeklysec/internal/tenant"
+	"weeklysec/internal/trivy"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxFeedbackComment bounds the free text of feedback, in characters.
+const maxFeedbackComment = 4000
+
+// FeedbackRequest rates a scan's summary, one of its fixes or one of its
+// findings. A finding rated down is left out of later scans as noise.
+type FeedbackRequest struct {
+	Subject         string `json:"subject"`          // summary, fix or finding
+	PkgName         string `json:"pkg_name"`         // the fix rated, or the finding's package; empty rates the whole package or every package
+	VulnerabilityID string `json:"vulnerability_id"` // the finding rated
+	Rating          string `json:"rating"`           // up, down or empty
+	Comment         string `json:"comment"`
+}
+
+// Validate checks the request rates or comments on a known subject.
+func (r *FeedbackRequest) Validate() error {
+	r.Subject = strings.ToLower(strings.TrimSpace(r.Subject))
+	r.Rating = strings.ToLower(strings.TrimSpace(r.Rating))
+	r.Comment = strings.TrimSpace(r.Comment)
+	r.VulnerabilityID = strings.TrimSpace(r.VulnerabilityID)
+
+	switch {
+	case !slices.Contains(agent.FeedbackSubjects, r.Subject):
+		return fmt.Errorf("'subject' must be one of %s", strings.Join(agent.FeedbackSubjects, ", "))
+	case r.Subject == agent.FeedbackSummary && r.PkgName != "":
+		return fmt.Errorf("'pkg_name' only applies to fixes and findings")
+	case r.Subject == agent.FeedbackFinding && r.VulnerabilityID == "":
+		return fmt.Errorf("'vulnerability_id' is required for findings")
+	case r.Subject != agent.FeedbackFinding && r.VulnerabilityID != "":
+		return fmt.Errorf("'vulnerability_id' only applies to findings")
+	case r.Subject == agent.FeedbackFinding && r.Rating == "":
+		return fmt.Errorf("'rating' is required for findings")
+	case r.Rating != "" && r.Rating != agent.RatingUp && r.Rating != agent.RatingDown:
+		return fmt.Errorf("'rating' must be %s or %s", agent.RatingUp, agent.RatingDown)
+	case r.Rating == "" && r.Comment == "":
+		return fmt.Errorf("'rating' or 'comment' is required")
+	case utf8.RuneCountInString(r.Comment) > maxFeedbackComment:
+		return fmt.Errorf("'comment' must be at most %d characters", maxFeedbackComment)
+	}
+	return nil
+}
+
+// CreateFeedbackHandler records feedback on a scan's summary or fixes,
+// together with the prompt and answer that produced them.
+func (h *Handler) CreateFeedbackHandler(c *gin.Context) {
+	var req FeedbackRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		abortWithError(c, errcode.InvalidRequest, "Invalid request body", err.Error())
+		return
+	}
+	if err := req.Validate(); err != nil {
+		abortWithError(c, errcode.InvalidRequest, "Invalid request", err.Error())
+		return
+	}
+	scan, ok := h.loadScan(c)
+	if !ok {
+		return
+	}
+
+	fb := agent.Feedback{
+		ID:              store.NewID(),
+		Org:             scan.Org,
+		Project:         scan.Project,
+		ScanID:          scan.ID,
+		Target:          scan.Target,
+		Subject:         req.Subject,
+		PkgName:         req.PkgName,
+		VulnerabilityID: req.VulnerabilityID,
+		Rating:          req.Rating,
+		Comment:         req.Comment,
+		CreatedBy:       identity(c),
+		CreatedAt:       time.Now().UTC(),
+	}
+	resp := scan.Response
+	switch req.Subject {
+	case agent.FeedbackSummary:
+		if resp == nil || resp.Summary == "" {
+			abortWithError(c, errcode.InvalidRequest, "Invalid request", "the scan has no summary")
+			return
+		}
+		fb.Exchange = agent.ExchangeFor(scan.Exchanges, agent.StepSummarize)
+	case agent.FeedbackFix:
+		if resp == nil || resp.Remediation == nil || len(resp.Remediation.Fixes) == 0 {
+			abortWithError(c, errcode.InvalidRequest, "Invalid request", "the scan has no fixes")
+			return
+		}
+		if req.PkgName != "" {
+			for _, f := range resp.Remediation.Fixes {
+				if f.PkgName == req.PkgName {
+					fb.Fix = &f
+					break
+				}
+			}
+			if fb.Fix == nil {
+				abortWithError(c, errcode.InvalidRequest, "Invalid request", fmt.Sprintf("the scan has no fix for %q", req.PkgName))
+				return
+			}
+		}
+		fb.Exchange = agent.ExchangeFor(scan.Exchanges, agent.StepRemediation)
+	case agent.FeedbackFinding:
+		if resp == nil || !slices.ContainsFunc(resp.Vulnerabilities, func(v trivy.Vulnerability) bool {
+			return v.VulnerabilityID == req.VulnerabilityID && (req.PkgName == "" || v.PkgName == req.PkgName)
+		}) {
+			abortWithError(c, errcode.InvalidRequest, "Invalid request", fmt.Sprintf("the scan has no finding %s", req.VulnerabilityID))
+			return
+		}
+	}
+
+	if err := h.store.SaveFeedback(fb); err != nil {
+		abortWithErr(c, err, "Failed to save feedback")
+		return
+	}
+	h.audit(c, "feedback.create", nil, withoutExchange(fb))
+	c.JSON(http.StatusCreated, fb)
+}
+
+// ListScanFeedbackHandler lists the feedback on one scan.
+func (h *Handler) ListScanFeedbackHandler(c *gin.Context) {
+	scan, ok := h.loadScan(c)
+	if !ok {
+		return
+	}
+	h.listFeedback(c, store.FeedbackFilter{ScanID: scan.ID, Org: scan.Org, Project: scan.Project})
+}
+
+// ListFeedbackHandler lists the caller's feedback, optionally narrowed by
+// subject and rating.
+func (h *Handler) ListFeedbackHandler(c *gin.Context) {
+	f, ok := feedbackFilter(c)
+	if !ok {
+		return
+	}
+	h.listFeedback(c, f)
+}
+
+func (h *Handler) DeleteFeedbackHandler(c *gin.Context) {
+	fb, err := h.store.GetFeedback(c.Param("id"))
+	if err == nil && !tenant.FromContext(c.Request.Context()).Allows(fb.Org, fb.Project) {
+		err = store.ErrNotFound
+	}
+	if errors.Is(err, store.ErrNotFound) {
+		abortWithError(c, errcode.NotFound, "Feedback not found", nil)
+		return
+	}
+	if err := h.store.DeleteFeedback(fb.ID); err != nil {
+		abortWithErr(c, err, "Failed to delete feedback")
+		return
+	}
+	h.audit(c, "feedback.delete", withoutExchange(fb), nil)
+	c.Status(http.StatusNoContent)
+}
+
+// FeedbackExample is one line of the feedback export: the conversation in
+// the chat format fine-tuning APIs take, the answer last, and its rating.
+type FeedbackExample struct {
+	Messages   []llm.Message `json:"messages"`
+	Model      string        `json:"model,omitempty"`
+	Step       string        `json:"step"`
+	Subject    string        `json:"subject"`
+	PkgName    string        `json:"pkg_name,omitempty"`
+	Rating     string        `json:"rating,omitempty"`
+	Comment    string        `json:"comment,omitempty"`
+	FeedbackID string        `json:"feedback_id"`
+	ScanID     string        `json:"scan_id"`
+	CreatedAt  time.Time     `json:"created_at"`
+}
+
+// ExportFeedbackHandler streams the caller's feedback that has a prompt and
+// answer as JSON Lines, for prompt tuning or fine-tuning. It takes the
+// filters of ListFeedbackHandler; rating=up gives the examples to train on.
+func (h *Handler) ExportFeedbackHandler(c *gin.Context) {
+	f, ok := feedbackFilter(c)
+	if !ok {
+		return
+	}
+	feedback, err := h.store.ListFeedback(f)
+	if err != nil {
+		abortWithErr(c, err, "Failed to list feedback")
+		return
+	}
+	c.Header("Content-Type", "application/x-ndjson")
+	c.Header("Content-Disposition", `attachment; filename="feedback.jsonl"`)
+	c.Status(http.StatusOK)
+
+	enc := json.NewEncoder(c.Writer)
+	for _, fb := range feedback {
+		ex := fb.Exchange
+		if ex == nil {
+			continue
+		}
+		messages := append(append([]llm.Message{}, ex.Messages...), llm.Message{Role: "assistant", Content: ex.Response})
+		if err := enc.Encode(FeedbackExample{
+			Messages:   messages,
+			Model:      ex.Model,
+			Step:       ex.Step,
+			Subject:    fb.Subject,
+			PkgName:    fb.PkgName,
+			Rating:     fb.Rating,
+			Comment:    fb.Comment,
+			FeedbackID: fb.ID,
+			ScanID:     fb.ScanID,
+			CreatedAt:  fb.CreatedAt,
+		}); err != nil {
+			return
+		}
+	}
+}
+
+func (h *Handler) listFeedback(c *gin.Context, f store.FeedbackFilter) {
+	out, err := h.store.ListFeedback(f)
+	if err != nil {
+		abortWithErr(c, err, "Failed to list feedback")
+		return
+	}
+	if out == nil {
+		out = []agent.Feedback{}
+	}
+	c.JSON(http.StatusOK, gin.H{"feedback": out})
+}
+
+func feedbackFilter(c *gin.Context) (store.FeedbackFilter, bool) {
+	t := tenant.FromContext(c.Request.Context())
+	f := store.FeedbackFilter{
+		Org:     t.Org,
+		Project: t.Project,
+		Subject: c.Query("subject"),
+		Rating:  c.Query("rating"),
+	}
+	if f.Subject != "" && !slices.Contains(agent.FeedbackSubjects, f.Subject) {
+		abortWithError(c, errcode.InvalidRequest, "Invalid request", fmt.Sprintf("'subject' must be one of %s", strings.Join(agent.FeedbackSubjects, ", ")))
+		return f, false
+	}
+	if f.Rating != "" && f.Rating != agent.RatingUp && f.Rating != agent.RatingDown {
+		abortWithError(c, errcode.InvalidRequest, "Invalid request", fmt.Sprintf("'rating' must be %s or %s", agent.RatingUp, agent.RatingDown))
+		return f, false
+	}
+	return f, true
+}
+
+// triageHistory collects what the team of org and project decided on
+// findings within the triage window: findings rated through feedback, and
+// not-affected suppressions that have lapsed. Lapsed accepted-risk rules
+// are left out, since their expiry asks for the finding to be looked at
+// again.
+func (h *Handler) triageHistory(org, project string) ([]agent.TriageDecision, error) {
+	if h.cfg.TriageWindow <= 0 {
+		return nil, nil
+	}
+	now := time.Now()
+	since := now.Add(-h.cfg.TriageWindow)
+	rules, err := h.store.ListSuppressions(org, project, true)
+	if err != nil {
+		return nil, err
+	}
+	feedback, err := h.store.ListFeedback(store.FeedbackFilter{Org: org, Project: project, Subject: agent.FeedbackFinding})
+	if err != nil {
+		return nil, err
+	}
+
+	var out []agent.TriageDecision
+	for _, rule := range rules {
+		if rule.VEXJustification == "" || rule.Active(now) || rule.ExpiresAt.Before(since) {
+			continue
+		}
+		out = append(out, agent.TriageDecision{
+			VulnerabilityID: rule.VulnerabilityID,
+			PkgName:         rule.Package,
+			Target:          rule.Target,
+			Noise:           true,
+			Source:          agent.TriageSuppression,
+			Reason:          rule.VEXJustification,
+			At:              *rule.ExpiresAt,
+		})
+	}
+	for _, fb := range feedback {
+		if fb.CreatedAt.Before(since) || fb.Rating == "" {
+			continue
+		}
+		out = append(out, agent.TriageDecision{
+			VulnerabilityID: fb.VulnerabilityID,
+			PkgName:         fb.PkgName,
+			Target:          fb.Target,
+			Noise:           fb.Rating == agent.RatingDown,
+			Source:          agent.TriageFeedback,
+			Reason:          fb.Comment,
+			At:              fb.CreatedAt,
+		})
+	}
+	return out, nil
+}
+
+// withoutExchange leaves the prompt out of audit records.
+func withoutExchange(fb agent.Feedback) agent.Feedback {
+	fb.Exchange = nil
+	return fb
+}
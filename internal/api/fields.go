@@ -0,0 +1,99 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"weeklysec/internal/agent"
+	"weeklysec/internal/errcode"
+
+	"github.com/gin-gonic/gin"
+)
+
+// responseFields are the top-level JSON keys of an AgentResponse, used to
+// reject field selections that can never match.
+var responseFields = jsonFields(reflect.TypeOf(agent.AgentResponse{}))
+
+// selectedFields returns the dotted paths requested through the `fields`
+// (or `include`) query parameter, e.g. fields=remediation,analysis.by_severity.
+// It writes a 400 and returns false when a path names an unknown field.
+func selectedFields(c *gin.Context) ([]string, bool) {
+	raw := c.Query("fields")
+	if raw == "" {
+		raw = c.Query("include")
+	}
+	if raw == "" {
+		return nil, true
+	}
+
+	var paths []string
+	for _, p := range strings.Split(raw, ",") {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+		top, _, _ := strings.Cut(p, ".")
+		if !responseFields[top] {
+			abortWithError(c, errcode.InvalidRequest, "Invalid request", fmt.Sprintf("unknown field %q", top))
+			return nil, false
+		}
+		paths = append(paths, p)
+	}
+	return paths, true
+}
+
+// shapeResponse trims resp down to the given paths. Paths that are absent
+// from this particular response are left out rather than reported as null.
+func shapeResponse(resp *agent.AgentResponse, paths []string) (map[string]any, error) {
+	b, err := json.Marshal(resp)
+	if err != nil {
+		return nil, err
+	}
+	var full map[string]any
+	if err := json.Unmarshal(b, &full); err != nil {
+		return nil, err
+	}
+
+	out := map[string]any{}
+	for _, p := range paths {
+		copyPath(out, full, strings.Split(p, "."))
+	}
+	return out, nil
+}
+
+// copyPath copies the value at keys from src into dst, creating the
+// intermediate objects it needs.
+func copyPath(dst, src map[string]any, keys []string) {
+	v, ok := src[keys[0]]
+	if !ok {
+		return
+	}
+	if len(keys) == 1 {
+		dst[keys[0]] = v
+		return
+	}
+	child, ok := v.(map[string]any)
+	if !ok {
+		return
+	}
+	next, ok := dst[keys[0]].(map[string]any)
+	if !ok {
+		next = map[string]any{}
+	}
+	copyPath(next, child, keys[1:])
+	if len(next) > 0 {
+		dst[keys[0]] = next
+	}
+}
+
+func jsonFields(t reflect.Type) map[string]bool {
+	fields := map[string]bool{}
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if name != "" && name != "-" {
+			fields[name] = true
+		}
+	}
+	return fields
+}
@@ -0,0 +1,364 @@
+package api
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"weeklysec/internal/digest"
+	"weeklysec/internal/errcode"
+	"weeklysec/internal/mttr"
+	"weeklysec/internal/report"
+	"weeklysec/internal/store"
+	"weeklysec/internal/tenant"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog"
+)
+
+// FindingUpdateRequest is the body accepted by PATCH /api/v1/findings/:id.
+type FindingUpdateRequest struct {
+	State string `json:"state"`
+	Note  string `json:"note"`
+}
+
+// Validate only allows the states people set; the rest follow from scans.
+func (r *FindingUpdateRequest) Validate() error {
+	r.State = strings.ToLower(strings.TrimSpace(r.State))
+	if !slices.Contains(store.ManualStates, r.State) {
+		return fmt.Errorf("'state' must be one of %s", strings.Join(store.ManualStates, ", "))
+	}
+	return nil
+}
+
+// ListFindingsHandler lists tracked findings. Query parameters: state,
+// target, severity, open=true and limit.
+func (h *Handler) ListFindingsHandler(c *gin.Context) {
+	t := tenant.FromContext(c.Request.Context())
+	findings, err := h.store.ListFindings(store.FindingFilter{
+		Org:      t.Org,
+		Project:  t.Project,
+		Target:   c.Query("target"),
+		State:    strings.ToLower(c.Query("state")),
+		Severity: strings.ToUpper(c.Query("severity")),
+		OpenOnly: c.Query("open") == "true",
+	})
+	if err != nil {
+		abortWithErr(c, err, "Failed to list findings")
+		return
+	}
+	if limit, err := strconv.Atoi(c.Query("limit")); err == nil && limit > 0 && len(findings) > limit {
+		findings = findings[:limit]
+	}
+	if findings == nil {
+		findings = []store.Finding{}
+	}
+	c.JSON(http.StatusOK, gin.H{"findings": findings})
+}
+
+// xlsxContentType is the media type of Excel workbooks.
+const xlsxContentType = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+
+// ExportFindingsHandler downloads the caller's findings as an Excel
+// workbook, with the fixes recommended by the latest scans and the SLA
+// status of what is open. With format=ndjson it streams them instead as
+// JSON Lines, one flattened finding per line, for SIEMs. It takes the
+// filters of ListFindingsHandler and lang for the sheet names and headers.
+func (h *Handler) ExportFindingsHandler(c *gin.Context) {
+	format := cmp.Or(c.Query("format"), "xlsx")
+	if format != "xlsx" && format != "ndjson" {
+		abortWithError(c, errcode.InvalidRequest, "Invalid request", "'format' must be xlsx or ndjson")
+		return
+	}
+	t := tenant.FromContext(c.Request.Context())
+	target := c.Query("target")
+	filter := store.FindingFilter{
+		Org:      t.Org,
+		Project:  t.Project,
+		Target:   target,
+		State:    strings.ToLower(c.Query("state")),
+		Severity: strings.ToUpper(c.Query("severity")),
+		OpenOnly: c.Query("open") == "true",
+	}
+	scans, err := h.store.ListScans(store.ScanFilter{Org: t.Org, Project: t.Project, Target: target, LatestOnly: true})
+	if err != nil {
+		abortWithErr(c, err, "Failed to list scans")
+		return
+	}
+	teams, err := h.teamsByTarget(t.Org, t.Project)
+	if err != nil {
+		abortWithErr(c, err, "Failed to list targets")
+		return
+	}
+
+	now := time.Now().UTC()
+	if format == "ndjson" {
+		h.streamFindingLines(c, filter, report.LineContext{GeneratedAt: now, Scans: scans, Teams: teams, SLA: h.cfg.SLA()})
+		return
+	}
+
+	findings, err := h.store.ListFindings(filter)
+	if err != nil {
+		abortWithErr(c, err, "Failed to list findings")
+		return
+	}
+	w := &report.Workbook{
+		Scope:       cmp.Or(target, t.Org+"/"+t.Project),
+		GeneratedAt: now,
+		Findings:    findings,
+		Scans:       scans,
+		Teams:       teams,
+		SLA:         h.cfg.SLA(),
+	}
+	l := negotiateLocale(c)
+	data, err := report.FindingsXLSX(w, l)
+	if err != nil {
+		abortWithErr(c, err, "Failed to build workbook")
+		return
+	}
+	c.Header("Content-Language", l.Lang())
+	c.Header("Content-Disposition", `attachment; filename="findings-`+now.Format("2006-01-02")+`.xlsx"`)
+	c.Data(http.StatusOK, xlsxContentType, data)
+}
+
+// streamFindingLines writes the findings matching f as JSON Lines as they
+// are read from the store. Once the first line is out the status cannot
+// change, so a later read error is logged and cuts the export short.
+func (h *Handler) streamFindingLines(c *gin.Context, f store.FindingFilter, lc report.LineContext) {
+	lw := report.NewLineWriter(c.Writer, lc)
+	started := false
+	start := func() {
+		if started {
+			return
+		}
+		started = true
+		c.Header("Content-Type", "application/x-ndjson")
+		c.Header("Content-Disposition", `attachment; filename="findings-`+lc.GeneratedAt.Format("2006-01-02")+`.jsonl"`)
+		c.Status(http.StatusOK)
+	}
+	err := h.store.EachFinding(f, func(fd store.Finding) error {
+		start()
+		return lw.Write(fd)
+	})
+	switch {
+	case err != nil && !started:
+		abortWithErr(c, err, "Failed to list findings")
+		return
+	case err != nil:
+		// Either the client went away or the store failed mid-export.
+		zerolog.Ctx(c.Request.Context()).Warn().Err(err).Msg("Findings export cut short")
+		return
+	}
+	start()
+	lw.Flush()
+}
+
+func (h *Handler) GetFindingHandler(c *gin.Context) {
+	f, ok := h.loadFinding(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, f)
+}
+
+// UpdateFindingHandler acknowledges a finding or marks its fix in progress.
+func (h *Handler) UpdateFindingHandler(c *gin.Context) {
+	f, ok := h.loadFinding(c)
+	if !ok {
+		return
+	}
+
+	var req FindingUpdateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		abortWithError(c, errcode.InvalidRequest, "Invalid request body", err.Error())
+		return
+	}
+	if err := req.Validate(); err != nil {
+		abortWithError(c, errcode.InvalidRequest, "Invalid request", err.Error())
+		return
+	}
+	if !f.Open() {
+		abortWithError(c, errcode.Conflict, "Finding is already fixed", nil)
+		return
+	}
+
+	f.Transition(req.State, time.Now().UTC(), identity(c), strings.TrimSpace(req.Note), "")
+	if err := h.store.SaveFinding(f); err != nil {
+		abortWithErr(c, err, "Failed to save finding")
+		return
+	}
+	c.JSON(http.StatusOK, f)
+}
+
+// FindingStatsHandler reports findings by state, mean time to remediate
+// over their whole history, as mttr computes it, and the regressions
+// currently open.
+func (h *Handler) FindingStatsHandler(c *gin.Context) {
+	t := tenant.FromContext(c.Request.Context())
+	findings, err := h.store.ListFindings(store.FindingFilter{Org: t.Org, Project: t.Project, Target: c.Query("target")})
+	if err != nil {
+		abortWithErr(c, err, "Failed to list findings")
+		return
+	}
+
+	byState := map[string]int{}
+	regressions := []store.Finding{}
+	for _, f := range findings {
+		byState[f.State]++
+		if f.State == store.StateReopened {
+			regressions = append(regressions, f)
+		}
+	}
+
+	r := mttr.Compute(findings, nil, time.Time{}, time.Now().UTC())
+	bySeverity := map[string]float64{}
+	for sev, s := range r.BySeverity {
+		bySeverity[sev] = s.MeanDays
+	}
+	var overall any
+	if r.Overall.Fixed > 0 {
+		overall = r.Overall.MeanDays
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"total":            len(findings),
+		"by_state":         byState,
+		"fixed":            r.Overall.Fixed,
+		"mttr_days":        overall,
+		"mttr_by_severity": bySeverity,
+		"regressions":      regressions,
+	})
+}
+
+// MTTRHandler reports the mean and percentile time to remediate the
+// caller's findings, overall and by severity, team and target. Query
+// parameters: since and until (RFC 3339, default the last 90 days) bound
+// when the fixes were made, and target, team and severity narrow the
+// findings considered.
+func (h *Handler) MTTRHandler(c *gin.Context) {
+	until := time.Now().UTC()
+	since := until.Add(-mttr.DefaultWindow)
+	var err error
+	if v := c.Query("since"); v != "" {
+		if since, err = time.Parse(time.RFC3339, v); err != nil {
+			abortWithError(c, errcode.InvalidRequest, "Invalid request", "'since' must be an RFC 3339 timestamp")
+			return
+		}
+	}
+	if v := c.Query("until"); v != "" {
+		if until, err = time.Parse(time.RFC3339, v); err != nil {
+			abortWithError(c, errcode.InvalidRequest, "Invalid request", "'until' must be an RFC 3339 timestamp")
+			return
+		}
+	}
+	if !since.Before(until) {
+		abortWithError(c, errcode.InvalidRequest, "Invalid request", "'since' must be before 'until'")
+		return
+	}
+
+	t := tenant.FromContext(c.Request.Context())
+	findings, err := h.store.ListFindings(store.FindingFilter{
+		Org:      t.Org,
+		Project:  t.Project,
+		Target:   c.Query("target"),
+		Severity: strings.ToUpper(c.Query("severity")),
+	})
+	if err != nil {
+		abortWithErr(c, err, "Failed to list findings")
+		return
+	}
+	teams, err := h.teamsByTarget(t.Org, t.Project)
+	if err != nil {
+		abortWithErr(c, err, "Failed to list targets")
+		return
+	}
+	if team := c.Query("team"); team != "" {
+		findings = slices.DeleteFunc(findings, func(f store.Finding) bool {
+			return cmp.Or(teams[f.TargetID], digest.Unassigned) != team
+		})
+	}
+	c.JSON(http.StatusOK, mttr.Compute(findings, teams, since, until))
+}
+
+// teamsByTarget maps the IDs of the targets of org and project to their
+// owning team, set on the target or by its owner label.
+func (h *Handler) teamsByTarget(org, project string) (map[string]string, error) {
+	targets, err := h.store.ListTargets(store.TargetFilter{Org: org, Project: project})
+	if err != nil {
+		return nil, err
+	}
+	teams := map[string]string{}
+	for _, tg := range targets {
+		teams[tg.ID] = cmp.Or(tg.Team, tg.Labels[h.cfg.OwnerLabel])
+	}
+	return teams, nil
+}
+
+// writeMTTRMetrics writes the time to remediate the findings fixed in the
+// last mttr.DefaultWindow as Prometheus summaries, for each org and project
+// by severity and by team.
+func (h *Handler) writeMTTRMetrics(b *strings.Builder) error {
+	findings, err := h.store.ListFindings(store.FindingFilter{})
+	if err != nil {
+		return err
+	}
+	type scope struct{ org, project string }
+	byScope := map[scope][]store.Finding{}
+	for _, f := range findings {
+		k := scope{f.Org, f.Project}
+		byScope[k] = append(byScope[k], f)
+	}
+	scopes := slices.SortedFunc(maps.Keys(byScope), func(a, b scope) int {
+		return cmp.Or(cmp.Compare(a.org, b.org), cmp.Compare(a.project, b.project))
+	})
+	teams, err := h.teamsByTarget("", "")
+	if err != nil {
+		return err
+	}
+
+	until := time.Now().UTC()
+	reports := make([]*mttr.Report, len(scopes))
+	for i, k := range scopes {
+		reports[i] = mttr.Compute(byScope[k], teams, until.Add(-mttr.DefaultWindow), until)
+	}
+	summary := func(name, help, label string, groups func(*mttr.Report) map[string]*mttr.Stats) {
+		fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s summary\n", name, help, name)
+		for i, k := range scopes {
+			m := groups(reports[i])
+			for _, key := range slices.Sorted(maps.Keys(m)) {
+				s := m[key]
+				labels := fmt.Sprintf("org=%q,project=%q,%s=%q", k.org, k.project, label, key)
+				for _, q := range mttr.Quantiles {
+					fmt.Fprintf(b, "%s{%s,quantile=\"%g\"} %g\n", name, labels, q, s.Quantile(q))
+				}
+				fmt.Fprintf(b, "%s_sum{%s} %g\n%s_count{%s} %d\n", name, labels, s.Sum(), name, labels, s.Fixed)
+			}
+		}
+	}
+	summary("weeklysec_remediation_days", "Days to remediate the findings fixed in the last 90 days, by severity.", "severity",
+		func(r *mttr.Report) map[string]*mttr.Stats { return r.BySeverity })
+	summary("weeklysec_remediation_days_by_team", "Days to remediate the findings fixed in the last 90 days, by team.", "team",
+		func(r *mttr.Report) map[string]*mttr.Stats { return r.ByTeam })
+	return nil
+}
+
+func (h *Handler) loadFinding(c *gin.Context) (store.Finding, bool) {
+	f, err := h.store.GetFinding(c.Param("id"))
+	if err == nil && !tenant.FromContext(c.Request.Context()).Allows(f.Org, f.Project) {
+		err = store.ErrNotFound
+	}
+	if errors.Is(err, store.ErrNotFound) {
+		abortWithError(c, errcode.NotFound, "Finding not found", nil)
+		return f, false
+	}
+	if err != nil {
+		abortWithErr(c, err, "Failed to load finding")
+		return f, false
+	}
+	return f, true
+}
@@ -0,0 +1,115 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"time"
+	"weeklysec/internal/errcode"
+	"weeklysec/internal/failure"
+	"weeklysec/internal/freshness"
+	"weeklysec/internal/store"
+	"weeklysec/internal/tenant"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+// StaleTargetsHandler lists the caller's registered targets not scanned
+// successfully within the freshness SLO and groups them by why. Query
+// parameters: slo (a duration, default FRESHNESS_SLO) and the filters of
+// ListTargetsHandler.
+func (h *Handler) StaleTargetsHandler(c *gin.Context) {
+	slo := h.cfg.FreshnessSLO
+	if v := c.Query("slo"); v != "" {
+		var err error
+		if slo, err = time.ParseDuration(v); err != nil {
+			abortWithError(c, errcode.InvalidRequest, "Invalid request", "'slo' must be a duration such as 336h")
+			return
+		}
+	}
+	if slo <= 0 {
+		abortWithError(c, errcode.InvalidRequest, "Invalid request", "'slo' must be positive")
+		return
+	}
+	f, ok := targetFilter(c, selectorFromQuery(c))
+	if !ok {
+		return
+	}
+	r, err := h.staleTargets(f, slo)
+	if err != nil {
+		abortWithErr(c, err, "Failed to load scans")
+		return
+	}
+	c.JSON(http.StatusOK, r)
+}
+
+// CheckFreshness announces the stale targets of every org with any to the
+// chat notifiers. It is run by the scheduler.
+func (h *Handler) CheckFreshness(ctx context.Context) {
+	if h.cfg.FreshnessSLO <= 0 {
+		return
+	}
+	logger := zerolog.Ctx(ctx)
+	targets, err := h.store.ListTargets(store.TargetFilter{})
+	if err != nil {
+		logger.Error().Err(err).Msg("Failed to list targets to check freshness")
+		return
+	}
+	orgs := map[string]bool{}
+	for _, t := range targets {
+		orgs[t.Org] = true
+	}
+	for org := range orgs {
+		r, err := h.staleTargets(store.TargetFilter{Org: org, Project: tenant.AllProjects}, h.cfg.FreshnessSLO)
+		if err != nil {
+			logger.Error().Err(err).Str("org", org).Msg("Failed to check target freshness")
+			continue
+		}
+		if len(r.Stale) == 0 {
+			continue
+		}
+		logger.Warn().Str("org", org).Int("stale", len(r.Stale)).Int("targets", r.Checked).Msg("Targets are stale")
+		h.notify.Stale(ctx, r)
+	}
+}
+
+// staleTargets checks the freshness of the targets matching f.
+func (h *Handler) staleTargets(f store.TargetFilter, slo time.Duration) (*freshness.Report, error) {
+	scans, err := h.store.ListScans(store.ScanFilter{Org: f.Org, Project: f.Project, LatestOnly: true})
+	if err != nil {
+		return nil, err
+	}
+	lastScans := map[string]time.Time{}
+	for _, s := range scans {
+		if s.TargetID != "" {
+			lastScans[s.TargetID] = s.CreatedAt
+		}
+	}
+	targets, err := h.ownedTargets(f)
+	if err != nil {
+		return nil, err
+	}
+	statuses, err := h.store.ScanStatuses()
+	if err != nil {
+		return nil, err
+	}
+	r := freshness.Check(targets, statuses, lastScans, slo, time.Now().UTC())
+	r.Org = f.Org
+	return r, nil
+}
+
+// recordAttempt notes how a scan of a registered target went, for its
+// freshness and failure triage. err is the scan failure, if any.
+func (h *Handler) recordAttempt(targetID string, err error) {
+	if targetID == "" {
+		return
+	}
+	var f *store.ScanFailure
+	if err != nil {
+		f = &store.ScanFailure{Code: string(errcode.Of(err)), Class: failure.Of(err), Error: err.Error()}
+	}
+	if err := h.store.RecordScanAttempt(targetID, time.Now().UTC(), f); err != nil {
+		log.Error().Err(err).Str("target_id", targetID).Msg("Failed to record scan attempt")
+	}
+}
@@ -0,0 +1,255 @@
+package api
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+	"weeklysec/internal/agent"
+	"weeklysec/internal/errcode"
+	"weeklysec/internal/gate"
+	"weeklysec/internal/github"
+	"weeklysec/internal/store"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog"
+)
+
+// VerdictHeader carries "pass" or "fail" on gate responses, so scripts can
+// branch on it whatever the body format.
+const VerdictHeader = "X-Weeklysec-Verdict"
+
+// GateRequest scans a target and judges it for CI.
+type GateRequest struct {
+	ScanRequest
+
+	// The baseline is the given scan, else the latest scan of
+	// BaselineTarget, else the latest earlier scan of the target itself.
+	BaselineScanID string `json:"baseline_scan_id"`
+	BaselineTarget string `json:"baseline_target"`
+
+	Policy     *gate.Policy     `json:"policy"`     // defaults to the GATE_* settings
+	Dockerfile *GateDockerfile  `json:"dockerfile"` // annotated with the failing findings
+	CheckRun   *CheckRunRequest `json:"check_run"`  // publishes the verdict on a commit
+}
+
+// GateDockerfile is the Dockerfile the image was built from.
+type GateDockerfile struct {
+	Path    string `json:"path"`    // relative to the repository root
+	Content string `json:"content"` // read from check_run's commit when empty
+}
+
+// CheckRunRequest asks for a GitHub check run on a commit.
+type CheckRunRequest struct {
+	Repo    string `json:"repo"` // owner/name
+	HeadSHA string `json:"head_sha"`
+	Name    string `json:"name"`  // defaults to GATE_CHECK_NAME
+	Token   string `json:"token"` // defaults to GITHUB_TOKEN where GITHUB_TOKEN_REPOS grants it; needs checks:write
+}
+
+// GateResponse is the verdict with the outcome of publishing it.
+type GateResponse struct {
+	*gate.Verdict
+	CheckRun      *github.CreatedCheckRun `json:"check_run,omitempty"`
+	CheckRunError string                  `json:"check_run_error,omitempty"`
+}
+
+// validate checks the gate-specific fields.
+func (r *GateRequest) validate() error {
+	if r.Policy != nil {
+		if err := r.Policy.Validate(); err != nil {
+			return fmt.Errorf("'policy' is invalid: %v", err)
+		}
+	}
+	if cr := r.CheckRun; cr != nil {
+		if err := github.ValidateRepo(cr.Repo); err != nil {
+			return fmt.Errorf("'check_run.repo' is invalid: %v", err)
+		}
+		if strings.TrimSpace(cr.HeadSHA) == "" {
+			return fmt.Errorf("'check_run.head_sha' is required")
+		}
+	}
+	if d := r.Dockerfile; d != nil {
+		d.Path = path.Clean(strings.TrimPrefix(strings.TrimSpace(d.Path), "/"))
+		if d.Path == "." || d.Path == ".." || strings.HasPrefix(d.Path, "../") {
+			return fmt.Errorf("'dockerfile.path' must be relative to the repository root")
+		}
+		if d.Content == "" && r.CheckRun == nil {
+			return fmt.Errorf("'dockerfile.content' is required without 'check_run'")
+		}
+	}
+	return nil
+}
+
+// GateHandler scans a target and answers with a pass/fail verdict against
+// the gate policy: JSON by default, the job summary as Markdown, or GitHub
+// workflow commands as text. The verdict is also in VerdictHeader. A
+// failed scan is an error, not a failing verdict.
+func (h *Handler) GateHandler(c *gin.Context) {
+	format, ok := negotiateFormat(c)
+	if !ok {
+		return
+	}
+	var req GateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			abortWithError(c, errcode.RequestTooLarge, "Request body too large", gin.H{"max_bytes": maxErr.Limit})
+			return
+		}
+		abortWithError(c, errcode.InvalidRequest, "Invalid request body", err.Error())
+		return
+	}
+	if !h.prepareScanRequest(c, &req.ScanRequest) {
+		return
+	}
+	if err := req.validate(); err != nil {
+		abortWithError(c, errcode.InvalidRequest, "Invalid request", err.Error())
+		return
+	}
+	if cr := req.CheckRun; cr != nil {
+		token, err := h.githubToken(cr.Token, cr.Repo, req.tenant)
+		if err != nil {
+			abortWithErr(c, err, "Invalid request")
+			return
+		}
+		cr.Token = token
+	}
+	policy := h.gatePolicy()
+	if req.Policy != nil {
+		policy = *req.Policy
+	}
+
+	// Pick the baseline before scanning, so the new scan is not its own.
+	ctx := c.Request.Context()
+	baseline, err := h.gateBaseline(req)
+	if err != nil {
+		abortWithErr(c, err, "Baseline scan not found")
+		return
+	}
+
+	resp, scan, err := h.runAgent(ctx, req.ScanRequest, agent.Request{
+		TargetType:  req.TargetType,
+		Target:      req.Target,
+		Remediation: true,
+		Explain:     req.Explain,
+	})
+	if err != nil {
+		abortWithRun(c, format, resp, "Scan failed")
+		return
+	}
+
+	verdict := gate.Evaluate(scan, baseline, policy)
+	out := GateResponse{Verdict: verdict}
+	if req.Dockerfile != nil {
+		h.annotateDockerfile(ctx, verdict, scan, req)
+	}
+	if req.CheckRun != nil {
+		out.CheckRun, err = h.publishCheckRun(ctx, verdict, *req.CheckRun)
+		if err != nil {
+			zerolog.Ctx(ctx).Warn().Err(err).Str("repo", req.CheckRun.Repo).Msg("Failed to publish check run")
+			out.CheckRunError = err.Error()
+		}
+	}
+
+	if verdict.Pass {
+		c.Header(VerdictHeader, "pass")
+	} else {
+		c.Header(VerdictHeader, "fail")
+	}
+	switch format {
+	case formatText:
+		c.String(http.StatusOK, gate.WorkflowCommands(verdict))
+	case formatMarkdown:
+		c.Data(http.StatusOK, "text/markdown; charset=utf-8", []byte(gate.Markdown(verdict)))
+	default:
+		c.JSON(http.StatusOK, out)
+	}
+}
+
+// gatePolicy returns the configured default policy.
+func (h *Handler) gatePolicy() gate.Policy {
+	return gate.Policy{
+		FailOn:       h.cfg.GateFailOn,
+		NewOnly:      h.cfg.GateNewOnly,
+		MaxRiskScore: h.cfg.GateMaxRiskScore,
+	}
+}
+
+// gateBaseline finds the scan a gate compares against, or nil when the
+// target has never been scanned.
+func (h *Handler) gateBaseline(req GateRequest) (*store.Scan, error) {
+	if req.BaselineScanID != "" {
+		scan, err := h.store.GetScan(req.BaselineScanID)
+		if err == nil && !req.tenant.Allows(scan.Org, scan.Project) {
+			err = store.ErrNotFound
+		}
+		if errors.Is(err, store.ErrNotFound) {
+			err = errcode.Wrap(errcode.NotFound, fmt.Errorf("scan %s not found", req.BaselineScanID))
+		}
+		return scan, err
+	}
+	target := req.BaselineTarget
+	if target == "" {
+		target = req.Target
+	}
+	scans, err := h.store.ListScans(store.ScanFilter{Org: req.tenant.Org, Project: req.tenant.Project, Target: target})
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range scans {
+		if s.TargetType == req.TargetType {
+			return s, nil
+		}
+	}
+	return nil, nil
+}
+
+// annotateDockerfile adds annotations for the failing findings. A
+// Dockerfile that cannot be read leaves the verdict without them.
+func (h *Handler) annotateDockerfile(ctx context.Context, v *gate.Verdict, scan *store.Scan, req GateRequest) {
+	content := req.Dockerfile.Content
+	if content == "" {
+		cr := req.CheckRun
+		b, err := github.New(h.cfg.GitHubAPIURL, cr.Token).GetFile(ctx, cr.Repo, req.Dockerfile.Path, cr.HeadSHA)
+		if err != nil {
+			zerolog.Ctx(ctx).Warn().Err(err).Str("path", req.Dockerfile.Path).Msg("Failed to read Dockerfile for annotations")
+			return
+		}
+		content = string(b)
+	}
+	var fixes []agent.Fix
+	if scan.Response != nil && scan.Response.Remediation != nil {
+		fixes = scan.Response.Remediation.Fixes
+	}
+	v.Annotations = gate.Annotate(req.Dockerfile.Path, content, v.Failing, fixes)
+}
+
+// publishCheckRun posts the verdict as a completed check run.
+func (h *Handler) publishCheckRun(ctx context.Context, v *gate.Verdict, req CheckRunRequest) (*github.CreatedCheckRun, error) {
+	run := github.CheckRun{
+		Name:       cmp.Or(req.Name, h.cfg.GateCheckName),
+		HeadSHA:    strings.TrimSpace(req.HeadSHA),
+		Conclusion: "success",
+		Title:      fmt.Sprintf("Passed, risk score %.1f", v.RiskScore),
+		Summary:    gate.Markdown(v),
+	}
+	if !v.Pass {
+		run.Conclusion = "failure"
+		run.Title = "Failed: " + strings.Join(v.Reasons, "; ")
+	}
+	for _, a := range v.Annotations {
+		run.Annotations = append(run.Annotations, github.CheckAnnotation{
+			Path:      a.Path,
+			StartLine: a.StartLine,
+			EndLine:   a.EndLine,
+			Level:     a.Level,
+			Title:     a.Title,
+			Message:   a.Message,
+		})
+	}
+	return github.New(h.cfg.GitHubAPIURL, req.Token).CreateCheckRun(ctx, req.Repo, run)
+}
@@ -0,0 +1,283 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+	"weeklysec/internal/errcode"
+	"weeklysec/internal/store"
+	"weeklysec/internal/tenant"
+	"weeklysec/internal/trivy"
+
+	"github.com/gin-gonic/gin"
+	"github.com/graphql-go/graphql"
+)
+
+// finding is a vulnerability annotated with the scan it was found in.
+type finding struct {
+	trivy.Vulnerability
+	Scan *store.Scan
+}
+
+var severityCountsType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "SeverityCounts",
+	Fields: graphql.Fields{
+		"critical": &graphql.Field{Type: graphql.Int},
+		"high":     &graphql.Field{Type: graphql.Int},
+		"medium":   &graphql.Field{Type: graphql.Int},
+		"low":      &graphql.Field{Type: graphql.Int},
+		"unknown":  &graphql.Field{Type: graphql.Int},
+	},
+})
+
+func newGraphQLSchema(st *store.Store) (graphql.Schema, error) {
+	findingType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Finding",
+		Fields: graphql.Fields{
+			"scanId":           &graphql.Field{Type: graphql.String, Resolve: findingField(func(f finding) any { return f.Scan.ID })},
+			"target":           &graphql.Field{Type: graphql.String, Resolve: findingField(func(f finding) any { return f.Scan.Target })},
+			"targetType":       &graphql.Field{Type: graphql.String, Resolve: findingField(func(f finding) any { return f.Scan.TargetType })},
+			"scannedAt":        &graphql.Field{Type: graphql.DateTime, Resolve: findingField(func(f finding) any { return f.Scan.CreatedAt })},
+			"vulnerabilityId":  &graphql.Field{Type: graphql.String, Resolve: findingField(func(f finding) any { return f.VulnerabilityID })},
+			"pkgName":          &graphql.Field{Type: graphql.String, Resolve: findingField(func(f finding) any { return f.PkgName })},
+			"installedVersion": &graphql.Field{Type: graphql.String, Resolve: findingField(func(f finding) any { return f.InstalledVersion })},
+			"fixedVersion":     &graphql.Field{Type: graphql.String, Resolve: findingField(func(f finding) any { return f.FixedVersion })},
+			"severity":         &graphql.Field{Type: graphql.String, Resolve: findingField(func(f finding) any { return f.Severity })},
+			"title":            &graphql.Field{Type: graphql.String, Resolve: findingField(func(f finding) any { return f.Title })},
+			"description":      &graphql.Field{Type: graphql.String, Resolve: findingField(func(f finding) any { return f.Description })},
+			"primaryUrl":       &graphql.Field{Type: graphql.String, Resolve: findingField(func(f finding) any { return f.PrimaryURL })},
+			"cvssScore":        &graphql.Field{Type: graphql.Float, Resolve: findingField(func(f finding) any { return f.Score() })},
+		},
+	})
+
+	findingArgs := graphql.FieldConfigArgument{
+		"severity": &graphql.ArgumentConfig{Type: graphql.NewList(graphql.String)},
+		"limit":    &graphql.ArgumentConfig{Type: graphql.Int},
+	}
+
+	scanType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Scan",
+		Fields: graphql.Fields{
+			"id":         &graphql.Field{Type: graphql.NewNonNull(graphql.ID), Resolve: scanField(func(s *store.Scan) any { return s.ID })},
+			"targetType": &graphql.Field{Type: graphql.String, Resolve: scanField(func(s *store.Scan) any { return s.TargetType })},
+			"target":     &graphql.Field{Type: graphql.String, Resolve: scanField(func(s *store.Scan) any { return s.Target })},
+			"createdAt":  &graphql.Field{Type: graphql.DateTime, Resolve: scanField(func(s *store.Scan) any { return s.CreatedAt })},
+			"summary":    &graphql.Field{Type: graphql.String, Resolve: scanField(func(s *store.Scan) any { return s.Summary })},
+			"riskScore": &graphql.Field{Type: graphql.Float, Resolve: scanField(func(s *store.Scan) any {
+				if s.Response == nil || s.Response.Analysis == nil {
+					return nil
+				}
+				return s.Response.Analysis.RiskScore
+			})},
+			"findingCount": &graphql.Field{Type: graphql.Int, Resolve: scanField(func(s *store.Scan) any {
+				return len(s.Vulnerabilities)
+			})},
+			"severityCounts": &graphql.Field{Type: severityCountsType, Resolve: scanField(func(s *store.Scan) any {
+				return severityCounts(s.Vulnerabilities)
+			})},
+			"findings": &graphql.Field{
+				Type: graphql.NewList(findingType),
+				Args: findingArgs,
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					scan := p.Source.(*store.Scan)
+					return filterFindings(findingsOf([]*store.Scan{scan}), p.Args), nil
+				},
+			},
+		},
+	})
+
+	scanListArgs := graphql.FieldConfigArgument{
+		"target":     &graphql.ArgumentConfig{Type: graphql.String},
+		"since":      &graphql.ArgumentConfig{Type: graphql.DateTime, Description: "Only include scans created at or after this time (RFC 3339)."},
+		"latestOnly": &graphql.ArgumentConfig{Type: graphql.Boolean, Description: "Only include the most recent scan of each target."},
+		"limit":      &graphql.ArgumentConfig{Type: graphql.Int},
+	}
+
+	query := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Query",
+		Fields: graphql.Fields{
+			"scan": &graphql.Field{
+				Type: scanType,
+				Args: graphql.FieldConfigArgument{
+					"id": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.ID)},
+				},
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					scan, err := st.GetScan(p.Args["id"].(string))
+					if err == store.ErrNotFound {
+						return nil, nil
+					}
+					if err != nil {
+						return nil, err
+					}
+					if !tenant.FromContext(p.Context).Allows(scan.Org, scan.Project) {
+						return nil, nil
+					}
+					return scan, nil
+				},
+			},
+			"scans": &graphql.Field{
+				Type: graphql.NewList(scanType),
+				Args: scanListArgs,
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					return st.ListScans(scanFilterFromArgs(p))
+				},
+			},
+			"findings": &graphql.Field{
+				Type:        graphql.NewList(findingType),
+				Description: "Findings across stored scans, ordered by severity then CVSS score.",
+				Args: graphql.FieldConfigArgument{
+					"target":     scanListArgs["target"],
+					"since":      scanListArgs["since"],
+					"latestOnly": scanListArgs["latestOnly"],
+					"severity":   findingArgs["severity"],
+					"search":     &graphql.ArgumentConfig{Type: graphql.String, Description: "Free text; every word must match the ID, package, version, title or description."},
+					"limit":      findingArgs["limit"],
+				},
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					f := scanFilterFromArgs(p)
+					f.Limit = 0 // the limit applies to findings, not scans
+					scans, err := st.ListScans(f)
+					if err != nil {
+						return nil, err
+					}
+					return filterFindings(findingsOf(scans), p.Args), nil
+				},
+			},
+		},
+	})
+
+	return graphql.NewSchema(graphql.SchemaConfig{Query: query})
+}
+
+func scanField(get func(*store.Scan) any) graphql.FieldResolveFn {
+	return func(p graphql.ResolveParams) (any, error) {
+		return get(p.Source.(*store.Scan)), nil
+	}
+}
+
+func findingField(get func(finding) any) graphql.FieldResolveFn {
+	return func(p graphql.ResolveParams) (any, error) {
+		return get(p.Source.(finding)), nil
+	}
+}
+
+// scanFilterFromArgs builds a filter from the query arguments, always scoped
+// to the caller's tenant.
+func scanFilterFromArgs(p graphql.ResolveParams) store.ScanFilter {
+	t := tenant.FromContext(p.Context)
+	f := store.ScanFilter{Org: t.Org, Project: t.Project}
+	args := p.Args
+	if v, ok := args["target"].(string); ok {
+		f.Target = v
+	}
+	if v, ok := args["since"].(time.Time); ok {
+		f.Since = v
+	}
+	if v, ok := args["latestOnly"].(bool); ok {
+		f.LatestOnly = v
+	}
+	if v, ok := args["limit"].(int); ok {
+		f.Limit = v
+	}
+	return f
+}
+
+func findingsOf(scans []*store.Scan) []finding {
+	var out []finding
+	for _, scan := range scans {
+		for _, v := range scan.Vulnerabilities {
+			out = append(out, finding{Vulnerability: v, Scan: scan})
+		}
+	}
+	return out
+}
+
+func filterFindings(findings []finding, args map[string]any) []finding {
+	if q, ok := args["search"].(string); ok {
+		terms := searchTerms(q)
+		kept := findings[:0]
+		for _, f := range findings {
+			if matchesTerms(f.Vulnerability, terms) {
+				kept = append(kept, f)
+			}
+		}
+		findings = kept
+	}
+
+	if sevs, ok := args["severity"].([]any); ok && len(sevs) > 0 {
+		want := make(map[string]bool)
+		for _, s := range sevs {
+			if str, ok := s.(string); ok {
+				want[strings.ToUpper(str)] = true
+			}
+		}
+		kept := findings[:0]
+		for _, f := range findings {
+			if want[strings.ToUpper(f.Severity)] {
+				kept = append(kept, f)
+			}
+		}
+		findings = kept
+	}
+
+	sort.SliceStable(findings, func(i, j int) bool {
+		ri, rj := trivy.SeverityRank(findings[i].Severity), trivy.SeverityRank(findings[j].Severity)
+		if ri != rj {
+			return ri < rj
+		}
+		return findings[i].Score() > findings[j].Score()
+	})
+
+	if limit, ok := args["limit"].(int); ok && limit > 0 && len(findings) > limit {
+		findings = findings[:limit]
+	}
+	return findings
+}
+
+func severityCounts(vulns []trivy.Vulnerability) map[string]int {
+	counts := map[string]int{"critical": 0, "high": 0, "medium": 0, "low": 0, "unknown": 0}
+	for _, v := range vulns {
+		counts[strings.ToLower(trivy.Severities[trivy.SeverityRank(v.Severity)])]++
+	}
+	return counts
+}
+
+type graphQLRequest struct {
+	Query         string         `json:"query" form:"query"`
+	OperationName string         `json:"operationName" form:"operationName"`
+	Variables     map[string]any `json:"variables"`
+}
+
+// GraphQLHandler executes queries against the stored scans.
+func (h *Handler) GraphQLHandler(c *gin.Context) {
+	var req graphQLRequest
+	var err error
+	if c.Request.Method == http.MethodGet {
+		err = c.ShouldBindQuery(&req)
+	} else {
+		err = c.ShouldBindJSON(&req)
+	}
+	if err != nil || req.Query == "" {
+		abortWithError(c, errcode.InvalidRequest, "Invalid request. 'query' is required.", nil)
+		return
+	}
+
+	result := graphql.Do(graphql.Params{
+		Schema:         h.schema,
+		RequestString:  req.Query,
+		OperationName:  req.OperationName,
+		VariableValues: req.Variables,
+		Context:        c.Request.Context(),
+	})
+	c.JSON(http.StatusOK, result)
+}
+
+func mustGraphQLSchema(st *store.Store) graphql.Schema {
+	schema, err := newGraphQLSchema(st)
+	if err != nil {
+		panic(fmt.Sprintf("invalid GraphQL schema: %v", err))
+	}
+	return schema
+}
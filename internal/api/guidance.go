@@ -0,0 +1,160 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+	"weeklysec/internal/agent"
+	"weeklysec/internal/errcode"
+	"weeklysec/internal/store"
+	"weeklysec/internal/tenant"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GuidanceRequest is the body accepted when setting a tenant's guidance.
+type GuidanceRequest struct {
+	Conventions         string   `json:"conventions"`
+	ForbiddenBaseImages []string `json:"forbidden_base_images"`
+	PatchingPolicy      string   `json:"patching_policy"`
+	Instructions        string   `json:"instructions"`
+}
+
+// Validate trims the guidance and checks it fits in a prompt.
+func (r *GuidanceRequest) Validate() error {
+	r.Conventions = strings.TrimSpace(r.Conventions)
+	r.PatchingPolicy = strings.TrimSpace(r.PatchingPolicy)
+	r.Instructions = strings.TrimSpace(r.Instructions)
+	var images []string
+	for _, img := range r.ForbiddenBaseImages {
+		if img = strings.TrimSpace(img); img != "" {
+			images = append(images, img)
+		}
+	}
+	r.ForbiddenBaseImages = images
+
+	g := agent.Guidance{
+		Conventions:         r.Conventions,
+		ForbiddenBaseImages: r.ForbiddenBaseImages,
+		PatchingPolicy:      r.PatchingPolicy,
+		Instructions:        r.Instructions,
+	}
+	switch n := g.Size(); {
+	case n == 0:
+		return fmt.Errorf("set at least one of 'conventions', 'forbidden_base_images', 'patching_policy' or 'instructions'")
+	case n > agent.MaxGuidance:
+		return fmt.Errorf("guidance is %d characters; the limit is %d", n, agent.MaxGuidance)
+	}
+	return nil
+}
+
+// ListGuidanceHandler lists the guidance added to the remediation prompts
+// of the caller's scans.
+func (h *Handler) ListGuidanceHandler(c *gin.Context) {
+	t := tenant.FromContext(c.Request.Context())
+	guidance, err := h.store.ListGuidance(t.Org, t.Project)
+	if err != nil {
+		abortWithErr(c, err, "Failed to list guidance")
+		return
+	}
+	if guidance == nil {
+		guidance = []agent.Guidance{}
+	}
+	c.JSON(http.StatusOK, gin.H{"guidance": guidance})
+}
+
+// GetGuidanceHandler returns the guidance of a project, or of the whole
+// org for project "*".
+func (h *Handler) GetGuidanceHandler(c *gin.Context) {
+	t, ok := guidanceTenant(c)
+	if !ok {
+		return
+	}
+	g, err := h.store.GetGuidance(t.Org, t.Project)
+	if errors.Is(err, store.ErrNotFound) {
+		abortWithError(c, errcode.NotFound, "Guidance not found", nil)
+		return
+	}
+	c.JSON(http.StatusOK, g)
+}
+
+// UpdateGuidanceHandler sets the guidance of a project, or of the whole
+// org for project "*", which needs access to every project.
+func (h *Handler) UpdateGuidanceHandler(c *gin.Context) {
+	t, ok := guidanceTenant(c)
+	if !ok {
+		return
+	}
+	var req GuidanceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		abortWithError(c, errcode.InvalidRequest, "Invalid request body", err.Error())
+		return
+	}
+	if err := req.Validate(); err != nil {
+		abortWithError(c, errcode.InvalidRequest, "Invalid request", err.Error())
+		return
+	}
+
+	before, err := h.store.GetGuidance(t.Org, t.Project)
+	status := http.StatusOK
+	if errors.Is(err, store.ErrNotFound) {
+		status = http.StatusCreated
+	}
+	g := agent.Guidance{
+		Org:                 t.Org,
+		Project:             t.Project,
+		Conventions:         req.Conventions,
+		ForbiddenBaseImages: req.ForbiddenBaseImages,
+		PatchingPolicy:      req.PatchingPolicy,
+		Instructions:        req.Instructions,
+		UpdatedBy:           identity(c),
+		UpdatedAt:           time.Now().UTC(),
+	}
+	if err := h.store.SaveGuidance(g); err != nil {
+		abortWithErr(c, err, "Failed to save guidance")
+		return
+	}
+	if status == http.StatusCreated {
+		h.audit(c, "guidance.create", nil, g)
+	} else {
+		h.audit(c, "guidance.update", before, g)
+	}
+	c.JSON(status, g)
+}
+
+func (h *Handler) DeleteGuidanceHandler(c *gin.Context) {
+	t, ok := guidanceTenant(c)
+	if !ok {
+		return
+	}
+	g, err := h.store.GetGuidance(t.Org, t.Project)
+	if errors.Is(err, store.ErrNotFound) {
+		abortWithError(c, errcode.NotFound, "Guidance not found", nil)
+		return
+	}
+	if err := h.store.DeleteGuidance(t.Org, t.Project); err != nil {
+		abortWithErr(c, err, "Failed to delete guidance")
+		return
+	}
+	h.audit(c, "guidance.delete", g, nil)
+	c.Status(http.StatusNoContent)
+}
+
+// guidanceTenant resolves the :project parameter against the caller's
+// tenant.
+func guidanceTenant(c *gin.Context) (tenant.Tenant, bool) {
+	t := tenant.FromContext(c.Request.Context())
+	project := c.Param("project")
+	if !t.AllowsProject(project) {
+		abortWithError(c, errcode.NotFound, "Guidance not found", nil)
+		return t, false
+	}
+	t, err := tenant.Parse(t.Org + "/" + project)
+	if err != nil {
+		abortWithError(c, errcode.InvalidRequest, "Invalid request", err.Error())
+		return t, false
+	}
+	return t, true
+}
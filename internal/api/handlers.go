@@ -1,48 +1,257 @@
 package api
 
 import (
+	"context"
+	"errors"
 	"net/http"
-	"strings"
-	"weeklysec/internal/llm"
-	"weeklysec/internal/trivy"
+	"sync"
+	"sync/atomic"
+	"time"
+	"weeklysec/internal/agent"
+	"weeklysec/internal/alert"
+	"weeklysec/internal/allowlist"
+	"weeklysec/internal/attest"
+	"weeklysec/internal/cluster"
+	"weeklysec/internal/config"
+	"weeklysec/internal/defectdojo"
+	"weeklysec/internal/deptrack"
+	"weeklysec/internal/email"
+	"weeklysec/internal/errcode"
+	"weeklysec/internal/github"
+	"weeklysec/internal/health"
+	"weeklysec/internal/i18n"
+	"weeklysec/internal/jobs"
+	"weeklysec/internal/kev"
+	"weeklysec/internal/notify"
+	"weeklysec/internal/policy"
+	"weeklysec/internal/queue"
+	"weeklysec/internal/quota"
+	"weeklysec/internal/report"
+	"weeklysec/internal/retention"
+	"weeklysec/internal/scheduler"
+	"weeklysec/internal/store"
+	"weeklysec/internal/tenant"
+	"weeklysec/internal/tickets"
+	"weeklysec/internal/webhook"
+	"weeklysec/internal/workspace"
 
 	"github.com/gin-gonic/gin"
+	"github.com/graphql-go/graphql"
+	"github.com/rs/zerolog/log"
 )
 
-func ScanHandler(c *gin.Context) {
-	var req struct {
-		TargetType string `json:"target_type"` // "file" or "image"
-		Target     string `json:"target"`      // path to file or image name
-		Summarize  bool   `json:"summarize"`   // true if summary is needed
+// Handler carries the dependencies shared by the HTTP handlers.
+type Handler struct {
+	cfg      *config.Config
+	store    *store.Store
+	agent    *agent.Agent
+	webhooks *webhook.Dispatcher
+	tenants  *tenant.Resolver
+	health   *health.Checker
+	schema   graphql.Schema
+	sched    *scheduler.Scheduler
+	purger   *retention.Purger
+	spaces   *workspace.Manager
+	trackers []*tickets.Filer
+	notify   *notify.Hub
+	alerter  *alert.Alerter
+	dojo     *defectdojo.Exporter
+	deptrack *deptrack.Client
+	pushes   *pushQueue
+	presync  *presyncRuns
+	cluster  *cluster.Scanner
+	attester *attest.Signer
+	runs     *queue.Pool
+	scans    *queue.Pool
+	jobs     *jobs.Queue
+	allow    *allowlist.Allowlist
+	policies atomic.Pointer[policy.Engine]
+	kev      *kev.Catalog
+	quota    *quota.Meter
+	watchMu  sync.Mutex // guards the announced watch changes
+
+	mailer       *email.Mailer
+	recipientsMu sync.RWMutex
+	recipients   email.Routes
+
+	tokenGrants github.Grants
+}
+
+// Deps are the services the handlers depend on.
+type Deps struct {
+	Store    *store.Store
+	Agent    *agent.Agent
+	Webhooks *webhook.Dispatcher
+	Tenants  *tenant.Resolver
+
+	// Scheduler is optional; without it the schedule endpoint is empty.
+	Scheduler *scheduler.Scheduler
+
+	Purger *retention.Purger
+
+	// Workspaces keep the files pull requests patch, for download; optional.
+	Workspaces *workspace.Manager
+
+	// Trackers file issues for the urgent findings of every stored scan.
+	Trackers []*tickets.Filer
+
+	// Notify posts scan summaries and digests to chat; optional.
+	Notify *notify.Hub
+
+	// Alerter pages on-call for exploited or high-scoring findings; optional.
+	Alerter *alert.Alerter
+
+	// DefectDojo receives the findings of stored scans; optional.
+	DefectDojo *defectdojo.Exporter
+
+	// DependencyTrack receives the SBOMs of stored scans; optional.
+	DependencyTrack *deptrack.Client
+
+	// Cluster scans the images running in Kubernetes; optional.
+	Cluster *cluster.Scanner
+
+	// Attester signs scan result attestations of images; optional.
+	Attester *attest.Signer
+
+	// RunQueue and ScanQueue are the agent's work queues, reported by the
+	// admin API. ScanQueue also bounds SBOM generation. Optional.
+	RunQueue  *queue.Pool
+	ScanQueue *queue.Pool
+
+	// Jobs shares background scans with the other replicas; optional.
+	// Without it they run on this replica.
+	Jobs *jobs.Queue
+
+	// Allowlist limits the files and images that may be scanned; nil
+	// allows any.
+	Allowlist *allowlist.Allowlist
+
+	// Policy judges every stored scan; optional, and replaced through the
+	// admin API. KEV tells its rules which CVEs are known exploited.
+	Policy *policy.Engine
+	KEV    *kev.Catalog
+
+	// Quota meters scans and LLM spend against monthly budgets; optional.
+	Quota *quota.Meter
+
+	// Mailer emails digests to Recipients; optional.
+	Mailer     *email.Mailer
+	Recipients email.Routes
+
+	// TokenGrants are the repos pull requests may be opened on with
+	// GITHUB_TOKEN, by tenant; without one callers bring their own token.
+	TokenGrants github.Grants
+}
+
+func NewHandler(cfg *config.Config, deps Deps) *Handler {
+	st := deps.Store
+
+	checker := health.NewChecker(cfg.HealthCheckTimeout)
+	checker.Register("trivy", health.Cached(time.Minute, health.Trivy(cfg.TrivyDBMaxAge)))
+	checker.Register("store", health.Ping(st))
+	if cfg.ReadinessCheckLLM {
+		checker.RegisterOptional("llm", health.Cached(time.Minute, health.LLM()))
+	}
+
+	h := &Handler{
+		cfg:      cfg,
+		store:    st,
+		agent:    deps.Agent,
+		webhooks: deps.Webhooks,
+		tenants:  deps.Tenants,
+		health:   checker,
+		schema:   mustGraphQLSchema(st),
+		sched:    deps.Scheduler,
+		purger:   deps.Purger,
+		spaces:   deps.Workspaces,
+		trackers: deps.Trackers,
+		notify:   deps.Notify,
+		alerter:  deps.Alerter,
+		dojo:     deps.DefectDojo,
+		deptrack: deps.DependencyTrack,
+		presync:  newPresyncRuns(cfg.PresyncConcurrency),
+		cluster:  deps.Cluster,
+		attester: deps.Attester,
+		runs:     deps.RunQueue,
+		scans:    deps.ScanQueue,
+		jobs:     deps.Jobs,
+		allow:    deps.Allowlist,
+		kev:      deps.KEV,
+		quota:    deps.Quota,
+
+		mailer:     deps.Mailer,
+		recipients: deps.Recipients,
+
+		tokenGrants: deps.TokenGrants,
 	}
+	h.policies.Store(deps.Policy)
+	if cfg.RegistryWebhookSecret != "" {
+		h.pushes = newPushQueue(h, cfg.RegistryWebhookQueue)
+	}
+	return h
+}
 
-	if err := c.ShouldBindJSON(&req); err != nil || req.TargetType == "" || req.Target == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request. 'target_type' and 'target' are required."})
+// SetRecipients replaces the digest email routes, e.g. after a
+// configuration reload.
+func (h *Handler) SetRecipients(r email.Routes) {
+	h.recipientsMu.Lock()
+	defer h.recipientsMu.Unlock()
+	h.recipients = r
+}
+
+func (h *Handler) emailRoutes() email.Routes {
+	h.recipientsMu.RLock()
+	defer h.recipientsMu.RUnlock()
+	return h.recipients
+}
+
+func (h *Handler) ScanHandler(c *gin.Context) {
+	format, ok := negotiateFormat(c)
+	if !ok {
+		return
+	}
+	req, ok := h.bindScanRequest(c)
+	if !ok {
 		return
 	}
+	if pr := req.PullRequest; pr != nil {
+		if _, err := h.githubToken(pr.Token, pr.Repo, req.tenant); err != nil {
+			abortWithErr(c, err, "Invalid request")
+			return
+		}
+	}
 
-	scanResult, err := trivy.RunScan(req.TargetType, req.Target)
+	resp, scan, err := h.runAgent(c.Request.Context(), req, agent.Request{
+		TargetType: req.TargetType,
+		Target:     req.Target,
+		Summarize:  req.Summarize,
+		Explain:    req.Explain,
+	})
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Scan failed", "details": err.Error()})
+		abortWithErr(c, err, "Scan failed")
 		return
 	}
+	scanResult := gin.H{"RawOutput": scan.RawOutput}
 
 	// Handle summary
 	if req.Summarize {
-		summary, err := llm.Summarize(scanResult.RawOutput)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Summarization failed", "details": err.Error()})
+		if step := findStep(resp, agent.StepSummarize); step.Status != agent.StepSucceeded {
+			code := step.ErrorCode
+			if code == "" {
+				code = errcode.Internal
+			}
+			abortWithError(c, code, "Summarization failed", step.Error)
 			return
 		}
+		summary := resp.Summary
 
-		// Check if it's a CLI (curl/httpie) client
-		ua := strings.ToLower(c.Request.UserAgent())
-		isCLI := strings.Contains(ua, "curl") || strings.Contains(ua, "httpie")
-
-		if isCLI {
-			// return plain text summary
+		switch format {
+		case formatText:
 			c.String(http.StatusOK, summary)
 			return
+		case formatMarkdown:
+			renderResponse(c, http.StatusOK, format, resp)
+			return
 		}
 
 		// else JSON response
@@ -54,7 +263,339 @@ func ScanHandler(c *gin.Context) {
 	}
 
 	// if Summarize == false
+	if format != formatJSON {
+		renderResponse(c, http.StatusOK, format, resp)
+		return
+	}
 	c.JSON(http.StatusOK, gin.H{
 		"scan_results": scanResult,
 	})
 }
+
+// CreateScanHandler runs the full agent pipeline and returns the AgentResponse.
+func (h *Handler) CreateScanHandler(c *gin.Context) {
+	format, ok := negotiateFormat(c)
+	if !ok {
+		return
+	}
+	req, ok := h.bindScanRequest(c)
+	if !ok {
+		return
+	}
+
+	resp, scan, err := h.runAgent(c.Request.Context(), req, agent.Request{
+		TargetType:  req.TargetType,
+		Target:      req.Target,
+		Summarize:   true,
+		Remediation: true,
+		Explain:     req.Explain,
+	})
+	if err != nil {
+		abortWithRun(c, format, resp, "Scan failed")
+		return
+	}
+	if req.PullRequest != nil {
+		h.proposeFixes(c.Request.Context(), scan, resp, *req.PullRequest)
+	}
+	renderResponse(c, http.StatusOK, format, resp)
+}
+
+// GetScanHandler returns a stored scan's AgentResponse.
+func (h *Handler) GetScanHandler(c *gin.Context) {
+	format, ok := negotiateFormat(c)
+	if !ok {
+		return
+	}
+	scan, ok := h.loadScan(c)
+	if !ok {
+		return
+	}
+	if notModified(c, scanETag(c, scan, format)) {
+		return
+	}
+	renderResponse(c, http.StatusOK, format, scan.Response)
+}
+
+// AnalyzeScanHandler re-runs the agent over a stored scan's Trivy output
+// without scanning again, optionally with a different model or threshold.
+func (h *Handler) AnalyzeScanHandler(c *gin.Context) {
+	format, ok := negotiateFormat(c)
+	if !ok {
+		return
+	}
+
+	var req AnalyzeRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			abortWithError(c, errcode.InvalidRequest, "Invalid request body", err.Error())
+			return
+		}
+	}
+	if err := req.Validate(); err != nil {
+		abortWithError(c, errcode.InvalidRequest, "Invalid request", err.Error())
+		return
+	}
+
+	scan, ok := h.loadScan(c)
+	if !ok {
+		return
+	}
+	raw, err := h.store.RawOutput(c.Request.Context(), scan)
+	if err != nil {
+		abortWithErr(c, err, "Failed to load stored Trivy output")
+		return
+	}
+	if raw == "" {
+		abortWithError(c, errcode.Conflict, "Scan has no stored Trivy output to analyze", nil)
+		return
+	}
+
+	areq := agent.Request{
+		TargetType:        scan.TargetType,
+		Target:            scan.Target,
+		Summarize:         req.Summarize == nil || *req.Summarize,
+		Remediation:       req.Remediation == nil || *req.Remediation,
+		Model:             req.Model,
+		PriorityThreshold: req.PriorityThreshold,
+		Explain:           req.Explain,
+	}
+	if err := h.loadTenantRules(&areq, scan.Org, scan.Project, scan.TargetID); err != nil {
+		abortWithErr(c, err, "Failed to load tenant rules")
+		return
+	}
+	scopes := quota.Scopes(tenant.Tenant{Org: scan.Org, Project: scan.Project}, identity(c))
+	if resp, err := h.checkQuota(scopes, &areq); err != nil {
+		abortWithRun(c, format, resp, "Analysis failed")
+		return
+	}
+	resp := h.agent.Analyze(c.Request.Context(), areq, raw)
+	resp.ScanID = scan.ID
+	if resp.ErrorCode != errcode.TooManyRequests {
+		h.recordUsage(c.Request.Context(), scopes, resp)
+	}
+	// A run the queue turned away analyzed nothing; keep the stored one.
+	if resp.ErrorCode == errcode.TooManyRequests {
+		abortWithRun(c, format, resp, "Analysis failed")
+		return
+	}
+
+	updated := *scan
+	updated.ReplaceResponse(resp)
+	if err := h.store.SaveScan(&updated); err != nil {
+		log.Error().Err(err).Str("scan_id", scan.ID).Msg("Failed to store analysis")
+	} else {
+		h.fileTickets(c.Request.Context(), &updated)
+		h.pageOnCall(c.Request.Context(), &updated)
+		h.exportDefectDojo(c.Request.Context(), &updated)
+	}
+
+	var extra []webhook.Endpoint
+	if req.WebhookURL != "" {
+		extra = append(extra, webhook.Endpoint{URL: req.WebhookURL, Secret: req.WebhookSecret})
+	}
+	h.webhooks.Notify(h.webhooks.NewEvent(resp), extra...)
+	h.notifyScan(c.Request.Context(), scan.Org, scan.Project, scan.TargetID, resp)
+
+	if resp.Status == agent.StatusFailed {
+		abortWithRun(c, format, resp, "Analysis failed")
+		return
+	}
+	renderResponse(c, http.StatusOK, format, resp)
+}
+
+// loadScan fetches the scan named by the :id parameter, hiding scans that
+// belong to other tenants behind a 404.
+func (h *Handler) loadScan(c *gin.Context) (*store.Scan, bool) {
+	scan, err := h.store.GetScan(c.Param("id"))
+	if err == nil && !tenant.FromContext(c.Request.Context()).Allows(scan.Org, scan.Project) {
+		err = store.ErrNotFound
+	}
+	if errors.Is(err, store.ErrNotFound) {
+		abortWithError(c, errcode.NotFound, "Scan not found", nil)
+		return nil, false
+	}
+	if err != nil {
+		abortWithErr(c, err, "Failed to load scan")
+		return nil, false
+	}
+	return scan, true
+}
+
+func (h *Handler) bindScanRequest(c *gin.Context) (ScanRequest, bool) {
+	var req ScanRequest
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			abortWithError(c, errcode.RequestTooLarge, "Request body too large", gin.H{"max_bytes": maxErr.Limit})
+			return req, false
+		}
+		abortWithError(c, errcode.InvalidRequest, "Invalid request body", err.Error())
+		return req, false
+	}
+	return req, h.prepareScanRequest(c, &req)
+}
+
+// prepareScanRequest validates a bound request and resolves its owner.
+func (h *Handler) prepareScanRequest(c *gin.Context, req *ScanRequest) bool {
+	if err := req.Validate(h.cfg.MaxTargetLength, h.allow); err != nil {
+		abortInvalid(c, err)
+		return false
+	}
+
+	t, err := writeTenant(c, req.Project)
+	if err != nil {
+		abortWithError(c, errcode.Forbidden, "Forbidden", err.Error())
+		return false
+	}
+	req.tenant = t
+	req.caller = identity(c)
+	if req.Source != "" {
+		src, err := agent.ReadSource(req.Source)
+		if err != nil {
+			abortWithError(c, errcode.InvalidRequest, "Invalid request", err.Error())
+			return false
+		}
+		req.source = src
+	}
+	return true
+}
+
+// loadTenantRules fills in what the agent needs to know about the tenant of
+// a run: its suppressions, severity overrides, triage history, guidance and
+// the target's inventory metadata.
+func (h *Handler) loadTenantRules(areq *agent.Request, org, project, targetID string) error {
+	var err error
+	if areq.Suppressions, err = h.store.ListSuppressions(org, project, false); err != nil {
+		return err
+	}
+	if areq.SeverityOverrides, err = h.store.ListSeverityOverrides(org, project); err != nil {
+		return err
+	}
+	if areq.Triage, err = h.triageHistory(org, project); err != nil {
+		return err
+	}
+	if areq.TargetInfo, err = h.targetInfo(org, project, targetID); err != nil {
+		return err
+	}
+	areq.Guidance, err = h.store.ListGuidance(org, project)
+	return err
+}
+
+// failedRun is the response of a run that failed before the agent started.
+func failedRun(areq *agent.Request, err error) *agent.AgentResponse {
+	now := time.Now().UTC()
+	return &agent.AgentResponse{
+		TargetType:  areq.TargetType,
+		Target:      areq.Target,
+		Status:      agent.StatusFailed,
+		Error:       err.Error(),
+		ErrorCode:   errcode.Of(err),
+		StartedAt:   now,
+		CompletedAt: now,
+		StepResults: []agent.StepResult{},
+	}
+}
+
+// runAgent runs the pipeline, stores the scan and fires webhooks. The error is
+// the scan failure, if any; later step failures are reported in the response.
+func (h *Handler) runAgent(ctx context.Context, req ScanRequest, areq agent.Request) (*agent.AgentResponse, *store.Scan, error) {
+	if req.targetID == "" {
+		t, err := h.store.FindTarget(req.tenant.Org, req.tenant.Project, req.TargetType, req.Target)
+		if err != nil && !errors.Is(err, store.ErrNotFound) {
+			return failedRun(&areq, err), nil, err
+		}
+		req.targetID = t.ID
+	}
+
+	if err := h.loadTenantRules(&areq, req.tenant.Org, req.tenant.Project, req.targetID); err != nil {
+		h.recordAttempt(req.targetID, err)
+		return failedRun(&areq, err), nil, err
+	}
+
+	scopes := quota.Scopes(req.tenant, req.caller)
+	if resp, err := h.reserveQuota(scopes, &areq); err != nil {
+		h.recordAttempt(req.targetID, err)
+		return resp, nil, err
+	}
+	areq.Source = req.source
+	resp, raw, err := h.agent.Run(ctx, areq)
+	if queue.Rejected(err) {
+		h.releaseQuota(ctx, scopes)
+		return resp, nil, err
+	}
+	h.recordUsage(ctx, scopes, resp)
+	h.recordAttempt(req.targetID, err)
+	if err != nil {
+		h.webhooks.Notify(h.webhooks.NewEvent(resp), webhookEndpoints(req)...)
+		h.notifyScan(ctx, req.tenant.Org, req.tenant.Project, req.targetID, resp)
+		return resp, nil, err
+	}
+
+	scan := &store.Scan{
+		ID:              store.NewID(),
+		TargetID:        req.targetID,
+		Org:             req.tenant.Org,
+		Project:         req.tenant.Project,
+		TargetType:      req.TargetType,
+		Target:          req.Target,
+		Summary:         resp.Summary,
+		Vulnerabilities: resp.Vulnerabilities,
+		RawOutput:       raw,
+		Response:        resp,
+		Exchanges:       resp.Exchanges,
+	}
+	resp.ScanID = scan.ID
+	resp.Policy = h.judge(scan)
+
+	// A storage failure is logged rather than failing the request, since the
+	// caller already has the results.
+	if err := h.store.SaveScan(scan); err != nil {
+		log.Error().Err(err).Str("target", scan.Target).Msg("Failed to store scan")
+	} else {
+		h.watchFindings(ctx, scan, scan.Vulnerabilities, false)
+		if err := h.store.TrackFindings(scan); err != nil {
+			log.Error().Err(err).Str("target", scan.Target).Msg("Failed to update finding lifecycle")
+		}
+		h.fileTickets(ctx, scan)
+		h.pageOnCall(ctx, scan)
+		h.exportDefectDojo(ctx, scan)
+		h.publishSBOM(ctx, scan)
+		h.attestScan(ctx, scan)
+	}
+	if err := h.archiveReport(ctx, scan.ID, "report.md", "text/markdown", []byte(report.Markdown(resp, i18n.Current().Fallback()))); err != nil {
+		log.Error().Err(err).Str("scan_id", scan.ID).Msg("Failed to archive report")
+	}
+
+	h.webhooks.Notify(h.webhooks.NewEvent(resp), webhookEndpoints(req)...)
+	h.notifyScan(ctx, scan.Org, scan.Project, scan.TargetID, resp)
+	return resp, scan, nil
+}
+
+// notifyScan announces a finished run to the chat notifiers, routed by the
+// scanned target if it is registered.
+func (h *Handler) notifyScan(ctx context.Context, org, project, targetID string, resp *agent.AgentResponse) {
+	n := notify.ScanNotice{Org: org, Project: project, Response: resp}
+	if targetID != "" {
+		if t, err := h.store.GetTarget(targetID); err == nil {
+			n.Target = &t
+		}
+	}
+	h.notify.Scan(ctx, n)
+}
+
+func webhookEndpoints(req ScanRequest) []webhook.Endpoint {
+	if req.WebhookURL == "" {
+		return nil
+	}
+	return []webhook.Endpoint{{URL: req.WebhookURL, Secret: req.WebhookSecret}}
+}
+
+func findStep(resp *agent.AgentResponse, name string) agent.StepResult {
+	for _, s := range resp.StepResults {
+		if s.Step == name {
+			return s
+		}
+	}
+	return agent.StepResult{Step: name, Status: agent.StepSkipped}
+}
@@ -0,0 +1,26 @@
+package api
+
+import (
+	"net/http"
+	"weeklysec/internal/health"
+
+	"github.com/gin-gonic/gin"
+)
+
+// LivenessHandler reports that the process is up. It checks nothing else so
+// that a slow dependency never gets the pod restarted.
+func (h *Handler) LivenessHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": health.StatusOK})
+}
+
+// ReadinessHandler runs the dependency checks and returns 503 when any
+// required one fails.
+func (h *Handler) ReadinessHandler(c *gin.Context) {
+	report := h.health.Run(c.Request.Context())
+
+	status := http.StatusOK
+	if report.Status != health.StatusOK {
+		status = http.StatusServiceUnavailable
+	}
+	c.JSON(status, report)
+}
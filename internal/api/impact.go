@@ -0,0 +1,203 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+	"weeklysec/internal/errcode"
+	"weeklysec/internal/impact"
+	"weeklysec/internal/queue"
+	"weeklysec/internal/store"
+	"weeklysec/internal/tenant"
+	"weeklysec/internal/trivy"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog"
+)
+
+// Impact sources: where an impacted target was found.
+const (
+	ImpactFindings = "findings" // the latest scan reported the vulnerability or package
+	ImpactSBOM     = "sbom"     // the archived SBOM lists the package
+	ImpactRescan   = "rescan"   // the archived SBOM matched the vulnerability in the current DB
+)
+
+// ImpactRequest asks which targets a vulnerability affects.
+type ImpactRequest struct {
+	impact.Query
+
+	VulnerabilityID string `json:"vulnerability_id"`
+
+	// Rescan matches every archived SBOM against the current
+	// vulnerability DB, finding the vulnerability before the next scan
+	// does. It needs vulnerability_id and takes a scan per target.
+	Rescan bool `json:"rescan"`
+}
+
+// Validate checks the request names a vulnerability or package.
+func (r *ImpactRequest) Validate() error {
+	r.VulnerabilityID = strings.TrimSpace(r.VulnerabilityID)
+	r.Package = strings.TrimSpace(r.Package)
+	switch {
+	case r.VulnerabilityID == "" && r.Package == "":
+		return errors.New("'vulnerability_id' or 'package' is required")
+	case len(r.Versions) > 0 && r.Package == "":
+		return errors.New("'versions' needs 'package'")
+	case r.Rescan && r.VulnerabilityID == "":
+		return errors.New("'rescan' needs 'vulnerability_id'")
+	}
+	return r.Query.Validate()
+}
+
+// ImpactedTarget is a target affected by the vulnerability.
+type ImpactedTarget struct {
+	Org              string    `json:"org"`
+	Project          string    `json:"project"`
+	TargetID         string    `json:"target_id,omitempty"`
+	TargetType       string    `json:"target_type"`
+	Target           string    `json:"target"`
+	ScanID           string    `json:"scan_id"`
+	ScannedAt        time.Time `json:"scanned_at"`
+	PkgName          string    `json:"pkg_name"`
+	InstalledVersion string    `json:"installed_version"`
+	FixedVersion     string    `json:"fixed_version,omitempty"`
+	Severity         string    `json:"severity,omitempty"`
+	Source           string    `json:"source"`
+}
+
+// ImpactReport lists the impacted targets.
+type ImpactReport struct {
+	Request       ImpactRequest    `json:"request"`
+	Targets       int              `json:"targets"` // distinct impacted targets
+	Impacted      []ImpactedTarget `json:"impacted"`
+	ScansSearched int              `json:"scans_searched"`
+	SBOMsSearched int              `json:"sboms_searched"`
+	WithoutSBOM   int              `json:"without_sbom"` // targets whose packages are only known from findings
+	Errors        []string         `json:"errors,omitempty"`
+}
+
+// ImpactHandler searches the latest scan of every target of the tenant,
+// and its archived SBOM, for the vulnerability or package in the request.
+func (h *Handler) ImpactHandler(c *gin.Context) {
+	var req ImpactRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		abortWithError(c, errcode.InvalidRequest, "Invalid request body", err.Error())
+		return
+	}
+	if err := req.Validate(); err != nil {
+		abortWithError(c, errcode.InvalidRequest, "Invalid request", err.Error())
+		return
+	}
+
+	t := tenant.FromContext(c.Request.Context())
+	scans, err := h.store.ListScans(store.ScanFilter{Org: t.Org, Project: t.Project, LatestOnly: true})
+	if err != nil {
+		abortWithErr(c, err, "Failed to load scans")
+		return
+	}
+	c.JSON(http.StatusOK, h.impact(c.Request.Context(), req, scans))
+}
+
+func (h *Handler) impact(ctx context.Context, req ImpactRequest, scans []*store.Scan) *ImpactReport {
+	logger := zerolog.Ctx(ctx)
+	rep := &ImpactReport{Request: req, Impacted: []ImpactedTarget{}, ScansSearched: len(scans)}
+	targets := map[string]bool{}
+	hit := func(scan *store.Scan, source, pkg, version string) *ImpactedTarget {
+		targets[scan.TargetKey()] = true
+		rep.Impacted = append(rep.Impacted, ImpactedTarget{
+			Org:              scan.Org,
+			Project:          scan.Project,
+			TargetID:         scan.TargetID,
+			TargetType:       scan.TargetType,
+			Target:           scan.Target,
+			ScanID:           scan.ID,
+			ScannedAt:        scan.CreatedAt,
+			PkgName:          pkg,
+			InstalledVersion: version,
+			Source:           source,
+		})
+		return &rep.Impacted[len(rep.Impacted)-1]
+	}
+	matches := func(v trivy.Vulnerability) bool {
+		if req.VulnerabilityID != "" && !strings.EqualFold(v.VulnerabilityID, req.VulnerabilityID) {
+			return false
+		}
+		return req.Package == "" || req.Matches(v.PkgName, v.InstalledVersion)
+	}
+
+	for _, scan := range scans {
+		found := map[string]bool{}
+		for _, v := range scan.Vulnerabilities {
+			key := v.PkgName + "@" + v.InstalledVersion
+			if found[key] || !matches(v) {
+				continue
+			}
+			found[key] = true
+			t := hit(scan, ImpactFindings, v.PkgName, v.InstalledVersion)
+			t.FixedVersion, t.Severity = v.FixedVersion, v.Severity
+		}
+
+		if req.Package == "" && !req.Rescan {
+			continue
+		}
+		bom, err := h.store.ArchivedReport(ctx, scan.ID, "sbom.cdx.json")
+		if errors.Is(err, store.ErrNotFound) {
+			rep.WithoutSBOM++
+			continue
+		}
+		if err != nil {
+			logger.Error().Err(err).Str("scan_id", scan.ID).Msg("Failed to read SBOM")
+			rep.Errors = append(rep.Errors, scan.Target+": "+err.Error())
+			continue
+		}
+		rep.SBOMsSearched++
+
+		if req.Package != "" {
+			components, err := impact.Components(bom)
+			if err != nil {
+				rep.Errors = append(rep.Errors, scan.Target+": "+err.Error())
+				continue
+			}
+			for _, comp := range components {
+				key := comp.Name + "@" + comp.Version
+				if !found[key] && req.Matches(comp.Name, comp.Version) {
+					found[key] = true
+					hit(scan, ImpactSBOM, comp.Name, comp.Version)
+				}
+			}
+		}
+		if req.Rescan {
+			var report *trivy.Report
+			err := h.scans.Do(queue.WithPriority(ctx, queue.PriorityInteractive), func(ctx context.Context) (err error) {
+				report, err = trivy.ScanSBOM(ctx, bom)
+				return err
+			})
+			if err != nil {
+				logger.Error().Err(err).Str("scan_id", scan.ID).Msg("Failed to scan SBOM")
+				rep.Errors = append(rep.Errors, scan.Target+": "+err.Error())
+				continue
+			}
+			for _, v := range report.Vulnerabilities() {
+				key := v.PkgName + "@" + v.InstalledVersion
+				if !found[key] && matches(v) {
+					found[key] = true
+					t := hit(scan, ImpactRescan, v.PkgName, v.InstalledVersion)
+					t.FixedVersion, t.Severity = v.FixedVersion, v.Severity
+				}
+			}
+		}
+	}
+
+	rep.Targets = len(targets)
+	sort.SliceStable(rep.Impacted, func(i, j int) bool {
+		a, b := rep.Impacted[i], rep.Impacted[j]
+		if a.Target != b.Target {
+			return a.Target < b.Target
+		}
+		return a.PkgName < b.PkgName
+	})
+	return rep
+}
@@ -0,0 +1,198 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+	"weeklysec/internal/agent"
+	"weeklysec/internal/errcode"
+	"weeklysec/internal/failure"
+	"weeklysec/internal/jobs"
+	"weeklysec/internal/queue"
+	"weeklysec/internal/store"
+	"weeklysec/internal/tenant"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog"
+)
+
+// Kinds of job handed to the shared job queue.
+const (
+	jobTargetScan = "target_scan"
+	jobImageScan  = "image_scan"
+)
+
+// scheduleWindow is how long the first replica to queue a scheduled scan
+// holds off the others firing the same schedule.
+const scheduleWindow = 10 * time.Minute
+
+type targetScanJob struct {
+	TargetID string `json:"target_id"`
+}
+
+type imageScanJob struct {
+	Org     string `json:"org,omitempty"`
+	Project string `json:"project,omitempty"`
+	Image   string `json:"image"`
+}
+
+// ScheduledScan is the scheduler's entry point. With a shared job queue it
+// queues the scan for whichever replica is free, once per schedule tick
+// across replicas; otherwise it scans here and now.
+func (h *Handler) ScheduledScan(ctx context.Context, t store.Target) error {
+	if h.jobs == nil {
+		return h.ScanTarget(ctx, t)
+	}
+	tick := time.Now().Truncate(time.Minute).Unix()
+	j, err := newJob(jobTargetScan, queue.PriorityScheduled, "scheduled:"+t.ID+":"+strconv.FormatInt(tick, 10), targetScanJob{TargetID: t.ID})
+	if err != nil {
+		return err
+	}
+	added, err := h.jobs.EnqueueOnce(ctx, j, scheduleWindow)
+	if err == nil && !added {
+		zerolog.Ctx(ctx).Debug().Str("target_id", t.ID).Msg("Scheduled scan already queued by another replica")
+	}
+	return err
+}
+
+// queueTargetScan hands a scan of t to the shared job queue unless one is
+// already waiting.
+func (h *Handler) queueTargetScan(ctx context.Context, t store.Target, prio queue.Priority) error {
+	j, err := newJob(jobTargetScan, prio, "target:"+t.ID, targetScanJob{TargetID: t.ID})
+	if err != nil {
+		return err
+	}
+	_, err = h.jobs.Enqueue(ctx, j)
+	return err
+}
+
+// queuePush queues a push-triggered scan on the shared job queue when there
+// is one, or on this replica's push queue. Like the latter it reports
+// success for a duplicate of a waiting scan.
+func (h *Handler) queuePush(ctx context.Context, p pushScan) bool {
+	if h.jobs == nil {
+		return h.pushes.add(p)
+	}
+	var (
+		j   jobs.Job
+		err error
+	)
+	if p.target != nil {
+		j, err = newJob(jobTargetScan, queue.PriorityWebhook, "push:"+p.key(), targetScanJob{TargetID: p.target.ID})
+	} else {
+		j, err = newJob(jobImageScan, queue.PriorityWebhook, "push:"+p.key(), imageScanJob{Org: p.tenant.Org, Project: p.tenant.Project, Image: p.image})
+	}
+	if err == nil {
+		_, err = h.jobs.Enqueue(ctx, j)
+	}
+	if err != nil {
+		zerolog.Ctx(ctx).Error().Err(err).Msg("Failed to queue push-triggered scan")
+		return false
+	}
+	return true
+}
+
+func newJob(kind string, prio queue.Priority, key string, payload any) (jobs.Job, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return jobs.Job{}, err
+	}
+	return jobs.Job{Kind: kind, Key: key, Priority: prio, Payload: data}, nil
+}
+
+// RunJob runs a job taken from the shared job queue. Scans that failed for
+// a reason retrying cannot fix, such as the registry refusing credentials,
+// are not retried, nor are scans of a target the store does not know, so
+// they end up in the dead-letter queue rather than vanish. A target that
+// could not be read is tried again.
+func (h *Handler) RunJob(ctx context.Context, j jobs.Job) error {
+	switch j.Kind {
+	case jobTargetScan:
+		var p targetScanJob
+		if err := json.Unmarshal(j.Payload, &p); err != nil {
+			return jobs.Permanent(err)
+		}
+		t, err := h.store.GetTarget(p.TargetID)
+		if errors.Is(err, store.ErrNotFound) {
+			return jobs.Permanent(fmt.Errorf("target %s not found", p.TargetID))
+		}
+		if err != nil {
+			return fmt.Errorf("failed to load target %s: %w", p.TargetID, err)
+		}
+		_, err = h.scanTarget(ctx, t)
+		return retryable(err)
+	case jobImageScan:
+		var p imageScanJob
+		if err := json.Unmarshal(j.Payload, &p); err != nil {
+			return jobs.Permanent(err)
+		}
+		return retryable(h.scanImage(ctx, tenant.Tenant{Org: p.Org, Project: p.Project}, p.Image))
+	default:
+		return jobs.Permanent(fmt.Errorf("unknown job kind %q", j.Kind))
+	}
+}
+
+// retryable marks a scan failure retrying cannot fix as permanent.
+func retryable(err error) error {
+	if err != nil && !failure.Retryable(err) {
+		return jobs.Permanent(err)
+	}
+	return err
+}
+
+// scanImage runs the full pipeline over an image on behalf of owner.
+func (h *Handler) scanImage(ctx context.Context, owner tenant.Tenant, image string) error {
+	req := ScanRequest{TargetType: TargetTypeImage, Target: image, Summarize: true, tenant: owner}
+	_, _, err := h.runAgent(ctx, req, agent.Request{
+		TargetType:  TargetTypeImage,
+		Target:      image,
+		Summarize:   true,
+		Remediation: true,
+	})
+	return err
+}
+
+// DeadJobsHandler lists the jobs that failed for good, most recent first.
+func (h *Handler) DeadJobsHandler(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	dead, err := h.jobs.Dead(c.Request.Context(), limit)
+	if err != nil {
+		abortWithErr(c, err, "Failed to read the dead-letter queue")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"jobs": dead})
+}
+
+// RetryJobHandler moves a dead-lettered job back to the queue.
+func (h *Handler) RetryJobHandler(c *gin.Context) {
+	j, err := h.jobs.Retry(c.Request.Context(), c.Param("id"))
+	if errors.Is(err, jobs.ErrNotFound) {
+		abortWithError(c, errcode.NotFound, "Job not found", nil)
+		return
+	}
+	if err != nil {
+		abortWithErr(c, err, "Failed to retry job")
+		return
+	}
+	h.audit(c, "job.retry", nil, j)
+	c.JSON(http.StatusOK, j)
+}
+
+// DiscardJobHandler drops a dead-lettered job.
+func (h *Handler) DiscardJobHandler(c *gin.Context) {
+	err := h.jobs.Discard(c.Request.Context(), c.Param("id"))
+	if errors.Is(err, jobs.ErrNotFound) {
+		abortWithError(c, errcode.NotFound, "Job not found", nil)
+		return
+	}
+	if err != nil {
+		abortWithErr(c, err, "Failed to discard job")
+		return
+	}
+	h.audit(c, "job.discard", gin.H{"id": c.Param("id")}, nil)
+	c.Status(http.StatusNoContent)
+}
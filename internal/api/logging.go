@@ -0,0 +1,77 @@
+package api
+
+import (
+	"time"
+	"weeklysec/internal/requestid"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+// Context key under which authentication middleware records the caller.
+const identityKey = "identity"
+
+// RequestID assigns every request an ID, reusing a valid X-Request-ID sent by
+// the caller, echoes it in the response and attaches a logger carrying it to
+// the request context.
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(requestid.Header)
+		if !requestid.Valid(id) {
+			id = requestid.New()
+		}
+		c.Header(requestid.Header, id)
+
+		logger := log.Logger.With().Str("request_id", id).Logger()
+		ctx := requestid.NewContext(c.Request.Context(), id)
+		c.Request = c.Request.WithContext(logger.WithContext(ctx))
+
+		c.Next()
+	}
+}
+
+// AccessLog writes one structured log line per request.
+func AccessLog() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		status := c.Writer.Status()
+		level := zerolog.InfoLevel
+		switch {
+		case status >= 500:
+			level = zerolog.ErrorLevel
+		case status >= 400:
+			level = zerolog.WarnLevel
+		}
+
+		evt := zerolog.Ctx(c.Request.Context()).WithLevel(level).
+			Str("method", c.Request.Method).
+			Str("path", c.Request.URL.Path).
+			Int("status", status).
+			Dur("latency", time.Since(start)).
+			Str("client_ip", c.ClientIP()).
+			Int("bytes", c.Writer.Size()).
+			Str("identity", identity(c))
+		if route := c.FullPath(); route != "" {
+			evt = evt.Str("route", route)
+		}
+		if len(c.Errors) > 0 {
+			evt = evt.Str("errors", c.Errors.String())
+		}
+		evt.Msg("request")
+	}
+}
+
+// identity describes the caller: the authenticated principal when auth
+// middleware set one, else the verified client certificate, else anonymous.
+func identity(c *gin.Context) string {
+	if id := c.GetString(identityKey); id != "" {
+		return id
+	}
+	if tls := c.Request.TLS; tls != nil && len(tls.VerifiedChains) > 0 {
+		return "cert:" + tls.VerifiedChains[0][0].Subject.CommonName
+	}
+	return "anonymous"
+}
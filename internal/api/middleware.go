@@ -0,0 +1,23 @@
+package api
+
+import (
+	"net/http"
+	"weeklysec/internal/errcode"
+
+	"github.com/gin-gonic/gin"
+)
+
+// LimitBody caps the size of request bodies. A body that declares a larger
+// Content-Length is refused up front; one that turns out larger while read
+// fails with an *http.MaxBytesError, which bindScanRequest answers with
+// REQUEST_TOO_LARGE.
+func LimitBody(maxBytes int64) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.ContentLength > maxBytes {
+			abortWithError(c, errcode.RequestTooLarge, "Request body too large", gin.H{"max_bytes": maxBytes})
+			return
+		}
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxBytes)
+		c.Next()
+	}
+}
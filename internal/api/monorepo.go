@@ -0,0 +1,134 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"weeklysec/internal/agent"
+	"weeklysec/internal/errcode"
+	"weeklysec/internal/monorepo"
+
+	"github.com/gin-gonic/gin"
+)
+
+// repoScanWorkers bounds the components of one repository scanned at once;
+// the run queue still bounds the server as a whole.
+const repoScanWorkers = 4
+
+// RepoScanRequest is the body accepted by POST /api/v1/repo-scans.
+type RepoScanRequest struct {
+	Target    string `json:"target"`    // repository checked out on disk
+	Project   string `json:"project"`   // for callers scoped to a whole org
+	Summarize bool   `json:"summarize"` // summarize each component
+	Explain   bool   `json:"explain"`
+}
+
+// ScanRepoHandler finds the Dockerfiles, charts and lockfiles of a
+// repository, scans each as a scan of its own, and answers with the
+// per-component results and a repository rollup with one remediation
+// package.
+func (h *Handler) ScanRepoHandler(c *gin.Context) {
+	var body RepoScanRequest
+	if err := c.ShouldBindJSON(&body); err != nil {
+		abortWithError(c, errcode.InvalidRequest, "Invalid request body", err.Error())
+		return
+	}
+	req := ScanRequest{TargetType: TargetTypeFile, Target: body.Target, Project: body.Project}
+	if !h.prepareScanRequest(c, &req) {
+		return
+	}
+	if info, err := os.Stat(req.Target); err != nil || !info.IsDir() {
+		abortWithError(c, errcode.InvalidRequest, "Invalid request", "'target' must be a directory")
+		return
+	}
+
+	components, err := monorepo.Discover(req.Target, h.cfg.MonorepoMaxComponents)
+	switch {
+	case errors.Is(err, monorepo.ErrTooManyComponents):
+		abortWithError(c, errcode.InvalidRequest, "Invalid request",
+			fmt.Sprintf("'target' has more than %d components; scan its parts separately", h.cfg.MonorepoMaxComponents))
+		return
+	case err != nil:
+		abortWithErr(c, errcode.Wrap(errcode.ScanFailed, err), "Failed to read repository")
+		return
+	case len(components) == 0:
+		abortWithError(c, errcode.InvalidRequest, "Invalid request", "'target' has no Dockerfiles, charts or lockfiles")
+		return
+	}
+
+	results := make([]monorepo.Result, len(components))
+	sem := make(chan struct{}, repoScanWorkers)
+	var wg sync.WaitGroup
+	for i, comp := range components {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			res := monorepo.Result{Component: comp, Status: agent.StatusFailed}
+			target, err := h.componentTarget(req.Target, comp)
+			if err != nil {
+				res.Error = err.Error()
+				results[i] = res
+				return
+			}
+			part := req
+			part.TargetType, part.Target, part.targetID = comp.TargetType, target, ""
+			resp, scan, err := h.runAgent(c.Request.Context(), part, agent.Request{
+				TargetType: part.TargetType,
+				Target:     part.Target,
+				Summarize:  body.Summarize,
+				Explain:    body.Explain,
+			})
+			res.Response = resp
+			if resp != nil {
+				res.Status, res.Error, res.Analysis = resp.Status, resp.Error, resp.Analysis
+			}
+			if err != nil && res.Error == "" {
+				res.Error = err.Error()
+			}
+			if scan != nil {
+				res.ScanID = scan.ID
+			}
+			results[i] = res
+		}()
+	}
+	wg.Wait()
+
+	c.JSON(http.StatusOK, monorepo.Rollup(req.Target, results))
+}
+
+// componentTarget checks the path of comp under root as a scan request of
+// its own would be checked, and returns it resolved. A chart is scanned as
+// a directory, so every symlink in it must stay within the allowed roots
+// too.
+func (h *Handler) componentTarget(root string, comp monorepo.Component) (string, error) {
+	check := ScanRequest{TargetType: TargetTypeFile, Target: filepath.Join(root, comp.Path)}
+	if err := check.Validate(h.cfg.MaxTargetLength, h.allow); err != nil {
+		return "", err
+	}
+	if comp.Kind != monorepo.KindChart {
+		return check.Target, nil
+	}
+	err := filepath.WalkDir(check.Target, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.Type()&fs.ModeSymlink != 0 {
+			if _, err := h.allow.File(p); err != nil {
+				rel, _ := filepath.Rel(check.Target, p)
+				return fmt.Errorf("chart %s: %s: %w", comp.Path, rel, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return check.Target, nil
+}
@@ -0,0 +1,69 @@
+package api
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"weeklysec/internal/allowlist"
+	"weeklysec/internal/config"
+	"weeklysec/internal/monorepo"
+)
+
+func TestComponentTarget(t *testing.T) {
+	root, outside := t.TempDir(), t.TempDir()
+	for _, dir := range []string{"chart/templates", "evil/templates", "app"} {
+		if err := os.MkdirAll(filepath.Join(root, dir), 0o750); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, name := range []string{"chart/Chart.yaml", "evil/Chart.yaml", "app/go.mod", filepath.Join(outside, "values.yaml")} {
+		if !filepath.IsAbs(name) {
+			name = filepath.Join(root, name)
+		}
+		if err := os.WriteFile(name, nil, 0o640); err != nil {
+			t.Fatal(err)
+		}
+	}
+	links := map[string]string{
+		"evil/templates/values.yaml": filepath.Join(outside, "values.yaml"),
+		"Dockerfile":                 filepath.Join(outside, "values.yaml"),
+		"chart/values.yaml":          filepath.Join(root, "app", "go.mod"),
+	}
+	for name, target := range links {
+		if err := os.Symlink(target, filepath.Join(root, name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	allow, err := allowlist.New([]string{root}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := &Handler{cfg: &config.Config{MaxTargetLength: 4096}, allow: allow}
+	tests := []struct {
+		comp    monorepo.Component
+		wantErr bool
+	}{
+		{monorepo.Component{Path: "chart", Kind: monorepo.KindChart}, false},
+		{monorepo.Component{Path: "app/go.mod", Kind: monorepo.KindLockfile}, false},
+		{monorepo.Component{Path: "evil", Kind: monorepo.KindChart}, true},
+		{monorepo.Component{Path: "Dockerfile", Kind: monorepo.KindDockerfile}, true},
+	}
+	for _, tt := range tests {
+		got, err := h.componentTarget(root, tt.comp)
+		if tt.wantErr {
+			if !errors.Is(err, allowlist.ErrNotAllowed) {
+				t.Errorf("componentTarget(%s) error = %v, want ErrNotAllowed", tt.comp.Path, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("componentTarget(%s) error = %v", tt.comp.Path, err)
+			continue
+		}
+		if want, _ := filepath.EvalSymlinks(filepath.Join(root, tt.comp.Path)); got != want {
+			t.Errorf("componentTarget(%s) = %s, want %s", tt.comp.Path, got, want)
+		}
+	}
+}
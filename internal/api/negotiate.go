@@ -0,0 +1,218 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"weeklysec/internal/agent"
+	"weeklysec/internal/errcode"
+	"weeklysec/internal/i18n"
+	"weeklysec/internal/report"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Response formats a client can ask for.
+const (
+	formatJSON     = "json"
+	formatText     = "text"
+	formatMarkdown = "markdown"
+)
+
+var formatMediaTypes = map[string]string{
+	"application/json": formatJSON,
+	"text/plain":       formatText,
+	"text/markdown":    formatMarkdown,
+}
+
+var formatAliases = map[string]string{
+	"json":     formatJSON,
+	"text":     formatText,
+	"txt":      formatText,
+	"markdown": formatMarkdown,
+	"md":       formatMarkdown,
+}
+
+// negotiateFormat picks the response format from the `format` query parameter
+// or, failing that, the Accept header, and validates any field selection,
+// report language and custom template. It writes a 400/406 and returns false
+// when nothing acceptable can be produced.
+func negotiateFormat(c *gin.Context) (string, bool) {
+	if _, ok := selectedFields(c); !ok {
+		return "", false
+	}
+	if lang := c.Query("lang"); lang != "" {
+		catalog := i18n.Current()
+		if _, ok := catalog.Lookup(lang); !ok {
+			abortWithError(c, errcode.InvalidRequest, "Invalid request", "'lang' must be one of "+strings.Join(catalog.Tags(), ", "))
+			return "", false
+		}
+	}
+	if name := c.Query("template"); name != "" {
+		if !slices.ContainsFunc(report.CustomTemplates().List(), func(t *report.Template) bool { return t.Name == name }) {
+			abortWithError(c, errcode.InvalidRequest, "Invalid request", fmt.Sprintf("no report template %q", name))
+			return "", false
+		}
+	}
+
+	if q := c.Query("format"); q != "" {
+		if f, ok := formatAliases[strings.ToLower(q)]; ok {
+			return f, true
+		}
+		abortWithError(c, errcode.InvalidRequest, "Invalid request", "'format' must be one of json, text or markdown")
+		return "", false
+	}
+
+	accept := c.GetHeader("Accept")
+	if accept == "" {
+		return formatJSON, true
+	}
+
+	for _, mt := range parseAccept(accept) {
+		switch {
+		case mt == "*/*" || mt == "application/*":
+			return formatJSON, true
+		case mt == "text/*":
+			return formatText, true
+		}
+		if f, ok := formatMediaTypes[mt]; ok {
+			return f, true
+		}
+	}
+
+	abortWithError(c, errcode.NotAcceptable, "Not acceptable", "supported types are application/json, text/plain and text/markdown")
+	return "", false
+}
+
+// negotiateLocale picks the language of the fixed strings of text reports
+// from the `lang` query parameter or, failing that, the Accept-Language
+// header, falling back to REPORT_LOCALE.
+func negotiateLocale(c *gin.Context) *i18n.Locale {
+	catalog := i18n.Current()
+	if l, ok := catalog.Lookup(c.Query("lang")); ok {
+		return l
+	}
+	if l, ok := catalog.Match(parseAccept(c.GetHeader("Accept-Language"))...); ok {
+		return l
+	}
+	return catalog.Fallback()
+}
+
+// parseAccept returns the media ranges of an Accept header ordered by
+// descending quality, dropping those with q=0. Language ranges of an
+// Accept-Language header parse the same way.
+func parseAccept(header string) []string {
+	type ranged struct {
+		mediaType string
+		q         float64
+	}
+
+	var ranges []ranged
+	for _, part := range strings.Split(header, ",") {
+		mt, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if parsed, err := strconv.ParseFloat(v, 64); err == nil {
+				q = parsed
+			}
+		}
+		if q > 0 {
+			ranges = append(ranges, ranged{mt, q})
+		}
+	}
+
+	sort.SliceStable(ranges, func(i, j int) bool { return ranges[i].q > ranges[j].q })
+
+	out := make([]string, len(ranges))
+	for i, r := range ranges {
+		out[i] = r.mediaType
+	}
+	return out
+}
+
+// renderResponse writes resp in the negotiated format. JSON output is trimmed
+// to the requested fields, if any; text reports are always complete. A
+// custom template selected with `template` takes the place of the format.
+//
+// The body is rendered before it is written so it can be signed.
+func renderResponse(c *gin.Context, status int, format string, resp *agent.AgentResponse) {
+	t, ok := negotiateTemplate(c, report.TemplateScan)
+	if !ok {
+		return
+	}
+	if t != nil {
+		renderTemplate(c, status, t, report.TemplateData{Scan: resp})
+		return
+	}
+
+	var body []byte
+	var contentType string
+	switch format {
+	case formatText:
+		l := negotiateLocale(c)
+		body, contentType = []byte(report.Text(resp, l)), "text/plain; charset=utf-8"
+		c.Header("Content-Language", l.Lang())
+	case formatMarkdown:
+		l := negotiateLocale(c)
+		body, contentType = []byte(report.Markdown(resp, l)), "text/markdown; charset=utf-8"
+		c.Header("Content-Language", l.Lang())
+	default:
+		var v any = resp
+		if fields, _ := selectedFields(c); len(fields) > 0 {
+			shaped, err := shapeResponse(resp, fields)
+			if err != nil {
+				abortWithErr(c, err, "Failed to render response")
+				return
+			}
+			v = shaped
+		}
+		data, err := json.Marshal(v)
+		if err != nil {
+			abortWithErr(c, err, "Failed to render response")
+			return
+		}
+		body, contentType = data, "application/json; charset=utf-8"
+	}
+	signResponse(c, body)
+	c.Data(status, contentType, body)
+}
+
+// negotiateTemplate returns the custom template of kind selected with the
+// `template` query parameter, or nil when none is. It writes a 400 and
+// returns false when there is no such template.
+func negotiateTemplate(c *gin.Context, kind string) (*report.Template, bool) {
+	name := c.Query("template")
+	if name == "" {
+		return nil, true
+	}
+	templates := report.CustomTemplates()
+	if t, ok := templates.Lookup(kind, name); ok {
+		return t, true
+	}
+	abortWithError(c, errcode.InvalidRequest, "Invalid request",
+		fmt.Sprintf("'template' must be one of the %s templates: %s", kind, strings.Join(templates.Names(kind), ", ")))
+	return nil, false
+}
+
+// renderTemplate writes data rendered with the custom template t. A
+// template that fails is a server error, reported with what failed.
+func renderTemplate(c *gin.Context, status int, t *report.Template, data report.TemplateData) {
+	l := negotiateLocale(c)
+	data.GeneratedAt = time.Now().UTC()
+	body, err := t.Render(data, l)
+	if err != nil {
+		abortWithError(c, errcode.Internal, "Failed to render report template", err.Error())
+		return
+	}
+	c.Header("Content-Language", l.Lang())
+	signResponse(c, body)
+	c.Data(status, t.ContentType(), body)
+}
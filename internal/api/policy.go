@@ -0,0 +1,75 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"weeklysec/internal/digest"
+	"weeklysec/internal/errcode"
+	"weeklysec/internal/policy"
+	"weeklysec/internal/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+// PolicySetting is the store key of the policy rules set through the admin
+// API, which take precedence over POLICY_FILE.
+const PolicySetting = "policies"
+
+// judge evaluates the policy against scan, nil without rules.
+func (h *Handler) judge(scan *store.Scan) *policy.Verdict {
+	engine := h.policies.Load()
+	if engine == nil {
+		return nil
+	}
+	in := policy.Input{
+		TargetType: scan.TargetType,
+		Target:     scan.Target,
+		Org:        scan.Org,
+		Project:    scan.Project,
+		RiskScore:  digest.RiskScore(scan),
+		Findings:   digest.Open(scan),
+		KEV: func(id string) bool {
+			_, ok := h.kev.Lookup(id)
+			return ok
+		},
+	}
+	if scan.Response != nil {
+		in.Status = scan.Response.Status
+	}
+	if scan.TargetID != "" {
+		if t, err := h.store.GetTarget(scan.TargetID); err == nil {
+			in.Environment, in.Team, in.Criticality, in.Labels = t.Environment, t.Team, t.Criticality, t.Labels
+		}
+	}
+	return engine.Evaluate(in)
+}
+
+// GetPoliciesHandler returns the policy rules in effect.
+func (h *Handler) GetPoliciesHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, h.policies.Load().Rules())
+}
+
+// UpdatePoliciesHandler replaces the policy rules. Later scans are judged
+// by them; stored verdicts are kept.
+func (h *Handler) UpdatePoliciesHandler(c *gin.Context) {
+	var next policy.Rules
+	dec := json.NewDecoder(c.Request.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&next); err != nil {
+		abortWithError(c, errcode.InvalidRequest, "Invalid request body", err.Error())
+		return
+	}
+	engine, err := policy.Compile(next)
+	if err != nil {
+		abortWithError(c, errcode.InvalidRequest, "Invalid policy", err.Error())
+		return
+	}
+	if err := h.store.PutSetting(PolicySetting, engine.Rules()); err != nil {
+		abortWithErr(c, err, "Failed to save policy")
+		return
+	}
+	before := h.policies.Swap(engine).Rules()
+
+	h.audit(c, "policies.update", before, engine.Rules())
+	c.JSON(http.StatusOK, engine.Rules())
+}
@@ -0,0 +1,339 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+	"weeklysec/internal/agent"
+	"weeklysec/internal/errcode"
+	"weeklysec/internal/gate"
+	"weeklysec/internal/gitops"
+	"weeklysec/internal/queue"
+	"weeklysec/internal/registry"
+	"weeklysec/internal/store"
+	"weeklysec/internal/tenant"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+// Pre-sync image outcomes.
+const (
+	PresyncCached  = "cached"  // judged on a recent scan
+	PresyncScanned = "scanned" // scanned for this check
+	PresyncPending = "pending" // still scanning when the check timed out
+	PresyncFailed  = "failed"  // the scan failed
+)
+
+// PresyncRequest lists what a GitOps sync is about to deploy.
+type PresyncRequest struct {
+	Application string       `json:"application"` // for logs and the response
+	Manifests   string       `json:"manifests"`   // rendered YAML or JSON
+	Images      []string     `json:"images"`      // in addition to the manifests' images
+	Project     string       `json:"project"`     // for callers scoped to a whole org
+	Policy      *gate.Policy `json:"policy"`      // defaults to the GATE_* settings
+}
+
+// PresyncImage is the outcome for one image.
+type PresyncImage struct {
+	gitops.Image
+	Status    string        `json:"status"`
+	ScanID    string        `json:"scan_id,omitempty"`
+	ScannedAt *time.Time    `json:"scanned_at,omitempty"`
+	Verdict   *gate.Verdict `json:"verdict,omitempty"`
+	Error     string        `json:"error,omitempty"`
+
+	scan *store.Scan
+}
+
+func (i *PresyncImage) setScan(scan *store.Scan) {
+	i.scan = scan
+	i.ScanID = scan.ID
+	i.ScannedAt = &scan.CreatedAt
+}
+
+// PresyncResponse allows or blocks a sync.
+type PresyncResponse struct {
+	Allowed     bool           `json:"allowed"`
+	Application string         `json:"application,omitempty"`
+	Reasons     []string       `json:"reasons,omitempty"` // why it is blocked
+	Policy      gate.Policy    `json:"policy"`
+	Images      []PresyncImage `json:"images"`
+}
+
+// PresyncHandler judges the images a GitOps sync would deploy, for Argo CD
+// PreSync hooks and Flux pre-deployment checks. Scans younger than
+// PRESYNC_CACHE_TTL are reused; other images are scanned for up to
+// PRESYNC_TIMEOUT, and those still scanning then finish in the background
+// so a retried sync finds them cached. Findings only count when the last
+// scan of another tag of the same repository lacks them, so a sync is
+// blocked for what it introduces. The answer is 200 either way, with the
+// verdict in VerdictHeader.
+func (h *Handler) PresyncHandler(c *gin.Context) {
+	format, ok := negotiateFormat(c)
+	if !ok {
+		return
+	}
+	var req PresyncRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			abortWithError(c, errcode.RequestTooLarge, "Request body too large", gin.H{"max_bytes": maxErr.Limit})
+			return
+		}
+		abortWithError(c, errcode.InvalidRequest, "Invalid request body", err.Error())
+		return
+	}
+	images, err := h.presyncImages(req)
+	if err != nil {
+		abortInvalid(c, err)
+		return
+	}
+	owner, err := writeTenant(c, req.Project)
+	if err != nil {
+		abortWithError(c, errcode.Forbidden, "Forbidden", err.Error())
+		return
+	}
+	policy := h.gatePolicy()
+	if req.Policy != nil {
+		policy = *req.Policy
+	}
+
+	ctx := c.Request.Context()
+	out := PresyncResponse{Allowed: true, Application: req.Application, Policy: policy}
+	for _, img := range h.presyncScan(ctx, owner, images) {
+		switch img.Status {
+		case PresyncFailed:
+			out.Reasons = append(out.Reasons, fmt.Sprintf("%s: scan failed: %s", img.Image.Image, img.Error))
+		case PresyncPending:
+			if !h.cfg.PresyncAllowPending {
+				out.Reasons = append(out.Reasons, img.Image.Image+": still scanning, retry the sync")
+			}
+		default:
+			img.Verdict = gate.Evaluate(img.scan, h.repositoryBaseline(owner, img.scan), policy)
+			for _, r := range img.Verdict.Reasons {
+				out.Reasons = append(out.Reasons, img.Image.Image+": "+r)
+			}
+		}
+		out.Images = append(out.Images, img)
+	}
+	out.Allowed = len(out.Reasons) == 0
+
+	zerolog.Ctx(ctx).Info().
+		Str("application", req.Application).
+		Int("images", len(out.Images)).
+		Bool("allowed", out.Allowed).
+		Msg("Pre-sync check")
+
+	if out.Allowed {
+		c.Header(VerdictHeader, "pass")
+	} else {
+		c.Header(VerdictHeader, "fail")
+	}
+	switch format {
+	case formatText, formatMarkdown:
+		c.String(http.StatusOK, presyncText(out))
+	default:
+		c.JSON(http.StatusOK, out)
+	}
+}
+
+// presyncImages collects and validates the images of a request.
+func (h *Handler) presyncImages(req PresyncRequest) ([]gitops.Image, error) {
+	if strings.TrimSpace(req.Manifests) == "" && len(req.Images) == 0 {
+		return nil, fmt.Errorf("'manifests' or 'images' is required")
+	}
+	if req.Policy != nil {
+		if err := req.Policy.Validate(); err != nil {
+			return nil, fmt.Errorf("'policy' is invalid: %v", err)
+		}
+	}
+	images, err := gitops.Images([]byte(req.Manifests))
+	if err != nil {
+		return nil, fmt.Errorf("'manifests' is invalid: %v", err)
+	}
+	seen := map[string]bool{}
+	for _, img := range images {
+		seen[img.Image] = true
+	}
+	for _, ref := range req.Images {
+		if ref = strings.TrimSpace(ref); ref != "" && !seen[ref] {
+			seen[ref] = true
+			images = append(images, gitops.Image{Image: ref})
+		}
+	}
+	if len(images) == 0 {
+		return nil, fmt.Errorf("no container images found")
+	}
+	if len(images) > h.cfg.PresyncMaxImages {
+		return nil, fmt.Errorf("%d images exceed the limit of %d", len(images), h.cfg.PresyncMaxImages)
+	}
+	for _, img := range images {
+		r := ScanRequest{TargetType: TargetTypeImage, Target: img.Image}
+		if err := r.Validate(h.cfg.MaxTargetLength, h.allow); err != nil {
+			return nil, fmt.Errorf("image %q: %w", img.Image, err)
+		}
+	}
+	return images, nil
+}
+
+// presyncScan finds a scan for every image: a fresh stored one, or a new
+// one if it finishes in time.
+func (h *Handler) presyncScan(ctx context.Context, owner tenant.Tenant, images []gitops.Image) []PresyncImage {
+	out := make([]PresyncImage, len(images))
+	running := map[int]*presyncRun{}
+	for i, img := range images {
+		out[i] = PresyncImage{Image: img}
+		if scan := h.freshScan(owner, img.Image); scan != nil {
+			out[i].Status = PresyncCached
+			out[i].setScan(scan)
+			continue
+		}
+		running[i] = h.presync.start(ctx, owner, img.Image, h.presyncScanImage)
+	}
+
+	wait, cancel := context.WithTimeout(ctx, h.cfg.PresyncTimeout)
+	defer cancel()
+	for i, run := range running {
+		select {
+		case <-run.done:
+			if run.err != nil {
+				out[i].Status = PresyncFailed
+				out[i].Error = run.err.Error()
+			} else {
+				out[i].Status = PresyncScanned
+				out[i].setScan(run.scan)
+			}
+		case <-wait.Done():
+			out[i].Status = PresyncPending
+		}
+	}
+	return out
+}
+
+// presyncScanImage scans an image without the LLM steps, which a sync
+// should not wait for.
+func (h *Handler) presyncScanImage(ctx context.Context, owner tenant.Tenant, ref string) (*store.Scan, error) {
+	req := ScanRequest{TargetType: TargetTypeImage, Target: ref, tenant: owner}
+	_, scan, err := h.runAgent(ctx, req, agent.Request{TargetType: TargetTypeImage, Target: ref})
+	return scan, err
+}
+
+// freshScan returns the tenant's latest scan of an image if it is younger
+// than the pre-sync cache TTL.
+func (h *Handler) freshScan(owner tenant.Tenant, ref string) *store.Scan {
+	scans, err := h.store.ListScans(store.ScanFilter{
+		Org:     owner.Org,
+		Project: owner.Project,
+		Target:  ref,
+		Since:   time.Now().Add(-h.cfg.PresyncCacheTTL),
+	})
+	if err != nil {
+		log.Warn().Err(err).Str("target", ref).Msg("Failed to look up cached scans")
+		return nil
+	}
+	for _, s := range scans {
+		if s.TargetType == TargetTypeImage && (s.Response == nil || s.Response.Status != agent.StatusFailed) {
+			return s
+		}
+	}
+	return nil
+}
+
+// repositoryBaseline returns the latest scan of another tag or digest of
+// the scanned image's repository, standing in for what is deployed now.
+func (h *Handler) repositoryBaseline(owner tenant.Tenant, scan *store.Scan) *store.Scan {
+	scans, err := h.store.ListScans(store.ScanFilter{Org: owner.Org, Project: owner.Project, LatestOnly: true})
+	if err != nil {
+		log.Warn().Err(err).Str("target", scan.Target).Msg("Failed to look up baseline scans")
+		return nil
+	}
+	repo := registry.Parse(scan.Target)
+	for _, s := range scans {
+		if s.TargetType != TargetTypeImage || s.Target == scan.Target || s.CreatedAt.After(scan.CreatedAt) {
+			continue
+		}
+		if r := registry.Parse(s.Target); r.Repository == repo.Repository && r != repo {
+			return s
+		}
+	}
+	return nil
+}
+
+// presyncText renders a verdict as one line per image and a final
+// ALLOW or BLOCK line, for hook scripts.
+func presyncText(r PresyncResponse) string {
+	var b strings.Builder
+	for _, img := range r.Images {
+		fmt.Fprintf(&b, "%-8s %s", img.Status, img.Image.Image)
+		if v := img.Verdict; v != nil {
+			result := "pass"
+			if !v.Pass {
+				result = "fail: " + strings.Join(v.Reasons, "; ")
+			}
+			fmt.Fprintf(&b, " risk %.1f %s", v.RiskScore, result)
+		}
+		if img.Error != "" {
+			b.WriteString(" " + img.Error)
+		}
+		b.WriteString("\n")
+	}
+	if r.Allowed {
+		b.WriteString("weeklysec: ALLOW\n")
+	} else {
+		fmt.Fprintf(&b, "weeklysec: BLOCK %s\n", strings.Join(r.Reasons, "; "))
+	}
+	return b.String()
+}
+
+// presyncRun is an image scan started by a pre-sync check.
+type presyncRun struct {
+	done chan struct{}
+	scan *store.Scan
+	err  error
+}
+
+// presyncRuns bounds pre-sync scans and shares a running one between the
+// checks waiting on the same image.
+type presyncRuns struct {
+	slots chan struct{}
+
+	mu      sync.Mutex
+	running map[string]*presyncRun
+}
+
+func newPresyncRuns(concurrency int) *presyncRuns {
+	return &presyncRuns{slots: make(chan struct{}, concurrency), running: map[string]*presyncRun{}}
+}
+
+// start scans ref for owner unless that scan is already running. The scan
+// is detached from ctx so it outlives a check that stops waiting.
+func (p *presyncRuns) start(ctx context.Context, owner tenant.Tenant, ref string, scan func(context.Context, tenant.Tenant, string) (*store.Scan, error)) *presyncRun {
+	key := owner.String() + "|" + ref
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if run, ok := p.running[key]; ok {
+		return run
+	}
+	run := &presyncRun{done: make(chan struct{})}
+	p.running[key] = run
+
+	// Runs are bounded by slots already, so they wait for the agent queue.
+	ctx = queue.WithPriority(context.WithoutCancel(ctx), queue.PriorityWebhook)
+	go func() {
+		p.slots <- struct{}{}
+		run.scan, run.err = scan(ctx, owner, ref)
+		<-p.slots
+
+		p.mu.Lock()
+		delete(p.running, key)
+		p.mu.Unlock()
+		close(run.done)
+	}()
+	return run
+}
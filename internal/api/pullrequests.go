@@ -0,0 +1,486 @@
+package api
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+	"weeklysec/internal/agent"
+	"weeklysec/internal/errcode"
+	"weeklysec/internal/fixer"
+	"weeklysec/internal/github"
+	"weeklysec/internal/store"
+	"weeklysec/internal/tenant"
+	"weeklysec/internal/workspace"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+)
+
+// maxPullRequestPaths bounds the manifests one pull request may touch.
+const maxPullRequestPaths = 20
+
+// errNoFixes is returned when a scan has no fixes to propose.
+var errNoFixes = errcode.New(errcode.Conflict, "scan has no fixes to propose")
+
+// PullRequestRequest asks for a remediation pull request against a GitHub
+// repository.
+type PullRequestRequest struct {
+	Repo   string   `json:"repo"`   // owner/name
+	Paths  []string `json:"paths"`  // manifests to patch, relative to the repo root
+	Base   string   `json:"base"`   // defaults to the repo's default branch
+	Branch string   `json:"branch"` // defaults to weeklysec/fix-<scan id>
+	Token  string   `json:"token"`  // defaults to GITHUB_TOKEN where GITHUB_TOKEN_REPOS grants it
+
+	// Fixes, when set, replaces the scan's fixes with a reviewed subset,
+	// possibly with other recommended versions. Only POST
+	// /api/v1/scans/:id/pull-request honours it.
+	Fixes []agent.Fix `json:"fixes"`
+}
+
+// Validate checks the repository and manifest paths.
+func (r *PullRequestRequest) Validate() error {
+	r.Repo = strings.TrimSpace(r.Repo)
+	r.Base = strings.TrimSpace(r.Base)
+	r.Branch = strings.TrimSpace(r.Branch)
+
+	if r.Repo == "" {
+		return fmt.Errorf("'repo' is required")
+	}
+	if err := github.ValidateRepo(r.Repo); err != nil {
+		return fmt.Errorf("'repo' is invalid: %v", err)
+	}
+	if len(r.Paths) > maxPullRequestPaths {
+		return fmt.Errorf("'paths' must list at most %d files", maxPullRequestPaths)
+	}
+	for i, p := range r.Paths {
+		p = path.Clean(strings.TrimPrefix(strings.TrimSpace(p), "/"))
+		if p == "." || strings.HasPrefix(p, "../") || p == ".." {
+			return fmt.Errorf("'paths' must be relative to the repository root")
+		}
+		if !fixer.Supported(p) {
+			return fmt.Errorf("'paths' contains %q, which is not a supported manifest", p)
+		}
+		r.Paths[i] = p
+	}
+	if strings.ContainsAny(r.Branch, " ~^:?*[\\") {
+		return fmt.Errorf("'branch' is not a valid branch name")
+	}
+	return nil
+}
+
+// CreatePullRequestHandler opens a pull request that applies a stored
+// scan's fixes to the given manifests, and records it on the scan.
+func (h *Handler) CreatePullRequestHandler(c *gin.Context) {
+	var req PullRequestRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		abortWithError(c, errcode.InvalidRequest, "Invalid request body", err.Error())
+		return
+	}
+	if err := req.Validate(); err != nil {
+		abortWithError(c, errcode.InvalidRequest, "Invalid request", err.Error())
+		return
+	}
+
+	scan, ok := h.loadScan(c)
+	if !ok {
+		return
+	}
+	if scan.Response == nil {
+		abortWithError(c, errcode.Conflict, "Scan has no analysis", nil)
+		return
+	}
+
+	resp := *scan.Response
+	if len(req.Fixes) > 0 {
+		var proposed []agent.Fix
+		if resp.Remediation != nil {
+			proposed = resp.Remediation.Fixes
+		}
+		fixes, err := fixer.Select(proposed, req.Fixes)
+		if err != nil {
+			abortWithError(c, errcode.InvalidRequest, "Invalid request", "'fixes': "+err.Error())
+			return
+		}
+		// The generated commit message and description cover every fix, so
+		// a reviewed subset gets the plain ones.
+		resp.Remediation = &agent.RemediationPackage{Fixes: fixes}
+	}
+	pr, err := h.openPullRequest(c.Request.Context(), scan, &resp, req)
+	if err != nil {
+		abortWithErr(c, err, "Failed to open pull request")
+		return
+	}
+
+	resp.PullRequest = pr
+	resp.Remediation = scan.Response.Remediation
+	updated := *scan
+	updated.Response = &resp
+	if err := h.store.SaveScan(&updated); err != nil {
+		log.Error().Err(err).Str("scan_id", scan.ID).Msg("Failed to record pull request")
+	}
+	c.JSON(http.StatusCreated, pr)
+}
+
+// proposeFixes opens the pull request asked for alongside a scan, recording
+// the outcome as a step of resp. A failure makes the run partial.
+func (h *Handler) proposeFixes(ctx context.Context, scan *store.Scan, resp *agent.AgentResponse, req PullRequestRequest) {
+	start := time.Now()
+	pr, err := h.openPullRequest(ctx, scan, resp, req)
+	step := agent.StepResult{Step: agent.StepPullRequest, Status: agent.StepSucceeded, DurationMS: time.Since(start).Milliseconds()}
+	if err != nil {
+		step.Status = agent.StepFailed
+		step.Error = err.Error()
+		step.ErrorCode = errcode.Of(err)
+		if resp.Status == agent.StatusCompleted {
+			resp.Status = agent.StatusPartial
+		}
+	}
+	resp.PullRequest = pr
+	resp.StepResults = append(resp.StepResults, step)
+
+	if err := h.store.SaveScan(scan); err != nil {
+		log.Error().Err(err).Str("scan_id", scan.ID).Msg("Failed to record pull request")
+	}
+}
+
+// openPullRequest applies resp's fixes to the manifests named by req and
+// opens a pull request with the generated commit message and description.
+// For file targets the paths default to the scanned file's name. The
+// patched files are kept in the scan's workspace.
+func (h *Handler) openPullRequest(ctx context.Context, scan *store.Scan, resp *agent.AgentResponse, req PullRequestRequest) (*agent.PullRequest, error) {
+	target := scan.Target
+	rem := resp.Remediation
+	if rem == nil || len(rem.Fixes) == 0 {
+		return nil, errNoFixes
+	}
+	paths, err := fixPaths(scan.TargetType, target, req.Paths)
+	if err != nil {
+		return nil, err
+	}
+	token, err := h.githubToken(req.Token, req.Repo, owner(scan))
+	if err != nil {
+		return nil, err
+	}
+
+	branch := req.Branch
+	if branch == "" {
+		branch = "weeklysec/fix-" + resp.ScanID
+	}
+
+	var edits editResult
+	ch := github.Change{
+		Repo:          req.Repo,
+		Base:          req.Base,
+		Branch:        branch,
+		Title:         rem.PRTitle,
+		Body:          rem.PRDescription,
+		CommitMessage: rem.CommitMessage,
+		Paths:         paths,
+		Edit:          applyFixes(rem.Fixes, &edits),
+	}
+	if ch.Title == "" {
+		ch.Title = fmt.Sprintf("Fix vulnerable dependencies in %s", target)
+	}
+	if ch.CommitMessage == "" {
+		ch.CommitMessage = ch.Title
+	}
+	if ch.Body == "" {
+		ch.Body = fixList(rem.Fixes)
+	}
+
+	pr, err := github.New(h.cfg.GitHubAPIURL, token).OpenPullRequest(ctx, ch)
+	if err != nil {
+		return nil, err
+	}
+	h.keepEdits(scan, edits)
+	return &agent.PullRequest{
+		Repo:     req.Repo,
+		Number:   pr.Number,
+		URL:      pr.URL,
+		Branch:   branch,
+		Base:     pr.Base,
+		Files:    pr.Files,
+		Packages: edits.packages,
+		Rejected: edits.rejected,
+		OpenedAt: time.Now().UTC(),
+	}, nil
+}
+
+// fixPaths returns the manifests to patch for a target: paths, or for file
+// targets the scanned file's name.
+func fixPaths(targetType, target string, paths []string) ([]string, error) {
+	if len(paths) > 0 {
+		return paths, nil
+	}
+	if name := filepath.Base(target); targetType == TargetTypeFile && fixer.Supported(name) {
+		return []string{name}, nil
+	}
+	return nil, errcode.New(errcode.InvalidRequest, "'paths' is required for this target")
+}
+
+// githubToken returns token, or when it is empty GITHUB_TOKEN if every one
+// of owners is granted repo by GITHUB_TOKEN_REPOS.
+func (h *Handler) githubToken(token, repo string, owners ...tenant.Tenant) (string, error) {
+	if token != "" {
+		return token, nil
+	}
+	if h.cfg.GitHubToken == "" {
+		return "", errcode.New(errcode.InvalidRequest, "'token' is required when GITHUB_TOKEN is not set")
+	}
+	for _, t := range owners {
+		if !h.tokenGrants.Allows(t.Org, t.Project, repo) {
+			return "", errcode.New(errcode.Forbidden, fmt.Sprintf("'token' is required: GITHUB_TOKEN is not granted to %s on %s", t, repo))
+		}
+	}
+	return h.cfg.GitHubToken, nil
+}
+
+// owner returns the tenant a scan belongs to.
+func owner(scan *store.Scan) tenant.Tenant {
+	return tenant.Tenant{Org: scan.Org, Project: scan.Project}
+}
+
+// editResult collects what the edits of a pull request did.
+type editResult struct {
+	packages []string            // bumped
+	rejected []agent.RejectedFix // left out because the file would not parse
+	files    []editedFile
+}
+
+// editedFile is a file an edit changed.
+type editedFile struct {
+	path          string
+	before, after []byte
+}
+
+// applyFixes returns an edit applying fixes, noting the packages it bumps
+// and the fixes it rejects into res.
+func applyFixes(fixes []agent.Fix, res *editResult) func(string, []byte) ([]byte, bool) {
+	return func(p string, content []byte) ([]byte, bool) {
+		out, applied, rejected := fixer.Apply(p, content, fixes)
+		for _, f := range applied {
+			if !slices.Contains(res.packages, f.PkgName) {
+				res.packages = append(res.packages, f.PkgName)
+			}
+		}
+		res.rejected = append(res.rejected, rejected...)
+		if len(applied) > 0 {
+			res.files = append(res.files, editedFile{path: p, before: content, after: out})
+		}
+		return out, len(applied) > 0
+	}
+}
+
+// keepEdits stores the files a pull request for scan changed, and their
+// diffs, in the scan's workspace. The pull request is open by then, so
+// failures are only logged.
+func (h *Handler) keepEdits(scan *store.Scan, res editResult) {
+	if h.spaces == nil || len(res.files) == 0 {
+		return
+	}
+	ws, err := h.spaces.Open(scan.ID, scan.Org, scan.Project)
+	if err == nil {
+		for _, f := range res.files {
+			if err = ws.Write(workspace.KindPatched, f.path, f.after); err != nil {
+				break
+			}
+			if err = ws.Write(workspace.KindDiff, f.path+".diff", []byte(fixer.Diff(f.path, f.before, f.after))); err != nil {
+				break
+			}
+		}
+	}
+	if err != nil {
+		log.Warn().Err(err).Str("scan_id", scan.ID).Msg("Failed to keep patched files in the workspace")
+	}
+}
+
+// fixList renders fixes as a Markdown list.
+func fixList(fixes []agent.Fix) string {
+	var b strings.Builder
+	for _, f := range fixes {
+		fmt.Fprintf(&b, "- %s\n", f.Description)
+	}
+	return b.String()
+}
+
+// maxPullRequestScans bounds the scans one repository pull request may
+// combine.
+const maxPullRequestScans = 20
+
+// RepoPullRequestRequest asks for one pull request that applies the fixes
+// of several scans whose targets live in the same repository, such as the
+// images built from its Dockerfiles, instead of one pull request each.
+type RepoPullRequestRequest struct {
+	Repo   string                `json:"repo"`   // owner/name
+	Base   string                `json:"base"`   // defaults to the repo's default branch
+	Branch string                `json:"branch"` // defaults to weeklysec/fix-<new id>
+	Token  string                `json:"token"`  // defaults to GITHUB_TOKEN where GITHUB_TOKEN_REPOS grants it
+	Scans  []RepoPullRequestScan `json:"scans"`
+}
+
+// RepoPullRequestScan names a scan and the manifests its fixes apply to.
+type RepoPullRequestScan struct {
+	ScanID string   `json:"scan_id"`
+	Paths  []string `json:"paths"` // relative to the repo root; defaults as for a single scan
+}
+
+// Validate checks the repository, scans and manifest paths.
+func (r *RepoPullRequestRequest) Validate() error {
+	single := PullRequestRequest{Repo: r.Repo, Base: r.Base, Branch: r.Branch}
+	if err := single.Validate(); err != nil {
+		return err
+	}
+	r.Repo, r.Base, r.Branch = single.Repo, single.Base, single.Branch
+
+	switch {
+	case len(r.Scans) == 0:
+		return fmt.Errorf("'scans' is required")
+	case len(r.Scans) > maxPullRequestScans:
+		return fmt.Errorf("'scans' must list at most %d scans", maxPullRequestScans)
+	}
+	seen := map[string]bool{}
+	paths := 0
+	for i := range r.Scans {
+		s := &r.Scans[i]
+		s.ScanID = strings.TrimSpace(s.ScanID)
+		switch {
+		case s.ScanID == "":
+			return fmt.Errorf("'scans[%d].scan_id' is required", i)
+		case seen[s.ScanID]:
+			return fmt.Errorf("'scans' lists %s twice", s.ScanID)
+		}
+		seen[s.ScanID] = true
+		check := PullRequestRequest{Repo: r.Repo, Paths: s.Paths}
+		if err := check.Validate(); err != nil {
+			return fmt.Errorf("'scans[%d]': %v", i, err)
+		}
+		paths += len(s.Paths)
+	}
+	if paths > maxPullRequestPaths {
+		return fmt.Errorf("the scans must list at most %d files together", maxPullRequestPaths)
+	}
+	return nil
+}
+
+// CreateRepoPullRequestHandler opens one pull request for several scans of
+// targets in the same repository, with a commit per target, and records it
+// on every scan.
+func (h *Handler) CreateRepoPullRequestHandler(c *gin.Context) {
+	var req RepoPullRequestRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		abortWithError(c, errcode.InvalidRequest, "Invalid request body", err.Error())
+		return
+	}
+	if err := req.Validate(); err != nil {
+		abortWithError(c, errcode.InvalidRequest, "Invalid request", err.Error())
+		return
+	}
+	t := tenant.FromContext(c.Request.Context())
+
+	var (
+		scans   []*store.Scan
+		commits []github.Commit
+		edits   = make([]editResult, len(req.Scans))
+		body    strings.Builder
+	)
+	for i, s := range req.Scans {
+		scan, err := h.store.GetScan(s.ScanID)
+		if err == nil && !t.Allows(scan.Org, scan.Project) {
+			err = store.ErrNotFound
+		}
+		if errors.Is(err, store.ErrNotFound) {
+			abortWithError(c, errcode.NotFound, "Scan not found", gin.H{"scan_id": s.ScanID})
+			return
+		}
+		if err != nil {
+			abortWithErr(c, err, "Failed to load scan")
+			return
+		}
+		if scan.Response == nil || scan.Response.Remediation == nil || len(scan.Response.Remediation.Fixes) == 0 {
+			abortWithError(c, errcode.Conflict, "Scan has no fixes to propose", gin.H{"scan_id": s.ScanID})
+			return
+		}
+		paths, err := fixPaths(scan.TargetType, scan.Target, s.Paths)
+		if err != nil {
+			abortWithErr(c, err, "Invalid request")
+			return
+		}
+
+		rem := scan.Response.Remediation
+		message := cmp.Or(rem.CommitMessage, fmt.Sprintf("Fix vulnerable dependencies in %s", scan.Target))
+		commits = append(commits, github.Commit{Message: message, Paths: paths, Edit: applyFixes(rem.Fixes, &edits[i])})
+		fmt.Fprintf(&body, "### %s\n\n%s\n\n", scan.Target, strings.TrimSpace(cmp.Or(rem.PRDescription, fixList(rem.Fixes))))
+		scans = append(scans, scan)
+	}
+
+	owners := make([]tenant.Tenant, len(scans))
+	for i, scan := range scans {
+		owners[i] = owner(scan)
+	}
+	token, err := h.githubToken(req.Token, req.Repo, owners...)
+	if err != nil {
+		abortWithErr(c, err, "Invalid request")
+		return
+	}
+	branch := cmp.Or(req.Branch, "weeklysec/fix-"+store.NewID())
+	ch := github.Change{
+		Repo:    req.Repo,
+		Base:    req.Base,
+		Branch:  branch,
+		Title:   fmt.Sprintf("Fix vulnerable dependencies in %d targets", len(scans)),
+		Body:    body.String(),
+		Commits: commits,
+	}
+	if len(scans) == 1 {
+		ch.Title = cmp.Or(scans[0].Response.Remediation.PRTitle, fmt.Sprintf("Fix vulnerable dependencies in %s", scans[0].Target))
+	}
+	opened, err := github.New(h.cfg.GitHubAPIURL, token).OpenPullRequest(c.Request.Context(), ch)
+	if err != nil {
+		abortWithErr(c, err, "Failed to open pull request")
+		return
+	}
+	for i, scan := range scans {
+		h.keepEdits(scan, edits[i])
+	}
+
+	now := time.Now().UTC()
+	ids := make([]string, len(scans))
+	for i, scan := range scans {
+		ids[i] = scan.ID
+	}
+	all := &agent.PullRequest{
+		Repo:     req.Repo,
+		Number:   opened.Number,
+		URL:      opened.URL,
+		Branch:   branch,
+		Base:     opened.Base,
+		Files:    opened.Files,
+		Packages: []string{},
+		Scans:    ids,
+		OpenedAt: now,
+	}
+	for i, scan := range scans {
+		pr := *all
+		pr.Packages, pr.Rejected = edits[i].packages, edits[i].rejected
+		for _, p := range edits[i].packages {
+			if !slices.Contains(all.Packages, p) {
+				all.Packages = append(all.Packages, p)
+			}
+		}
+		resp := *scan.Response
+		resp.PullRequest = &pr
+		updated := *scan
+		updated.Response = &resp
+		if err := h.store.SaveScan(&updated); err != nil {
+			log.Error().Err(err).Str("scan_id", scan.ID).Msg("Failed to record pull request")
+		}
+	}
+	c.JSON(http.StatusCreated, all)
+}
@@ -0,0 +1,180 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+	"weeklysec/internal/agent"
+	"weeklysec/internal/errcode"
+	"weeklysec/internal/quota"
+	"weeklysec/internal/tenant"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog"
+)
+
+// QuotasSetting is the store key of the monthly budgets set through the
+// admin API.
+const QuotasSetting = "quotas"
+
+// UsageHandler reports this month's usage of the caller's org, project
+// and credentials against their budgets.
+func (h *Handler) UsageHandler(c *gin.Context) {
+	t := tenant.FromContext(c.Request.Context())
+	usage, err := h.quota.Status(quota.Scopes(t, identity(c)))
+	if err != nil {
+		abortWithErr(c, err, "Failed to read usage")
+		return
+	}
+	if usage == nil {
+		usage = []quota.Status{}
+	}
+	c.JSON(http.StatusOK, gin.H{"month": quota.Month(time.Now()), "usage": usage})
+}
+
+// AllUsageHandler reports this month's usage of every scope.
+func (h *Handler) AllUsageHandler(c *gin.Context) {
+	usage, err := h.quota.All()
+	if err != nil {
+		abortWithErr(c, err, "Failed to list usage")
+		return
+	}
+	if usage == nil {
+		usage = []quota.Status{}
+	}
+	c.JSON(http.StatusOK, gin.H{"month": quota.Month(time.Now()), "usage": usage})
+}
+
+// GetQuotasHandler returns the monthly budgets in effect.
+func (h *Handler) GetQuotasHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, h.quota.Budgets())
+}
+
+// UpdateQuotasHandler replaces the monthly budgets.
+func (h *Handler) UpdateQuotasHandler(c *gin.Context) {
+	var next quota.Config
+	dec := json.NewDecoder(c.Request.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&next); err != nil {
+		abortWithError(c, errcode.InvalidRequest, "Invalid request body", err.Error())
+		return
+	}
+	if err := next.Validate(); err != nil {
+		abortWithError(c, errcode.InvalidRequest, "Invalid quotas", err.Error())
+		return
+	}
+	if next.Budgets == nil {
+		next.Budgets = []quota.Budget{}
+	}
+	if err := h.store.PutSetting(QuotasSetting, next); err != nil {
+		abortWithErr(c, err, "Failed to save quotas")
+		return
+	}
+	before := h.quota.Budgets()
+	h.quota.SetBudgets(next)
+
+	h.audit(c, "quotas.update", before, next)
+	c.JSON(http.StatusOK, next)
+}
+
+// MetricsHandler exposes this month's usage and budgets, the load of the
+// work queues, the time to remediate findings and the failing targets in
+// the Prometheus text format.
+func (h *Handler) MetricsHandler(c *gin.Context) {
+	usage, err := h.quota.All()
+	if err != nil {
+		abortWithErr(c, err, "Failed to list usage")
+		return
+	}
+	var b strings.Builder
+	gauge := func(name, help string, value func(quota.Status) (float64, bool)) {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s gauge\n", name, help, name)
+		for _, s := range usage {
+			if v, ok := value(s); ok {
+				fmt.Fprintf(&b, "%s{scope=%q} %g\n", name, s.Scope, v)
+			}
+		}
+	}
+	limit := func(get func(quota.Budget) float64) func(quota.Status) (float64, bool) {
+		return func(s quota.Status) (float64, bool) {
+			if s.Budget == nil || get(*s.Budget) == 0 {
+				return 0, false
+			}
+			return get(*s.Budget), true
+		}
+	}
+
+	gauge("weeklysec_quota_scans", "Scans this month.", func(s quota.Status) (float64, bool) { return float64(s.Scans), true })
+	gauge("weeklysec_quota_tokens", "Estimated LLM tokens this month.", func(s quota.Status) (float64, bool) { return float64(s.Tokens), true })
+	gauge("weeklysec_quota_cost", "Estimated LLM spend this month.", func(s quota.Status) (float64, bool) { return s.Cost, true })
+	gauge("weeklysec_quota_scans_limit", "Monthly scan budget.", limit(func(b quota.Budget) float64 { return float64(b.Scans) }))
+	gauge("weeklysec_quota_tokens_limit", "Monthly LLM token budget.", limit(func(b quota.Budget) float64 { return float64(b.Tokens) }))
+	gauge("weeklysec_quota_cost_limit", "Monthly LLM spend budget.", limit(func(b quota.Budget) float64 { return b.Cost }))
+	gauge("weeklysec_quota_exceeded", "1 when the scope's budget is used up.", func(s quota.Status) (float64, bool) {
+		if s.Exceeded {
+			return 1, true
+		}
+		return 0, s.Budget != nil
+	})
+	h.writeQueueMetrics(&b)
+	if err := h.writeMTTRMetrics(&b); err != nil {
+		abortWithErr(c, err, "Failed to list findings")
+		return
+	}
+	if err := h.writeFailureMetrics(&b); err != nil {
+		abortWithErr(c, err, "Failed to list targets")
+		return
+	}
+
+	c.Data(http.StatusOK, "text/plain; version=0.0.4; charset=utf-8", []byte(b.String()))
+}
+
+// checkQuota decides how a run counted against scopes may go. A rejected
+// run, or one whose usage cannot be read, gets a failed response and an
+// error; a degraded one has its LLM steps skipped.
+func (h *Handler) checkQuota(scopes []string, areq *agent.Request) (*agent.AgentResponse, error) {
+	d, err := h.quota.Check(scopes)
+	return quotaDecision(d, err, areq)
+}
+
+// reserveQuota counts a scan against scopes before it runs and decides how
+// it may go as checkQuota does. A scan that then does not run must be
+// given back with releaseQuota.
+func (h *Handler) reserveQuota(scopes []string, areq *agent.Request) (*agent.AgentResponse, error) {
+	d, err := h.quota.Reserve(scopes)
+	return quotaDecision(d, err, areq)
+}
+
+// releaseQuota gives back a scan reserved over scopes that did not run.
+func (h *Handler) releaseQuota(ctx context.Context, scopes []string) {
+	if err := h.quota.Release(scopes); err != nil {
+		zerolog.Ctx(ctx).Error().Err(err).Msg("Failed to release quota")
+	}
+}
+
+func quotaDecision(d quota.Decision, err error, areq *agent.Request) (*agent.AgentResponse, error) {
+	if err != nil {
+		return failedRun(areq, err), err
+	}
+	switch d.Action {
+	case quota.ActionReject:
+		err := errcode.New(errcode.QuotaExceeded, d.Err())
+		return failedRun(areq, err), err
+	case quota.ActionDegrade:
+		areq.SkipLLM = errcode.New(errcode.QuotaExceeded, d.Err()+"; LLM steps are skipped")
+	}
+	return nil, nil
+}
+
+// recordUsage counts the LLM tokens of a finished run against scopes.
+func (h *Handler) recordUsage(ctx context.Context, scopes []string, resp *agent.AgentResponse) {
+	if resp.LLMUsage == nil {
+		return
+	}
+	if err := h.quota.Record(scopes, 0, resp.LLMUsage.EstimatedTokens); err != nil {
+		zerolog.Ctx(ctx).Error().Err(err).Msg("Failed to record quota usage")
+	}
+}
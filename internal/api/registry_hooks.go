@@ -0,0 +1,190 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"slices"
+	"sync"
+	"weeklysec/internal/errcode"
+	"weeklysec/internal/queue"
+	"weeklysec/internal/registry"
+	"weeklysec/internal/store"
+	"weeklysec/internal/tenant"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog"
+)
+
+// pushScan is a queued scan of a pushed image, either of a registered
+// target or of the image itself on behalf of a tenant.
+type pushScan struct {
+	ctx    context.Context
+	target *store.Target
+	tenant tenant.Tenant
+	image  string
+}
+
+func (j pushScan) key() string {
+	if j.target != nil {
+		return "target:" + j.target.ID
+	}
+	return j.tenant.String() + "|" + j.image
+}
+
+// pushQueue runs push-triggered scans one at a time, dropping duplicates
+// of scans still waiting.
+type pushQueue struct {
+	jobs chan pushScan
+
+	mu      sync.Mutex
+	pending map[string]bool
+}
+
+func newPushQueue(h *Handler, size int) *pushQueue {
+	q := &pushQueue{jobs: make(chan pushScan, size), pending: map[string]bool{}}
+	go func() {
+		for j := range q.jobs {
+			q.done(j)
+			j.ctx = queue.WithPriority(j.ctx, queue.PriorityWebhook)
+			h.runPushScan(j)
+		}
+	}()
+	return q
+}
+
+// add queues j and reports whether it is now waiting, which it already
+// was if a duplicate is queued. It returns false when the queue is full.
+func (q *pushQueue) add(j pushScan) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.pending[j.key()] {
+		return true
+	}
+	select {
+	case q.jobs <- j:
+		q.pending[j.key()] = true
+		return true
+	default:
+		return false
+	}
+}
+
+func (q *pushQueue) done(j pushScan) {
+	q.mu.Lock()
+	delete(q.pending, j.key())
+	q.mu.Unlock()
+}
+
+// RegistryHookHandler accepts a push event from a container registry and
+// queues scans of the pushed images. Images are matched to registered
+// targets of the same repository across tenants: a target pinned to the
+// pushed tag or digest is scanned as such, otherwise the pushed image is
+// scanned for the target's tenant. Images no target knows go to the
+// configured fallback tenant, or are ignored without one.
+func (h *Handler) RegistryHookHandler(c *gin.Context) {
+	provider := c.Param("provider")
+	if !slices.Contains(registry.Providers, provider) {
+		abortWithError(c, errcode.NotFound, "Unknown registry provider", gin.H{"supported": registry.Providers})
+		return
+	}
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			abortWithError(c, errcode.RequestTooLarge, "Request body too large", gin.H{"max_bytes": maxErr.Limit})
+			return
+		}
+		abortWithError(c, errcode.InvalidRequest, "Invalid request body", err.Error())
+		return
+	}
+	images, err := registry.ParseEvent(provider, body)
+	if err != nil {
+		abortWithError(c, errcode.InvalidRequest, "Invalid registry event", err.Error())
+		return
+	}
+
+	ctx := context.WithoutCancel(c.Request.Context())
+	queued, dropped := 0, 0
+	for _, image := range images {
+		req := ScanRequest{TargetType: TargetTypeImage, Target: image}
+		if err := req.Validate(h.cfg.MaxTargetLength, h.allow); err != nil {
+			zerolog.Ctx(ctx).Warn().Err(err).Str("image", image).Msg("Ignoring pushed image")
+			continue
+		}
+		jobs, err := h.pushScans(req.Target)
+		if err != nil {
+			abortWithErr(c, err, "Failed to list targets")
+			return
+		}
+		for _, j := range jobs {
+			j.ctx = ctx
+			if h.queuePush(ctx, j) {
+				queued++
+			} else {
+				dropped++
+			}
+		}
+	}
+	if dropped > 0 && queued == 0 {
+		abortWithError(c, errcode.TooManyRequests, "Scan queue is full", nil)
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{"images": images, "queued": queued, "dropped": dropped})
+}
+
+// pushScans returns the scans a push of image calls for.
+func (h *Handler) pushScans(image string) ([]pushScan, error) {
+	targets, err := h.store.ListTargets(store.TargetFilter{})
+	if err != nil {
+		return nil, err
+	}
+	pushed := registry.Parse(image)
+	var jobs []pushScan
+	exact := map[string]bool{}
+	var others []tenant.Tenant
+	for _, t := range targets {
+		if t.TargetType != TargetTypeImage {
+			continue
+		}
+		ref := registry.Parse(t.Target)
+		if ref.Repository != pushed.Repository {
+			continue
+		}
+		owner := tenant.Tenant{Org: t.Org, Project: t.Project}
+		if (ref.Tag == pushed.Tag && ref.Digest == pushed.Digest) || (ref.Digest != "" && ref.Digest == pushed.Digest) {
+			jobs = append(jobs, pushScan{target: &t, tenant: owner})
+			exact[owner.String()] = true
+		} else {
+			others = append(others, owner)
+		}
+	}
+	seen := map[string]bool{}
+	for _, owner := range others {
+		if exact[owner.String()] || seen[owner.String()] {
+			continue
+		}
+		seen[owner.String()] = true
+		jobs = append(jobs, pushScan{tenant: owner, image: image})
+	}
+	if len(jobs) == 0 && h.cfg.RegistryWebhookTenant != "" {
+		if owner, err := tenant.Parse(h.cfg.RegistryWebhookTenant); err == nil {
+			jobs = append(jobs, pushScan{tenant: owner, image: image})
+		}
+	}
+	return jobs, nil
+}
+
+func (h *Handler) runPushScan(j pushScan) {
+	logger := zerolog.Ctx(j.ctx)
+	if j.target != nil {
+		if _, err := h.scanTarget(j.ctx, *j.target); err != nil {
+			logger.Warn().Err(err).Str("target_id", j.target.ID).Msg("Push-triggered target scan failed")
+		}
+		return
+	}
+	if err := h.scanImage(j.ctx, j.tenant, j.image); err != nil {
+		logger.Warn().Err(err).Str("image", j.image).Msg("Push-triggered scan failed")
+	}
+}
@@ -0,0 +1,334 @@
+package api
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/mail"
+	"slices"
+	"strings"
+	"time"
+	"weeklysec/internal/errcode"
+	"weeklysec/internal/i18n"
+	"weeklysec/internal/store"
+	"weeklysec/internal/tenant"
+	"weeklysec/internal/webhook"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog"
+)
+
+// Formats a scheduled report can be emailed in. HTML is the body with a
+// plain text alternative; PDF and JSON come as an attachment to the text.
+const (
+	ReportFormatHTML     = "html"
+	ReportFormatText     = "text"
+	ReportFormatMarkdown = "markdown"
+	ReportFormatPDF      = "pdf"
+	ReportFormatJSON     = "json"
+)
+
+var reportFormats = []string{ReportFormatHTML, ReportFormatText, ReportFormatMarkdown, ReportFormatPDF, ReportFormatJSON}
+
+// maxReportPeriodDays bounds the period a scheduled report covers.
+const maxReportPeriodDays = 90
+
+// ReportScheduleRequest is the body accepted when creating or replacing a
+// report schedule.
+type ReportScheduleRequest struct {
+	Name       string `json:"name"`
+	Project    string `json:"project"` // defaults to the caller's project, "*" for the whole org
+	Team       string `json:"team"`
+	Day        string `json:"day"`         // e.g. "monday"
+	Hour       int    `json:"hour"`        // 0-23
+	Timezone   string `json:"timezone"`    // IANA name, default UTC
+	PeriodDays int    `json:"period_days"` // default 7
+	Format     string `json:"format"`      // default html
+	Locale     string `json:"locale"`      // default REPORT_LOCALE
+
+	Email         []string `json:"email"`
+	WebhookURL    string   `json:"webhook_url"`
+	WebhookSecret string   `json:"webhook_secret"`
+	Chat          bool     `json:"chat"`
+
+	Paused bool `json:"paused"`
+}
+
+// Validate checks the slot, format and destinations, filling in defaults.
+func (r *ReportScheduleRequest) Validate() error {
+	r.Name = strings.TrimSpace(r.Name)
+	r.Team = strings.TrimSpace(r.Team)
+	r.Timezone = cmp.Or(strings.TrimSpace(r.Timezone), "UTC")
+	r.Format = cmp.Or(strings.ToLower(strings.TrimSpace(r.Format)), ReportFormatHTML)
+	if r.PeriodDays == 0 {
+		r.PeriodDays = 7
+	}
+
+	day, ok := store.ParseWeekday(r.Day)
+	switch {
+	case !ok:
+		return fmt.Errorf("'day' must be a day of the week such as monday")
+	case r.Hour < 0 || r.Hour > 23:
+		return fmt.Errorf("'hour' must be between 0 and 23")
+	case r.PeriodDays < 1 || r.PeriodDays > maxReportPeriodDays:
+		return fmt.Errorf("'period_days' must be between 1 and %d", maxReportPeriodDays)
+	case !slices.Contains(reportFormats, r.Format):
+		return fmt.Errorf("'format' must be one of %s", strings.Join(reportFormats, ", "))
+	case len(r.Email) == 0 && r.WebhookURL == "" && !r.Chat:
+		return fmt.Errorf("'email', 'webhook_url' or 'chat' is required")
+	}
+	r.Day = strings.ToLower(day.String())
+	if r.Locale = strings.TrimSpace(r.Locale); r.Locale != "" {
+		catalog := i18n.Current()
+		l, ok := catalog.Lookup(r.Locale)
+		if !ok {
+			return fmt.Errorf("'locale' must be one of %s", strings.Join(catalog.Tags(), ", "))
+		}
+		r.Locale = l.Tag
+	}
+	if _, err := time.LoadLocation(r.Timezone); err != nil {
+		return fmt.Errorf("'timezone' is not a known time zone")
+	}
+	if r.WebhookURL != "" {
+		if err := webhook.ValidateEndpoint(r.WebhookURL); err != nil {
+			return err
+		}
+	}
+	for _, addr := range r.Email {
+		if _, err := mail.ParseAddress(addr); err != nil {
+			return fmt.Errorf("'email' has an invalid address %q", addr)
+		}
+	}
+	return nil
+}
+
+// ListReportSchedulesHandler lists the caller's report schedules.
+func (h *Handler) ListReportSchedulesHandler(c *gin.Context) {
+	t := tenant.FromContext(c.Request.Context())
+	schedules, err := h.store.ListReportSchedules(t.Org, t.Project)
+	if err != nil {
+		abortWithErr(c, err, "Failed to list report schedules")
+		return
+	}
+	out := make([]store.ReportSchedule, len(schedules))
+	for i, rs := range schedules {
+		out[i] = rs.Redacted()
+	}
+	c.JSON(http.StatusOK, gin.H{"report_schedules": out})
+}
+
+func (h *Handler) GetReportScheduleHandler(c *gin.Context) {
+	rs, ok := h.loadReportSchedule(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, rs.Redacted())
+}
+
+func (h *Handler) CreateReportScheduleHandler(c *gin.Context) {
+	req, ok := bindReportScheduleRequest(c)
+	if !ok {
+		return
+	}
+	t := tenant.FromContext(c.Request.Context())
+	project := cmp.Or(req.Project, t.Project)
+	if !t.AllowsProject(project) {
+		abortWithError(c, errcode.Forbidden, "Forbidden", fmt.Sprintf("not allowed to write to project %q", project))
+		return
+	}
+	t, err := tenant.Parse(t.Org + "/" + project)
+	if err != nil {
+		abortWithError(c, errcode.InvalidRequest, "Invalid request", err.Error())
+		return
+	}
+
+	now := time.Now().UTC()
+	rs := store.ReportSchedule{
+		ID:        store.NewID(),
+		Org:       t.Org,
+		Project:   t.Project,
+		CreatedBy: identity(c),
+		CreatedAt: now,
+	}
+	applyReportScheduleRequest(&rs, req, now)
+
+	if err := h.store.SaveReportSchedule(rs); err != nil {
+		abortWithErr(c, err, "Failed to save report schedule")
+		return
+	}
+	h.audit(c, "report_schedule.create", nil, rs.Redacted())
+	c.JSON(http.StatusCreated, rs.Redacted())
+}
+
+func (h *Handler) UpdateReportScheduleHandler(c *gin.Context) {
+	before, ok := h.loadReportSchedule(c)
+	if !ok {
+		return
+	}
+	req, ok := bindReportScheduleRequest(c)
+	if !ok {
+		return
+	}
+	if req.Project != "" && req.Project != before.Project {
+		abortWithError(c, errcode.InvalidRequest, "Invalid request", "'project' cannot be changed")
+		return
+	}
+
+	rs := before
+	applyReportScheduleRequest(&rs, req, time.Now().UTC())
+
+	if err := h.store.SaveReportSchedule(rs); err != nil {
+		abortWithErr(c, err, "Failed to save report schedule")
+		return
+	}
+	h.audit(c, "report_schedule.update", before.Redacted(), rs.Redacted())
+	c.JSON(http.StatusOK, rs.Redacted())
+}
+
+func (h *Handler) DeleteReportScheduleHandler(c *gin.Context) {
+	rs, ok := h.loadReportSchedule(c)
+	if !ok {
+		return
+	}
+	if err := h.store.DeleteReportSchedule(rs.ID); err != nil {
+		abortWithErr(c, err, "Failed to delete report schedule")
+		return
+	}
+	h.audit(c, "report_schedule.delete", rs.Redacted(), nil)
+	c.Status(http.StatusNoContent)
+}
+
+// SendReportScheduleHandler delivers a scheduled report now, covering the
+// period up to now, without moving its next run.
+func (h *Handler) SendReportScheduleHandler(c *gin.Context) {
+	rs, ok := h.loadReportSchedule(c)
+	if !ok {
+		return
+	}
+	if err := h.deliverReport(c.Request.Context(), rs, time.Now().UTC()); err != nil {
+		abortWithErr(c, err, "Failed to deliver report")
+		return
+	}
+	rs.LastSentAt, rs.LastError = time.Now().UTC(), ""
+	if err := h.store.SaveReportSchedule(rs); err != nil {
+		abortWithErr(c, err, "Failed to save report schedule")
+		return
+	}
+	c.JSON(http.StatusOK, rs.Redacted())
+}
+
+func (h *Handler) loadReportSchedule(c *gin.Context) (store.ReportSchedule, bool) {
+	rs, err := h.store.GetReportSchedule(c.Param("id"))
+	if err == nil && !tenant.FromContext(c.Request.Context()).Allows(rs.Org, rs.Project) {
+		err = store.ErrNotFound
+	}
+	if errors.Is(err, store.ErrNotFound) {
+		abortWithError(c, errcode.NotFound, "Report schedule not found", nil)
+		return rs, false
+	}
+	if err != nil {
+		abortWithErr(c, err, "Failed to load report schedule")
+		return rs, false
+	}
+	return rs, true
+}
+
+func bindReportScheduleRequest(c *gin.Context) (ReportScheduleRequest, bool) {
+	var req ReportScheduleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		abortWithError(c, errcode.InvalidRequest, "Invalid request body", err.Error())
+		return req, false
+	}
+	if err := req.Validate(); err != nil {
+		abortWithError(c, errcode.InvalidRequest, "Invalid request", err.Error())
+		return req, false
+	}
+	return req, true
+}
+
+func applyReportScheduleRequest(rs *store.ReportSchedule, req ReportScheduleRequest, now time.Time) {
+	rs.Name = req.Name
+	rs.Team = req.Team
+	rs.Day = req.Day
+	rs.Hour = req.Hour
+	rs.Timezone = req.Timezone
+	rs.PeriodDays = req.PeriodDays
+	rs.Format = req.Format
+	rs.Locale = req.Locale
+	rs.Email = req.Email
+	rs.WebhookURL = req.WebhookURL
+	rs.WebhookSecret = req.WebhookSecret
+	rs.Chat = req.Chat
+	rs.Paused = req.Paused
+	rs.NextRun = rs.Next(now)
+	rs.UpdatedAt = now
+}
+
+// DeliverReports sends the scheduled reports that are due. Each covers the
+// period up to its slot, however late the delivery runs. It is run by the
+// scheduler.
+func (h *Handler) DeliverReports(ctx context.Context) {
+	schedules, err := h.store.ListReportSchedules("", "")
+	if err != nil {
+		zerolog.Ctx(ctx).Error().Err(err).Msg("Failed to list report schedules")
+		return
+	}
+	now := time.Now().UTC()
+	for _, rs := range schedules {
+		if rs.Paused || rs.NextRun.After(now) {
+			continue
+		}
+		logger := zerolog.Ctx(ctx).With().Str("report_schedule", rs.ID).Logger()
+		rs.LastError = ""
+		if err := h.deliverReport(ctx, rs, rs.NextRun); err != nil {
+			logger.Error().Err(err).Msg("Failed to deliver scheduled report")
+			rs.LastError = err.Error()
+		} else {
+			rs.LastSentAt = now
+		}
+		// A missed slot is not made up twice; the next one is after now.
+		rs.NextRun = rs.Next(now)
+		if err := h.store.SaveReportSchedule(rs); err != nil {
+			logger.Error().Err(err).Msg("Failed to save report schedule")
+		}
+	}
+}
+
+// deliverReport builds the digest of rs for the period ending at end and
+// sends it to the schedule's destinations.
+func (h *Handler) deliverReport(ctx context.Context, rs store.ReportSchedule, end time.Time) error {
+	d, err := h.buildDigest(store.TargetFilter{Org: rs.Org, Project: rs.Project, Team: rs.Team}, end, rs.Period())
+	if err != nil {
+		return err
+	}
+	scope := rs.Org + "/" + rs.Project
+	if rs.Team != "" {
+		scope = "team:" + rs.Team
+	}
+	scope = cmp.Or(rs.Name, scope)
+
+	if rs.WebhookURL != "" {
+		h.webhooks.Send(h.webhooks.NewDigestEvent(d), webhook.Endpoint{URL: rs.WebhookURL, Secret: rs.WebhookSecret})
+	}
+	if rs.Chat {
+		h.notify.Digest(ctx, d)
+	}
+	if len(rs.Email) > 0 {
+		if h.mailer == nil {
+			return errcode.New(errcode.InvalidRequest, "email is not configured")
+		}
+		// A locale removed from LOCALE_DIR since leaves the default.
+		catalog := i18n.Current()
+		l, ok := catalog.Lookup(rs.Locale)
+		if !ok {
+			l = catalog.Fallback()
+		}
+		if err := h.sendDigestMail(ctx, scope, d, rs.Email, rs.Format, l); err != nil {
+			return err
+		}
+	}
+	zerolog.Ctx(ctx).Info().Str("report_schedule", rs.ID).Str("scope", scope).Msg("Delivered scheduled report")
+	return nil
+}
@@ -0,0 +1,19 @@
+package api
+
+import (
+	"net/http"
+	"weeklysec/internal/report"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ListReportTemplatesHandler lists the custom report templates of
+// REPORT_TEMPLATE_DIR, which scan and digest reports are rendered with when
+// one is named in their `template` query parameter.
+func (h *Handler) ListReportTemplatesHandler(c *gin.Context) {
+	templates := report.CustomTemplates().List()
+	if templates == nil {
+		templates = []*report.Template{}
+	}
+	c.JSON(http.StatusOK, gin.H{"report_templates": templates})
+}
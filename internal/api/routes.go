@@ -1,11 +1,170 @@
 package api
 
 import (
+	"weeklysec/internal/dashboard"
+	"weeklysec/internal/errcode"
+
 	"github.com/gin-gonic/gin"
 )
 
-func SetupRoutes() func(*gin.Engine) {
+func SetupRoutes(h *Handler) func(*gin.Engine) {
 	return func(r *gin.Engine) {
-		r.POST("/scan", ScanHandler)
+		if h.cfg.ReportSigningSecret != "" {
+			r.Use(SignResponses(h.cfg.ReportSigningSecret))
+		}
+		r.GET("/livez", h.LivenessHandler)
+		r.GET("/readyz", h.ReadinessHandler)
+		r.GET("/health", h.LivenessHandler)
+
+		// Tenant-scoped routes
+		auth := Authenticate(h.tenants, h.cfg.AuthRequired)
+
+		r.POST("/scan",
+			auth,
+			LimitBody(h.cfg.MaxRequestBytes),
+			h.ScanHandler,
+		)
+
+		v1 := r.Group("/api/v1")
+		api := v1.Group("", auth)
+		api.POST("/scans", LimitBody(h.cfg.MaxRequestBytes), h.CreateScanHandler)
+		api.GET("/scans/:id", h.GetScanHandler)
+		api.POST("/scans/:id/analyze", LimitBody(h.cfg.MaxRequestBytes), h.AnalyzeScanHandler)
+		api.POST("/scans/:id/pull-request", LimitBody(h.cfg.MaxRequestBytes), h.CreatePullRequestHandler)
+		api.POST("/pull-requests", LimitBody(h.cfg.MaxRequestBytes), h.CreateRepoPullRequestHandler)
+		api.POST("/repo-scans", LimitBody(h.cfg.MaxRequestBytes), h.ScanRepoHandler)
+		api.POST("/app-scans", LimitBody(h.cfg.MaxRequestBytes), h.ScanAppHandler)
+		api.POST("/scans/:id/defectdojo", h.ExportDefectDojoHandler)
+		api.GET("/scans/:id/vex", h.VEXHandler)
+		api.GET("/scans/:id/attestation", h.AttestationHandler)
+		api.GET("/scans/:id/feedback", h.ListScanFeedbackHandler)
+		api.POST("/scans/:id/feedback", LimitBody(h.cfg.MaxRequestBytes), h.CreateFeedbackHandler)
+		api.POST("/scans/:id/attestation", h.AttachAttestationHandler)
+		api.GET("/scans/:id/workspace", h.WorkspaceHandler)
+		api.GET("/scans/:id/workspace/:kind/*path", h.WorkspaceArtifactHandler)
+		api.GET("/attestation/public-key", h.AttestationKeyHandler)
+		api.POST("/gate", LimitBody(h.cfg.MaxRequestBytes), h.GateHandler)
+		api.POST("/presync", LimitBody(h.cfg.MaxRequestBytes), h.PresyncHandler)
+		api.GET("/policies", h.GetPoliciesHandler)
+		api.GET("/usage", h.UsageHandler)
+
+		api.GET("/targets", h.ListTargetsHandler)
+		api.POST("/targets", LimitBody(h.cfg.MaxRequestBytes), h.CreateTargetHandler)
+		api.POST("/targets/scan", LimitBody(h.cfg.MaxRequestBytes), h.ScanTargetsHandler)
+		api.GET("/targets/stale", h.StaleTargetsHandler)
+		api.GET("/targets/failures", h.ScanFailuresHandler)
+		api.GET("/targets/:id", h.GetTargetHandler)
+		api.PUT("/targets/:id", LimitBody(h.cfg.MaxRequestBytes), h.UpdateTargetHandler)
+		api.DELETE("/targets/:id", h.DeleteTargetHandler)
+		api.POST("/targets/:id/scan", h.ScanTargetHandler)
+
+		api.GET("/services", h.ListServicesHandler)
+		api.GET("/services/:service", h.GetServiceHandler)
+		api.GET("/teams", h.ListTeamsHandler)
+		api.GET("/teams/:team", h.GetTeamHandler)
+		api.GET("/schedule", h.ScheduleHandler)
+		api.GET("/report-schedules", h.ListReportSchedulesHandler)
+		api.POST("/report-schedules", LimitBody(h.cfg.MaxRequestBytes), h.CreateReportScheduleHandler)
+		api.GET("/report-schedules/:id", h.GetReportScheduleHandler)
+		api.PUT("/report-schedules/:id", LimitBody(h.cfg.MaxRequestBytes), h.UpdateReportScheduleHandler)
+		api.DELETE("/report-schedules/:id", h.DeleteReportScheduleHandler)
+		api.POST("/report-schedules/:id/send", h.SendReportScheduleHandler)
+		api.GET("/report-templates", h.ListReportTemplatesHandler)
+		api.GET("/digest", h.DigestHandler)
+		api.GET("/compare", h.CompareHandler)
+		api.GET("/trends", h.TrendsHandler)
+
+		api.POST("/cluster/scan", h.ClusterScanHandler)
+		api.GET("/cluster/report", h.ClusterReportHandler)
+
+		api.GET("/search", h.SearchHandler)
+		api.POST("/impact", LimitBody(h.cfg.MaxRequestBytes), h.ImpactHandler)
+		api.GET("/tickets", h.ListTicketsHandler)
+
+		api.GET("/findings", h.ListFindingsHandler)
+		api.GET("/findings/stats", h.FindingStatsHandler)
+		api.GET("/findings/mttr", h.MTTRHandler)
+		api.GET("/findings/export", h.ExportFindingsHandler)
+		api.GET("/findings/:id", h.GetFindingHandler)
+		api.PATCH("/findings/:id", LimitBody(h.cfg.MaxRequestBytes), h.UpdateFindingHandler)
+
+		api.GET("/suppressions", h.ListSuppressionsHandler)
+		api.POST("/suppressions", LimitBody(h.cfg.MaxRequestBytes), h.CreateSuppressionHandler)
+		api.GET("/suppressions/:id", h.GetSuppressionHandler)
+		api.PUT("/suppressions/:id", LimitBody(h.cfg.MaxRequestBytes), h.UpdateSuppressionHandler)
+		api.DELETE("/suppressions/:id", h.DeleteSuppressionHandler)
+		api.GET("/severity-overrides", h.ListSeverityOverridesHandler)
+		api.POST("/severity-overrides", LimitBody(h.cfg.MaxRequestBytes), h.CreateSeverityOverrideHandler)
+		api.GET("/severity-overrides/:id", h.GetSeverityOverrideHandler)
+		api.PUT("/severity-overrides/:id", LimitBody(h.cfg.MaxRequestBytes), h.UpdateSeverityOverrideHandler)
+		api.DELETE("/severity-overrides/:id", h.DeleteSeverityOverrideHandler)
+		api.GET("/guidance", h.ListGuidanceHandler)
+		api.GET("/guidance/:project", h.GetGuidanceHandler)
+		api.PUT("/guidance/:project", LimitBody(h.cfg.MaxRequestBytes), h.UpdateGuidanceHandler)
+		api.DELETE("/guidance/:project", h.DeleteGuidanceHandler)
+		api.GET("/watches", h.ListWatchesHandler)
+		api.POST("/watches", LimitBody(h.cfg.MaxRequestBytes), h.CreateWatchHandler)
+		api.GET("/watches/:id", h.GetWatchHandler)
+		api.PUT("/watches/:id", LimitBody(h.cfg.MaxRequestBytes), h.UpdateWatchHandler)
+		api.DELETE("/watches/:id", h.DeleteWatchHandler)
+		api.GET("/feedback", h.ListFeedbackHandler)
+		api.GET("/feedback/export", h.ExportFeedbackHandler)
+		api.DELETE("/feedback/:id", h.DeleteFeedbackHandler)
+
+		// Registry push hooks, authenticated by a shared secret since
+		// registries cannot hold API keys.
+		if h.cfg.RegistryWebhookSecret != "" {
+			v1.POST("/hooks/registry/:provider",
+				RequireSecret(h.cfg.RegistryWebhookSecret, "registry"),
+				LimitBody(h.cfg.MaxRequestBytes),
+				h.RegistryHookHandler,
+			)
+		}
+
+		// Admin endpoints are only available when an admin token is set.
+		if h.cfg.AdminToken != "" {
+			admin := v1.Group("/admin", RequireToken(h.cfg.AdminToken, "admin"))
+			admin.GET("/config", h.GetAgentConfigHandler)
+			admin.PUT("/config", LimitBody(h.cfg.MaxRequestBytes), h.UpdateAgentConfigHandler)
+			admin.PATCH("/config", LimitBody(h.cfg.MaxRequestBytes), h.UpdateAgentConfigHandler)
+			admin.PUT("/policies", LimitBody(h.cfg.MaxRequestBytes), h.UpdatePoliciesHandler)
+			admin.GET("/experiments", h.GetExperimentsHandler)
+			admin.PUT("/experiments", LimitBody(h.cfg.MaxRequestBytes), h.UpdateExperimentsHandler)
+			admin.GET("/experiments/results", h.ExperimentResultsHandler)
+			admin.GET("/scoring", h.GetScoringHandler)
+			admin.PUT("/scoring", LimitBody(h.cfg.MaxRequestBytes), h.UpdateScoringHandler)
+			admin.GET("/quotas", h.GetQuotasHandler)
+			admin.PUT("/quotas", LimitBody(h.cfg.MaxRequestBytes), h.UpdateQuotasHandler)
+			admin.GET("/usage", h.AllUsageHandler)
+			admin.GET("/audit", h.AuditLogHandler)
+			admin.GET("/queues", h.QueuesHandler)
+			if h.jobs != nil {
+				admin.GET("/queues/dead", h.DeadJobsHandler)
+				admin.POST("/queues/dead/:id/retry", h.RetryJobHandler)
+				admin.DELETE("/queues/dead/:id", h.DiscardJobHandler)
+			}
+			admin.GET("/retention", h.RetentionStatusHandler)
+			admin.POST("/retention/purge", h.PurgeHandler)
+			admin.GET("/export", h.ExportHandler)
+			admin.POST("/import", LimitBody(h.cfg.MaxImportBytes), h.ImportHandler)
+		}
+
+		// Metrics carry every tenant's usage and findings, so they need the
+		// admin token.
+		if h.cfg.AdminToken != "" {
+			r.GET("/metrics", RequireToken(h.cfg.AdminToken, "metrics"), h.MetricsHandler)
+		}
+
+		r.GET("/graphql", auth, h.GraphQLHandler)
+		r.POST("/graphql", auth, LimitBody(h.cfg.MaxRequestBytes), h.GraphQLHandler)
+
+		// The dashboard is static; its data comes from the routes above.
+		if h.cfg.DashboardEnabled {
+			dashboard.Register(r)
+		}
+
+		r.NoRoute(func(c *gin.Context) {
+			abortWithError(c, errcode.NotFound, "Route not found", nil)
+		})
 	}
 }
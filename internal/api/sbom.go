@@ -0,0 +1,58 @@
+package api
+
+import (
+	"context"
+	"weeklysec/internal/deptrack"
+	"weeklysec/internal/queue"
+	"weeklysec/internal/store"
+	"weeklysec/internal/trivy"
+
+	"github.com/rs/zerolog"
+)
+
+// publishSBOM generates scan's CycloneDX SBOM in the background, archives
+// it next to the report and uploads it to Dependency-Track if configured.
+func (h *Handler) publishSBOM(ctx context.Context, scan *store.Scan) {
+	// An application scan has no single artifact to describe.
+	if !h.cfg.SBOMEnabled || scan.TargetType == TargetTypeApp {
+		return
+	}
+	ctx = context.WithoutCancel(ctx)
+	go func() {
+		logger := zerolog.Ctx(ctx).With().Str("scan_id", scan.ID).Logger()
+		var bom []byte
+		err := h.scans.Do(queue.WithPriority(ctx, queue.PriorityScheduled), func(ctx context.Context) (err error) {
+			bom, err = trivy.GenerateSBOM(ctx, scan.TargetType, scan.Target)
+			return err
+		})
+		if err != nil {
+			logger.Error().Err(err).Msg("Failed to generate SBOM")
+			return
+		}
+		if err := h.archiveReport(ctx, scan.ID, "sbom.cdx.json", "application/vnd.cyclonedx+json", bom); err != nil {
+			logger.Error().Err(err).Msg("Failed to archive SBOM")
+		}
+		if h.deptrack == nil {
+			return
+		}
+
+		u := deptrack.Upload{ProjectName: scan.Target, ProjectVersion: h.cfg.DependencyTrackVersion, BOM: bom}
+		if t := h.targetOf(scan); t != nil {
+			if t.Name != "" {
+				u.ProjectName = t.Name
+			}
+			if t.Environment != "" {
+				u.ProjectVersion = t.Environment
+			}
+		}
+		if h.cfg.DependencyTrackParents {
+			u.ParentName = scan.Org + "/" + scan.Project
+		}
+		token, err := h.deptrack.UploadBOM(ctx, u)
+		if err != nil {
+			logger.Error().Err(err).Msg("Failed to upload SBOM to Dependency-Track")
+			return
+		}
+		logger.Info().Str("project", u.ProjectName).Str("version", u.ProjectVersion).Str("token", token).Msg("Uploaded SBOM to Dependency-Track")
+	}()
+}
@@ -0,0 +1,68 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"weeklysec/internal/errcode"
+	"weeklysec/internal/scoring"
+	"weeklysec/internal/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ScoringSetting is the store key of the scoring hooks set through the
+// admin API, which take precedence over SCORING_FILE.
+const ScoringSetting = "scoring_hooks"
+
+// GetScoringHandler returns the scoring hooks in effect.
+func (h *Handler) GetScoringHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, h.agent.Scoring().Hooks())
+}
+
+// UpdateScoringHandler replaces the scoring hooks. Runs already in
+// progress keep the hooks they started with.
+func (h *Handler) UpdateScoringHandler(c *gin.Context) {
+	var next scoring.Hooks
+	dec := json.NewDecoder(c.Request.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&next); err != nil {
+		abortWithError(c, errcode.InvalidRequest, "Invalid request body", err.Error())
+		return
+	}
+	engine, err := scoring.Compile(next)
+	if err != nil {
+		abortWithError(c, errcode.InvalidRequest, "Invalid scoring hooks", err.Error())
+		return
+	}
+	if err := h.store.PutSetting(ScoringSetting, engine.Hooks()); err != nil {
+		abortWithErr(c, err, "Failed to save scoring hooks")
+		return
+	}
+	before := h.agent.Scoring().Hooks()
+	if len(next.Hooks) == 0 {
+		engine = nil
+	}
+	h.agent.SetScoring(engine)
+
+	h.audit(c, "scoring.update", before, engine.Hooks())
+	c.JSON(http.StatusOK, engine.Hooks())
+}
+
+// targetInfo returns what scoring hooks know about a target of the
+// tenant: its inventory metadata when it is registered.
+func (h *Handler) targetInfo(org, project, targetID string) (scoring.Target, error) {
+	info := scoring.Target{Org: org, Project: project}
+	if targetID == "" {
+		return info, nil
+	}
+	t, err := h.store.GetTarget(targetID)
+	if errors.Is(err, store.ErrNotFound) {
+		return info, nil
+	}
+	if err != nil {
+		return info, err
+	}
+	info.Environment, info.Team, info.Criticality, info.Labels = t.Environment, t.Team, t.Criticality, t.Labels
+	return info, nil
+}
@@ -0,0 +1,170 @@
+package api
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"weeklysec/internal/errcode"
+	"weeklysec/internal/store"
+	"weeklysec/internal/tenant"
+	"weeklysec/internal/trivy"
+
+	"github.com/gin-gonic/gin"
+)
+
+// defaultSearchLimit bounds search results unless the caller asks for more.
+const defaultSearchLimit = 100
+
+// SearchHit is one finding matching a search.
+type SearchHit struct {
+	ScanID           string    `json:"scan_id"`
+	Org              string    `json:"org"`
+	Project          string    `json:"project"`
+	TargetType       string    `json:"target_type"`
+	Target           string    `json:"target"`
+	ScannedAt        time.Time `json:"scanned_at"`
+	VulnerabilityID  string    `json:"vulnerability_id"`
+	PkgName          string    `json:"pkg_name"`
+	InstalledVersion string    `json:"installed_version"`
+	FixedVersion     string    `json:"fixed_version,omitempty"`
+	Severity         string    `json:"severity"`
+	CVSSScore        float64   `json:"cvss_score,omitempty"`
+	Title            string    `json:"title,omitempty"`
+	PrimaryURL       string    `json:"primary_url,omitempty"`
+}
+
+// SearchHandler finds stored findings. Query parameters:
+//
+//	q         free text; every word must match the ID, package, installed
+//	          version, title or description (e.g. "log4j 2.14")
+//	cve       exact vulnerability ID
+//	package   exact package name
+//	severity  comma-separated severities
+//	history   true to search every scan instead of each target's latest
+//	limit     maximum hits (default 100)
+func (h *Handler) SearchHandler(c *gin.Context) {
+	terms := searchTerms(c.Query("q"))
+	cve := strings.TrimSpace(c.Query("cve"))
+	pkg := strings.TrimSpace(c.Query("package"))
+	if len(terms) == 0 && cve == "" && pkg == "" {
+		abortWithError(c, errcode.InvalidRequest, "Invalid request", "one of 'q', 'cve' or 'package' is required")
+		return
+	}
+
+	limit := defaultSearchLimit
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			abortWithError(c, errcode.InvalidRequest, "Invalid request", "'limit' must be a positive integer")
+			return
+		}
+		limit = n
+	}
+
+	severities := map[string]bool{}
+	for _, s := range strings.Split(c.Query("severity"), ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			severities[strings.ToUpper(s)] = true
+		}
+	}
+
+	t := tenant.FromContext(c.Request.Context())
+	scans, err := h.store.ListScans(store.ScanFilter{
+		Org:        t.Org,
+		Project:    t.Project,
+		LatestOnly: c.Query("history") != "true",
+	})
+	if err != nil {
+		abortWithErr(c, err, "Failed to load scans")
+		return
+	}
+
+	hits := []SearchHit{}
+	targets := map[string]bool{}
+	for _, scan := range scans {
+		seen := map[string]bool{}
+		for _, v := range scan.Vulnerabilities {
+			switch {
+			case cve != "" && !strings.EqualFold(v.VulnerabilityID, cve),
+				pkg != "" && !strings.EqualFold(v.PkgName, pkg),
+				len(severities) > 0 && !severities[strings.ToUpper(v.Severity)],
+				!matchesTerms(v, terms):
+				continue
+			}
+			key := v.VulnerabilityID + "/" + v.PkgName + "/" + v.InstalledVersion
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			targets[scan.TargetKey()] = true
+			hits = append(hits, SearchHit{
+				ScanID:           scan.ID,
+				Org:              scan.Org,
+				Project:          scan.Project,
+				TargetType:       scan.TargetType,
+				Target:           scan.Target,
+				ScannedAt:        scan.CreatedAt,
+				VulnerabilityID:  v.VulnerabilityID,
+				PkgName:          v.PkgName,
+				InstalledVersion: v.InstalledVersion,
+				FixedVersion:     v.FixedVersion,
+				Severity:         v.Severity,
+				CVSSScore:        v.Score(),
+				Title:            v.Title,
+				PrimaryURL:       v.PrimaryURL,
+			})
+		}
+	}
+
+	sort.SliceStable(hits, func(i, j int) bool {
+		if ri, rj := trivy.SeverityRank(hits[i].Severity), trivy.SeverityRank(hits[j].Severity); ri != rj {
+			return ri < rj
+		}
+		return hits[i].ScannedAt.After(hits[j].ScannedAt)
+	})
+
+	total := len(hits)
+	if len(hits) > limit {
+		hits = hits[:limit]
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"total":   total,
+		"targets": len(targets),
+		"hits":    hits,
+	})
+}
+
+// searchTerms splits a free-text query into lower-case words.
+func searchTerms(q string) []string {
+	return strings.Fields(strings.ToLower(q))
+}
+
+// matchesTerms reports whether every term occurs in one of the finding's
+// searchable fields.
+func matchesTerms(v trivy.Vulnerability, terms []string) bool {
+	if len(terms) == 0 {
+		return true
+	}
+	fields := []string{
+		strings.ToLower(v.VulnerabilityID),
+		strings.ToLower(v.PkgName),
+		strings.ToLower(v.InstalledVersion),
+		strings.ToLower(v.Title),
+		strings.ToLower(v.Description),
+	}
+	for _, term := range terms {
+		found := false
+		for _, f := range fields {
+			if strings.Contains(f, term) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,108 @@
+package api
+
+import (
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"weeklysec/internal/errcode"
+	"weeklysec/internal/posture"
+	"weeklysec/internal/store"
+	"weeklysec/internal/tenant"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ListServicesHandler returns the posture of every service of the caller,
+// worst first. A service is the set of targets sharing a SERVICE_LABEL
+// value, which a Backstage entity names in its weeklysec.io/service
+// annotation.
+func (h *Handler) ListServicesHandler(c *gin.Context) {
+	groups, ok := h.serviceTargets(c)
+	if !ok {
+		return
+	}
+	latest, ok := h.latestScans(c, groups)
+	if !ok {
+		return
+	}
+	services := make([]*posture.Service, 0, len(groups))
+	for name, targets := range groups {
+		services = append(services, posture.Build(name, targets, latest, h.reportURL))
+	}
+	sort.Slice(services, func(i, j int) bool {
+		if services[i].RiskScore != services[j].RiskScore {
+			return services[i].RiskScore > services[j].RiskScore
+		}
+		return services[i].Service < services[j].Service
+	})
+	c.JSON(http.StatusOK, gin.H{"schema_version": posture.SchemaVersion, "services": services})
+}
+
+// GetServiceHandler returns the posture of one service: its risk score,
+// open criticals and latest report, in a schema that only grows within a
+// schema_version.
+func (h *Handler) GetServiceHandler(c *gin.Context) {
+	groups, ok := h.serviceTargets(c)
+	if !ok {
+		return
+	}
+	latest, ok := h.latestScans(c, groups)
+	if !ok {
+		return
+	}
+	name := c.Param("service")
+	targets, found := groups[name]
+	if !found {
+		abortWithError(c, errcode.NotFound, "Service not found", gin.H{"label": h.cfg.ServiceLabel})
+		return
+	}
+	c.JSON(http.StatusOK, posture.Build(name, targets, latest, h.reportURL))
+}
+
+// serviceTargets groups the caller's targets by service.
+func (h *Handler) serviceTargets(c *gin.Context) (map[string][]store.Target, bool) {
+	t := tenant.FromContext(c.Request.Context())
+	targets, err := h.store.ListTargets(store.TargetFilter{Org: t.Org, Project: t.Project})
+	if err != nil {
+		abortWithErr(c, err, "Failed to list targets")
+		return nil, false
+	}
+	groups := map[string][]store.Target{}
+	for _, target := range targets {
+		if name := target.Labels[h.cfg.ServiceLabel]; name != "" {
+			groups[name] = append(groups[name], target)
+		}
+	}
+	return groups, true
+}
+
+// latestScans returns the most recent scan of each grouped target, keyed by
+// target ID. Ad hoc scans of a target's reference count as its scans.
+func (h *Handler) latestScans(c *gin.Context, groups map[string][]store.Target) (map[string]*store.Scan, bool) {
+	t := tenant.FromContext(c.Request.Context())
+	scans, err := h.store.ListScans(store.ScanFilter{Org: t.Org, Project: t.Project, LatestOnly: true})
+	if err != nil {
+		abortWithErr(c, err, "Failed to list scans")
+		return nil, false
+	}
+	byRef := make(map[string]*store.Scan, len(scans))
+	for _, s := range scans {
+		byRef[s.Org+"/"+s.Project+"|"+s.TargetType+"|"+s.Target] = s
+	}
+	latest := map[string]*store.Scan{}
+	for _, targets := range groups {
+		for _, t := range targets {
+			if s := byRef[t.Org+"/"+t.Project+"|"+t.TargetType+"|"+t.Target]; s != nil {
+				latest[t.ID] = s
+			}
+		}
+	}
+	return latest, true
+}
+
+// reportURL links the Markdown report of a scan, relative to the API unless
+// PUBLIC_URL is set.
+func (h *Handler) reportURL(scanID string) string {
+	return strings.TrimRight(h.cfg.PublicURL, "/") + "/api/v1/scans/" + url.PathEscape(scanID) + "?format=markdown"
+}
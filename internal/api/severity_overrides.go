@@ -0,0 +1,175 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"slices"
+	"strings"
+	"time"
+	"weeklysec/internal/agent"
+	"weeklysec/internal/errcode"
+	"weeklysec/internal/store"
+	"weeklysec/internal/tenant"
+	"weeklysec/internal/trivy"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SeverityOverrideRequest is the body accepted when creating or replacing
+// a severity override.
+type SeverityOverrideRequest struct {
+	VulnerabilityID string `json:"vulnerability_id"`
+	Package         string `json:"package"`
+	Target          string `json:"target"`
+	Severity        string `json:"severity"`
+	Reason          string `json:"reason"`
+	Project         string `json:"project"`
+}
+
+// Validate checks the override names what it covers and why.
+func (r *SeverityOverrideRequest) Validate() error {
+	r.VulnerabilityID = strings.TrimSpace(r.VulnerabilityID)
+	r.Package = strings.TrimSpace(r.Package)
+	r.Severity = strings.ToUpper(strings.TrimSpace(r.Severity))
+	r.Reason = strings.TrimSpace(r.Reason)
+
+	switch {
+	case r.VulnerabilityID == "" && r.Package == "":
+		return fmt.Errorf("'vulnerability_id' or 'package' is required")
+	case !slices.Contains(trivy.Severities, r.Severity):
+		return fmt.Errorf("'severity' must be one of %s", strings.Join(trivy.Severities, ", "))
+	case r.Reason == "":
+		return fmt.Errorf("'reason' is required")
+	}
+	for field, pattern := range map[string]string{"package": r.Package, "target": r.Target} {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("'%s' is not a valid pattern: %v", field, err)
+		}
+	}
+	return nil
+}
+
+// ListSeverityOverridesHandler lists the caller's overrides.
+func (h *Handler) ListSeverityOverridesHandler(c *gin.Context) {
+	t := tenant.FromContext(c.Request.Context())
+	rules, err := h.store.ListSeverityOverrides(t.Org, t.Project)
+	if err != nil {
+		abortWithErr(c, err, "Failed to list severity overrides")
+		return
+	}
+	if rules == nil {
+		rules = []agent.SeverityOverride{}
+	}
+	c.JSON(http.StatusOK, gin.H{"severity_overrides": rules})
+}
+
+func (h *Handler) GetSeverityOverrideHandler(c *gin.Context) {
+	rule, ok := h.loadSeverityOverride(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, rule)
+}
+
+func (h *Handler) CreateSeverityOverrideHandler(c *gin.Context) {
+	req, ok := bindSeverityOverrideRequest(c)
+	if !ok {
+		return
+	}
+	t, err := writeTenant(c, req.Project)
+	if err != nil {
+		abortWithError(c, errcode.Forbidden, "Forbidden", err.Error())
+		return
+	}
+
+	now := time.Now().UTC()
+	rule := agent.SeverityOverride{
+		ID:        store.NewID(),
+		Org:       t.Org,
+		Project:   t.Project,
+		CreatedBy: identity(c),
+		CreatedAt: now,
+	}
+	applySeverityOverrideRequest(&rule, req, now)
+
+	if err := h.store.SaveSeverityOverride(rule); err != nil {
+		abortWithErr(c, err, "Failed to save severity override")
+		return
+	}
+	h.audit(c, "severity_override.create", nil, rule)
+	c.JSON(http.StatusCreated, rule)
+}
+
+func (h *Handler) UpdateSeverityOverrideHandler(c *gin.Context) {
+	before, ok := h.loadSeverityOverride(c)
+	if !ok {
+		return
+	}
+	req, ok := bindSeverityOverrideRequest(c)
+	if !ok {
+		return
+	}
+
+	rule := before
+	applySeverityOverrideRequest(&rule, req, time.Now().UTC())
+
+	if err := h.store.SaveSeverityOverride(rule); err != nil {
+		abortWithErr(c, err, "Failed to save severity override")
+		return
+	}
+	h.audit(c, "severity_override.update", before, rule)
+	c.JSON(http.StatusOK, rule)
+}
+
+func (h *Handler) DeleteSeverityOverrideHandler(c *gin.Context) {
+	rule, ok := h.loadSeverityOverride(c)
+	if !ok {
+		return
+	}
+	if err := h.store.DeleteSeverityOverride(rule.ID); err != nil {
+		abortWithErr(c, err, "Failed to delete severity override")
+		return
+	}
+	h.audit(c, "severity_override.delete", rule, nil)
+	c.Status(http.StatusNoContent)
+}
+
+func (h *Handler) loadSeverityOverride(c *gin.Context) (agent.SeverityOverride, bool) {
+	rule, err := h.store.GetSeverityOverride(c.Param("id"))
+	if err == nil && !tenant.FromContext(c.Request.Context()).Allows(rule.Org, rule.Project) {
+		err = store.ErrNotFound
+	}
+	if errors.Is(err, store.ErrNotFound) {
+		abortWithError(c, errcode.NotFound, "Severity override not found", nil)
+		return rule, false
+	}
+	if err != nil {
+		abortWithErr(c, err, "Failed to load severity override")
+		return rule, false
+	}
+	return rule, true
+}
+
+func bindSeverityOverrideRequest(c *gin.Context) (SeverityOverrideRequest, bool) {
+	var req SeverityOverrideRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		abortWithError(c, errcode.InvalidRequest, "Invalid request body", err.Error())
+		return req, false
+	}
+	if err := req.Validate(); err != nil {
+		abortWithError(c, errcode.InvalidRequest, "Invalid request", err.Error())
+		return req, false
+	}
+	return req, true
+}
+
+func applySeverityOverrideRequest(rule *agent.SeverityOverride, req SeverityOverrideRequest, now time.Time) {
+	rule.VulnerabilityID = req.VulnerabilityID
+	rule.Package = req.Package
+	rule.Target = req.Target
+	rule.Severity = req.Severity
+	rule.Reason = req.Reason
+	rule.UpdatedAt = now
+}
@@ -0,0 +1,61 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"time"
+	"weeklysec/internal/webhook"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+)
+
+const signingSecretKey = "weeklysec.signing_secret"
+
+// SignResponses makes scan reports written by renderResponse carry
+// X-Weeklysec-Timestamp and X-Weeklysec-Signature headers, signed with
+// secret the way webhook deliveries are, so clients can tell they came
+// from this instance.
+func SignResponses(secret string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(signingSecretKey, secret)
+		c.Next()
+	}
+}
+
+// signResponse sets the signature headers of body when responses are
+// signed.
+func signResponse(c *gin.Context, body []byte) {
+	secret := c.GetString(signingSecretKey)
+	if secret == "" {
+		return
+	}
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+	c.Header(webhook.HeaderTimestamp, ts)
+	c.Header(webhook.HeaderSignature, "sha256="+webhook.Sign(secret, ts, body))
+}
+
+// ReportSignature is the detached signature archived next to a report as
+// "<name>.sig" when reports are signed.
+type ReportSignature struct {
+	Timestamp string `json:"timestamp"` // Unix seconds
+	Signature string `json:"signature"` // "sha256=<hex>" of "<timestamp>.<report>"
+}
+
+// archiveReport archives a rendered report of a scan and, with
+// REPORT_SIGNING_SECRET set, its signature.
+func (h *Handler) archiveReport(ctx context.Context, scanID, name, contentType string, data []byte) error {
+	if err := h.store.ArchiveReport(ctx, scanID, name, contentType, data); err != nil {
+		return err
+	}
+	if h.cfg.ReportSigningSecret == "" {
+		return nil
+	}
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+	sig, _ := json.Marshal(ReportSignature{Timestamp: ts, Signature: "sha256=" + webhook.Sign(h.cfg.ReportSigningSecret, ts, data)})
+	if err := h.store.ArchiveReport(ctx, scanID, name+".sig", "application/json", sig); err != nil {
+		log.Error().Err(err).Str("scan_id", scanID).Str("report", name).Msg("Failed to archive report signature")
+	}
+	return nil
+}
@@ -0,0 +1,206 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"slices"
+	"strings"
+	"time"
+	"weeklysec/internal/agent"
+	"weeklysec/internal/errcode"
+	"weeklysec/internal/store"
+	"weeklysec/internal/tenant"
+	"weeklysec/internal/vex"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SuppressionRequest is the body accepted when creating or replacing a
+// suppression rule.
+type SuppressionRequest struct {
+	VulnerabilityID string     `json:"vulnerability_id"`
+	Target          string     `json:"target"`
+	Package         string     `json:"package"`
+	Justification   string     `json:"justification"`
+	Approver        string     `json:"approver"`
+	ExpiresAt       *time.Time `json:"expires_at"`
+	Project         string     `json:"project"`
+
+	VEXJustification string `json:"vex_justification"`
+}
+
+// Validate checks the rule is specific and accountable enough to accept.
+func (r *SuppressionRequest) Validate() error {
+	r.VulnerabilityID = strings.TrimSpace(r.VulnerabilityID)
+	r.Justification = strings.TrimSpace(r.Justification)
+	r.Approver = strings.TrimSpace(r.Approver)
+
+	switch {
+	case r.VulnerabilityID == "":
+		return fmt.Errorf("'vulnerability_id' is required")
+	case r.Justification == "":
+		return fmt.Errorf("'justification' is required")
+	case r.Approver == "":
+		return fmt.Errorf("'approver' is required")
+	case r.ExpiresAt != nil && !r.ExpiresAt.After(time.Now()):
+		return fmt.Errorf("'expires_at' must be in the future")
+	}
+	if r.Target != "" {
+		if _, err := path.Match(r.Target, ""); err != nil {
+			return fmt.Errorf("'target' is not a valid pattern: %v", err)
+		}
+	}
+	if r.VEXJustification != "" && !slices.Contains(vex.Justifications, r.VEXJustification) {
+		return fmt.Errorf("'vex_justification' must be one of %s", strings.Join(vex.Justifications, ", "))
+	}
+	return nil
+}
+
+// ListSuppressionsHandler lists the caller's rules. Query parameters:
+// include_expired=true and expiring_within=<duration>.
+func (h *Handler) ListSuppressionsHandler(c *gin.Context) {
+	t := tenant.FromContext(c.Request.Context())
+
+	var within time.Duration
+	if v := c.Query("expiring_within"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			abortWithError(c, errcode.InvalidRequest, "Invalid request", "'expiring_within' must be a positive duration such as 336h")
+			return
+		}
+		within = d
+	}
+
+	rules, err := h.store.ListSuppressions(t.Org, t.Project, c.Query("include_expired") == "true")
+	if err != nil {
+		abortWithErr(c, err, "Failed to list suppressions")
+		return
+	}
+	if within > 0 {
+		deadline := time.Now().Add(within)
+		expiring := rules[:0]
+		for _, rule := range rules {
+			if rule.ExpiresAt != nil && rule.ExpiresAt.Before(deadline) {
+				expiring = append(expiring, rule)
+			}
+		}
+		rules = expiring
+	}
+	if rules == nil {
+		rules = []agent.Suppression{}
+	}
+	c.JSON(http.StatusOK, gin.H{"suppressions": rules})
+}
+
+func (h *Handler) GetSuppressionHandler(c *gin.Context) {
+	rule, ok := h.loadSuppression(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, rule)
+}
+
+func (h *Handler) CreateSuppressionHandler(c *gin.Context) {
+	req, ok := bindSuppressionRequest(c)
+	if !ok {
+		return
+	}
+	t, err := writeTenant(c, req.Project)
+	if err != nil {
+		abortWithError(c, errcode.Forbidden, "Forbidden", err.Error())
+		return
+	}
+
+	now := time.Now().UTC()
+	rule := agent.Suppression{
+		ID:        store.NewID(),
+		Org:       t.Org,
+		Project:   t.Project,
+		CreatedBy: identity(c),
+		CreatedAt: now,
+	}
+	applySuppressionRequest(&rule, req, now)
+
+	if err := h.store.SaveSuppression(rule); err != nil {
+		abortWithErr(c, err, "Failed to save suppression")
+		return
+	}
+	h.audit(c, "suppression.create", nil, rule)
+	c.JSON(http.StatusCreated, rule)
+}
+
+func (h *Handler) UpdateSuppressionHandler(c *gin.Context) {
+	before, ok := h.loadSuppression(c)
+	if !ok {
+		return
+	}
+	req, ok := bindSuppressionRequest(c)
+	if !ok {
+		return
+	}
+
+	rule := before
+	applySuppressionRequest(&rule, req, time.Now().UTC())
+
+	if err := h.store.SaveSuppression(rule); err != nil {
+		abortWithErr(c, err, "Failed to save suppression")
+		return
+	}
+	h.audit(c, "suppression.update", before, rule)
+	c.JSON(http.StatusOK, rule)
+}
+
+func (h *Handler) DeleteSuppressionHandler(c *gin.Context) {
+	rule, ok := h.loadSuppression(c)
+	if !ok {
+		return
+	}
+	if err := h.store.DeleteSuppression(rule.ID); err != nil {
+		abortWithErr(c, err, "Failed to delete suppression")
+		return
+	}
+	h.audit(c, "suppression.delete", rule, nil)
+	c.Status(http.StatusNoContent)
+}
+
+func (h *Handler) loadSuppression(c *gin.Context) (agent.Suppression, bool) {
+	rule, err := h.store.GetSuppression(c.Param("id"))
+	if err == nil && !tenant.FromContext(c.Request.Context()).Allows(rule.Org, rule.Project) {
+		err = store.ErrNotFound
+	}
+	if errors.Is(err, store.ErrNotFound) {
+		abortWithError(c, errcode.NotFound, "Suppression not found", nil)
+		return rule, false
+	}
+	if err != nil {
+		abortWithErr(c, err, "Failed to load suppression")
+		return rule, false
+	}
+	return rule, true
+}
+
+func bindSuppressionRequest(c *gin.Context) (SuppressionRequest, bool) {
+	var req SuppressionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		abortWithError(c, errcode.InvalidRequest, "Invalid request body", err.Error())
+		return req, false
+	}
+	if err := req.Validate(); err != nil {
+		abortWithError(c, errcode.InvalidRequest, "Invalid request", err.Error())
+		return req, false
+	}
+	return req, true
+}
+
+func applySuppressionRequest(rule *agent.Suppression, req SuppressionRequest, now time.Time) {
+	rule.VulnerabilityID = req.VulnerabilityID
+	rule.Target = req.Target
+	rule.Package = req.Package
+	rule.Justification = req.Justification
+	rule.Approver = req.Approver
+	rule.ExpiresAt = req.ExpiresAt
+	rule.VEXJustification = req.VEXJustification
+	rule.UpdatedAt = now
+}
@@ -0,0 +1,379 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+	"weeklysec/internal/agent"
+	"weeklysec/internal/allowlist"
+	"weeklysec/internal/errcode"
+	"weeklysec/internal/labels"
+	"weeklysec/internal/queue"
+	"weeklysec/internal/scheduler"
+	"weeklysec/internal/store"
+	"weeklysec/internal/tenant"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog"
+)
+
+// TargetRequest is the body accepted when registering or replacing a target.
+type TargetRequest struct {
+	Name        string            `json:"name"`
+	TargetType  string            `json:"target_type"`
+	Target      string            `json:"target"`
+	Team        string            `json:"team"`
+	Environment string            `json:"environment"`
+	Criticality string            `json:"criticality"`
+	Schedule    string            `json:"schedule"`
+	Labels      map[string]string `json:"labels"`
+	Project     string            `json:"project"`
+}
+
+// Validate applies the same checks as an ad-hoc scan plus the metadata rules.
+func (r *TargetRequest) Validate(maxTargetLength int, allow *allowlist.Allowlist) error {
+	scan := ScanRequest{TargetType: r.TargetType, Target: r.Target}
+	if err := scan.Validate(maxTargetLength, allow); err != nil {
+		return err
+	}
+	r.TargetType, r.Target = scan.TargetType, scan.Target
+
+	r.Name = strings.TrimSpace(r.Name)
+	r.Team = strings.TrimSpace(r.Team)
+	r.Environment = strings.TrimSpace(r.Environment)
+	r.Criticality = strings.ToLower(strings.TrimSpace(r.Criticality))
+	r.Schedule = strings.TrimSpace(r.Schedule)
+
+	if r.Criticality != "" && !slices.Contains(store.Criticalities, r.Criticality) {
+		return fmt.Errorf("'criticality' must be one of %s", strings.Join(store.Criticalities, ", "))
+	}
+	if err := scheduler.Validate(r.Schedule); err != nil {
+		return fmt.Errorf("'schedule' is invalid: %v", errors.Unwrap(err))
+	}
+	if err := labels.Validate(r.Labels); err != nil {
+		return fmt.Errorf("'labels' is invalid: %v", err)
+	}
+	return nil
+}
+
+// TargetSelector picks the targets of a bulk scan. Empty fields match
+// everything the caller can see. Selector is a label selector such as
+// "team=payments,env in (prod,staging)".
+type TargetSelector struct {
+	Team        string `json:"team"`
+	Environment string `json:"environment"`
+	Criticality string `json:"criticality"`
+	Selector    string `json:"selector"`
+}
+
+// ListTargetsHandler lists the caller's targets, optionally filtered by
+// team, environment, criticality and label selector query parameters.
+func (h *Handler) ListTargetsHandler(c *gin.Context) {
+	f, ok := targetFilter(c, selectorFromQuery(c))
+	if !ok {
+		return
+	}
+	targets, err := h.store.ListTargets(f)
+	if err != nil {
+		abortWithErr(c, err, "Failed to list targets")
+		return
+	}
+	if targets == nil {
+		targets = []store.Target{}
+	}
+	c.JSON(http.StatusOK, gin.H{"targets": targets})
+}
+
+func (h *Handler) GetTargetHandler(c *gin.Context) {
+	t, ok := h.loadTarget(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, t)
+}
+
+func (h *Handler) CreateTargetHandler(c *gin.Context) {
+	req, ok := h.bindTargetRequest(c)
+	if !ok {
+		return
+	}
+	owner, err := writeTenant(c, req.Project)
+	if err != nil {
+		abortWithError(c, errcode.Forbidden, "Forbidden", err.Error())
+		return
+	}
+	existing, err := h.store.FindTarget(owner.Org, owner.Project, req.TargetType, req.Target)
+	if err == nil {
+		abortWithError(c, errcode.Conflict, "Target already registered", gin.H{"id": existing.ID})
+		return
+	}
+	if !errors.Is(err, store.ErrNotFound) {
+		abortWithErr(c, err, "Failed to look up target")
+		return
+	}
+
+	now := time.Now().UTC()
+	t := store.Target{ID: store.NewID(), Org: owner.Org, Project: owner.Project, CreatedAt: now}
+	applyTargetRequest(&t, req, now)
+
+	if err := h.store.SaveTarget(t); err != nil {
+		abortWithErr(c, err, "Failed to save target")
+		return
+	}
+	c.JSON(http.StatusCreated, t)
+}
+
+func (h *Handler) UpdateTargetHandler(c *gin.Context) {
+	t, ok := h.loadTarget(c)
+	if !ok {
+		return
+	}
+	req, ok := h.bindTargetRequest(c)
+	if !ok {
+		return
+	}
+	existing, err := h.store.FindTarget(t.Org, t.Project, req.TargetType, req.Target)
+	if err == nil && existing.ID != t.ID {
+		abortWithError(c, errcode.Conflict, "Target already registered", gin.H{"id": existing.ID})
+		return
+	}
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		abortWithErr(c, err, "Failed to look up target")
+		return
+	}
+
+	applyTargetRequest(&t, req, time.Now().UTC())
+	if err := h.store.SaveTarget(t); err != nil {
+		abortWithErr(c, err, "Failed to save target")
+		return
+	}
+	c.JSON(http.StatusOK, t)
+}
+
+func (h *Handler) DeleteTargetHandler(c *gin.Context) {
+	t, ok := h.loadTarget(c)
+	if !ok {
+		return
+	}
+	if err := h.store.DeleteTarget(t.ID); err != nil {
+		abortWithErr(c, err, "Failed to delete target")
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// ScanTargetHandler scans one registered target and returns the AgentResponse.
+func (h *Handler) ScanTargetHandler(c *gin.Context) {
+	format, ok := negotiateFormat(c)
+	if !ok {
+		return
+	}
+	t, ok := h.loadTarget(c)
+	if !ok {
+		return
+	}
+
+	resp, err := h.scanTarget(c.Request.Context(), t)
+	if err != nil {
+		abortWithRun(c, format, resp, "Scan failed")
+		return
+	}
+	renderResponse(c, http.StatusOK, format, resp)
+}
+
+// ScanTargetsHandler scans every target matching the selector in the
+// background, one at a time, and answers 202 with the selected targets.
+// Results are stored and announced through webhooks as usual.
+func (h *Handler) ScanTargetsHandler(c *gin.Context) {
+	var sel TargetSelector
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&sel); err != nil {
+			abortWithError(c, errcode.InvalidRequest, "Invalid request body", err.Error())
+			return
+		}
+	}
+
+	f, ok := targetFilter(c, sel)
+	if !ok {
+		return
+	}
+	targets, err := h.store.ListTargets(f)
+	if err != nil {
+		abortWithErr(c, err, "Failed to list targets")
+		return
+	}
+	if len(targets) == 0 {
+		abortWithError(c, errcode.NotFound, "No matching targets", nil)
+		return
+	}
+
+	// Detach from the request so the scans outlive it, keeping its logger
+	// and request ID. They run one at a time behind interactive scans, or
+	// on whichever replicas are free with a shared job queue.
+	ctx := queue.WithPriority(context.WithoutCancel(c.Request.Context()), queue.PriorityScheduled)
+	if h.jobs != nil {
+		for _, t := range targets {
+			if err := h.queueTargetScan(ctx, t, queue.PriorityScheduled); err != nil {
+				abortWithErr(c, err, "Failed to queue target scans")
+				return
+			}
+		}
+	} else {
+		go func() {
+			for _, t := range targets {
+				if _, err := h.scanTarget(ctx, t); err != nil {
+					zerolog.Ctx(ctx).Warn().Err(err).Str("target_id", t.ID).Msg("Bulk target scan failed")
+				}
+			}
+		}()
+	}
+
+	ids := make([]string, len(targets))
+	for i, t := range targets {
+		ids[i] = t.ID
+	}
+	c.JSON(http.StatusAccepted, gin.H{"count": len(ids), "target_ids": ids})
+}
+
+// ScheduleHandler lists when the caller's targets are next scanned.
+func (h *Handler) ScheduleHandler(c *gin.Context) {
+	entries := []scheduler.Entry{}
+	if h.sched != nil {
+		t := tenant.FromContext(c.Request.Context())
+		for _, e := range h.sched.Entries() {
+			if t.Allows(e.Org, e.Project) {
+				entries = append(entries, e)
+			}
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"schedule": entries})
+}
+
+// ScanTarget scans a registered target on behalf of its owner. It is the
+// operator's entry point, and the scheduler's without a shared job queue,
+// so its scans queue behind interactive ones.
+func (h *Handler) ScanTarget(ctx context.Context, t store.Target) error {
+	_, err := h.scanTarget(queue.WithPriority(ctx, queue.PriorityScheduled), t)
+	return err
+}
+
+// scanTarget runs the full pipeline over a registered target on behalf of
+// its owner. Targets registered before the allowlist was narrowed are
+// refused.
+func (h *Handler) scanTarget(ctx context.Context, t store.Target) (*agent.AgentResponse, error) {
+	if _, err := h.allow.Check(t.TargetType, t.Target); err != nil {
+		h.recordAttempt(t.ID, err)
+		return nil, err
+	}
+	req := ScanRequest{
+		TargetType: t.TargetType,
+		Target:     t.Target,
+		Summarize:  true,
+		tenant:     tenant.Tenant{Org: t.Org, Project: t.Project},
+		targetID:   t.ID,
+	}
+	resp, _, err := h.runAgent(ctx, req, agent.Request{
+		TargetType:  t.TargetType,
+		Target:      t.Target,
+		Summarize:   true,
+		Remediation: true,
+	})
+	return resp, err
+}
+
+func (h *Handler) loadTarget(c *gin.Context) (store.Target, bool) {
+	t, err := h.store.GetTarget(c.Param("id"))
+	if err == nil && !tenant.FromContext(c.Request.Context()).Allows(t.Org, t.Project) {
+		err = store.ErrNotFound
+	}
+	if errors.Is(err, store.ErrNotFound) {
+		abortWithError(c, errcode.NotFound, "Target not found", nil)
+		return t, false
+	}
+	if err != nil {
+		abortWithErr(c, err, "Failed to load target")
+		return t, false
+	}
+	return t, true
+}
+
+func (h *Handler) bindTargetRequest(c *gin.Context) (TargetRequest, bool) {
+	var req TargetRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		abortWithError(c, errcode.InvalidRequest, "Invalid request body", err.Error())
+		return req, false
+	}
+	if err := req.Validate(h.cfg.MaxTargetLength, h.allow); err != nil {
+		abortInvalid(c, err)
+		return req, false
+	}
+	return req, true
+}
+
+func selectorFromQuery(c *gin.Context) TargetSelector {
+	return TargetSelector{
+		Team:        c.Query("team"),
+		Environment: c.Query("environment"),
+		Criticality: c.Query("criticality"),
+		Selector:    c.Query("selector"),
+	}
+}
+
+// targetFilter scopes sel to the caller's tenant. It aborts the request
+// when the label selector does not parse.
+func targetFilter(c *gin.Context, sel TargetSelector) (store.TargetFilter, bool) {
+	ls, err := labels.Parse(sel.Selector)
+	if err != nil {
+		abortWithError(c, errcode.InvalidRequest, "Invalid request", fmt.Sprintf("'selector' is invalid: %v", err))
+		return store.TargetFilter{}, false
+	}
+	t := tenant.FromContext(c.Request.Context())
+	return store.TargetFilter{
+		Org:         t.Org,
+		Project:     t.Project,
+		Team:        sel.Team,
+		Environment: sel.Environment,
+		Criticality: strings.ToLower(sel.Criticality),
+		Selector:    ls,
+	}, true
+}
+
+// scansOfTargets keeps the scans linked to one of targets.
+func scansOfTargets(scans []*store.Scan, targets []store.Target) []*store.Scan {
+	owned := make(map[string]bool, len(targets))
+	for _, t := range targets {
+		owned[t.ID] = true
+	}
+	kept := scans[:0]
+	for _, s := range scans {
+		if owned[s.TargetID] {
+			kept = append(kept, s)
+		}
+	}
+	return kept
+}
+
+// findingsOfTargets keeps the findings of one of targets.
+func findingsOfTargets(findings []store.Finding, targets []store.Target) []store.Finding {
+	owned := make(map[string]bool, len(targets))
+	for _, t := range targets {
+		owned[t.ID] = true
+	}
+	return slices.DeleteFunc(findings, func(f store.Finding) bool { return !owned[f.TargetID] })
+}
+
+func applyTargetRequest(t *store.Target, req TargetRequest, now time.Time) {
+	t.Name = req.Name
+	t.TargetType = req.TargetType
+	t.Target = req.Target
+	t.Team = req.Team
+	t.Environment = req.Environment
+	t.Criticality = req.Criticality
+	t.Schedule = req.Schedule
+	t.Labels = req.Labels
+	t.UpdatedAt = now
+}
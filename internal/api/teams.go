@@ -0,0 +1,35 @@
+package api
+
+import (
+	"net/http"
+	"weeklysec/internal/errcode"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ListTeamsHandler returns the scorecard of every team owning the caller's
+// targets, riskiest first: open criticals, time to remediate, SLA
+// compliance and the trend since the previous period. It takes the query
+// parameters of the digest.
+func (h *Handler) ListTeamsHandler(c *gin.Context) {
+	d, ok := h.digestFromQuery(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"period_start": d.PeriodStart, "period_end": d.PeriodEnd, "teams": d.Teams})
+}
+
+// GetTeamHandler returns the scorecard of one team.
+func (h *Handler) GetTeamHandler(c *gin.Context) {
+	d, ok := h.digestFromQuery(c)
+	if !ok {
+		return
+	}
+	for _, t := range d.Teams {
+		if t.Team == c.Param("team") {
+			c.JSON(http.StatusOK, gin.H{"period_start": d.PeriodStart, "period_end": d.PeriodEnd, "team": t})
+			return
+		}
+	}
+	abortWithError(c, errcode.NotFound, "Team not found", gin.H{"label": h.cfg.OwnerLabel})
+}
@@ -0,0 +1,56 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"weeklysec/internal/store"
+	"weeklysec/internal/tenant"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog"
+)
+
+// ListTicketsHandler lists the issues opened for the caller's findings,
+// optionally narrowed to one tracker.
+func (h *Handler) ListTicketsHandler(c *gin.Context) {
+	t := tenant.FromContext(c.Request.Context())
+	tickets, err := h.store.ListTickets(t.Org, t.Project, c.Query("tracker"))
+	if err != nil {
+		abortWithErr(c, err, "Failed to list tickets")
+		return
+	}
+	if tickets == nil {
+		tickets = []store.Ticket{}
+	}
+	c.JSON(http.StatusOK, gin.H{"tickets": tickets})
+}
+
+// fileTickets opens tracker issues for scan's urgent findings in the
+// background, so slow trackers do not hold up the response.
+func (h *Handler) fileTickets(ctx context.Context, scan *store.Scan) {
+	if len(h.trackers) == 0 {
+		return
+	}
+	ctx = context.WithoutCancel(ctx)
+	go func() {
+		for _, f := range h.trackers {
+			if _, err := f.File(ctx, scan); err != nil {
+				zerolog.Ctx(ctx).Error().Err(err).Str("tracker", f.Tracker()).Str("scan_id", scan.ID).Msg("Failed to file issues")
+			}
+		}
+	}()
+}
+
+// SyncTickets refreshes the status of open issues from the trackers that
+// report it, for the scheduler.
+func (h *Handler) SyncTickets(ctx context.Context) {
+	for _, f := range h.trackers {
+		closed, err := f.Sync(ctx)
+		if err != nil {
+			zerolog.Ctx(ctx).Error().Err(err).Str("tracker", f.Tracker()).Msg("Failed to sync issues")
+		}
+		if closed > 0 {
+			zerolog.Ctx(ctx).Info().Str("tracker", f.Tracker()).Int("closed", closed).Msg("Synced issues")
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package api
+
+import (
+	"net/http"
+	"time"
+	"weeklysec/internal/errcode"
+	"weeklysec/internal/store"
+	"weeklysec/internal/trends"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TrendsHandler returns time series of a risk metric for plotting. Query
+// parameters: metric (risk_score, open_criticals, mttr_days), group_by
+// (target, team, all), since and until (RFC 3339, default the last 30
+// days), interval (duration, default 24h), and target, team or a label
+// selector to narrow the scans and findings considered.
+func (h *Handler) TrendsHandler(c *gin.Context) {
+	now := time.Now().UTC()
+	q := trends.Query{
+		Metric:   c.Query("metric"),
+		GroupBy:  c.Query("group_by"),
+		Since:    now.Add(-30 * 24 * time.Hour),
+		Until:    now,
+		Interval: 24 * time.Hour,
+	}
+
+	var err error
+	if v := c.Query("since"); v != "" {
+		if q.Since, err = time.Parse(time.RFC3339, v); err != nil {
+			abortWithError(c, errcode.InvalidRequest, "Invalid request", "'since' must be an RFC 3339 timestamp")
+			return
+		}
+	}
+	if v := c.Query("until"); v != "" {
+		if q.Until, err = time.Parse(time.RFC3339, v); err != nil {
+			abortWithError(c, errcode.InvalidRequest, "Invalid request", "'until' must be an RFC 3339 timestamp")
+			return
+		}
+	}
+	if v := c.Query("interval"); v != "" {
+		if q.Interval, err = time.ParseDuration(v); err != nil {
+			abortWithError(c, errcode.InvalidRequest, "Invalid request", "'interval' must be a duration such as 24h")
+			return
+		}
+	}
+	if err := q.Validate(); err != nil {
+		abortWithError(c, errcode.InvalidRequest, "Invalid request", err.Error())
+		return
+	}
+
+	sel := TargetSelector{Team: c.Query("team"), Selector: c.Query("selector")}
+	f, ok := targetFilter(c, sel)
+	if !ok {
+		return
+	}
+	scans, err := h.store.ListScans(store.ScanFilter{Org: f.Org, Project: f.Project, Target: c.Query("target")})
+	if err != nil {
+		abortWithErr(c, err, "Failed to load scans")
+		return
+	}
+	findings, err := h.store.ListFindings(store.FindingFilter{Org: f.Org, Project: f.Project, Target: c.Query("target")})
+	if err != nil {
+		abortWithErr(c, err, "Failed to load findings")
+		return
+	}
+	targets, err := h.store.ListTargets(f)
+	if err != nil {
+		abortWithErr(c, err, "Failed to load targets")
+		return
+	}
+	if sel.Team != "" || sel.Selector != "" {
+		scans = scansOfTargets(scans, targets)
+		findings = findingsOfTargets(findings, targets)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"metric":   q.Metric,
+		"group_by": q.GroupBy,
+		"since":    q.Since,
+		"until":    q.Until,
+		"interval": q.Interval.String(),
+		"series":   trends.Compute(q, scans, targets, findings),
+	})
+}
@@ -0,0 +1,150 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+	"weeklysec/internal/agent"
+	"weeklysec/internal/allowlist"
+	"weeklysec/internal/errcode"
+	"weeklysec/internal/tenant"
+	"weeklysec/internal/webhook"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Supported values for ScanRequest.TargetType.
+const (
+	TargetTypeFile  = "file"
+	TargetTypeImage = "image"
+)
+
+// ScanRequest is the body accepted by POST /scan.
+type ScanRequest struct {
+	TargetType string `json:"target_type"` // "file" or "image"
+	Target     string `json:"target"`      // path to file or image name
+	Summarize  bool   `json:"summarize"`   // true if summary is needed
+	WebhookURL string `json:"webhook_url"` // optional per-request webhook
+	Project    string `json:"project"`     // for callers scoped to a whole org
+	Explain    bool   `json:"explain"`     // record the rationale of each step
+
+	// WebhookSecret signs deliveries to WebhookURL in place of the
+	// server's WEBHOOK_SECRET.
+	WebhookSecret string `json:"webhook_secret"`
+
+	// Source is the path of the Dockerfile or Kubernetes manifest an image
+	// target is built or deployed from. The fixes then point at its lines.
+	Source string `json:"source"`
+
+	// PullRequest, when set, opens a pull request with the fixes once the
+	// scan completes. Only POST /api/v1/scans honours it.
+	PullRequest *PullRequestRequest `json:"pull_request"`
+
+	tenant   tenant.Tenant // resolved owner of the scan
+	caller   string        // authenticated caller, for quotas
+	targetID string        // inventory entry being scanned, if known
+	source   *agent.Source // read from Source
+}
+
+// Validate rejects requests that should never reach the scanner or the LLM,
+// including targets allow does not permit. File targets are canonicalized.
+func (r *ScanRequest) Validate(maxTargetLength int, allow *allowlist.Allowlist) error {
+	r.TargetType = strings.ToLower(strings.TrimSpace(r.TargetType))
+	r.Target = strings.TrimSpace(r.Target)
+
+	switch r.TargetType {
+	case TargetTypeFile, TargetTypeImage:
+	case "":
+		return fmt.Errorf("'target_type' is required")
+	default:
+		return fmt.Errorf("'target_type' must be one of %q or %q", TargetTypeFile, TargetTypeImage)
+	}
+
+	if r.Target == "" {
+		return fmt.Errorf("'target' is required")
+	}
+	if len(r.Target) > maxTargetLength {
+		return fmt.Errorf("'target' exceeds the maximum length of %d characters", maxTargetLength)
+	}
+	// A leading dash would be parsed by trivy as a flag.
+	if strings.HasPrefix(r.Target, "-") {
+		return fmt.Errorf("'target' must not start with '-'")
+	}
+	for _, ch := range r.Target {
+		if unicode.IsControl(ch) {
+			return fmt.Errorf("'target' must not contain control characters")
+		}
+	}
+	if r.TargetType == TargetTypeImage && strings.ContainsAny(r.Target, " \t") {
+		return fmt.Errorf("'target' is not a valid image reference")
+	}
+	target, err := allow.Check(r.TargetType, r.Target)
+	if err != nil {
+		return err
+	}
+	r.Target = target
+
+	if r.Source = strings.TrimSpace(r.Source); r.Source != "" {
+		if r.TargetType != TargetTypeImage {
+			return fmt.Errorf("'source' is only allowed with image targets")
+		}
+		source, err := allow.File(r.Source)
+		if err != nil {
+			return fmt.Errorf("'source': %w", err)
+		}
+		r.Source = source
+	}
+
+	if r.WebhookURL != "" {
+		if err := webhook.ValidateEndpoint(r.WebhookURL); err != nil {
+			return err
+		}
+	}
+	if r.PullRequest != nil {
+		if err := r.PullRequest.Validate(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// abortInvalid rejects a request that failed validation, with the code of
+// the error when it has one.
+func abortInvalid(c *gin.Context, err error) {
+	code, msg := errcode.InvalidRequest, "Invalid request"
+	var coded *errcode.Error
+	if errors.As(err, &coded) {
+		code = coded.Code
+	}
+	if code == errcode.TargetNotAllowed {
+		msg = "Scan target not allowed"
+	}
+	abortWithError(c, code, msg, err.Error())
+}
+
+// AnalyzeRequest is the optional body accepted by POST /api/v1/scans/:id/analyze.
+type AnalyzeRequest struct {
+	Model             string `json:"model"`
+	PriorityThreshold string `json:"priority_threshold"`
+	Summarize         *bool  `json:"summarize"`   // defaults to true
+	Remediation       *bool  `json:"remediation"` // defaults to true
+	Explain           bool   `json:"explain"`
+	WebhookURL        string `json:"webhook_url"`
+	WebhookSecret     string `json:"webhook_secret"`
+}
+
+// Validate checks the overrides.
+func (r *AnalyzeRequest) Validate() error {
+	if r.PriorityThreshold != "" {
+		cfg := agent.AgentConfig{PriorityThreshold: r.PriorityThreshold}
+		if err := cfg.Validate(); err != nil {
+			return err
+		}
+	}
+	if r.WebhookURL != "" {
+		return webhook.ValidateEndpoint(r.WebhookURL)
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package api
+
+import (
+	"cmp"
+	"net/http"
+	"strings"
+	"time"
+	"weeklysec/internal/errcode"
+	"weeklysec/internal/store"
+	"weeklysec/internal/vex"
+
+	"github.com/gin-gonic/gin"
+)
+
+// VEX document specifications, chosen with ?spec=.
+const (
+	VEXSpecOpenVEX = "openvex"
+	VEXSpecCSAF    = "csaf"
+)
+
+// VEXHandler describes a scan as a VEX document: OpenVEX by default, or
+// CSAF VEX with ?spec=csaf. Open findings are affected, accepted risks are
+// affected or, with a VEX justification, not_affected, and findings the
+// target no longer had at the time of the scan are fixed.
+func (h *Handler) VEXHandler(c *gin.Context) {
+	spec := cmp.Or(c.Query("spec"), VEXSpecOpenVEX)
+	if spec != VEXSpecOpenVEX && spec != VEXSpecCSAF {
+		abortWithError(c, errcode.InvalidRequest, "Invalid request", "'spec' must be one of \"openvex\" or \"csaf\"")
+		return
+	}
+	scan, ok := h.loadScan(c)
+	if !ok {
+		return
+	}
+
+	findings, err := h.store.ListFindings(store.FindingFilter{
+		Org:     scan.Org,
+		Project: scan.Project,
+		Target:  scan.Target,
+		State:   store.StateFixed,
+	})
+	if err != nil {
+		abortWithErr(c, err, "Failed to list findings")
+		return
+	}
+	statements := vex.Statements(scan, findings)
+	meta := vex.Meta{
+		ID:        "urn:weeklysec:vex:" + scan.ID,
+		Author:    h.cfg.VEXAuthor,
+		Namespace: cmp.Or(h.cfg.PublicURL, "urn:weeklysec"),
+		Title:     "Vulnerability status of " + scan.Target,
+		Timestamp: time.Now().UTC().Truncate(time.Second),
+	}
+	if h.cfg.PublicURL != "" {
+		meta.ID = strings.TrimSuffix(h.cfg.PublicURL, "/") + "/api/v1/scans/" + scan.ID + "/vex"
+	}
+
+	product := vex.ProductOf(scan)
+	if spec == VEXSpecCSAF {
+		c.JSON(http.StatusOK, vex.CSAF(meta, product, statements))
+		return
+	}
+	c.JSON(http.StatusOK, vex.OpenVEX(meta, product, statements))
+}
@@ -0,0 +1,368 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/mail"
+	"path"
+	"slices"
+	"strings"
+	"time"
+	"weeklysec/internal/email"
+	"weeklysec/internal/errcode"
+	"weeklysec/internal/queue"
+	"weeklysec/internal/store"
+	"weeklysec/internal/tenant"
+	"weeklysec/internal/trivy"
+	"weeklysec/internal/watch"
+	"weeklysec/internal/webhook"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog"
+)
+
+// WatchNotifiedSetting is the store key of the changes already announced,
+// so a change is announced once however often it is seen.
+const WatchNotifiedSetting = "watch_notified"
+
+// watchNotifiedTTL is how long an announced change is remembered.
+const watchNotifiedTTL = 180 * 24 * time.Hour
+
+// WatchRequest is the body accepted when creating or replacing a watch
+// subscription.
+type WatchRequest struct {
+	VulnerabilityID string   `json:"vulnerability_id"`
+	Package         string   `json:"package"`
+	Target          string   `json:"target"`
+	Kinds           []string `json:"kinds"`
+	WebhookURL      string   `json:"webhook_url"`
+	WebhookSecret   string   `json:"webhook_secret"`
+	Email           []string `json:"email"`
+	Project         string   `json:"project"`
+}
+
+// Validate checks the subscription says what to watch and where to report.
+func (r *WatchRequest) Validate() error {
+	r.VulnerabilityID = strings.TrimSpace(r.VulnerabilityID)
+	r.Package = strings.TrimSpace(r.Package)
+
+	switch {
+	case r.VulnerabilityID == "" && r.Package == "":
+		return fmt.Errorf("'vulnerability_id' or 'package' is required")
+	case r.WebhookURL == "" && len(r.Email) == 0:
+		return fmt.Errorf("'webhook_url' or 'email' is required")
+	}
+	for field, pattern := range map[string]string{"package": r.Package, "target": r.Target} {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("'%s' is not a valid pattern: %v", field, err)
+		}
+	}
+	for _, k := range r.Kinds {
+		if !slices.Contains(watch.Kinds, k) {
+			return fmt.Errorf("'kinds' must contain only %s", strings.Join(watch.Kinds, ", "))
+		}
+	}
+	if r.WebhookURL != "" {
+		if err := webhook.ValidateEndpoint(r.WebhookURL); err != nil {
+			return err
+		}
+	}
+	for _, addr := range r.Email {
+		if _, err := mail.ParseAddress(addr); err != nil {
+			return fmt.Errorf("'email' has an invalid address %q", addr)
+		}
+	}
+	return nil
+}
+
+// ListWatchesHandler lists the caller's subscriptions.
+func (h *Handler) ListWatchesHandler(c *gin.Context) {
+	t := tenant.FromContext(c.Request.Context())
+	subs, err := h.store.ListWatches(t.Org, t.Project)
+	if err != nil {
+		abortWithErr(c, err, "Failed to list watches")
+		return
+	}
+	if subs == nil {
+		subs = []watch.Subscription{}
+	}
+	for i := range subs {
+		subs[i] = subs[i].Redacted()
+	}
+	c.JSON(http.StatusOK, gin.H{"watches": subs})
+}
+
+func (h *Handler) GetWatchHandler(c *gin.Context) {
+	sub, ok := h.loadWatch(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, sub.Redacted())
+}
+
+func (h *Handler) CreateWatchHandler(c *gin.Context) {
+	req, ok := bindWatchRequest(c)
+	if !ok {
+		return
+	}
+	t, err := writeTenant(c, req.Project)
+	if err != nil {
+		abortWithError(c, errcode.Forbidden, "Forbidden", err.Error())
+		return
+	}
+
+	now := time.Now().UTC()
+	sub := watch.Subscription{
+		ID:        store.NewID(),
+		Org:       t.Org,
+		Project:   t.Project,
+		CreatedBy: identity(c),
+		CreatedAt: now,
+	}
+	applyWatchRequest(&sub, req, now)
+
+	if err := h.store.SaveWatch(sub); err != nil {
+		abortWithErr(c, err, "Failed to save watch")
+		return
+	}
+	h.audit(c, "watch.create", nil, sub.Redacted())
+	c.JSON(http.StatusCreated, sub.Redacted())
+}
+
+func (h *Handler) UpdateWatchHandler(c *gin.Context) {
+	before, ok := h.loadWatch(c)
+	if !ok {
+		return
+	}
+	req, ok := bindWatchRequest(c)
+	if !ok {
+		return
+	}
+
+	sub := before
+	applyWatchRequest(&sub, req, time.Now().UTC())
+
+	if err := h.store.SaveWatch(sub); err != nil {
+		abortWithErr(c, err, "Failed to save watch")
+		return
+	}
+	h.audit(c, "watch.update", before.Redacted(), sub.Redacted())
+	c.JSON(http.StatusOK, sub.Redacted())
+}
+
+func (h *Handler) DeleteWatchHandler(c *gin.Context) {
+	sub, ok := h.loadWatch(c)
+	if !ok {
+		return
+	}
+	if err := h.store.DeleteWatch(sub.ID); err != nil {
+		abortWithErr(c, err, "Failed to delete watch")
+		return
+	}
+	h.audit(c, "watch.delete", sub.Redacted(), nil)
+	c.Status(http.StatusNoContent)
+}
+
+func (h *Handler) loadWatch(c *gin.Context) (watch.Subscription, bool) {
+	sub, err := h.store.GetWatch(c.Param("id"))
+	if err == nil && !tenant.FromContext(c.Request.Context()).Allows(sub.Org, sub.Project) {
+		err = store.ErrNotFound
+	}
+	if errors.Is(err, store.ErrNotFound) {
+		abortWithError(c, errcode.NotFound, "Watch not found", nil)
+		return sub, false
+	}
+	return sub, true
+}
+
+func bindWatchRequest(c *gin.Context) (WatchRequest, bool) {
+	var req WatchRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		abortWithError(c, errcode.InvalidRequest, "Invalid request body", err.Error())
+		return req, false
+	}
+	if err := req.Validate(); err != nil {
+		abortWithError(c, errcode.InvalidRequest, "Invalid request", err.Error())
+		return req, false
+	}
+	return req, true
+}
+
+func applyWatchRequest(sub *watch.Subscription, req WatchRequest, now time.Time) {
+	sub.VulnerabilityID = req.VulnerabilityID
+	sub.Package = req.Package
+	sub.Target = req.Target
+	sub.Kinds = req.Kinds
+	sub.WebhookURL = req.WebhookURL
+	sub.WebhookSecret = req.WebhookSecret
+	sub.Email = req.Email
+	sub.UpdatedAt = now
+}
+
+// CheckWatches re-matches the archived SBOM of every target's latest scan
+// against the current vulnerability DB and tells subscribers about new
+// advisories and newly released fixes. It is run by the scheduler.
+func (h *Handler) CheckWatches(ctx context.Context) {
+	logger := zerolog.Ctx(ctx)
+	scans, err := h.store.ListScans(store.ScanFilter{LatestOnly: true})
+	if err != nil {
+		logger.Error().Err(err).Msg("Failed to list scans for watches")
+		return
+	}
+
+	checked := 0
+	for _, scan := range scans {
+		subs, err := h.store.ListWatches(scan.Org, scan.Project)
+		if err != nil {
+			logger.Error().Err(err).Str("scan_id", scan.ID).Msg("Failed to list watches")
+			continue
+		}
+		if len(subs) == 0 {
+			continue
+		}
+		bom, err := h.store.ArchivedReport(ctx, scan.ID, "sbom.cdx.json")
+		if errors.Is(err, store.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			logger.Error().Err(err).Str("scan_id", scan.ID).Msg("Failed to read SBOM")
+			continue
+		}
+		var report *trivy.Report
+		err = h.scans.Do(queue.WithPriority(ctx, queue.PriorityScheduled), func(ctx context.Context) (err error) {
+			report, err = trivy.ScanSBOM(ctx, bom)
+			return err
+		})
+		if err != nil {
+			logger.Error().Err(err).Str("scan_id", scan.ID).Msg("Failed to scan SBOM")
+			continue
+		}
+		checked++
+		ignore := h.agent.Config().IgnorePolicy
+		var vulns []trivy.Vulnerability
+		for _, v := range report.Vulnerabilities() {
+			if !ignore.Ignores(v) {
+				vulns = append(vulns, v)
+			}
+		}
+		h.watchFindings(ctx, scan, vulns, true)
+	}
+	h.pruneWatchNotified()
+	logger.Info().Int("sboms", checked).Msg("Checked watches")
+}
+
+// watchFindings announces the changes between vulns and the tracked open
+// findings of scan's target to the subscriptions they match. Regular scans
+// call it before tracking their findings, with newAdvisories unset.
+func (h *Handler) watchFindings(ctx context.Context, scan *store.Scan, vulns []trivy.Vulnerability, newAdvisories bool) {
+	logger := zerolog.Ctx(ctx)
+	subs, err := h.store.ListWatches(scan.Org, scan.Project)
+	if err != nil {
+		logger.Error().Err(err).Str("scan_id", scan.ID).Msg("Failed to list watches")
+		return
+	}
+	if len(subs) == 0 {
+		return
+	}
+	findings, err := h.store.ListFindings(store.FindingFilter{Org: scan.Org, Project: scan.Project, Target: scan.Target, OpenOnly: true})
+	if err != nil {
+		// Without the known findings every one would be announced as new.
+		logger.Error().Err(err).Str("scan_id", scan.ID).Msg("Failed to list findings for watches")
+		return
+	}
+
+	key := scan.TargetKey()
+	known := watch.Known{}
+	for _, f := range findings {
+		if f.TargetKey == key {
+			known[watch.KnownKey(f.VulnerabilityID, f.PkgName)] = f.FixedVersion
+		}
+	}
+	changes := h.unannounced(ctx, key, watch.Diff(known, scan.ID, scan.Target, vulns, newAdvisories))
+
+	for _, sub := range subs {
+		var matched []watch.Change
+		for _, c := range changes {
+			if sub.Matches(c) {
+				matched = append(matched, c)
+			}
+		}
+		if len(matched) > 0 {
+			h.announceWatch(ctx, sub, matched)
+		}
+	}
+}
+
+// unannounced drops the changes already announced and records the rest.
+func (h *Handler) unannounced(ctx context.Context, targetKey string, changes []watch.Change) []watch.Change {
+	if len(changes) == 0 {
+		return nil
+	}
+	h.watchMu.Lock()
+	defer h.watchMu.Unlock()
+
+	notified := map[string]time.Time{}
+	_ = h.store.GetSetting(WatchNotifiedSetting, &notified)
+	now := time.Now().UTC()
+	var out []watch.Change
+	for _, c := range changes {
+		k := c.Key(targetKey)
+		if _, ok := notified[k]; ok {
+			continue
+		}
+		notified[k] = now
+		out = append(out, c)
+	}
+	if len(out) > 0 {
+		if err := h.store.PutSetting(WatchNotifiedSetting, notified); err != nil {
+			zerolog.Ctx(ctx).Error().Err(err).Msg("Failed to record announced watch changes")
+		}
+	}
+	return out
+}
+
+func (h *Handler) pruneWatchNotified() {
+	h.watchMu.Lock()
+	defer h.watchMu.Unlock()
+
+	notified := map[string]time.Time{}
+	if err := h.store.GetSetting(WatchNotifiedSetting, &notified); err != nil {
+		return
+	}
+	cutoff := time.Now().Add(-watchNotifiedTTL)
+	n := len(notified)
+	for k, at := range notified {
+		if at.Before(cutoff) {
+			delete(notified, k)
+		}
+	}
+	if len(notified) < n {
+		_ = h.store.PutSetting(WatchNotifiedSetting, notified)
+	}
+}
+
+// announceWatch sends changes to the subscription's webhook and email.
+func (h *Handler) announceWatch(ctx context.Context, sub watch.Subscription, changes []watch.Change) {
+	logger := zerolog.Ctx(ctx).With().Str("watch", sub.ID).Int("changes", len(changes)).Logger()
+	if sub.WebhookURL != "" {
+		h.webhooks.Send(h.webhooks.NewWatchEvent(sub, changes), webhook.Endpoint{URL: sub.WebhookURL, Secret: sub.WebhookSecret})
+	}
+	if len(sub.Email) > 0 && h.mailer != nil {
+		var b strings.Builder
+		for _, c := range changes {
+			fmt.Fprintf(&b, "- %s\n", c.Summary())
+		}
+		msg := email.Message{
+			To:      sub.Email,
+			Subject: fmt.Sprintf("CVE watch: %d changes in %s", len(changes), changes[0].Target),
+			Text:    b.String(),
+		}
+		if err := h.mailer.Send(ctx, msg); err != nil {
+			logger.Error().Err(err).Msg("Failed to email watch changes")
+			return
+		}
+	}
+	logger.Info().Msg("Announced watch changes")
+}
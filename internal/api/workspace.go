@@ -0,0 +1,91 @@
+package api
+
+import (
+	"mime"
+	"net/http"
+	"path"
+	"time"
+	"weeklysec/internal/errcode"
+	"weeklysec/internal/workspace"
+
+	"github.com/gin-gonic/gin"
+)
+
+// WorkspaceResponse lists the artifacts of a scan's workspace.
+type WorkspaceResponse struct {
+	ScanID    string               `json:"scan_id"`
+	CreatedAt time.Time            `json:"created_at"`
+	ExpiresAt time.Time            `json:"expires_at"`
+	Size      int64                `json:"size"`
+	MaxBytes  int64                `json:"max_bytes,omitempty"`
+	Artifacts []workspace.Artifact `json:"artifacts"`
+}
+
+// WorkspaceHandler lists the artifacts a scan's workspace holds, such as
+// the patched files and diffs of its pull requests, until it expires.
+func (h *Handler) WorkspaceHandler(c *gin.Context) {
+	ws, ok := h.loadWorkspace(c)
+	if !ok {
+		return
+	}
+	size, err := ws.Size()
+	if err != nil {
+		abortWithErr(c, err, "Failed to read workspace")
+		return
+	}
+	artifacts := ws.Artifacts()
+	if artifacts == nil {
+		artifacts = []workspace.Artifact{}
+	}
+	c.JSON(http.StatusOK, WorkspaceResponse{
+		ScanID:    ws.ID,
+		CreatedAt: ws.CreatedAt,
+		ExpiresAt: ws.ExpiresAt,
+		Size:      size,
+		MaxBytes:  ws.MaxBytes,
+		Artifacts: artifacts,
+	})
+}
+
+// WorkspaceArtifactHandler downloads one artifact of a scan's workspace.
+func (h *Handler) WorkspaceArtifactHandler(c *gin.Context) {
+	ws, ok := h.loadWorkspace(c)
+	if !ok {
+		return
+	}
+	name := c.Param("path")
+	f, err := ws.Open(c.Param("kind"), name)
+	if err != nil {
+		abortWithErr(c, err, "Artifact not found")
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		abortWithErr(c, err, "Failed to read artifact")
+		return
+	}
+	c.Header("Expires", ws.ExpiresAt.UTC().Format(http.TimeFormat))
+	c.DataFromReader(http.StatusOK, info.Size(), "application/octet-stream", f, map[string]string{
+		"Content-Disposition": mime.FormatMediaType("attachment", map[string]string{"filename": path.Base(name)}),
+	})
+}
+
+// loadWorkspace loads the workspace of the scan in the path, checking the
+// caller may read the scan.
+func (h *Handler) loadWorkspace(c *gin.Context) (*workspace.Workspace, bool) {
+	if h.spaces == nil {
+		abortWithError(c, errcode.NotFound, "Workspaces are not configured", nil)
+		return nil, false
+	}
+	scan, ok := h.loadScan(c)
+	if !ok {
+		return nil, false
+	}
+	ws, err := h.spaces.Get(scan.ID)
+	if err != nil {
+		abortWithErr(c, err, "Workspace not found")
+		return nil, false
+	}
+	return ws, true
+}
@@ -0,0 +1,178 @@
+// Package attest describes scan results as signed in-toto attestations with
+// cosign's vulnerability predicate, so admission policies can check that an
+// image digest was scanned and what was found.
+package attest
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"weeklysec/internal/digest"
+	"weeklysec/internal/registry"
+	"weeklysec/internal/store"
+	"weeklysec/internal/trivy"
+)
+
+// In-toto and cosign identifiers.
+const (
+	StatementType = "https://in-toto.io/Statement/v1"
+	PredicateType = "https://cosign.sigstore.dev/attestation/vuln/v1"
+	PayloadType   = "application/vnd.in-toto+json"
+
+	// BuilderID identifies weeklysec as the producer of the predicate.
+	BuilderID = "https://github.com/chinmaykubal-one2n/weekly-security-ai"
+)
+
+// Statement is an in-toto statement about one image digest.
+type Statement struct {
+	Type          string    `json:"_type"`
+	Subject       []Subject `json:"subject"`
+	PredicateType string    `json:"predicateType"`
+	Predicate     Predicate `json:"predicate"`
+}
+
+// Subject is the attested artifact.
+type Subject struct {
+	Name   string            `json:"name"`
+	Digest map[string]string `json:"digest"`
+}
+
+// Predicate follows cosign's vuln/v1 predicate. Result is weeklysec's own.
+type Predicate struct {
+	Invocation Invocation `json:"invocation"`
+	Scanner    Scanner    `json:"scanner"`
+	Metadata   Metadata   `json:"metadata"`
+}
+
+type Invocation struct {
+	URI       string `json:"uri,omitempty"` // the scan in the weeklysec API
+	EventID   string `json:"event_id"`      // scan ID
+	BuilderID string `json:"builder.id"`
+}
+
+type Scanner struct {
+	URI     string `json:"uri"`
+	Version string `json:"version"`
+	DB      DB     `json:"db"`
+	Result  Result `json:"result"`
+}
+
+type DB struct {
+	URI     string `json:"uri,omitempty"`
+	Version string `json:"version,omitempty"`
+}
+
+type Metadata struct {
+	ScanStartedOn  time.Time `json:"scanStartedOn"`
+	ScanFinishedOn time.Time `json:"scanFinishedOn"`
+}
+
+// Result summarizes the scan. Open counts exclude accepted risks, so a
+// policy requiring open.CRITICAL == 0 honours risk acceptance.
+type Result struct {
+	RiskScore       float64        `json:"risk_score"`
+	Open            map[string]int `json:"open"`
+	Accepted        int            `json:"accepted"`
+	Signature       string         `json:"signature,omitempty"` // cosign verification status of the image
+	Vulnerabilities []Finding      `json:"vulnerabilities"`
+}
+
+// Finding is one open finding.
+type Finding struct {
+	ID               string `json:"id"`
+	Package          string `json:"package"`
+	InstalledVersion string `json:"installed_version"`
+	FixedVersion     string `json:"fixed_version,omitempty"`
+	Severity         string `json:"severity"`
+}
+
+// SubjectOf returns the image digest a scan covers: the digest of its
+// reference, or else the one Trivy resolved for the repository. Scans that
+// are not of images, or whose digest is unknown, cannot be attested.
+func SubjectOf(scan *store.Scan, raw string) (Subject, error) {
+	if scan.TargetType != "image" {
+		return Subject{}, fmt.Errorf("only image scans can be attested")
+	}
+	ref := registry.Parse(scan.Target)
+	d := ref.Digest
+	if d == "" && raw != "" {
+		if report, err := trivy.ParseReport([]byte(raw)); err == nil {
+			for _, rd := range report.Metadata.RepoDigests {
+				name, repoDigest, _ := strings.Cut(rd, "@")
+				if registry.Parse(name).Repository == ref.Repository {
+					d = repoDigest
+					break
+				}
+			}
+		}
+	}
+	algo, hex, ok := strings.Cut(d, ":")
+	if !ok || algo != "sha256" || hex == "" {
+		return Subject{}, fmt.Errorf("the digest of %s is unknown; scan it by digest to attest it", scan.Target)
+	}
+	return Subject{Name: ref.Repository, Digest: map[string]string{"sha256": hex}}, nil
+}
+
+// Ref returns the image reference of the subject, by digest.
+func (s Subject) Ref() string {
+	return s.Name + "@sha256:" + s.Digest["sha256"]
+}
+
+// New describes a scan of subject. scanURI links the scan, if known.
+func New(scan *store.Scan, subject Subject, version *trivy.VersionInfo, scanURI string) Statement {
+	result := Result{
+		Open:            make(map[string]int, len(trivy.Severities)),
+		Vulnerabilities: []Finding{},
+	}
+	for _, sev := range trivy.Severities {
+		result.Open[sev] = 0
+	}
+	for _, v := range digest.Open(scan) {
+		sev := strings.ToUpper(v.Severity)
+		result.Open[sev]++
+		result.Vulnerabilities = append(result.Vulnerabilities, Finding{
+			ID:               v.VulnerabilityID,
+			Package:          v.PkgName,
+			InstalledVersion: v.InstalledVersion,
+			FixedVersion:     v.FixedVersion,
+			Severity:         sev,
+		})
+	}
+	result.RiskScore = digest.RiskScore(scan)
+
+	started, finished := scan.CreatedAt, scan.CreatedAt
+	if resp := scan.Response; resp != nil {
+		if resp.AcceptedRisk != nil {
+			result.Accepted = resp.AcceptedRisk.Count
+		}
+		if resp.Signature != nil {
+			result.Signature = resp.Signature.Status
+		}
+		if !resp.StartedAt.IsZero() {
+			started, finished = resp.StartedAt, resp.CompletedAt
+		}
+	}
+
+	scanner := Scanner{URI: "pkg:github/aquasecurity/trivy", Version: "unknown", Result: result}
+	if version != nil {
+		scanner.Version = version.Version
+		scanner.URI += "@" + version.Version
+		if db := version.VulnerabilityDB; db != nil {
+			scanner.DB = DB{
+				URI:     "pkg:oci/trivy-db?repository_url=ghcr.io/aquasecurity/trivy-db",
+				Version: db.UpdatedAt.UTC().Format(time.RFC3339),
+			}
+		}
+	}
+
+	return Statement{
+		Type:          StatementType,
+		Subject:       []Subject{subject},
+		PredicateType: PredicateType,
+		Predicate: Predicate{
+			Invocation: Invocation{URI: scanURI, EventID: scan.ID, BuilderID: BuilderID},
+			Scanner:    scanner,
+			Metadata:   Metadata{ScanStartedOn: started.UTC(), ScanFinishedOn: finished.UTC()},
+		},
+	}
+}
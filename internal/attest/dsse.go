@@ -0,0 +1,123 @@
+package attest
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"os"
+)
+
+// Envelope is a DSSE envelope, the form cosign stores attestations in.
+type Envelope struct {
+	PayloadType string      `json:"payloadType"`
+	Payload     string      `json:"payload"` // base64 statement
+	Signatures  []Signature `json:"signatures"`
+}
+
+type Signature struct {
+	KeyID string `json:"keyid"`
+	Sig   string `json:"sig"`
+}
+
+// Signer signs statements with a private key. Its public key verifies them,
+// e.g. with cosign verify-attestation --key.
+type Signer struct {
+	key       crypto.Signer
+	keyID     string
+	publicPEM []byte
+}
+
+// LoadSigner reads an unencrypted PEM private key: ECDSA, Ed25519 or RSA,
+// in PKCS #8, SEC 1 or PKCS #1 form.
+func LoadSigner(path string) (*Signer, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s: no PEM block", path)
+	}
+	var key any
+	switch block.Type {
+	case "PRIVATE KEY":
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("%s: unsupported PEM block %q; encrypted keys are not supported", path, block.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("%s: unsupported key type %T", path, key)
+	}
+	return NewSigner(signer)
+}
+
+// NewSigner returns a signer for key.
+func NewSigner(key crypto.Signer) (*Signer, error) {
+	switch key.(type) {
+	case *ecdsa.PrivateKey, ed25519.PrivateKey, *rsa.PrivateKey:
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", key)
+	}
+	der, err := x509.MarshalPKIXPublicKey(key.Public())
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(der)
+	return &Signer{
+		key:       key,
+		keyID:     "SHA256:" + hex.EncodeToString(sum[:]),
+		publicPEM: pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}),
+	}, nil
+}
+
+// PublicKey returns the PEM public key that verifies the signer's envelopes.
+func (s *Signer) PublicKey() []byte {
+	return s.publicPEM
+}
+
+// Sign wraps the statement in a signed DSSE envelope.
+func (s *Signer) Sign(st Statement) (*Envelope, error) {
+	payload, err := json.Marshal(st)
+	if err != nil {
+		return nil, err
+	}
+	msg := pae(PayloadType, payload)
+
+	var sig []byte
+	if _, ok := s.key.(ed25519.PrivateKey); ok {
+		sig, err = s.key.Sign(rand.Reader, msg, crypto.Hash(0))
+	} else {
+		sum := sha256.Sum256(msg)
+		sig, err = s.key.Sign(rand.Reader, sum[:], crypto.SHA256)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("sign attestation: %w", err)
+	}
+	return &Envelope{
+		PayloadType: PayloadType,
+		Payload:     base64.StdEncoding.EncodeToString(payload),
+		Signatures:  []Signature{{KeyID: s.keyID, Sig: base64.StdEncoding.EncodeToString(sig)}},
+	}, nil
+}
+
+// pae is DSSE's pre-authentication encoding, the bytes actually signed.
+func pae(payloadType string, payload []byte) []byte {
+	return fmt.Appendf(nil, "DSSEv1 %d %s %d %s", len(payloadType), payloadType, len(payload), payload)
+}
@@ -0,0 +1,153 @@
+package certs
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Reloader serves a certificate (and optional client CA pool) from disk and
+// picks up changes to the files without a restart.
+type Reloader struct {
+	certFile, keyFile, caFile string
+	clientAuth                tls.ClientAuthType
+
+	mu      sync.RWMutex
+	cert    *tls.Certificate
+	pool    *x509.CertPool
+	modTime time.Time
+}
+
+// NewReloader loads the key pair and, when caFile is set, the client CA bundle.
+func NewReloader(certFile, keyFile, caFile string, clientAuth tls.ClientAuthType) (*Reloader, error) {
+	r := &Reloader{certFile: certFile, keyFile: keyFile, caFile: caFile, clientAuth: clientAuth}
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// ParseClientAuth maps a config value to a tls.ClientAuthType.
+func ParseClientAuth(mode string) (tls.ClientAuthType, error) {
+	switch mode {
+	case "", "none":
+		return tls.NoClientCert, nil
+	case "request":
+		return tls.VerifyClientCertIfGiven, nil
+	case "require":
+		return tls.RequireAndVerifyClientCert, nil
+	default:
+		return tls.NoClientCert, fmt.Errorf("invalid client auth mode: %s", mode)
+	}
+}
+
+// TLSConfig returns a server config that always uses the latest certificate.
+func (r *Reloader) TLSConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			r.mu.RLock()
+			defer r.mu.RUnlock()
+			return &tls.Config{
+				MinVersion:   tls.VersionTLS12,
+				Certificates: []tls.Certificate{*r.cert},
+				ClientAuth:   r.clientAuth,
+				ClientCAs:    r.pool,
+			}, nil
+		},
+	}
+}
+
+// Watch polls the files every interval and reloads them when they change.
+// It returns when stop is closed.
+func (r *Reloader) Watch(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			changed, err := r.changed()
+			if err != nil {
+				log.Warn().Err(err).Msg("Failed to stat TLS files")
+				continue
+			}
+			if !changed {
+				continue
+			}
+			if err := r.load(); err != nil {
+				log.Error().Err(err).Msg("Failed to reload TLS certificate, keeping the previous one")
+				continue
+			}
+			log.Info().Str("cert", r.certFile).Msg("Reloaded TLS certificate")
+		}
+	}
+}
+
+func (r *Reloader) load() error {
+	modTime, err := r.latestModTime()
+	if err != nil {
+		return err
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load key pair: %w", err)
+	}
+
+	var pool *x509.CertPool
+	if r.caFile != "" {
+		pem, err := os.ReadFile(r.caFile)
+		if err != nil {
+			return fmt.Errorf("failed to read client CA file: %w", err)
+		}
+		pool = x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return errors.New("no certificates found in client CA file")
+		}
+	} else if r.clientAuth != tls.NoClientCert {
+		return errors.New("client certificate verification requires a client CA file")
+	}
+
+	r.mu.Lock()
+	r.cert = &cert
+	r.pool = pool
+	r.modTime = modTime
+	r.mu.Unlock()
+	return nil
+}
+
+func (r *Reloader) changed() (bool, error) {
+	modTime, err := r.latestModTime()
+	if err != nil {
+		return false, err
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return modTime.After(r.modTime), nil
+}
+
+func (r *Reloader) latestModTime() (time.Time, error) {
+	var latest time.Time
+	for _, f := range []string{r.certFile, r.keyFile, r.caFile} {
+		if f == "" {
+			continue
+		}
+		info, err := os.Stat(f)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
@@ -0,0 +1,38 @@
+// Package childenv decides which of the server's environment variables the
+// programs it starts, Trivy and notifier scripts, inherit, so that none of
+// the server's own credentials reach them.
+package childenv
+
+import (
+	"os"
+	"strings"
+)
+
+// Base is what any program needs to run and reach the network.
+var Base = []string{
+	"PATH", "HOME", "TMPDIR", "LANG", "TZ",
+	"HTTP_PROXY", "HTTPS_PROXY", "NO_PROXY", "http_proxy", "https_proxy", "no_proxy",
+	"SSL_CERT_FILE", "SSL_CERT_DIR",
+}
+
+// Filter keeps the variables of env that names allows, with "PREFIX_*"
+// matching every variable starting with PREFIX_.
+func Filter(env, names []string) []string {
+	var kept []string
+	for _, kv := range env {
+		name, _, _ := strings.Cut(kv, "=")
+		for _, n := range names {
+			if prefix, ok := strings.CutSuffix(n, "*"); ok && strings.HasPrefix(name, prefix) || n == name {
+				kept = append(kept, kv)
+				break
+			}
+		}
+	}
+	return kept
+}
+
+// Environ returns the variables of the server's environment that names
+// allows.
+func Environ(names []string) []string {
+	return Filter(os.Environ(), names)
+}
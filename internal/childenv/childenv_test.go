@@ -0,0 +1,23 @@
+package childenv
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestFilter(t *testing.T) {
+	env := []string{"PATH=/bin", "AWS_SECRET_ACCESS_KEY=x", "TRIVY_USERNAME=u", "TRIVY=1", "PATHEXT=.exe", "NOEQUALS"}
+	tests := []struct {
+		names []string
+		want  []string
+	}{
+		{[]string{"PATH", "TRIVY_*"}, []string{"PATH=/bin", "TRIVY_USERNAME=u"}},
+		{[]string{"*"}, env},
+		{nil, nil},
+	}
+	for _, tt := range tests {
+		if got := Filter(env, tt.names); !slices.Equal(got, tt.want) {
+			t.Errorf("Filter(%v) = %v, want %v", tt.names, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,212 @@
+// Package cluster finds the images running in a Kubernetes cluster and
+// scans each distinct one once, mapping the findings back to the
+// namespaces, workloads and owners that run it.
+package cluster
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"weeklysec/internal/kube"
+)
+
+// Workload is a controller running an image, e.g. a Deployment, or a bare
+// pod.
+type Workload struct {
+	Namespace string `json:"namespace"`
+	Kind      string `json:"kind"`
+	Name      string `json:"name"`
+	Container string `json:"container"`
+	Owner     string `json:"owner,omitempty"` // value of the owner label, if set
+}
+
+// Image is one distinct image and everything running it.
+type Image struct {
+	Digest    string     `json:"digest"`    // what images are deduplicated by
+	Image     string     `json:"image"`     // as named in the pod spec
+	Reference string     `json:"reference"` // what is scanned: repository@digest when known
+	Workloads []Workload `json:"workloads"`
+}
+
+// DiscoverOptions narrows discovery.
+type DiscoverOptions struct {
+	Namespace         string   // only this namespace; all when empty
+	ExcludeNamespaces []string // skipped namespaces, e.g. kube-system
+	OwnerLabel        string   // pod or workload label naming the owning team
+}
+
+type pod struct {
+	Metadata kube.ObjectMeta `json:"metadata"`
+	Status   struct {
+		Phase                 string            `json:"phase"`
+		ContainerStatuses     []containerStatus `json:"containerStatuses"`
+		InitContainerStatuses []containerStatus `json:"initContainerStatuses"`
+	} `json:"status"`
+}
+
+type containerStatus struct {
+	Name    string `json:"name"`
+	Image   string `json:"image"`
+	ImageID string `json:"imageID"`
+}
+
+// Discover lists the running pods and returns their images, deduplicated
+// by digest, ordered by reference.
+func Discover(ctx context.Context, client *kube.Client, opts DiscoverOptions) ([]Image, error) {
+	path := "/api/v1/pods"
+	if opts.Namespace != "" {
+		path = "/api/v1/namespaces/" + opts.Namespace + "/pods"
+	}
+	var pods struct {
+		Items []pod `json:"items"`
+	}
+	if err := client.Get(ctx, path+"?fieldSelector=status.phase%3DRunning", &pods); err != nil {
+		return nil, fmt.Errorf("failed to list pods: %w", err)
+	}
+
+	excluded := map[string]bool{}
+	for _, ns := range opts.ExcludeNamespaces {
+		excluded[ns] = true
+	}
+	owners := ownerResolver{client: client, cache: map[string]owner{}}
+	images := map[string]*Image{}
+	for _, p := range pods.Items {
+		if excluded[p.Metadata.Namespace] || p.Status.Phase != "Running" {
+			continue
+		}
+		o := owners.resolve(ctx, p.Metadata)
+		team := p.Metadata.Labels[opts.OwnerLabel]
+		if team == "" {
+			team = o.labels[opts.OwnerLabel]
+		}
+		for _, cs := range append(p.Status.ContainerStatuses, p.Status.InitContainerStatuses...) {
+			digest, ref := parseImageID(cs.Image, cs.ImageID)
+			if digest == "" {
+				continue
+			}
+			img, ok := images[digest]
+			if !ok {
+				img = &Image{Digest: digest, Image: cs.Image, Reference: ref}
+				images[digest] = img
+			}
+			// A workload's replicas count once
+			w := Workload{Namespace: p.Metadata.Namespace, Kind: o.kind, Name: o.name, Container: cs.Name, Owner: team}
+			if !slices.Contains(img.Workloads, w) {
+				img.Workloads = append(img.Workloads, w)
+			}
+		}
+	}
+
+	out := make([]Image, 0, len(images))
+	for _, img := range images {
+		sort.Slice(img.Workloads, func(i, j int) bool {
+			a, b := img.Workloads[i], img.Workloads[j]
+			return a.Namespace+"/"+a.Kind+"/"+a.Name+"/"+a.Container < b.Namespace+"/"+b.Kind+"/"+b.Name+"/"+b.Container
+		})
+		out = append(out, *img)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Reference < out[j].Reference })
+	return out, nil
+}
+
+// parseImageID returns the digest a container runs and the reference to
+// scan it by. Runtimes report the image ID as "docker-pullable://repo@digest",
+// "repo@digest" or a bare "sha256:..." config digest; the last can only be
+// scanned through the tag the pod names.
+func parseImageID(image, imageID string) (digest, ref string) {
+	id := imageID
+	if i := strings.Index(id, "://"); i >= 0 {
+		id = id[i+3:]
+	}
+	if repo, d, ok := strings.Cut(id, "@"); ok {
+		return d, repo + "@" + d
+	}
+	if id != "" {
+		return id, image
+	}
+	// Not pulled yet
+	return "", ""
+}
+
+// owner is the top-level controller of a pod.
+type owner struct {
+	kind, name string
+	labels     map[string]string
+}
+
+// ownerResolver follows owner references up to the top-level controller:
+// ReplicaSets to their Deployment and Jobs to their CronJob.
+type ownerResolver struct {
+	client *kube.Client
+	cache  map[string]owner
+}
+
+func (r *ownerResolver) resolve(ctx context.Context, meta kube.ObjectMeta) owner {
+	ref := controllerOf(meta)
+	if ref == nil {
+		return owner{kind: "Pod", name: meta.Name, labels: meta.Labels}
+	}
+	var path string
+	switch ref.Kind {
+	case "ReplicaSet":
+		path = "/apis/apps/v1/namespaces/" + meta.Namespace + "/replicasets/" + ref.Name
+	case "Job":
+		path = "/apis/batch/v1/namespaces/" + meta.Namespace + "/jobs/" + ref.Name
+	default:
+		return r.lookup(ctx, meta.Namespace, ref.Kind, ref.Name)
+	}
+	key := meta.Namespace + "/" + ref.Kind + "/" + ref.Name
+	if o, ok := r.cache[key]; ok {
+		return o
+	}
+	var parent struct {
+		Metadata kube.ObjectMeta `json:"metadata"`
+	}
+	o := owner{kind: ref.Kind, name: ref.Name}
+	if err := r.client.Get(ctx, path, &parent); err == nil {
+		o.labels = parent.Metadata.Labels
+		if top := controllerOf(parent.Metadata); top != nil {
+			o = r.lookup(ctx, meta.Namespace, top.Kind, top.Name)
+		}
+	}
+	r.cache[key] = o
+	return o
+}
+
+// lookup returns the owner of the given kind and name with its labels,
+// read from the API when the kind is one the resolver knows.
+func (r *ownerResolver) lookup(ctx context.Context, ns, kind, name string) owner {
+	key := ns + "/" + kind + "/" + name
+	if o, ok := r.cache[key]; ok {
+		return o
+	}
+	o := owner{kind: kind, name: name}
+	if path, ok := workloadPaths[kind]; ok {
+		var obj struct {
+			Metadata kube.ObjectMeta `json:"metadata"`
+		}
+		if err := r.client.Get(ctx, fmt.Sprintf(path, ns, name), &obj); err == nil {
+			o.labels = obj.Metadata.Labels
+		}
+	}
+	r.cache[key] = o
+	return o
+}
+
+var workloadPaths = map[string]string{
+	"Deployment":  "/apis/apps/v1/namespaces/%s/deployments/%s",
+	"StatefulSet": "/apis/apps/v1/namespaces/%s/statefulsets/%s",
+	"DaemonSet":   "/apis/apps/v1/namespaces/%s/daemonsets/%s",
+	"CronJob":     "/apis/batch/v1/namespaces/%s/cronjobs/%s",
+}
+
+func controllerOf(meta kube.ObjectMeta) *kube.OwnerReference {
+	for i, ref := range meta.OwnerReferences {
+		if ref.Controller {
+			return &meta.OwnerReferences[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,199 @@
+package cluster
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+	"weeklysec/internal/digest"
+	"weeklysec/internal/kube"
+	"weeklysec/internal/store"
+	"weeklysec/internal/trivy"
+)
+
+// ErrRunning is returned when a fleet scan is already in progress.
+var ErrRunning = errors.New("a cluster scan is already running")
+
+// ScanFunc scans one image reference and returns the stored scan.
+type ScanFunc func(ctx context.Context, ref string) (*store.Scan, error)
+
+// Report is the outcome of a fleet scan.
+type Report struct {
+	StartedAt  time.Time     `json:"started_at"`
+	FinishedAt time.Time     `json:"finished_at,omitzero"`
+	Running    bool          `json:"running,omitempty"` // another scan is in progress
+	Images     []ImageResult `json:"images"`
+	Namespaces []Group       `json:"namespaces"`
+	Owners     []Group       `json:"owners"`
+	Scanned    int           `json:"scanned"`
+	Failed     int           `json:"failed"`
+}
+
+// ImageResult is the scan of one distinct image.
+type ImageResult struct {
+	Image
+	ScanID          string         `json:"scan_id,omitempty"`
+	Error           string         `json:"error,omitempty"`
+	RiskScore       float64        `json:"risk_score"`
+	Vulnerabilities map[string]int `json:"vulnerabilities"`
+}
+
+// Group totals the images run in a namespace or by an owner. An image run
+// by several workloads of the group counts once.
+type Group struct {
+	Name            string         `json:"name"`
+	Images          int            `json:"images"`
+	Workloads       int            `json:"workloads"`
+	MaxRiskScore    float64        `json:"max_risk_score"`
+	Vulnerabilities map[string]int `json:"vulnerabilities"`
+}
+
+// Scanner runs fleet scans, one at a time.
+type Scanner struct {
+	client      *kube.Client
+	scan        ScanFunc
+	opts        DiscoverOptions
+	concurrency int
+
+	mu      sync.Mutex
+	running bool
+}
+
+// NewScanner returns a scanner that discovers images through client and
+// scans up to concurrency of them at a time.
+func NewScanner(client *kube.Client, scan ScanFunc, opts DiscoverOptions, concurrency int) *Scanner {
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+	return &Scanner{client: client, scan: scan, opts: opts, concurrency: concurrency}
+}
+
+// Discover lists the cluster's distinct images.
+func (s *Scanner) Discover(ctx context.Context) ([]Image, error) {
+	return Discover(ctx, s.client, s.opts)
+}
+
+// Running reports whether a fleet scan is in progress.
+func (s *Scanner) Running() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.running
+}
+
+// Start claims the scanner for a fleet scan and returns a function that
+// scans images and releases it. It fails with ErrRunning while another
+// scan holds it, so callers can report that before going async.
+func (s *Scanner) Start() (func(ctx context.Context, images []Image) *Report, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.running {
+		return nil, ErrRunning
+	}
+	s.running = true
+	return func(ctx context.Context, images []Image) *Report {
+		defer func() {
+			s.mu.Lock()
+			s.running = false
+			s.mu.Unlock()
+		}()
+		return s.scanAll(ctx, images)
+	}, nil
+}
+
+func (s *Scanner) scanAll(ctx context.Context, images []Image) *Report {
+	r := &Report{StartedAt: time.Now().UTC(), Images: make([]ImageResult, len(images))}
+	slots := make(chan struct{}, s.concurrency)
+	var wg sync.WaitGroup
+	for i, img := range images {
+		wg.Add(1)
+		slots <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-slots }()
+			r.Images[i] = s.scanOne(ctx, img)
+		}()
+	}
+	wg.Wait()
+
+	for _, res := range r.Images {
+		if res.Error != "" {
+			r.Failed++
+		} else {
+			r.Scanned++
+		}
+	}
+	r.Namespaces = group(r.Images, func(w Workload) string { return w.Namespace })
+	r.Owners = group(r.Images, func(w Workload) string { return w.Owner })
+	r.FinishedAt = time.Now().UTC()
+	return r
+}
+
+func (s *Scanner) scanOne(ctx context.Context, img Image) ImageResult {
+	res := ImageResult{Image: img, Vulnerabilities: emptyCounts()}
+	scan, err := s.scan(ctx, img.Reference)
+	if scan != nil {
+		res.ScanID = scan.ID
+		res.RiskScore = digest.RiskScore(scan)
+		for _, v := range digest.Open(scan) {
+			res.Vulnerabilities[v.Severity]++
+		}
+	}
+	if err != nil {
+		res.Error = err.Error()
+	}
+	return res
+}
+
+// group totals the results by the key of their workloads, leaving out
+// workloads without one, and orders the groups by risk.
+func group(results []ImageResult, key func(Workload) string) []Group {
+	groups := map[string]*Group{}
+	workloads := map[string]bool{}
+	for _, res := range results {
+		counted := map[string]bool{}
+		for _, w := range res.Workloads {
+			k := key(w)
+			if k == "" {
+				continue
+			}
+			g, ok := groups[k]
+			if !ok {
+				g = &Group{Name: k, Vulnerabilities: emptyCounts()}
+				groups[k] = g
+			}
+			if id := k + "|" + w.Namespace + "/" + w.Kind + "/" + w.Name; !workloads[id] {
+				workloads[id] = true
+				g.Workloads++
+			}
+			if counted[k] {
+				continue
+			}
+			counted[k] = true
+			g.Images++
+			g.MaxRiskScore = max(g.MaxRiskScore, res.RiskScore)
+			for sev, n := range res.Vulnerabilities {
+				g.Vulnerabilities[sev] += n
+			}
+		}
+	}
+	out := make([]Group, 0, len(groups))
+	for _, g := range groups {
+		out = append(out, *g)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].MaxRiskScore != out[j].MaxRiskScore {
+			return out[i].MaxRiskScore > out[j].MaxRiskScore
+		}
+		return out[i].Name < out[j].Name
+	})
+	return out
+}
+
+func emptyCounts() map[string]int {
+	m := make(map[string]int, len(trivy.Severities))
+	for _, sev := range trivy.Severities {
+		m[sev] = 0
+	}
+	return m
+}
@@ -0,0 +1,906 @@
+package config
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config holds the server settings read from the environment.
+type Config struct {
+	Port    string
+	DataDir string
+
+	// Storage. Scans go to StoreBackend. Raw Trivy output stays in the scan
+	// record, and reports are not archived, unless BlobBackend is set.
+	StoreBackend  string // sqlite, postgres or file
+	DatabaseURL   string
+	BlobBackend   string // "", file, s3 or gcs
+	BlobBucket    string
+	BlobPrefix    string
+	BlobEndpoint  string
+	BlobRegion    string
+	BlobAccessKey string
+	BlobSecretKey string
+	BlobInsecure  bool
+
+	// Retention; 0 keeps data forever
+	RetentionRawOutput time.Duration
+	RetentionScans     time.Duration
+	RetentionInterval  time.Duration // how often the purger runs; 0 disables it
+
+	// Scan workspaces, by default under DataDir/workspaces, hold the
+	// patched files and diffs of pull requests, downloadable for
+	// WorkspaceTTL. A workspace may hold WorkspaceMaxBytes, 0 being
+	// unlimited; expired ones are removed every WorkspaceSweepInterval.
+	WorkspaceDir           string
+	WorkspaceTTL           time.Duration
+	WorkspaceMaxBytes      int64
+	WorkspaceSweepInterval time.Duration
+
+	// Native TLS. HTTPS is served when both TLSCertFile and TLSKeyFile are set.
+	TLSCertFile       string
+	TLSKeyFile        string
+	TLSClientCAFile   string
+	TLSClientAuth     string // "none", "request" or "require"
+	TLSReloadInterval time.Duration
+
+	// CORS. An empty origin list disables CORS handling. Credentials need
+	// explicit origins; "*" with them is refused at startup.
+	CORSAllowedOrigins   []string
+	CORSAllowedMethods   []string
+	CORSAllowedHeaders   []string
+	CORSAllowCredentials bool
+	CORSMaxAge           time.Duration
+
+	// Tracing. Spans are exported over OTLP/HTTP when enabled.
+	TracingEnabled     bool
+	TracingServiceName string
+
+	// Agent
+	LLMModel           string
+	PriorityThreshold  string
+	TokenBudget        int
+	MaxVulnerabilities int    // findings sent to the LLM per prompt; 0 is unlimited
+	PromptDir          string // prompt overrides, see llm.LoadPrompts
+
+	// Reports. The fixed strings of text, Markdown and HTML reports are in
+	// ReportLocale unless a request or report schedule asks for another;
+	// LocaleDir adds locales or overrides built-in strings, see i18n.Load.
+	// ReportTemplateDir holds custom report layouts, see
+	// report.LoadTemplates.
+	ReportLocale      string
+	LocaleDir         string
+	ReportTemplateDir string
+
+	// White-labeling of HTML and PDF reports: the organization reported
+	// for, its logo (an http(s) URL or an image file, see
+	// report.NewBranding), a classification banner such as CONFIDENTIAL
+	// and a footer.
+	ReportOrgName        string
+	ReportLogo           string
+	ReportClassification string
+	ReportFooter         string
+
+	// Findings the team triaged as noise within TriageWindow, through
+	// finding feedback or not-affected suppressions since lapsed, are left
+	// out of prioritization. 0 disables it.
+	TriageWindow time.Duration
+
+	// LLM HTTP client. A request gets LLMAttemptTimeout and is retried up
+	// to LLMAttempts times within LLMTimeout; connections are kept alive up
+	// to LLMMaxIdleConns at a time.
+	LLMAttemptTimeout  time.Duration
+	LLMTimeout         time.Duration
+	LLMAttempts        int
+	LLMMaxIdleConns    int
+	LLMIdleConnTimeout time.Duration
+
+	// Data minimization. With LLMMinimizeData, models other than the
+	// LLMLocalModels ("name" or "prefix*"), served at the OpenAI-compatible
+	// LLMLocalURL, are sent only the IDs, packages, versions and severities
+	// of findings.
+	LLMMinimizeData bool
+	LLMLocalURL     string
+	LLMLocalAPIKey  string
+	LLMLocalModels  []string
+
+	// Synthetic mode for load tests: scans replay the Trivy JSON reports in
+	// SyntheticScanFixtures after SyntheticScanLatency instead of running
+	// Trivy, and with LLMMock the LLM steps get canned answers after
+	// LLMMockLatency.
+	SyntheticScanFixtures string
+	SyntheticScanLatency  time.Duration
+	LLMMock               bool
+	LLMMockLatency        time.Duration
+
+	// Hot reload. ConfigFile, PromptDir, LocaleDir and ReportTemplateDir are
+	// polled every ConfigReloadInterval, 0 disables polling; SIGHUP reloads
+	// either way.
+	ConfigFile           string
+	ConfigReloadInterval time.Duration
+
+	// Secrets. Any setting may hold a reference to a secret in Vault, AWS
+	// Secrets Manager, Kubernetes or a file instead of the secret (see
+	// package secrets). References are resolved at startup and again every
+	// SecretsRefreshInterval, 0 resolving them once. Vault is read with
+	// VaultToken, or by logging in with Kubernetes auth as VaultRole.
+	SecretsRefreshInterval time.Duration
+	VaultAddr              string
+	VaultNamespace         string
+	VaultToken             string
+	VaultRole              string
+	VaultAuthPath          string
+
+	// Tenant authentication. API keys have the form "[name:]key=org/project".
+	APIKeys      []string
+	JWTSecret    string
+	JWTIssuer    string
+	JWTAudience  string
+	AuthRequired bool
+
+	// Admin API. Disabled when the token is empty.
+	AdminToken string
+
+	// Web dashboard served under /ui
+	DashboardEnabled bool
+
+	// Scheduled scans of registered targets
+	SchedulerEnabled      bool
+	ScheduleDefault       string // cron spec for targets without their own; "off" disables
+	SchedulerSyncInterval time.Duration
+	SchedulerConcurrency  int
+	SchedulerSelector     string // label selector limiting which targets are scheduled
+
+	// Weekly digest, sent through webhooks on DigestSchedule; "off" disables it
+	DigestSchedule string
+	DigestPeriod   time.Duration
+
+	// Report schedules set through the API are checked for due deliveries
+	// on ReportDeliverySchedule; "off" disables them
+	ReportDeliverySchedule string
+
+	// Archived SBOMs are re-matched against the vulnerability DB for CVE
+	// watch subscriptions on WatchSchedule; "off" disables it
+	WatchSchedule string
+
+	// Registered targets not scanned successfully within FreshnessSLO are
+	// reported stale, and announced to the chat notifiers on
+	// FreshnessSchedule; "off" or an SLO of 0 disables the announcements
+	FreshnessSLO      time.Duration
+	FreshnessSchedule string
+
+	// Remediation SLAs by severity; 0 means no SLA
+	SLACritical time.Duration
+	SLAHigh     time.Duration
+	SLAMedium   time.Duration
+	SLALow      time.Duration
+
+	// Webhooks
+	WebhookURLs        []string
+	WebhookSecret      string
+	WebhookSecrets     []string // "url=secret" pairs replacing WebhookSecret per endpoint
+	WebhookSummaryOnly bool
+	WebhookMaxRetries  int
+	WebhookTimeout     time.Duration
+
+	// Report signing: scan reports returned by the API carry signature
+	// headers, and archived reports a "<name>.sig" file, signed with
+	// ReportSigningSecret the way webhooks are. Off when empty.
+	ReportSigningSecret string
+
+	// Quotas: LLM spend is estimated from tokens at this price per 1K
+	// tokens. Budgets are set through the admin API.
+	QuotaCostPer1KTokens float64
+
+	// Base URL the service is reachable at, for links in notifications
+	PublicURL string
+
+	// Slack notifications. Scans are routed by the SlackChannelLabel target
+	// label, then by team through SlackTeamChannels ("team=channel" pairs).
+	SlackWebhookURL   string
+	SlackBotToken     string
+	SlackChannel      string
+	SlackTeamChannels []string
+	SlackChannelLabel string
+	SlackAPIURL       string
+
+	// Microsoft Teams and Discord webhook notifications
+	TeamsWebhookURL   string
+	DiscordWebhookURL string
+
+	// Out-of-tree notifiers as "name=..." pairs: NotifyExec runs a command
+	// (split on spaces, no shell) with the message as JSON on stdin, and
+	// NotifyWebhooks posts that JSON to a URL. Commands inherit only the
+	// NotifyExecEnv variables ("PREFIX_*" for a prefix), by default the
+	// ones they need to run and the WEEKLYSEC_NOTIFY_ ones.
+	NotifyExec        []string
+	NotifyExecTimeout time.Duration
+	NotifyExecEnv     []string
+	NotifyWebhooks    []string
+
+	// Email delivery of digests over SMTP; disabled when the host is empty.
+	// EmailRecipients are "scope=address" pairs where scope is "*", an org,
+	// "org/project" or "team:<name>".
+	SMTPHost        string
+	SMTPPort        int
+	SMTPUsername    string
+	SMTPPassword    string
+	SMTPFrom        string
+	SMTPTLS         string // "starttls", "tls" or "none"
+	EmailRecipients []string
+	EmailAttachPDF  bool
+
+	// GitHub pull requests. The token is used when a request brings none,
+	// only on the repos GitHubTokenRepos grants its tenant, as
+	// "org[/project]=owner/repo" pairs whose repo may be a pattern.
+	GitHubToken      string
+	GitHubTokenRepos []string
+	GitHubAPIURL     string
+
+	// GitHub issues for urgent findings; disabled when the repo is empty
+	GitHubIssuesRepo        string
+	GitHubIssuesMaxPriority int
+	GitHubIssuesLabels      []string
+	GitHubIssuesAssignees   []string
+	GitHubIssuesTitle       string // text/template
+	GitHubIssuesTemplate    string // path to a text/template file for the body
+
+	// Jira tickets for urgent findings; disabled when the URL is empty.
+	// JiraUser is the Jira Cloud account email; without it JiraToken is sent
+	// as a bearer personal access token.
+	JiraURL          string
+	JiraUser         string
+	JiraToken        string
+	JiraProject      string
+	JiraIssueType    string
+	JiraPriorities   []string // "SEVERITY=Priority" pairs replacing the default mapping
+	JiraLabels       []string
+	JiraCustomFields string // JSON object merged into the fields of new issues
+	JiraMaxPriority  int
+	JiraTitle        string // text/template
+	JiraTemplate     string // path to a text/template file for the description
+
+	// ServiceNow records for urgent findings; disabled when the URL is
+	// empty. ServiceNowUser and ServiceNowPassword authenticate with basic
+	// auth, otherwise ServiceNowToken is sent as an OAuth bearer token.
+	// Record states are synced back on ServiceNowSyncSchedule.
+	ServiceNowURL          string
+	ServiceNowUser         string
+	ServiceNowPassword     string
+	ServiceNowToken        string
+	ServiceNowTable        string   // incident, sn_si_incident, change_request...
+	ServiceNowLevels       []string // "PRIORITY=urgency/impact" pairs replacing the default mapping
+	ServiceNowFields       string   // JSON object merged into the fields of new records
+	ServiceNowMaxPriority  int
+	ServiceNowTitle        string // text/template
+	ServiceNowTemplate     string // path to a text/template file for the description
+	ServiceNowSyncSchedule string
+
+	// Paging for findings in the KEV catalog at or above AlertMinSeverity,
+	// or scoring at least AlertCVSSThreshold (0 disables). Disabled unless a
+	// PagerDuty routing key or Opsgenie API key is set. The KEV catalog is
+	// kept fresh when paging or policy rules are configured.
+	PagerDutyRoutingKey string
+	PagerDutyURL        string
+	OpsgenieAPIKey      string
+	OpsgenieURL         string
+	OpsgenieTags        []string
+	AlertMinSeverity    string
+	AlertCVSSThreshold  float64
+	KEVURL              string // CISA's feed when empty
+	KEVRefreshInterval  time.Duration
+
+	// DefectDojo export; disabled when the URL is empty. Each target maps to
+	// a test in the DefectDojoEngagement engagement of its org/project
+	// product, which the target's labels or environment can override.
+	DefectDojoURL              string
+	DefectDojoAPIKey           string
+	DefectDojoProductType      string
+	DefectDojoEngagement       string
+	DefectDojoMinimumSeverity  string // Info, Low, Medium, High or Critical
+	DefectDojoCloseOldFindings bool
+	DefectDojoAutoExport       bool // export every stored scan, not only on request
+
+	// CycloneDX SBOMs generated after every stored scan and uploaded to
+	// Dependency-Track when its URL is set. Projects are named after the
+	// target, versioned by its environment or DependencyTrackVersion, and
+	// nested under an existing "org/project" parent with
+	// DependencyTrackParents.
+	SBOMEnabled            bool
+	DependencyTrackURL     string
+	DependencyTrackAPIKey  string
+	DependencyTrackVersion string
+	DependencyTrackParents bool
+
+	// Registry push hooks; disabled when the secret is empty. Pushed images
+	// no registered target knows are scanned for RegistryWebhookTenant
+	// ("org/project"), or ignored when it is empty.
+	RegistryWebhookSecret string
+	RegistryWebhookTenant string
+	RegistryWebhookQueue  int
+
+	// Registry catalog crawling; disabled when the URL is empty. Selected
+	// images are registered as targets of RegistryCrawlTenant.
+	RegistryCrawlURL      string
+	RegistryCrawlUsername string
+	RegistryCrawlPassword string
+	RegistryCrawlInclude  []string // repository or repository:tag globs
+	RegistryCrawlExclude  []string
+	RegistryCrawlMaxTags  int // newest tags per repository
+	RegistryCrawlTenant   string
+	RegistryCrawlSchedule string   // cron spec of created targets
+	RegistryCrawlLabels   []string // "key=value" labels of created targets
+	RegistryCrawlPrune    bool
+	RegistryCrawlInterval time.Duration
+
+	// Kubernetes API access for the operator and cluster scans. The API
+	// server is found in-cluster unless KubeAPIURL is set.
+	KubeAPIURL string
+	KubeToken  string
+	KubeCAFile string
+
+	// Kubernetes operator mode: ScanTarget resources become targets of
+	// OperatorOrg, one project per namespace.
+	OperatorEnabled   bool
+	OperatorNamespace string // watched namespace; all when empty
+	OperatorOrg       string
+	OperatorResync    time.Duration
+
+	// Cluster scans: the distinct images running in the cluster are scanned
+	// for ClusterScanTenant on ClusterScanSchedule and on request.
+	ClusterScanEnabled           bool
+	ClusterScanTenant            string
+	ClusterScanNamespace         string // all when empty
+	ClusterScanExcludeNamespaces []string
+	ClusterScanOwnerLabel        string // pod or workload label naming the owning team
+	ClusterScanSchedule          string
+	ClusterScanConcurrency       int
+
+	// CI gate defaults: a scan fails when it has findings at a GateFailOn
+	// severity (only ones missing from the baseline with GateNewOnly) or a
+	// risk score above GateMaxRiskScore (0 disables).
+	GateFailOn       []string
+	GateNewOnly      bool
+	GateMaxRiskScore float64
+	GateCheckName    string // name of published GitHub check runs
+
+	// Policy rules (see package policy) judging every stored scan, read from
+	// the YAML or JSON PolicyFile unless set through the admin API. Deny
+	// violations fail gates and pre-sync checks; rules may also page.
+	PolicyFile string
+
+	// Prompt experiments (see package experiment) routing a share of runs
+	// to prompt and model variants, read from the YAML or JSON
+	// ExperimentsFile unless set through the admin API.
+	ExperimentsFile string
+
+	// Scoring hooks (see package scoring) that drop, re-rank and tag
+	// prioritized findings, read from the YAML or JSON ScoringFile unless
+	// set through the admin API.
+	ScoringFile string
+
+	// GitOps pre-sync checks judge the images about to be deployed with the
+	// gate policy, reusing scans younger than PresyncCacheTTL and scanning
+	// the rest for up to PresyncTimeout.
+	PresyncCacheTTL     time.Duration
+	PresyncTimeout      time.Duration
+	PresyncConcurrency  int
+	PresyncMaxImages    int
+	PresyncAllowPending bool // let images still being scanned through
+
+	// VEX documents name VEXAuthor as their author and publisher, with
+	// PublicURL as the publisher's namespace.
+	VEXAuthor string
+
+	// Service posture for developer portals such as Backstage: targets
+	// belong to the service named by their ServiceLabel label.
+	ServiceLabel string
+
+	// Team scorecards: targets without a team belong to the team named by
+	// their OwnerLabel label.
+	OwnerLabel string
+
+	// Image signature verification with cosign, on when CosignKeys or
+	// CosignIdentities (issuer=subject-regexp) are set. Images without a
+	// trusted signature have their findings moved up in priority.
+	CosignKeys            []string
+	CosignIdentities      []string
+	CosignAttestationType string // e.g. slsaprovenance; empty skips attestations
+	CosignTimeout         time.Duration
+
+	// Scan result attestations: image scans are signed with AttestationKey,
+	// an unencrypted PEM private key, and attached to the image with cosign
+	// when AttestationAttach is set.
+	AttestationKey    string
+	AttestationAttach bool
+
+	// Trivy bootstrap: when TrivyInstall is set and Trivy is not in PATH,
+	// the pinned release is downloaded into TrivyInstallDir, by default
+	// DataDir/trivy, and verified against TrivySHA256 or else the release's
+	// checksum file.
+	TrivyInstall     bool
+	TrivyVersion     string // "" uses the version the server is tested with
+	TrivyInstallDir  string
+	TrivyDownloadURL string // release mirror; "" uses GitHub
+	TrivySHA256      string
+
+	// Trivy output limits. Scans printing more than TrivyMaxOutputBytes of
+	// JSON fail; outputs over TrivyMaxRawOutputBytes are stored in compact
+	// form, without the fields the analysis does not read. 0 is unlimited.
+	TrivyMaxOutputBytes    int64
+	TrivyMaxRawOutputBytes int64
+
+	// Trivy cache shared by every scan, by default DataDir/trivy-cache. Its
+	// vulnerability DB is downloaded at startup unless current, and again
+	// every TrivyDBRefreshInterval, after which scans skip their own DB
+	// update. 0 leaves the updates to each scan.
+	TrivyCacheDir          string
+	TrivyDBRefreshInterval time.Duration
+
+	// Delta scanning: image layers are read from the registry before a
+	// scan, and an image whose layer stack was scanned against the current
+	// DB reuses those findings. The crawl registry credentials are used for
+	// its host; other registries are read anonymously.
+	DeltaScans bool
+
+	// Scanner sandbox: Trivy runs as SandboxUser when set, under the
+	// resource limits (0 is unlimited), and inherits only the SandboxEnv
+	// variables ("PREFIX_*" for a prefix), by default the ones it needs to
+	// reach registries and its TRIVY_* credentials, never the server's
+	// cloud ones. SandboxIsolate puts it in its own Linux namespaces,
+	// without network for config scans.
+	SandboxUser           string
+	SandboxMaxMemoryBytes int64
+	SandboxMaxCPUTime     time.Duration
+	SandboxMaxOpenFiles   int
+	SandboxMaxFileBytes   int64
+	SandboxIsolate        bool
+	SandboxEnv            []string
+
+	// Health checks
+	HealthCheckTimeout time.Duration
+	TrivyDBMaxAge      time.Duration // 0 disables the freshness check
+	ReadinessCheckLLM  bool
+
+	// Request limits
+	MaxTargetLength int
+	MaxRequestBytes int64
+	MaxImportBytes  int64
+
+	// MonorepoMaxComponents bounds the Dockerfiles, charts and lockfiles
+	// one repository scan may cover.
+	MonorepoMaxComponents int
+
+	// AppScanMaxImages bounds the images one application scan may cover.
+	AppScanMaxImages int
+
+	// Scan target allowlist. File targets must resolve under one of
+	// ScanFileRoots and images come from one of ScanImageRegistries
+	// ("host" or "host/path"); an empty list leaves that type unrestricted.
+	ScanFileRoots       []string
+	ScanImageRegistries []string
+
+	// Work queues. Agent runs beyond MaxConcurrentAgents wait in a queue of
+	// AgentQueueSize, and callers get 429 once it is full or after waiting
+	// AgentQueueWaitTimeout (0 waits as long as the caller). ScanWorkers
+	// bounds the Trivy processes of those runs.
+	MaxConcurrentAgents   int
+	AgentQueueSize        int
+	AgentQueueWaitTimeout time.Duration
+	ScanWorkers           int
+
+	// Shared job queue for HA deployments. With QueueBackend "redis",
+	// scheduled, bulk and push-triggered scans are queued in Redis at
+	// RedisURL and QueueWorkers of each replica take them; a job is tried
+	// QueueMaxAttempts times, QueueRetryBackoff apart and doubling, before
+	// it goes to the dead-letter queue. "memory" keeps them on the replica
+	// they started on, where scheduled scans that fail for a transient
+	// reason are retried the same way. Scans failing for other reasons,
+	// such as registry credentials, are not retried either way. "redis"
+	// needs StoreBackend "postgres" so every replica knows every target.
+	QueueBackend      string
+	RedisURL          string
+	QueuePrefix       string
+	QueueWorkers      int
+	QueueMaxAttempts  int
+	QueueRetryBackoff time.Duration
+}
+
+// Load reads the configuration from environment variables, falling back to
+// sensible defaults when a variable is unset or malformed.
+func Load() *Config {
+	return &Config{
+		Port:    getEnv("PORT", "8080"),
+		DataDir: getEnv("DATA_DIR", "data"),
+
+		StoreBackend:  getEnv("STORE_BACKEND", "sqlite"),
+		DatabaseURL:   os.Getenv("DATABASE_URL"),
+		BlobBackend:   os.Getenv("BLOB_BACKEND"),
+		BlobBucket:    os.Getenv("BLOB_BUCKET"),
+		BlobPrefix:    os.Getenv("BLOB_PREFIX"),
+		BlobEndpoint:  os.Getenv("BLOB_ENDPOINT"),
+		BlobRegion:    os.Getenv("BLOB_REGION"),
+		BlobAccessKey: os.Getenv("BLOB_ACCESS_KEY_ID"),
+		BlobSecretKey: os.Getenv("BLOB_SECRET_ACCESS_KEY"),
+		BlobInsecure:  getEnvBool("BLOB_INSECURE", false),
+
+		RetentionRawOutput: getEnvDuration("RETENTION_RAW_OUTPUT", 30*24*time.Hour),
+		RetentionScans:     getEnvDuration("RETENTION_SCANS", 365*24*time.Hour),
+		RetentionInterval:  getEnvDuration("RETENTION_INTERVAL", 24*time.Hour),
+
+		WorkspaceDir:           os.Getenv("WORKSPACE_DIR"),
+		WorkspaceTTL:           getEnvDuration("WORKSPACE_TTL", 24*time.Hour),
+		WorkspaceMaxBytes:      int64(getEnvInt("WORKSPACE_MAX_BYTES", 64<<20)),
+		WorkspaceSweepInterval: getEnvDuration("WORKSPACE_SWEEP_INTERVAL", 15*time.Minute),
+
+		TLSCertFile:       os.Getenv("TLS_CERT_FILE"),
+		TLSKeyFile:        os.Getenv("TLS_KEY_FILE"),
+		TLSClientCAFile:   os.Getenv("TLS_CLIENT_CA_FILE"),
+		TLSClientAuth:     getEnv("TLS_CLIENT_AUTH", "none"),
+		TLSReloadInterval: getEnvDuration("TLS_RELOAD_INTERVAL", time.Minute),
+
+		CORSAllowedOrigins:   getEnvList("CORS_ALLOWED_ORIGINS", nil),
+		CORSAllowedMethods:   getEnvList("CORS_ALLOWED_METHODS", []string{"GET", "POST", "OPTIONS"}),
+		CORSAllowedHeaders:   getEnvList("CORS_ALLOWED_HEADERS", []string{"Content-Type", "Authorization"}),
+		CORSAllowCredentials: getEnvBool("CORS_ALLOW_CREDENTIALS", false),
+		CORSMaxAge:           getEnvDuration("CORS_MAX_AGE", 10*time.Minute),
+
+		TracingEnabled:     getEnvBool("TRACING_ENABLED", os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") != ""),
+		TracingServiceName: getEnv("OTEL_SERVICE_NAME", "weeklysec"),
+
+		LLMModel:           os.Getenv("LLM_MODEL"),
+		PriorityThreshold:  getEnv("AGENT_PRIORITY_THRESHOLD", "HIGH"),
+		TokenBudget:        getEnvInt("AGENT_TOKEN_BUDGET", 0),
+		MaxVulnerabilities: getEnvInt("AGENT_MAX_VULNERABILITIES", 200),
+		PromptDir:          os.Getenv("PROMPT_DIR"),
+		TriageWindow:       getEnvDuration("TRIAGE_WINDOW", 180*24*time.Hour),
+
+		ReportLocale:      getEnv("REPORT_LOCALE", "en"),
+		LocaleDir:         os.Getenv("LOCALE_DIR"),
+		ReportTemplateDir: os.Getenv("REPORT_TEMPLATE_DIR"),
+
+		ReportOrgName:        os.Getenv("REPORT_ORG_NAME"),
+		ReportLogo:           os.Getenv("REPORT_LOGO"),
+		ReportClassification: os.Getenv("REPORT_CLASSIFICATION"),
+		ReportFooter:         os.Getenv("REPORT_FOOTER"),
+
+		LLMAttemptTimeout:  getEnvDuration("LLM_ATTEMPT_TIMEOUT", 2*time.Minute),
+		LLMTimeout:         getEnvDuration("LLM_TIMEOUT", 5*time.Minute),
+		LLMAttempts:        getEnvInt("LLM_ATTEMPTS", 3),
+		LLMMaxIdleConns:    getEnvInt("LLM_MAX_IDLE_CONNS", 16),
+		LLMIdleConnTimeout: getEnvDuration("LLM_IDLE_CONN_TIMEOUT", 90*time.Second),
+
+		LLMMinimizeData: getEnvBool("LLM_MINIMIZE_DATA", false),
+		LLMLocalURL:     os.Getenv("LLM_LOCAL_URL"),
+		LLMLocalAPIKey:  os.Getenv("LLM_LOCAL_API_KEY"),
+		LLMLocalModels:  getEnvList("LLM_LOCAL_MODELS", nil),
+
+		SyntheticScanFixtures: os.Getenv("SYNTHETIC_SCAN_FIXTURES"),
+		SyntheticScanLatency:  getEnvDuration("SYNTHETIC_SCAN_LATENCY", 0),
+		LLMMock:               getEnvBool("LLM_MOCK", false),
+		LLMMockLatency:        getEnvDuration("LLM_MOCK_LATENCY", 500*time.Millisecond),
+
+		ConfigFile:           getEnv("CONFIG_FILE", ".env"),
+		ConfigReloadInterval: getEnvDuration("CONFIG_RELOAD_INTERVAL", 30*time.Second),
+
+		SecretsRefreshInterval: getEnvDuration("SECRETS_REFRESH_INTERVAL", 5*time.Minute),
+		VaultAddr:              os.Getenv("VAULT_ADDR"),
+		VaultNamespace:         os.Getenv("VAULT_NAMESPACE"),
+		VaultToken:             os.Getenv("VAULT_TOKEN"),
+		VaultRole:              os.Getenv("VAULT_ROLE"),
+		VaultAuthPath:          getEnv("VAULT_AUTH_PATH", "kubernetes"),
+
+		APIKeys:      getEnvList("API_KEYS", nil),
+		JWTSecret:    os.Getenv("JWT_SECRET"),
+		JWTIssuer:    os.Getenv("JWT_ISSUER"),
+		JWTAudience:  os.Getenv("JWT_AUDIENCE"),
+		AuthRequired: getEnvBool("AUTH_REQUIRED", false),
+
+		AdminToken: os.Getenv("ADMIN_TOKEN"),
+
+		DashboardEnabled: getEnvBool("DASHBOARD_ENABLED", true),
+
+		SchedulerEnabled:      getEnvBool("SCHEDULER_ENABLED", true),
+		ScheduleDefault:       getEnv("SCHEDULE_DEFAULT", "@weekly"),
+		SchedulerSyncInterval: getEnvDuration("SCHEDULER_SYNC_INTERVAL", time.Minute),
+		SchedulerConcurrency:  getEnvInt("SCHEDULER_CONCURRENCY", 1),
+		SchedulerSelector:     getEnv("SCHEDULER_SELECTOR", ""),
+
+		DigestSchedule: getEnv("DIGEST_SCHEDULE", "0 9 * * 1"),
+		DigestPeriod:   getEnvDuration("DIGEST_PERIOD", 7*24*time.Hour),
+
+		ReportDeliverySchedule: getEnv("REPORT_DELIVERY_SCHEDULE", "*/5 * * * *"),
+
+		WatchSchedule: getEnv("WATCH_SCHEDULE", "@every 6h"),
+
+		FreshnessSLO:      getEnvDuration("FRESHNESS_SLO", 14*24*time.Hour),
+		FreshnessSchedule: getEnv("FRESHNESS_SCHEDULE", "0 8 * * *"),
+
+		SLACritical: getEnvDuration("SLA_CRITICAL", 7*24*time.Hour),
+		SLAHigh:     getEnvDuration("SLA_HIGH", 30*24*time.Hour),
+		SLAMedium:   getEnvDuration("SLA_MEDIUM", 90*24*time.Hour),
+		SLALow:      getEnvDuration("SLA_LOW", 0),
+
+		WebhookURLs:        getEnvList("WEBHOOK_URLS", nil),
+		WebhookSecret:      os.Getenv("WEBHOOK_SECRET"),
+		WebhookSecrets:     getEnvList("WEBHOOK_SECRETS", nil),
+		WebhookSummaryOnly: getEnvBool("WEBHOOK_SUMMARY_ONLY", false),
+		WebhookMaxRetries:  getEnvInt("WEBHOOK_MAX_RETRIES", 3),
+		WebhookTimeout:     getEnvDuration("WEBHOOK_TIMEOUT", 10*time.Second),
+
+		ReportSigningSecret: os.Getenv("REPORT_SIGNING_SECRET"),
+
+		QuotaCostPer1KTokens: getEnvFloat("QUOTA_COST_PER_1K_TOKENS", 0),
+
+		PublicURL: os.Getenv("PUBLIC_URL"),
+
+		SlackWebhookURL:   os.Getenv("SLACK_WEBHOOK_URL"),
+		SlackBotToken:     os.Getenv("SLACK_BOT_TOKEN"),
+		SlackChannel:      os.Getenv("SLACK_CHANNEL"),
+		SlackTeamChannels: getEnvList("SLACK_TEAM_CHANNELS", nil),
+		SlackChannelLabel: getEnv("SLACK_CHANNEL_LABEL", "slack-channel"),
+		SlackAPIURL:       getEnv("SLACK_API_URL", "https://slack.com/api"),
+
+		TeamsWebhookURL:   os.Getenv("TEAMS_WEBHOOK_URL"),
+		DiscordWebhookURL: os.Getenv("DISCORD_WEBHOOK_URL"),
+
+		NotifyExec:        getEnvList("NOTIFY_EXEC", nil),
+		NotifyExecTimeout: getEnvDuration("NOTIFY_EXEC_TIMEOUT", 30*time.Second),
+		NotifyExecEnv:     getEnvList("NOTIFY_EXEC_ENV", nil),
+		NotifyWebhooks:    getEnvList("NOTIFY_WEBHOOKS", nil),
+
+		SMTPHost:        os.Getenv("SMTP_HOST"),
+		SMTPPort:        getEnvInt("SMTP_PORT", 587),
+		SMTPUsername:    os.Getenv("SMTP_USERNAME"),
+		SMTPPassword:    os.Getenv("SMTP_PASSWORD"),
+		SMTPFrom:        os.Getenv("SMTP_FROM"),
+		SMTPTLS:         getEnv("SMTP_TLS", "starttls"),
+		EmailRecipients: getEnvList("EMAIL_RECIPIENTS", nil),
+		EmailAttachPDF:  getEnvBool("EMAIL_ATTACH_PDF", true),
+
+		GitHubToken:      os.Getenv("GITHUB_TOKEN"),
+		GitHubTokenRepos: getEnvList("GITHUB_TOKEN_REPOS", nil),
+		GitHubAPIURL:     getEnv("GITHUB_API_URL", "https://api.github.com"),
+
+		GitHubIssuesRepo:        os.Getenv("GITHUB_ISSUES_REPO"),
+		GitHubIssuesMaxPriority: getEnvInt("GITHUB_ISSUES_MAX_PRIORITY", 2),
+		GitHubIssuesLabels:      getEnvList("GITHUB_ISSUES_LABELS", []string{"security"}),
+		GitHubIssuesAssignees:   getEnvList("GITHUB_ISSUES_ASSIGNEES", nil),
+		GitHubIssuesTitle:       os.Getenv("GITHUB_ISSUES_TITLE"),
+		GitHubIssuesTemplate:    os.Getenv("GITHUB_ISSUES_TEMPLATE"),
+
+		JiraURL:          os.Getenv("JIRA_URL"),
+		JiraUser:         os.Getenv("JIRA_USER"),
+		JiraToken:        os.Getenv("JIRA_TOKEN"),
+		JiraProject:      os.Getenv("JIRA_PROJECT"),
+		JiraIssueType:    getEnv("JIRA_ISSUE_TYPE", "Bug"),
+		JiraPriorities:   getEnvList("JIRA_PRIORITIES", nil),
+		JiraLabels:       getEnvList("JIRA_LABELS", []string{"security"}),
+		JiraCustomFields: os.Getenv("JIRA_CUSTOM_FIELDS"),
+		JiraMaxPriority:  getEnvInt("JIRA_MAX_PRIORITY", 2),
+		JiraTitle:        os.Getenv("JIRA_TITLE"),
+		JiraTemplate:     os.Getenv("JIRA_TEMPLATE"),
+
+		ServiceNowURL:          os.Getenv("SERVICENOW_URL"),
+		ServiceNowUser:         os.Getenv("SERVICENOW_USER"),
+		ServiceNowPassword:     os.Getenv("SERVICENOW_PASSWORD"),
+		ServiceNowToken:        os.Getenv("SERVICENOW_TOKEN"),
+		ServiceNowTable:        getEnv("SERVICENOW_TABLE", "incident"),
+		ServiceNowLevels:       getEnvList("SERVICENOW_LEVELS", nil),
+		ServiceNowFields:       os.Getenv("SERVICENOW_FIELDS"),
+		ServiceNowMaxPriority:  getEnvInt("SERVICENOW_MAX_PRIORITY", 2),
+		ServiceNowTitle:        os.Getenv("SERVICENOW_TITLE"),
+		ServiceNowTemplate:     os.Getenv("SERVICENOW_TEMPLATE"),
+		ServiceNowSyncSchedule: getEnv("SERVICENOW_SYNC_SCHEDULE", "@every 15m"),
+
+		PagerDutyRoutingKey: os.Getenv("PAGERDUTY_ROUTING_KEY"),
+		PagerDutyURL:        os.Getenv("PAGERDUTY_URL"),
+		OpsgenieAPIKey:      os.Getenv("OPSGENIE_API_KEY"),
+		OpsgenieURL:         os.Getenv("OPSGENIE_URL"),
+		OpsgenieTags:        getEnvList("OPSGENIE_TAGS", []string{"security"}),
+		AlertMinSeverity:    getEnv("ALERT_MIN_SEVERITY", "CRITICAL"),
+		AlertCVSSThreshold:  getEnvFloat("ALERT_CVSS_THRESHOLD", 0),
+		KEVURL:              os.Getenv("KEV_URL"),
+		KEVRefreshInterval:  getEnvDuration("KEV_REFRESH_INTERVAL", 24*time.Hour),
+
+		DefectDojoURL:              os.Getenv("DEFECTDOJO_URL"),
+		DefectDojoAPIKey:           os.Getenv("DEFECTDOJO_API_KEY"),
+		DefectDojoProductType:      getEnv("DEFECTDOJO_PRODUCT_TYPE", "weeklysec"),
+		DefectDojoEngagement:       getEnv("DEFECTDOJO_ENGAGEMENT", "weeklysec"),
+		DefectDojoMinimumSeverity:  os.Getenv("DEFECTDOJO_MINIMUM_SEVERITY"),
+		DefectDojoCloseOldFindings: getEnvBool("DEFECTDOJO_CLOSE_OLD_FINDINGS", true),
+		DefectDojoAutoExport:       getEnvBool("DEFECTDOJO_AUTO_EXPORT", true),
+
+		SBOMEnabled:            getEnvBool("SBOM_ENABLED", false),
+		DependencyTrackURL:     os.Getenv("DEPENDENCY_TRACK_URL"),
+		DependencyTrackAPIKey:  os.Getenv("DEPENDENCY_TRACK_API_KEY"),
+		DependencyTrackVersion: getEnv("DEPENDENCY_TRACK_PROJECT_VERSION", "latest"),
+		DependencyTrackParents: getEnvBool("DEPENDENCY_TRACK_PARENTS", false),
+
+		RegistryWebhookSecret: os.Getenv("REGISTRY_WEBHOOK_SECRET"),
+		RegistryWebhookTenant: os.Getenv("REGISTRY_WEBHOOK_TENANT"),
+		RegistryWebhookQueue:  getEnvInt("REGISTRY_WEBHOOK_QUEUE", 100),
+
+		RegistryCrawlURL:      os.Getenv("REGISTRY_CRAWL_URL"),
+		RegistryCrawlUsername: os.Getenv("REGISTRY_CRAWL_USERNAME"),
+		RegistryCrawlPassword: os.Getenv("REGISTRY_CRAWL_PASSWORD"),
+		RegistryCrawlInclude:  getEnvList("REGISTRY_CRAWL_INCLUDE", nil),
+		RegistryCrawlExclude:  getEnvList("REGISTRY_CRAWL_EXCLUDE", nil),
+		RegistryCrawlMaxTags:  getEnvInt("REGISTRY_CRAWL_MAX_TAGS", 3),
+		RegistryCrawlTenant:   getEnv("REGISTRY_CRAWL_TENANT", "default/default"),
+		RegistryCrawlSchedule: os.Getenv("REGISTRY_CRAWL_SCHEDULE"),
+		RegistryCrawlLabels:   getEnvList("REGISTRY_CRAWL_LABELS", nil),
+		RegistryCrawlPrune:    getEnvBool("REGISTRY_CRAWL_PRUNE", true),
+		RegistryCrawlInterval: getEnvDuration("REGISTRY_CRAWL_INTERVAL", 6*time.Hour),
+
+		KubeAPIURL: os.Getenv("KUBE_API_URL"),
+		KubeToken:  os.Getenv("KUBE_TOKEN"),
+		KubeCAFile: os.Getenv("KUBE_CA_FILE"),
+
+		OperatorEnabled:   getEnvBool("OPERATOR_ENABLED", false),
+		OperatorNamespace: os.Getenv("OPERATOR_NAMESPACE"),
+		OperatorOrg:       getEnv("OPERATOR_ORG", "default"),
+		OperatorResync:    getEnvDuration("OPERATOR_RESYNC", 30*time.Second),
+
+		ClusterScanEnabled:           getEnvBool("CLUSTER_SCAN_ENABLED", false),
+		ClusterScanTenant:            getEnv("CLUSTER_SCAN_TENANT", "default/default"),
+		ClusterScanNamespace:         os.Getenv("CLUSTER_SCAN_NAMESPACE"),
+		ClusterScanExcludeNamespaces: getEnvList("CLUSTER_SCAN_EXCLUDE_NAMESPACES", []string{"kube-system"}),
+		ClusterScanOwnerLabel:        getEnv("CLUSTER_SCAN_OWNER_LABEL", "team"),
+		ClusterScanSchedule:          getEnv("CLUSTER_SCAN_SCHEDULE", "@daily"),
+		ClusterScanConcurrency:       getEnvInt("CLUSTER_SCAN_CONCURRENCY", 2),
+
+		GateFailOn:       getEnvList("GATE_FAIL_ON", []string{"CRITICAL"}),
+		GateNewOnly:      getEnvBool("GATE_NEW_ONLY", true),
+		GateMaxRiskScore: getEnvFloat("GATE_MAX_RISK_SCORE", 0),
+		GateCheckName:    getEnv("GATE_CHECK_NAME", "weeklysec"),
+
+		PolicyFile: os.Getenv("POLICY_FILE"),
+
+		ExperimentsFile: os.Getenv("EXPERIMENTS_FILE"),
+
+		ScoringFile: os.Getenv("SCORING_FILE"),
+
+		PresyncCacheTTL:     getEnvDuration("PRESYNC_CACHE_TTL", 24*time.Hour),
+		PresyncTimeout:      getEnvDuration("PRESYNC_TIMEOUT", 90*time.Second),
+		PresyncConcurrency:  getEnvInt("PRESYNC_CONCURRENCY", 4),
+		PresyncMaxImages:    getEnvInt("PRESYNC_MAX_IMAGES", 50),
+		PresyncAllowPending: getEnvBool("PRESYNC_ALLOW_PENDING", false),
+
+		VEXAuthor: getEnv("VEX_AUTHOR", "weeklysec"),
+
+		ServiceLabel: getEnv("SERVICE_LABEL", "service"),
+		OwnerLabel:   getEnv("OWNER_LABEL", "team"),
+
+		CosignKeys:            getEnvList("COSIGN_KEYS", nil),
+		CosignIdentities:      getEnvList("COSIGN_IDENTITIES", nil),
+		CosignAttestationType: os.Getenv("COSIGN_ATTESTATION_TYPE"),
+		CosignTimeout:         getEnvDuration("COSIGN_TIMEOUT", time.Minute),
+
+		AttestationKey:    os.Getenv("ATTESTATION_KEY"),
+		AttestationAttach: getEnvBool("ATTESTATION_ATTACH", false),
+
+		TrivyInstall:     getEnvBool("TRIVY_INSTALL", false),
+		TrivyVersion:     os.Getenv("TRIVY_VERSION"),
+		TrivyInstallDir:  os.Getenv("TRIVY_INSTALL_DIR"),
+		TrivyDownloadURL: os.Getenv("TRIVY_DOWNLOAD_URL"),
+		TrivySHA256:      os.Getenv("TRIVY_SHA256"),
+
+		TrivyMaxOutputBytes:    int64(getEnvInt("TRIVY_MAX_OUTPUT_BYTES", 1<<30)),
+		TrivyMaxRawOutputBytes: int64(getEnvInt("TRIVY_MAX_RAW_OUTPUT_BYTES", 32<<20)),
+		TrivyCacheDir:          os.Getenv("TRIVY_CACHE_DIR"),
+		TrivyDBRefreshInterval: getEnvDuration("TRIVY_DB_REFRESH_INTERVAL", 6*time.Hour),
+		DeltaScans:             getEnvBool("DELTA_SCANS", true),
+
+		SandboxUser:           os.Getenv("SANDBOX_USER"),
+		SandboxMaxMemoryBytes: int64(getEnvInt("SANDBOX_MAX_MEMORY_BYTES", 4<<30)),
+		SandboxMaxCPUTime:     getEnvDuration("SANDBOX_MAX_CPU_TIME", 0),
+		SandboxMaxOpenFiles:   getEnvInt("SANDBOX_MAX_OPEN_FILES", 4096),
+		SandboxMaxFileBytes:   int64(getEnvInt("SANDBOX_MAX_FILE_BYTES", 0)),
+		SandboxIsolate:        getEnvBool("SANDBOX_ISOLATE", false),
+		SandboxEnv:            getEnvList("SANDBOX_ENV", nil),
+
+		HealthCheckTimeout: getEnvDuration("HEALTH_CHECK_TIMEOUT", 5*time.Second),
+		TrivyDBMaxAge:      getEnvDuration("TRIVY_DB_MAX_AGE", 72*time.Hour),
+		ReadinessCheckLLM:  getEnvBool("READINESS_CHECK_LLM", false),
+
+		MaxTargetLength: getEnvInt("MAX_TARGET_LENGTH", 512),
+		MaxRequestBytes: int64(getEnvInt("MAX_REQUEST_BYTES", 1<<20)),
+		MaxImportBytes:  int64(getEnvInt("MAX_IMPORT_BYTES", 1<<30)),
+
+		MonorepoMaxComponents: getEnvInt("MONOREPO_MAX_COMPONENTS", 50),
+		AppScanMaxImages:      getEnvInt("APP_SCAN_MAX_IMAGES", 20),
+
+		ScanFileRoots:       getEnvList("SCAN_FILE_ROOTS", nil),
+		ScanImageRegistries: getEnvList("SCAN_IMAGE_REGISTRIES", nil),
+
+		MaxConcurrentAgents:   getEnvInt("MAX_CONCURRENT_AGENTS", 4),
+		AgentQueueSize:        getEnvInt("AGENT_QUEUE_SIZE", 16),
+		AgentQueueWaitTimeout: getEnvDuration("AGENT_QUEUE_WAIT_TIMEOUT", 0),
+		ScanWorkers:           getEnvInt("SCAN_WORKERS", 2),
+
+		QueueBackend:      getEnv("QUEUE_BACKEND", "memory"),
+		RedisURL:          getEnv("REDIS_URL", "redis://localhost:6379/0"),
+		QueuePrefix:       getEnv("QUEUE_PREFIX", "weeklysec"),
+		QueueWorkers:      getEnvInt("QUEUE_WORKERS", 2),
+		QueueMaxAttempts:  getEnvInt("QUEUE_MAX_ATTEMPTS", 3),
+		QueueRetryBackoff: getEnvDuration("QUEUE_RETRY_BACKOFF", time.Minute),
+	}
+}
+
+func getEnv(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
+
+func getEnvInt(key string, fallback int) int {
+	v, err := strconv.Atoi(os.Getenv(key))
+	if err != nil || v <= 0 {
+		return fallback
+	}
+	return v
+}
+
+func getEnvFloat(key string, fallback float64) float64 {
+	v, err := strconv.ParseFloat(os.Getenv(key), 64)
+	if err != nil || v < 0 {
+		return fallback
+	}
+	return v
+}
+
+func getEnvBool(key string, fallback bool) bool {
+	v, err := strconv.ParseBool(os.Getenv(key))
+	if err != nil {
+		return fallback
+	}
+	return v
+}
+
+// getEnvList splits a comma-separated variable, dropping empty entries.
+func getEnvList(key string, fallback []string) []string {
+	var out []string
+	for _, item := range strings.Split(os.Getenv(key), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	if len(out) == 0 {
+		return fallback
+	}
+	return out
+}
+
+func getEnvDuration(key string, fallback time.Duration) time.Duration {
+	v, err := time.ParseDuration(os.Getenv(key))
+	if err != nil || v < 0 {
+		return fallback
+	}
+	return v
+}
+
+// SLA returns the remediation SLAs keyed by severity, leaving out those
+// that are disabled.
+func (c *Config) SLA() map[string]time.Duration {
+	out := map[string]time.Duration{}
+	for sev, d := range map[string]time.Duration{
+		"CRITICAL": c.SLACritical,
+		"HIGH":     c.SLAHigh,
+		"MEDIUM":   c.SLAMedium,
+		"LOW":      c.SLALow,
+	} {
+		if d > 0 {
+			out[sev] = d
+		}
+	}
+	return out
+}
+
+// TLSEnabled reports whether the server should serve HTTPS itself.
+func (c *Config) TLSEnabled() bool {
+	return c.TLSCertFile != "" && c.TLSKeyFile != ""
+}
@@ -0,0 +1,225 @@
+// Package cosign verifies image signatures and attestations with the cosign
+// CLI, against public keys or keyless (Fulcio) identities, and attaches
+// attestations to images.
+package cosign
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+	"time"
+	"weeklysec/internal/errcode"
+	"weeklysec/internal/tracing"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// Verification statuses.
+const (
+	StatusVerified  = "verified"  // signed by a trusted key or identity
+	StatusUnsigned  = "unsigned"  // no signatures at all
+	StatusUntrusted = "untrusted" // signed, but not by anyone trusted
+	StatusError     = "error"     // verification could not run
+)
+
+// Identity is a keyless signer: a certificate issued by Fulcio to a subject
+// matching SubjectRegexp, authenticated by Issuer.
+type Identity struct {
+	Issuer        string
+	SubjectRegexp string
+}
+
+// ParseIdentity parses "issuer=subject-regexp", e.g.
+// "https://token.actions.githubusercontent.com=^https://github.com/acme/".
+func ParseIdentity(s string) (Identity, error) {
+	issuer, subject, ok := strings.Cut(s, "=")
+	issuer, subject = strings.TrimSpace(issuer), strings.TrimSpace(subject)
+	if !ok || issuer == "" || subject == "" {
+		return Identity{}, fmt.Errorf("invalid identity %q: want issuer=subject-regexp", s)
+	}
+	if _, err := regexp.Compile(subject); err != nil {
+		return Identity{}, fmt.Errorf("invalid identity %q: %w", s, err)
+	}
+	return Identity{Issuer: issuer, SubjectRegexp: subject}, nil
+}
+
+// Verifier checks images against the trusted keys and identities. An image
+// is verified when any one of them signed it.
+type Verifier struct {
+	Keys            []string // key files, KMS URIs or k8s:// secrets
+	Identities      []Identity
+	AttestationType string // predicate type to verify, e.g. slsaprovenance; empty skips attestations
+	Timeout         time.Duration
+}
+
+// Result is the outcome of verifying one image.
+type Result struct {
+	Status          string `json:"status"`
+	Signer          string `json:"signer,omitempty"` // key or certificate subject that verified
+	AttestationType string `json:"attestation_type,omitempty"`
+	Attested        bool   `json:"attested"` // an attestation of AttestationType verified
+	Error           string `json:"error,omitempty"`
+}
+
+// Verified reports whether the image carries a trusted signature.
+func (r *Result) Verified() bool {
+	return r != nil && r.Status == StatusVerified
+}
+
+// Verify checks the image's signatures and, when configured, its
+// attestation. It never fails: problems are reported in the result.
+func (v *Verifier) Verify(ctx context.Context, image string) (res *Result) {
+	ctx, span := tracing.Start(ctx, "cosign.verify", attribute.String("scan.target", image))
+	defer func() { span.SetAttributes(attribute.String("cosign.status", res.Status)); span.End() }()
+
+	if v.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, v.Timeout)
+		defer cancel()
+	}
+
+	res = &Result{Status: StatusUnsigned, AttestationType: v.AttestationType}
+	signed := false
+	var errs []string
+	for _, trust := range v.trusted() {
+		signer, err := run(ctx, "verify", trust, image)
+		if err == nil {
+			res.Status, res.Signer = StatusVerified, signer
+			break
+		}
+		switch {
+		case errors.Is(err, errUnsigned):
+		case errors.Is(err, errUntrusted):
+			signed = true
+		default:
+			errs = append(errs, err.Error())
+		}
+	}
+	switch {
+	case res.Status == StatusVerified:
+	case signed:
+		res.Status = StatusUntrusted
+	case len(errs) > 0:
+		res.Status, res.Error = StatusError, strings.Join(errs, "; ")
+		return res
+	}
+
+	if v.AttestationType != "" {
+		for _, trust := range v.trusted() {
+			if _, err := run(ctx, "verify-attestation", append(trust, "--type", v.AttestationType), image); err == nil {
+				res.Attested = true
+				break
+			}
+		}
+	}
+	return res
+}
+
+// AttachAttestation attaches a signed DSSE envelope to the image ref, which
+// should name a digest, in the registry.
+func AttachAttestation(ctx context.Context, ref string, envelope []byte) error {
+	f, err := os.CreateTemp("", "weeklysec-attestation-*.json")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(envelope); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "cosign", "attach", "attestation", "--attestation", f.Name(), ref)
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if msg == "" {
+			msg = err.Error()
+		}
+		return errcode.Wrap(errcode.AttestationFailed, fmt.Errorf("cosign attach attestation: %s", lastLine(msg)))
+	}
+	return nil
+}
+
+// trusted returns the cosign flags of each trusted key and identity.
+func (v *Verifier) trusted() [][]string {
+	var out [][]string
+	for _, key := range v.Keys {
+		out = append(out, []string{"--key", key})
+	}
+	for _, id := range v.Identities {
+		out = append(out, []string{"--certificate-oidc-issuer", id.Issuer, "--certificate-identity-regexp", id.SubjectRegexp})
+	}
+	return out
+}
+
+var (
+	errUnsigned  = errors.New("no signatures found")
+	errUntrusted = errors.New("no matching signatures")
+)
+
+// run invokes one cosign verification and returns the signer it reports.
+func run(ctx context.Context, command string, trust []string, image string) (string, error) {
+	args := append([]string{command, "--output", "json"}, trust...)
+	cmd := exec.CommandContext(ctx, "cosign", append(args, image)...)
+	var out, stderr bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		lower := strings.ToLower(msg)
+		switch {
+		case ctx.Err() != nil:
+			return "", fmt.Errorf("cosign %s: %w", command, ctx.Err())
+		case strings.Contains(lower, "no signatures found"), strings.Contains(lower, "no matching attestations"):
+			return "", errUnsigned
+		case strings.Contains(lower, "no matching signatures"):
+			return "", errUntrusted
+		}
+		if msg == "" {
+			msg = err.Error()
+		}
+		return "", fmt.Errorf("cosign %s: %s", command, lastLine(msg))
+	}
+	return signer(out.Bytes(), trust), nil
+}
+
+// signer picks the certificate subject of the first verified signature,
+// falling back to the key that verified it.
+func signer(out []byte, trust []string) string {
+	var sigs []struct {
+		Optional struct {
+			Subject string `json:"Subject"`
+		} `json:"optional"`
+	}
+	// verify prints a JSON array; verify-attestation prints envelopes, one
+	// per line, which are not needed.
+	if json.Unmarshal(bytes.TrimSpace(out), &sigs) == nil {
+		for _, s := range sigs {
+			if s.Optional.Subject != "" {
+				return s.Optional.Subject
+			}
+		}
+	}
+	if trust[0] == "--key" {
+		return trust[1]
+	}
+	return ""
+}
+
+func lastLine(s string) string {
+	if i := strings.LastIndexByte(s, '\n'); i >= 0 {
+		return s[i+1:]
+	}
+	return s
+}
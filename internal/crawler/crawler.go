@@ -0,0 +1,305 @@
+// Package crawler keeps the target inventory in step with a registry's
+// catalog: it lists every repository and tag, keeps the newest tags of the
+// repositories that pass the include and exclude patterns, and registers
+// them as image targets for the scheduler to scan.
+package crawler
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"weeklysec/internal/registry"
+	"weeklysec/internal/store"
+
+	"github.com/rs/zerolog/log"
+)
+
+// ManagedLabel marks the targets the crawler owns, which it updates and
+// removes as the catalog changes.
+const ManagedLabel = "managed-by"
+
+// managedValue is ManagedLabel's value on crawled targets.
+const managedValue = "registry-crawler"
+
+// Options decide which images become targets and how they are set up.
+type Options struct {
+	Org      string
+	Project  string
+	Include  []string          // repository globs, or repository:tag globs when they contain ':'; all when empty. '*' matches '/' too
+	Exclude  []string          // same syntax, applied after Include
+	MaxTags  int               // newest tags kept per repository; 0 keeps all
+	Schedule string            // cron spec of created targets; the scheduler default when empty
+	Labels   map[string]string // added to created targets
+	Prune    bool              // delete crawled targets no longer selected
+}
+
+// Result describes one crawl.
+type Result struct {
+	StartedAt    time.Time `json:"started_at"`
+	FinishedAt   time.Time `json:"finished_at"`
+	Repositories int       `json:"repositories"` // repositories selected
+	Images       int       `json:"images"`       // repository:tag pairs selected
+	Added        int       `json:"added"`
+	Removed      int       `json:"removed"`
+	Errors       int       `json:"errors"`
+	LastError    string    `json:"last_error,omitempty"`
+}
+
+// Crawler registers a registry's images as targets. Only one crawl runs at
+// a time.
+type Crawler struct {
+	store   *store.Store
+	client  *registry.Client
+	opts    Options
+	include []pattern
+	exclude []pattern
+
+	mu sync.Mutex
+}
+
+// New returns a crawler of client's registry.
+func New(st *store.Store, client *registry.Client, opts Options) (*Crawler, error) {
+	return &Crawler{
+		store:   st,
+		client:  client,
+		opts:    opts,
+		include: compile(opts.Include),
+		exclude: compile(opts.Exclude),
+	}, nil
+}
+
+// Crawl lists the catalog and syncs the targets. Failing to list a
+// repository's tags is counted and skips it, leaving its targets alone.
+func (c *Crawler) Crawl(ctx context.Context) (Result, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	res := Result{StartedAt: time.Now().UTC()}
+	repos, err := c.client.Repositories(ctx)
+	if err != nil {
+		return res, err
+	}
+
+	host := c.client.Host()
+	keep := map[string]bool{}    // image references selected
+	skipped := map[string]bool{} // repositories whose tags could not be listed
+	for _, repo := range repos {
+		if !c.selected(repo) {
+			continue
+		}
+		tags, err := c.client.Tags(ctx, repo)
+		if err != nil {
+			res.Errors++
+			res.LastError = err.Error()
+			skipped[host+"/"+repo] = true
+			continue
+		}
+		tags = c.newest(repo, tags)
+		if len(tags) == 0 {
+			continue
+		}
+		res.Repositories++
+		for _, tag := range tags {
+			ref := host + "/" + repo + ":" + tag
+			keep[ref] = true
+			res.Images++
+			added, err := c.register(repo+":"+tag, ref)
+			if err != nil {
+				res.Errors++
+				res.LastError = err.Error()
+			} else if added {
+				res.Added++
+			}
+		}
+	}
+
+	if c.opts.Prune {
+		targets, err := c.store.ListTargets(store.TargetFilter{Org: c.opts.Org, Project: c.opts.Project})
+		if err != nil {
+			return res, err
+		}
+		for _, t := range targets {
+			if t.Labels[ManagedLabel] != managedValue || !strings.HasPrefix(t.Target, host+"/") || keep[t.Target] {
+				continue
+			}
+			if skipped[repositoryOf(t.Target)] {
+				continue
+			}
+			if err := c.store.DeleteTarget(t.ID); err != nil {
+				res.Errors++
+				res.LastError = err.Error()
+				continue
+			}
+			res.Removed++
+		}
+	}
+
+	res.FinishedAt = time.Now().UTC()
+	return res, nil
+}
+
+// Run crawls now and then every interval until stop is closed.
+func (c *Crawler) Run(interval time.Duration, stop <-chan struct{}) {
+	crawl := func() {
+		ctx, cancel := context.WithTimeout(context.Background(), interval)
+		defer cancel()
+		res, err := c.Crawl(ctx)
+		if err != nil {
+			log.Error().Err(err).Str("registry", c.client.Host()).Msg("Registry crawl failed")
+			return
+		}
+		log.Info().
+			Str("registry", c.client.Host()).
+			Int("images", res.Images).
+			Int("added", res.Added).
+			Int("removed", res.Removed).
+			Int("errors", res.Errors).
+			Msg("Registry crawl finished")
+	}
+
+	crawl()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			crawl()
+		case <-stop:
+			return
+		}
+	}
+}
+
+// register creates the target of ref unless the tenant already has one,
+// and reports whether it did.
+func (c *Crawler) register(name, ref string) (bool, error) {
+	if _, err := c.store.FindTarget(c.opts.Org, c.opts.Project, "image", ref); err == nil {
+		return false, nil
+	} else if !errors.Is(err, store.ErrNotFound) {
+		return false, err
+	}
+	labels := map[string]string{ManagedLabel: managedValue}
+	for k, v := range c.opts.Labels {
+		labels[k] = v
+	}
+	now := time.Now().UTC()
+	return true, c.store.SaveTarget(store.Target{
+		ID:         store.NewID(),
+		Org:        c.opts.Org,
+		Project:    c.opts.Project,
+		Name:       name,
+		TargetType: "image",
+		Target:     ref,
+		Schedule:   c.opts.Schedule,
+		Labels:     labels,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	})
+}
+
+// selected reports whether a repository passes the repository patterns.
+func (c *Crawler) selected(repo string) bool {
+	return matches(c.include, repo, false, true) && !matches(c.exclude, repo, false, false)
+}
+
+// newest applies the tag patterns and keeps the MaxTags highest tags.
+func (c *Crawler) newest(repo string, tags []string) []string {
+	var out []string
+	for _, tag := range tags {
+		image := repo + ":" + tag
+		if matches(c.include, image, true, true) && !matches(c.exclude, image, true, false) {
+			out = append(out, tag)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return compareTags(out[i], out[j]) > 0 })
+	if c.opts.MaxTags > 0 && len(out) > c.opts.MaxTags {
+		out = out[:c.opts.MaxTags]
+	}
+	return out
+}
+
+// pattern is a compiled glob.
+type pattern struct {
+	re   *regexp.Regexp
+	tags bool // matches repository:tag rather than repository
+}
+
+// compile turns globs into patterns; '*' matches any run of characters and
+// '?' any one.
+func compile(globs []string) []pattern {
+	out := make([]pattern, len(globs))
+	for i, g := range globs {
+		expr := regexp.QuoteMeta(g)
+		expr = strings.ReplaceAll(expr, `\*`, ".*")
+		expr = strings.ReplaceAll(expr, `\?`, ".")
+		out[i] = pattern{re: regexp.MustCompile("^" + expr + "$"), tags: strings.Contains(g, ":")}
+	}
+	return out
+}
+
+// matches reports whether s matches one of the patterns of its kind:
+// repository:tag patterns when tags is set, repository patterns otherwise.
+// Without patterns of that kind it returns def.
+func matches(patterns []pattern, s string, tags, def bool) bool {
+	found := false
+	for _, p := range patterns {
+		if p.tags != tags {
+			continue
+		}
+		found = true
+		if p.re.MatchString(s) {
+			return true
+		}
+	}
+	return !found && def
+}
+
+// compareTags orders tags by their version: runs of digits compare as
+// numbers, so "1.10" sorts above "1.9" and "v2" above "v1".
+func compareTags(a, b string) int {
+	for a != "" && b != "" {
+		ca, ra := leadingRun(a)
+		cb, rb := leadingRun(b)
+		a, b = ra, rb
+		da, db := isDigits(ca), isDigits(cb)
+		switch {
+		case da && db:
+			na, nb := strings.TrimLeft(ca, "0"), strings.TrimLeft(cb, "0")
+			if len(na) != len(nb) {
+				return len(na) - len(nb)
+			}
+			if na != nb {
+				return strings.Compare(na, nb)
+			}
+		case ca != cb:
+			return strings.Compare(ca, cb)
+		}
+	}
+	return len(a) - len(b)
+}
+
+// leadingRun splits off s's leading run of digits or of other characters.
+func leadingRun(s string) (string, string) {
+	digit := unicode.IsDigit(rune(s[0]))
+	i := 1
+	for i < len(s) && unicode.IsDigit(rune(s[i])) == digit {
+		i++
+	}
+	return s[:i], s[i:]
+}
+
+func isDigits(s string) bool {
+	return s != "" && unicode.IsDigit(rune(s[0]))
+}
+
+func repositoryOf(ref string) string {
+	if i := strings.LastIndex(ref, ":"); i > strings.LastIndex(ref, "/") {
+		return ref[:i]
+	}
+	return ref
+}
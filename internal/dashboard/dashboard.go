@@ -0,0 +1,27 @@
+// Package dashboard serves the embedded web UI. The UI is plain static
+// files that talk to the JSON and GraphQL APIs with the caller's own
+// credentials, so it needs no server-side state of its own.
+package dashboard
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+//go:embed static
+var static embed.FS
+
+// Register mounts the dashboard under /ui and redirects / to it.
+func Register(r *gin.Engine) {
+	files, err := fs.Sub(static, "static")
+	if err != nil {
+		panic(err) // the embedded tree is fixed at build time
+	}
+	r.StaticFS("/ui", http.FS(files))
+	r.GET("/", func(c *gin.Context) {
+		c.Redirect(http.StatusFound, "/ui/")
+	})
+}
@@ -0,0 +1,181 @@
+"use strict";
+
+// The dashboard only reads data the caller's credentials already allow:
+// target inventory and trends come from GraphQL, details and scan failures
+// from the REST API.
+
+const tokenKey = "weeklysec.token";
+
+function headers(extra) {
+  const h = Object.assign({}, extra);
+  const token = localStorage.getItem(tokenKey);
+  if (token) h["Authorization"] = "Bearer " + token;
+  return h;
+}
+
+async function graphql(query, variables) {
+  const res = await fetch("/graphql", {
+    method: "POST",
+    headers: headers({ "Content-Type": "application/json" }),
+    body: JSON.stringify({ query, variables }),
+  });
+  const body = await res.json();
+  if (!res.ok || body.errors) {
+    throw new Error(body.error ? body.error.message : body.errors[0].message);
+  }
+  return body.data;
+}
+
+async function getScan(id, fields, accept) {
+  const url = "/api/v1/scans/" + encodeURIComponent(id) + (fields ? "?fields=" + fields : "");
+  const res = await fetch(url, { headers: headers({ Accept: accept || "application/json" }) });
+  if (!res.ok) throw new Error("failed to load scan " + id);
+  return accept && accept !== "application/json" ? res.text() : res.json();
+}
+
+function el(tag, text, className) {
+  const e = document.createElement(tag);
+  if (text !== undefined && text !== null) e.textContent = text;
+  if (className) e.className = className;
+  return e;
+}
+
+function download(name, type, content) {
+  const a = document.createElement("a");
+  a.href = URL.createObjectURL(new Blob([content], { type }));
+  a.download = name;
+  a.click();
+  URL.revokeObjectURL(a.href);
+}
+
+async function loadInventory() {
+  const status = document.getElementById("inventory-status");
+  const tbody = document.getElementById("targets");
+  tbody.replaceChildren();
+  try {
+    const data = await graphql(`{
+      scans(latestOnly: true) {
+        id target targetType createdAt riskScore
+        severityCounts { critical high medium low }
+      }
+    }`);
+    const scans = (data.scans || []).sort((a, b) => (b.riskScore || 0) - (a.riskScore || 0));
+    status.textContent = scans.length ? "" : "No scans yet.";
+    for (const s of scans) {
+      const tr = el("tr", null, "clickable");
+      const c = s.severityCounts;
+      for (const v of [s.target, s.targetType, new Date(s.createdAt).toLocaleString(),
+        s.riskScore == null ? "-" : s.riskScore.toFixed(1), c.critical, c.high, c.medium, c.low]) {
+        tr.appendChild(el("td", v));
+      }
+      tr.addEventListener("click", () => {
+        for (const row of tbody.children) row.classList.remove("selected");
+        tr.classList.add("selected");
+        showDetail(s);
+      });
+      tbody.appendChild(tr);
+    }
+  } catch (err) {
+    status.textContent = err.message;
+  }
+}
+
+async function loadFailures() {
+  const section = document.getElementById("failures");
+  const tbody = document.getElementById("failure-classes");
+  tbody.replaceChildren();
+  try {
+    const res = await fetch("/api/v1/targets/failures", { headers: headers({ Accept: "application/json" }) });
+    if (!res.ok) throw new Error("failed to load scan failures");
+    const s = await res.json();
+    section.hidden = !s.by_class.length;
+    document.getElementById("failures-status").textContent =
+      s.failing + " of " + s.checked + " registered targets failed their last scan.";
+    for (const c of s.by_class) {
+      const tr = el("tr");
+      for (const v of [c.class.replaceAll("_", " "), c.transient ? "yes" : "no", c.failing, c.targets, c.failures, c.last_error]) {
+        tr.appendChild(el("td", v));
+      }
+      tbody.appendChild(tr);
+    }
+  } catch (err) {
+    section.hidden = true;
+  }
+}
+
+function drawTrend(points) {
+  const svg = document.getElementById("trend");
+  svg.replaceChildren();
+  if (points.length === 0) return;
+
+  const w = 600, h = 160, pad = 10;
+  const ns = "http://www.w3.org/2000/svg";
+  const x = (i) => points.length === 1 ? w / 2 : pad + (i * (w - 2 * pad)) / (points.length - 1);
+  const y = (v) => h - pad - ((v || 0) * (h - 2 * pad)) / 100;
+
+  const line = document.createElementNS(ns, "polyline");
+  line.setAttribute("points", points.map((p, i) => x(i) + "," + y(p.riskScore)).join(" "));
+  svg.appendChild(line);
+  points.forEach((p, i) => {
+    const dot = document.createElementNS(ns, "circle");
+    dot.setAttribute("cx", x(i));
+    dot.setAttribute("cy", y(p.riskScore));
+    dot.setAttribute("r", 3);
+    const title = document.createElementNS(ns, "title");
+    title.textContent = new Date(p.createdAt).toLocaleString() + ": " + (p.riskScore || 0).toFixed(1);
+    dot.appendChild(title);
+    svg.appendChild(dot);
+  });
+}
+
+async function showDetail(scan) {
+  document.getElementById("detail").hidden = false;
+  document.getElementById("detail-title").textContent = scan.target;
+
+  const [history, resp] = await Promise.all([
+    graphql(`query($target: String) { scans(target: $target, limit: 30) { createdAt riskScore } }`, { target: scan.target }),
+    getScan(scan.id, "summary,prioritized,remediation"),
+  ]);
+  drawTrend((history.scans || []).slice().reverse());
+
+  document.getElementById("summary").textContent = resp.summary || "No summary.";
+
+  const findings = document.getElementById("findings");
+  findings.replaceChildren();
+  for (const f of resp.prioritized || []) {
+    const tr = el("tr");
+    for (const v of [f.priority, f.vulnerability_id, f.pkg_name, f.installed_version, f.fixed_version || "-"]) {
+      tr.appendChild(el("td", v));
+    }
+    tr.appendChild(el("td", f.severity, "sev sev-" + f.severity));
+    tr.appendChild(el("td", f.reason));
+    findings.appendChild(tr);
+  }
+
+  const remediation = resp.remediation || { fixes: [] };
+  const fixes = document.getElementById("fixes");
+  fixes.replaceChildren();
+  for (const fix of remediation.fixes || []) {
+    fixes.appendChild(el("li", fix.description));
+  }
+  document.getElementById("pr").textContent =
+    remediation.pr_title ? remediation.pr_title + "\n\n" + (remediation.pr_description || "") : "";
+
+  document.getElementById("download-json").onclick = () =>
+    download(scan.id + "-remediation.json", "application/json", JSON.stringify(remediation, null, 2));
+  document.getElementById("download-md").onclick = async () =>
+    download(scan.id + ".md", "text/markdown", await getScan(scan.id, "", "text/markdown"));
+}
+
+document.getElementById("token").value = localStorage.getItem(tokenKey) || "";
+document.getElementById("auth").addEventListener("submit", (e) => {
+  e.preventDefault();
+  const token = document.getElementById("token").value.trim();
+  if (token) localStorage.setItem(tokenKey, token);
+  else localStorage.removeItem(tokenKey);
+  loadInventory();
+  loadFailures();
+});
+
+loadInventory();
+loadFailures();
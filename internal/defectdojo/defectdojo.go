@@ -0,0 +1,140 @@
+// Package defectdojo pushes scan findings into DefectDojo through its
+// reimport API, so each target keeps one test whose findings DefectDojo
+// deduplicates and closes as they are fixed.
+package defectdojo
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"weeklysec/internal/errcode"
+)
+
+// ScanType is the DefectDojo parser the reports are fed to.
+const ScanType = "Trivy Scan"
+
+// Client calls one DefectDojo instance with an API v2 key.
+type Client struct {
+	baseURL string
+	token   string
+	http    *http.Client
+}
+
+// New returns a client for the DefectDojo instance at baseURL.
+func New(baseURL, token string) *Client {
+	return &Client{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		token:   token,
+		http:    &http.Client{Timeout: 2 * time.Minute},
+	}
+}
+
+// Context names where a report lands. Missing product, engagement and test
+// are created.
+type Context struct {
+	ProductType string `json:"product_type"`
+	Product     string `json:"product"`
+	Engagement  string `json:"engagement"`
+	Test        string `json:"test"`
+}
+
+// Options tune the import.
+type Options struct {
+	MinimumSeverity  string // Info, Low, Medium, High or Critical; all findings when empty
+	CloseOldFindings bool   // close findings of the test missing from the report
+}
+
+// Result locates the imported test.
+type Result struct {
+	Context
+	ProductID    int    `json:"product_id"`
+	EngagementID int    `json:"engagement_id"`
+	TestID       int    `json:"test_id"`
+	URL          string `json:"url"`
+}
+
+// Reimport uploads a Trivy JSON report into the test named by dc.
+func (c *Client) Reimport(ctx context.Context, dc Context, report []byte, opts Options) (Result, error) {
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	fields := [][2]string{
+		{"scan_type", ScanType},
+		{"product_type_name", dc.ProductType},
+		{"product_name", dc.Product},
+		{"engagement_name", dc.Engagement},
+		{"test_title", dc.Test},
+		{"auto_create_context", "true"},
+		{"active", "true"},
+		{"verified", "false"},
+		{"close_old_findings", strconv.FormatBool(opts.CloseOldFindings)},
+	}
+	if opts.MinimumSeverity != "" {
+		fields = append(fields, [2]string{"minimum_severity", opts.MinimumSeverity})
+	}
+	for _, f := range fields {
+		if err := w.WriteField(f[0], f[1]); err != nil {
+			return Result{}, err
+		}
+	}
+	fw, err := w.CreateFormFile("file", "trivy.json")
+	if err != nil {
+		return Result{}, err
+	}
+	if _, err := fw.Write(report); err != nil {
+		return Result{}, err
+	}
+	if err := w.Close(); err != nil {
+		return Result{}, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+"/api/v2/reimport-scan/", &body)
+	if err != nil {
+		return Result{}, err
+	}
+	req.Header.Set("Content-Type", w.FormDataContentType())
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Authorization", "Token "+c.token)
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return Result{}, errcode.Wrap(errcode.DefectDojoError, fmt.Errorf("defectdojo: %w", err))
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if resp.StatusCode >= 300 {
+		msg := strings.TrimSpace(string(data))
+		if len(msg) > 500 {
+			msg = msg[:500]
+		}
+		if msg == "" {
+			msg = resp.Status
+		}
+		return Result{}, errcode.Wrap(errcode.DefectDojoError, fmt.Errorf("defectdojo: reimport failed: %s", msg))
+	}
+
+	// Older releases only return "test"; newer ones add "test_id".
+	var out struct {
+		Test         int `json:"test"`
+		TestID       int `json:"test_id"`
+		EngagementID int `json:"engagement_id"`
+		ProductID    int `json:"product_id"`
+	}
+	if err := json.Unmarshal(data, &out); err != nil {
+		return Result{}, errcode.Wrap(errcode.DefectDojoError, fmt.Errorf("defectdojo: invalid response: %w", err))
+	}
+	r := Result{Context: dc, ProductID: out.ProductID, EngagementID: out.EngagementID, TestID: out.TestID}
+	if r.TestID == 0 {
+		r.TestID = out.Test
+	}
+	if r.TestID != 0 {
+		r.URL = c.baseURL + "/test/" + strconv.Itoa(r.TestID)
+	}
+	return r, nil
+}
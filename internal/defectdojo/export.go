@@ -0,0 +1,84 @@
+package defectdojo
+
+import (
+	"context"
+	"encoding/json"
+	"weeklysec/internal/digest"
+	"weeklysec/internal/store"
+	"weeklysec/internal/trivy"
+)
+
+// Target labels overriding the product and engagement of a target.
+const (
+	ProductLabel    = "defectdojo-product"
+	EngagementLabel = "defectdojo-engagement"
+)
+
+// Exporter maps scans to DefectDojo tests and uploads their open findings.
+type Exporter struct {
+	client      *Client
+	productType string
+	engagement  string
+	opts        Options
+}
+
+// NewExporter returns an exporter filing products under productType and
+// tests under engagement unless a target says otherwise.
+func NewExporter(client *Client, productType, engagement string, opts Options) *Exporter {
+	return &Exporter{client: client, productType: productType, engagement: engagement, opts: opts}
+}
+
+// ContextFor returns where scan's findings go. The product is the scan's
+// org/project and the test is named after the target; an inventory target
+// can override the product and engagement through labels, and its
+// environment names the engagement otherwise.
+func (e *Exporter) ContextFor(scan *store.Scan, target *store.Target) Context {
+	dc := Context{
+		ProductType: e.productType,
+		Product:     scan.Org + "/" + scan.Project,
+		Engagement:  e.engagement,
+		Test:        scan.TargetType + ": " + scan.Target,
+	}
+	if target == nil {
+		return dc
+	}
+	if target.Name != "" {
+		dc.Test = target.Name
+	}
+	if target.Environment != "" {
+		dc.Engagement = target.Environment
+	}
+	if v := target.Labels[ProductLabel]; v != "" {
+		dc.Product = v
+	}
+	if v := target.Labels[EngagementLabel]; v != "" {
+		dc.Engagement = v
+	}
+	return dc
+}
+
+// Export uploads scan's open findings, leaving out accepted risks, to the
+// test of its target.
+func (e *Exporter) Export(ctx context.Context, scan *store.Scan, target *store.Target) (Result, error) {
+	report, err := Report(scan)
+	if err != nil {
+		return Result{}, err
+	}
+	return e.client.Reimport(ctx, e.ContextFor(scan, target), report, e.opts)
+}
+
+// Report renders scan's open findings as a Trivy JSON report.
+func Report(scan *store.Scan) ([]byte, error) {
+	vulns := digest.Open(scan)
+	if vulns == nil {
+		vulns = []trivy.Vulnerability{}
+	}
+	return json.Marshal(map[string]any{
+		"SchemaVersion": 2,
+		"ArtifactName":  scan.Target,
+		"Results": []map[string]any{{
+			"Target":          scan.Target,
+			"Vulnerabilities": vulns,
+		}},
+	})
+}
@@ -0,0 +1,87 @@
+// Package deptrack uploads CycloneDX SBOMs to OWASP Dependency-Track.
+package deptrack
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+	"weeklysec/internal/errcode"
+)
+
+// Client calls one Dependency-Track API server with an API key holding the
+// BOM_UPLOAD and PROJECT_CREATION_UPLOAD permissions.
+type Client struct {
+	baseURL string
+	apiKey  string
+	http    *http.Client
+}
+
+// New returns a client for the API server at baseURL.
+func New(baseURL, apiKey string) *Client {
+	return &Client{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		apiKey:  apiKey,
+		http:    &http.Client{Timeout: time.Minute},
+	}
+}
+
+// Upload is one BOM for a project version, created if missing. With a
+// parent, the project is nested under it; the parent must already exist.
+type Upload struct {
+	ProjectName    string
+	ProjectVersion string
+	ParentName     string
+	BOM            []byte
+}
+
+// UploadBOM submits the BOM and returns the token of the processing task.
+func (c *Client) UploadBOM(ctx context.Context, u Upload) (string, error) {
+	body := map[string]any{
+		"projectName":    u.ProjectName,
+		"projectVersion": u.ProjectVersion,
+		"autoCreate":     true,
+		"bom":            base64.StdEncoding.EncodeToString(u.BOM),
+	}
+	if u.ParentName != "" {
+		body["parentName"] = u.ParentName
+	}
+	b, err := json.Marshal(body)
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, c.baseURL+"/api/v1/bom", bytes.NewReader(b))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("X-Api-Key", c.apiKey)
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return "", errcode.Wrap(errcode.DependencyTrackError, fmt.Errorf("dependency-track: %w", err))
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<16))
+	if resp.StatusCode >= 300 {
+		msg := strings.TrimSpace(string(data))
+		if msg == "" {
+			msg = resp.Status
+		}
+		return "", errcode.Wrap(errcode.DependencyTrackError, fmt.Errorf("dependency-track: BOM upload failed: %s", msg))
+	}
+
+	var out struct {
+		Token string `json:"token"`
+	}
+	if err := json.Unmarshal(data, &out); err != nil {
+		return "", errcode.Wrap(errcode.DependencyTrackError, fmt.Errorf("dependency-track: invalid response: %w", err))
+	}
+	return out.Token, nil
+}
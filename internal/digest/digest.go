@@ -0,0 +1,388 @@
+// Package digest rolls a period's scans up into a fleet-wide report.
+package digest
+
+import (
+	"cmp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"weeklysec/internal/mttr"
+	"weeklysec/internal/store"
+	"weeklysec/internal/trivy"
+)
+
+// TopIssues bounds Digest.TopIssues.
+const TopIssues = 10
+
+// Unassigned is the team reported for targets without one.
+const Unassigned = store.Unassigned
+
+// SLA is the maximum time a finding of each severity may stay open.
+// Severities without an entry have no SLA.
+type SLA map[string]time.Duration
+
+// Digest summarizes the latest state of every target scanned in a period.
+type Digest struct {
+	Org         string    `json:"org"`
+	Project     string    `json:"project"`
+	PeriodStart time.Time `json:"period_start"`
+	PeriodEnd   time.Time `json:"period_end"`
+
+	Scans          int            `json:"scans"`
+	TargetsScanned int            `json:"targets_scanned"`
+	TargetsMissed  int            `json:"targets_missed"` // registered but not scanned in the period
+	FleetRiskScore float64        `json:"fleet_risk_score"`
+	BySeverity     map[string]int `json:"by_severity"`
+
+	TopIssues    []Issue    `json:"top_issues"`
+	FixLeverage  []Leverage `json:"fix_leverage"` // the single actions fixing the most
+	NewCriticals []Finding  `json:"new_criticals"`
+	SLABreaches  []Breach   `json:"sla_breaches"`
+	Teams        []Team     `json:"teams"`
+}
+
+// Issue is a vulnerability and the targets it currently affects.
+type Issue struct {
+	VulnerabilityID string   `json:"vulnerability_id"`
+	Severity        string   `json:"severity"`
+	CVSSScore       float64  `json:"cvss_score,omitempty"`
+	Title           string   `json:"title,omitempty"`
+	Fixable         bool     `json:"fixable"`
+	Targets         []string `json:"targets"`
+}
+
+// Finding is one vulnerability on one target.
+type Finding struct {
+	Target          string    `json:"target"`
+	Team            string    `json:"team"`
+	VulnerabilityID string    `json:"vulnerability_id"`
+	PkgName         string    `json:"pkg_name"`
+	Severity        string    `json:"severity"`
+	FirstSeen       time.Time `json:"first_seen"`
+}
+
+// Breach is a finding that has been open longer than its severity's SLA.
+type Breach struct {
+	Finding
+	SLA     string `json:"sla"`
+	OpenFor string `json:"open_for"`
+}
+
+// Team trends, comparing a team's risk score with the previous period's.
+const (
+	TrendImproving = "improving"
+	TrendWorsening = "worsening"
+	TrendSteady    = "steady"
+	TrendNew       = "new" // no targets scanned before the period
+)
+
+// Team is the scorecard of the targets owned by one team.
+type Team struct {
+	Team          string         `json:"team"`
+	Targets       int            `json:"targets"`
+	RiskScore     float64        `json:"risk_score"` // mean of the targets' scores
+	BySeverity    map[string]int `json:"by_severity"`
+	OpenCriticals int            `json:"open_criticals"`
+	SLABreaches   int            `json:"sla_breaches"`
+	SLACompliance float64        `json:"sla_compliance"` // percent of open findings with an SLA still within it
+	Fixed         int            `json:"fixed"`          // findings fixed in the period
+	MTTRDays      float64        `json:"mttr_days"`      // mean days to fix them
+	RiskChange    float64        `json:"risk_change"`    // since the end of the previous period
+	Trend         string         `json:"trend"`
+
+	slaTracked   int
+	previousRisk float64
+	previous     int
+}
+
+// steadyRisk is the largest change in risk score reported as steady.
+const steadyRisk = 1.0
+
+// targetState is the history of one target, oldest scan first.
+type targetState struct {
+	name  string
+	team  string
+	scans []*store.Scan
+}
+
+// Build computes the digest of the period ending at end. scans should hold
+// the tenant's whole history so first-seen dates predate the period;
+// targets is the tenant's inventory and findings their tracked findings,
+// whose fixes give the teams' time to remediate.
+func Build(org, project string, scans []*store.Scan, targets []store.Target, findings []store.Finding, end time.Time, period time.Duration, sla SLA) *Digest {
+	start := end.Add(-period)
+	d := &Digest{
+		Org:          org,
+		Project:      project,
+		PeriodStart:  start,
+		PeriodEnd:    end,
+		BySeverity:   emptyCounts(),
+		TopIssues:    []Issue{},
+		NewCriticals: []Finding{},
+		SLABreaches:  []Breach{},
+		Teams:        []Team{},
+	}
+
+	teams := make(map[string]string, len(targets))
+	for _, t := range targets {
+		teams[t.ID] = t.Team
+	}
+
+	states := map[string]*targetState{}
+	for _, s := range scans {
+		if s.CreatedAt.After(end) {
+			continue
+		}
+		key := s.TargetKey()
+		st, ok := states[key]
+		if !ok {
+			st = &targetState{name: s.Target, team: cmp.Or(teams[s.TargetID], Unassigned)}
+			states[key] = st
+		}
+		st.scans = append(st.scans, s)
+		if !s.CreatedAt.Before(start) {
+			d.Scans++
+		}
+	}
+
+	issues := map[string]*Issue{}
+	actions := leverage{}
+	teamStats := map[string]*Team{}
+	var riskTotal float64
+	scanned := map[string]bool{}
+
+	for _, st := range states {
+		sort.Slice(st.scans, func(i, j int) bool { return st.scans[i].CreatedAt.Before(st.scans[j].CreatedAt) })
+		latest := st.scans[len(st.scans)-1]
+		if latest.CreatedAt.Before(start) {
+			continue
+		}
+		d.TargetsScanned++
+		scanned[latest.TargetID] = true
+
+		firstSeen := FirstSeen(st.scans)
+		risk := RiskScore(latest)
+		riskTotal += risk
+
+		ts, ok := teamStats[st.team]
+		if !ok {
+			ts = &Team{Team: st.team, BySeverity: emptyCounts()}
+			teamStats[st.team] = ts
+		}
+		ts.Targets++
+		ts.RiskScore += risk
+		if prev := latestBefore(st.scans, start); prev != nil {
+			ts.previousRisk += RiskScore(prev)
+			ts.previous++
+		}
+
+		open := Open(latest)
+		actions.add(st.name, latest, open)
+		for _, v := range open {
+			sev := strings.ToUpper(v.Severity)
+			d.BySeverity[sev]++
+			ts.BySeverity[sev]++
+
+			iss, ok := issues[v.VulnerabilityID]
+			if !ok {
+				iss = &Issue{VulnerabilityID: v.VulnerabilityID, Severity: sev, Title: v.Title}
+				issues[v.VulnerabilityID] = iss
+			}
+			iss.CVSSScore = max(iss.CVSSScore, v.Score())
+			iss.Fixable = iss.Fixable || v.FixedVersion != ""
+			if !slices.Contains(iss.Targets, st.name) {
+				iss.Targets = append(iss.Targets, st.name)
+			}
+
+			f := Finding{
+				Target:          st.name,
+				Team:            st.team,
+				VulnerabilityID: v.VulnerabilityID,
+				PkgName:         v.PkgName,
+				Severity:        sev,
+				FirstSeen:       firstSeen[FindingKey(v)],
+			}
+			if sev == "CRITICAL" && !f.FirstSeen.Before(start) {
+				d.NewCriticals = append(d.NewCriticals, f)
+			}
+			limit, ok := sla[sev]
+			if ok {
+				ts.slaTracked++
+			}
+			if ok && end.Sub(f.FirstSeen) > limit {
+				d.SLABreaches = append(d.SLABreaches, Breach{
+					Finding: f,
+					SLA:     formatDays(limit),
+					OpenFor: formatDays(end.Sub(f.FirstSeen)),
+				})
+				ts.SLABreaches++
+			}
+		}
+	}
+
+	if d.TargetsScanned > 0 {
+		d.FleetRiskScore = round1(riskTotal / float64(d.TargetsScanned))
+	}
+	for _, t := range targets {
+		if !scanned[t.ID] {
+			d.TargetsMissed++
+		}
+	}
+
+	for _, iss := range issues {
+		sort.Strings(iss.Targets)
+		d.TopIssues = append(d.TopIssues, *iss)
+	}
+	sort.Slice(d.TopIssues, func(i, j int) bool {
+		a, b := d.TopIssues[i], d.TopIssues[j]
+		if ra, rb := trivy.SeverityRank(a.Severity), trivy.SeverityRank(b.Severity); ra != rb {
+			return ra < rb
+		}
+		if len(a.Targets) != len(b.Targets) {
+			return len(a.Targets) > len(b.Targets)
+		}
+		if a.CVSSScore != b.CVSSScore {
+			return a.CVSSScore > b.CVSSScore
+		}
+		return a.VulnerabilityID < b.VulnerabilityID
+	})
+	if len(d.TopIssues) > TopIssues {
+		d.TopIssues = d.TopIssues[:TopIssues]
+	}
+	d.FixLeverage = actions.ranked()
+
+	sort.Slice(d.NewCriticals, func(i, j int) bool {
+		a, b := d.NewCriticals[i], d.NewCriticals[j]
+		if !a.FirstSeen.Equal(b.FirstSeen) {
+			return a.FirstSeen.After(b.FirstSeen)
+		}
+		return a.Target+a.VulnerabilityID < b.Target+b.VulnerabilityID
+	})
+	sort.Slice(d.SLABreaches, func(i, j int) bool {
+		a, b := d.SLABreaches[i], d.SLABreaches[j]
+		if ra, rb := trivy.SeverityRank(a.Severity), trivy.SeverityRank(b.Severity); ra != rb {
+			return ra < rb
+		}
+		return a.FirstSeen.Before(b.FirstSeen)
+	})
+
+	for team, s := range mttr.Compute(findings, teams, start, end).ByTeam {
+		if ts := teamStats[team]; ts != nil {
+			ts.Fixed, ts.MTTRDays = s.Fixed, s.MeanDays
+		}
+	}
+
+	for _, ts := range teamStats {
+		ts.RiskScore = round1(ts.RiskScore / float64(ts.Targets))
+		ts.OpenCriticals = ts.BySeverity["CRITICAL"]
+		ts.SLACompliance = 100
+		if ts.slaTracked > 0 {
+			ts.SLACompliance = round1(100 * float64(ts.slaTracked-ts.SLABreaches) / float64(ts.slaTracked))
+		}
+		ts.Trend = TrendNew
+		if ts.previous > 0 {
+			ts.RiskChange = round1(ts.RiskScore - ts.previousRisk/float64(ts.previous))
+			switch {
+			case ts.RiskChange > steadyRisk:
+				ts.Trend = TrendWorsening
+			case ts.RiskChange < -steadyRisk:
+				ts.Trend = TrendImproving
+			default:
+				ts.Trend = TrendSteady
+			}
+		}
+		d.Teams = append(d.Teams, *ts)
+	}
+	sort.Slice(d.Teams, func(i, j int) bool {
+		if d.Teams[i].RiskScore != d.Teams[j].RiskScore {
+			return d.Teams[i].RiskScore > d.Teams[j].RiskScore
+		}
+		return d.Teams[i].Team < d.Teams[j].Team
+	})
+
+	return d
+}
+
+// latestBefore returns the last of scans, oldest first, taken before t.
+func latestBefore(scans []*store.Scan, t time.Time) *store.Scan {
+	var out *store.Scan
+	for _, s := range scans {
+		if !s.CreatedAt.Before(t) {
+			break
+		}
+		out = s
+	}
+	return out
+}
+
+// FindingKey identifies a finding within one target.
+func FindingKey(v trivy.Vulnerability) string {
+	return v.VulnerabilityID + "/" + v.PkgName
+}
+
+// FirstSeen maps each finding of a target's scans, oldest first, to the
+// time of the earliest scan that reported it.
+func FirstSeen(scans []*store.Scan) map[string]time.Time {
+	out := map[string]time.Time{}
+	for _, s := range scans {
+		for _, v := range s.Vulnerabilities {
+			if _, ok := out[FindingKey(v)]; !ok {
+				out[FindingKey(v)] = s.CreatedAt
+			}
+		}
+	}
+	return out
+}
+
+// Open returns a scan's findings minus those covered by an accepted-risk
+// suppression, with duplicate CVE/package pairs dropped.
+func Open(s *store.Scan) []trivy.Vulnerability {
+	accepted := map[string]bool{}
+	if s.Response != nil && s.Response.AcceptedRisk != nil {
+		for _, f := range s.Response.AcceptedRisk.Findings {
+			accepted[f.VulnerabilityID+"/"+f.PkgName] = true
+		}
+	}
+
+	seen := map[string]bool{}
+	var out []trivy.Vulnerability
+	for _, v := range s.Vulnerabilities {
+		k := FindingKey(v)
+		if accepted[k] || seen[k] {
+			continue
+		}
+		seen[k] = true
+		out = append(out, v)
+	}
+	return out
+}
+
+// RiskScore returns the scan's analyzed risk score, or 0 if it has none.
+func RiskScore(s *store.Scan) float64 {
+	if s.Response == nil || s.Response.Analysis == nil {
+		return 0
+	}
+	return s.Response.Analysis.RiskScore
+}
+
+func emptyCounts() map[string]int {
+	m := make(map[string]int, len(trivy.Severities))
+	for _, sev := range trivy.Severities {
+		m[sev] = 0
+	}
+	return m
+}
+
+func round1(f float64) float64 {
+	return float64(int(f*10+0.5)) / 10
+}
+
+func formatDays(d time.Duration) string {
+	days := int(d.Hours() / 24)
+	if days == 1 {
+		return "1 day"
+	}
+	return strconv.Itoa(days) + " days"
+}
@@ -0,0 +1,133 @@
+package digest
+
+import (
+	"slices"
+	"sort"
+	"strings"
+	"weeklysec/internal/agent"
+	"weeklysec/internal/impact"
+	"weeklysec/internal/store"
+	"weeklysec/internal/trivy"
+)
+
+// TopLeverage bounds Digest.FixLeverage.
+const TopLeverage = 10
+
+// Kinds of action in Digest.FixLeverage.
+const (
+	ActionUpgrade   = "upgrade"    // upgrade a package wherever it is installed
+	ActionBaseImage = "base_image" // rebuild the images FROM a base image on a patched tag
+)
+
+// Leverage is one action and the open findings it would fix across the
+// fleet, so the biggest wins can be taken first.
+type Leverage struct {
+	Action     string         `json:"action"`
+	Subject    string         `json:"subject"`             // the package, or the base image
+	Ecosystem  string         `json:"ecosystem,omitempty"` // of the package, from its PURL, e.g. npm or deb
+	Version    string         `json:"version,omitempty"`   // the package version fixing every finding
+	Findings   int            `json:"findings"`
+	BySeverity map[string]int `json:"by_severity"`
+	Targets    []string       `json:"targets"`
+	Score      float64        `json:"score"` // the risk score the findings add up to across targets
+}
+
+// leverage accumulates the actions fixing the open findings of the latest
+// scans of the fleet.
+type leverage map[string]*Leverage
+
+// add counts the fixable findings of target's latest scan s. A package a
+// remediation traced to the base image of the target's Dockerfile is fixed
+// by moving to a patched tag of it; any other is upgraded where it is.
+func (lv leverage) add(target string, s *store.Scan, vulns []trivy.Vulnerability) {
+	fromBase := map[string]string{}
+	if s.Response != nil && s.Response.Remediation != nil {
+		for _, fix := range s.Response.Remediation.Fixes {
+			if src := fix.Source; src != nil && src.Kind == agent.SourceBaseImage {
+				fromBase[fix.PkgName] = baseImage(src.Text)
+			}
+		}
+	}
+
+	for _, v := range vulns {
+		fixed := firstVersion(v.FixedVersion)
+		if fixed == "" {
+			continue
+		}
+		a := Leverage{Action: ActionUpgrade, Subject: v.PkgName, Ecosystem: ecosystem(v.PkgIdentifier.PURL)}
+		if image := fromBase[v.PkgName]; image != "" {
+			a = Leverage{Action: ActionBaseImage, Subject: image}
+		}
+		key := a.Action + "|" + a.Ecosystem + "|" + a.Subject
+		l, ok := lv[key]
+		if !ok {
+			l = &a
+			l.BySeverity = emptyCounts()
+			lv[key] = l
+		}
+		if l.Action == ActionUpgrade && impact.Compare(fixed, l.Version) > 0 {
+			l.Version = fixed
+		}
+		sev := trivy.Severities[trivy.SeverityRank(v.Severity)]
+		l.Findings++
+		l.BySeverity[sev]++
+		l.Score += agent.SeverityWeight(sev)
+		if !slices.Contains(l.Targets, target) {
+			l.Targets = append(l.Targets, target)
+		}
+	}
+}
+
+// ranked returns the actions fixing the most, by score and then findings,
+// at most TopLeverage of them.
+func (lv leverage) ranked() []Leverage {
+	out := make([]Leverage, 0, len(lv))
+	for _, l := range lv {
+		sort.Strings(l.Targets)
+		l.Score = round1(l.Score)
+		out = append(out, *l)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		a, b := out[i], out[j]
+		if a.Score != b.Score {
+			return a.Score > b.Score
+		}
+		if a.Findings != b.Findings {
+			return a.Findings > b.Findings
+		}
+		return a.Action+a.Subject < b.Action+b.Subject
+	})
+	if len(out) > TopLeverage {
+		out = out[:TopLeverage]
+	}
+	return out
+}
+
+// baseImage returns the image of a FROM line, without its flags and stage
+// name.
+func baseImage(from string) string {
+	fields := strings.Fields(from)
+	for i, f := range fields {
+		if i > 0 && !strings.HasPrefix(f, "--") {
+			return f
+		}
+	}
+	return from
+}
+
+// ecosystem is the type of a package URL, such as npm in pkg:npm/lodash.
+func ecosystem(purl string) string {
+	rest, ok := strings.CutPrefix(purl, "pkg:")
+	if !ok {
+		return ""
+	}
+	typ, _, _ := strings.Cut(rest, "/")
+	return typ
+}
+
+// firstVersion picks the first entry of Trivy's comma-separated
+// FixedVersion.
+func firstVersion(v string) string {
+	first, _, _ := strings.Cut(v, ",")
+	return strings.TrimSpace(first)
+}
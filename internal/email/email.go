@@ -0,0 +1,245 @@
+// Package email sends multipart messages over SMTP.
+package email
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"sort"
+	"strings"
+	"time"
+)
+
+// TLS modes.
+const (
+	TLSStartTLS = "starttls" // upgrade a plain connection; required
+	TLSImplicit = "tls"      // connect over TLS, usually port 465
+	TLSNone     = "none"     // plain text; for local relays only
+)
+
+// Config locates and authenticates with the SMTP server.
+type Config struct {
+	Host     string
+	Port     int
+	Username string // no authentication when empty
+	Password string
+	From     string
+	TLS      string // TLSStartTLS when empty
+}
+
+// Attachment is a file attached to a message.
+type Attachment struct {
+	Name        string
+	ContentType string
+	Data        []byte
+}
+
+// Message is an email with a plain-text and an HTML alternative.
+type Message struct {
+	To          []string
+	Subject     string
+	Text        string
+	HTML        string
+	Attachments []Attachment
+}
+
+// Mailer sends messages through one SMTP server.
+type Mailer struct {
+	cfg Config
+}
+
+// New returns a mailer for cfg.
+func New(cfg Config) (*Mailer, error) {
+	switch cfg.TLS {
+	case "":
+		cfg.TLS = TLSStartTLS
+	case TLSStartTLS, TLSImplicit, TLSNone:
+	default:
+		return nil, fmt.Errorf("unknown SMTP TLS mode %q", cfg.TLS)
+	}
+	if cfg.Host == "" || cfg.From == "" {
+		return nil, fmt.Errorf("SMTP host and sender are required")
+	}
+	return &Mailer{cfg: cfg}, nil
+}
+
+// Send delivers m to every recipient in one transaction.
+func (m *Mailer) Send(ctx context.Context, msg Message) error {
+	body, err := m.build(msg)
+	if err != nil {
+		return err
+	}
+
+	addr := net.JoinHostPort(m.cfg.Host, fmt.Sprint(m.cfg.Port))
+	dialer := &net.Dialer{Timeout: 30 * time.Second}
+	var conn net.Conn
+	if m.cfg.TLS == TLSImplicit {
+		conn, err = (&tls.Dialer{NetDialer: dialer, Config: &tls.Config{ServerName: m.cfg.Host}}).DialContext(ctx, "tcp", addr)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return fmt.Errorf("smtp: %w", err)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	} else {
+		_ = conn.SetDeadline(time.Now().Add(2 * time.Minute))
+	}
+
+	c, err := smtp.NewClient(conn, m.cfg.Host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("smtp: %w", err)
+	}
+	defer c.Close()
+
+	if m.cfg.TLS == TLSStartTLS {
+		if err := c.StartTLS(&tls.Config{ServerName: m.cfg.Host}); err != nil {
+			return fmt.Errorf("smtp: starttls: %w", err)
+		}
+	}
+	if m.cfg.Username != "" {
+		if err := c.Auth(smtp.PlainAuth("", m.cfg.Username, m.cfg.Password, m.cfg.Host)); err != nil {
+			return fmt.Errorf("smtp: auth: %w", err)
+		}
+	}
+	if err := c.Mail(m.cfg.From); err != nil {
+		return fmt.Errorf("smtp: %w", err)
+	}
+	for _, to := range msg.To {
+		if err := c.Rcpt(to); err != nil {
+			return fmt.Errorf("smtp: recipient %s: %w", to, err)
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return fmt.Errorf("smtp: %w", err)
+	}
+	if _, err := w.Write(body); err != nil {
+		return fmt.Errorf("smtp: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("smtp: %w", err)
+	}
+	return c.Quit()
+}
+
+// build encodes msg as multipart/mixed holding a multipart/alternative body
+// and the attachments.
+func (m *Mailer) build(msg Message) ([]byte, error) {
+	var b bytes.Buffer
+	mixed := multipart.NewWriter(&b)
+
+	fmt.Fprintf(&b, "From: %s\r\n", m.cfg.From)
+	fmt.Fprintf(&b, "To: %s\r\n", strings.Join(msg.To, ", "))
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&b, "Content-Type: multipart/mixed; boundary=%q\r\n\r\n", mixed.Boundary())
+
+	var alt bytes.Buffer
+	altw := multipart.NewWriter(&alt)
+	for _, part := range []struct{ ct, body string }{
+		{"text/plain; charset=utf-8", msg.Text},
+		{"text/html; charset=utf-8", msg.HTML},
+	} {
+		if part.body == "" {
+			continue
+		}
+		w, err := altw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.ct},
+			"Content-Transfer-Encoding": {"base64"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		writeBase64(w, []byte(part.body))
+	}
+	if err := altw.Close(); err != nil {
+		return nil, err
+	}
+	w, err := mixed.CreatePart(textproto.MIMEHeader{
+		"Content-Type": {fmt.Sprintf("multipart/alternative; boundary=%q", altw.Boundary())},
+	})
+	if err != nil {
+		return nil, err
+	}
+	w.Write(alt.Bytes())
+
+	for _, a := range msg.Attachments {
+		w, err := mixed.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {a.ContentType},
+			"Content-Transfer-Encoding": {"base64"},
+			"Content-Disposition":       {mime.FormatMediaType("attachment", map[string]string{"filename": a.Name})},
+		})
+		if err != nil {
+			return nil, err
+		}
+		writeBase64(w, a.Data)
+	}
+	if err := mixed.Close(); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// writeBase64 writes data base64-encoded in 76-character lines.
+func writeBase64(w io.Writer, data []byte) {
+	enc := base64.StdEncoding.EncodeToString(data)
+	for len(enc) > 76 {
+		w.Write([]byte(enc[:76] + "\r\n"))
+		enc = enc[76:]
+	}
+	w.Write([]byte(enc + "\r\n"))
+}
+
+// Routes maps digest scopes to recipients. A scope is "*" (every org), an
+// org, "org/project", or "team:<name>".
+type Routes map[string][]string
+
+// ParseRoutes reads "scope=address" pairs.
+func ParseRoutes(pairs []string) (Routes, error) {
+	routes := Routes{}
+	for _, pair := range pairs {
+		scope, addr, ok := strings.Cut(pair, "=")
+		scope, addr = strings.TrimSpace(scope), strings.TrimSpace(addr)
+		if !ok || scope == "" || !strings.Contains(addr, "@") {
+			return nil, fmt.Errorf("%q is not scope=address", pair)
+		}
+		routes[scope] = append(routes[scope], addr)
+	}
+	return routes, nil
+}
+
+// Teams lists the teams with recipients.
+func (r Routes) Teams() []string {
+	var teams []string
+	for scope := range r {
+		if team, ok := strings.CutPrefix(scope, "team:"); ok {
+			teams = append(teams, team)
+		}
+	}
+	sort.Strings(teams)
+	return teams
+}
+
+// Projects lists the projects of org with recipients.
+func (r Routes) Projects(org string) []string {
+	var projects []string
+	for scope := range r {
+		if project, ok := strings.CutPrefix(scope, org+"/"); ok {
+			projects = append(projects, project)
+		}
+	}
+	sort.Strings(projects)
+	return projects
+}
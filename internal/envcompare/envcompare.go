@@ -0,0 +1,246 @@
+// Package envcompare compares the latest scans of the same application
+// deployed to two environments or clusters, such as the staging and prod
+// tags of an image, to show which findings a promotion would fix and which
+// it would bring along.
+package envcompare
+
+import (
+	"sort"
+	"strings"
+	"time"
+	"weeklysec/internal/digest"
+	"weeklysec/internal/store"
+	"weeklysec/internal/trivy"
+)
+
+// Options says how targets are grouped and compared.
+type Options struct {
+	// By names what tells the two sides apart: "environment", or
+	// "label:<key>" for a label such as the cluster.
+	By string `json:"by"`
+
+	From string `json:"from"` // the side a promotion starts from, e.g. staging
+	To   string `json:"to"`   // the side it goes to, e.g. prod
+
+	// ServiceLabel groups targets into applications; targets without it
+	// are grouped by name, then by image repository.
+	ServiceLabel string `json:"-"`
+}
+
+// Side returns the value of t that Options.By compares.
+func (o Options) Side(t store.Target) string {
+	if key, ok := strings.CutPrefix(o.By, "label:"); ok {
+		return t.Labels[key]
+	}
+	return t.Environment
+}
+
+// Application returns the application t belongs to.
+func (o Options) Application(t store.Target) string {
+	if name := t.Labels[o.ServiceLabel]; name != "" {
+		return name
+	}
+	if t.Name != "" {
+		return t.Name
+	}
+	if t.TargetType == "image" {
+		return Repository(t.Target)
+	}
+	return t.Target
+}
+
+// Repository strips the tag and digest from an image reference.
+func Repository(ref string) string {
+	ref, _, _ = strings.Cut(ref, "@")
+	if i := strings.LastIndex(ref, ":"); i > strings.LastIndex(ref, "/") {
+		return ref[:i]
+	}
+	return ref
+}
+
+// Target is a scanned target on one side of a comparison.
+type Target struct {
+	ID        string    `json:"id"`
+	Target    string    `json:"target"`
+	ScanID    string    `json:"scan_id"`
+	ScannedAt time.Time `json:"scanned_at"`
+	RiskScore float64   `json:"risk_score"`
+	Open      int       `json:"open"`
+}
+
+// Finding is an open finding present on one side only.
+type Finding struct {
+	VulnerabilityID  string   `json:"vulnerability_id"`
+	PkgName          string   `json:"pkg_name"`
+	InstalledVersion string   `json:"installed_version"`
+	FixedVersion     string   `json:"fixed_version,omitempty"`
+	Severity         string   `json:"severity"`
+	CVSSScore        float64  `json:"cvss_score,omitempty"`
+	Title            string   `json:"title,omitempty"`
+	Targets          []string `json:"targets"` // the targets of the side it is open in
+}
+
+// Application compares one application across the two sides.
+type Application struct {
+	Application   string    `json:"application"`
+	From          []Target  `json:"from"`
+	To            []Target  `json:"to"`
+	FromRiskScore float64   `json:"from_risk_score"` // highest of the side's targets
+	ToRiskScore   float64   `json:"to_risk_score"`
+	FixedInFrom   []Finding `json:"fixed_in_from"` // open in To, gone from every From target
+	OnlyInFrom    []Finding `json:"only_in_from"`  // open in From, not in To: what a promotion brings along
+	Common        int       `json:"common"`        // open on both sides
+
+	// Promote is set when promoting From would fix findings without
+	// bringing a new critical or high one along.
+	Promote bool `json:"promote"`
+}
+
+// Report is the comparison of every application deployed to both sides.
+type Report struct {
+	Options
+	GeneratedAt  time.Time      `json:"generated_at"`
+	Applications []*Application `json:"applications"`
+	Promotable   int            `json:"promotable"`
+	FixedInFrom  int            `json:"fixed_in_from"`
+	OnlyInFrom   int            `json:"only_in_from"`
+
+	// Unpaired lists the applications scanned on one side only.
+	Unpaired []string `json:"unpaired,omitempty"`
+}
+
+// Build compares the applications of targets, given the latest scan of
+// each keyed by target ID. Targets on neither side or never scanned are
+// left out.
+func Build(opts Options, targets []store.Target, latest map[string]*store.Scan) *Report {
+	type sides struct{ from, to []store.Target }
+	apps := map[string]*sides{}
+	for _, t := range targets {
+		if latest[t.ID] == nil {
+			continue
+		}
+		name := opts.Application(t)
+		if apps[name] == nil {
+			apps[name] = &sides{}
+		}
+		switch opts.Side(t) {
+		case opts.From:
+			apps[name].from = append(apps[name].from, t)
+		case opts.To:
+			apps[name].to = append(apps[name].to, t)
+		}
+	}
+
+	r := &Report{Options: opts, GeneratedAt: time.Now().UTC(), Applications: []*Application{}}
+	for name, s := range apps {
+		switch {
+		case len(s.from) == 0 && len(s.to) == 0:
+			continue
+		case len(s.from) == 0 || len(s.to) == 0:
+			r.Unpaired = append(r.Unpaired, name)
+			continue
+		}
+		a := compare(name, s.from, s.to, latest)
+		r.Applications = append(r.Applications, a)
+		r.FixedInFrom += len(a.FixedInFrom)
+		r.OnlyInFrom += len(a.OnlyInFrom)
+		if a.Promote {
+			r.Promotable++
+		}
+	}
+	sort.Strings(r.Unpaired)
+	sort.Slice(r.Applications, func(i, j int) bool {
+		a, b := r.Applications[i], r.Applications[j]
+		if len(a.FixedInFrom) != len(b.FixedInFrom) {
+			return len(a.FixedInFrom) > len(b.FixedInFrom)
+		}
+		return a.Application < b.Application
+	})
+	return r
+}
+
+func compare(name string, from, to []store.Target, latest map[string]*store.Scan) *Application {
+	a := &Application{Application: name, FixedInFrom: []Finding{}, OnlyInFrom: []Finding{}}
+	fromOpen, fromOrder := open(from, latest, &a.From, &a.FromRiskScore)
+	toOpen, toOrder := open(to, latest, &a.To, &a.ToRiskScore)
+
+	for _, k := range toOrder {
+		if _, ok := fromOpen[k]; ok {
+			a.Common++
+			continue
+		}
+		a.FixedInFrom = append(a.FixedInFrom, *toOpen[k])
+	}
+	for _, k := range fromOrder {
+		if _, ok := toOpen[k]; !ok {
+			a.OnlyInFrom = append(a.OnlyInFrom, *fromOpen[k])
+		}
+	}
+	sortFindings(a.FixedInFrom)
+	sortFindings(a.OnlyInFrom)
+
+	a.Promote = len(a.FixedInFrom) > 0
+	for _, f := range a.OnlyInFrom {
+		if f.Severity == "CRITICAL" || f.Severity == "HIGH" {
+			a.Promote = false
+		}
+	}
+	return a
+}
+
+// open merges the open findings of the latest scans of targets, recording
+// each target and the side's highest risk score.
+func open(targets []store.Target, latest map[string]*store.Scan, out *[]Target, risk *float64) (map[string]*Finding, []string) {
+	findings := map[string]*Finding{}
+	var order []string
+	for _, t := range targets {
+		scan := latest[t.ID]
+		vulns := digest.Open(scan)
+		score := digest.RiskScore(scan)
+		*risk = max(*risk, score)
+		*out = append(*out, Target{
+			ID:        t.ID,
+			Target:    t.Target,
+			ScanID:    scan.ID,
+			ScannedAt: scan.CreatedAt,
+			RiskScore: score,
+			Open:      len(vulns),
+		})
+		for _, v := range vulns {
+			k := digest.FindingKey(v)
+			f := findings[k]
+			if f == nil {
+				f = newFinding(v)
+				findings[k] = f
+				order = append(order, k)
+			}
+			f.Targets = append(f.Targets, t.Target)
+		}
+	}
+	return findings, order
+}
+
+func newFinding(v trivy.Vulnerability) *Finding {
+	return &Finding{
+		VulnerabilityID:  v.VulnerabilityID,
+		PkgName:          v.PkgName,
+		InstalledVersion: v.InstalledVersion,
+		FixedVersion:     v.FixedVersion,
+		Severity:         strings.ToUpper(v.Severity),
+		CVSSScore:        v.Score(),
+		Title:            v.Title,
+	}
+}
+
+// sortFindings orders findings worst first.
+func sortFindings(fs []Finding) {
+	sort.SliceStable(fs, func(i, j int) bool {
+		if fs[i].Severity != fs[j].Severity {
+			return trivy.SeverityRank(fs[i].Severity) < trivy.SeverityRank(fs[j].Severity)
+		}
+		if fs[i].CVSSScore != fs[j].CVSSScore {
+			return fs[i].CVSSScore > fs[j].CVSSScore
+		}
+		return fs[i].VulnerabilityID < fs[j].VulnerabilityID
+	})
+}
@@ -0,0 +1,91 @@
+// Package errcode defines the machine-readable error codes returned by the
+// API and attached to agent step results.
+package errcode
+
+import (
+	"context"
+	"errors"
+)
+
+// Code identifies a class of failure. Clients may branch on it; the set only
+// grows.
+type Code string
+
+const (
+	// Request errors
+	InvalidRequest   Code = "INVALID_REQUEST"
+	RequestTooLarge  Code = "REQUEST_TOO_LARGE"
+	TooManyRequests  Code = "TOO_MANY_REQUESTS"
+	NotAcceptable    Code = "NOT_ACCEPTABLE"
+	Unauthorized     Code = "UNAUTHORIZED"
+	Forbidden        Code = "FORBIDDEN" // authenticated, but not allowed that
+	NotFound         Code = "NOT_FOUND"
+	Conflict         Code = "CONFLICT"
+	TargetNotAllowed Code = "TARGET_NOT_ALLOWED" // outside the configured scan roots or registries
+	QuotaExceeded    Code = "QUOTA_EXCEEDED"     // the tenant's or caller's monthly quota is used up
+
+	// Scanner errors
+	TrivyNotFound        Code = "TRIVY_NOT_FOUND"
+	TargetUnreachable    Code = "TARGET_UNREACHABLE"
+	ScanFailed           Code = "SCAN_FAILED"
+	InvalidReport        Code = "INVALID_REPORT"
+	SignatureCheckFailed Code = "SIGNATURE_CHECK_FAILED"
+	AttestationFailed    Code = "ATTESTATION_FAILED"
+
+	// LLM errors
+	LLMNotConfigured Code = "LLM_NOT_CONFIGURED"
+	LLMRateLimited   Code = "LLM_RATE_LIMITED"
+	LLMInvalidJSON   Code = "LLM_INVALID_JSON"
+	LLMUnavailable   Code = "LLM_UNAVAILABLE"
+	BudgetExceeded   Code = "BUDGET_EXCEEDED"
+
+	// Integration errors
+	GitHubError          Code = "GITHUB_ERROR"
+	JiraError            Code = "JIRA_ERROR"
+	DefectDojoError      Code = "DEFECTDOJO_ERROR"
+	DependencyTrackError Code = "DEPENDENCY_TRACK_ERROR"
+	KubernetesError      Code = "KUBERNETES_ERROR"
+	ServiceNowError      Code = "SERVICENOW_ERROR"
+
+	// Generic errors
+	Timeout  Code = "TIMEOUT"
+	Internal Code = "INTERNAL"
+)
+
+// Error attaches a code to an underlying error.
+type Error struct {
+	Code Code
+	Err  error
+}
+
+func (e *Error) Error() string { return e.Err.Error() }
+func (e *Error) Unwrap() error { return e.Err }
+
+// New returns a coded error with the given message, suitable as a sentinel.
+func New(code Code, msg string) error {
+	return &Error{Code: code, Err: errors.New(msg)}
+}
+
+// Wrap attaches code to err. A nil err stays nil.
+func Wrap(code Code, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &Error{Code: code, Err: err}
+}
+
+// Of returns the code of the outermost coded error in err's chain. Deadline
+// errors map to Timeout; anything else uncoded is Internal.
+func Of(err error) Code {
+	if err == nil {
+		return ""
+	}
+	var coded *Error
+	if errors.As(err, &coded) {
+		return coded.Code
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return Timeout
+	}
+	return Internal
+}
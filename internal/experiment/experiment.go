@@ -0,0 +1,305 @@
+// Package experiment routes a share of agent runs to prompt and model
+// variants of an LLM step, and compares the variants by validity, cost,
+// latency and user feedback so a prompt change can be judged before it is
+// rolled out. Runs not routed to a variant use the configured prompts and
+// model, and are reported as the control.
+package experiment
+
+import (
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"os"
+	"slices"
+	"strings"
+	"text/template"
+	"weeklysec/internal/llm"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Control names the runs that got no variant.
+const Control = "control"
+
+// The LLM steps of an agent run that can be experimented on.
+const (
+	StepRemediation = "remediation"
+	StepSummarize   = "summarize"
+)
+
+// Steps lists the steps an experiment can target.
+var Steps = []string{StepRemediation, StepSummarize}
+
+// Variant is an alternative prompt or model for a step.
+type Variant struct {
+	Name   string `json:"name" yaml:"name"`
+	Weight int    `json:"weight" yaml:"weight"` // percent of the step's runs
+
+	Model    string `json:"model,omitempty" yaml:"model"`       // empty keeps the run's model
+	System   string `json:"system,omitempty" yaml:"system"`     // replaces the step's system prompt
+	Template string `json:"template,omitempty" yaml:"template"` // summarize only: replaces summary.tmpl
+
+	// CostPer1KTokens prices the variant's model, for the estimated cost
+	// in results.
+	CostPer1KTokens float64 `json:"cost_per_1k_tokens,omitempty" yaml:"cost_per_1k_tokens"`
+}
+
+// Experiment splits the runs of one step between variants.
+type Experiment struct {
+	Step     string    `json:"step" yaml:"step"`
+	Variants []Variant `json:"variants" yaml:"variants"`
+}
+
+// Config is the set of experiments as stored and loaded.
+type Config struct {
+	Experiments []Experiment `json:"experiments" yaml:"experiments"`
+}
+
+// Load reads experiments from a YAML or JSON file.
+func Load(path string) (Config, error) {
+	var c Config
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return c, err
+	}
+	if err := yaml.Unmarshal(data, &c); err != nil {
+		return c, fmt.Errorf("%s: %w", path, err)
+	}
+	return c, nil
+}
+
+type variant struct {
+	Variant
+	summary *template.Template
+}
+
+// Set is a validated Config ready to route runs.
+type Set struct {
+	cfg   Config
+	steps map[string][]variant
+}
+
+// Compile validates c.
+func Compile(c Config) (*Set, error) {
+	s := &Set{cfg: c, steps: map[string][]variant{}}
+	for _, e := range c.Experiments {
+		if !slices.Contains(Steps, e.Step) {
+			return nil, fmt.Errorf("experiment step %q must be one of %v", e.Step, Steps)
+		}
+		if _, dup := s.steps[e.Step]; dup {
+			return nil, fmt.Errorf("step %s has more than one experiment", e.Step)
+		}
+		if len(e.Variants) == 0 {
+			return nil, fmt.Errorf("experiment on %s has no variants", e.Step)
+		}
+		total := 0
+		seen := map[string]bool{}
+		var vs []variant
+		for _, v := range e.Variants {
+			switch {
+			case v.Name == "" || v.Name == Control:
+				return nil, fmt.Errorf("%s: variants need a name other than %q", e.Step, Control)
+			case seen[v.Name]:
+				return nil, fmt.Errorf("%s: duplicate variant %q", e.Step, v.Name)
+			case v.Weight <= 0:
+				return nil, fmt.Errorf("%s/%s: weight must be a positive percentage", e.Step, v.Name)
+			case v.Model == "" && v.System == "" && v.Template == "":
+				return nil, fmt.Errorf("%s/%s: set a model, system prompt or template", e.Step, v.Name)
+			case v.Template != "" && e.Step != StepSummarize:
+				return nil, fmt.Errorf("%s/%s: only the %s step has a template", e.Step, v.Name, StepSummarize)
+			case v.CostPer1KTokens < 0:
+				return nil, fmt.Errorf("%s/%s: cost_per_1k_tokens must not be negative", e.Step, v.Name)
+			}
+			seen[v.Name] = true
+			total += v.Weight
+
+			cv := variant{Variant: v}
+			if v.Template != "" {
+				t, err := llm.ParseSummary(v.Template)
+				if err != nil {
+					return nil, fmt.Errorf("%s/%s: template: %w", e.Step, v.Name, err)
+				}
+				cv.summary = t
+			}
+			vs = append(vs, cv)
+		}
+		if total > 100 {
+			return nil, fmt.Errorf("%s: variant weights add up to %d%%, more than 100%%", e.Step, total)
+		}
+		s.steps[e.Step] = vs
+	}
+	return s, nil
+}
+
+// Config returns the experiments as configured; empty for a nil Set.
+func (s *Set) Config() Config {
+	if s == nil {
+		return Config{Experiments: []Experiment{}}
+	}
+	return s.cfg
+}
+
+// Variant returns the configured variant of step named name.
+func (s *Set) Variant(step, name string) (Variant, bool) {
+	if s != nil {
+		for _, v := range s.steps[step] {
+			if v.Name == name {
+				return v.Variant, true
+			}
+		}
+	}
+	return Variant{}, false
+}
+
+// Choice is the variant a run got for a step.
+type Choice struct {
+	Variant string       // Control when the run got none
+	Model   string       // empty keeps the run's model
+	Prompts *llm.Prompts // base with the variant's prompts applied
+}
+
+// Pick routes a run to a variant of step by weight, applying it to the
+// base prompts. A nil Set always picks the control.
+func (s *Set) Pick(step string, base *llm.Prompts) Choice {
+	c := Choice{Variant: Control, Prompts: base}
+	if s == nil {
+		return c
+	}
+	n := rand.IntN(100)
+	for _, v := range s.steps[step] {
+		if n >= v.Weight {
+			n -= v.Weight
+			continue
+		}
+		p := *base
+		switch {
+		case v.System != "" && step == StepSummarize:
+			p.SummarySystem = v.System
+		case v.System != "":
+			p.RemediationSystem = v.System
+		}
+		if v.summary != nil {
+			p.Summary = v.summary
+		}
+		return Choice{Variant: v.Name, Model: v.Model, Prompts: &p}
+	}
+	return c
+}
+
+// Sample is one LLM call made for a step.
+type Sample struct {
+	Step       string
+	Variant    string
+	Valid      bool // the answer was usable
+	DurationMS int64
+	Tokens     int // estimated, prompt and answer
+}
+
+// Rating is user feedback on the output of a step.
+type Rating struct {
+	Step    string
+	Variant string
+	Up      bool
+}
+
+// Result compares one variant, or the control, of a step.
+type Result struct {
+	Step          string  `json:"step"`
+	Variant       string  `json:"variant"`
+	Weight        int     `json:"weight"` // currently configured; 0 for retired variants
+	Calls         int     `json:"calls"`
+	Valid         int     `json:"valid"`
+	ValidityRate  float64 `json:"validity_rate"` // percent
+	MeanLatencyMS int64   `json:"mean_latency_ms"`
+	MeanTokens    int     `json:"mean_tokens"`
+	EstimatedCost float64 `json:"estimated_cost,omitempty"` // from cost_per_1k_tokens
+	Up            int     `json:"feedback_up"`
+	Down          int     `json:"feedback_down"`
+	Approval      float64 `json:"approval"` // percent of ratings that are up
+}
+
+// Results aggregates samples and ratings per step and variant, with the
+// control's weight the share left by the variants of s.
+func Results(s *Set, samples []Sample, ratings []Rating) []Result {
+	type key struct{ step, variant string }
+	type acc struct {
+		Result
+		latency int64
+		tokens  int
+	}
+	by := map[key]*acc{}
+	get := func(step, name string) *acc {
+		k := key{step, name}
+		if by[k] == nil {
+			by[k] = &acc{Result: Result{Step: step, Variant: name}}
+		}
+		return by[k]
+	}
+	if s != nil {
+		for step, vs := range s.steps {
+			get(step, Control)
+			for _, v := range vs {
+				get(step, v.Name)
+			}
+		}
+	}
+	for _, sm := range samples {
+		a := get(sm.Step, sm.Variant)
+		a.Calls++
+		if sm.Valid {
+			a.Valid++
+		}
+		a.latency += sm.DurationMS
+		a.tokens += sm.Tokens
+	}
+	for _, r := range ratings {
+		a := get(r.Step, r.Variant)
+		if r.Up {
+			a.Up++
+		} else {
+			a.Down++
+		}
+	}
+
+	out := make([]Result, 0, len(by))
+	for _, a := range by {
+		r := a.Result
+		if r.Variant == Control {
+			r.Weight = 100
+			if s != nil {
+				for _, v := range s.steps[r.Step] {
+					r.Weight -= v.Weight
+				}
+			}
+		} else if v, ok := s.Variant(r.Step, r.Variant); ok {
+			r.Weight = v.Weight
+			r.EstimatedCost = float64(a.tokens) / 1000 * v.CostPer1KTokens
+		}
+		if r.Calls > 0 {
+			r.ValidityRate = percent(r.Valid, r.Calls)
+			r.MeanLatencyMS = a.latency / int64(r.Calls)
+			r.MeanTokens = a.tokens / r.Calls
+		}
+		if r.Up+r.Down > 0 {
+			r.Approval = percent(r.Up, r.Up+r.Down)
+		}
+		out = append(out, r)
+	}
+	slices.SortFunc(out, func(a, b Result) int {
+		if a.Step != b.Step {
+			return strings.Compare(a.Step, b.Step)
+		}
+		if (a.Variant == Control) != (b.Variant == Control) {
+			if a.Variant == Control {
+				return -1
+			}
+			return 1
+		}
+		return strings.Compare(a.Variant, b.Variant)
+	})
+	return out
+}
+
+func percent(n, of int) float64 {
+	return math.Round(1000*float64(n)/float64(of)) / 10
+}
@@ -0,0 +1,98 @@
+// Package failure sorts scan failures into classes an operator can act on,
+// such as the registry refusing credentials or Trivy failing to download
+// its database, and tells the transient ones worth retrying from those
+// that will fail again until someone fixes them.
+package failure
+
+import (
+	"strings"
+	"weeklysec/internal/errcode"
+)
+
+// Classes of scan failure.
+const (
+	RegistryAuth   = "registry_auth"   // the registry refused the credentials, or there were none
+	RateLimited    = "rate_limited"    // the registry throttled pulls
+	NotFound       = "not_found"       // the image, tag, repository or path does not exist
+	Network        = "network"         // DNS, connection or TLS failures reaching the target
+	DBDownload     = "db_download"     // Trivy could not download its vulnerability database
+	Timeout        = "timeout"         // the scan ran past its deadline
+	OOM            = "oom"             // the scanner ran out of memory or was killed for it
+	ScannerMissing = "scanner_missing" // Trivy is not installed
+	Busy           = "busy"            // turned away by a full scan queue
+	Rejected       = "rejected"        // refused before scanning: allowlist, quota or invalid request
+	Other          = "other"
+)
+
+// Classes lists every class, the transient ones first.
+var Classes = []string{RateLimited, Network, DBDownload, Timeout, Busy, RegistryAuth, NotFound, OOM, ScannerMissing, Rejected, Other}
+
+// transient are the classes a later attempt may well get past.
+var transient = map[string]bool{
+	RateLimited: true,
+	Network:     true,
+	DBDownload:  true,
+	Timeout:     true,
+	Busy:        true,
+}
+
+// markers are lowercase fragments of Trivy's and the registries' messages,
+// checked in order: a database download failing on a connection error is
+// a database problem, and an out-of-memory crash may mention anything.
+var markers = []struct {
+	class     string
+	fragments []string
+}{
+	{OOM, []string{"out of memory", "cannot allocate memory", "oomkilled", "signal: killed"}},
+	{DBDownload, []string{"failed to download vulnerability db", "failed to download trivy db", "db download", "trivy-db", "javadb"}},
+	{RateLimited, []string{"toomanyrequests", "too many requests", "rate limit"}},
+	{RegistryAuth, []string{"unauthorized", "authentication required", "no basic auth credentials", "access denied", "requested access to the resource is denied", "denied:", "403 forbidden"}},
+	{NotFound, []string{"manifest unknown", "name unknown", "not found", "no such file or directory", "could not find"}},
+	{Network, []string{"no such host", "connection refused", "connection reset", "i/o timeout", "tls handshake", "network is unreachable", "unexpected eof"}},
+}
+
+// Classify returns the class of a scan that failed with code and msg.
+func Classify(code errcode.Code, msg string) string {
+	switch code {
+	case "":
+		return ""
+	case errcode.TrivyNotFound:
+		return ScannerMissing
+	case errcode.TargetNotAllowed, errcode.QuotaExceeded, errcode.InvalidRequest:
+		return Rejected
+	case errcode.Timeout:
+		return Timeout
+	case errcode.TooManyRequests:
+		return Busy
+	}
+	lower := strings.ToLower(msg)
+	for _, m := range markers {
+		for _, f := range m.fragments {
+			if strings.Contains(lower, f) {
+				return m.class
+			}
+		}
+	}
+	if strings.Contains(lower, "deadline exceeded") {
+		return Timeout
+	}
+	return Other
+}
+
+// Of returns the class of err, or "" for nil.
+func Of(err error) string {
+	if err == nil {
+		return ""
+	}
+	return Classify(errcode.Of(err), err.Error())
+}
+
+// Transient reports whether failures of class may pass on their own.
+func Transient(class string) bool {
+	return transient[class]
+}
+
+// Retryable reports whether a scan that failed with err is worth retrying.
+func Retryable(err error) bool {
+	return Transient(Of(err))
+}
@@ -0,0 +1,127 @@
+package failure
+
+import (
+	"cmp"
+	"slices"
+	"time"
+	"weeklysec/internal/digest"
+	"weeklysec/internal/errcode"
+	"weeklysec/internal/store"
+)
+
+// Summary is how the scans of a set of targets failed over a window, by
+// class, so a problem hitting many targets at once stands out from a
+// single broken one.
+type Summary struct {
+	Since    time.Time `json:"since"`
+	Until    time.Time `json:"until"`
+	Checked  int       `json:"checked"`  // targets
+	Failing  int       `json:"failing"`  // targets whose last scan attempt failed
+	Failures int       `json:"failures"` // failed attempts in the window
+
+	ByClass []ClassSummary  `json:"by_class"` // the most targets failing now first
+	Targets []FailingTarget `json:"targets"`  // failing now, the longest first
+}
+
+// ClassSummary is the failures of one class.
+type ClassSummary struct {
+	Class     string    `json:"class"`
+	Transient bool      `json:"transient"` // retried automatically
+	Failures  int       `json:"failures"`  // failed attempts in the window
+	Targets   int       `json:"targets"`   // targets with such a failure in the window
+	Failing   int       `json:"failing"`   // targets whose last attempt failed this way
+	LastAt    time.Time `json:"last_at"`
+	LastError string    `json:"last_error"`
+}
+
+// FailingTarget is a target whose last scan attempt failed.
+type FailingTarget struct {
+	ID            string     `json:"id"`
+	Org           string     `json:"org"`
+	Project       string     `json:"project"`
+	Name          string     `json:"name,omitempty"`
+	TargetType    string     `json:"target_type"`
+	Target        string     `json:"target"`
+	Team          string     `json:"team"`
+	Class         string     `json:"class"`
+	Code          string     `json:"code"`
+	Error         string     `json:"error"`
+	Failures      int        `json:"failures"` // consecutive
+	LastAttemptAt time.Time  `json:"last_attempt_at"`
+	LastSuccessAt *time.Time `json:"last_success_at,omitempty"`
+	NextRetryAt   *time.Time `json:"next_retry_at,omitempty"`
+}
+
+// Summarize sums up the failures of targets in [since, until] from their
+// scan statuses, by target ID. Only the class in the filter is kept when
+// it is not empty.
+func Summarize(targets []store.Target, statuses map[string]store.ScanStatus, since, until time.Time, class string) *Summary {
+	s := &Summary{Since: since, Until: until, Checked: len(targets), ByClass: []ClassSummary{}, Targets: []FailingTarget{}}
+	byClass := map[string]*ClassSummary{}
+	get := func(c string) *ClassSummary {
+		cs, ok := byClass[c]
+		if !ok {
+			cs = &ClassSummary{Class: c, Transient: Transient(c)}
+			byClass[c] = cs
+		}
+		return cs
+	}
+
+	for _, t := range targets {
+		st, ok := statuses[t.ID]
+		if !ok {
+			continue
+		}
+		seen := map[string]bool{}
+		for _, f := range st.RecentFailures {
+			c := cmp.Or(f.Class, Other)
+			if f.At.Before(since) || f.At.After(until) || (class != "" && c != class) {
+				continue
+			}
+			cs := get(c)
+			cs.Failures++
+			s.Failures++
+			if !seen[c] {
+				seen[c] = true
+				cs.Targets++
+			}
+			if f.At.After(cs.LastAt) {
+				cs.LastAt, cs.LastError = f.At, f.Error
+			}
+		}
+
+		c := cmp.Or(st.LastClass, Classify(errcode.Code(st.LastErrorCode), st.LastError))
+		if st.Failures == 0 || (class != "" && c != class) {
+			continue
+		}
+		get(c).Failing++
+		s.Failing++
+		s.Targets = append(s.Targets, FailingTarget{
+			ID:            t.ID,
+			Org:           t.Org,
+			Project:       t.Project,
+			Name:          t.Name,
+			TargetType:    t.TargetType,
+			Target:        t.Target,
+			Team:          cmp.Or(t.Team, digest.Unassigned),
+			Class:         c,
+			Code:          st.LastErrorCode,
+			Error:         st.LastError,
+			Failures:      st.Failures,
+			LastAttemptAt: st.LastAttemptAt,
+			LastSuccessAt: st.LastSuccessAt,
+			NextRetryAt:   st.NextRetryAt,
+		})
+	}
+
+	for _, c := range Classes {
+		if cs, ok := byClass[c]; ok {
+			s.ByClass = append(s.ByClass, *cs)
+		}
+	}
+	slices.SortStableFunc(s.ByClass, func(a, b ClassSummary) int {
+		return cmp.Or(cmp.Compare(b.Failing, a.Failing), cmp.Compare(b.Targets, a.Targets), cmp.Compare(b.Failures, a.Failures))
+	})
+	slices.SortStableFunc(s.Targets, func(a, b FailingTarget) int { return cmp.Compare(b.Failures, a.Failures) })
+	return s
+}
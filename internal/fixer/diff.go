@@ -0,0 +1,155 @@
+package fixer
+
+import (
+	"fmt"
+	"strings"
+)
+
+// diffContext is the number of unchanged lines shown around a change.
+const diffContext = 3
+
+// maxDiffCells bounds the table of the line matching; larger files get a
+// diff replacing them whole.
+const maxDiffCells = 4 << 20
+
+// Diff renders the change from before to after of the file p as a unified
+// diff, empty when they are equal.
+func Diff(p string, before, after []byte) string {
+	if string(before) == string(after) {
+		return ""
+	}
+	a, b := lines(string(before)), lines(string(after))
+	ops := diffLines(a, b)
+
+	var out strings.Builder
+	fmt.Fprintf(&out, "--- a/%s\n+++ b/%s\n", p, p)
+	for i := 0; i < len(ops); {
+		// Find the next change and the hunk of changes close to it.
+		for i < len(ops) && ops[i].kind == ' ' {
+			i++
+		}
+		if i == len(ops) {
+			break
+		}
+		start := max(0, i-diffContext)
+		end := i
+		for end < len(ops) {
+			if ops[end].kind != ' ' {
+				end++
+				continue
+			}
+			next := end
+			for next < len(ops) && ops[next].kind == ' ' {
+				next++
+			}
+			if next == len(ops) || next-end > 2*diffContext {
+				end = min(len(ops), end+diffContext)
+				break
+			}
+			end = next
+		}
+
+		oldStart, newStart := ops[start].a+1, ops[start].b+1
+		var oldLen, newLen int
+		var body strings.Builder
+		for _, op := range ops[start:end] {
+			switch op.kind {
+			case ' ':
+				oldLen++
+				newLen++
+				fmt.Fprintf(&body, " %s\n", a[op.a])
+			case '-':
+				oldLen++
+				fmt.Fprintf(&body, "-%s\n", a[op.a])
+			case '+':
+				newLen++
+				fmt.Fprintf(&body, "+%s\n", b[op.b])
+			}
+		}
+		// An empty side starts at the line before it, as in diff -u.
+		if oldLen == 0 {
+			oldStart--
+		}
+		if newLen == 0 {
+			newStart--
+		}
+		fmt.Fprintf(&out, "@@ -%d,%d +%d,%d @@\n%s", oldStart, oldLen, newStart, newLen, body.String())
+		i = end
+	}
+	return out.String()
+}
+
+// lines splits s into lines without their newlines.
+func lines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
+
+// diffOp keeps (' '), removes ('-') or adds ('+') a line; a and b are its
+// index in the old and new file, or where it would be.
+type diffOp struct {
+	kind byte
+	a, b int
+}
+
+// diffLines matches a and b by their longest common subsequence, after
+// trimming the common prefix and suffix that fixes usually leave.
+func diffLines(a, b []string) []diffOp {
+	var ops []diffOp
+	pre := 0
+	for pre < len(a) && pre < len(b) && a[pre] == b[pre] {
+		ops = append(ops, diffOp{' ', pre, pre})
+		pre++
+	}
+	suf := 0
+	for suf < len(a)-pre && suf < len(b)-pre && a[len(a)-1-suf] == b[len(b)-1-suf] {
+		suf++
+	}
+	ma, mb := a[pre:len(a)-suf], b[pre:len(b)-suf]
+
+	if len(ma)*len(mb) > maxDiffCells {
+		for i := range ma {
+			ops = append(ops, diffOp{'-', pre + i, pre})
+		}
+		for j := range mb {
+			ops = append(ops, diffOp{'+', pre + len(ma), pre + j})
+		}
+	} else {
+		// lcs[i][j] is the length of the common subsequence of ma[i:] and mb[j:].
+		lcs := make([][]int, len(ma)+1)
+		for i := range lcs {
+			lcs[i] = make([]int, len(mb)+1)
+		}
+		for i := len(ma) - 1; i >= 0; i-- {
+			for j := len(mb) - 1; j >= 0; j-- {
+				if ma[i] == mb[j] {
+					lcs[i][j] = lcs[i+1][j+1] + 1
+				} else {
+					lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+				}
+			}
+		}
+		i, j := 0, 0
+		for i < len(ma) || j < len(mb) {
+			switch {
+			case i < len(ma) && j < len(mb) && ma[i] == mb[j]:
+				ops = append(ops, diffOp{' ', pre + i, pre + j})
+				i++
+				j++
+			case j == len(mb) || i < len(ma) && lcs[i+1][j] >= lcs[i][j+1]:
+				ops = append(ops, diffOp{'-', pre + i, pre + j})
+				i++
+			default:
+				ops = append(ops, diffOp{'+', pre + i, pre + j})
+				j++
+			}
+		}
+	}
+
+	for k := 0; k < suf; k++ {
+		ops = append(ops, diffOp{' ', len(a) - suf + k, len(b) - suf + k})
+	}
+	return ops
+}
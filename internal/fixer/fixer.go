@@ -0,0 +1,144 @@
+// Package fixer applies remediation fixes to dependency manifests so they
+// can be committed as-is.
+package fixer
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+	"weeklysec/internal/agent"
+)
+
+// Supported reports whether Apply knows how to edit the manifest at p.
+func Supported(p string) bool {
+	return editorFor(p) != nil
+}
+
+// Apply bumps the packages named by fixes in the manifest at p and returns
+// the new content along with the fixes that changed it. Unsupported files
+// and packages the manifest does not pin are left untouched. Each edit is
+// validated in memory: a fix that would leave a manifest that parsed
+// unparseable, such as a reviewed version with a stray quote, is skipped
+// and returned as rejected.
+func Apply(p string, content []byte, fixes []agent.Fix) ([]byte, []agent.Fix, []agent.RejectedFix) {
+	edit := editorFor(p)
+	if edit == nil {
+		return content, nil, nil
+	}
+	out := string(content)
+	valid := Validate(p, content) == nil
+	var applied []agent.Fix
+	var rejected []agent.RejectedFix
+	for _, fix := range fixes {
+		if fix.RecommendedVersion == "" {
+			continue
+		}
+		next, ok := edit(out, fix)
+		if !ok || next == out {
+			continue
+		}
+		if valid {
+			if err := Validate(p, []byte(next)); err != nil {
+				rejected = append(rejected, agent.RejectedFix{
+					Path:               p,
+					PkgName:            fix.PkgName,
+					RecommendedVersion: fix.RecommendedVersion,
+					Reason:             err.Error(),
+				})
+				continue
+			}
+		}
+		out = next
+		applied = append(applied, fix)
+	}
+	return []byte(out), applied, rejected
+}
+
+// Select returns the proposed fixes that were kept after review, in the
+// reviewed order, with the recommended version the reviewer settled on.
+// Reviewed fixes match proposed ones by package and current version; any
+// that match none are an error, so a review cannot add upgrades.
+func Select(proposed, reviewed []agent.Fix) ([]agent.Fix, error) {
+	out := make([]agent.Fix, 0, len(reviewed))
+	for _, r := range reviewed {
+		i := slices.IndexFunc(proposed, func(p agent.Fix) bool {
+			return p.PkgName == r.PkgName && (r.CurrentVersion == "" || p.CurrentVersion == r.CurrentVersion)
+		})
+		if i < 0 {
+			return nil, fmt.Errorf("%s is not among the proposed fixes", r.PkgName)
+		}
+		fix := proposed[i]
+		if v := strings.TrimSpace(r.RecommendedVersion); v != "" && v != fix.RecommendedVersion {
+			fix.RecommendedVersion = v
+			fix.Description = agent.DescribeFix(fix)
+		}
+		out = append(out, fix)
+	}
+	return out, nil
+}
+
+type editor func(content string, fix agent.Fix) (string, bool)
+
+func editorFor(p string) editor {
+	name := strings.ToLower(path.Base(p))
+	switch {
+	case name == "package.json":
+		return editPackageJSON
+	case name == "go.mod":
+		return editGoMod
+	case strings.HasPrefix(name, "requirements") && strings.HasSuffix(name, ".txt"):
+		return editRequirements
+	}
+	return nil
+}
+
+var requirementLine = regexp.MustCompile(`(?m)^(\s*)([A-Za-z0-9][A-Za-z0-9._-]*)(\[[^\]]*\])?(\s*)(==|~=|>=)(\s*)([^\s;#,]+)`)
+
+// editRequirements pins a pip requirement to the recommended version.
+// Package names compare case-insensitively with '_' and '.' equal to '-'.
+func editRequirements(content string, fix agent.Fix) (string, bool) {
+	want := normalizePyName(fix.PkgName)
+	changed := false
+	out := requirementLine.ReplaceAllStringFunc(content, func(line string) string {
+		m := requirementLine.FindStringSubmatch(line)
+		if normalizePyName(m[2]) != want {
+			return line
+		}
+		changed = true
+		return m[1] + m[2] + m[3] + m[4] + "==" + m[6] + fix.RecommendedVersion
+	})
+	return out, changed
+}
+
+func normalizePyName(name string) string {
+	return strings.NewReplacer("_", "-", ".", "-").Replace(strings.ToLower(name))
+}
+
+// editPackageJSON rewrites the version of a dependency entry, keeping any
+// ^ or ~ range prefix.
+func editPackageJSON(content string, fix agent.Fix) (string, bool) {
+	re := regexp.MustCompile(`("` + regexp.QuoteMeta(fix.PkgName) + `"\s*:\s*")([\^~]?)[0-9][^"]*(")`)
+	if !re.MatchString(content) {
+		return content, false
+	}
+	return re.ReplaceAllString(content, "${1}${2}"+escapeReplacement(fix.RecommendedVersion)+"${3}"), true
+}
+
+// editGoMod rewrites a require line of the module.
+func editGoMod(content string, fix agent.Fix) (string, bool) {
+	version := fix.RecommendedVersion
+	if !strings.HasPrefix(version, "v") {
+		version = "v" + version
+	}
+	re := regexp.MustCompile(`(?m)^(\s*(?:require\s+)?` + regexp.QuoteMeta(fix.PkgName) + `\s+)v\S+`)
+	if !re.MatchString(content) {
+		return content, false
+	}
+	return re.ReplaceAllString(content, "${1}"+escapeReplacement(version)), true
+}
+
+func escapeReplacement(s string) string {
+	return strings.ReplaceAll(s, "$", "$$")
+}
@@ -0,0 +1,309 @@
+package fixer
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Validate checks that content parses as the kind of file p names:
+// package.json, go.mod, pip requirements, Dockerfiles, YAML (with the
+// basic shape of Kubernetes resources) and Terraform/HCL. Files of other
+// kinds pass. The Dockerfile and HCL checks are structural, not full
+// parsers: they catch what a bad edit breaks, such as unknown
+// instructions, unbalanced braces or unterminated strings.
+func Validate(p string, content []byte) error {
+	name := strings.ToLower(path.Base(p))
+	switch {
+	case name == "package.json":
+		return validateJSON(content)
+	case name == "go.mod":
+		return validateGoMod(string(content))
+	case strings.HasPrefix(name, "requirements") && strings.HasSuffix(name, ".txt"):
+		return validateRequirements(string(content))
+	case strings.Contains(name, "dockerfile") || strings.Contains(name, "containerfile"):
+		return validateDockerfile(string(content))
+	case strings.HasSuffix(name, ".yaml") || strings.HasSuffix(name, ".yml"):
+		return validateYAML(content)
+	case strings.HasSuffix(name, ".tf") || strings.HasSuffix(name, ".hcl"):
+		return validateHCL(string(content))
+	}
+	return nil
+}
+
+func validateJSON(content []byte) error {
+	var v map[string]any
+	if err := json.Unmarshal(content, &v); err != nil {
+		return fmt.Errorf("invalid JSON: %w", err)
+	}
+	return nil
+}
+
+// goModDirectives are the directives a go.mod may hold.
+var goModDirectives = []string{"module", "go", "toolchain", "godebug", "require", "replace", "exclude", "retract", "tool", "ignore"}
+
+func validateGoMod(content string) error {
+	block, module := "", false
+	for i, line := range strings.Split(content, "\n") {
+		line, _, _ = strings.Cut(line, "//")
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if block != "" {
+			if fields[0] == ")" {
+				block = ""
+			} else if block == "require" && len(fields) != 2 {
+				return fmt.Errorf("go.mod line %d: want a module path and version", i+1)
+			}
+			continue
+		}
+		if !slices.Contains(goModDirectives, fields[0]) {
+			return fmt.Errorf("go.mod line %d: unknown directive %q", i+1, fields[0])
+		}
+		module = module || fields[0] == "module"
+		switch {
+		case len(fields) == 2 && fields[1] == "(":
+			block = fields[0]
+		case len(fields) < 2:
+			return fmt.Errorf("go.mod line %d: %s needs an argument", i+1, fields[0])
+		case fields[0] == "require" && len(fields) != 3:
+			return fmt.Errorf("go.mod line %d: want a module path and version", i+1)
+		}
+	}
+	if block != "" {
+		return fmt.Errorf("go.mod: unterminated %s block", block)
+	}
+	if !module {
+		return errors.New("go.mod: no module directive")
+	}
+	return nil
+}
+
+// requirementSpec matches a pip requirement: a name, extras, version
+// clauses and an environment marker.
+var requirementSpec = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*(\[[^\]]*\])?\s*((===|==|~=|>=|<=|!=|<|>)\s*[A-Za-z0-9.*+!_-]+\s*(,\s*(==|~=|>=|<=|!=|<|>)\s*[A-Za-z0-9.*+!_-]+\s*)*)?(;.*)?$`)
+
+func validateRequirements(content string) error {
+	for i, line := range strings.Split(content, "\n") {
+		if j := strings.Index(line, " #"); j >= 0 {
+			line = line[:j]
+		}
+		line = strings.TrimSpace(line)
+		// Comments, pip options and direct references are left to pip.
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, "-") || strings.Contains(line, "://") || strings.Contains(line, " @ ") {
+			continue
+		}
+		if !requirementSpec.MatchString(line) {
+			return fmt.Errorf("requirements line %d: %q is not a valid requirement", i+1, line)
+		}
+	}
+	return nil
+}
+
+// dockerInstructions are the instructions a Dockerfile may use.
+var dockerInstructions = []string{
+	"ADD", "ARG", "CMD", "COPY", "ENTRYPOINT", "ENV", "EXPOSE", "FROM", "HEALTHCHECK", "LABEL",
+	"MAINTAINER", "ONBUILD", "RUN", "SHELL", "STOPSIGNAL", "USER", "VOLUME", "WORKDIR",
+}
+
+// heredoc matches the start of a heredoc, capturing its delimiter.
+var heredoc = regexp.MustCompile(`<<-?["']?([A-Za-z_][A-Za-z0-9_]*)["']?`)
+
+func validateDockerfile(content string) error {
+	lines := strings.Split(content, "\n")
+	from := false
+	for i := 0; i < len(lines); i++ {
+		line := strings.TrimSpace(lines[i])
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		start := i + 1
+		text := line
+		for strings.HasSuffix(text, "\\") && i+1 < len(lines) {
+			i++
+			if next := strings.TrimSpace(lines[i]); !strings.HasPrefix(next, "#") {
+				text = strings.TrimSuffix(text, "\\") + " " + next
+			}
+		}
+
+		keyword, args, _ := strings.Cut(text, " ")
+		keyword = strings.ToUpper(keyword)
+		if !slices.Contains(dockerInstructions, keyword) {
+			return fmt.Errorf("Dockerfile line %d: unknown instruction %q", start, keyword)
+		}
+		if strings.TrimSpace(args) == "" {
+			return fmt.Errorf("Dockerfile line %d: %s needs arguments", start, keyword)
+		}
+		switch {
+		case keyword == "FROM":
+			from = true
+		case keyword != "ARG" && !from:
+			return fmt.Errorf("Dockerfile line %d: %s before the first FROM", start, keyword)
+		case keyword == "SHELL":
+			var shell []string
+			if err := json.Unmarshal([]byte(args), &shell); err != nil {
+				return fmt.Errorf("Dockerfile line %d: SHELL needs a JSON array of strings", start)
+			}
+		}
+		// Heredoc bodies are not instructions.
+		for _, m := range heredoc.FindAllStringSubmatch(text, -1) {
+			for i++; i < len(lines) && strings.TrimSpace(lines[i]) != m[1]; i++ {
+			}
+			if i == len(lines) {
+				return fmt.Errorf("Dockerfile line %d: unterminated heredoc %s", start, m[1])
+			}
+		}
+	}
+	if !from {
+		return errors.New("Dockerfile: no FROM instruction")
+	}
+	return nil
+}
+
+// podSpecs says where Kubernetes workloads keep their pod spec.
+var podSpecs = map[string][]string{
+	"Pod":         {"spec"},
+	"Deployment":  {"spec", "template", "spec"},
+	"StatefulSet": {"spec", "template", "spec"},
+	"DaemonSet":   {"spec", "template", "spec"},
+	"ReplicaSet":  {"spec", "template", "spec"},
+	"Job":         {"spec", "template", "spec"},
+	"CronJob":     {"spec", "jobTemplate", "spec", "template", "spec"},
+}
+
+// validateYAML parses every document and checks the ones that look like
+// Kubernetes resources have a kind, a name and, for workloads, named
+// containers with images.
+func validateYAML(content []byte) error {
+	dec := yaml.NewDecoder(bytes.NewReader(content))
+	for n := 1; ; n++ {
+		var doc map[string]any
+		err := dec.Decode(&doc)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("YAML document %d: %w", n, err)
+		}
+		if doc["apiVersion"] == nil && doc["kind"] == nil {
+			continue
+		}
+		kind, _ := doc["kind"].(string)
+		if _, ok := doc["apiVersion"].(string); !ok || kind == "" {
+			return fmt.Errorf("YAML document %d: a Kubernetes resource needs string apiVersion and kind", n)
+		}
+		if strings.HasSuffix(kind, "List") {
+			continue
+		}
+		meta, _ := doc["metadata"].(map[string]any)
+		if name, _ := meta["name"].(string); name == "" && meta["generateName"] == nil {
+			return fmt.Errorf("YAML document %d: %s has no metadata.name", n, kind)
+		}
+		keys, ok := podSpecs[kind]
+		if !ok {
+			continue
+		}
+		var spec any = doc
+		for _, k := range keys {
+			m, _ := spec.(map[string]any)
+			spec = m[k]
+		}
+		m, _ := spec.(map[string]any)
+		containers, _ := m["containers"].([]any)
+		if len(containers) == 0 {
+			return fmt.Errorf("YAML document %d: %s has no containers", n, kind)
+		}
+		for _, c := range containers {
+			c, _ := c.(map[string]any)
+			name, _ := c["name"].(string)
+			image, _ := c["image"].(string)
+			if name == "" || image == "" {
+				return fmt.Errorf("YAML document %d: every container of %s needs a name and an image", n, kind)
+			}
+		}
+	}
+}
+
+// validateHCL checks that braces, brackets and parentheses balance and
+// that strings, comments and heredocs are terminated.
+func validateHCL(content string) error {
+	var stack []byte
+	closing := map[byte]byte{'}': '{', ']': '[', ')': '('}
+	line := 1
+	for i := 0; i < len(content); i++ {
+		c := content[i]
+		switch {
+		case c == '\n':
+			line++
+		case c == '#' || c == '/' && i+1 < len(content) && content[i+1] == '/':
+			for i < len(content) && content[i] != '\n' {
+				i++
+			}
+			line++
+		case c == '/' && i+1 < len(content) && content[i+1] == '*':
+			end := strings.Index(content[i+2:], "*/")
+			if end < 0 {
+				return fmt.Errorf("HCL line %d: unterminated comment", line)
+			}
+			line += strings.Count(content[i:i+2+end], "\n")
+			i += end + 3
+		case c == '"':
+			start := line
+			for i++; i < len(content) && content[i] != '"'; i++ {
+				switch content[i] {
+				case '\\':
+					i++
+				case '\n':
+					return fmt.Errorf("HCL line %d: unterminated string", start)
+				}
+			}
+			if i >= len(content) {
+				return fmt.Errorf("HCL line %d: unterminated string", start)
+			}
+		case c == '<' && strings.HasPrefix(content[i:], "<<"):
+			m := heredoc.FindStringSubmatch(content[i:])
+			if m == nil {
+				continue
+			}
+			start := line
+			rest := content[i+len(m[0]):]
+			j := 0
+			for {
+				nl := strings.IndexByte(rest[j:], '\n')
+				if nl < 0 {
+					return fmt.Errorf("HCL line %d: unterminated heredoc %s", start, m[1])
+				}
+				j += nl + 1
+				line++
+				end := strings.IndexByte(rest[j:], '\n')
+				if end < 0 {
+					end = len(rest) - j
+				}
+				if strings.TrimSpace(rest[j:j+end]) == m[1] {
+					i += len(m[0]) + j + end - 1
+					break
+				}
+			}
+		case c == '{' || c == '[' || c == '(':
+			stack = append(stack, c)
+		case closing[c] != 0:
+			if len(stack) == 0 || stack[len(stack)-1] != closing[c] {
+				return fmt.Errorf("HCL line %d: unexpected %q", line, c)
+			}
+			stack = stack[:len(stack)-1]
+		}
+	}
+	if len(stack) > 0 {
+		return fmt.Errorf("HCL: unclosed %q", stack[len(stack)-1])
+	}
+	return nil
+}
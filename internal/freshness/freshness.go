@@ -0,0 +1,132 @@
+// Package freshness finds the registered targets that have not been
+// scanned successfully within a freshness SLO, and groups them by why, so
+// "7 images have not been scanned in 14 days because the registry refuses
+// our credentials" surfaces before the next digest quietly misses them.
+package freshness
+
+import (
+	"cmp"
+	"math"
+	"slices"
+	"time"
+	"weeklysec/internal/digest"
+	"weeklysec/internal/errcode"
+	"weeklysec/internal/failure"
+	"weeklysec/internal/store"
+)
+
+// NotAttempted is the cause of targets that went stale without a failed
+// scan: nothing scanned them, e.g. because their schedule is off.
+const NotAttempted = "not_attempted"
+
+// Target is a stale target.
+type Target struct {
+	ID            string     `json:"id"`
+	Org           string     `json:"org"`
+	Project       string     `json:"project"`
+	Name          string     `json:"name,omitempty"`
+	TargetType    string     `json:"target_type"`
+	Target        string     `json:"target"`
+	Team          string     `json:"team"`
+	LastScannedAt *time.Time `json:"last_scanned_at,omitempty"` // last successful scan; nil if never
+	LastAttemptAt *time.Time `json:"last_attempt_at,omitempty"`
+	StaleDays     float64    `json:"stale_days"` // since the last successful scan, or registration
+	Failures      int        `json:"failures"`   // consecutive failed attempts
+	Cause         string     `json:"cause"`      // failure class of the last attempt, or NotAttempted
+	LastErrorCode string     `json:"last_error_code,omitempty"`
+	LastError     string     `json:"last_error,omitempty"`
+}
+
+// Group is the stale targets of one type sharing a cause.
+type Group struct {
+	TargetType string `json:"target_type"`
+	Cause      string `json:"cause"`
+	Targets    int    `json:"targets"`
+	LastError  string `json:"last_error,omitempty"` // the most recent, as an example
+}
+
+// Report lists the targets not scanned successfully within the SLO, the
+// longest stale first, and groups them by cause, the largest group first.
+type Report struct {
+	Org         string    `json:"org,omitempty"`
+	GeneratedAt time.Time `json:"generated_at"`
+	SLODays     float64   `json:"slo_days"`
+	Checked     int       `json:"checked"`
+	Stale       []Target  `json:"stale"`
+	Groups      []Group   `json:"groups"`
+}
+
+// Check finds the targets not scanned successfully within slo of now.
+// statuses are the targets' scan statuses and lastScans the time of the
+// latest stored scan of each target, both by target ID; the later of the
+// two successes counts. A target never scanned is stale once it has been
+// registered for longer than slo.
+func Check(targets []store.Target, statuses map[string]store.ScanStatus, lastScans map[string]time.Time, slo time.Duration, now time.Time) *Report {
+	r := &Report{GeneratedAt: now, SLODays: days(slo), Checked: len(targets), Stale: []Target{}, Groups: []Group{}}
+	for _, t := range targets {
+		st, tracked := statuses[t.ID]
+		var last *time.Time
+		if at, ok := lastScans[t.ID]; ok {
+			last = &at
+		}
+		if st.LastSuccessAt != nil && (last == nil || st.LastSuccessAt.After(*last)) {
+			last = st.LastSuccessAt
+		}
+		since := t.CreatedAt
+		if last != nil {
+			since = *last
+		}
+		if now.Sub(since) <= slo {
+			continue
+		}
+
+		s := Target{
+			ID:            t.ID,
+			Org:           t.Org,
+			Project:       t.Project,
+			Name:          t.Name,
+			TargetType:    t.TargetType,
+			Target:        t.Target,
+			Team:          cmp.Or(t.Team, digest.Unassigned),
+			LastScannedAt: last,
+			StaleDays:     days(now.Sub(since)),
+			Cause:         NotAttempted,
+		}
+		if tracked {
+			s.LastAttemptAt = &st.LastAttemptAt
+			if st.Failures > 0 {
+				s.Failures, s.LastErrorCode, s.LastError = st.Failures, st.LastErrorCode, st.LastError
+				s.Cause = cmp.Or(st.LastClass, failure.Classify(errcode.Code(st.LastErrorCode), st.LastError))
+			}
+		}
+		r.Stale = append(r.Stale, s)
+	}
+	slices.SortStableFunc(r.Stale, func(a, b Target) int { return cmp.Compare(b.StaleDays, a.StaleDays) })
+
+	type key struct{ typ, cause string }
+	groups := map[key]*Group{}
+	latest := map[key]time.Time{}
+	var order []key
+	for _, s := range r.Stale {
+		k := key{s.TargetType, s.Cause}
+		g, ok := groups[k]
+		if !ok {
+			g = &Group{TargetType: s.TargetType, Cause: s.Cause}
+			groups[k] = g
+			order = append(order, k)
+		}
+		g.Targets++
+		if s.LastAttemptAt != nil && s.LastError != "" && s.LastAttemptAt.After(latest[k]) {
+			g.LastError, latest[k] = s.LastError, *s.LastAttemptAt
+		}
+	}
+	for _, k := range order {
+		r.Groups = append(r.Groups, *groups[k])
+	}
+	slices.SortStableFunc(r.Groups, func(a, b Group) int { return cmp.Compare(b.Targets, a.Targets) })
+	return r
+}
+
+func days(d time.Duration) float64 {
+	return math.Round(d.Hours()/24*10) / 10
+}
@@ -0,0 +1,135 @@
+package gate
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"weeklysec/internal/agent"
+	"weeklysec/internal/trivy"
+)
+
+// Annotation levels, as GitHub check runs name them.
+const (
+	LevelFailure = "failure"
+	LevelWarning = "warning"
+)
+
+// Annotation points at the lines of a file that need changing.
+type Annotation struct {
+	Path      string `json:"path"`
+	StartLine int    `json:"start_line"`
+	EndLine   int    `json:"end_line"`
+	Level     string `json:"annotation_level"`
+	Title     string `json:"title"`
+	Message   string `json:"message"`
+}
+
+// instruction is one Dockerfile instruction, continuation lines included.
+type instruction struct {
+	command    string // upper-cased, e.g. RUN
+	text       string
+	start, end int // 1-based lines
+}
+
+// parseDockerfile splits a Dockerfile into instructions, joining lines
+// ending in a backslash and skipping comments.
+func parseDockerfile(content string) []instruction {
+	var out []instruction
+	var cur *instruction
+	for i, line := range strings.Split(content, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if cur == nil {
+			if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+				continue
+			}
+			cmd, _, _ := strings.Cut(trimmed, " ")
+			cur = &instruction{command: strings.ToUpper(cmd), start: i + 1}
+		} else if strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		cur.end = i + 1
+		cur.text += " " + strings.TrimSuffix(trimmed, `\`)
+		if !strings.HasSuffix(trimmed, `\`) {
+			out = append(out, *cur)
+			cur = nil
+		}
+	}
+	if cur != nil {
+		out = append(out, *cur)
+	}
+	return out
+}
+
+// Annotate maps findings to the Dockerfile instructions that bring them in:
+// the last RUN that installs the package by name, otherwise the FROM of the
+// final stage. Fixes, when given, add the recommended version. Findings are
+// grouped into one annotation per instruction.
+func Annotate(path, dockerfile string, findings []trivy.Vulnerability, fixes []agent.Fix) []Annotation {
+	instructions := parseDockerfile(dockerfile)
+	base := -1
+	for i, in := range instructions {
+		if in.command == "FROM" {
+			base = i
+		}
+	}
+	if base < 0 {
+		return nil
+	}
+	recommended := map[string]string{}
+	for _, f := range fixes {
+		if f.RecommendedVersion != "" {
+			recommended[f.PkgName] = f.RecommendedVersion
+		}
+	}
+
+	byLine := map[int][]trivy.Vulnerability{}
+	for _, f := range findings {
+		at := base
+		installs := installPattern(f.PkgName)
+		for i := len(instructions) - 1; i > base; i-- {
+			if instructions[i].command == "RUN" && installs.MatchString(instructions[i].text) {
+				at = i
+				break
+			}
+		}
+		byLine[at] = append(byLine[at], f)
+	}
+
+	var out []Annotation
+	for at, vulns := range byLine {
+		in := instructions[at]
+		var b strings.Builder
+		if at == base {
+			fmt.Fprintf(&b, "The base image brings in %d vulnerable package(s); move to a patched tag or digest.\n", len(vulns))
+		}
+		for _, v := range vulns {
+			fmt.Fprintf(&b, "%s (%s) in %s %s", v.VulnerabilityID, v.Severity, v.PkgName, v.InstalledVersion)
+			switch {
+			case recommended[v.PkgName] != "":
+				fmt.Fprintf(&b, ": upgrade to %s", recommended[v.PkgName])
+			case v.FixedVersion != "":
+				fmt.Fprintf(&b, ": fixed in %s", v.FixedVersion)
+			default:
+				b.WriteString(": no fix available")
+			}
+			b.WriteString("\n")
+		}
+		out = append(out, Annotation{
+			Path:      path,
+			StartLine: in.start,
+			EndLine:   in.end,
+			Level:     LevelFailure,
+			Title:     fmt.Sprintf("%d vulnerability finding(s) to fix", len(vulns)),
+			Message:   strings.TrimSuffix(b.String(), "\n"),
+		})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].StartLine < out[j].StartLine })
+	return out
+}
+
+// installPattern matches a package name as a word of an install command,
+// optionally followed by a version pin.
+func installPattern(pkg string) *regexp.Regexp {
+	return regexp.MustCompile(`(^|[\s"'])` + regexp.QuoteMeta(pkg) + `($|[\s"'=<>~@:;&|,\[])`)
+}
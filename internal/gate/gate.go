@@ -0,0 +1,141 @@
+// Package gate turns a scan into a CI verdict: whether it passes a policy,
+// compared with a baseline scan so only newly introduced findings fail a
+// build, along with annotations on the Dockerfile lines to change and a
+// Markdown job summary.
+package gate
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"weeklysec/internal/agent"
+	"weeklysec/internal/digest"
+	"weeklysec/internal/policy"
+	"weeklysec/internal/store"
+	"weeklysec/internal/trivy"
+)
+
+// Policy decides when a scan fails the gate.
+type Policy struct {
+	FailOn       []string `json:"fail_on"`                  // severities that fail the gate
+	NewOnly      bool     `json:"new_only"`                 // only findings missing from the baseline count
+	MaxRiskScore float64  `json:"max_risk_score,omitempty"` // a higher risk score fails; 0 disables
+}
+
+// Validate checks the severities.
+func (p Policy) Validate() error {
+	for _, sev := range p.FailOn {
+		if !slices.Contains(trivy.Severities, sev) {
+			return fmt.Errorf("unknown severity %q", sev)
+		}
+	}
+	if p.MaxRiskScore < 0 || p.MaxRiskScore > 100 {
+		return fmt.Errorf("max risk score must be between 0 and 100")
+	}
+	return nil
+}
+
+// Verdict is the outcome of a gate.
+type Verdict struct {
+	Pass           bool                  `json:"pass"`
+	Reasons        []string              `json:"reasons,omitempty"` // why it failed
+	ScanID         string                `json:"scan_id"`
+	BaselineScanID string                `json:"baseline_scan_id,omitempty"`
+	Target         string                `json:"target"`
+	Policy         Policy                `json:"policy"`
+	RiskScore      float64               `json:"risk_score"`
+	Counts         map[string]int        `json:"counts"`     // open findings by severity
+	NewCounts      map[string]int        `json:"new_counts"` // of which missing from the baseline
+	Fixed          int                   `json:"fixed"`      // baseline findings gone from the scan
+	Failing        []trivy.Vulnerability `json:"failing"`    // findings that fail the gate
+	Annotations    []Annotation          `json:"annotations,omitempty"`
+	Rules          *policy.Verdict       `json:"rules,omitempty"` // of the policy rules when the scan was stored
+}
+
+// Evaluate judges scan against the policy. Without a baseline every
+// finding is new.
+func Evaluate(scan, baseline *store.Scan, p Policy) *Verdict {
+	v := &Verdict{
+		Pass:      true,
+		ScanID:    scan.ID,
+		Target:    scan.Target,
+		Policy:    p,
+		RiskScore: digest.RiskScore(scan),
+		Counts:    emptyCounts(),
+		NewCounts: emptyCounts(),
+		Failing:   []trivy.Vulnerability{},
+	}
+	known := map[string]bool{}
+	if baseline != nil {
+		v.BaselineScanID = baseline.ID
+		for _, f := range digest.Open(baseline) {
+			known[digest.FindingKey(f)] = true
+		}
+	}
+
+	current := map[string]bool{}
+	for _, f := range digest.Open(scan) {
+		key := digest.FindingKey(f)
+		current[key] = true
+		v.Counts[f.Severity]++
+		isNew := !known[key]
+		if isNew {
+			v.NewCounts[f.Severity]++
+		}
+		if slices.Contains(p.FailOn, f.Severity) && (isNew || !p.NewOnly) {
+			v.Failing = append(v.Failing, f)
+		}
+	}
+	for key := range known {
+		if !current[key] {
+			v.Fixed++
+		}
+	}
+	sort.SliceStable(v.Failing, func(i, j int) bool {
+		return trivy.SeverityRank(v.Failing[i].Severity) > trivy.SeverityRank(v.Failing[j].Severity)
+	})
+
+	if len(v.Failing) > 0 {
+		qualifier := ""
+		if p.NewOnly && baseline != nil {
+			qualifier = "new "
+		}
+		v.Reasons = append(v.Reasons, fmt.Sprintf("%d %s%s finding(s)", len(v.Failing), qualifier, strings.Join(p.FailOn, "/")))
+	}
+	if p.MaxRiskScore > 0 && v.RiskScore > p.MaxRiskScore {
+		v.Reasons = append(v.Reasons, fmt.Sprintf("risk score %.1f exceeds %.1f", v.RiskScore, p.MaxRiskScore))
+	}
+	if scan.Response != nil && scan.Response.Status == agent.StatusFailed {
+		v.Reasons = append(v.Reasons, "scan failed: "+scan.Response.Error)
+	}
+	if scan.Response != nil {
+		v.Rules = scan.Response.Policy
+		for _, x := range v.Rules.Denied() {
+			v.Reasons = append(v.Reasons, policyReason(x))
+		}
+	}
+	v.Pass = len(v.Reasons) == 0
+	return v
+}
+
+func policyReason(x policy.Violation) string {
+	reason := "policy " + x.Rule
+	switch {
+	case x.Error != "":
+		reason += " could not be evaluated: " + x.Error
+	case x.Description != "":
+		reason += " violated: " + x.Description
+	default:
+		reason += " violated"
+	}
+	return reason
+}
+
+func emptyCounts() map[string]int {
+	m := make(map[string]int, len(trivy.Severities))
+	for _, sev := range trivy.Severities {
+		m[sev] = 0
+	}
+	return m
+}
@@ -0,0 +1,99 @@
+package gate
+
+import (
+	"fmt"
+	"strings"
+	"weeklysec/internal/policy"
+	"weeklysec/internal/trivy"
+)
+
+// maxSummaryFindings bounds the failing findings listed in a summary.
+const maxSummaryFindings = 50
+
+// Markdown renders the verdict as a CI job summary, e.g. for
+// $GITHUB_STEP_SUMMARY.
+func Markdown(v *Verdict) string {
+	var b strings.Builder
+	if v.Pass {
+		b.WriteString("## weeklysec gate: passed\n\n")
+	} else {
+		b.WriteString("## weeklysec gate: failed\n\n")
+		for _, r := range v.Reasons {
+			fmt.Fprintf(&b, "- %s\n", r)
+		}
+		b.WriteString("\n")
+	}
+	fmt.Fprintf(&b, "**Target:** `%s`  \n", v.Target)
+	fmt.Fprintf(&b, "**Risk score:** %.1f / 100  \n", v.RiskScore)
+	if v.BaselineScanID != "" {
+		fmt.Fprintf(&b, "**Baseline:** scan `%s`, %d finding(s) fixed since\n\n", v.BaselineScanID, v.Fixed)
+	} else {
+		b.WriteString("**Baseline:** none, every finding counts as new\n\n")
+	}
+
+	b.WriteString("| Severity | Open | New |\n|---|---|---|\n")
+	for _, sev := range trivy.Severities {
+		fmt.Fprintf(&b, "| %s | %d | %d |\n", sev, v.Counts[sev], v.NewCounts[sev])
+	}
+
+	if v.Rules != nil {
+		var warnings []string
+		for _, x := range v.Rules.Violations {
+			if x.Action == policy.ActionWarn {
+				warnings = append(warnings, policyReason(x))
+			}
+		}
+		if len(warnings) > 0 {
+			b.WriteString("\n### Policy warnings\n\n")
+			for _, w := range warnings {
+				fmt.Fprintf(&b, "- %s\n", w)
+			}
+		}
+	}
+
+	if len(v.Failing) > 0 {
+		b.WriteString("\n### Failing findings\n\n| Vulnerability | Severity | Package | Installed | Fixed in |\n|---|---|---|---|---|\n")
+		for i, f := range v.Failing {
+			if i == maxSummaryFindings {
+				fmt.Fprintf(&b, "\n…and %d more.\n", len(v.Failing)-maxSummaryFindings)
+				break
+			}
+			fixed := f.FixedVersion
+			if fixed == "" {
+				fixed = "—"
+			}
+			fmt.Fprintf(&b, "| %s | %s | %s | %s | %s |\n", f.VulnerabilityID, f.Severity, f.PkgName, f.InstalledVersion, fixed)
+		}
+	}
+	return b.String()
+}
+
+// WorkflowCommands renders the annotations as GitHub Actions workflow
+// commands, which the runner shows on the changed lines, followed by a
+// one-line verdict.
+func WorkflowCommands(v *Verdict) string {
+	var b strings.Builder
+	for _, a := range v.Annotations {
+		cmd := "error"
+		if a.Level == LevelWarning {
+			cmd = "warning"
+		}
+		fmt.Fprintf(&b, "::%s file=%s,line=%d,endLine=%d,title=%s::%s\n",
+			cmd, escapeProperty(a.Path), a.StartLine, a.EndLine, escapeProperty(a.Title), escapeData(a.Message))
+	}
+	if v.Pass {
+		fmt.Fprintf(&b, "weeklysec: PASS %s (risk %.1f)\n", v.Target, v.RiskScore)
+	} else {
+		fmt.Fprintf(&b, "weeklysec: FAIL %s: %s\n", v.Target, strings.Join(v.Reasons, "; "))
+	}
+	return b.String()
+}
+
+// escapeData and escapeProperty follow the workflow command encoding.
+func escapeData(s string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A").Replace(s)
+}
+
+func escapeProperty(s string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A", ":", "%3A", ",", "%2C").Replace(s)
+}
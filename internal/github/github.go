@@ -0,0 +1,310 @@
+// Package github opens remediation pull requests and issues, and publishes
+// check runs, through the GitHub REST API without a local clone.
+package github
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"weeklysec/internal/errcode"
+	"weeklysec/internal/jsonapi"
+)
+
+// DefaultAPIURL is the public GitHub API.
+const DefaultAPIURL = "https://api.github.com"
+
+// ErrNoChanges is returned when none of the files needed editing.
+var ErrNoChanges = errcode.New(errcode.Conflict, "none of the files needed changes")
+
+var repoName = regexp.MustCompile(`^[A-Za-z0-9_.-]+/[A-Za-z0-9_.-]+$`)
+
+// ValidateRepo checks that repo has the "owner/name" form.
+func ValidateRepo(repo string) error {
+	if !repoName.MatchString(repo) {
+		return fmt.Errorf("repository must have the form owner/name")
+	}
+	return nil
+}
+
+// Client calls the GitHub API with a token.
+type Client struct {
+	api *jsonapi.Client
+}
+
+// New returns a client for the API at baseURL (DefaultAPIURL when empty).
+func New(baseURL, token string) *Client {
+	api := jsonapi.New("github", errcode.GitHubError, cmp.Or(baseURL, DefaultAPIURL))
+	api.Header = func(req *http.Request) {
+		req.Header.Set("Accept", "application/vnd.github+json")
+		req.Header.Set("X-GitHub-Api-Version", "2022-11-28")
+		jsonapi.Auth("", "", token)(req)
+	}
+	api.Message = message
+	return &Client{api: api}
+}
+
+// message returns the message of a GitHub error response.
+func message(body []byte) string {
+	var apiErr struct {
+		Message string `json:"message"`
+	}
+	_ = json.Unmarshal(body, &apiErr)
+	return apiErr.Message
+}
+
+// Change describes a pull request that edits existing files of a repo.
+type Change struct {
+	Repo          string // owner/name
+	Base          string // base branch; the repo's default branch when empty
+	Branch        string // branch created for the change
+	Title         string
+	Body          string
+	CommitMessage string
+	Paths         []string
+
+	// Edit returns the new content of a file, or false to leave it as is.
+	Edit func(path string, content []byte) ([]byte, bool)
+
+	// Commits, when set, replaces CommitMessage, Paths and Edit with a
+	// series of commits, each editing the files as the ones before it
+	// left them.
+	Commits []Commit
+}
+
+// Commit is one commit of a Change.
+type Commit struct {
+	Message string
+	Paths   []string
+	Edit    func(path string, content []byte) ([]byte, bool)
+}
+
+// PullRequest is an opened pull request.
+type PullRequest struct {
+	Number int      `json:"number"`
+	URL    string   `json:"html_url"`
+	Base   string   `json:"-"`
+	Files  []string `json:"-"` // paths changed by the pull request
+}
+
+// OpenPullRequest creates ch.Branch from the base branch, commits every
+// edited file to it and opens a pull request. Nothing is created when no
+// file needs changes; commits that change nothing are left out.
+func (c *Client) OpenPullRequest(ctx context.Context, ch Change) (*PullRequest, error) {
+	base := ch.Base
+	if base == "" {
+		var repo struct {
+			DefaultBranch string `json:"default_branch"`
+		}
+		if err := c.api.Do(ctx, http.MethodGet, "/repos/"+ch.Repo, nil, &repo); err != nil {
+			return nil, err
+		}
+		base = repo.DefaultBranch
+	}
+
+	commits := ch.Commits
+	if len(commits) == 0 {
+		commits = []Commit{{Message: ch.CommitMessage, Paths: ch.Paths, Edit: ch.Edit}}
+	}
+
+	// Every edit is worked out before anything is created, following each
+	// file through the commits.
+	type edit struct {
+		message, path string
+		content       []byte
+	}
+	var edits []edit
+	current := map[string][]byte{}
+	shas := map[string]string{}
+	for _, cm := range commits {
+		for _, p := range cm.Paths {
+			content, ok := current[p]
+			if !ok {
+				var err error
+				if content, shas[p], err = c.getFile(ctx, ch.Repo, p, base); err != nil {
+					return nil, err
+				}
+				current[p] = content
+			}
+			if next, ok := cm.Edit(p, content); ok && !bytes.Equal(next, content) {
+				edits = append(edits, edit{message: cm.Message, path: p, content: next})
+				current[p] = next
+			}
+		}
+	}
+	if len(edits) == 0 {
+		return nil, ErrNoChanges
+	}
+
+	var ref struct {
+		Object struct {
+			SHA string `json:"sha"`
+		} `json:"object"`
+	}
+	if err := c.api.Do(ctx, http.MethodGet, "/repos/"+ch.Repo+"/git/ref/heads/"+escapePath(base), nil, &ref); err != nil {
+		return nil, err
+	}
+	if err := c.api.Do(ctx, http.MethodPost, "/repos/"+ch.Repo+"/git/refs", map[string]string{
+		"ref": "refs/heads/" + ch.Branch,
+		"sha": ref.Object.SHA,
+	}, nil); err != nil {
+		return nil, err
+	}
+
+	pr := &PullRequest{Base: base}
+	for _, e := range edits {
+		var put struct {
+			Content struct {
+				SHA string `json:"sha"`
+			} `json:"content"`
+		}
+		if err := c.api.Do(ctx, http.MethodPut, "/repos/"+ch.Repo+"/contents/"+escapePath(e.path), map[string]string{
+			"message": e.message,
+			"content": base64.StdEncoding.EncodeToString(e.content),
+			"sha":     shas[e.path],
+			"branch":  ch.Branch,
+		}, &put); err != nil {
+			return nil, err
+		}
+		if !slices.Contains(pr.Files, e.path) {
+			pr.Files = append(pr.Files, e.path)
+		}
+		shas[e.path] = put.Content.SHA
+	}
+
+	if err := c.api.Do(ctx, http.MethodPost, "/repos/"+ch.Repo+"/pulls", map[string]string{
+		"title": ch.Title,
+		"body":  ch.Body,
+		"head":  ch.Branch,
+		"base":  base,
+	}, pr); err != nil {
+		return nil, err
+	}
+	return pr, nil
+}
+
+func (c *Client) getFile(ctx context.Context, repo, p, ref string) ([]byte, string, error) {
+	var file struct {
+		SHA      string `json:"sha"`
+		Content  string `json:"content"`
+		Encoding string `json:"encoding"`
+	}
+	path := "/repos/" + repo + "/contents/" + escapePath(p) + "?ref=" + url.QueryEscape(ref)
+	if err := c.api.Do(ctx, http.MethodGet, path, nil, &file); err != nil {
+		return nil, "", err
+	}
+	if file.Encoding != "base64" {
+		return nil, "", errcode.Wrap(errcode.GitHubError, fmt.Errorf("%s: unsupported content encoding %q", p, file.Encoding))
+	}
+	content, err := base64.StdEncoding.DecodeString(strings.ReplaceAll(file.Content, "\n", ""))
+	if err != nil {
+		return nil, "", errcode.Wrap(errcode.GitHubError, fmt.Errorf("%s: %w", p, err))
+	}
+	return content, file.SHA, nil
+}
+
+// escapePath escapes each segment of a slash-separated path.
+func escapePath(p string) string {
+	segs := strings.Split(strings.Trim(p, "/"), "/")
+	for i, s := range segs {
+		segs[i] = url.PathEscape(s)
+	}
+	return strings.Join(segs, "/")
+}
+
+// Issue is an issue to open.
+type Issue struct {
+	Title     string   `json:"title"`
+	Body      string   `json:"body"`
+	Labels    []string `json:"labels,omitempty"`
+	Assignees []string `json:"assignees,omitempty"`
+}
+
+// CreatedIssue is an opened issue.
+type CreatedIssue struct {
+	Number int    `json:"number"`
+	URL    string `json:"html_url"`
+}
+
+// CreateIssue opens an issue in repo.
+func (c *Client) CreateIssue(ctx context.Context, repo string, issue Issue) (*CreatedIssue, error) {
+	var out CreatedIssue
+	if err := c.api.Do(ctx, http.MethodPost, "/repos/"+repo+"/issues", issue, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetFile returns the content of a file at ref.
+func (c *Client) GetFile(ctx context.Context, repo, p, ref string) ([]byte, error) {
+	content, _, err := c.getFile(ctx, repo, p, ref)
+	return content, err
+}
+
+// maxAnnotations is how many annotations GitHub accepts per check run
+// request.
+const maxAnnotations = 50
+
+// CheckRun is a completed check run to publish on a commit.
+type CheckRun struct {
+	Name        string
+	HeadSHA     string
+	Conclusion  string // success, failure or neutral
+	Title       string
+	Summary     string // Markdown
+	Annotations []CheckAnnotation
+}
+
+// CheckAnnotation marks lines of a file in a check run.
+type CheckAnnotation struct {
+	Path      string `json:"path"`
+	StartLine int    `json:"start_line"`
+	EndLine   int    `json:"end_line"`
+	Level     string `json:"annotation_level"` // notice, warning or failure
+	Title     string `json:"title,omitempty"`
+	Message   string `json:"message"`
+}
+
+// CreatedCheckRun is a published check run.
+type CreatedCheckRun struct {
+	ID  int64  `json:"id"`
+	URL string `json:"html_url"`
+}
+
+// CreateCheckRun publishes run on its commit. Annotations beyond the
+// per-request limit are added by follow-up updates.
+func (c *Client) CreateCheckRun(ctx context.Context, repo string, run CheckRun) (*CreatedCheckRun, error) {
+	batch := func(i int) []CheckAnnotation {
+		end := min(i+maxAnnotations, len(run.Annotations))
+		return run.Annotations[i:end]
+	}
+	output := func(i int) map[string]any {
+		return map[string]any{"title": run.Title, "summary": run.Summary, "annotations": batch(i)}
+	}
+
+	var out CreatedCheckRun
+	if err := c.api.Do(ctx, http.MethodPost, "/repos/"+repo+"/check-runs", map[string]any{
+		"name":       run.Name,
+		"head_sha":   run.HeadSHA,
+		"status":     "completed",
+		"conclusion": run.Conclusion,
+		"output":     output(0),
+	}, &out); err != nil {
+		return nil, err
+	}
+	for i := maxAnnotations; i < len(run.Annotations); i += maxAnnotations {
+		if err := c.api.Do(ctx, http.MethodPatch, fmt.Sprintf("/repos/%s/check-runs/%d", repo, out.ID), map[string]any{
+			"output": output(i),
+		}, nil); err != nil {
+			return &out, err
+		}
+	}
+	return &out, nil
+}
@@ -0,0 +1,54 @@
+package github
+
+import (
+	"fmt"
+	"path"
+	"strings"
+	"weeklysec/internal/tenant"
+)
+
+// Grant lets the tenants of Tenant have the server's own token used on
+// the repos matching Repo, an "owner/name" pattern such as "acme/*".
+type Grant struct {
+	Tenant tenant.Tenant
+	Repo   string
+}
+
+// Grants are the repos each tenant may use the server's token on.
+type Grants []Grant
+
+// ParseGrants parses "org[/project]=owner/repo" pairs; repo may be a
+// path.Match pattern, and project "*" or left out for every project.
+func ParseGrants(pairs []string) (Grants, error) {
+	grants := make(Grants, 0, len(pairs))
+	for _, p := range pairs {
+		owner, repo, ok := strings.Cut(p, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid token grant %q, want org[/project]=owner/repo", p)
+		}
+		t, err := tenant.Parse(owner)
+		if err != nil {
+			return nil, fmt.Errorf("invalid token grant %q: %w", p, err)
+		}
+		repo = strings.TrimSpace(repo)
+		if _, err := path.Match(repo, ""); err != nil || strings.Count(repo, "/") != 1 {
+			return nil, fmt.Errorf("invalid token grant %q: bad repo pattern %q", p, repo)
+		}
+		grants = append(grants, Grant{Tenant: t, Repo: repo})
+	}
+	return grants, nil
+}
+
+// Allows reports whether the server's token may be used on repo for the
+// records of org/project.
+func (g Grants) Allows(org, project, repo string) bool {
+	for _, grant := range g {
+		if !grant.Tenant.Allows(org, project) {
+			continue
+		}
+		if ok, _ := path.Match(grant.Repo, repo); ok {
+			return true
+		}
+	}
+	return false
+}
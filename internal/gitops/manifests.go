@@ -0,0 +1,119 @@
+// Package gitops reads the container images out of rendered Kubernetes
+// manifests, as Argo CD and Flux are about to apply them, so they can be
+// judged before a sync.
+package gitops
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Workload is a manifest that runs an image.
+type Workload struct {
+	Kind      string `json:"kind"`
+	Namespace string `json:"namespace,omitempty"`
+	Name      string `json:"name"`
+	Container string `json:"container"`
+}
+
+// Image is a distinct image of the manifests, with every workload using it.
+type Image struct {
+	Image     string     `json:"image"`
+	Workloads []Workload `json:"workloads,omitempty"`
+}
+
+// containerKeys are the pod spec fields holding containers.
+var containerKeys = []string{"initContainers", "containers", "ephemeralContainers"}
+
+// Images returns the images referenced by a stream of YAML or JSON
+// documents, sorted by reference. Any resource with a pod template counts,
+// custom ones such as Argo Rollouts included, and List items are followed.
+func Images(manifests []byte) ([]Image, error) {
+	byRef := map[string]*Image{}
+	dec := yaml.NewDecoder(bytes.NewReader(manifests))
+	for n := 1; ; n++ {
+		var doc map[string]any
+		err := dec.Decode(&doc)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("document %d: %w", n, err)
+		}
+		collect(doc, byRef)
+	}
+
+	out := make([]Image, 0, len(byRef))
+	for _, img := range byRef {
+		sort.Slice(img.Workloads, func(i, j int) bool {
+			a, b := img.Workloads[i], img.Workloads[j]
+			return a.Namespace+"/"+a.Kind+"/"+a.Name+"/"+a.Container < b.Namespace+"/"+b.Kind+"/"+b.Name+"/"+b.Container
+		})
+		out = append(out, *img)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Image < out[j].Image })
+	return out, nil
+}
+
+// collect adds the images of one resource.
+func collect(doc map[string]any, byRef map[string]*Image) {
+	if doc == nil {
+		return
+	}
+	if items, ok := doc["items"].([]any); ok {
+		for _, item := range items {
+			if m, ok := item.(map[string]any); ok {
+				collect(m, byRef)
+			}
+		}
+		return
+	}
+	meta, _ := doc["metadata"].(map[string]any)
+	w := Workload{Kind: str(doc["kind"]), Namespace: str(meta["namespace"]), Name: str(meta["name"])}
+	findContainers(doc["spec"], func(name, image string) {
+		img := byRef[image]
+		if img == nil {
+			img = &Image{Image: image}
+			byRef[image] = img
+		}
+		w.Container = name
+		img.Workloads = append(img.Workloads, w)
+	})
+}
+
+// findContainers walks a spec for container lists, wherever the resource
+// keeps its pod template.
+func findContainers(v any, found func(name, image string)) {
+	switch v := v.(type) {
+	case map[string]any:
+		for key, child := range v {
+			if slices.Contains(containerKeys, key) {
+				if list, ok := child.([]any); ok {
+					for _, item := range list {
+						c, _ := item.(map[string]any)
+						if image := str(c["image"]); image != "" {
+							found(str(c["name"]), image)
+						}
+					}
+					continue
+				}
+			}
+			findContainers(child, found)
+		}
+	case []any:
+		for _, child := range v {
+			findContainers(child, found)
+		}
+	}
+}
+
+func str(v any) string {
+	s, _ := v.(string)
+	return s
+}
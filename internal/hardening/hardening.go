@@ -0,0 +1,447 @@
+// Package hardening reviews Kubernetes manifests for the protections they
+// leave out, whether or not their images have known vulnerabilities:
+// container security contexts, resource limits, network policies and RBAC
+// grants. Each recommendation carries the YAML to apply.
+package hardening
+
+import (
+	"bytes"
+	"cmp"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Recommendation categories.
+const (
+	CategorySecurityContext = "security_context"
+	CategoryResources       = "resources"
+	CategoryHostAccess      = "host_access"
+	CategoryNetworkPolicy   = "network_policy"
+	CategoryRBAC            = "rbac"
+)
+
+// MaxFiles bounds the manifests read from one directory.
+const MaxFiles = 200
+
+// Recommendation is one hardening fix for one resource, or one container
+// of it.
+type Recommendation struct {
+	Category  string   `json:"category"`
+	Severity  string   `json:"severity"` // the most severe of Issues
+	File      string   `json:"file"`
+	Line      int      `json:"line,omitempty"`
+	Resource  string   `json:"resource"` // Kind/namespace/name
+	Container string   `json:"container,omitempty"`
+	Issues    []string `json:"issues"`
+	Patch     string   `json:"patch"` // YAML to merge at Line, or a new resource
+}
+
+// issue is one finding of a check, before it is grouped.
+type issue struct {
+	severity string
+	text     string
+	patch    string
+}
+
+// severityRank orders the severities issues use.
+var severityRank = map[string]int{"HIGH": 0, "MEDIUM": 1, "LOW": 2}
+
+// podSpecPaths says where each workload kind keeps its pod spec.
+var podSpecPaths = map[string][]string{
+	"Pod":                   {"spec"},
+	"Deployment":            {"spec", "template", "spec"},
+	"StatefulSet":           {"spec", "template", "spec"},
+	"DaemonSet":             {"spec", "template", "spec"},
+	"ReplicaSet":            {"spec", "template", "spec"},
+	"ReplicationController": {"spec", "template", "spec"},
+	"Job":                   {"spec", "template", "spec"},
+	"CronJob":               {"spec", "jobTemplate", "spec", "template", "spec"},
+}
+
+// Manifests returns the Kubernetes manifests at path: the file itself, or
+// the YAML files under a directory, skipping hidden directories. Files
+// without a Kubernetes resource are left out, so an empty result means
+// path holds none.
+func Manifests(path string) (map[string][]byte, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	out := map[string][]byte{}
+	add := func(file string) error {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		if isManifest(data) {
+			out[file] = data
+		}
+		return nil
+	}
+	if !info.IsDir() {
+		return out, add(path)
+	}
+
+	n := 0
+	err = filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if p != path && strings.HasPrefix(d.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if ext := filepath.Ext(p); ext != ".yaml" && ext != ".yml" {
+			return nil
+		}
+		if n++; n > MaxFiles {
+			return fmt.Errorf("more than %d YAML files under %s", MaxFiles, path)
+		}
+		return add(p)
+	})
+	return out, err
+}
+
+// isManifest reports whether data holds at least one document with an
+// apiVersion and a kind.
+func isManifest(data []byte) bool {
+	docs, err := decode(data)
+	if err != nil {
+		return false
+	}
+	for _, doc := range docs {
+		if scalar(get(doc, "apiVersion")) != "" && scalar(get(doc, "kind")) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// Review checks the manifests, keyed by file, and returns the
+// recommendations ordered by severity, file and line.
+func Review(manifests map[string][]byte) ([]Recommendation, error) {
+	files := make([]string, 0, len(manifests))
+	for f := range manifests {
+		files = append(files, f)
+	}
+	sort.Strings(files)
+
+	var out []Recommendation
+	workloadNS := map[string]string{} // namespace -> first file running workloads in it
+	covered := map[string]bool{}      // namespaces with a NetworkPolicy
+	for _, file := range files {
+		docs, err := decode(manifests[file])
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		for _, doc := range docs {
+			kind := scalar(get(doc, "kind"))
+			ns := cmp.Or(scalar(get(doc, "metadata", "namespace")), "default")
+			res := resource{file: file, kind: kind, namespace: ns, name: scalar(get(doc, "metadata", "name"))}
+			switch kind {
+			case "NetworkPolicy":
+				covered[ns] = true
+			case "Role", "ClusterRole":
+				out = append(out, reviewRole(res, doc)...)
+			case "RoleBinding", "ClusterRoleBinding":
+				out = append(out, reviewBinding(res, doc)...)
+			}
+			if path, ok := podSpecPaths[kind]; ok {
+				if spec := get(doc, path...); spec != nil {
+					out = append(out, reviewPodSpec(res, spec)...)
+					if _, ok := workloadNS[ns]; !ok {
+						workloadNS[ns] = file
+					}
+				}
+			}
+		}
+	}
+
+	for ns, file := range workloadNS {
+		if covered[ns] {
+			continue
+		}
+		out = append(out, Recommendation{
+			Category: CategoryNetworkPolicy,
+			Severity: "MEDIUM",
+			File:     file,
+			Resource: "Namespace/" + ns,
+			Issues:   []string{"no NetworkPolicy restricts traffic in namespace " + ns},
+			Patch:    defaultDenyPolicy(ns),
+		})
+	}
+
+	sort.SliceStable(out, func(i, j int) bool {
+		a, b := out[i], out[j]
+		if severityRank[a.Severity] != severityRank[b.Severity] {
+			return severityRank[a.Severity] < severityRank[b.Severity]
+		}
+		if a.File != b.File {
+			return a.File < b.File
+		}
+		return a.Line < b.Line
+	})
+	return out, nil
+}
+
+// resource identifies the document being reviewed.
+type resource struct {
+	file, kind, namespace, name string
+}
+
+func (r resource) String() string {
+	if r.kind == "ClusterRole" || r.kind == "ClusterRoleBinding" {
+		return r.kind + "/" + r.name
+	}
+	return r.kind + "/" + r.namespace + "/" + r.name
+}
+
+// recommend groups issues into a recommendation; nil without any.
+func recommend(category string, res resource, line int, container string, issues []issue) *Recommendation {
+	if len(issues) == 0 {
+		return nil
+	}
+	rec := &Recommendation{
+		Category:  category,
+		Severity:  "LOW",
+		File:      res.file,
+		Line:      line,
+		Resource:  res.String(),
+		Container: container,
+	}
+	var patch []string
+	for _, is := range issues {
+		if severityRank[is.severity] < severityRank[rec.Severity] {
+			rec.Severity = is.severity
+		}
+		rec.Issues = append(rec.Issues, is.text)
+		if is.patch != "" {
+			patch = append(patch, is.patch)
+		}
+	}
+	rec.Patch = strings.Join(patch, "\n")
+	return rec
+}
+
+// reviewPodSpec checks a pod spec and each of its containers.
+func reviewPodSpec(res resource, spec *yaml.Node) []Recommendation {
+	var out []Recommendation
+	var host []issue
+	for _, field := range []string{"hostNetwork", "hostPID", "hostIPC"} {
+		if scalar(get(spec, field)) == "true" {
+			host = append(host, issue{"HIGH", field + " shares the node's namespace with the pod", field + ": false"})
+		}
+	}
+	if scalar(get(spec, "automountServiceAccountToken")) != "false" {
+		host = append(host, issue{"LOW", "the service account token is mounted into every container", "automountServiceAccountToken: false"})
+	}
+	if rec := recommend(CategoryHostAccess, res, spec.Line, "", host); rec != nil {
+		out = append(out, *rec)
+	}
+
+	podNonRoot := scalar(get(spec, "securityContext", "runAsNonRoot")) == "true"
+	for _, key := range []string{"initContainers", "containers"} {
+		list := get(spec, key)
+		if list == nil || list.Kind != yaml.SequenceNode {
+			continue
+		}
+		for _, c := range list.Content {
+			name := scalar(get(c, "name"))
+			if rec := recommend(CategorySecurityContext, res, c.Line, name, securityContextIssues(c, podNonRoot)); rec != nil {
+				rec.Patch = "securityContext:\n" + indent(rec.Patch)
+				out = append(out, *rec)
+			}
+			if rec := recommend(CategoryResources, res, c.Line, name, resourceIssues(c)); rec != nil {
+				rec.Patch = "resources:\n" + indent(rec.Patch)
+				out = append(out, *rec)
+			}
+		}
+	}
+	return out
+}
+
+func securityContextIssues(c *yaml.Node, podNonRoot bool) []issue {
+	var out []issue
+	sc := get(c, "securityContext")
+	if scalar(get(sc, "privileged")) == "true" {
+		out = append(out, issue{"HIGH", "the container runs privileged", "privileged: false"})
+	}
+	if nonRoot := scalar(get(sc, "runAsNonRoot")); nonRoot != "true" && (nonRoot == "false" || !podNonRoot) {
+		out = append(out, issue{"MEDIUM", "the container may run as root", "runAsNonRoot: true"})
+	}
+	if scalar(get(sc, "allowPrivilegeEscalation")) != "false" {
+		out = append(out, issue{"MEDIUM", "privilege escalation is allowed", "allowPrivilegeEscalation: false"})
+	}
+	if !slices.Contains(scalars(get(sc, "capabilities", "drop")), "ALL") {
+		out = append(out, issue{"MEDIUM", "Linux capabilities are not dropped", "capabilities:\n  drop: [\"ALL\"]"})
+	}
+	if scalar(get(sc, "readOnlyRootFilesystem")) != "true" {
+		out = append(out, issue{"LOW", "the root filesystem is writable", "readOnlyRootFilesystem: true"})
+	}
+	return out
+}
+
+// resourceIssues asks for limits and requests; the patch values are
+// placeholders to size from the workload's real usage.
+func resourceIssues(c *yaml.Node) []issue {
+	var out []issue
+	var limits, requests []string
+	for _, r := range []string{"cpu", "memory"} {
+		if get(c, "resources", "limits", r) == nil {
+			limits = append(limits, r)
+		}
+		if get(c, "resources", "requests", r) == nil {
+			requests = append(requests, r)
+		}
+	}
+	if len(limits) > 0 {
+		out = append(out, issue{"MEDIUM", "no " + strings.Join(limits, " or ") + " limit, so one container can starve the node",
+			"limits:\n" + resourceValues(limits, "500m", "512Mi")})
+	}
+	if len(requests) > 0 {
+		out = append(out, issue{"LOW", "no " + strings.Join(requests, " or ") + " request for the scheduler to place the pod by",
+			"requests:\n" + resourceValues(requests, "100m", "128Mi")})
+	}
+	return out
+}
+
+func resourceValues(names []string, cpu, memory string) string {
+	var b strings.Builder
+	for _, n := range names {
+		v := cpu
+		if n == "memory" {
+			v = memory
+		}
+		fmt.Fprintf(&b, "  %s: %s\n", n, v)
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// reviewRole flags wildcard grants and read access to secrets.
+func reviewRole(res resource, doc *yaml.Node) []Recommendation {
+	rules := get(doc, "rules")
+	if rules == nil || rules.Kind != yaml.SequenceNode {
+		return nil
+	}
+	var out []Recommendation
+	for i, rule := range rules.Content {
+		var issues []issue
+		for _, field := range []string{"apiGroups", "resources", "verbs"} {
+			if slices.Contains(scalars(get(rule, field)), "*") {
+				issues = append(issues, issue{"HIGH", fmt.Sprintf("rule %d grants every %s", i+1, strings.ToLower(strings.TrimSuffix(field, "s"))),
+					fmt.Sprintf("%s: [] # list the %s the workload needs", field, field)})
+			}
+		}
+		verbs := scalars(get(rule, "verbs"))
+		if slices.Contains(scalars(get(rule, "resources")), "secrets") && slices.ContainsFunc(verbs, func(v string) bool {
+			return v == "get" || v == "list" || v == "watch"
+		}) {
+			issues = append(issues, issue{"MEDIUM", fmt.Sprintf("rule %d reads secrets", i+1),
+				"resourceNames: [] # name the secrets the workload reads"})
+		}
+		if rec := recommend(CategoryRBAC, res, rule.Line, "", issues); rec != nil {
+			out = append(out, *rec)
+		}
+	}
+	return out
+}
+
+// reviewBinding flags bindings of cluster-admin.
+func reviewBinding(res resource, doc *yaml.Node) []Recommendation {
+	ref := get(doc, "roleRef")
+	if scalar(get(ref, "name")) != "cluster-admin" {
+		return nil
+	}
+	rec := recommend(CategoryRBAC, res, ref.Line, "", []issue{{
+		"HIGH", "binds cluster-admin, which grants everything in every namespace",
+		"roleRef:\n  apiGroup: rbac.authorization.k8s.io\n  kind: ClusterRole # or a Role, bound by a RoleBinding in one namespace\n  name: <role with only the rules the subjects need>",
+	}})
+	return []Recommendation{*rec}
+}
+
+func defaultDenyPolicy(ns string) string {
+	return fmt.Sprintf(`apiVersion: networking.k8s.io/v1
+kind: NetworkPolicy
+metadata:
+  name: default-deny
+  namespace: %s
+spec:
+  podSelector: {}
+  policyTypes: ["Ingress", "Egress"]`, ns)
+}
+
+// decode parses a stream of YAML documents.
+func decode(data []byte) ([]*yaml.Node, error) {
+	var docs []*yaml.Node
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	for {
+		var doc yaml.Node
+		err := dec.Decode(&doc)
+		if errors.Is(err, io.EOF) {
+			return docs, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(doc.Content) == 0 {
+			continue
+		}
+		root := doc.Content[0]
+		if items := get(root, "items"); items != nil && items.Kind == yaml.SequenceNode {
+			docs = append(docs, items.Content...)
+			continue
+		}
+		docs = append(docs, root)
+	}
+}
+
+// get follows keys through nested mappings; nil when one is missing.
+func get(n *yaml.Node, keys ...string) *yaml.Node {
+	for _, key := range keys {
+		if n == nil || n.Kind != yaml.MappingNode {
+			return nil
+		}
+		var next *yaml.Node
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			if n.Content[i].Value == key {
+				next = n.Content[i+1]
+				break
+			}
+		}
+		n = next
+	}
+	return n
+}
+
+func scalar(n *yaml.Node) string {
+	if n == nil || n.Kind != yaml.ScalarNode {
+		return ""
+	}
+	return n.Value
+}
+
+func scalars(n *yaml.Node) []string {
+	if n == nil || n.Kind != yaml.SequenceNode {
+		return nil
+	}
+	out := make([]string, 0, len(n.Content))
+	for _, c := range n.Content {
+		out = append(out, scalar(c))
+	}
+	return out
+}
+
+func indent(s string) string {
+	return "  " + strings.ReplaceAll(s, "\n", "\n  ")
+}
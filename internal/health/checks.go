@@ -0,0 +1,67 @@
+package health
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"time"
+	"weeklysec/internal/llm"
+	"weeklysec/internal/trivy"
+)
+
+// Trivy verifies the binary is installed and, when maxDBAge is positive, that
+// its vulnerability DB was updated within maxDBAge.
+func Trivy(maxDBAge time.Duration) CheckFunc {
+	return func(ctx context.Context) (any, error) {
+		if names := trivy.Fixtures(); names != nil {
+			return details{"synthetic": true, "fixtures": len(names)}, nil
+		}
+		path, err := exec.LookPath(trivy.Binary())
+		if err != nil {
+			return nil, fmt.Errorf("trivy binary not found: %s", trivy.Binary())
+		}
+
+		info, err := trivy.Version(ctx)
+		if err != nil {
+			return details{"path": path}, err
+		}
+
+		d := details{"path": path, "version": info.Version}
+		if info.VulnerabilityDB == nil || info.VulnerabilityDB.UpdatedAt.IsZero() {
+			if maxDBAge > 0 {
+				return d, fmt.Errorf("vulnerability DB has not been downloaded")
+			}
+			return d, nil
+		}
+
+		age := time.Since(info.VulnerabilityDB.UpdatedAt)
+		d["db_updated_at"] = info.VulnerabilityDB.UpdatedAt
+		d["db_age"] = age.Round(time.Minute).String()
+		if maxDBAge > 0 && age > maxDBAge {
+			return d, fmt.Errorf("vulnerability DB is older than %s", maxDBAge)
+		}
+		return d, nil
+	}
+}
+
+// Pinger is implemented by dependencies that can report their own health.
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// Ping adapts a Pinger to a CheckFunc.
+func Ping(p Pinger) CheckFunc {
+	return func(ctx context.Context) (any, error) {
+		return nil, p.Ping(ctx)
+	}
+}
+
+// LLM verifies the LLM provider is configured and reachable.
+func LLM() CheckFunc {
+	return func(ctx context.Context) (any, error) {
+		return nil, llm.Ping(ctx)
+	}
+}
+
+// details is the free-form detail map reported by a check.
+type details = map[string]any
@@ -0,0 +1,119 @@
+package health
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Status values.
+const (
+	StatusOK   = "ok"
+	StatusFail = "fail"
+)
+
+// CheckFunc probes one dependency. Details are reported alongside the status
+// and may be nil.
+type CheckFunc func(ctx context.Context) (details any, err error)
+
+// Result is the outcome of one check.
+type Result struct {
+	Status   string `json:"status"`
+	Optional bool   `json:"optional,omitempty"`
+	Details  any    `json:"details,omitempty"`
+	Error    string `json:"error,omitempty"`
+	Duration string `json:"duration"`
+}
+
+// Report is the outcome of all checks.
+type Report struct {
+	Status string            `json:"status"`
+	Checks map[string]Result `json:"checks"`
+}
+
+type check struct {
+	name     string
+	fn       CheckFunc
+	optional bool
+}
+
+// Checker runs registered dependency checks concurrently.
+type Checker struct {
+	timeout time.Duration
+	checks  []check
+}
+
+func NewChecker(timeout time.Duration) *Checker {
+	return &Checker{timeout: timeout}
+}
+
+// Register adds a check whose failure makes the service not ready.
+func (c *Checker) Register(name string, fn CheckFunc) {
+	c.checks = append(c.checks, check{name: name, fn: fn})
+}
+
+// RegisterOptional adds a check that is reported but never fails readiness.
+func (c *Checker) RegisterOptional(name string, fn CheckFunc) {
+	c.checks = append(c.checks, check{name: name, fn: fn, optional: true})
+}
+
+// Run executes every check and aggregates the results.
+func (c *Checker) Run(ctx context.Context) Report {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	report := Report{Status: StatusOK, Checks: make(map[string]Result, len(c.checks))}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, chk := range c.checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			start := time.Now()
+			details, err := chk.fn(ctx)
+			res := Result{
+				Status:   StatusOK,
+				Optional: chk.optional,
+				Details:  details,
+				Duration: time.Since(start).Round(time.Millisecond).String(),
+			}
+			if err != nil {
+				res.Status = StatusFail
+				res.Error = err.Error()
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			report.Checks[chk.name] = res
+			if err != nil && !chk.optional {
+				report.Status = StatusFail
+			}
+		}()
+	}
+	wg.Wait()
+
+	return report
+}
+
+// Cached wraps fn so its result is reused for ttl. Useful for checks that
+// fork processes or call external services.
+func Cached(ttl time.Duration, fn CheckFunc) CheckFunc {
+	var (
+		mu      sync.Mutex
+		at      time.Time
+		details any
+		err     error
+	)
+	return func(ctx context.Context) (any, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if !at.IsZero() && time.Since(at) < ttl {
+			return details, err
+		}
+		details, err = fn(ctx)
+		at = time.Now()
+		return details, err
+	}
+}
@@ -0,0 +1,232 @@
+// Package i18n translates the fixed strings of reports: section headers,
+// labels and the short phrases between figures. What the LLM writes is
+// localized by the prompts instead (see llm.LoadPrompts).
+//
+// A locale is a JSON file named after its language tag, such as de.json or
+// pt-BR.json, mapping each English string to its translation. Strings with
+// verbs are fmt formats; a translation may reorder them with explicit
+// argument indexes such as %[2]d. Strings missing from a locale stay in
+// English, so a partial locale is usable as it grows.
+package i18n
+
+import (
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+//go:embed locales/*.json
+var builtin embed.FS
+
+// English is the language reports are written in.
+const English = "en"
+
+// Locale translates into one language. A nil Locale is English.
+type Locale struct {
+	Tag      string
+	messages map[string]string
+}
+
+// T returns the translation of msg, formatted with args if there are any.
+func (l *Locale) T(msg string, args ...any) string {
+	if l != nil {
+		if tr, ok := l.messages[msg]; ok {
+			msg = tr
+		}
+	}
+	if len(args) == 0 {
+		return msg
+	}
+	return fmt.Sprintf(msg, args...)
+}
+
+// Lang is the tag of l, for HTML lang attributes and Content-Language.
+func (l *Locale) Lang() string {
+	if l == nil {
+		return English
+	}
+	return l.Tag
+}
+
+// Catalog is a set of locales by tag, one of them the default.
+type Catalog struct {
+	locales  map[string]*Locale
+	fallback *Locale
+}
+
+// Builtin returns the catalog of the built-in locales, English by default.
+func Builtin() *Catalog {
+	en := &Locale{Tag: English, messages: map[string]string{}}
+	c := &Catalog{locales: map[string]*Locale{English: en}, fallback: en}
+	files, _ := fs.Glob(builtin, "locales/*.json")
+	for _, f := range files {
+		data, _ := builtin.ReadFile(f)
+		if err := c.add(path.Base(f), data); err != nil {
+			panic(err) // the embedded locales are fixed at build time
+		}
+	}
+	return c
+}
+
+// Load reads the locale files in dir over the built-in locales: a file of
+// a built-in tag overrides the strings it lists, any other adds a locale.
+func Load(dir string) (*Catalog, error) {
+	c := Builtin()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		if e.IsDir() || filepath.Ext(e.Name()) != ".json" {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		if err := c.add(e.Name(), data); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// add merges the locale file name into c.
+func (c *Catalog) add(name string, data []byte) error {
+	tag := canonical(strings.TrimSuffix(name, ".json"))
+	if tag == "" {
+		return fmt.Errorf("%s: file name is not a language tag", name)
+	}
+	var messages map[string]string
+	if err := json.Unmarshal(data, &messages); err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	var errs []error
+	for msg, tr := range messages {
+		if verbs(msg) != verbs(tr) {
+			errs = append(errs, fmt.Errorf("%s: %q has %d verbs, its translation %d", name, msg, verbs(msg), verbs(tr)))
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return err
+	}
+
+	l, ok := c.locales[tag]
+	if !ok {
+		l = &Locale{Tag: tag, messages: map[string]string{}}
+		c.locales[tag] = l
+	}
+	for msg, tr := range messages {
+		l.messages[msg] = tr
+	}
+	return nil
+}
+
+// Lookup returns the locale of tag, or of its language when there is none
+// for its region, and false when neither is known.
+func (c *Catalog) Lookup(tag string) (*Locale, bool) {
+	tag = canonical(tag)
+	if l, ok := c.locales[tag]; ok {
+		return l, true
+	}
+	lang, _, _ := strings.Cut(tag, "-")
+	l, ok := c.locales[lang]
+	return l, ok
+}
+
+// SetDefault makes the locale of tag the one Fallback returns.
+func (c *Catalog) SetDefault(tag string) error {
+	l, ok := c.Lookup(tag)
+	if !ok {
+		return fmt.Errorf("unknown locale %q, have %s", tag, strings.Join(c.Tags(), ", "))
+	}
+	c.fallback = l
+	return nil
+}
+
+// Fallback is the locale of reports nobody asked a language for.
+func (c *Catalog) Fallback() *Locale {
+	return c.fallback
+}
+
+// Match returns the first locale known for tags, in order of preference.
+func (c *Catalog) Match(tags ...string) (*Locale, bool) {
+	for _, tag := range tags {
+		if l, ok := c.Lookup(tag); ok {
+			return l, true
+		}
+	}
+	return nil, false
+}
+
+// Tags lists the tags of the locales in c.
+func (c *Catalog) Tags() []string {
+	tags := make([]string, 0, len(c.locales))
+	for tag := range c.locales {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+	return tags
+}
+
+// canonical normalizes a language tag, also taking POSIX locale names such
+// as de_DE.UTF-8. It returns "" for anything else.
+func canonical(tag string) string {
+	tag, _, _ = strings.Cut(tag, ".")
+	tag, _, _ = strings.Cut(tag, "@")
+	parts := strings.Split(strings.ReplaceAll(strings.TrimSpace(tag), "_", "-"), "-")
+	for i, p := range parts {
+		if p == "" || len(p) > 8 || strings.Trim(p, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789") != "" {
+			return ""
+		}
+		if i == 0 {
+			parts[i] = strings.ToLower(p)
+		} else if len(p) == 2 {
+			parts[i] = strings.ToUpper(p)
+		}
+	}
+	return strings.Join(parts, "-")
+}
+
+// verbs counts the formatting verbs of s.
+func verbs(s string) int {
+	n := 0
+	for i := 0; i < len(s); i++ {
+		if s[i] != '%' {
+			continue
+		}
+		if i+1 < len(s) && s[i+1] == '%' {
+			i++
+			continue
+		}
+		n++
+	}
+	return n
+}
+
+var (
+	currentMu sync.RWMutex
+	current   = Builtin()
+)
+
+// Set replaces the catalog used from now on.
+func Set(c *Catalog) {
+	currentMu.Lock()
+	defer currentMu.Unlock()
+	current = c
+}
+
+// Current returns the catalog in use.
+func Current() *Catalog {
+	currentMu.RLock()
+	defer currentMu.RUnlock()
+	return current
+}
@@ -0,0 +1,253 @@
+// Package impact finds the targets affected by a vulnerability from what
+// is already stored, their SBOMs and findings, so a newly published CVE can
+// be triaged without waiting for the next scan.
+package impact
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Component is a package listed in an SBOM.
+type Component struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+	PURL    string `json:"purl,omitempty"`
+}
+
+// Components returns the components of a CycloneDX JSON SBOM, nested ones
+// included.
+func Components(bom []byte) ([]Component, error) {
+	type component struct {
+		Name       string      `json:"name"`
+		Version    string      `json:"version"`
+		PURL       string      `json:"purl"`
+		Components []component `json:"components"`
+	}
+	var doc struct {
+		Components []component `json:"components"`
+	}
+	if err := json.Unmarshal(bom, &doc); err != nil {
+		return nil, fmt.Errorf("invalid CycloneDX SBOM: %w", err)
+	}
+
+	var out []Component
+	var walk func([]component)
+	walk = func(cs []component) {
+		for _, c := range cs {
+			if c.Name != "" {
+				out = append(out, Component{Name: c.Name, Version: c.Version, PURL: c.PURL})
+			}
+			walk(c.Components)
+		}
+	}
+	walk(doc.Components)
+	return out, nil
+}
+
+// Query describes the affected packages.
+type Query struct {
+	// Package is an exact name or glob; matched against the package
+	// names of findings and SBOM components.
+	Package string `json:"package"`
+
+	// Versions are the affected versions, each an exact version or a
+	// range of comparisons that must all hold, e.g. ">=2.0.0 <2.15.0".
+	// Empty matches every version.
+	Versions []string `json:"versions,omitempty"`
+}
+
+// Validate checks the query can be evaluated.
+func (q Query) Validate() error {
+	if _, err := path.Match(q.Package, ""); err != nil {
+		return fmt.Errorf("'package' is not a valid pattern: %v", err)
+	}
+	for _, r := range q.Versions {
+		if _, err := parseRange(r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Matches reports whether the package name at version is affected.
+func (q Query) Matches(name, version string) bool {
+	if q.Package == "" {
+		return false
+	}
+	if q.Package != name {
+		if ok, _ := path.Match(q.Package, name); !ok {
+			return false
+		}
+	}
+	if len(q.Versions) == 0 {
+		return true
+	}
+	for _, r := range q.Versions {
+		conds, err := parseRange(r)
+		if err == nil && conds.holds(version) {
+			return true
+		}
+	}
+	return false
+}
+
+type condition struct {
+	op      string
+	version string
+}
+
+type conditions []condition
+
+func (cs conditions) holds(version string) bool {
+	for _, c := range cs {
+		n := Compare(version, c.version)
+		var ok bool
+		switch c.op {
+		case "<":
+			ok = n < 0
+		case "<=":
+			ok = n <= 0
+		case ">":
+			ok = n > 0
+		case ">=":
+			ok = n >= 0
+		case "!=":
+			ok = n != 0
+		default:
+			ok = n == 0
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// parseRange parses comparisons separated by spaces or commas.
+func parseRange(r string) (conditions, error) {
+	var out conditions
+	for _, f := range strings.FieldsFunc(r, func(c rune) bool { return c == ',' || unicode.IsSpace(c) }) {
+		op := ""
+		for _, o := range []string{"<=", ">=", "!=", "==", "<", ">", "="} {
+			if strings.HasPrefix(f, o) {
+				op = o
+				break
+			}
+		}
+		v := strings.TrimPrefix(f, op)
+		if v == "" {
+			return nil, fmt.Errorf("'versions' has an incomplete range %q", r)
+		}
+		out = append(out, condition{op: op, version: v})
+	}
+	if len(out) == 0 {
+		return nil, fmt.Errorf("'versions' has an empty range")
+	}
+	return out, nil
+}
+
+// Compare orders two versions of the same package, returning -1, 0 or 1.
+// It compares runs of digits numerically and everything else as text,
+// which is close enough to the semantic, Debian, Alpine and RPM orderings
+// for matching affected ranges; an epoch ("1:") and a leading "v" are
+// honoured.
+func Compare(a, b string) int {
+	ea, a := epoch(a)
+	eb, b := epoch(b)
+	if ea != eb {
+		return cmpInt(ea, eb)
+	}
+	for a != "" || b != "" {
+		var sa, sb string
+		sa, a = segment(a)
+		sb, b = segment(b)
+		if n := compareSegment(sa, sb); n != 0 {
+			return n
+		}
+	}
+	return 0
+}
+
+func epoch(v string) (int, string) {
+	v = strings.TrimPrefix(strings.TrimSpace(v), "v")
+	if e, rest, ok := strings.Cut(v, ":"); ok {
+		if n, err := strconv.Atoi(e); err == nil {
+			return n, rest
+		}
+	}
+	return 0, v
+}
+
+// segment splits off the leading run of digits or of letters, skipping
+// separators.
+func segment(v string) (string, string) {
+	v = strings.TrimLeftFunc(v, func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsDigit(r) })
+	if v == "" {
+		return "", ""
+	}
+	digit := unicode.IsDigit(rune(v[0]))
+	i := strings.IndexFunc(v, func(r rune) bool {
+		return unicode.IsDigit(r) != digit || !(unicode.IsLetter(r) || unicode.IsDigit(r))
+	})
+	if i < 0 {
+		return v, ""
+	}
+	return v[:i], v[i:]
+}
+
+func compareSegment(a, b string) int {
+	switch {
+	case a == b:
+		return 0
+	case a == "":
+		// 1.0 < 1.0.1 and 1.1.1 < 1.1.1k, but 1.0 > 1.0rc1.
+		if preRelease[strings.ToLower(b)] {
+			return 1
+		}
+		return -1
+	case b == "":
+		return -compareSegment(b, a)
+	}
+	if isDigits(a) && isDigits(b) {
+		a, b = strings.TrimLeft(a, "0"), strings.TrimLeft(b, "0")
+		if len(a) != len(b) {
+			return cmpInt(len(a), len(b))
+		}
+		return strings.Compare(a, b)
+	}
+	// Numbers sort after letters: 1.0rc1 < 1.0.1.
+	if isDigits(a) != isDigits(b) {
+		if isDigits(a) {
+			return 1
+		}
+		return -1
+	}
+	return strings.Compare(a, b)
+}
+
+// preRelease are the suffixes that mark a version before the release,
+// rather than a patch level after it as in OpenSSL's 1.1.1k or Alpine's
+// -r0.
+var preRelease = map[string]bool{
+	"alpha": true, "beta": true, "rc": true, "pre": true, "preview": true,
+	"dev": true, "snapshot": true,
+}
+
+func isDigits(s string) bool {
+	return s != "" && strings.IndexFunc(s, func(r rune) bool { return !unicode.IsDigit(r) }) < 0
+}
+
+func cmpInt(a, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,63 @@
+// Package jira creates and updates Jira issues through the REST API (v2).
+package jira
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"weeklysec/internal/errcode"
+	"weeklysec/internal/jsonapi"
+)
+
+// Client calls one Jira site. With a user it authenticates with basic auth
+// (Jira Cloud email and API token), otherwise with a bearer personal access
+// token (Jira Server and Data Center).
+type Client struct {
+	baseURL string
+	api     *jsonapi.Client
+}
+
+// New returns a client for the Jira site at baseURL.
+func New(baseURL, user, token string) *Client {
+	api := jsonapi.New("jira", errcode.JiraError, baseURL)
+	api.Header = jsonapi.Auth(user, token, token)
+	api.Message = message
+	return &Client{baseURL: api.BaseURL, api: api}
+}
+
+// message joins the messages of a Jira error response.
+func message(body []byte) string {
+	var apiErr struct {
+		ErrorMessages []string          `json:"errorMessages"`
+		Errors        map[string]string `json:"errors"`
+	}
+	_ = json.Unmarshal(body, &apiErr)
+	msgs := apiErr.ErrorMessages
+	for field, msg := range apiErr.Errors {
+		msgs = append(msgs, field+": "+msg)
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// BrowseURL returns the web URL of the issue with the given key.
+func (c *Client) BrowseURL(key string) string {
+	return c.baseURL + "/browse/" + url.PathEscape(key)
+}
+
+// CreateIssue creates an issue from its fields and returns its key.
+func (c *Client) CreateIssue(ctx context.Context, fields map[string]any) (string, error) {
+	var out struct {
+		Key string `json:"key"`
+	}
+	if err := c.api.Do(ctx, http.MethodPost, "/rest/api/2/issue", map[string]any{"fields": fields}, &out); err != nil {
+		return "", err
+	}
+	return out.Key, nil
+}
+
+// UpdateIssue sets fields of an existing issue.
+func (c *Client) UpdateIssue(ctx context.Context, key string, fields map[string]any) error {
+	return c.api.Do(ctx, http.MethodPut, "/rest/api/2/issue/"+url.PathEscape(key), map[string]any{"fields": fields}, nil)
+}
@@ -0,0 +1,553 @@
+// Package jobs queues background scans in Redis so every replica of an HA
+// deployment takes its share of them. A job stays in Redis until a worker
+// finishes it: jobs held by a replica that stopped are handed to the
+// others, failed jobs are retried with backoff, and jobs that keep failing
+// are moved to a dead-letter list for an operator to retry or discard.
+package jobs
+
+import (
+	"cmp"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"sync/atomic"
+	"time"
+	"weeklysec/internal/errcode"
+	"weeklysec/internal/queue"
+	"weeklysec/internal/requestid"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// leaseTTL is how long a replica's jobs stay claimed after its last
+	// heartbeat.
+	leaseTTL = 30 * time.Second
+	// pollInterval spaces out checks of empty queues.
+	pollInterval = time.Second
+	// keyTTL bounds how long a duplicate key is held, in case the job
+	// holding it is lost.
+	keyTTL = 24 * time.Hour
+	// maxDead caps the dead-letter list; the oldest entries go first.
+	maxDead = 1000
+	// maxBackoff caps the delay between attempts.
+	maxBackoff = time.Hour
+)
+
+// ErrNotFound is returned for a dead-letter job that does not exist.
+var ErrNotFound = errcode.New(errcode.NotFound, "job not found")
+
+// Job is a unit of background work. Payload is up to the handler of Kind.
+type Job struct {
+	ID         string          `json:"id"`
+	Kind       string          `json:"kind"`
+	Key        string          `json:"key,omitempty"`  // duplicates of a queued job with the same key are dropped
+	Once       bool            `json:"once,omitempty"` // the key outlives the job; see EnqueueOnce
+	Priority   queue.Priority  `json:"priority"`
+	Payload    json.RawMessage `json:"payload,omitempty"`
+	RequestID  string          `json:"request_id,omitempty"`
+	Attempts   int             `json:"attempts"`
+	LastError  string          `json:"last_error,omitempty"`
+	EnqueuedAt time.Time       `json:"enqueued_at"`
+	FailedAt   *time.Time      `json:"failed_at,omitempty"`
+}
+
+// Handler runs a job. An error retries it unless it is Permanent.
+type Handler func(ctx context.Context, j Job) error
+
+type permanentError struct{ err error }
+
+func (e permanentError) Error() string { return e.err.Error() }
+func (e permanentError) Unwrap() error { return e.err }
+
+// Permanent marks err as one retrying cannot fix, so the job goes straight
+// to the dead-letter list.
+func Permanent(err error) error {
+	return permanentError{err}
+}
+
+// Options configures a Queue.
+type Options struct {
+	URL          string // redis://[user:password@]host:port/db
+	Prefix       string // namespaces the keys; defaults to "weeklysec"
+	MaxAttempts  int    // runs before a job is dead-lettered; defaults to 3
+	RetryBackoff time.Duration
+	Consumer     string // names this replica; defaults to the hostname and a random suffix
+}
+
+// Queue is a job queue shared through Redis.
+type Queue struct {
+	rdb          *redis.Client
+	prefix       string
+	consumer     string
+	maxAttempts  int
+	retryBackoff time.Duration
+
+	completed atomic.Int64
+	retried   atomic.Int64
+	dead      atomic.Int64
+}
+
+// Open connects to Redis and checks that it answers.
+func Open(ctx context.Context, opts Options) (*Queue, error) {
+	ro, err := redis.ParseURL(opts.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid REDIS_URL: %w", err)
+	}
+	rdb := redis.NewClient(ro)
+	if err := rdb.Ping(ctx).Err(); err != nil {
+		rdb.Close()
+		return nil, fmt.Errorf("failed to reach redis: %w", err)
+	}
+	consumer := opts.Consumer
+	if consumer == "" {
+		host, _ := os.Hostname()
+		consumer = cmp.Or(host, "weeklysec") + "-" + randomID(4)
+	}
+	return &Queue{
+		rdb:          rdb,
+		prefix:       cmp.Or(opts.Prefix, "weeklysec") + ":jobs:",
+		consumer:     consumer,
+		maxAttempts:  max(opts.MaxAttempts, 1),
+		retryBackoff: cmp.Or(opts.RetryBackoff, time.Minute),
+	}, nil
+}
+
+// Close disconnects from Redis.
+func (q *Queue) Close() error {
+	return q.rdb.Close()
+}
+
+func (q *Queue) readyKey(p queue.Priority) string { return q.prefix + "ready:" + strconv.Itoa(int(p)) }
+func (q *Queue) delayedKey(p queue.Priority) string {
+	return q.prefix + "delayed:" + strconv.Itoa(int(p))
+}
+func (q *Queue) processingKey(c string) string { return q.prefix + "processing:" + c }
+func (q *Queue) aliveKey(c string) string      { return q.prefix + "alive:" + c }
+func (q *Queue) dedupeKey(k string) string     { return q.prefix + "key:" + k }
+func (q *Queue) consumersKey() string          { return q.prefix + "consumers" }
+func (q *Queue) deadKey() string               { return q.prefix + "dead" }
+
+// enqueueScript pushes a job unless its key is already held.
+var enqueueScript = redis.NewScript(`
+if ARGV[2] ~= '' and not redis.call('SET', KEYS[2], ARGV[2], 'NX', 'EX', ARGV[3]) then
+  return 0
+end
+redis.call('LPUSH', KEYS[1], ARGV[1])
+return 1
+`)
+
+// Enqueue queues j and reports whether it was added, which it is not when
+// a job with the same key is still queued or running.
+func (q *Queue) Enqueue(ctx context.Context, j Job) (bool, error) {
+	j.Once = false
+	return q.enqueue(ctx, j, keyTTL)
+}
+
+// EnqueueOnce queues j unless a job with the same key was queued within
+// window, finished or not. Replicas firing the same schedule use it to
+// queue a single scan between them.
+func (q *Queue) EnqueueOnce(ctx context.Context, j Job, window time.Duration) (bool, error) {
+	j.Once = true
+	return q.enqueue(ctx, j, window)
+}
+
+func (q *Queue) enqueue(ctx context.Context, j Job, ttl time.Duration) (bool, error) {
+	if j.ID == "" {
+		j.ID = randomID(12)
+	}
+	if j.RequestID == "" {
+		j.RequestID = requestid.FromContext(ctx)
+	}
+	j.EnqueuedAt = time.Now().UTC()
+	j.Attempts, j.LastError, j.FailedAt = 0, "", nil
+	raw, err := json.Marshal(j)
+	if err != nil {
+		return false, err
+	}
+	key := ""
+	if j.Key != "" {
+		key = j.ID
+	}
+	added, err := enqueueScript.Run(ctx, q.rdb,
+		[]string{q.readyKey(j.Priority), q.dedupeKey(j.Key)},
+		raw, key, max(int(ttl.Seconds()), 1)).Int()
+	if err != nil {
+		return false, fmt.Errorf("failed to queue job: %w", err)
+	}
+	return added == 1, nil
+}
+
+// Start runs workers that take jobs from Redis and pass them to handle, most
+// urgent first, and keeps this replica's claim on its jobs alive, until stop
+// is closed.
+func (q *Queue) Start(workers int, handle Handler, stop <-chan struct{}) {
+	q.heartbeat(context.Background())
+	go q.maintain(stop)
+	for range max(workers, 1) {
+		go q.work(handle, stop)
+	}
+	log.Info().Str("consumer", q.consumer).Int("workers", max(workers, 1)).Msg("Job queue workers started")
+}
+
+func (q *Queue) work(handle Handler, stop <-chan struct{}) {
+	ctx := context.Background()
+	for {
+		select {
+		case <-stop:
+			return
+		default:
+		}
+		raw, err := q.claim(ctx)
+		if err != nil {
+			log.Warn().Err(err).Msg("Failed to take a job from the queue")
+		}
+		if raw == "" {
+			select {
+			case <-stop:
+				return
+			case <-time.After(pollInterval):
+			}
+			continue
+		}
+		q.process(ctx, raw, handle)
+	}
+}
+
+// claim moves the most urgent ready job to this replica's processing list
+// and returns it, or "" when every queue is empty.
+func (q *Queue) claim(ctx context.Context) (string, error) {
+	for p := queue.PriorityInteractive; p <= queue.PriorityScheduled; p++ {
+		raw, err := q.rdb.LMove(ctx, q.readyKey(p), q.processingKey(q.consumer), "RIGHT", "LEFT").Result()
+		if errors.Is(err, redis.Nil) {
+			continue
+		}
+		return raw, err
+	}
+	return "", nil
+}
+
+func (q *Queue) process(ctx context.Context, raw string, handle Handler) {
+	var j Job
+	if err := json.Unmarshal([]byte(raw), &j); err != nil {
+		log.Error().Err(err).Msg("Dropping malformed job")
+		q.rdb.LRem(ctx, q.processingKey(q.consumer), 1, raw)
+		return
+	}
+
+	id := cmp.Or(j.RequestID, requestid.New())
+	logger := log.With().Str("request_id", id).Str("job_id", j.ID).Str("kind", j.Kind).Int("attempt", j.Attempts+1).Logger()
+	jctx := queue.WithPriority(logger.WithContext(requestid.NewContext(context.Background(), id)), j.Priority)
+
+	err := handle(jctx, j)
+	if err == nil {
+		q.finish(ctx, raw, j, &logger)
+		return
+	}
+	q.fail(ctx, raw, j, err, &logger)
+}
+
+func (q *Queue) finish(ctx context.Context, raw string, j Job, logger *zerolog.Logger) {
+	_, err := q.rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.LRem(ctx, q.processingKey(q.consumer), 1, raw)
+		if j.Key != "" && !j.Once {
+			pipe.Del(ctx, q.dedupeKey(j.Key))
+		}
+		return nil
+	})
+	if err != nil {
+		logger.Warn().Err(err).Msg("Failed to mark job done; it may run again")
+		return
+	}
+	q.completed.Add(1)
+}
+
+// fail schedules another attempt of j after a backoff that doubles each
+// time, or dead-letters it once it is out of attempts.
+func (q *Queue) fail(ctx context.Context, raw string, j Job, jobErr error, logger *zerolog.Logger) {
+	j.Attempts++
+	j.LastError = jobErr.Error()
+	var perm permanentError
+	dead := errors.As(jobErr, &perm) || j.Attempts >= q.maxAttempts
+
+	var delay time.Duration
+	if dead {
+		now := time.Now().UTC()
+		j.FailedAt = &now
+	} else {
+		delay = min(q.retryBackoff<<(j.Attempts-1), maxBackoff)
+	}
+	next, err := json.Marshal(j)
+	if err != nil {
+		logger.Error().Err(err).Msg("Failed to encode job")
+		return
+	}
+
+	_, err = q.rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.LRem(ctx, q.processingKey(q.consumer), 1, raw)
+		if dead {
+			pipe.LPush(ctx, q.deadKey(), next)
+			pipe.LTrim(ctx, q.deadKey(), 0, maxDead-1)
+			if j.Key != "" && !j.Once {
+				pipe.Del(ctx, q.dedupeKey(j.Key))
+			}
+			return nil
+		}
+		pipe.ZAdd(ctx, q.delayedKey(j.Priority), redis.Z{
+			Score:  float64(time.Now().Add(delay).UnixMilli()),
+			Member: next,
+		})
+		return nil
+	})
+	if err != nil {
+		logger.Error().Err(err).AnErr("job_error", jobErr).Msg("Failed to record job failure; it may run again")
+		return
+	}
+	if dead {
+		q.dead.Add(1)
+		logger.Warn().Err(jobErr).Msg("Job failed for good; moved to the dead-letter queue")
+		return
+	}
+	q.retried.Add(1)
+	logger.Warn().Err(jobErr).Dur("retry_in", delay).Msg("Job failed; retrying")
+}
+
+// promoteScript moves delayed jobs that are due back to their ready list.
+var promoteScript = redis.NewScript(`
+local due = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', ARGV[1], 'LIMIT', 0, 100)
+for _, raw in ipairs(due) do
+  redis.call('ZREM', KEYS[1], raw)
+  redis.call('LPUSH', KEYS[2], raw)
+end
+return #due
+`)
+
+// recoverScript hands the jobs of a replica that stopped back to the
+// queue, counting the interrupted run as an attempt so a job that keeps
+// killing its worker ends up dead-lettered.
+var recoverScript = redis.NewScript(`
+local n = 0
+while true do
+  local raw = redis.call('RPOP', KEYS[1])
+  if not raw then break end
+  local j = cjson.decode(raw)
+  j.attempts = (j.attempts or 0) + 1
+  j.last_error = 'worker stopped before finishing the job'
+  if j.attempts >= tonumber(ARGV[3]) then
+    j.failed_at = ARGV[5]
+    redis.call('LPUSH', KEYS[3], cjson.encode(j))
+    redis.call('LTRIM', KEYS[3], 0, tonumber(ARGV[4]) - 1)
+    if j.key and not j.once then
+      redis.call('DEL', ARGV[6] .. j.key)
+    end
+  else
+    redis.call('LPUSH', ARGV[2] .. string.format('%d', j.priority), cjson.encode(j))
+  end
+  n = n + 1
+end
+redis.call('SREM', KEYS[2], ARGV[1])
+return n
+`)
+
+// maintain keeps this replica's lease alive, promotes delayed jobs and
+// recovers the jobs of replicas whose lease ran out.
+func (q *Queue) maintain(stop <-chan struct{}) {
+	ctx := context.Background()
+	promote := time.NewTicker(pollInterval)
+	defer promote.Stop()
+	beat := time.NewTicker(leaseTTL / 3)
+	defer beat.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-promote.C:
+			q.promote(ctx)
+		case <-beat.C:
+			q.heartbeat(ctx)
+			q.recover(ctx)
+		}
+	}
+}
+
+func (q *Queue) heartbeat(ctx context.Context) {
+	_, err := q.rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, q.aliveKey(q.consumer), time.Now().UTC().Format(time.RFC3339), leaseTTL)
+		pipe.SAdd(ctx, q.consumersKey(), q.consumer)
+		return nil
+	})
+	if err != nil {
+		log.Warn().Err(err).Msg("Failed to renew the job queue lease")
+	}
+}
+
+func (q *Queue) promote(ctx context.Context) {
+	now := strconv.FormatInt(time.Now().UnixMilli(), 10)
+	for p := queue.PriorityInteractive; p <= queue.PriorityScheduled; p++ {
+		if err := promoteScript.Run(ctx, q.rdb, []string{q.delayedKey(p), q.readyKey(p)}, now).Err(); err != nil {
+			log.Warn().Err(err).Msg("Failed to promote delayed jobs")
+			return
+		}
+	}
+}
+
+func (q *Queue) recover(ctx context.Context) {
+	consumers, err := q.rdb.SMembers(ctx, q.consumersKey()).Result()
+	if err != nil {
+		log.Warn().Err(err).Msg("Failed to list job queue consumers")
+		return
+	}
+	for _, c := range consumers {
+		if c == q.consumer {
+			continue
+		}
+		if alive, err := q.rdb.Exists(ctx, q.aliveKey(c)).Result(); err != nil || alive > 0 {
+			continue
+		}
+		n, err := recoverScript.Run(ctx, q.rdb,
+			[]string{q.processingKey(c), q.consumersKey(), q.deadKey()},
+			c, q.prefix+"ready:", q.maxAttempts, maxDead, time.Now().UTC().Format(time.RFC3339), q.prefix+"key:").Int()
+		if err != nil {
+			log.Warn().Err(err).Str("consumer", c).Msg("Failed to recover jobs of a stopped replica")
+			continue
+		}
+		if n > 0 {
+			log.Info().Str("consumer", c).Int("jobs", n).Msg("Recovered jobs of a stopped replica")
+		}
+	}
+}
+
+// Dead lists up to limit dead-lettered jobs, most recent first.
+func (q *Queue) Dead(ctx context.Context, limit int) ([]Job, error) {
+	if limit <= 0 || limit > maxDead {
+		limit = maxDead
+	}
+	raws, err := q.rdb.LRange(ctx, q.deadKey(), 0, int64(limit-1)).Result()
+	if err != nil {
+		return nil, err
+	}
+	jobs := make([]Job, 0, len(raws))
+	for _, raw := range raws {
+		var j Job
+		if err := json.Unmarshal([]byte(raw), &j); err == nil {
+			jobs = append(jobs, j)
+		}
+	}
+	return jobs, nil
+}
+
+// Retry moves a dead-lettered job back to the queue with fresh attempts.
+// It no longer holds its key, so it runs even if a duplicate was queued
+// since.
+func (q *Queue) Retry(ctx context.Context, id string) (Job, error) {
+	raw, j, err := q.findDead(ctx, id)
+	if err != nil {
+		return j, err
+	}
+	j.Key, j.Once, j.Attempts, j.FailedAt = "", false, 0, nil
+	next, err := json.Marshal(j)
+	if err != nil {
+		return j, err
+	}
+	_, err = q.rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.LRem(ctx, q.deadKey(), 1, raw)
+		pipe.LPush(ctx, q.readyKey(j.Priority), next)
+		return nil
+	})
+	return j, err
+}
+
+// Discard removes a dead-lettered job.
+func (q *Queue) Discard(ctx context.Context, id string) error {
+	raw, _, err := q.findDead(ctx, id)
+	if err != nil {
+		return err
+	}
+	return q.rdb.LRem(ctx, q.deadKey(), 1, raw).Err()
+}
+
+func (q *Queue) findDead(ctx context.Context, id string) (string, Job, error) {
+	raws, err := q.rdb.LRange(ctx, q.deadKey(), 0, -1).Result()
+	if err != nil {
+		return "", Job{}, err
+	}
+	for _, raw := range raws {
+		var j Job
+		if json.Unmarshal([]byte(raw), &j) == nil && j.ID == id {
+			return raw, j, nil
+		}
+	}
+	return "", Job{}, ErrNotFound
+}
+
+// Stats is a snapshot of the shared queue. Counts cover every replica;
+// the totals only this one since it started.
+type Stats struct {
+	Backend    string           `json:"backend"`
+	Consumer   string           `json:"consumer"`
+	Consumers  int64            `json:"consumers"`
+	Ready      int64            `json:"ready"`
+	ByPriority map[string]int64 `json:"ready_by_priority"`
+	Delayed    int64            `json:"delayed"` // waiting to be retried
+	Processing int64            `json:"processing"`
+	Dead       int64            `json:"dead"`
+	Completed  int64            `json:"completed"`
+	Retried    int64            `json:"retried"`
+	DeadLocal  int64            `json:"dead_lettered"`
+}
+
+// Stats reads the queue lengths from Redis.
+func (q *Queue) Stats(ctx context.Context) (Stats, error) {
+	s := Stats{
+		Backend:    "redis",
+		Consumer:   q.consumer,
+		ByPriority: make(map[string]int64),
+		Completed:  q.completed.Load(),
+		Retried:    q.retried.Load(),
+		DeadLocal:  q.dead.Load(),
+	}
+	consumers, err := q.rdb.SMembers(ctx, q.consumersKey()).Result()
+	if err != nil {
+		return s, err
+	}
+	s.Consumers = int64(len(consumers))
+
+	pipe := q.rdb.Pipeline()
+	var ready, delayed [queue.PriorityScheduled + 1]*redis.IntCmd
+	for p := queue.PriorityInteractive; p <= queue.PriorityScheduled; p++ {
+		ready[p] = pipe.LLen(ctx, q.readyKey(p))
+		delayed[p] = pipe.ZCard(ctx, q.delayedKey(p))
+	}
+	processing := make([]*redis.IntCmd, len(consumers))
+	for i, c := range consumers {
+		processing[i] = pipe.LLen(ctx, q.processingKey(c))
+	}
+	dead := pipe.LLen(ctx, q.deadKey())
+	if _, err := pipe.Exec(ctx); err != nil {
+		return s, err
+	}
+	for p := range ready {
+		n := ready[p].Val()
+		s.ByPriority[queue.Priority(p).String()] = n
+		s.Ready += n
+		s.Delayed += delayed[p].Val()
+	}
+	for _, cmd := range processing {
+		s.Processing += cmd.Val()
+	}
+	s.Dead = dead.Val()
+	return s, nil
+}
+
+func randomID(n int) string {
+	b := make([]byte, n)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,278 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+	"weeklysec/internal/queue"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func openTestQueue(t *testing.T, opts Options) (*Queue, *miniredis.Miniredis) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	opts.URL = "redis://" + mr.Addr()
+	if opts.Consumer == "" {
+		opts.Consumer = "replica-a"
+	}
+	q, err := Open(context.Background(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { q.Close() })
+	return q, mr
+}
+
+// runOne claims the next job and runs it through handle, failing the test
+// when there is none.
+func runOne(t *testing.T, q *Queue, handle Handler) {
+	t.Helper()
+	ctx := context.Background()
+	raw, err := q.claim(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if raw == "" {
+		t.Fatal("claim() found no job")
+	}
+	q.process(ctx, raw, handle)
+}
+
+func decodeJob(t *testing.T, raw string) Job {
+	t.Helper()
+	var j Job
+	if err := json.Unmarshal([]byte(raw), &j); err != nil {
+		t.Fatal(err)
+	}
+	return j
+}
+
+func TestEnqueueDropsDuplicateKeys(t *testing.T) {
+	q, _ := openTestQueue(t, Options{})
+	ctx := context.Background()
+
+	for i, want := range []bool{true, false} {
+		added, err := q.Enqueue(ctx, Job{Kind: "scan", Key: "nginx"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if added != want {
+			t.Fatalf("Enqueue() #%d added = %v, want %v", i+1, added, want)
+		}
+	}
+	runOne(t, q, func(context.Context, Job) error { return nil })
+	if added, err := q.Enqueue(ctx, Job{Kind: "scan", Key: "nginx"}); err != nil || !added {
+		t.Fatalf("Enqueue() after the job finished = %v, %v, want it added", added, err)
+	}
+
+	if added, err := q.EnqueueOnce(ctx, Job{Kind: "digest", Key: "weekly"}, time.Hour); err != nil || !added {
+		t.Fatalf("EnqueueOnce() = %v, %v", added, err)
+	}
+	for range 2 {
+		if _, err := q.claim(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if added, err := q.EnqueueOnce(ctx, Job{Kind: "digest", Key: "weekly"}, time.Hour); err != nil || added {
+		t.Fatalf("EnqueueOnce() within the window = %v, %v, want it dropped", added, err)
+	}
+}
+
+func TestClaimTakesTheMostUrgentJobFirst(t *testing.T) {
+	q, _ := openTestQueue(t, Options{})
+	ctx := context.Background()
+	for _, j := range []Job{
+		{ID: "scheduled", Priority: queue.PriorityScheduled},
+		{ID: "first", Priority: queue.PriorityInteractive},
+		{ID: "second", Priority: queue.PriorityInteractive},
+	} {
+		if _, err := q.Enqueue(ctx, j); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, want := range []string{"first", "second", "scheduled"} {
+		raw, err := q.claim(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if j := decodeJob(t, raw); j.ID != want {
+			t.Fatalf("claim() = %s, want %s", j.ID, want)
+		}
+	}
+	if raw, err := q.claim(ctx); err != nil || raw != "" {
+		t.Fatalf("claim() of empty queues = %q, %v", raw, err)
+	}
+	if n, _ := q.rdb.LLen(ctx, q.processingKey(q.consumer)).Result(); n != 3 {
+		t.Fatalf("%d jobs held by the replica, want 3", n)
+	}
+}
+
+func TestFailedJobsBackOffThenGoToTheDeadLetterList(t *testing.T) {
+	q, _ := openTestQueue(t, Options{MaxAttempts: 3, RetryBackoff: time.Minute})
+	ctx := context.Background()
+	if _, err := q.Enqueue(ctx, Job{ID: "j1", Kind: "scan", Key: "nginx"}); err != nil {
+		t.Fatal(err)
+	}
+	failing := func(context.Context, Job) error { return errors.New("registry timeout") }
+
+	for attempt, backoff := range []time.Duration{time.Minute, 2 * time.Minute} {
+		start := time.Now().Truncate(time.Millisecond) // due times are in milliseconds
+		runOne(t, q, failing)
+		delayed, err := q.rdb.ZRangeWithScores(ctx, q.delayedKey(queue.PriorityInteractive), 0, -1).Result()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(delayed) != 1 {
+			t.Fatalf("attempt %d: %d delayed jobs, want 1", attempt+1, len(delayed))
+		}
+		due := time.UnixMilli(int64(delayed[0].Score))
+		if due.Before(start.Add(backoff)) || due.After(time.Now().Add(backoff)) {
+			t.Fatalf("attempt %d: retry due in %s, want %s", attempt+1, due.Sub(start), backoff)
+		}
+		j := decodeJob(t, delayed[0].Member.(string))
+		if j.Attempts != attempt+1 || j.LastError != "registry timeout" {
+			t.Fatalf("attempt %d: delayed job = %+v", attempt+1, j)
+		}
+
+		q.promote(ctx)
+		if n, _ := q.rdb.LLen(ctx, q.readyKey(queue.PriorityInteractive)).Result(); n != 0 {
+			t.Fatal("promote() moved a job that is not due yet")
+		}
+		// Make the retry due.
+		q.rdb.ZAdd(ctx, q.delayedKey(queue.PriorityInteractive), redis.Z{Score: 0, Member: delayed[0].Member})
+		q.promote(ctx)
+	}
+
+	runOne(t, q, failing)
+	dead, err := q.Dead(ctx, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dead) != 1 || dead[0].ID != "j1" || dead[0].Attempts != 3 || dead[0].FailedAt == nil {
+		t.Fatalf("Dead() = %+v, want j1 after 3 attempts", dead)
+	}
+	if added, err := q.Enqueue(ctx, Job{Kind: "scan", Key: "nginx"}); err != nil || !added {
+		t.Fatalf("the dead job still holds its key: added = %v, %v", added, err)
+	}
+
+	s, err := q.Stats(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Retried != 2 || s.DeadLocal != 1 || s.Dead != 1 || s.Ready != 1 || s.Processing != 0 {
+		t.Fatalf("Stats() = %+v", s)
+	}
+}
+
+func TestPermanentErrorsSkipRetries(t *testing.T) {
+	q, _ := openTestQueue(t, Options{MaxAttempts: 5})
+	ctx := context.Background()
+	if _, err := q.Enqueue(ctx, Job{ID: "j1", Kind: "scan"}); err != nil {
+		t.Fatal(err)
+	}
+	runOne(t, q, func(context.Context, Job) error { return Permanent(errors.New("no such image")) })
+
+	dead, err := q.Dead(ctx, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dead) != 1 || dead[0].Attempts != 1 {
+		t.Fatalf("Dead() = %+v, want j1 after one attempt", dead)
+	}
+
+	j, err := q.Retry(ctx, "j1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if j.Attempts != 0 || j.FailedAt != nil {
+		t.Fatalf("Retry() = %+v, want fresh attempts", j)
+	}
+	var ran Job
+	runOne(t, q, func(_ context.Context, j Job) error {
+		ran = j
+		return nil
+	})
+	if ran.ID != "j1" || ran.LastError != "no such image" {
+		t.Fatalf("retried job ran as %+v", ran)
+	}
+	if _, err := q.Retry(ctx, "j1"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Retry() of a job no longer dead = %v, want ErrNotFound", err)
+	}
+
+	if _, err := q.Enqueue(ctx, Job{ID: "j2", Kind: "scan"}); err != nil {
+		t.Fatal(err)
+	}
+	runOne(t, q, func(context.Context, Job) error { return Permanent(errors.New("no such image")) })
+	if err := q.Discard(ctx, "j2"); err != nil {
+		t.Fatal(err)
+	}
+	if dead, _ := q.Dead(ctx, 10); len(dead) != 0 {
+		t.Fatalf("Dead() after Discard() = %+v", dead)
+	}
+}
+
+func TestRecoverHandsBackTheJobsOfAStoppedReplica(t *testing.T) {
+	ctx := context.Background()
+	gone, mr := openTestQueue(t, Options{Consumer: "replica-b", MaxAttempts: 2})
+	gone.heartbeat(ctx)
+	for _, j := range []Job{{ID: "j1", Key: "nginx"}, {ID: "j2", Key: "redis"}} {
+		if _, err := gone.Enqueue(ctx, j); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Count a run that killed its worker before against the first job.
+	raw, _ := gone.claim(ctx)
+	j := decodeJob(t, raw)
+	j.Attempts = 1
+	next, _ := json.Marshal(j)
+	gone.rdb.LSet(ctx, gone.processingKey("replica-b"), 0, string(next))
+	if _, err := gone.claim(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	q, err := Open(ctx, Options{URL: "redis://" + mr.Addr(), Consumer: "replica-a", MaxAttempts: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+	q.heartbeat(ctx)
+
+	// Still alive: nothing is taken over.
+	q.recover(ctx)
+	if n, _ := q.rdb.LLen(ctx, q.processingKey("replica-b")).Result(); n != 2 {
+		t.Fatalf("recover() took %d jobs from a live replica", 2-n)
+	}
+
+	mr.FastForward(leaseTTL + time.Second)
+	q.heartbeat(ctx)
+	q.recover(ctx)
+
+	raw, err = q.claim(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recovered := decodeJob(t, raw)
+	if recovered.ID == j.ID || recovered.Attempts != 1 || recovered.LastError == "" {
+		t.Fatalf("recovered job = %+v, want the other one with the interrupted run counted", recovered)
+	}
+	dead, err := q.Dead(ctx, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dead) != 1 || dead[0].ID != j.ID || dead[0].Attempts != 2 || dead[0].FailedAt == nil {
+		t.Fatalf("Dead() = %+v, want %s out of attempts", dead, j.ID)
+	}
+	if mr.Exists(q.dedupeKey(dead[0].Key)) {
+		t.Fatal("the dead job still holds its key")
+	}
+	if !mr.Exists(q.dedupeKey(recovered.Key)) {
+		t.Fatal("the recovered job lost its key")
+	}
+	if ok, _ := mr.SIsMember(q.consumersKey(), "replica-b"); ok {
+		t.Fatal("the stopped replica is still a consumer")
+	}
+}
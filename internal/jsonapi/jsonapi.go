@@ -0,0 +1,104 @@
+// Package jsonapi sends the JSON requests of the REST clients for Jira,
+// ServiceNow and GitHub, which differ only in authentication and in how
+// they report errors.
+package jsonapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+	"weeklysec/internal/errcode"
+)
+
+// Client calls one API.
+type Client struct {
+	BaseURL string
+	HTTP    *http.Client
+	Name    string       // prefixes errors, e.g. "jira"
+	Code    errcode.Code // carried by every failure
+
+	// Header sets credentials and API-specific headers on each request,
+	// after the JSON Accept and Content-Type headers.
+	Header func(*http.Request)
+
+	// Message extracts the API's error message from the body of a failed
+	// response; the HTTP status is used when it returns "".
+	Message func(body []byte) string
+}
+
+// New returns a client for the API at baseURL with a 30s timeout.
+func New(name string, code errcode.Code, baseURL string) *Client {
+	return &Client{
+		BaseURL: strings.TrimRight(baseURL, "/"),
+		HTTP:    &http.Client{Timeout: 30 * time.Second},
+		Name:    name,
+		Code:    code,
+	}
+}
+
+// Auth sets basic auth when user is given, otherwise a bearer token when
+// there is one.
+func Auth(user, password, token string) func(*http.Request) {
+	return func(req *http.Request) {
+		if user != "" {
+			req.SetBasicAuth(user, password)
+		} else if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+	}
+}
+
+// Do sends body, when not nil, as JSON and decodes the JSON answer into
+// out, if given. Failures carry c.Code with the API's message; the query
+// string of path is left out of them.
+func (c *Client) Do(ctx context.Context, method, path string, body, out any) error {
+	var rd io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		rd = bytes.NewReader(b)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.BaseURL+path, rd)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.Header != nil {
+		c.Header(req)
+	}
+
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return errcode.Wrap(c.Code, fmt.Errorf("%s: %w", c.Name, err))
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		var msg string
+		if data, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<16)); c.Message != nil {
+			msg = c.Message(data)
+		}
+		if msg == "" {
+			msg = resp.Status
+		}
+		return errcode.Wrap(c.Code, fmt.Errorf("%s: %s %s: %s", c.Name, method, strings.SplitN(path, "?", 2)[0], msg))
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil && !errors.Is(err, io.EOF) {
+		return errcode.Wrap(c.Code, fmt.Errorf("%s: invalid response: %w", c.Name, err))
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+package jsonapi
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"weeklysec/internal/errcode"
+)
+
+func TestDo(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/echo":
+			io.Copy(w, r.Body)
+		case "/empty":
+			w.WriteHeader(http.StatusNoContent)
+		case "/fail":
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, `{"message":"bad field"}`)
+		case "/garbled":
+			io.WriteString(w, `{`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	c := New("test", errcode.GitHubError, srv.URL+"/")
+	c.Header = Auth("", "", "tok")
+	c.Message = func(body []byte) string {
+		var e struct{ Message string }
+		_ = json.Unmarshal(body, &e)
+		return e.Message
+	}
+
+	tests := []struct {
+		name    string
+		path    string
+		body    any
+		want    string
+		wantErr string
+	}{
+		{name: "round trip", path: "/echo", body: map[string]string{"a": "b"}, want: "b"},
+		{name: "no content", path: "/empty"},
+		{name: "api message", path: "/fail?secret=1", wantErr: "test: POST /fail: bad field"},
+		{name: "status without message", path: "/missing", wantErr: "test: POST /missing: 404 Not Found"},
+		{name: "invalid response", path: "/garbled", wantErr: "test: invalid response"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out struct{ A string }
+			err := c.Do(context.Background(), http.MethodPost, tt.path, tt.body, &out)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) || errcode.Of(err) != errcode.GitHubError {
+					t.Fatalf("Do() error = %v, want %s %q", err, errcode.GitHubError, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || out.A != tt.want {
+				t.Fatalf("Do() = %+v, %v, want A %q", out, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestAuth(t *testing.T) {
+	tests := []struct {
+		user, password, token string
+		want                  string
+	}{
+		{"alice", "pw", "tok", "Basic YWxpY2U6cHc="},
+		{"", "pw", "tok", "Bearer tok"},
+		{"", "", "", ""},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		Auth(tt.user, tt.password, tt.token)(req)
+		if got := req.Header.Get("Authorization"); got != tt.want {
+			t.Errorf("Auth(%q, %q, %q) set %q, want %q", tt.user, tt.password, tt.token, got, tt.want)
+		}
+	}
+}
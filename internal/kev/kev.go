@@ -0,0 +1,158 @@
+// Package kev keeps a copy of CISA's Known Exploited Vulnerabilities
+// catalog, refreshed periodically and cached on disk so lookups work
+// offline after the first download.
+package kev
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// DefaultURL is CISA's JSON feed.
+const DefaultURL = "https://www.cisa.gov/sites/default/files/feeds/known_exploited_vulnerabilities.json"
+
+// maxCatalogBytes bounds the download; the feed is a few megabytes.
+const maxCatalogBytes = 64 << 20
+
+// Entry is one catalog entry.
+type Entry struct {
+	CVEID                      string `json:"cveID"`
+	VendorProject              string `json:"vendorProject"`
+	Product                    string `json:"product"`
+	VulnerabilityName          string `json:"vulnerabilityName"`
+	DateAdded                  string `json:"dateAdded"`
+	RequiredAction             string `json:"requiredAction"`
+	DueDate                    string `json:"dueDate"`
+	KnownRansomwareCampaignUse string `json:"knownRansomwareCampaignUse"`
+}
+
+type feed struct {
+	CatalogVersion  string  `json:"catalogVersion"`
+	DateReleased    string  `json:"dateReleased"`
+	Vulnerabilities []Entry `json:"vulnerabilities"`
+}
+
+// Catalog answers KEV membership queries. The zero value is empty.
+type Catalog struct {
+	url       string
+	cachePath string
+	client    *http.Client
+
+	mu      sync.RWMutex
+	entries map[string]Entry
+	version string
+}
+
+// New returns a catalog downloaded from url and cached at cachePath. The
+// cache, if present, is loaded right away.
+func New(url, cachePath string) *Catalog {
+	c := &Catalog{url: url, cachePath: cachePath, client: &http.Client{Timeout: time.Minute}}
+	if data, err := os.ReadFile(cachePath); err == nil {
+		if err := c.load(data); err != nil {
+			log.Warn().Err(err).Str("path", cachePath).Msg("Ignoring unreadable KEV cache")
+		}
+	}
+	return c
+}
+
+// Lookup returns the entry for a CVE ID.
+func (c *Catalog) Lookup(cveID string) (Entry, bool) {
+	if c == nil {
+		return Entry{}, false
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	e, ok := c.entries[strings.ToUpper(cveID)]
+	return e, ok
+}
+
+// Size returns the number of entries and the catalog version.
+func (c *Catalog) Size() (int, string) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return len(c.entries), c.version
+}
+
+// Refresh downloads the catalog and replaces the cache.
+func (c *Catalog) Refresh(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to download KEV catalog: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to download KEV catalog: %s", resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxCatalogBytes))
+	if err != nil {
+		return fmt.Errorf("failed to download KEV catalog: %w", err)
+	}
+	if err := c.load(data); err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(c.cachePath), 0o750); err != nil {
+		return err
+	}
+	tmp := c.cachePath + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o640); err != nil {
+		return err
+	}
+	return os.Rename(tmp, c.cachePath)
+}
+
+// Run refreshes the catalog now and then every interval until stop is
+// closed. Failures keep the previous copy.
+func (c *Catalog) Run(interval time.Duration, stop <-chan struct{}) {
+	refresh := func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+		defer cancel()
+		if err := c.Refresh(ctx); err != nil {
+			log.Warn().Err(err).Msg("KEV catalog refresh failed")
+			return
+		}
+		n, version := c.Size()
+		log.Info().Int("entries", n).Str("version", version).Msg("KEV catalog refreshed")
+	}
+
+	refresh()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			refresh()
+		case <-stop:
+			return
+		}
+	}
+}
+
+func (c *Catalog) load(data []byte) error {
+	var f feed
+	if err := json.Unmarshal(data, &f); err != nil {
+		return fmt.Errorf("invalid KEV catalog: %w", err)
+	}
+	entries := make(map[string]Entry, len(f.Vulnerabilities))
+	for _, e := range f.Vulnerabilities {
+		entries[strings.ToUpper(e.CVEID)] = e
+	}
+	c.mu.Lock()
+	c.entries, c.version = entries, f.CatalogVersion
+	c.mu.Unlock()
+	return nil
+}
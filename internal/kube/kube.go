@@ -0,0 +1,193 @@
+// Package kube is a small Kubernetes API client: JSON reads, creates,
+// merge patches and deletes against the REST paths, authenticated with a
+// service account token.
+package kube
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+	"weeklysec/internal/errcode"
+)
+
+// Paths of the mounted service account credentials.
+const (
+	serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+	tokenFile         = serviceAccountDir + "/token"
+	caFile            = serviceAccountDir + "/ca.crt"
+)
+
+// ObjectMeta is the subset of object metadata the callers use.
+type ObjectMeta struct {
+	Name              string            `json:"name"`
+	Namespace         string            `json:"namespace,omitempty"`
+	UID               string            `json:"uid,omitempty"`
+	ResourceVersion   string            `json:"resourceVersion,omitempty"`
+	Generation        int64             `json:"generation,omitempty"`
+	CreationTimestamp time.Time         `json:"creationTimestamp,omitzero"`
+	Labels            map[string]string `json:"labels,omitempty"`
+	Annotations       map[string]string `json:"annotations,omitempty"`
+	OwnerReferences   []OwnerReference  `json:"ownerReferences,omitempty"`
+}
+
+// OwnerReference ties an object's lifetime to its owner's.
+type OwnerReference struct {
+	APIVersion         string `json:"apiVersion"`
+	Kind               string `json:"kind"`
+	Name               string `json:"name"`
+	UID                string `json:"uid"`
+	Controller         bool   `json:"controller,omitempty"`
+	BlockOwnerDeletion bool   `json:"blockOwnerDeletion,omitempty"`
+}
+
+// StatusError is a failed API call.
+type StatusError struct {
+	Code    int
+	Reason  string
+	Message string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("kubernetes: %s (%d): %s", e.Reason, e.Code, e.Message)
+}
+
+// IsNotFound reports whether err is a 404 from the API server.
+func IsNotFound(err error) bool {
+	var se *StatusError
+	return errors.As(err, &se) && se.Code == http.StatusNotFound
+}
+
+// Client calls one API server.
+type Client struct {
+	baseURL   string
+	token     string
+	tokenFile string // re-read on every call, as projected tokens rotate
+	http      *http.Client
+}
+
+// InCluster returns a client for the API server of the cluster the process
+// runs in, using its service account.
+func InCluster() (*Client, error) {
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return nil, fmt.Errorf("not running in a cluster: KUBERNETES_SERVICE_HOST is not set")
+	}
+	c, err := New("https://"+net.JoinHostPort(host, port), "", caFile)
+	if err != nil {
+		return nil, err
+	}
+	c.tokenFile = tokenFile
+	return c, nil
+}
+
+// New returns a client for the API server at baseURL. The CA file, if
+// given, replaces the system roots; an empty token sends no credentials,
+// which suits `kubectl proxy`.
+func New(baseURL, token, caPath string) (*Client, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if caPath != "" {
+		pem, err := os.ReadFile(caPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read cluster CA: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates in %s", caPath)
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}
+	}
+	return &Client{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		token:   token,
+		http:    &http.Client{Timeout: 30 * time.Second, Transport: transport},
+	}, nil
+}
+
+// Get reads the object at path into out.
+func (c *Client) Get(ctx context.Context, path string, out any) error {
+	return c.do(ctx, http.MethodGet, path, "", nil, out)
+}
+
+// Create posts obj to the collection at path and decodes the created
+// object into out, if given.
+func (c *Client) Create(ctx context.Context, path string, obj, out any) error {
+	return c.do(ctx, http.MethodPost, path, "application/json", obj, out)
+}
+
+// Patch applies a JSON merge patch to the object at path.
+func (c *Client) Patch(ctx context.Context, path string, patch, out any) error {
+	return c.do(ctx, http.MethodPatch, path, "application/merge-patch+json", patch, out)
+}
+
+// Delete removes the object at path. A missing object is not an error.
+func (c *Client) Delete(ctx context.Context, path string) error {
+	if err := c.do(ctx, http.MethodDelete, path, "", nil, nil); err != nil && !IsNotFound(err) {
+		return err
+	}
+	return nil
+}
+
+func (c *Client) do(ctx context.Context, method, path, contentType string, body, out any) error {
+	var r io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		r = bytes.NewReader(b)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, r)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	token := c.token
+	if c.tokenFile != "" {
+		b, err := os.ReadFile(c.tokenFile)
+		if err != nil {
+			return fmt.Errorf("failed to read service account token: %w", err)
+		}
+		token = strings.TrimSpace(string(b))
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return errcode.Wrap(errcode.KubernetesError, fmt.Errorf("kubernetes: %w", err))
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		var status struct {
+			Reason  string `json:"reason"`
+			Message string `json:"message"`
+		}
+		_ = json.NewDecoder(io.LimitReader(resp.Body, 1<<16)).Decode(&status)
+		if status.Reason == "" {
+			status.Reason = http.StatusText(resp.StatusCode)
+		}
+		return errcode.Wrap(errcode.KubernetesError, &StatusError{Code: resp.StatusCode, Reason: status.Reason, Message: status.Message})
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return errcode.Wrap(errcode.KubernetesError, fmt.Errorf("kubernetes: invalid response: %w", err))
+	}
+	return nil
+}
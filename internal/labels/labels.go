@@ -0,0 +1,178 @@
+// Package labels implements Kubernetes-style label selectors over target
+// labels, e.g. "team=payments,env in (prod,staging),!deprecated".
+package labels
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// validKey and validValue follow the Kubernetes label syntax, minus the
+// optional DNS prefix length rules.
+var (
+	validKey   = regexp.MustCompile(`^([a-z0-9]([-a-z0-9.]*[a-z0-9])?/)?[A-Za-z0-9]([-A-Za-z0-9_.]*[A-Za-z0-9])?$`)
+	validValue = regexp.MustCompile(`^([A-Za-z0-9]([-A-Za-z0-9_.]*[A-Za-z0-9])?)?$`)
+)
+
+// Validate checks a label set.
+func Validate(labels map[string]string) error {
+	for k, v := range labels {
+		if len(k) > 253 || !validKey.MatchString(k) {
+			return fmt.Errorf("invalid label key %q", k)
+		}
+		if len(v) > 63 || !validValue.MatchString(v) {
+			return fmt.Errorf("invalid value %q for label %q", v, k)
+		}
+	}
+	return nil
+}
+
+type operator int
+
+const (
+	opEquals operator = iota
+	opNotEquals
+	opIn
+	opNotIn
+	opExists
+	opNotExists
+)
+
+type requirement struct {
+	key    string
+	op     operator
+	values []string
+}
+
+func (r requirement) matches(labels map[string]string) bool {
+	v, ok := labels[r.key]
+	switch r.op {
+	case opEquals:
+		return ok && v == r.values[0]
+	case opNotEquals:
+		return !ok || v != r.values[0]
+	case opIn:
+		return ok && slices.Contains(r.values, v)
+	case opNotIn:
+		return !ok || !slices.Contains(r.values, v)
+	case opExists:
+		return ok
+	default:
+		return !ok
+	}
+}
+
+// Selector matches label sets against every one of its requirements. The
+// zero Selector matches everything.
+type Selector struct {
+	reqs []requirement
+}
+
+// Empty reports whether the selector matches everything.
+func (s Selector) Empty() bool {
+	return len(s.reqs) == 0
+}
+
+// Matches reports whether labels satisfy the selector.
+func (s Selector) Matches(labels map[string]string) bool {
+	for _, r := range s.reqs {
+		if !r.matches(labels) {
+			return false
+		}
+	}
+	return true
+}
+
+// Parse reads a comma-separated list of requirements:
+//
+//	key=value  key==value  key!=value
+//	key in (a,b)  key notin (a,b)
+//	key  !key
+func Parse(selector string) (Selector, error) {
+	var s Selector
+	for _, part := range splitTopLevel(selector) {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		r, err := parseRequirement(part)
+		if err != nil {
+			return Selector{}, err
+		}
+		s.reqs = append(s.reqs, r)
+	}
+	return s, nil
+}
+
+func parseRequirement(part string) (requirement, error) {
+	if strings.HasPrefix(part, "!") {
+		return keyOnly(strings.TrimSpace(part[1:]), opNotExists)
+	}
+	for _, op := range []struct {
+		token string
+		op    operator
+	}{{"!=", opNotEquals}, {"==", opEquals}, {"=", opEquals}} {
+		if k, v, ok := strings.Cut(part, op.token); ok {
+			k, v = strings.TrimSpace(k), strings.TrimSpace(v)
+			if err := Validate(map[string]string{k: v}); err != nil {
+				return requirement{}, err
+			}
+			return requirement{key: k, op: op.op, values: []string{v}}, nil
+		}
+	}
+	if fields := strings.Fields(part); len(fields) >= 2 {
+		var op operator
+		switch fields[1] {
+		case "in":
+			op = opIn
+		case "notin":
+			op = opNotIn
+		default:
+			return requirement{}, fmt.Errorf("invalid selector requirement %q", part)
+		}
+		key := fields[0]
+		rest := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(part[len(key):]), fields[1]))
+		if !strings.HasPrefix(rest, "(") || !strings.HasSuffix(rest, ")") {
+			return requirement{}, fmt.Errorf("invalid selector requirement %q: values must be in parentheses", part)
+		}
+		var values []string
+		for _, v := range strings.Split(rest[1:len(rest)-1], ",") {
+			v = strings.TrimSpace(v)
+			if err := Validate(map[string]string{key: v}); err != nil {
+				return requirement{}, err
+			}
+			values = append(values, v)
+		}
+		return requirement{key: key, op: op, values: values}, nil
+	}
+	return keyOnly(part, opExists)
+}
+
+func keyOnly(key string, op operator) (requirement, error) {
+	if err := Validate(map[string]string{key: ""}); err != nil {
+		return requirement{}, err
+	}
+	return requirement{key: key, op: op}, nil
+}
+
+// splitTopLevel splits on commas outside parentheses.
+func splitTopLevel(s string) []string {
+	var parts []string
+	depth, start := 0, 0
+	for i, r := range s {
+		switch r {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				parts = append(parts, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(parts, s[start:])
+}
@@ -0,0 +1,135 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+	"weeklysec/internal/errcode"
+)
+
+// ClientOptions tunes the HTTP client every LLM call shares.
+type ClientOptions struct {
+	MaxIdleConns    int           // kept-alive connections to the LLM API
+	IdleConnTimeout time.Duration // how long an unused connection is kept
+	// AttemptTimeout bounds one request and Timeout a call across its
+	// attempts, so a slow completion is retried without the retry
+	// outliving the caller. 0 disables either.
+	AttemptTimeout time.Duration
+	Timeout        time.Duration
+	Attempts       int // tries of a call that timed out, failed to connect or got a 429 or 5xx
+}
+
+// DefaultClientOptions are in effect until SetClientOptions is called.
+var DefaultClientOptions = ClientOptions{
+	MaxIdleConns:    16,
+	IdleConnTimeout: 90 * time.Second,
+	AttemptTimeout:  2 * time.Minute,
+	Timeout:         5 * time.Minute,
+	Attempts:        3,
+}
+
+var (
+	clientOpts = DefaultClientOptions
+	httpClient = newHTTPClient(DefaultClientOptions)
+)
+
+// SetClientOptions replaces the LLM HTTP client. It must be called before
+// the first call.
+func SetClientOptions(o ClientOptions) {
+	clientOpts = o
+	httpClient = newHTTPClient(o)
+}
+
+func newHTTPClient(o ClientOptions) *http.Client {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	// Every call goes to the same host, so the per-host limit is the one
+	// that matters; the default of 2 makes bursts of steps reconnect.
+	t.MaxIdleConns = o.MaxIdleConns
+	t.MaxIdleConnsPerHost = o.MaxIdleConns
+	t.IdleConnTimeout = o.IdleConnTimeout
+	t.ForceAttemptHTTP2 = true
+	return &http.Client{Transport: t}
+}
+
+// call sends a request to the LLM API and decodes a 200 response into out,
+// when set. Transient failures are retried with a short backoff.
+func call(ctx context.Context, method, url, apiKey string, body []byte, out any) error {
+	o := clientOpts
+	if o.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, o.Timeout)
+		defer cancel()
+	}
+	attempts := max(o.Attempts, 1)
+	for attempt := 1; ; attempt++ {
+		retry, err := attemptCall(ctx, o.AttemptTimeout, method, url, apiKey, body, out)
+		if err == nil || !retry || attempt == attempts {
+			return err
+		}
+		select {
+		case <-time.After(time.Duration(attempt) * time.Second):
+		case <-ctx.Done():
+			return err
+		}
+	}
+}
+
+// attemptCall makes one try of call, reporting whether a failure is worth
+// another.
+func attemptCall(ctx context.Context, timeout time.Duration, method, url, apiKey string, body []byte, out any) (retry bool, err error) {
+	parent := ctx
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(body))
+	if err != nil {
+		return false, fmt.Errorf("failed to create request: %w", err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+apiKey)
+	}
+	req.Header.Set("X-Title", "weekly-sec-ai")
+	req.Header.Set("HTTP-Referer", "http://localhost")
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return parent.Err() == nil, errcode.Wrap(transportCode(err), fmt.Errorf("failed to send request: %w", err))
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		s := resp.StatusCode
+		return parent.Err() == nil && (s == http.StatusTooManyRequests || s >= 500), statusError(s)
+	}
+	if out == nil {
+		return false, nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		// The attempt timing out while the completion is read is as
+		// transient as it timing out before.
+		if ctx.Err() != nil {
+			return parent.Err() == nil, errcode.Wrap(errcode.Timeout, fmt.Errorf("failed to read response: %w", err))
+		}
+		return false, fmt.Errorf("failed to decode response: %w", err)
+	}
+	return false, nil
+}
+
+func transportCode(err error) errcode.Code {
+	var ne net.Error
+	if errors.Is(err, context.DeadlineExceeded) || errors.As(err, &ne) && ne.Timeout() {
+		return errcode.Timeout
+	}
+	return errcode.LLMUnavailable
+}
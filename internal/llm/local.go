@@ -0,0 +1,41 @@
+package llm
+
+import (
+	"os"
+	"strings"
+)
+
+// LocalOptions route models served on the operator's own infrastructure to
+// an OpenAI-compatible chat completions endpoint, such as Ollama or vLLM,
+// instead of OpenRouter. Data-minimization mode only sends full-detail
+// prompts to these models.
+type LocalOptions struct {
+	URL    string   // chat completions endpoint, e.g. http://localhost:11434/v1/chat/completions
+	APIKey string   // sent as a bearer token when set
+	Models []string // model names, or prefixes ending in "*"
+}
+
+var local LocalOptions
+
+// SetLocal replaces the local model routing. It must be called before the
+// first call.
+func SetLocal(o LocalOptions) {
+	local = o
+}
+
+// IsLocal reports whether model is served by the local endpoint. An empty
+// model is LLM_MODEL.
+func IsLocal(model string) bool {
+	if local.URL == "" {
+		return false
+	}
+	if model == "" {
+		model = os.Getenv("LLM_MODEL")
+	}
+	for _, m := range local.Models {
+		if prefix, ok := strings.CutSuffix(m, "*"); ok && strings.HasPrefix(model, prefix) || m == model {
+			return true
+		}
+	}
+	return false
+}
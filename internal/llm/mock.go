@@ -0,0 +1,41 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// mock, when set, answers every call in place of the API.
+var mock *mockLLM
+
+type mockLLM struct {
+	latency time.Duration
+}
+
+// UseMock makes every call answer with canned text after latency instead of
+// contacting the API, so load tests and demos spend no credits. Remediation
+// prompts get a valid remediation object. It must be called before the
+// first call.
+func UseMock(latency time.Duration) {
+	mock = &mockLLM{latency: latency}
+}
+
+// Mocked reports whether calls go to the mock.
+func Mocked() bool {
+	return mock != nil
+}
+
+func (m *mockLLM) chat(ctx context.Context, messages []Message) (string, error) {
+	select {
+	case <-time.After(m.latency):
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+
+	if len(messages) > 0 && (messages[0].Content == CurrentPrompts().RemediationSystem || strings.HasPrefix(messages[len(messages)-1].Content, "Target: ")) {
+		return `{"commit_message": "Upgrade vulnerable packages", "pr_title": "Upgrade vulnerable packages", "pr_description": "Mock remediation package."}`, nil
+	}
+	return fmt.Sprintf("Mock summary of a %d token prompt.", EstimateTokens(messages)), nil
+}
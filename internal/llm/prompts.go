@@ -0,0 +1,133 @@
+package llm
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"text/template"
+)
+
+// Prompt template files read by LoadPrompts. Missing files keep the
+// built-in prompt.
+const (
+	SummarySystemFile     = "summary_system.txt"
+	SummaryFile           = "summary.tmpl" // text/template; {{.Report}} is the Trivy JSON
+	RemediationSystemFile = "remediation_system.txt"
+)
+
+// Prompts are the instructions sent to the LLM.
+type Prompts struct {
+	SummarySystem     string
+	Summary           *template.Template
+	RemediationSystem string
+}
+
+var defaultSummary = template.Must(template.New(SummaryFile).Parse(`
+You are a security analyst. Summarize the following Trivy JSON scan result for terminal display.
+
+Only output plain text.
+Avoid any Markdown formatting like **, backticks, or bullet symbols like '*'.
+Use simple dashes (-), colons (:), and line breaks for clarity.
+
+Include these sections:
+1. Overall Risk Level
+2. Summary of Detected Vulnerabilities
+3. Recommendations
+4. Action Items (Critical and Best Practice)
+
+Scan Output:
+{{.Report}}
+{{- if .Omitted}}
+
+Only the most severe findings are included; {{.Omitted}} lower-ranked ones were left out. Say that the summary is partial.
+{{- end}}
+`))
+
+type summaryData struct {
+	Report  string
+	Omitted int // findings left out of Report
+}
+
+// DefaultPrompts returns the built-in prompts.
+func DefaultPrompts() *Prompts {
+	return &Prompts{
+		SummarySystem: "You are a security analyst. Output must be clean, plain text only. Absolutely no Markdown like **, backticks, or bullet symbols. Use '-' and ':' for listing.",
+		Summary:       defaultSummary,
+		RemediationSystem: `You are a security engineer preparing a remediation pull request.
+Respond with a single JSON object and nothing else, using exactly these keys:
+{"commit_message": string, "pr_title": string, "pr_description": string}
+The commit message uses a short imperative subject line, a blank line, then a body.
+The PR description is Markdown and lists every fix with the CVEs it resolves.
+Configuration fixes are edits to the named file, not upgrades: describe each one with the check ID it resolves.
+Leaked secrets come with rotation runbooks: name each credential and where it is referenced, and point to its runbook instead of a generic note to rotate it.
+Hardening recommendations are Kubernetes manifest changes: describe each one with the resource and container it applies to.`,
+	}
+}
+
+// LoadPrompts reads the prompt files in dir over the built-in prompts.
+func LoadPrompts(dir string) (*Prompts, error) {
+	p := DefaultPrompts()
+	read := func(name string, dst *string) error {
+		b, err := os.ReadFile(filepath.Join(dir, name))
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		*dst = strings.TrimSpace(string(b))
+		return nil
+	}
+
+	if err := read(SummarySystemFile, &p.SummarySystem); err != nil {
+		return nil, err
+	}
+	if err := read(RemediationSystemFile, &p.RemediationSystem); err != nil {
+		return nil, err
+	}
+	var summary string
+	if err := read(SummaryFile, &summary); err != nil {
+		return nil, err
+	}
+	if summary != "" {
+		t, err := ParseSummary(summary)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", SummaryFile, err)
+		}
+		p.Summary = t
+	}
+	return p, nil
+}
+
+// ParseSummary parses and test-renders a summary prompt template.
+func ParseSummary(text string) (*template.Template, error) {
+	t, err := template.New(SummaryFile).Parse(text)
+	if err == nil {
+		err = t.Execute(io.Discard, summaryData{Report: "{}"})
+	}
+	return t, err
+}
+
+var (
+	promptsMu sync.RWMutex
+	prompts   = DefaultPrompts()
+)
+
+// SetPrompts replaces the prompts used from now on.
+func SetPrompts(p *Prompts) {
+	promptsMu.Lock()
+	defer promptsMu.Unlock()
+	prompts = p
+}
+
+// CurrentPrompts returns the prompts in use.
+func CurrentPrompts() *Prompts {
+	promptsMu.RLock()
+	defer promptsMu.RUnlock()
+	return prompts
+}
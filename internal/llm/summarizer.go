@@ -1,16 +1,26 @@
 package llm
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
-	"errors"
 	"fmt"
 	"net/http"
 	"os"
+	"strings"
 	"time"
+	"weeklysec/internal/errcode"
+	"weeklysec/internal/tracing"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+const (
+	openRouterURL       = "https://openrouter.ai/api/v1/chat/completions"
+	openRouterModelsURL = "https://openrouter.ai/api/v1/models"
 )
 
-const openRouterURL = "https://openrouter.ai/api/v1/chat/completions"
+// ErrNotConfigured is returned when the OpenRouter credentials are missing.
+var ErrNotConfigured = errcode.New(errcode.LLMNotConfigured, "missing OpenRouter config in environment")
 
 type Message struct {
 	Role    string `json:"role"`
@@ -20,90 +30,157 @@ type Message struct {
 type ChatRequest struct {
 	Model    string    `json:"model"`
 	Messages []Message `json:"messages"`
+
+	// IncludeReasoning asks reasoning models to return their reasoning
+	// alongside the answer.
+	IncludeReasoning bool `json:"include_reasoning,omitempty"`
 }
 
 type ChatResponse struct {
 	Choices []struct {
 		Message struct {
-			Content string `json:"content"`
+			Content   string `json:"content"`
+			Reasoning string `json:"reasoning,omitempty"`
 		} `json:"message"`
 	} `json:"choices"`
 }
 
-func Summarize(trivyJSON string) (string, error) {
-	apiKey := os.Getenv("OPENROUTER_API_KEY")
-	model := os.Getenv("LLM_MODEL")
-
-	if apiKey == "" || model == "" {
-		return "", errors.New("missing OpenRouter config in environment")
-	}
+// Configured reports whether an API key and default model are available,
+// the default model is local, or calls go to the mock.
+func Configured() bool {
+	return mock != nil || os.Getenv("OPENROUTER_API_KEY") != "" && os.Getenv("LLM_MODEL") != "" || IsLocal("")
+}
 
-	// Add contextual prompt
-	prompt := fmt.Sprintf(`
-You are a security analyst. Summarize the following Trivy JSON scan result for terminal display.
+func Summarize(trivyJSON string) (string, error) {
+	return SummarizeContext(context.Background(), "", trivyJSON)
+}
 
-Only output plain text.
-Avoid any Markdown formatting like **, backticks, or bullet symbols like '*'.
-Use simple dashes (-), colons (:), and line breaks for clarity.
+// SummarizeContext is Summarize with a context and an optional model
+// override; an empty model uses LLM_MODEL.
+func SummarizeContext(ctx context.Context, model, trivyJSON string) (string, error) {
+	return Chat(ctx, model, SummaryMessages(trivyJSON, 0))
+}
 
-Include these sections:
-1. Overall Risk Level
-2. Summary of Detected Vulnerabilities
-3. Recommendations
-4. Action Items (Critical and Best Practice)
+// SummaryMessages builds the chat messages used to summarize a Trivy report
+// from which omitted findings were left out.
+func SummaryMessages(trivyJSON string, omitted int) []Message {
+	return SummaryMessagesWith(CurrentPrompts(), trivyJSON, omitted)
+}
 
-Scan Output:
-%s
-`, trivyJSON)
+// SummaryMessagesWith is SummaryMessages with the given prompts.
+func SummaryMessagesWith(p *Prompts, trivyJSON string, omitted int) []Message {
+	data := summaryData{Report: trivyJSON, Omitted: omitted}
+	var prompt strings.Builder
+	if err := p.Summary.Execute(&prompt, data); err != nil {
+		// Templates are checked when loaded; fall back rather than send half
+		// a prompt.
+		prompt.Reset()
+		_ = defaultSummary.Execute(&prompt, data)
+	}
 
-	reqBody := ChatRequest{
-		Model: model,
-		Messages: []Message{
-			{
-				Role:    "system",
-				Content: "You are a security analyst. Output must be clean, plain text only. Absolutely no Markdown like **, backticks, or bullet symbols. Use '-' and ':' for listing.",
-			},
-			{
-				Role:    "user",
-				Content: prompt,
-			},
+	return []Message{
+		{
+			Role:    "system",
+			Content: p.SummarySystem,
+		},
+		{
+			Role:    "user",
+			Content: prompt.String(),
 		},
 	}
+}
 
-	jsonData, err := json.Marshal(reqBody)
-	if err != nil {
-		return "", fmt.Errorf("failed to marshal request: %w", err)
+// EstimateTokens roughly estimates the prompt tokens of messages, assuming
+// about four characters per token.
+func EstimateTokens(messages []Message) int {
+	chars := 0
+	for _, m := range messages {
+		chars += len(m.Content)
 	}
+	return (chars + 3) / 4
+}
 
-	req, err := http.NewRequest("POST", openRouterURL, bytes.NewBuffer(jsonData))
-	if err != nil {
-		return "", fmt.Errorf("failed to create request: %w", err)
+// Chat sends a chat completion request to OpenRouter and returns the content
+// of the first choice. An empty model uses LLM_MODEL.
+func Chat(ctx context.Context, model string, messages []Message) (string, error) {
+	content, _, err := chat(ctx, model, messages, false)
+	return content, err
+}
+
+// ChatReasoning is Chat that also returns the model's reasoning, empty for
+// models that do not expose it.
+func ChatReasoning(ctx context.Context, model string, messages []Message) (content, reasoning string, err error) {
+	return chat(ctx, model, messages, true)
+}
+
+func chat(ctx context.Context, model string, messages []Message, reasoning bool) (_, _ string, err error) {
+	apiKey := os.Getenv("OPENROUTER_API_KEY")
+	if model == "" {
+		model = os.Getenv("LLM_MODEL")
 	}
 
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+apiKey)
-	req.Header.Set("X-Title", "weekly-sec-ai")
-	req.Header.Set("HTTP-Referer", "http://localhost")
+	ctx, span := tracing.Start(ctx, "llm.chat", attribute.String("llm.model", model))
+	defer func() { tracing.End(span, err) }()
 
-	client := &http.Client{Timeout: 90 * time.Second}
-	resp, err := client.Do(req)
-	if err != nil {
-		return "", fmt.Errorf("failed to send request: %w", err)
+	if m := mock; m != nil {
+		content, err := m.chat(ctx, messages)
+		return content, "", err
+	}
+	url := openRouterURL
+	if IsLocal(model) {
+		url, apiKey = local.URL, local.APIKey
+		span.SetAttributes(attribute.Bool("llm.local", true))
+	} else if apiKey == "" || model == "" {
+		return "", "", ErrNotConfigured
+	}
+
+	reqBody := ChatRequest{
+		Model:            model,
+		Messages:         messages,
+		IncludeReasoning: reasoning,
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	jsonData, err := json.Marshal(reqBody)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to marshal request: %w", err)
 	}
 
 	var response ChatResponse
-	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
-		return "", fmt.Errorf("failed to decode response: %w", err)
+	if err := call(ctx, http.MethodPost, url, apiKey, jsonData, &response); err != nil {
+		return "", "", err
 	}
 
 	if len(response.Choices) == 0 {
-		return "", errors.New("no response choices returned from LLM")
+		return "", "", errcode.New(errcode.LLMUnavailable, "no response choices returned from LLM")
+	}
+
+	msg := response.Choices[0].Message
+	return msg.Content, msg.Reasoning, nil
+}
+
+// Ping checks that OpenRouter is configured and reachable.
+func Ping(ctx context.Context) error {
+	if !Configured() {
+		return ErrNotConfigured
+	}
+	// Local endpoints have no standard listing to check.
+	if mock != nil || IsLocal("") {
+		return nil
 	}
 
-	return response.Choices[0].Message.Content, nil
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	return call(ctx, http.MethodGet, openRouterModelsURL, os.Getenv("OPENROUTER_API_KEY"), nil, nil)
+}
+
+func statusError(status int) error {
+	err := fmt.Errorf("unexpected status code: %d", status)
+	switch {
+	case status == http.StatusTooManyRequests:
+		return errcode.Wrap(errcode.LLMRateLimited, err)
+	case status == http.StatusPaymentRequired:
+		return errcode.Wrap(errcode.BudgetExceeded, err)
+	default:
+		return errcode.Wrap(errcode.LLMUnavailable, err)
+	}
 }
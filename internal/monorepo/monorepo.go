@@ -0,0 +1,148 @@
+// Package monorepo finds the scannable components of a repository checked
+// out on disk: Dockerfiles, Helm charts and dependency lockfiles, each
+// scanned on its own and rolled up into one report for the repository.
+package monorepo
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"weeklysec/internal/agent"
+)
+
+// Component kinds.
+const (
+	KindDockerfile = "dockerfile"
+	KindChart      = "chart"
+	KindLockfile   = "lockfile"
+)
+
+// lockfiles are the dependency manifests Trivy reads for vulnerabilities.
+var lockfiles = []string{
+	"package-lock.json", "yarn.lock", "pnpm-lock.yaml",
+	"go.mod",
+	"requirements.txt", "Pipfile.lock", "poetry.lock", "uv.lock",
+	"Gemfile.lock", "Cargo.lock", "composer.lock",
+	"pom.xml", "gradle.lockfile", "packages.lock.json",
+}
+
+// skipDirs are never descended into: vendored or generated trees whose
+// findings belong to their upstream.
+var skipDirs = []string{"node_modules", "vendor", "testdata", "third_party"}
+
+// ErrTooManyComponents is returned by Discover when a repository has more
+// components than it may scan.
+var ErrTooManyComponents = errors.New("too many components")
+
+// Component is one scannable part of a repository.
+type Component struct {
+	Path       string `json:"path"` // relative to the repository root, "." for the root
+	Kind       string `json:"kind"`
+	TargetType string `json:"target_type"` // "file" for config checks, "fs" for lockfiles
+}
+
+// Discover walks the repository at root and returns its components in path
+// order. Hidden directories and vendored trees are skipped, and so are
+// symlinks. It fails with ErrTooManyComponents past max, unless max is 0.
+func Discover(root string, max int) ([]Component, error) {
+	var out []Component
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(root, p)
+		rel = filepath.ToSlash(rel)
+		name := d.Name()
+
+		var c Component
+		switch {
+		case d.IsDir() && p != root && (strings.HasPrefix(name, ".") || slices.Contains(skipDirs, name)):
+			return fs.SkipDir
+		case d.IsDir():
+			if !isFile(filepath.Join(p, "Chart.yaml")) {
+				return nil
+			}
+			// A chart is scanned as a whole, subcharts included.
+			out = append(out, Component{Path: rel, Kind: KindChart, TargetType: "file"})
+			if max > 0 && len(out) > max {
+				return ErrTooManyComponents
+			}
+			if p != root {
+				return fs.SkipDir
+			}
+			return nil
+		case !d.Type().IsRegular():
+			return nil
+		case isDockerfile(name):
+			c = Component{Path: rel, Kind: KindDockerfile, TargetType: "file"}
+		case slices.Contains(lockfiles, name):
+			c = Component{Path: rel, Kind: KindLockfile, TargetType: "fs"}
+		default:
+			return nil
+		}
+		out = append(out, c)
+		if max > 0 && len(out) > max {
+			return ErrTooManyComponents
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func isDockerfile(name string) bool {
+	lower := strings.ToLower(name)
+	return lower == "dockerfile" || strings.HasPrefix(lower, "dockerfile.") || strings.HasSuffix(lower, ".dockerfile") ||
+		lower == "containerfile"
+}
+
+func isFile(p string) bool {
+	info, err := os.Lstat(p)
+	return err == nil && info.Mode().IsRegular()
+}
+
+// Result is the outcome of scanning one component.
+type Result struct {
+	Component
+	ScanID   string               `json:"scan_id,omitempty"`
+	Status   string               `json:"status"`
+	Error    string               `json:"error,omitempty"`
+	Analysis *agent.Analysis      `json:"analysis,omitempty"`
+	Response *agent.AgentResponse `json:"-"`
+}
+
+// Report is the repository-level view of a monorepo scan.
+type Report struct {
+	Target      string                     `json:"target"`
+	Status      string                     `json:"status"` // completed, partial when some components failed, failed when all did
+	Components  []Result                   `json:"components"`
+	Analysis    *agent.Analysis            `json:"analysis"`
+	Prioritized []agent.PrioritizedFinding `json:"prioritized,omitempty"`
+	Remediation *agent.RemediationPackage  `json:"remediation"`
+}
+
+// Rollup builds the report of a repository from its component results.
+func Rollup(target string, results []Result) *Report {
+	r := &Report{Target: target, Components: results, Status: agent.StatusCompleted}
+	var parts []*agent.AgentResponse
+	failed := 0
+	for _, res := range results {
+		if res.Status == agent.StatusFailed {
+			failed++
+		}
+		parts = append(parts, res.Response)
+	}
+	switch {
+	case len(results) > 0 && failed == len(results):
+		r.Status = agent.StatusFailed
+	case failed > 0:
+		r.Status = agent.StatusPartial
+	}
+	r.Analysis, r.Prioritized, r.Remediation = agent.Rollup(target, parts)
+	return r
+}
@@ -0,0 +1,135 @@
+// Package mttr measures how long findings take to remediate, from their
+// lifecycle: the KPI security programs report on.
+package mttr
+
+import (
+	"cmp"
+	"math"
+	"slices"
+	"time"
+	"weeklysec/internal/store"
+	"weeklysec/internal/trivy"
+)
+
+// DefaultWindow is how far back fixes are counted when no window is given.
+const DefaultWindow = 90 * 24 * time.Hour
+
+// Quantiles are the percentiles of Stats, as fractions.
+var Quantiles = []float64{0.5, 0.9, 0.95}
+
+// Stats describes the time to remediate of a group of fixes, in days
+// rounded to one decimal. Quantile and Sum need the durations Compute
+// collected, so a Stats decoded from JSON has only its fields.
+type Stats struct {
+	Fixed    int     `json:"fixed"`
+	MeanDays float64 `json:"mean_days"`
+	P50Days  float64 `json:"p50_days"`
+	P90Days  float64 `json:"p90_days"`
+	P95Days  float64 `json:"p95_days"`
+	MaxDays  float64 `json:"max_days"`
+
+	durations []time.Duration
+}
+
+// Quantile returns the q-th quantile of the fixes, by nearest rank, in
+// days. It is 0 when there are none.
+func (s *Stats) Quantile(q float64) float64 {
+	if len(s.durations) == 0 {
+		return 0
+	}
+	ds := slices.Clone(s.durations)
+	slices.Sort(ds)
+	rank := int(math.Ceil(q*float64(len(ds)))) - 1
+	return days(ds[max(rank, 0)])
+}
+
+// Sum is the time the fixes were open in total, in days, unrounded.
+func (s *Stats) Sum() float64 {
+	var total time.Duration
+	for _, d := range s.durations {
+		total += d
+	}
+	return total.Hours() / 24
+}
+
+func (s *Stats) add(d time.Duration) {
+	s.durations = append(s.durations, d)
+}
+
+func (s *Stats) finish() {
+	s.Fixed = len(s.durations)
+	if s.Fixed == 0 {
+		return
+	}
+	s.MeanDays = math.Round(s.Sum()/float64(s.Fixed)*10) / 10
+	s.P50Days = s.Quantile(0.5)
+	s.P90Days = s.Quantile(0.9)
+	s.P95Days = s.Quantile(0.95)
+	s.MaxDays = s.Quantile(1)
+}
+
+// Report is the time to remediate of the fixes made in [Since, Until],
+// overall and by severity, team and target. Groups without fixes are
+// left out.
+type Report struct {
+	Since      time.Time         `json:"since"`
+	Until      time.Time         `json:"until"`
+	Overall    *Stats            `json:"overall"`
+	BySeverity map[string]*Stats `json:"by_severity"`
+	ByTeam     map[string]*Stats `json:"by_team"`
+	ByTarget   map[string]*Stats `json:"by_target"`
+}
+
+// Each calls fn with every fix of findings made in [since, until] and the
+// team owning the finding's target. teams maps target IDs to their owning
+// team; targets without one count as store.Unassigned. A finding fixed,
+// reopened and fixed again counts each time. It is what Compute measures,
+// for callers grouping the fixes their own way.
+func Each(findings []store.Finding, teams map[string]string, since, until time.Time, fn func(f store.Finding, team string, x store.Fix)) {
+	for _, f := range findings {
+		team := cmp.Or(teams[f.TargetID], store.Unassigned)
+		for _, x := range f.Fixes() {
+			if !x.Fixed.Before(since) && !x.Fixed.After(until) {
+				fn(f, team, x)
+			}
+		}
+	}
+}
+
+// Compute measures the fixes of findings made in [since, until], teams as
+// for Each.
+func Compute(findings []store.Finding, teams map[string]string, since, until time.Time) *Report {
+	r := &Report{
+		Since:      since,
+		Until:      until,
+		Overall:    &Stats{},
+		BySeverity: map[string]*Stats{},
+		ByTeam:     map[string]*Stats{},
+		ByTarget:   map[string]*Stats{},
+	}
+	group := func(m map[string]*Stats, key string) *Stats {
+		s, ok := m[key]
+		if !ok {
+			s = &Stats{}
+			m[key] = s
+		}
+		return s
+	}
+	Each(findings, teams, since, until, func(f store.Finding, team string, x store.Fix) {
+		sev := trivy.Severities[trivy.SeverityRank(f.Severity)]
+		for _, s := range []*Stats{r.Overall, group(r.BySeverity, sev), group(r.ByTeam, team), group(r.ByTarget, f.Target)} {
+			s.add(x.Duration())
+		}
+	})
+	r.Overall.finish()
+	for _, m := range []map[string]*Stats{r.BySeverity, r.ByTeam, r.ByTarget} {
+		for _, s := range m {
+			s.finish()
+		}
+	}
+	return r
+}
+
+func days(d time.Duration) float64 {
+	return math.Round(d.Hours()/24*10) / 10
+}
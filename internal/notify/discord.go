@@ -0,0 +1,67 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// discordLimit is Discord's limit on embed descriptions.
+const discordLimit = 4096
+
+// Discord posts embeds to a Discord webhook URL.
+type Discord struct {
+	WebhookURL string
+}
+
+func (d *Discord) Name() string { return "discord" }
+
+func (d *Discord) NotifyScan(ctx context.Context, n ScanNotice) error {
+	return postJSON(ctx, "discord", d.WebhookURL, discordEmbed(scanMessage(n)))
+}
+
+func (d *Discord) NotifyDigest(ctx context.Context, n DigestNotice) error {
+	return postJSON(ctx, "discord", d.WebhookURL, discordEmbed(digestMessage(n)))
+}
+
+func (d *Discord) NotifyStale(ctx context.Context, n StaleNotice) error {
+	return postJSON(ctx, "discord", d.WebhookURL, discordEmbed(staleMessage(n)))
+}
+
+func discordEmbed(m message) map[string]any {
+	color := map[string]int{levelGood: 0x2eb67d, levelWarning: 0xecb22e, levelBad: 0xe01e5a}[m.Level]
+
+	var b strings.Builder
+	if m.Error != "" {
+		fmt.Fprintf(&b, "> %s\n\n", m.Error)
+	}
+	if len(m.List) > 0 {
+		fmt.Fprintf(&b, "**%s**\n", m.ListTitle)
+		for _, item := range m.List {
+			fmt.Fprintf(&b, "- %s\n", item)
+		}
+	}
+	for _, l := range m.Links {
+		fmt.Fprintf(&b, "[%s](%s)\n", l.Text, l.URL)
+	}
+	desc := b.String()
+	if len(desc) > discordLimit {
+		desc = desc[:discordLimit-1] + "…"
+	}
+
+	fields := make([]map[string]any, len(m.Facts))
+	for i, f := range m.Facts {
+		fields[i] = map[string]any{"name": f.Name, "value": f.Value, "inline": true}
+	}
+	embed := map[string]any{
+		"title":       m.Title,
+		"description": desc,
+		"color":       color,
+		"fields":      fields,
+		"footer":      map[string]string{"text": m.Subtitle},
+	}
+	if len(m.Links) > 0 {
+		embed["url"] = m.Links[len(m.Links)-1].URL
+	}
+	return map[string]any{"embeds": []map[string]any{embed}}
+}
@@ -0,0 +1,173 @@
+package notify
+
+import (
+	"cmp"
+	"fmt"
+	"strings"
+	"weeklysec/internal/agent"
+	"weeklysec/internal/digest"
+	"weeklysec/internal/freshness"
+	"weeklysec/internal/trivy"
+)
+
+// Message levels, mapped to colors or icons by each notifier.
+const (
+	levelGood    = "good"
+	levelWarning = "warning"
+	levelBad     = "bad"
+)
+
+// message is the platform-neutral content every notifier renders.
+type message struct {
+	Title     string
+	Subtitle  string
+	Level     string
+	Error     string
+	Facts     []fact
+	ListTitle string
+	List      []string
+	Links     []link
+}
+
+type fact struct{ Name, Value string }
+
+type link struct{ Text, URL string }
+
+func scanMessage(n ScanNotice) message {
+	resp := n.Response
+	m := message{
+		Title:    fmt.Sprintf("Scan %s: %s", resp.Status, resp.Target),
+		Subtitle: n.Org + "/" + n.Project,
+		Level:    levelGood,
+		Error:    resp.Error,
+	}
+	switch resp.Status {
+	case agent.StatusFailed:
+		m.Level = levelBad
+	case agent.StatusPartial:
+		m.Level = levelWarning
+	}
+
+	if a := resp.Analysis; a != nil {
+		m.Facts = append(m.Facts,
+			fact{"Risk score", fmt.Sprintf("%.1f", a.RiskScore)},
+			fact{"Vulnerabilities", fmt.Sprintf("%d (%d fixable)", a.TotalVulnerabilities, a.Fixable)},
+			fact{"By severity", severityLine(a.BySeverity)},
+		)
+	}
+	if rem := resp.Remediation; rem != nil && len(rem.Fixes) > 0 {
+		m.ListTitle = "Top fixes"
+		for i, fix := range rem.Fixes {
+			if i == TopFixes {
+				m.List = append(m.List, fmt.Sprintf("… and %d more", len(rem.Fixes)-TopFixes))
+				break
+			}
+			m.List = append(m.List, fmt.Sprintf("P%d %s", fix.Priority, fix.Description))
+		}
+	}
+	if pr := resp.PullRequest; pr != nil {
+		m.Links = append(m.Links, link{fmt.Sprintf("Pull request %s#%d", pr.Repo, pr.Number), pr.URL})
+	}
+	if n.ReportURL != "" {
+		m.Links = append(m.Links, link{"Full report", n.ReportURL})
+	}
+	return m
+}
+
+func digestMessage(n DigestNotice) message {
+	d := n.Digest
+	m := message{
+		Title:    "Security digest for " + d.Org,
+		Subtitle: d.PeriodStart.Format("Jan 2") + " – " + d.PeriodEnd.Format("Jan 2"),
+		Level:    levelGood,
+		Facts: []fact{
+			{"Targets scanned", fmt.Sprint(d.TargetsScanned)},
+			{"Targets missed", fmt.Sprint(d.TargetsMissed)},
+			{"Fleet risk score", fmt.Sprintf("%.1f", d.FleetRiskScore)},
+			{"By severity", severityLine(d.BySeverity)},
+		},
+	}
+	if len(d.NewCriticals) > 0 {
+		m.Level = levelWarning
+		m.Facts = append(m.Facts, fact{"New criticals", fmt.Sprint(len(d.NewCriticals))})
+	}
+	if len(d.SLABreaches) > 0 {
+		m.Level = levelBad
+		m.Facts = append(m.Facts, fact{"SLA breaches", fmt.Sprint(len(d.SLABreaches))})
+	}
+	if len(d.FixLeverage) > 0 {
+		a := d.FixLeverage[0]
+		action := "Upgrade " + a.Subject + " to " + a.Version
+		if a.Action == digest.ActionBaseImage {
+			action = "Update base image " + a.Subject
+		}
+		m.Facts = append(m.Facts, fact{"Biggest win", fmt.Sprintf("%s: %d findings in %d targets", action, a.Findings, len(a.Targets))})
+	}
+	if len(d.TopIssues) > 0 {
+		m.ListTitle = "Top issues"
+		for i, is := range d.TopIssues {
+			if i == TopFixes {
+				break
+			}
+			fix := "no fix yet"
+			if is.Fixable {
+				fix = "fixable"
+			}
+			m.List = append(m.List, fmt.Sprintf("%s (%s, %s) on %d targets", is.VulnerabilityID, is.Severity, fix, len(is.Targets)))
+		}
+	}
+	if n.ReportURL != "" {
+		m.Links = append(m.Links, link{"Full digest", n.ReportURL})
+	}
+	return m
+}
+
+func staleMessage(n StaleNotice) message {
+	r := n.Report
+	m := message{
+		Title:    fmt.Sprintf("%d stale targets in %s", len(r.Stale), r.Org),
+		Subtitle: fmt.Sprintf("Not scanned successfully in %g days", r.SLODays),
+		Level:    levelWarning,
+		Facts:    []fact{{"Stale targets", fmt.Sprintf("%d of %d", len(r.Stale), r.Checked)}},
+	}
+	if len(r.Stale) > 0 {
+		s := r.Stale[0]
+		m.Facts = append(m.Facts, fact{"Longest stale", fmt.Sprintf("%s (%g days)", cmp.Or(s.Name, s.Target), s.StaleDays)})
+	}
+	m.ListTitle = "Why"
+	for i, g := range r.Groups {
+		if g.Cause != freshness.NotAttempted {
+			m.Level = levelBad
+		}
+		if i == TopFixes {
+			m.List = append(m.List, fmt.Sprintf("… and %d more", len(r.Groups)-TopFixes))
+			continue
+		}
+		switch {
+		case g.Cause == freshness.NotAttempted:
+			m.List = append(m.List, fmt.Sprintf("%d %s targets: no scan attempted", g.Targets, g.TargetType))
+		case g.LastError != "":
+			m.List = append(m.List, fmt.Sprintf("%d %s targets: %s (%s)", g.Targets, g.TargetType, strings.ReplaceAll(g.Cause, "_", " "), truncate(g.LastError, 200)))
+		default:
+			m.List = append(m.List, fmt.Sprintf("%d %s targets: %s", g.Targets, g.TargetType, strings.ReplaceAll(g.Cause, "_", " ")))
+		}
+	}
+	if n.ReportURL != "" {
+		m.Links = append(m.Links, link{"Stale targets", n.ReportURL})
+	}
+	return m
+}
+
+// severityLine renders counts as "2 critical, 1 high", skipping zeros.
+func severityLine(counts map[string]int) string {
+	var parts []string
+	for _, sev := range trivy.Severities {
+		if c := counts[sev]; c > 0 {
+			parts = append(parts, fmt.Sprintf("%d %s", c, strings.ToLower(sev)))
+		}
+	}
+	if len(parts) == 0 {
+		return "none"
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,141 @@
+// Package notify posts human-readable scan summaries and digests to chat
+// services. Unlike webhooks, which carry the raw events, notifiers format
+// messages for people.
+package notify
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+	"weeklysec/internal/agent"
+	"weeklysec/internal/digest"
+	"weeklysec/internal/freshness"
+	"weeklysec/internal/store"
+
+	"github.com/rs/zerolog"
+)
+
+// httpClient is shared by the notifiers.
+var httpClient = &http.Client{Timeout: 10 * time.Second}
+
+// TopFixes bounds the fixes listed in a scan message.
+const TopFixes = 5
+
+// ScanNotice describes a finished scan.
+type ScanNotice struct {
+	Org       string
+	Project   string
+	Response  *agent.AgentResponse
+	Target    *store.Target // inventory entry, if the scan has one; used for routing
+	ReportURL string        // empty without PUBLIC_URL
+}
+
+// DigestNotice carries a periodic digest.
+type DigestNotice struct {
+	Digest    *digest.Digest
+	ReportURL string
+}
+
+// StaleNotice lists the targets of an org that went stale.
+type StaleNotice struct {
+	Report    *freshness.Report
+	ReportURL string
+}
+
+// Notifier delivers messages to one service.
+type Notifier interface {
+	Name() string
+	NotifyScan(ctx context.Context, n ScanNotice) error
+	NotifyDigest(ctx context.Context, n DigestNotice) error
+	NotifyStale(ctx context.Context, n StaleNotice) error
+}
+
+// Hub fans messages out to every configured notifier in the background. A
+// nil Hub does nothing.
+type Hub struct {
+	mu        sync.RWMutex
+	notifiers []Notifier
+	publicURL string
+}
+
+// NewHub returns a hub linking back to the API at publicURL, if set.
+func NewHub(publicURL string, notifiers ...Notifier) *Hub {
+	return &Hub{notifiers: notifiers, publicURL: strings.TrimRight(publicURL, "/")}
+}
+
+// SetNotifiers replaces the notifiers, e.g. after a configuration reload.
+func (h *Hub) SetNotifiers(notifiers ...Notifier) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.notifiers = notifiers
+}
+
+func (h *Hub) current() []Notifier {
+	if h == nil {
+		return nil
+	}
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.notifiers
+}
+
+// Scan announces a finished scan.
+func (h *Hub) Scan(ctx context.Context, n ScanNotice) {
+	if len(h.current()) == 0 {
+		return
+	}
+	if h.publicURL != "" && n.Response.ScanID != "" {
+		n.ReportURL = h.publicURL + "/api/v1/scans/" + url.PathEscape(n.Response.ScanID) + "?format=markdown"
+	}
+	h.each(ctx, "scan", func(ctx context.Context, nt Notifier) error { return nt.NotifyScan(ctx, n) })
+}
+
+// Digest announces a digest.
+func (h *Hub) Digest(ctx context.Context, d *digest.Digest) {
+	if len(h.current()) == 0 {
+		return
+	}
+	n := DigestNotice{Digest: d}
+	if h.publicURL != "" {
+		q := url.Values{"format": {"markdown"}, "end": {d.PeriodEnd.Format(time.RFC3339)}}
+		n.ReportURL = h.publicURL + "/api/v1/digest?" + q.Encode()
+	}
+	h.each(ctx, "digest", func(ctx context.Context, nt Notifier) error { return nt.NotifyDigest(ctx, n) })
+}
+
+// Stale announces the stale targets of an org.
+func (h *Hub) Stale(ctx context.Context, r *freshness.Report) {
+	if len(h.current()) == 0 {
+		return
+	}
+	n := StaleNotice{Report: r}
+	if h.publicURL != "" {
+		n.ReportURL = h.publicURL + "/api/v1/targets/stale"
+	}
+	h.each(ctx, "stale", func(ctx context.Context, nt Notifier) error { return nt.NotifyStale(ctx, n) })
+}
+
+func (h *Hub) each(ctx context.Context, kind string, fn func(context.Context, Notifier) error) {
+	ctx = context.WithoutCancel(ctx)
+	for _, nt := range h.current() {
+		go func() {
+			if err := fn(ctx, nt); err != nil {
+				zerolog.Ctx(ctx).Error().Err(err).Str("notifier", nt.Name()).Str("kind", kind).Msg("Notification failed")
+			}
+		}()
+	}
+}
+
+// team returns the team owning t: its team field, else its "team" label.
+func team(t *store.Target) string {
+	if t == nil {
+		return ""
+	}
+	if t.Team != "" {
+		return t.Team
+	}
+	return t.Labels["team"]
+}
@@ -0,0 +1,203 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+	"weeklysec/internal/agent"
+	"weeklysec/internal/childenv"
+	"weeklysec/internal/digest"
+	"weeklysec/internal/freshness"
+)
+
+// Payload is what the out-of-tree adapters hand over: the rendered message,
+// a plain-text version of it for services that only take text, and the
+// scan or digest it was rendered from.
+type Payload struct {
+	Kind      string   `json:"kind"` // "scan", "digest" or "stale"
+	Title     string   `json:"title"`
+	Subtitle  string   `json:"subtitle,omitempty"`
+	Level     string   `json:"level"` // "good", "warning" or "bad"
+	Error     string   `json:"error,omitempty"`
+	Facts     []Fact   `json:"facts,omitempty"`
+	ListTitle string   `json:"list_title,omitempty"`
+	List      []string `json:"list,omitempty"`
+	Links     []Link   `json:"links,omitempty"`
+	Text      string   `json:"text"`
+
+	Org       string               `json:"org,omitempty"`
+	Project   string               `json:"project,omitempty"`
+	ReportURL string               `json:"report_url,omitempty"`
+	Scan      *agent.AgentResponse `json:"scan,omitempty"`
+	Digest    *digest.Digest       `json:"digest,omitempty"`
+	Stale     *freshness.Report    `json:"stale,omitempty"`
+}
+
+// Fact is a name/value pair of a Payload.
+type Fact struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// Link is a link of a Payload.
+type Link struct {
+	Text string `json:"text"`
+	URL  string `json:"url"`
+}
+
+// ScanPayload returns the payload of a scan notice.
+func ScanPayload(n ScanNotice) Payload {
+	p := newPayload("scan", scanMessage(n))
+	p.Org, p.Project, p.ReportURL, p.Scan = n.Org, n.Project, n.ReportURL, n.Response
+	return p
+}
+
+// DigestPayload returns the payload of a digest notice.
+func DigestPayload(n DigestNotice) Payload {
+	p := newPayload("digest", digestMessage(n))
+	p.Org, p.ReportURL, p.Digest = n.Digest.Org, n.ReportURL, n.Digest
+	return p
+}
+
+// StalePayload returns the payload of a stale targets notice.
+func StalePayload(n StaleNotice) Payload {
+	p := newPayload("stale", staleMessage(n))
+	p.Org, p.ReportURL, p.Stale = n.Report.Org, n.ReportURL, n.Report
+	return p
+}
+
+func newPayload(kind string, m message) Payload {
+	p := Payload{
+		Kind:      kind,
+		Title:     m.Title,
+		Subtitle:  m.Subtitle,
+		Level:     m.Level,
+		Error:     m.Error,
+		ListTitle: m.ListTitle,
+		List:      m.List,
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s (%s)\n", m.Title, m.Subtitle)
+	if m.Error != "" {
+		fmt.Fprintf(&b, "%s\n", m.Error)
+	}
+	for _, f := range m.Facts {
+		p.Facts = append(p.Facts, Fact{f.Name, f.Value})
+		fmt.Fprintf(&b, "%s: %s\n", f.Name, f.Value)
+	}
+	if len(m.List) > 0 {
+		fmt.Fprintf(&b, "%s:\n", m.ListTitle)
+		for _, item := range m.List {
+			fmt.Fprintf(&b, "- %s\n", item)
+		}
+	}
+	for _, l := range m.Links {
+		p.Links = append(p.Links, Link{l.Text, l.URL})
+		fmt.Fprintf(&b, "%s: %s\n", l.Text, l.URL)
+	}
+	p.Text = strings.TrimRight(b.String(), "\n")
+	return p
+}
+
+// Exec runs a command for every message with its Payload as JSON on
+// stdin, so destinations without built-in support can be scripted. The
+// command is run directly, not through a shell, with none of the server's
+// environment but the variables Env names; a non-zero exit fails the
+// notification.
+type Exec struct {
+	Label   string   // names the notifier in logs
+	Command []string // program and arguments
+	Timeout time.Duration
+
+	// Env lists the variables the command inherits, with "PREFIX_*"
+	// matching every variable starting with PREFIX_; nil passes
+	// DefaultExecEnv.
+	Env []string
+}
+
+// DefaultExecEnv passes a command what it needs to run and reach the
+// network, and none of the server's credentials. Scripts that need their
+// own can read them from variables prefixed WEEKLYSEC_NOTIFY_.
+var DefaultExecEnv = slices.Concat(childenv.Base, []string{"WEEKLYSEC_NOTIFY_*"})
+
+func (e *Exec) Name() string { return "exec:" + e.Label }
+
+func (e *Exec) NotifyScan(ctx context.Context, n ScanNotice) error {
+	return e.run(ctx, ScanPayload(n))
+}
+
+func (e *Exec) NotifyDigest(ctx context.Context, n DigestNotice) error {
+	return e.run(ctx, DigestPayload(n))
+}
+
+func (e *Exec) NotifyStale(ctx context.Context, n StaleNotice) error {
+	return e.run(ctx, StalePayload(n))
+}
+
+func (e *Exec) run(ctx context.Context, p Payload) error {
+	if len(e.Command) == 0 {
+		return fmt.Errorf("%s: no command", e.Name())
+	}
+	body, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	if e.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, e.Timeout)
+		defer cancel()
+	}
+
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, e.Command[0], e.Command[1:]...)
+	cmd.Stdin = bytes.NewReader(body)
+	cmd.Stderr = &stderr
+	names := e.Env
+	if names == nil {
+		names = DefaultExecEnv
+	}
+	cmd.Env = append(childenv.Environ(names), "WEEKLYSEC_EVENT="+p.Kind)
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return fmt.Errorf("%s: %w: %s", e.Name(), err, truncate(msg, 500))
+		}
+		return fmt.Errorf("%s: %w", e.Name(), err)
+	}
+	return nil
+}
+
+// HTTP posts every message's Payload as JSON to a URL. Services that take
+// a "text" field, such as Mattermost incoming webhooks, work as is; others
+// can put a small relay in front.
+type HTTP struct {
+	Label string // names the notifier in logs
+	URL   string
+}
+
+func (h *HTTP) Name() string { return "webhook:" + h.Label }
+
+func (h *HTTP) NotifyScan(ctx context.Context, n ScanNotice) error {
+	return postJSON(ctx, h.Name(), h.URL, ScanPayload(n))
+}
+
+func (h *HTTP) NotifyDigest(ctx context.Context, n DigestNotice) error {
+	return postJSON(ctx, h.Name(), h.URL, DigestPayload(n))
+}
+
+func (h *HTTP) NotifyStale(ctx context.Context, n StaleNotice) error {
+	return postJSON(ctx, h.Name(), h.URL, StalePayload(n))
+}
+
+// truncate cuts s to at most n runes, marking the cut with an ellipsis.
+func truncate(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return string([]rune(s)[:n-1]) + "…"
+}
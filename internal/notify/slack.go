@@ -0,0 +1,140 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"weeklysec/internal/store"
+)
+
+// DefaultSlackAPIURL is Slack's Web API.
+const DefaultSlackAPIURL = "https://slack.com/api"
+
+// Slack posts through an incoming webhook or a bot token. Scan messages are
+// routed to the channel named by the target's RouteLabel label, else to the
+// channel of its team in Routes, else to the default destination. Routes
+// and labels may name a channel (which needs a bot token) or an incoming
+// webhook URL. Digests go to the default destination.
+type Slack struct {
+	WebhookURL string            // default destination without a token
+	Token      string            // bot token for chat.postMessage
+	Channel    string            // default channel with a token
+	Routes     map[string]string // team to channel or webhook URL
+	RouteLabel string            // target label naming a channel or webhook URL
+	APIURL     string            // DefaultSlackAPIURL when empty
+}
+
+func (s *Slack) Name() string { return "slack" }
+
+func (s *Slack) NotifyScan(ctx context.Context, n ScanNotice) error {
+	return s.post(ctx, s.route(n.Target), slackText(scanMessage(n)))
+}
+
+func (s *Slack) NotifyDigest(ctx context.Context, n DigestNotice) error {
+	return s.post(ctx, "", slackText(digestMessage(n)))
+}
+
+func (s *Slack) NotifyStale(ctx context.Context, n StaleNotice) error {
+	return s.post(ctx, "", slackText(staleMessage(n)))
+}
+
+func (s *Slack) route(t *store.Target) string {
+	if t == nil {
+		return ""
+	}
+	if dest := t.Labels[s.RouteLabel]; s.RouteLabel != "" && dest != "" {
+		return dest
+	}
+	return s.Routes[team(t)]
+}
+
+// post sends text to dest, a channel or webhook URL; empty means the
+// default destination.
+func (s *Slack) post(ctx context.Context, dest, text string) error {
+	var endpoint string
+	body := map[string]any{"text": text, "unfurl_links": false}
+	switch {
+	case strings.HasPrefix(dest, "https://"):
+		endpoint = dest
+	case dest == "" && s.Token == "":
+		endpoint = s.WebhookURL
+	default:
+		if s.Token == "" {
+			return fmt.Errorf("slack: routing to channel %q needs a bot token", dest)
+		}
+		if dest == "" {
+			dest = s.Channel
+		}
+		api := s.APIURL
+		if api == "" {
+			api = DefaultSlackAPIURL
+		}
+		endpoint = strings.TrimRight(api, "/") + "/chat.postMessage"
+		body["channel"] = dest
+	}
+	if endpoint == "" {
+		return fmt.Errorf("slack: no destination configured")
+	}
+
+	b, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	if body["channel"] != nil {
+		req.Header.Set("Authorization", "Bearer "+s.Token)
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("slack: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("slack: unexpected status %s", resp.Status)
+	}
+	// The Web API reports failures in the body; webhooks answer "ok".
+	if body["channel"] != nil {
+		var out struct {
+			OK    bool   `json:"ok"`
+			Error string `json:"error"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+			return fmt.Errorf("slack: invalid response: %w", err)
+		}
+		if !out.OK {
+			return fmt.Errorf("slack: %s", out.Error)
+		}
+	}
+	return nil
+}
+
+// slackText renders m as Slack mrkdwn.
+func slackText(m message) string {
+	icon := map[string]string{levelGood: ":white_check_mark:", levelWarning: ":warning:", levelBad: ":x:"}[m.Level]
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s *%s* (%s)\n", icon, m.Title, m.Subtitle)
+	if m.Error != "" {
+		fmt.Fprintf(&b, "> %s\n", m.Error)
+	}
+	for _, f := range m.Facts {
+		fmt.Fprintf(&b, "%s: *%s*\n", f.Name, f.Value)
+	}
+	if len(m.List) > 0 {
+		fmt.Fprintf(&b, "*%s*\n", m.ListTitle)
+		for _, item := range m.List {
+			fmt.Fprintf(&b, "• %s\n", item)
+		}
+	}
+	for _, l := range m.Links {
+		fmt.Fprintf(&b, "<%s|%s>\n", l.URL, l.Text)
+	}
+	return b.String()
+}
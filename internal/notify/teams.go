@@ -0,0 +1,72 @@
+package notify
+
+import (
+	"context"
+	"strings"
+)
+
+// Teams posts Adaptive Cards to a Microsoft Teams incoming webhook or
+// Workflows webhook URL.
+type Teams struct {
+	WebhookURL string
+}
+
+func (t *Teams) Name() string { return "teams" }
+
+func (t *Teams) NotifyScan(ctx context.Context, n ScanNotice) error {
+	return postJSON(ctx, "teams", t.WebhookURL, adaptiveCard(scanMessage(n)))
+}
+
+func (t *Teams) NotifyDigest(ctx context.Context, n DigestNotice) error {
+	return postJSON(ctx, "teams", t.WebhookURL, adaptiveCard(digestMessage(n)))
+}
+
+func (t *Teams) NotifyStale(ctx context.Context, n StaleNotice) error {
+	return postJSON(ctx, "teams", t.WebhookURL, adaptiveCard(staleMessage(n)))
+}
+
+// adaptiveCard wraps m in the message envelope Teams webhooks expect.
+func adaptiveCard(m message) map[string]any {
+	color := map[string]string{levelGood: "Good", levelWarning: "Warning", levelBad: "Attention"}[m.Level]
+	body := []map[string]any{
+		{"type": "TextBlock", "text": m.Title, "weight": "Bolder", "size": "Medium", "color": color, "wrap": true},
+		{"type": "TextBlock", "text": m.Subtitle, "isSubtle": true, "spacing": "None", "wrap": true},
+	}
+	if m.Error != "" {
+		body = append(body, map[string]any{"type": "TextBlock", "text": m.Error, "color": "Attention", "wrap": true})
+	}
+	if len(m.Facts) > 0 {
+		facts := make([]map[string]string, len(m.Facts))
+		for i, f := range m.Facts {
+			facts[i] = map[string]string{"title": f.Name, "value": f.Value}
+		}
+		body = append(body, map[string]any{"type": "FactSet", "facts": facts})
+	}
+	if len(m.List) > 0 {
+		body = append(body,
+			map[string]any{"type": "TextBlock", "text": m.ListTitle, "weight": "Bolder", "wrap": true},
+			map[string]any{"type": "TextBlock", "text": "- " + strings.Join(m.List, "\n- "), "wrap": true},
+		)
+	}
+
+	card := map[string]any{
+		"$schema": "http://adaptivecards.io/schemas/adaptive-card.json",
+		"type":    "AdaptiveCard",
+		"version": "1.4",
+		"body":    body,
+	}
+	if len(m.Links) > 0 {
+		actions := make([]map[string]string, len(m.Links))
+		for i, l := range m.Links {
+			actions[i] = map[string]string{"type": "Action.OpenUrl", "title": l.Text, "url": l.URL}
+		}
+		card["actions"] = actions
+	}
+	return map[string]any{
+		"type": "message",
+		"attachments": []map[string]any{{
+			"contentType": "application/vnd.microsoft.card.adaptive",
+			"content":     card,
+		}},
+	}
+}
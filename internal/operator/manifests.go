@@ -0,0 +1,23 @@
+package operator
+
+import (
+	"bytes"
+	"embed"
+	"io/fs"
+)
+
+//go:embed crds/*.yaml
+var manifests embed.FS
+
+// Manifests returns the CustomResourceDefinitions and the ClusterRoles of
+// the operator and of cluster scans, as one multi-document YAML stream for
+// kubectl apply.
+func Manifests() []byte {
+	files, _ := fs.Glob(manifests, "crds/*.yaml")
+	var docs [][]byte
+	for _, f := range files {
+		b, _ := manifests.ReadFile(f)
+		docs = append(docs, bytes.TrimSpace(b))
+	}
+	return append(bytes.Join(docs, []byte("\n---\n")), '\n')
+}
@@ -0,0 +1,479 @@
+// Package operator manages scan targets through Kubernetes custom
+// resources: ScanTarget objects become inventory targets that the
+// scheduler scans, their latest results are written back to the
+// ScanTarget's status and to a ScanReport, and the workloads they name are
+// annotated with the risk score. ScanPolicy objects supply a schedule and a
+// risk ceiling to the ScanTargets they select.
+package operator
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"reflect"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+	"weeklysec/internal/agent"
+	"weeklysec/internal/digest"
+	"weeklysec/internal/kube"
+	"weeklysec/internal/labels"
+	"weeklysec/internal/scheduler"
+	"weeklysec/internal/store"
+	"weeklysec/internal/trivy"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Labels of the inventory targets the operator owns.
+const (
+	ManagedLabel = "managed-by"
+	managedValue = "weeklysec-operator"
+	uidLabel     = "scantarget-uid"
+)
+
+// AnnotationPrefix starts the annotations written on workloads.
+const AnnotationPrefix = Group + "/"
+
+// retryAfter spaces out scans of a ScanTarget that failed without
+// storing a result.
+const retryAfter = 5 * time.Minute
+
+// reportFindings bounds the findings copied into a ScanReport.
+const reportFindings = 20
+
+// workloadPaths maps the annotatable kinds to their API paths.
+var workloadPaths = map[string]string{
+	"Deployment":  "/apis/apps/v1/namespaces/%s/deployments/%s",
+	"StatefulSet": "/apis/apps/v1/namespaces/%s/statefulsets/%s",
+	"DaemonSet":   "/apis/apps/v1/namespaces/%s/daemonsets/%s",
+	"CronJob":     "/apis/batch/v1/namespaces/%s/cronjobs/%s",
+}
+
+// Options configures an Operator.
+type Options struct {
+	Namespace string // watched namespace; every namespace when empty
+	Org       string // owner of the targets; the namespace is the project
+}
+
+// Operator reconciles the custom resources with the inventory.
+type Operator struct {
+	store  *store.Store
+	client *kube.Client
+	scan   scheduler.ScanFunc
+	opts   Options
+
+	mu        sync.Mutex // serializes Reconcile and guards the maps
+	scanning  map[string]bool
+	attempted map[string]time.Time
+}
+
+// New returns an operator that runs initial scans through scan.
+func New(st *store.Store, client *kube.Client, scan scheduler.ScanFunc, opts Options) *Operator {
+	return &Operator{
+		store:     st,
+		client:    client,
+		scan:      scan,
+		opts:      opts,
+		scanning:  map[string]bool{},
+		attempted: map[string]time.Time{},
+	}
+}
+
+// Run reconciles now and then every interval until stop is closed.
+func (o *Operator) Run(interval time.Duration, stop <-chan struct{}) {
+	reconcile := func() {
+		ctx, cancel := context.WithTimeout(context.Background(), interval)
+		defer cancel()
+		if err := o.Reconcile(ctx); err != nil {
+			log.Error().Err(err).Msg("Operator reconcile failed")
+		}
+	}
+
+	reconcile()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			reconcile()
+		case <-stop:
+			return
+		}
+	}
+}
+
+// Reconcile syncs every ScanTarget once and removes the inventory targets
+// of deleted ones. Errors on single objects are logged and skip them.
+func (o *Operator) Reconcile(ctx context.Context) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	var policies scanPolicyList
+	if err := o.client.Get(ctx, o.collection("scanpolicies"), &policies); err != nil {
+		return fmt.Errorf("failed to list ScanPolicies: %w", err)
+	}
+	var targets scanTargetList
+	if err := o.client.Get(ctx, o.collection("scantargets"), &targets); err != nil {
+		return fmt.Errorf("failed to list ScanTargets: %w", err)
+	}
+	sort.Slice(policies.Items, func(i, j int) bool { return policies.Items[i].Metadata.Name < policies.Items[j].Metadata.Name })
+
+	inventory, err := o.store.ListTargets(store.TargetFilter{Org: o.opts.Org})
+	if err != nil {
+		return fmt.Errorf("failed to list targets: %w", err)
+	}
+	managed := map[string]store.Target{}
+	for _, t := range inventory {
+		if t.Labels[ManagedLabel] == managedValue {
+			managed[t.Labels[uidLabel]] = t
+		}
+	}
+
+	seen := map[string]bool{}
+	for _, st := range targets.Items {
+		seen[st.Metadata.UID] = true
+		existing, ok := managed[st.Metadata.UID]
+		if err := o.reconcileTarget(ctx, st, policies.Items, existing, ok); err != nil {
+			log.Warn().Err(err).
+				Str("namespace", st.Metadata.Namespace).
+				Str("scantarget", st.Metadata.Name).
+				Msg("Failed to reconcile ScanTarget")
+		}
+	}
+
+	for uid, t := range managed {
+		if seen[uid] {
+			continue
+		}
+		if err := o.store.DeleteTarget(t.ID); err != nil {
+			log.Warn().Err(err).Str("target_id", t.ID).Msg("Failed to remove target of deleted ScanTarget")
+			continue
+		}
+		delete(o.attempted, uid)
+		log.Info().Str("target_id", t.ID).Str("target", t.Target).Msg("Removed target of deleted ScanTarget")
+	}
+	return nil
+}
+
+func (o *Operator) reconcileTarget(ctx context.Context, st ScanTarget, policies []ScanPolicy, existing store.Target, found bool) error {
+	status := ScanTargetStatus{ObservedGeneration: st.Metadata.Generation}
+	policy, err := policyFor(st, policies)
+	if err == nil {
+		err = validate(st.Spec)
+	}
+	if err != nil {
+		status.Phase, status.Message = PhaseFailed, err.Error()
+		return o.writeStatus(ctx, st, status)
+	}
+	if policy != nil {
+		status.Policy = policy.Metadata.Name
+	}
+	status.Schedule = st.Spec.Schedule
+	if status.Schedule == "" && policy != nil {
+		status.Schedule = policy.Spec.Schedule
+	}
+
+	t := o.desiredTarget(st, status.Schedule, existing, found)
+	if !found || !sameTarget(t, existing) {
+		if err := o.store.SaveTarget(t); err != nil {
+			return err
+		}
+	}
+	status.TargetID = t.ID
+
+	latest := o.latestScan(t)
+	uid := st.Metadata.UID
+	switch {
+	case o.scanning[uid]:
+		status.Phase = PhaseScanning
+	case latest == nil && time.Since(o.attempted[uid]) >= retryAfter:
+		o.startScan(uid, t)
+		status.Phase = PhaseScanning
+	case latest == nil:
+		status.Phase = PhasePending
+		status.Message = "Last scan failed; retrying"
+	}
+	if latest != nil {
+		o.describe(&status, latest, policy)
+		if st.Status.LastScanID != latest.ID {
+			if err := o.publish(ctx, st, latest, status); err != nil {
+				return err
+			}
+		}
+		status.Report = st.Metadata.Name
+	}
+	return o.writeStatus(ctx, st, status)
+}
+
+// startScan scans t in the background.
+func (o *Operator) startScan(uid string, t store.Target) {
+	o.scanning[uid] = true
+	o.attempted[uid] = time.Now()
+	go func() {
+		err := o.scan(context.Background(), t)
+		if err != nil {
+			log.Warn().Err(err).Str("target_id", t.ID).Msg("Operator scan failed")
+		}
+		o.mu.Lock()
+		delete(o.scanning, uid)
+		if err == nil {
+			delete(o.attempted, uid)
+		}
+		o.mu.Unlock()
+	}()
+}
+
+// desiredTarget returns the inventory target for st, keeping the identity
+// of the existing one.
+func (o *Operator) desiredTarget(st ScanTarget, schedule string, existing store.Target, found bool) store.Target {
+	now := time.Now().UTC()
+	t := store.Target{
+		ID:          store.NewID(),
+		Org:         o.opts.Org,
+		Project:     st.Metadata.Namespace,
+		Name:        st.Metadata.Name,
+		TargetType:  st.Spec.Type,
+		Target:      st.Spec.Target,
+		Team:        st.Spec.Team,
+		Environment: st.Spec.Environment,
+		Criticality: st.Spec.Criticality,
+		Schedule:    schedule,
+		Labels:      map[string]string{},
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	for k, v := range st.Metadata.Labels {
+		if labels.Validate(map[string]string{k: v}) == nil {
+			t.Labels[k] = v
+		}
+	}
+	t.Labels[ManagedLabel] = managedValue
+	t.Labels[uidLabel] = st.Metadata.UID
+	if found {
+		t.ID, t.CreatedAt = existing.ID, existing.CreatedAt
+		if sameTarget(t, existing) {
+			t.UpdatedAt = existing.UpdatedAt
+		}
+	}
+	return t
+}
+
+// sameTarget compares the fields a ScanTarget sets.
+func sameTarget(a, b store.Target) bool {
+	return a.Org == b.Org && a.Project == b.Project && a.Name == b.Name &&
+		a.TargetType == b.TargetType && a.Target == b.Target &&
+		a.Team == b.Team && a.Environment == b.Environment && a.Criticality == b.Criticality &&
+		a.Schedule == b.Schedule && maps.Equal(a.Labels, b.Labels)
+}
+
+// latestScan returns the newest scan of t's current reference, or nil.
+func (o *Operator) latestScan(t store.Target) *store.Scan {
+	scans, err := o.store.ListScans(store.ScanFilter{Org: t.Org, Project: t.Project, Target: t.Target})
+	if err != nil {
+		log.Warn().Err(err).Str("target_id", t.ID).Msg("Failed to list scans")
+		return nil
+	}
+	for _, s := range scans {
+		if s.TargetID == t.ID && s.TargetType == t.TargetType {
+			return s
+		}
+	}
+	return nil
+}
+
+// describe fills the status fields that come from the latest scan.
+func (o *Operator) describe(status *ScanTargetStatus, scan *store.Scan, policy *ScanPolicy) {
+	at := scan.CreatedAt
+	status.LastScanID = scan.ID
+	status.LastScanTime = &at
+	status.RiskScore = digest.RiskScore(scan)
+	status.Vulnerabilities = severityCounts(scan)
+	if status.Phase == "" {
+		status.Phase = PhaseScanned
+		if scan.Response != nil && scan.Response.Status == agent.StatusFailed {
+			status.Phase, status.Message = PhaseFailed, scan.Response.Error
+		}
+	}
+	if policy != nil && policy.Spec.MaxRiskScore > 0 {
+		compliant := status.RiskScore <= policy.Spec.MaxRiskScore
+		status.Compliant = &compliant
+	}
+}
+
+// publish writes the ScanReport and annotates the workloads for a scan
+// the ScanTarget has not reported yet.
+func (o *Operator) publish(ctx context.Context, st ScanTarget, scan *store.Scan, status ScanTargetStatus) error {
+	ns := st.Metadata.Namespace
+	report := ScanReport{
+		APIVersion: APIVersion,
+		Kind:       "ScanReport",
+		Metadata: kube.ObjectMeta{
+			Name:      st.Metadata.Name,
+			Namespace: ns,
+			Labels:    map[string]string{ManagedLabel: managedValue},
+			OwnerReferences: []kube.OwnerReference{{
+				APIVersion: APIVersion,
+				Kind:       "ScanTarget",
+				Name:       st.Metadata.Name,
+				UID:        st.Metadata.UID,
+				Controller: true,
+			}},
+		},
+		Spec: ScanReportSpec{
+			ScanTarget:      st.Metadata.Name,
+			ScanID:          scan.ID,
+			Type:            scan.TargetType,
+			Target:          scan.Target,
+			ScannedAt:       scan.CreatedAt,
+			RiskScore:       status.RiskScore,
+			Vulnerabilities: status.Vulnerabilities,
+			Summary:         scan.Summary,
+			Findings:        reportFindingsOf(scan),
+		},
+	}
+	if scan.Response != nil {
+		report.Spec.Status = scan.Response.Status
+	}
+	path := fmt.Sprintf("/apis/%s/namespaces/%s/scanreports", APIVersion, ns)
+	err := o.client.Patch(ctx, path+"/"+st.Metadata.Name, map[string]any{"spec": report.Spec}, nil)
+	if kube.IsNotFound(err) {
+		err = o.client.Create(ctx, path, report, nil)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write ScanReport: %w", err)
+	}
+
+	annotations := map[string]string{
+		AnnotationPrefix + "risk-score": strconv.FormatFloat(status.RiskScore, 'f', 1, 64),
+		AnnotationPrefix + "critical":   strconv.Itoa(status.Vulnerabilities["CRITICAL"]),
+		AnnotationPrefix + "high":       strconv.Itoa(status.Vulnerabilities["HIGH"]),
+		AnnotationPrefix + "scan-id":    scan.ID,
+		AnnotationPrefix + "scanned-at": scan.CreatedAt.UTC().Format(time.RFC3339),
+	}
+	patch := map[string]any{"metadata": map[string]any{"annotations": annotations}}
+	for _, w := range st.Spec.Workloads {
+		// validate has checked the kind
+		if err := o.client.Patch(ctx, fmt.Sprintf(workloadPaths[w.Kind], ns, w.Name), patch, nil); err != nil {
+			log.Warn().Err(err).
+				Str("namespace", ns).
+				Str("workload", w.Kind+"/"+w.Name).
+				Msg("Failed to annotate workload")
+		}
+	}
+	return nil
+}
+
+// writeStatus patches the status subresource when it changed.
+func (o *Operator) writeStatus(ctx context.Context, st ScanTarget, status ScanTargetStatus) error {
+	if reflect.DeepEqual(normalize(st.Status), normalize(status)) {
+		return nil
+	}
+	path := fmt.Sprintf("/apis/%s/namespaces/%s/scantargets/%s/status", APIVersion, st.Metadata.Namespace, st.Metadata.Name)
+	// Fields left out of status are cleared explicitly, as a merge patch
+	// would otherwise keep the old values.
+	var patch map[string]any
+	b, _ := json.Marshal(status)
+	_ = json.Unmarshal(b, &patch)
+	var old map[string]any
+	b, _ = json.Marshal(st.Status)
+	_ = json.Unmarshal(b, &old)
+	for k := range old {
+		if _, ok := patch[k]; !ok {
+			patch[k] = nil
+		}
+	}
+	if err := o.client.Patch(ctx, path, map[string]any{"status": patch}, nil); err != nil {
+		return fmt.Errorf("failed to update status: %w", err)
+	}
+	return nil
+}
+
+// normalize drops what the API server's round trip changes, so read and
+// computed statuses compare equal.
+func normalize(s ScanTargetStatus) ScanTargetStatus {
+	if s.LastScanTime != nil {
+		t := s.LastScanTime.UTC().Truncate(time.Second)
+		s.LastScanTime = &t
+	}
+	return s
+}
+
+func (o *Operator) collection(resource string) string {
+	if o.opts.Namespace != "" {
+		return fmt.Sprintf("/apis/%s/namespaces/%s/%s", APIVersion, o.opts.Namespace, resource)
+	}
+	return fmt.Sprintf("/apis/%s/%s", APIVersion, resource)
+}
+
+// policyFor returns the policy a ScanTarget names or, failing that, the
+// first of its namespace whose selector matches it.
+func policyFor(st ScanTarget, policies []ScanPolicy) (*ScanPolicy, error) {
+	for i, p := range policies {
+		if p.Metadata.Namespace != st.Metadata.Namespace {
+			continue
+		}
+		if st.Spec.Policy != "" && p.Metadata.Name == st.Spec.Policy {
+			return &policies[i], nil
+		}
+		if st.Spec.Policy == "" && p.Spec.Selector.Matches(st.Metadata.Labels) {
+			return &policies[i], nil
+		}
+	}
+	if st.Spec.Policy != "" {
+		return nil, fmt.Errorf("ScanPolicy %q not found", st.Spec.Policy)
+	}
+	return nil, nil
+}
+
+func validate(spec ScanTargetSpec) error {
+	if spec.Type != "image" && spec.Type != "file" {
+		return fmt.Errorf("spec.type must be image or file")
+	}
+	if spec.Target == "" {
+		return fmt.Errorf("spec.target is required")
+	}
+	if err := scheduler.Validate(spec.Schedule); err != nil {
+		return fmt.Errorf("spec.schedule: %w", err)
+	}
+	for _, w := range spec.Workloads {
+		if _, ok := workloadPaths[w.Kind]; !ok || w.Name == "" {
+			return fmt.Errorf("spec.workloads: unsupported workload %s/%s", w.Kind, w.Name)
+		}
+	}
+	return nil
+}
+
+func severityCounts(scan *store.Scan) map[string]int {
+	counts := make(map[string]int, len(trivy.Severities))
+	for _, sev := range trivy.Severities {
+		counts[sev] = 0
+	}
+	for _, v := range digest.Open(scan) {
+		counts[v.Severity]++
+	}
+	return counts
+}
+
+func reportFindingsOf(scan *store.Scan) []ReportFinding {
+	if scan.Response == nil {
+		return nil
+	}
+	var out []ReportFinding
+	for _, f := range scan.Response.Prioritized {
+		if len(out) == reportFindings {
+			break
+		}
+		out = append(out, ReportFinding{
+			Priority:         f.Priority,
+			VulnerabilityID:  f.VulnerabilityID,
+			Package:          f.PkgName,
+			InstalledVersion: f.InstalledVersion,
+			FixedVersion:     f.FixedVersion,
+			Severity:         f.Severity,
+		})
+	}
+	return out
+}
@@ -0,0 +1,139 @@
+package operator
+
+import (
+	"time"
+	"weeklysec/internal/kube"
+)
+
+// API group and version of the custom resources.
+const (
+	Group      = "weeklysec.io"
+	Version    = "v1alpha1"
+	APIVersion = Group + "/" + Version
+)
+
+// ScanTarget asks for an image or file to be scanned on a schedule.
+type ScanTarget struct {
+	APIVersion string           `json:"apiVersion"`
+	Kind       string           `json:"kind"`
+	Metadata   kube.ObjectMeta  `json:"metadata"`
+	Spec       ScanTargetSpec   `json:"spec"`
+	Status     ScanTargetStatus `json:"status,omitzero"`
+}
+
+// ScanTargetSpec mirrors the inventory fields of a target.
+type ScanTargetSpec struct {
+	Type        string        `json:"type"` // image or file
+	Target      string        `json:"target"`
+	Schedule    string        `json:"schedule,omitempty"` // cron; the policy's or the default when empty
+	Policy      string        `json:"policy,omitempty"`   // ScanPolicy in the same namespace
+	Team        string        `json:"team,omitempty"`
+	Environment string        `json:"environment,omitempty"`
+	Criticality string        `json:"criticality,omitempty"`
+	Workloads   []WorkloadRef `json:"workloads,omitempty"` // annotated with the latest results
+}
+
+// WorkloadRef names a workload in the ScanTarget's namespace.
+type WorkloadRef struct {
+	Kind string `json:"kind"` // Deployment, StatefulSet, DaemonSet or CronJob
+	Name string `json:"name"`
+}
+
+// ScanTargetStatus reports the latest scan.
+type ScanTargetStatus struct {
+	ObservedGeneration int64          `json:"observedGeneration,omitempty"`
+	Phase              string         `json:"phase,omitempty"`
+	Message            string         `json:"message,omitempty"`
+	TargetID           string         `json:"targetID,omitempty"`
+	Policy             string         `json:"policy,omitempty"`
+	Schedule           string         `json:"schedule,omitempty"`
+	LastScanID         string         `json:"lastScanID,omitempty"`
+	LastScanTime       *time.Time     `json:"lastScanTime,omitempty"`
+	RiskScore          float64        `json:"riskScore,omitempty"`
+	Vulnerabilities    map[string]int `json:"vulnerabilities,omitempty"`
+	Compliant          *bool          `json:"compliant,omitempty"` // against the policy's maxRiskScore
+	Report             string         `json:"report,omitempty"`
+}
+
+// ScanTarget phases.
+const (
+	PhasePending  = "Pending"
+	PhaseScanning = "Scanning"
+	PhaseScanned  = "Scanned"
+	PhaseFailed   = "Failed"
+)
+
+// ScanPolicy sets defaults for the ScanTargets of its namespace that name
+// it or match its selector.
+type ScanPolicy struct {
+	APIVersion string          `json:"apiVersion"`
+	Kind       string          `json:"kind"`
+	Metadata   kube.ObjectMeta `json:"metadata"`
+	Spec       ScanPolicySpec  `json:"spec"`
+}
+
+// ScanPolicySpec is what a policy sets.
+type ScanPolicySpec struct {
+	Selector     LabelSelector `json:"selector,omitzero"` // ScanTargets it applies to; none when empty
+	Schedule     string        `json:"schedule,omitempty"`
+	MaxRiskScore float64       `json:"maxRiskScore,omitempty"` // 0 disables the compliance check
+}
+
+// LabelSelector selects by exact label values.
+type LabelSelector struct {
+	MatchLabels map[string]string `json:"matchLabels,omitempty"`
+}
+
+// Matches reports whether labels carry every MatchLabels pair. An empty
+// selector matches nothing.
+func (s LabelSelector) Matches(labels map[string]string) bool {
+	if len(s.MatchLabels) == 0 {
+		return false
+	}
+	for k, v := range s.MatchLabels {
+		if labels[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+// ScanReport is the result of a ScanTarget's latest scan, owned by it.
+type ScanReport struct {
+	APIVersion string          `json:"apiVersion"`
+	Kind       string          `json:"kind"`
+	Metadata   kube.ObjectMeta `json:"metadata"`
+	Spec       ScanReportSpec  `json:"spec"`
+}
+
+// ScanReportSpec holds the scan's outcome.
+type ScanReportSpec struct {
+	ScanTarget      string          `json:"scanTarget"`
+	ScanID          string          `json:"scanID"`
+	Type            string          `json:"type"`
+	Target          string          `json:"target"`
+	ScannedAt       time.Time       `json:"scannedAt"`
+	Status          string          `json:"status,omitempty"`
+	RiskScore       float64         `json:"riskScore"`
+	Vulnerabilities map[string]int  `json:"vulnerabilities"`
+	Summary         string          `json:"summary,omitempty"`
+	Findings        []ReportFinding `json:"findings,omitempty"`
+}
+
+// ReportFinding is one prioritized finding.
+type ReportFinding struct {
+	Priority         int    `json:"priority"`
+	VulnerabilityID  string `json:"vulnerabilityID"`
+	Package          string `json:"package"`
+	InstalledVersion string `json:"installedVersion"`
+	FixedVersion     string `json:"fixedVersion,omitempty"`
+	Severity         string `json:"severity"`
+}
+
+type scanTargetList struct {
+	Items []ScanTarget `json:"items"`
+}
+
+type scanPolicyList struct {
+	Items []ScanPolicy `json:"items"`
+}
@@ -0,0 +1,261 @@
+// Package policy judges scans against rules written in CEL, such as "no
+// critical findings in prod images" or "no known exploited CVEs". A rule's
+// expression holds for a compliant scan; it sees three variables:
+//
+//	scan      target, target_type, org, project, status, risk_score (0-100),
+//	          total, fixable and counts (open findings by severity)
+//	target    environment, team, criticality and labels of the registered
+//	          target, empty for ad hoc scans
+//	findings  the open findings: id, package, installed_version,
+//	          fixed_version, severity, cvss, fixable and kev
+//
+// For example:
+//
+//	target.environment != "prod" || scan.counts.CRITICAL == 0
+//	!findings.exists(f, f.kev)
+//	scan.risk_score <= 70
+package policy
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"weeklysec/internal/trivy"
+
+	"github.com/google/cel-go/cel"
+	"gopkg.in/yaml.v3"
+)
+
+// Rule actions.
+const (
+	ActionDeny = "deny" // a violation fails CI gates and pre-sync checks
+	ActionWarn = "warn" // a violation is only reported
+)
+
+// maxCost bounds the work of one evaluation, so a rule iterating over a
+// huge scan cannot stall the server.
+const maxCost = 10_000_000
+
+// Rule is one policy rule.
+type Rule struct {
+	Name        string `json:"name" yaml:"name"`
+	Description string `json:"description,omitempty" yaml:"description"`
+	Expr        string `json:"expr" yaml:"expr"`             // CEL; true when the scan complies
+	Action      string `json:"action" yaml:"action"`         // deny or warn; deny when empty
+	Alert       bool   `json:"alert,omitempty" yaml:"alert"` // violations page on-call
+}
+
+// Rules is a policy as stored and loaded.
+type Rules struct {
+	Rules []Rule `json:"rules" yaml:"rules"`
+}
+
+// Load reads rules from a YAML or JSON file.
+func Load(path string) (Rules, error) {
+	var r Rules
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return r, err
+	}
+	if err := yaml.Unmarshal(data, &r); err != nil {
+		return r, fmt.Errorf("%s: %w", path, err)
+	}
+	return r, nil
+}
+
+// Input is what rules are evaluated against.
+type Input struct {
+	TargetType string
+	Target     string
+	Org        string
+	Project    string
+	Status     string
+	RiskScore  float64
+
+	// Of the registered target, if any.
+	Environment string
+	Team        string
+	Criticality string
+	Labels      map[string]string
+
+	Findings []trivy.Vulnerability // open findings
+	KEV      func(cveID string) bool
+}
+
+// Violation is a rule a scan broke, or could not be judged by.
+type Violation struct {
+	Rule        string `json:"rule"`
+	Description string `json:"description,omitempty"`
+	Action      string `json:"action"`
+	Alert       bool   `json:"alert,omitempty"`
+	Error       string `json:"error,omitempty"` // the rule failed to evaluate
+}
+
+// Verdict is the outcome of a policy.
+type Verdict struct {
+	Pass       bool        `json:"pass"` // no deny rule is violated
+	Evaluated  int         `json:"evaluated"`
+	Violations []Violation `json:"violations,omitempty"`
+}
+
+// Denied returns the violations that fail the scan.
+func (v *Verdict) Denied() []Violation {
+	if v == nil {
+		return nil
+	}
+	var out []Violation
+	for _, x := range v.Violations {
+		if x.Action == ActionDeny {
+			out = append(out, x)
+		}
+	}
+	return out
+}
+
+// Engine evaluates a compiled policy. It is safe for concurrent use.
+type Engine struct {
+	rules    Rules
+	programs []cel.Program
+}
+
+var env = mustEnv()
+
+func mustEnv() *cel.Env {
+	e, err := cel.NewEnv(
+		cel.Variable("scan", cel.MapType(cel.StringType, cel.DynType)),
+		cel.Variable("target", cel.MapType(cel.StringType, cel.DynType)),
+		cel.Variable("findings", cel.ListType(cel.MapType(cel.StringType, cel.DynType))),
+		cel.CrossTypeNumericComparisons(true),
+	)
+	if err != nil {
+		panic(err) // the declarations are fixed
+	}
+	return e
+}
+
+// Compile checks and compiles rules.
+func Compile(r Rules) (*Engine, error) {
+	e := &Engine{rules: r}
+	var names []string
+	for i := range r.Rules {
+		rule := &e.rules.Rules[i]
+		if rule.Name == "" {
+			return nil, fmt.Errorf("rule %d has no name", i+1)
+		}
+		if slices.Contains(names, rule.Name) {
+			return nil, fmt.Errorf("rule %q is defined twice", rule.Name)
+		}
+		names = append(names, rule.Name)
+		switch rule.Action {
+		case "":
+			rule.Action = ActionDeny
+		case ActionDeny, ActionWarn:
+		default:
+			return nil, fmt.Errorf("rule %q: unknown action %q; use deny or warn", rule.Name, rule.Action)
+		}
+
+		ast, iss := env.Compile(rule.Expr)
+		if iss.Err() != nil {
+			return nil, fmt.Errorf("rule %q: %w", rule.Name, iss.Err())
+		}
+		if t := ast.OutputType(); t != cel.BoolType && t != cel.DynType {
+			return nil, fmt.Errorf("rule %q: expression is %s, not bool", rule.Name, t)
+		}
+		prg, err := env.Program(ast, cel.CostLimit(maxCost))
+		if err != nil {
+			return nil, fmt.Errorf("rule %q: %w", rule.Name, err)
+		}
+		e.programs = append(e.programs, prg)
+	}
+	return e, nil
+}
+
+// Rules returns the rules with their defaults filled in.
+func (e *Engine) Rules() Rules {
+	if e == nil {
+		return Rules{Rules: []Rule{}}
+	}
+	return Rules{Rules: slices.Clone(e.rules.Rules)}
+}
+
+// Evaluate judges in against every rule; nil without rules. A rule that
+// fails to evaluate counts as violated, so a deny rule fails closed.
+func (e *Engine) Evaluate(in Input) *Verdict {
+	if e == nil || len(e.programs) == 0 {
+		return nil
+	}
+	vars := activation(in)
+	v := &Verdict{Pass: true, Evaluated: len(e.programs)}
+	for i, prg := range e.programs {
+		rule := e.rules.Rules[i]
+		out, _, err := prg.Eval(vars)
+		ok, isBool := false, false
+		if err == nil {
+			ok, isBool = out.Value().(bool)
+			if !isBool {
+				err = fmt.Errorf("expression returned %s, not bool", out.Type().TypeName())
+			}
+		}
+		if err == nil && ok {
+			continue
+		}
+		violation := Violation{Rule: rule.Name, Description: rule.Description, Action: rule.Action, Alert: rule.Alert}
+		if err != nil {
+			violation.Error = err.Error()
+		}
+		v.Violations = append(v.Violations, violation)
+		if rule.Action == ActionDeny {
+			v.Pass = false
+		}
+	}
+	return v
+}
+
+func activation(in Input) map[string]any {
+	counts := make(map[string]int, len(trivy.Severities))
+	for _, sev := range trivy.Severities {
+		counts[sev] = 0
+	}
+	findings := make([]any, 0, len(in.Findings))
+	fixable := 0
+	for _, f := range in.Findings {
+		counts[f.Severity]++
+		if f.FixedVersion != "" {
+			fixable++
+		}
+		findings = append(findings, map[string]any{
+			"id":                f.VulnerabilityID,
+			"package":           f.PkgName,
+			"installed_version": f.InstalledVersion,
+			"fixed_version":     f.FixedVersion,
+			"severity":          f.Severity,
+			"cvss":              f.Score(),
+			"fixable":           f.FixedVersion != "",
+			"kev":               in.KEV != nil && in.KEV(f.VulnerabilityID),
+		})
+	}
+	labels := in.Labels
+	if labels == nil {
+		labels = map[string]string{}
+	}
+	return map[string]any{
+		"scan": map[string]any{
+			"target":      in.Target,
+			"target_type": in.TargetType,
+			"org":         in.Org,
+			"project":     in.Project,
+			"status":      in.Status,
+			"risk_score":  in.RiskScore,
+			"total":       len(in.Findings),
+			"fixable":     fixable,
+			"counts":      counts,
+		},
+		"target": map[string]any{
+			"environment": in.Environment,
+			"team":        in.Team,
+			"criticality": in.Criticality,
+			"labels":      labels,
+		},
+		"findings": findings,
+	}
+}
@@ -0,0 +1,140 @@
+package policy
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"weeklysec/internal/trivy"
+)
+
+func TestCompile(t *testing.T) {
+	tests := []struct {
+		name    string
+		rules   []Rule
+		wantErr string
+	}{
+		{"valid", []Rule{{Name: "a", Expr: "scan.risk_score <= 70"}, {Name: "b", Expr: "true", Action: ActionWarn}}, ""},
+		{"dynamic result", []Rule{{Name: "a", Expr: "target.labels['gate']"}}, ""},
+		{"no name", []Rule{{Expr: "true"}}, "rule 1 has no name"},
+		{"duplicate name", []Rule{{Name: "a", Expr: "true"}, {Name: "a", Expr: "false"}}, `rule "a" is defined twice`},
+		{"unknown action", []Rule{{Name: "a", Expr: "true", Action: "block"}}, `unknown action "block"`},
+		{"syntax error", []Rule{{Name: "a", Expr: "scan.counts.CRITICAL =="}}, `rule "a"`},
+		{"unknown variable", []Rule{{Name: "a", Expr: "image.tag == 'latest'"}}, "undeclared reference"},
+		{"not bool", []Rule{{Name: "a", Expr: "scan.total + 1"}}, "not bool"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, err := Compile(Rules{Rules: tt.rules})
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("Compile() error = %v", err)
+				}
+				for _, r := range e.Rules().Rules {
+					if r.Action == "" {
+						t.Fatalf("rule %q has no default action", r.Name)
+					}
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("Compile() error = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	in := Input{
+		TargetType:  "image",
+		Target:      "ghcr.io/acme/web:1.0",
+		Org:         "acme",
+		Project:     "web",
+		RiskScore:   82.5,
+		Environment: "prod",
+		Labels:      map[string]string{"tier": "frontend"},
+		Findings: []trivy.Vulnerability{
+			{VulnerabilityID: "CVE-2024-1", PkgName: "openssl", Severity: "CRITICAL", FixedVersion: "3.0.14", CVSS: map[string]trivy.CVSS{"nvd": {V3Score: 9.8}}},
+			{VulnerabilityID: "CVE-2024-2", PkgName: "zlib", Severity: "LOW"},
+		},
+		KEV: func(id string) bool { return id == "CVE-2024-1" },
+	}
+
+	tests := []struct {
+		name       string
+		rule       Rule
+		in         Input
+		wantPass   bool
+		violations int
+		wantError  bool
+	}{
+		{"criticals in prod", Rule{Name: "r", Expr: `target.environment != "prod" || scan.counts.CRITICAL == 0`}, in, false, 1, false},
+		{"criticals outside prod", Rule{Name: "r", Expr: `target.environment != "prod" || scan.counts.CRITICAL == 0`}, Input{Environment: "dev", Findings: in.Findings}, true, 0, false},
+		{"kev", Rule{Name: "r", Expr: `!findings.exists(f, f.kev)`}, in, false, 1, false},
+		{"kev without a catalog", Rule{Name: "r", Expr: `!findings.exists(f, f.kev)`}, Input{Findings: in.Findings}, true, 0, false},
+		{"risk score", Rule{Name: "r", Expr: `scan.risk_score <= 90`}, in, true, 0, false},
+		{"cvss and fixable", Rule{Name: "r", Expr: `findings.all(f, f.cvss < 9.0 || !f.fixable)`}, in, false, 1, false},
+		{"counts", Rule{Name: "r", Expr: `scan.total == 2 && scan.fixable == 1 && scan.counts.HIGH == 0`}, in, true, 0, false},
+		{"labels", Rule{Name: "r", Expr: `target.labels.tier == "frontend"`}, in, true, 0, false},
+		{"warn does not fail", Rule{Name: "r", Expr: `scan.counts.LOW == 0`, Action: ActionWarn}, in, true, 1, false},
+		{"missing key fails closed", Rule{Name: "r", Expr: `target.labels.owner == "x"`}, in, false, 1, true},
+		{"non-bool result fails closed", Rule{Name: "r", Expr: `target.labels.tier`}, in, false, 1, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, err := Compile(Rules{Rules: []Rule{tt.rule}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			v := e.Evaluate(tt.in)
+			if v.Pass != tt.wantPass || len(v.Violations) != tt.violations || v.Evaluated != 1 {
+				t.Fatalf("Evaluate() = %+v, want pass %v with %d violations", v, tt.wantPass, tt.violations)
+			}
+			if tt.violations > 0 && (v.Violations[0].Error != "") != tt.wantError {
+				t.Fatalf("violation error = %q, want error %v", v.Violations[0].Error, tt.wantError)
+			}
+		})
+	}
+}
+
+func TestEvaluateCostLimit(t *testing.T) {
+	e, err := Compile(Rules{Rules: []Rule{{Name: "r", Expr: `!findings.exists(f, f.package.contains(f.installed_version))`}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	long := strings.Repeat("x", 1<<16)
+	v := e.Evaluate(Input{Findings: []trivy.Vulnerability{{PkgName: long, InstalledVersion: long}}})
+	if v.Pass || len(v.Violations) != 1 || !strings.Contains(v.Violations[0].Error, "cost") {
+		t.Fatalf("Evaluate() = %+v, want a cost limit violation", v)
+	}
+}
+
+func TestEvaluateWithoutRules(t *testing.T) {
+	var e *Engine
+	if v := e.Evaluate(Input{}); v != nil {
+		t.Fatalf("nil engine Evaluate() = %+v", v)
+	}
+	if v := e.Evaluate(Input{}).Denied(); v != nil {
+		t.Fatalf("nil verdict Denied() = %+v", v)
+	}
+	if rules := e.Rules().Rules; rules == nil || len(rules) != 0 {
+		t.Fatalf("nil engine Rules() = %+v", rules)
+	}
+}
+
+func TestDenied(t *testing.T) {
+	e, err := Compile(Rules{Rules: []Rule{
+		{Name: "deny", Expr: "false"},
+		{Name: "warn", Expr: "false", Action: ActionWarn},
+		{Name: "ok", Expr: "true"},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, x := range e.Evaluate(Input{}).Denied() {
+		names = append(names, x.Rule)
+	}
+	if !slices.Equal(names, []string{"deny"}) {
+		t.Fatalf("Denied() = %v, want [deny]", names)
+	}
+}
@@ -0,0 +1,121 @@
+// Package posture summarizes the security posture of a service, the
+// targets sharing a service label, in a stable schema meant for developer
+// portals such as Backstage.
+package posture
+
+import (
+	"sort"
+	"strings"
+	"time"
+	"weeklysec/internal/digest"
+	"weeklysec/internal/store"
+	"weeklysec/internal/trivy"
+)
+
+// SchemaVersion is bumped only for incompatible changes; fields may be
+// added within a version.
+const SchemaVersion = "v1"
+
+// Service statuses, from worst to best.
+const (
+	StatusCritical = "critical" // open critical findings
+	StatusWarning  = "warning"  // open high findings
+	StatusOK       = "ok"
+	StatusUnknown  = "unknown" // never scanned
+)
+
+// Service is the posture of one service.
+type Service struct {
+	SchemaVersion   string         `json:"schema_version"`
+	Service         string         `json:"service"`
+	Status          string         `json:"status"`
+	RiskScore       float64        `json:"risk_score"` // highest of its targets, 0-100
+	OpenCriticals   int            `json:"open_criticals"`
+	Open            map[string]int `json:"open"` // open findings by severity
+	LastScannedAt   *time.Time     `json:"last_scanned_at,omitempty"`
+	LatestReportURL string         `json:"latest_report_url,omitempty"`
+	Targets         []Target       `json:"targets"`
+}
+
+// Target is the posture of one target of a service.
+type Target struct {
+	ID            string         `json:"id"`
+	Name          string         `json:"name,omitempty"`
+	TargetType    string         `json:"target_type"`
+	Target        string         `json:"target"`
+	Environment   string         `json:"environment,omitempty"`
+	Status        string         `json:"status"`
+	RiskScore     float64        `json:"risk_score"`
+	OpenCriticals int            `json:"open_criticals"`
+	Open          map[string]int `json:"open"`
+	LastScanID    string         `json:"last_scan_id,omitempty"`
+	LastScannedAt *time.Time     `json:"last_scanned_at,omitempty"`
+	ReportURL     string         `json:"report_url,omitempty"`
+}
+
+// Build summarizes a service from its targets and their latest scans,
+// keyed by target ID. reportURL links a scan's report.
+func Build(service string, targets []store.Target, latest map[string]*store.Scan, reportURL func(scanID string) string) *Service {
+	s := &Service{
+		SchemaVersion: SchemaVersion,
+		Service:       service,
+		Status:        StatusUnknown,
+		Open:          emptyCounts(),
+		Targets:       []Target{},
+	}
+	for _, t := range targets {
+		pt := Target{
+			ID:          t.ID,
+			Name:        t.Name,
+			TargetType:  t.TargetType,
+			Target:      t.Target,
+			Environment: t.Environment,
+			Status:      StatusUnknown,
+			Open:        emptyCounts(),
+		}
+		if scan := latest[t.ID]; scan != nil {
+			for _, v := range digest.Open(scan) {
+				sev := strings.ToUpper(v.Severity)
+				pt.Open[sev]++
+				s.Open[sev]++
+			}
+			pt.RiskScore = digest.RiskScore(scan)
+			pt.OpenCriticals = pt.Open["CRITICAL"]
+			pt.Status = status(pt.Open)
+			pt.LastScanID = scan.ID
+			pt.LastScannedAt = &scan.CreatedAt
+			pt.ReportURL = reportURL(scan.ID)
+
+			s.RiskScore = max(s.RiskScore, pt.RiskScore)
+			if s.LastScannedAt == nil || scan.CreatedAt.After(*s.LastScannedAt) {
+				s.LastScannedAt = &scan.CreatedAt
+				s.LatestReportURL = pt.ReportURL
+			}
+		}
+		s.Targets = append(s.Targets, pt)
+	}
+	s.OpenCriticals = s.Open["CRITICAL"]
+	if s.LastScannedAt != nil {
+		s.Status = status(s.Open)
+	}
+	sort.SliceStable(s.Targets, func(i, j int) bool { return s.Targets[i].RiskScore > s.Targets[j].RiskScore })
+	return s
+}
+
+func status(open map[string]int) string {
+	switch {
+	case open["CRITICAL"] > 0:
+		return StatusCritical
+	case open["HIGH"] > 0:
+		return StatusWarning
+	}
+	return StatusOK
+}
+
+func emptyCounts() map[string]int {
+	m := make(map[string]int, len(trivy.Severities))
+	for _, sev := range trivy.Severities {
+		m[sev] = 0
+	}
+	return m
+}
@@ -0,0 +1,287 @@
+// Package queue runs jobs on a fixed number of workers behind a bounded
+// queue, so a burst of scans waits its turn instead of starting a Trivy
+// process or LLM call each. Workers take the most urgent job first.
+package queue
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+	"weeklysec/internal/errcode"
+)
+
+// ErrFull is returned when a job finds the queue full.
+var ErrFull = errcode.New(errcode.TooManyRequests, "queue is full")
+
+// ErrWaitTimeout is returned when a job waited too long for a worker.
+var ErrWaitTimeout = errcode.New(errcode.TooManyRequests, "timed out waiting for a free worker")
+
+// Rejected reports whether err means a job was turned away without
+// running.
+func Rejected(err error) bool {
+	return errors.Is(err, ErrFull) || errors.Is(err, ErrWaitTimeout)
+}
+
+// Priority orders queued jobs; lower values run first.
+type Priority int
+
+const (
+	PriorityInteractive Priority = iota // a caller is waiting on the answer
+	PriorityWebhook                     // triggered by an external event
+	PriorityScheduled                   // batch and periodic scans
+
+	numPriorities = iota
+)
+
+var priorityNames = [numPriorities]string{"interactive", "webhook", "scheduled"}
+
+func (p Priority) String() string {
+	if p < 0 || p >= numPriorities {
+		return "unknown"
+	}
+	return priorityNames[p]
+}
+
+type (
+	waitKey     struct{}
+	priorityKey struct{}
+)
+
+// WithWait marks ctx so that jobs run with it wait for room in a full queue
+// instead of failing with ErrFull.
+func WithWait(ctx context.Context) context.Context {
+	return context.WithValue(ctx, waitKey{}, true)
+}
+
+// WithPriority sets the priority of jobs run with ctx. Jobs below
+// PriorityInteractive come from background callers that bound their own
+// concurrency, so they also wait for room as with WithWait.
+func WithPriority(ctx context.Context, p Priority) context.Context {
+	return context.WithValue(ctx, priorityKey{}, p)
+}
+
+// PriorityOf returns the priority set on ctx, PriorityInteractive by
+// default.
+func PriorityOf(ctx context.Context) Priority {
+	p, ok := ctx.Value(priorityKey{}).(Priority)
+	if !ok || p < 0 || p >= numPriorities {
+		return PriorityInteractive
+	}
+	return p
+}
+
+func waits(ctx context.Context) bool {
+	w, _ := ctx.Value(waitKey{}).(bool)
+	return w || PriorityOf(ctx) != PriorityInteractive
+}
+
+type job struct {
+	ctx  context.Context
+	fn   func(context.Context) error
+	done chan error
+}
+
+// Pool runs jobs on a fixed set of workers. A nil Pool runs every job
+// immediately on the caller's goroutine.
+type Pool struct {
+	name    string
+	workers int
+	size    int
+	maxWait time.Duration
+
+	mu      sync.Mutex
+	pending [numPriorities][]*job
+	idle    int           // workers waiting for a job
+	wake    chan struct{} // a job was queued
+	freed   chan struct{} // closed when a job leaves the queue
+
+	running   atomic.Int64
+	completed atomic.Int64
+	rejected  atomic.Int64
+}
+
+// New starts workers that take jobs from a queue holding up to size of
+// them. Jobs not started within maxWait fail; 0 waits as long as the
+// caller does.
+func New(name string, workers, size int, maxWait time.Duration) *Pool {
+	p := &Pool{
+		name:    name,
+		workers: max(workers, 1),
+		size:    max(size, 0),
+		maxWait: maxWait,
+		freed:   make(chan struct{}),
+	}
+	p.wake = make(chan struct{}, p.workers)
+	for range p.workers {
+		go p.work()
+	}
+	return p
+}
+
+// Do runs fn on a worker and returns its error. It fails without running
+// fn when the queue is full, when fn waited longer than the pool allows, or
+// when ctx is done before a worker picked it up.
+func (p *Pool) Do(ctx context.Context, fn func(context.Context) error) error {
+	if p == nil {
+		return fn(ctx)
+	}
+	j := &job{ctx: ctx, fn: fn, done: make(chan error, 1)}
+	prio := PriorityOf(ctx)
+
+	var timeout <-chan time.Time
+	if p.maxWait > 0 {
+		timer := time.NewTimer(p.maxWait)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	for !p.enqueue(j, prio) {
+		if !waits(ctx) {
+			p.rejected.Add(1)
+			return ErrFull
+		}
+		p.mu.Lock()
+		freed := p.freed
+		p.mu.Unlock()
+		select {
+		case <-freed:
+		case <-timeout:
+			p.rejected.Add(1)
+			return ErrWaitTimeout
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	select {
+	case err := <-j.done:
+		return err
+	case <-timeout:
+		if p.withdraw(j, prio) {
+			p.rejected.Add(1)
+			return ErrWaitTimeout
+		}
+	case <-ctx.Done():
+		if p.withdraw(j, prio) {
+			return ctx.Err()
+		}
+	}
+	// A worker got to the job first; it sees ctx and winds down.
+	return <-j.done
+}
+
+// enqueue queues j unless the queue is full. Only jobs at least as urgent
+// count, so a backlog of batch scans never turns an interactive one away.
+func (p *Pool) enqueue(j *job, prio Priority) bool {
+	p.mu.Lock()
+	// Idle workers take queued jobs right away, so they add room.
+	if p.queuedLocked(prio) >= p.size+p.idle {
+		p.mu.Unlock()
+		return false
+	}
+	p.pending[prio] = append(p.pending[prio], j)
+	p.mu.Unlock()
+
+	select {
+	case p.wake <- struct{}{}:
+	default:
+	}
+	return true
+}
+
+// withdraw takes j out of the queue, reporting false when a worker has
+// already started it.
+func (p *Pool) withdraw(j *job, prio Priority) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	i := slices.Index(p.pending[prio], j)
+	if i < 0 {
+		return false
+	}
+	p.pending[prio] = slices.Delete(p.pending[prio], i, i+1)
+	p.notifyFreedLocked()
+	return true
+}
+
+func (p *Pool) work() {
+	for {
+		j := p.next()
+		p.running.Add(1)
+		err := j.fn(j.ctx)
+		p.running.Add(-1)
+		p.completed.Add(1)
+		j.done <- err
+	}
+}
+
+// next blocks until a job is queued and takes the most urgent one, oldest
+// first within a priority.
+func (p *Pool) next() *job {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for {
+		for prio, q := range p.pending {
+			if len(q) > 0 {
+				j := q[0]
+				p.pending[prio] = slices.Delete(q, 0, 1)
+				p.notifyFreedLocked()
+				return j
+			}
+		}
+		p.idle++
+		p.mu.Unlock()
+		<-p.wake
+		p.mu.Lock()
+		p.idle--
+	}
+}
+
+// queuedLocked counts the queued jobs of priority prio or more urgent.
+func (p *Pool) queuedLocked(prio Priority) int {
+	n := 0
+	for _, q := range p.pending[:prio+1] {
+		n += len(q)
+	}
+	return n
+}
+
+// notifyFreedLocked wakes the callers waiting for room.
+func (p *Pool) notifyFreedLocked() {
+	close(p.freed)
+	p.freed = make(chan struct{})
+}
+
+// Stats is a snapshot of a pool's load.
+type Stats struct {
+	Name       string           `json:"name"`
+	Workers    int              `json:"workers"`
+	Capacity   int              `json:"capacity"` // jobs of each priority that can wait for a worker
+	Queued     int64            `json:"queued"`
+	ByPriority map[string]int64 `json:"queued_by_priority"`
+	Running    int64            `json:"running"`
+	Completed  int64            `json:"completed"`
+	Rejected   int64            `json:"rejected"` // full queue or wait timeout
+}
+
+// Stats returns the pool's current load and totals since it started.
+func (p *Pool) Stats() Stats {
+	s := Stats{
+		Name:       p.name,
+		Workers:    p.workers,
+		Capacity:   p.size,
+		ByPriority: make(map[string]int64, numPriorities),
+		Running:    p.running.Load(),
+		Completed:  p.completed.Load(),
+		Rejected:   p.rejected.Load(),
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for prio, q := range p.pending {
+		s.ByPriority[Priority(prio).String()] = int64(len(q))
+		s.Queued += int64(len(q))
+	}
+	return s
+}
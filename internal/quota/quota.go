@@ -0,0 +1,314 @@
+// Package quota meters scans and estimated LLM spend per tenant and per
+// caller against monthly budgets. A budget that is used up either rejects
+// new scans or degrades them to scans without LLM steps.
+package quota
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+	"weeklysec/internal/tenant"
+)
+
+// What happens to scans once a budget is used up.
+const (
+	ActionReject  = "reject"  // refuse the scan
+	ActionDegrade = "degrade" // scan, but skip the LLM steps
+)
+
+// Budget limits one scope per calendar month (UTC). Zero limits are
+// unlimited.
+type Budget struct {
+	// Scope is an org, an "org/project", or a caller as the audit log
+	// names it, e.g. "apikey:ci" or "jwt:alice".
+	Scope      string  `json:"scope"`
+	Scans      int     `json:"scans,omitempty"`
+	Tokens     int     `json:"tokens,omitempty"` // estimated LLM tokens
+	Cost       float64 `json:"cost,omitempty"`   // estimated from the cost per 1K tokens
+	OnExceeded string  `json:"on_exceeded"`      // ActionReject or ActionDegrade
+}
+
+// Config is the set of budgets as stored.
+type Config struct {
+	Budgets []Budget `json:"budgets"`
+}
+
+// Validate checks c and normalizes its budgets.
+func (c *Config) Validate() error {
+	seen := map[string]bool{}
+	for i := range c.Budgets {
+		b := &c.Budgets[i]
+		b.Scope = strings.TrimSpace(b.Scope)
+		if b.OnExceeded == "" {
+			b.OnExceeded = ActionReject
+		}
+		switch {
+		case b.Scope == "":
+			return fmt.Errorf("budget %d: 'scope' is required", i+1)
+		case seen[b.Scope]:
+			return fmt.Errorf("budget %d: duplicate scope %q", i+1, b.Scope)
+		case b.Scans < 0 || b.Tokens < 0 || b.Cost < 0:
+			return fmt.Errorf("budget %s: limits must not be negative", b.Scope)
+		case b.OnExceeded != ActionReject && b.OnExceeded != ActionDegrade:
+			return fmt.Errorf("budget %s: 'on_exceeded' must be %q or %q", b.Scope, ActionReject, ActionDegrade)
+		}
+		if !strings.Contains(b.Scope, ":") {
+			if _, err := tenant.Parse(b.Scope); err != nil {
+				return fmt.Errorf("budget %d: %w", i+1, err)
+			}
+		}
+		seen[b.Scope] = true
+	}
+	return nil
+}
+
+// Usage is what one scope used in one month.
+type Usage struct {
+	Scope     string    `json:"scope"`
+	Month     string    `json:"month"` // 2006-01
+	Scans     int       `json:"scans"`
+	Tokens    int       `json:"tokens"`
+	Cost      float64   `json:"cost"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Key identifies u in a Store.
+func (u Usage) Key() string {
+	return u.Month + "|" + u.Scope
+}
+
+// Status is a scope's usage against its budget.
+type Status struct {
+	Usage
+	Budget   *Budget `json:"budget,omitempty"`
+	Exceeded bool    `json:"exceeded"`
+}
+
+// Store persists usage. Cost is not stored; the meter prices tokens when
+// it reports usage.
+type Store interface {
+	// GetUsage returns a zero Usage when scope used nothing in month.
+	GetUsage(month, scope string) (Usage, error)
+	ListUsage(month string) ([]Usage, error)
+	// AddUsage adds to the month's usage of scope in one atomic step,
+	// creating it when needed, and returns the sum, so that replicas
+	// metering the same scope never lose each other's counts.
+	AddUsage(month, scope string, scans, tokens int, at time.Time) (Usage, error)
+}
+
+// Decision is the outcome of Check.
+type Decision struct {
+	Action string  // "", ActionReject or ActionDegrade
+	Budget *Budget // the budget used up, when Action is set
+}
+
+// Err describes the budget that was used up.
+func (d Decision) Err() string {
+	if d.Budget == nil {
+		return ""
+	}
+	return fmt.Sprintf("monthly quota of %s is used up", d.Budget.Scope)
+}
+
+// Meter counts usage and checks it against the budgets. A nil Meter allows
+// everything and counts nothing.
+type Meter struct {
+	store     Store
+	costPer1K float64
+
+	mu      sync.Mutex
+	budgets []Budget
+}
+
+// New returns a meter pricing LLM tokens at costPer1K.
+func New(store Store, costPer1K float64) *Meter {
+	return &Meter{store: store, costPer1K: costPer1K}
+}
+
+// SetBudgets replaces the budgets, which must have been validated.
+func (m *Meter) SetBudgets(c Config) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.budgets = slices.Clone(c.Budgets)
+}
+
+// Budgets returns the budgets in effect.
+func (m *Meter) Budgets() Config {
+	if m == nil {
+		return Config{Budgets: []Budget{}}
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return Config{Budgets: append([]Budget{}, m.budgets...)}
+}
+
+// Scopes returns the scopes a scan for t by caller counts against: the
+// org, the project unless t spans them all and, when known, the caller.
+func Scopes(t tenant.Tenant, caller string) []string {
+	scopes := []string{t.Org}
+	if t.Project != tenant.AllProjects {
+		scopes = append(scopes, t.String())
+	}
+	if caller != "" {
+		scopes = append(scopes, caller)
+	}
+	return scopes
+}
+
+// Month returns the usage month of t.
+func Month(t time.Time) string {
+	return t.UTC().Format("2006-01")
+}
+
+// Check tells whether a run over scopes may go on, without counting it.
+// A used-up rejecting budget wins over a degrading one.
+func (m *Meter) Check(scopes []string) (Decision, error) {
+	s, err := m.Status(scopes)
+	if err != nil {
+		return Decision{}, err
+	}
+	return decide(s), nil
+}
+
+// Reserve counts a scan against scopes before it runs and tells whether it
+// may. Since the count is taken first, concurrent scans never all slip
+// under the same budget. A rejected scan is not counted; a scan that ends
+// up not running must be given back with Release.
+func (m *Meter) Reserve(scopes []string) (Decision, error) {
+	if m == nil {
+		return Decision{}, nil
+	}
+	now := time.Now().UTC()
+	month := Month(now)
+	before := make([]Status, 0, len(scopes))
+	for i, scope := range scopes {
+		u, err := m.store.AddUsage(month, scope, 1, 0, now)
+		if err != nil {
+			return Decision{}, errors.Join(err, m.add(scopes[:i], -1, 0))
+		}
+		// The budget is used up only when it was before this scan.
+		u.Scans--
+		before = append(before, m.status(u))
+	}
+	d := decide(before)
+	if d.Action == ActionReject {
+		if err := m.Release(scopes); err != nil {
+			return d, err
+		}
+	}
+	return d, nil
+}
+
+// Release gives back a scan reserved over scopes that did not run.
+func (m *Meter) Release(scopes []string) error {
+	if m == nil {
+		return nil
+	}
+	return m.add(scopes, -1, 0)
+}
+
+// Record adds scans and tokens to the current month of every scope.
+func (m *Meter) Record(scopes []string, scans, tokens int) error {
+	if m == nil || scans == 0 && tokens == 0 {
+		return nil
+	}
+	return m.add(scopes, scans, tokens)
+}
+
+func (m *Meter) add(scopes []string, scans, tokens int) error {
+	now := time.Now().UTC()
+	for _, scope := range scopes {
+		if _, err := m.store.AddUsage(Month(now), scope, scans, tokens, now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// decide picks the action the most severe used-up budget of s calls for.
+func decide(s []Status) Decision {
+	var d Decision
+	for _, s := range s {
+		if !s.Exceeded {
+			continue
+		}
+		if s.Budget.OnExceeded == ActionReject {
+			return Decision{Action: ActionReject, Budget: s.Budget}
+		}
+		if d.Action == "" {
+			d = Decision{Action: ActionDegrade, Budget: s.Budget}
+		}
+	}
+	return d
+}
+
+// Status returns this month's usage of scopes with their budgets.
+func (m *Meter) Status(scopes []string) ([]Status, error) {
+	if m == nil {
+		return nil, nil
+	}
+	month := Month(time.Now())
+	out := make([]Status, 0, len(scopes))
+	for _, scope := range scopes {
+		u, err := m.store.GetUsage(month, scope)
+		if err != nil {
+			return nil, err
+		}
+		u.Scope, u.Month = scope, month
+		out = append(out, m.status(u))
+	}
+	return out, nil
+}
+
+// All returns this month's usage of every scope that has some or has a
+// budget, sorted by scope.
+func (m *Meter) All() ([]Status, error) {
+	if m == nil {
+		return nil, nil
+	}
+	month := Month(time.Now())
+	usage, err := m.store.ListUsage(month)
+	if err != nil {
+		return nil, err
+	}
+	byScope := map[string]Usage{}
+	for _, u := range usage {
+		byScope[u.Scope] = u
+	}
+	for _, b := range m.Budgets().Budgets {
+		if _, ok := byScope[b.Scope]; !ok {
+			byScope[b.Scope] = Usage{Scope: b.Scope, Month: month}
+		}
+	}
+	out := make([]Status, 0, len(byScope))
+	for _, u := range byScope {
+		out = append(out, m.status(u))
+	}
+	slices.SortFunc(out, func(a, b Status) int { return strings.Compare(a.Scope, b.Scope) })
+	return out, nil
+}
+
+// status prices u's tokens and matches u with its budget.
+func (m *Meter) status(u Usage) Status {
+	u.Cost = math.Round(float64(u.Tokens)/1000*m.costPer1K*1e4) / 1e4
+	s := Status{Usage: u}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := range m.budgets {
+		if b := m.budgets[i]; b.Scope == u.Scope {
+			s.Budget = &b
+			s.Exceeded = b.Scans > 0 && u.Scans >= b.Scans ||
+				b.Tokens > 0 && u.Tokens >= b.Tokens ||
+				b.Cost > 0 && u.Cost >= b.Cost
+			break
+		}
+	}
+	return s
+}
@@ -0,0 +1,298 @@
+package quota
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"weeklysec/internal/tenant"
+)
+
+// memStore is an in-memory Store.
+type memStore struct {
+	mu    sync.Mutex
+	usage map[string]Usage
+}
+
+func newMemStore() *memStore {
+	return &memStore{usage: map[string]Usage{}}
+}
+
+func (s *memStore) GetUsage(month, scope string) (Usage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.usage[Usage{Month: month, Scope: scope}.Key()], nil
+}
+
+func (s *memStore) AddUsage(month, scope string, scans, tokens int, at time.Time) (Usage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := Usage{Month: month, Scope: scope}.Key()
+	u := s.usage[key]
+	u.Month, u.Scope = month, scope
+	u.Scans += scans
+	u.Tokens += tokens
+	u.UpdatedAt = at
+	s.usage[key] = u
+	return u, nil
+}
+
+func (s *memStore) ListUsage(month string) ([]Usage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out []Usage
+	for _, u := range s.usage {
+		if u.Month == month {
+			out = append(out, u)
+		}
+	}
+	return out, nil
+}
+
+func TestConfigValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		budgets []Budget
+		wantErr string
+	}{
+		{"valid", []Budget{{Scope: " acme ", Scans: 10}, {Scope: "acme/web", Cost: 5, OnExceeded: ActionDegrade}, {Scope: "apikey:ci", Tokens: 1000}}, ""},
+		{"no scope", []Budget{{Scans: 1}}, "'scope' is required"},
+		{"duplicate scope", []Budget{{Scope: "acme"}, {Scope: "acme"}}, "duplicate scope"},
+		{"negative limit", []Budget{{Scope: "acme", Tokens: -1}}, "must not be negative"},
+		{"unknown action", []Budget{{Scope: "acme", OnExceeded: "warn"}}, "'on_exceeded' must be"},
+		{"invalid tenant", []Budget{{Scope: "acme/web/x"}}, "invalid tenant"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := Config{Budgets: tt.budgets}
+			err := c.Validate()
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Validate() error = %v, want it to contain %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if c.Budgets[0].Scope != "acme" || c.Budgets[0].OnExceeded != ActionReject {
+				t.Fatalf("Validate() left %+v", c.Budgets[0])
+			}
+		})
+	}
+}
+
+func TestScopes(t *testing.T) {
+	tests := []struct {
+		tenant tenant.Tenant
+		caller string
+		want   []string
+	}{
+		{tenant.Tenant{Org: "acme", Project: "web"}, "apikey:ci", []string{"acme", "acme/web", "apikey:ci"}},
+		{tenant.Tenant{Org: "acme", Project: tenant.AllProjects}, "", []string{"acme"}},
+	}
+	for _, tt := range tests {
+		if got := Scopes(tt.tenant, tt.caller); !slices.Equal(got, tt.want) {
+			t.Errorf("Scopes(%s, %q) = %v, want %v", tt.tenant, tt.caller, got, tt.want)
+		}
+	}
+}
+
+func TestMeterCheck(t *testing.T) {
+	scopes := []string{"acme", "acme/web", "apikey:ci"}
+	tests := []struct {
+		name         string
+		budgets      []Budget
+		scans        int
+		tokens       int
+		wantAction   string
+		wantExceeded string
+	}{
+		{"no budgets", nil, 100, 1e6, "", ""},
+		{"under every budget", []Budget{{Scope: "acme", Scans: 3}, {Scope: "apikey:ci", Tokens: 1000}}, 2, 999, "", ""},
+		{"scans used up", []Budget{{Scope: "acme/web", Scans: 2, OnExceeded: ActionReject}}, 2, 0, ActionReject, "acme/web"},
+		{"tokens used up degrades", []Budget{{Scope: "apikey:ci", Tokens: 1000, OnExceeded: ActionDegrade}}, 1, 1000, ActionDegrade, "apikey:ci"},
+		{"cost used up", []Budget{{Scope: "acme", Cost: 0.02, OnExceeded: ActionReject}}, 1, 1000, ActionReject, "acme"},
+		{"reject wins over degrade", []Budget{{Scope: "acme", Scans: 1, OnExceeded: ActionDegrade}, {Scope: "apikey:ci", Scans: 1, OnExceeded: ActionReject}}, 1, 0, ActionReject, "apikey:ci"},
+		{"other scopes do not count", []Budget{{Scope: "other", Scans: 1}}, 5, 0, "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := New(newMemStore(), 0.02)
+			m.SetBudgets(Config{Budgets: tt.budgets})
+			if err := m.Record(scopes, tt.scans, tt.tokens); err != nil {
+				t.Fatal(err)
+			}
+			d, err := m.Check(scopes)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if d.Action != tt.wantAction {
+				t.Fatalf("Check() = %+v, want action %q", d, tt.wantAction)
+			}
+			if tt.wantExceeded != "" && (d.Budget == nil || d.Budget.Scope != tt.wantExceeded) {
+				t.Fatalf("Check() budget = %+v, want %s", d.Budget, tt.wantExceeded)
+			}
+			if (d.Err() == "") != (tt.wantAction == "") {
+				t.Fatalf("Err() = %q for action %q", d.Err(), tt.wantAction)
+			}
+		})
+	}
+}
+
+func TestMeterRecord(t *testing.T) {
+	store := newMemStore()
+	m := New(store, 0.5)
+	for range 3 {
+		if err := m.Record([]string{"acme"}, 1, 1500); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := m.Record([]string{"acme"}, 0, 0); err != nil {
+		t.Fatal(err)
+	}
+	s, err := m.Status([]string{"acme", "unused"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s) != 2 || s[0].Scans != 3 || s[0].Tokens != 4500 || s[0].Cost != 2.25 || s[0].UpdatedAt.IsZero() {
+		t.Fatalf("Status() = %+v", s)
+	}
+	if s[1].Scope != "unused" || s[1].Scans != 0 || s[1].Budget != nil || s[1].Exceeded {
+		t.Fatalf("unused scope status = %+v", s[1])
+	}
+	if len(store.usage) != 1 {
+		t.Fatalf("stored %d usage records, want 1", len(store.usage))
+	}
+}
+
+func TestMeterReserve(t *testing.T) {
+	store := newMemStore()
+	m := New(store, 0)
+	m.SetBudgets(Config{Budgets: []Budget{{Scope: "acme/web", Scans: 5, OnExceeded: ActionReject}, {Scope: "apikey:ci", Scans: 100, OnExceeded: ActionDegrade}}})
+	scopes := []string{"acme", "acme/web", "apikey:ci"}
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	allowed := 0
+	for range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			d, err := m.Reserve(scopes)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if d.Action == "" {
+				mu.Lock()
+				allowed++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if allowed != 5 {
+		t.Fatalf("Reserve() allowed %d concurrent scans, want 5", allowed)
+	}
+	s, err := m.Status(scopes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range s {
+		if s.Scans != 5 {
+			t.Errorf("%s counts %d scans, want the 5 that were allowed", s.Scope, s.Scans)
+		}
+	}
+
+	if err := m.Release(scopes); err != nil {
+		t.Fatal(err)
+	}
+	if d, err := m.Reserve(scopes); err != nil || d.Action != "" {
+		t.Fatalf("Reserve() after a release = %+v, %v, want it allowed", d, err)
+	}
+}
+
+type failingStore struct {
+	*memStore
+	read, write error
+}
+
+func (s failingStore) GetUsage(month, scope string) (Usage, error) {
+	if s.read != nil {
+		return Usage{}, s.read
+	}
+	return s.memStore.GetUsage(month, scope)
+}
+
+func (s failingStore) AddUsage(month, scope string, scans, tokens int, at time.Time) (Usage, error) {
+	if s.write != nil && scope == "apikey:ci" {
+		return Usage{}, s.write
+	}
+	return s.memStore.AddUsage(month, scope, scans, tokens, at)
+}
+
+func TestMeterStoreErrors(t *testing.T) {
+	errDisk := errors.New("disk full")
+	store := failingStore{memStore: newMemStore(), write: errDisk}
+	m := New(store, 0)
+	scopes := []string{"acme", "apikey:ci"}
+	if err := m.Record(scopes, 1, 0); !errors.Is(err, errDisk) {
+		t.Fatalf("Record() error = %v, want the store error", err)
+	}
+	if _, err := m.Reserve(scopes); !errors.Is(err, errDisk) {
+		t.Fatalf("Reserve() error = %v, want the store error", err)
+	}
+	if u, _ := store.memStore.GetUsage(Month(time.Now()), "acme"); u.Scans != 1 {
+		t.Fatalf("a failed Reserve() left acme at %d scans, want the 1 recorded", u.Scans)
+	}
+
+	m = New(failingStore{memStore: newMemStore(), read: errors.New("connection reset")}, 0)
+	m.SetBudgets(Config{Budgets: []Budget{{Scope: "acme", Scans: 1}}})
+	if _, err := m.Check(scopes); err == nil {
+		t.Fatal("Check() took a read error for no usage")
+	}
+}
+
+func TestMeterAll(t *testing.T) {
+	m := New(newMemStore(), 0)
+	m.SetBudgets(Config{Budgets: []Budget{{Scope: "zeta", Scans: 1}, {Scope: "acme", Scans: 1}}})
+	if err := m.Record([]string{"acme", "beta"}, 1, 0); err != nil {
+		t.Fatal(err)
+	}
+	all, err := m.All()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, s := range all {
+		got = append(got, s.Scope)
+		if s.Scope == "acme" && !s.Exceeded {
+			t.Errorf("acme is not exceeded: %+v", s)
+		}
+	}
+	if want := []string{"acme", "beta", "zeta"}; !slices.Equal(got, want) {
+		t.Fatalf("All() scopes = %v, want %v", got, want)
+	}
+}
+
+func TestNilMeter(t *testing.T) {
+	var m *Meter
+	m.SetBudgets(Config{Budgets: []Budget{{Scope: "acme", Scans: 1}}})
+	if err := m.Record([]string{"acme"}, 1, 1); err != nil {
+		t.Fatal(err)
+	}
+	if d, err := m.Check([]string{"acme"}); err != nil || d.Action != "" {
+		t.Fatalf("nil meter Check() = %+v, %v", d, err)
+	}
+	if d, err := m.Reserve([]string{"acme"}); err != nil || d.Action != "" {
+		t.Fatalf("nil meter Reserve() = %+v, %v", d, err)
+	}
+	status, _ := m.Status([]string{"acme"})
+	all, _ := m.All()
+	if status != nil || all != nil || m.Budgets().Budgets == nil {
+		t.Fatal("nil meter reported usage")
+	}
+}
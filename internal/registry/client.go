@@ -0,0 +1,242 @@
+package registry
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// pageSize is the number of repositories asked for per catalog page.
+const pageSize = 1000
+
+// Client lists repositories and tags through the Docker Registry HTTP API
+// v2, which Harbor, GitLab, Artifactory, Quay and distribution implement.
+// Credentials are sent as basic auth, or exchanged for a bearer token when
+// the registry asks for one.
+type Client struct {
+	baseURL  string
+	host     string
+	username string
+	password string
+	http     *http.Client
+
+	mu     sync.Mutex
+	tokens map[string]string // bearer tokens by scope
+}
+
+// New returns a client for the registry at baseURL, e.g.
+// "https://harbor.example.com". Without a scheme https is assumed.
+func New(baseURL, username, password string) (*Client, error) {
+	if !strings.Contains(baseURL, "://") {
+		baseURL = "https://" + baseURL
+	}
+	u, err := url.Parse(strings.TrimRight(baseURL, "/"))
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid registry URL %q", baseURL)
+	}
+	return &Client{
+		baseURL:  u.String(),
+		host:     u.Host,
+		username: username,
+		password: password,
+		http:     &http.Client{Timeout: 30 * time.Second},
+		tokens:   map[string]string{},
+	}, nil
+}
+
+// Host returns the registry host that image references start with.
+func (c *Client) Host() string {
+	return c.host
+}
+
+// Repositories returns every repository in the catalog.
+func (c *Client) Repositories(ctx context.Context) ([]string, error) {
+	var repos []string
+	next := fmt.Sprintf("/v2/_catalog?n=%d", pageSize)
+	for next != "" {
+		var page struct {
+			Repositories []string `json:"repositories"`
+		}
+		link, err := c.get(ctx, next, "registry:catalog:*", &page)
+		if err != nil {
+			return nil, err
+		}
+		repos = append(repos, page.Repositories...)
+		next = nextPage(link)
+	}
+	return repos, nil
+}
+
+// Tags returns the tags of a repository.
+func (c *Client) Tags(ctx context.Context, repo string) ([]string, error) {
+	var tags []string
+	next := "/v2/" + repo + "/tags/list"
+	for next != "" {
+		var page struct {
+			Tags []string `json:"tags"`
+		}
+		link, err := c.get(ctx, next, "repository:"+repo+":pull", &page)
+		if err != nil {
+			return nil, err
+		}
+		tags = append(tags, page.Tags...)
+		next = nextPage(link)
+	}
+	return tags, nil
+}
+
+// get fetches path into out and returns the Link header.
+func (c *Client) get(ctx context.Context, path, scope string, out any) (string, error) {
+	resp, err := c.fetch(ctx, path, scope, "application/json")
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 32<<20)).Decode(out); err != nil {
+		return "", fmt.Errorf("registry: GET %s: invalid response: %w", path, err)
+	}
+	return resp.Header.Get("Link"), nil
+}
+
+// fetch GETs path and returns the response when it is a 200. A 401 with a
+// bearer challenge is answered once with a token for scope.
+func (c *Client) fetch(ctx context.Context, path, scope, accept string) (*http.Response, error) {
+	resp, err := c.send(ctx, path, scope, accept)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusUnauthorized {
+		challenge := resp.Header.Get("WWW-Authenticate")
+		resp.Body.Close()
+		if !strings.HasPrefix(strings.ToLower(challenge), "bearer ") {
+			return nil, fmt.Errorf("registry: %s: unauthorized", path)
+		}
+		if err := c.fetchToken(ctx, challenge, scope); err != nil {
+			return nil, err
+		}
+		if resp, err = c.send(ctx, path, scope, accept); err != nil {
+			return nil, err
+		}
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("registry: GET %s: %s", path, resp.Status)
+	}
+	return resp, nil
+}
+
+func (c *Client) send(ctx context.Context, path, scope, accept string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", accept)
+	c.mu.Lock()
+	token := c.tokens[scope]
+	c.mu.Unlock()
+	switch {
+	case token != "":
+		req.Header.Set("Authorization", "Bearer "+token)
+	case c.username != "":
+		req.SetBasicAuth(c.username, c.password)
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("registry: %w", err)
+	}
+	return resp, nil
+}
+
+// fetchToken gets a bearer token from the realm named in the challenge.
+func (c *Client) fetchToken(ctx context.Context, challenge, scope string) error {
+	params := parseChallenge(challenge[len("bearer "):])
+	realm, err := url.Parse(params["realm"])
+	if err != nil || realm.Host == "" {
+		return fmt.Errorf("registry: invalid auth challenge %q", challenge)
+	}
+	q := realm.Query()
+	if s := params["service"]; s != "" {
+		q.Set("service", s)
+	}
+	q.Set("scope", scope)
+	realm.RawQuery = q.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, realm.String(), nil)
+	if err != nil {
+		return err
+	}
+	if c.username != "" {
+		req.SetBasicAuth(c.username, c.password)
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("registry: token request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("registry: token request failed: %s", resp.Status)
+	}
+	var out struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return fmt.Errorf("registry: invalid token response: %w", err)
+	}
+	token := out.Token
+	if token == "" {
+		token = out.AccessToken
+	}
+	c.mu.Lock()
+	c.tokens[scope] = token
+	c.mu.Unlock()
+	return nil
+}
+
+// parseChallenge reads the key="value" pairs of a WWW-Authenticate header.
+func parseChallenge(s string) map[string]string {
+	out := map[string]string{}
+	for s != "" {
+		key, rest, ok := strings.Cut(s, "=")
+		if !ok {
+			break
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		var value string
+		if strings.HasPrefix(rest, `"`) {
+			end := strings.Index(rest[1:], `"`)
+			if end < 0 {
+				value, rest = rest[1:], ""
+			} else {
+				value, rest = rest[1:end+1], rest[end+2:]
+			}
+		} else {
+			value, rest, _ = strings.Cut(rest, ",")
+		}
+		out[key] = value
+		s = strings.TrimLeft(rest, ", ")
+	}
+	return out
+}
+
+// nextPage extracts the path of a `<...>; rel="next"` Link header.
+func nextPage(link string) string {
+	if link == "" || !strings.Contains(link, `rel="next"`) {
+		return ""
+	}
+	start, end := strings.Index(link, "<"), strings.Index(link, ">")
+	if start < 0 || end < start {
+		return ""
+	}
+	u, err := url.Parse(link[start+1 : end])
+	if err != nil {
+		return ""
+	}
+	return u.RequestURI()
+}
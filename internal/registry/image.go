@@ -0,0 +1,153 @@
+package registry
+
+import (
+	"cmp"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+)
+
+// Media types of the manifests Image understands.
+const (
+	dockerManifest = "application/vnd.docker.distribution.manifest.v2+json"
+	dockerList     = "application/vnd.docker.distribution.manifest.list.v2+json"
+	ociManifest    = "application/vnd.oci.image.manifest.v1+json"
+	ociIndex       = "application/vnd.oci.image.index.v1+json"
+)
+
+var manifestTypes = strings.Join([]string{dockerManifest, ociManifest, dockerList, ociIndex}, ", ")
+
+// Image describes an image as its registry serves it, without pulling its
+// layers.
+type Image struct {
+	Digest       string   // manifest digest the tag points at
+	ConfigDigest string   // digest of the image config, which Trivy reports as the image ID
+	DiffIDs      []string // uncompressed layer digests, base layer first
+}
+
+type manifest struct {
+	MediaType string `json:"mediaType"`
+	Config    struct {
+		Digest string `json:"digest"`
+	} `json:"config"`
+	Manifests []struct {
+		Digest   string `json:"digest"`
+		Platform struct {
+			OS           string `json:"os"`
+			Architecture string `json:"architecture"`
+		} `json:"platform"`
+	} `json:"manifests"`
+}
+
+// Image reads the manifest and config of repo at reference, a tag or a
+// digest. For a multi-platform image the linux/amd64 variant is read,
+// which is the one Trivy scans by default.
+func (c *Client) Image(ctx context.Context, repo, reference string) (Image, error) {
+	scope := "repository:" + repo + ":pull"
+	m, digest, err := c.manifest(ctx, repo, reference, scope)
+	if err != nil {
+		return Image{}, err
+	}
+	if len(m.Manifests) > 0 {
+		var platform string
+		for _, d := range m.Manifests {
+			if d.Platform.OS == "linux" && d.Platform.Architecture == "amd64" {
+				platform = d.Digest
+				break
+			}
+		}
+		if platform == "" {
+			return Image{}, fmt.Errorf("registry: %s:%s has no linux/amd64 image", repo, reference)
+		}
+		if m, _, err = c.manifest(ctx, repo, platform, scope); err != nil {
+			return Image{}, err
+		}
+	}
+	if m.Config.Digest == "" {
+		return Image{}, fmt.Errorf("registry: %s:%s: unsupported manifest type %q", repo, reference, m.MediaType)
+	}
+
+	var config struct {
+		RootFS struct {
+			DiffIDs []string `json:"diff_ids"`
+		} `json:"rootfs"`
+	}
+	if _, err := c.get(ctx, "/v2/"+repo+"/blobs/"+m.Config.Digest, scope, &config); err != nil {
+		return Image{}, err
+	}
+	return Image{Digest: digest, ConfigDigest: m.Config.Digest, DiffIDs: config.RootFS.DiffIDs}, nil
+}
+
+// manifest fetches a manifest and the digest it is stored under.
+func (c *Client) manifest(ctx context.Context, repo, reference, scope string) (*manifest, string, error) {
+	path := "/v2/" + repo + "/manifests/" + reference
+	resp, err := c.fetch(ctx, path, scope, manifestTypes)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 4<<20))
+	if err != nil {
+		return nil, "", fmt.Errorf("registry: GET %s: %w", path, err)
+	}
+	var m manifest
+	if err := json.Unmarshal(body, &m); err != nil {
+		return nil, "", fmt.Errorf("registry: GET %s: invalid response: %w", path, err)
+	}
+	digest := resp.Header.Get("Docker-Content-Digest")
+	if digest == "" {
+		sum := sha256.Sum256(body)
+		digest = "sha256:" + hex.EncodeToString(sum[:])
+	}
+	return &m, digest, nil
+}
+
+// Images reads images from whichever registry hosts them, through the
+// client given for that host or anonymously.
+type Images struct {
+	mu      sync.Mutex
+	clients map[string]*Client // by Reference host
+}
+
+// NewImages returns an Images that uses clients for their hosts.
+func NewImages(clients ...*Client) *Images {
+	im := &Images{clients: make(map[string]*Client, len(clients))}
+	for _, c := range clients {
+		im.clients[strings.ToLower(c.Host())] = c
+	}
+	return im
+}
+
+// Image reads the image ref names.
+func (im *Images) Image(ctx context.Context, ref string) (Image, error) {
+	r := Parse(ref)
+	host, repo, _ := strings.Cut(r.Repository, "/")
+	c, err := im.client(host)
+	if err != nil {
+		return Image{}, err
+	}
+	return c.Image(ctx, repo, cmp.Or(r.Digest, r.Tag))
+}
+
+func (im *Images) client(host string) (*Client, error) {
+	im.mu.Lock()
+	defer im.mu.Unlock()
+	if c, ok := im.clients[host]; ok {
+		return c, nil
+	}
+	base := host
+	if host == "docker.io" {
+		base = "registry-1.docker.io"
+	}
+	c, err := New(base, "", "")
+	if err != nil {
+		return nil, err
+	}
+	im.clients[host] = c
+	return c, nil
+}
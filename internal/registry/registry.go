@@ -0,0 +1,203 @@
+// Package registry talks to container registries: it reads the push
+// notifications they send, lists their catalogs, and normalizes image
+// references so images can be matched to targets.
+package registry
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Providers whose push events ParseEvent understands.
+const (
+	Harbor    = "harbor"
+	DockerHub = "dockerhub"
+	ECR       = "ecr" // EventBridge "ECR Image Action" events
+	GCR       = "gcr" // Pub/Sub push subscriptions to the gcr topic, also used by Artifact Registry
+)
+
+// Providers lists the supported providers.
+var Providers = []string{Harbor, DockerHub, ECR, GCR}
+
+// ParseEvent returns the image references pushed according to an event
+// from provider. Events other than pushes yield no references.
+func ParseEvent(provider string, body []byte) ([]string, error) {
+	switch provider {
+	case Harbor:
+		return parseHarbor(body)
+	case DockerHub:
+		return parseDockerHub(body)
+	case ECR:
+		return parseECR(body)
+	case GCR:
+		return parseGCR(body)
+	}
+	return nil, fmt.Errorf("unknown registry provider %q", provider)
+}
+
+func parseHarbor(body []byte) ([]string, error) {
+	var ev struct {
+		Type      string `json:"type"`
+		EventData struct {
+			Resources []struct {
+				Tag         string `json:"tag"`
+				Digest      string `json:"digest"`
+				ResourceURL string `json:"resource_url"`
+			} `json:"resources"`
+		} `json:"event_data"`
+	}
+	if err := json.Unmarshal(body, &ev); err != nil {
+		return nil, fmt.Errorf("invalid Harbor event: %w", err)
+	}
+	// Harbor 1.x called it pushImage
+	if ev.Type != "PUSH_ARTIFACT" && ev.Type != "pushImage" {
+		return nil, nil
+	}
+	var refs []string
+	for _, r := range ev.EventData.Resources {
+		if r.ResourceURL != "" {
+			refs = append(refs, r.ResourceURL)
+		}
+	}
+	return refs, nil
+}
+
+func parseDockerHub(body []byte) ([]string, error) {
+	var ev struct {
+		PushData struct {
+			Tag string `json:"tag"`
+		} `json:"push_data"`
+		Repository struct {
+			RepoName string `json:"repo_name"`
+		} `json:"repository"`
+	}
+	if err := json.Unmarshal(body, &ev); err != nil {
+		return nil, fmt.Errorf("invalid Docker Hub event: %w", err)
+	}
+	if ev.Repository.RepoName == "" {
+		return nil, fmt.Errorf("invalid Docker Hub event: missing repository")
+	}
+	tag := ev.PushData.Tag
+	if tag == "" {
+		tag = "latest"
+	}
+	return []string{ev.Repository.RepoName + ":" + tag}, nil
+}
+
+func parseECR(body []byte) ([]string, error) {
+	var ev struct {
+		DetailType string `json:"detail-type"`
+		Account    string `json:"account"`
+		Region     string `json:"region"`
+		Detail     struct {
+			Result         string `json:"result"`
+			ActionType     string `json:"action-type"`
+			RepositoryName string `json:"repository-name"`
+			ImageTag       string `json:"image-tag"`
+			ImageDigest    string `json:"image-digest"`
+		} `json:"detail"`
+	}
+	if err := json.Unmarshal(body, &ev); err != nil {
+		return nil, fmt.Errorf("invalid ECR event: %w", err)
+	}
+	d := ev.Detail
+	if ev.DetailType != "ECR Image Action" || d.ActionType != "PUSH" || d.Result != "SUCCESS" {
+		return nil, nil
+	}
+	if ev.Account == "" || ev.Region == "" || d.RepositoryName == "" {
+		return nil, fmt.Errorf("invalid ECR event: missing account, region or repository")
+	}
+	repo := fmt.Sprintf("%s.dkr.ecr.%s.amazonaws.com/%s", ev.Account, ev.Region, d.RepositoryName)
+	switch {
+	case d.ImageTag != "":
+		return []string{repo + ":" + d.ImageTag}, nil
+	case d.ImageDigest != "":
+		return []string{repo + "@" + d.ImageDigest}, nil
+	}
+	return nil, nil
+}
+
+func parseGCR(body []byte) ([]string, error) {
+	var push struct {
+		Message struct {
+			Data string `json:"data"`
+		} `json:"message"`
+	}
+	if err := json.Unmarshal(body, &push); err != nil {
+		return nil, fmt.Errorf("invalid Pub/Sub push: %w", err)
+	}
+	data, err := base64.StdEncoding.DecodeString(push.Message.Data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Pub/Sub push: %w", err)
+	}
+	var ev struct {
+		Action string `json:"action"`
+		Digest string `json:"digest"`
+		Tag    string `json:"tag"`
+	}
+	if err := json.Unmarshal(data, &ev); err != nil {
+		return nil, fmt.Errorf("invalid GCR event: %w", err)
+	}
+	if ev.Action != "INSERT" {
+		return nil, nil
+	}
+	switch {
+	case ev.Tag != "":
+		return []string{ev.Tag}, nil
+	case ev.Digest != "":
+		return []string{ev.Digest}, nil
+	}
+	return nil, nil
+}
+
+// Reference is a parsed image reference.
+type Reference struct {
+	Repository string // registry host and path, e.g. docker.io/library/alpine
+	Tag        string // "latest" when neither a tag nor a digest is given
+	Digest     string
+}
+
+// Parse splits an image reference, filling in Docker Hub's defaults so
+// "alpine" and "docker.io/library/alpine:latest" compare equal.
+func Parse(ref string) Reference {
+	var r Reference
+	ref = strings.TrimSpace(ref)
+	if name, digest, ok := strings.Cut(ref, "@"); ok {
+		ref, r.Digest = name, digest
+	}
+	// A colon after the last slash separates the tag; one before it is a
+	// registry port.
+	if i := strings.LastIndex(ref, ":"); i > strings.LastIndex(ref, "/") {
+		ref, r.Tag = ref[:i], ref[i+1:]
+	}
+	if r.Tag == "" && r.Digest == "" {
+		r.Tag = "latest"
+	}
+
+	host, path, ok := strings.Cut(ref, "/")
+	if !ok || !strings.ContainsAny(host, ".:") && host != "localhost" {
+		host, path = "docker.io", ref
+	}
+	if host == "index.docker.io" || host == "registry-1.docker.io" {
+		host = "docker.io"
+	}
+	if host == "docker.io" && !strings.Contains(path, "/") {
+		path = "library/" + path
+	}
+	r.Repository = strings.ToLower(host + "/" + path)
+	return r
+}
+
+// String returns the fully qualified reference.
+func (r Reference) String() string {
+	s := r.Repository
+	if r.Tag != "" {
+		s += ":" + r.Tag
+	}
+	if r.Digest != "" {
+		s += "@" + r.Digest
+	}
+	return s
+}
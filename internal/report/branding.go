@@ -0,0 +1,107 @@
+package report
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/base64"
+	"fmt"
+	htmltemplate "html/template"
+	"image"
+	_ "image/gif" // logo formats
+	_ "image/jpeg"
+	_ "image/png"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+)
+
+// maxLogoBytes bounds the logo file, which is embedded in every report.
+const maxLogoBytes = 1 << 20
+
+// Branding white-labels HTML and PDF reports, for those running the tool on
+// behalf of others. The zero value brands nothing.
+type Branding struct {
+	OrgName        string
+	Classification string // a banner atop and below every page, such as CONFIDENTIAL
+	Footer         string
+
+	// LogoURL is the src of the logo in HTML: the URL configured, or a
+	// data URI of the file.
+	LogoURL htmltemplate.URL
+
+	logo *pdfImage // the logo file, for PDFs; nil for a URL
+}
+
+// NewBranding brands reports with the organization name, classification
+// banner and footer given, and the logo at logo: an http(s) URL, linked
+// from HTML and left out of PDFs, or a PNG, JPEG or GIF file of up to 1 MiB,
+// embedded in both.
+func NewBranding(orgName, logo, classification, footer string) (Branding, error) {
+	b := Branding{OrgName: orgName, Classification: classification, Footer: footer}
+	if logo == "" {
+		return b, nil
+	}
+	if u, err := url.Parse(logo); err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "" {
+		b.LogoURL = htmltemplate.URL(logo)
+		return b, nil
+	}
+
+	data, err := os.ReadFile(logo)
+	if err != nil {
+		return b, err
+	}
+	if len(data) > maxLogoBytes {
+		return b, fmt.Errorf("%s: logo is larger than %d bytes", logo, maxLogoBytes)
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return b, fmt.Errorf("%s: %w", logo, err)
+	}
+	b.LogoURL = htmltemplate.URL("data:" + http.DetectContentType(data) + ";base64," + base64.StdEncoding.EncodeToString(data))
+	b.logo = newPDFImage(img)
+	return b, nil
+}
+
+// pdfImage is an image as a PDF XObject: 8-bit RGB, Flate-compressed.
+type pdfImage struct {
+	width, height int
+	data          []byte
+}
+
+// newPDFImage flattens img onto white, PDF images being opaque.
+func newPDFImage(img image.Image) *pdfImage {
+	bounds := img.Bounds()
+	var buf bytes.Buffer
+	zw := zlib.NewWriter(&buf)
+	row := make([]byte, 3*bounds.Dx())
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			r, g, b, a := img.At(x, y).RGBA() // alpha-premultiplied
+			i := 3 * (x - bounds.Min.X)
+			row[i], row[i+1], row[i+2] = byte((r+0xffff-a)>>8), byte((g+0xffff-a)>>8), byte((b+0xffff-a)>>8)
+		}
+		_, _ = zw.Write(row)
+	}
+	_ = zw.Close()
+	return &pdfImage{width: bounds.Dx(), height: bounds.Dy(), data: buf.Bytes()}
+}
+
+var (
+	brandingMu sync.RWMutex
+	branding   Branding
+)
+
+// SetBranding replaces the branding of reports rendered from now on.
+func SetBranding(b Branding) {
+	brandingMu.Lock()
+	defer brandingMu.Unlock()
+	branding = b
+}
+
+// CurrentBranding returns the branding in use.
+func CurrentBranding() Branding {
+	brandingMu.RLock()
+	defer brandingMu.RUnlock()
+	return branding
+}
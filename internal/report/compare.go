@@ -0,0 +1,102 @@
+package report
+
+import (
+	"fmt"
+	"strings"
+	"weeklysec/internal/envcompare"
+	"weeklysec/internal/i18n"
+)
+
+// CompareText renders an environment comparison as plain text, with its
+// fixed strings in l.
+func CompareText(r *envcompare.Report, l *i18n.Locale) string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "%s: %s -> %s (%s)\n", l.T("Environment Comparison"), r.From, r.To, l.T("by %s", r.By))
+	fmt.Fprintf(&b, "%s: %s\n", l.T("Applications"), l.T("%d compared, %d ready to promote", len(r.Applications), r.Promotable))
+	fmt.Fprintf(&b, "%s: %s\n", l.T("Findings"), l.T("%d fixed in %s, %d only in %s", r.FixedInFrom, r.From, r.OnlyInFrom, r.From))
+
+	for _, a := range r.Applications {
+		fmt.Fprintf(&b, "\n%s: %s%s\n", a.Application,
+			l.T("risk %.1f in %s, %.1f in %s, %d common", a.FromRiskScore, r.From, a.ToRiskScore, r.To, a.Common), promoteNote(a.Promote, l))
+		fmt.Fprintf(&b, "  %s: %s\n", r.From, targetList(a.From))
+		fmt.Fprintf(&b, "  %s: %s\n", r.To, targetList(a.To))
+		if len(a.FixedInFrom) > 0 {
+			fmt.Fprintf(&b, "  %s:\n", l.T("Open in %s, fixed in %s", r.To, r.From))
+			for _, f := range a.FixedInFrom {
+				fmt.Fprintf(&b, "  - %s (%s): %s %s\n", f.VulnerabilityID, f.Severity, f.PkgName, f.InstalledVersion)
+			}
+		}
+		if len(a.OnlyInFrom) > 0 {
+			fmt.Fprintf(&b, "  %s:\n", l.T("Only in %s", r.From))
+			for _, f := range a.OnlyInFrom {
+				fmt.Fprintf(&b, "  - %s (%s): %s %s\n", f.VulnerabilityID, f.Severity, f.PkgName, f.InstalledVersion)
+			}
+		}
+	}
+
+	if len(r.Unpaired) > 0 {
+		fmt.Fprintf(&b, "\n%s: %s\n", l.T("Scanned on one side only"), strings.Join(r.Unpaired, ", "))
+	}
+	return b.String()
+}
+
+// CompareMarkdown renders an environment comparison as GitHub-flavoured
+// Markdown, with its fixed strings in l.
+func CompareMarkdown(r *envcompare.Report, l *i18n.Locale) string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "# %s: %s → %s\n\n", l.T("Environment comparison"), r.From, r.To)
+	fmt.Fprintf(&b, "**%s:** %s — %s\n\n", l.T("Compared by"), r.By,
+		l.T("%d applications, %d ready to promote, %d findings fixed in %s, %d only in %s",
+			len(r.Applications), r.Promotable, r.FixedInFrom, r.From, r.OnlyInFrom, r.From))
+
+	if len(r.Applications) > 0 {
+		b.WriteString(header(l, "Application", l.T("Risk (%s)", r.From), l.T("Risk (%s)", r.To), l.T("Fixed in %s", r.From), l.T("Only in %s", r.From), "Common", "Promote"))
+		for _, a := range r.Applications {
+			fmt.Fprintf(&b, "| %s | %.1f | %.1f | %d | %d | %d | %s |\n",
+				a.Application, a.FromRiskScore, a.ToRiskScore, len(a.FixedInFrom), len(a.OnlyInFrom), a.Common, yesNo(a.Promote, l))
+		}
+	}
+
+	for _, a := range r.Applications {
+		if len(a.FixedInFrom) == 0 && len(a.OnlyInFrom) == 0 {
+			continue
+		}
+		fmt.Fprintf(&b, "\n## %s\n\n`%s` → `%s`\n", a.Application, targetList(a.From), targetList(a.To))
+		if len(a.FixedInFrom) > 0 {
+			fmt.Fprintf(&b, "\n### %s\n\n", l.T("Open in %s, fixed in %s", r.To, r.From))
+			b.WriteString(header(l, "ID", "Severity", "Package", "Installed", "Fixed"))
+			for _, f := range a.FixedInFrom {
+				fmt.Fprintf(&b, "| %s | %s | %s | %s | %s |\n", f.VulnerabilityID, f.Severity, f.PkgName, f.InstalledVersion, f.FixedVersion)
+			}
+		}
+		if len(a.OnlyInFrom) > 0 {
+			fmt.Fprintf(&b, "\n### %s\n\n", l.T("Only in %s", r.From))
+			b.WriteString(header(l, "ID", "Severity", "Package", "Installed", "Fixed"))
+			for _, f := range a.OnlyInFrom {
+				fmt.Fprintf(&b, "| %s | %s | %s | %s | %s |\n", f.VulnerabilityID, f.Severity, f.PkgName, f.InstalledVersion, f.FixedVersion)
+			}
+		}
+	}
+
+	if len(r.Unpaired) > 0 {
+		fmt.Fprintf(&b, "\n_%s: %s_\n", l.T("Scanned on one side only"), strings.Join(r.Unpaired, ", "))
+	}
+	return b.String()
+}
+
+func targetList(ts []envcompare.Target) string {
+	refs := make([]string, len(ts))
+	for i, t := range ts {
+		refs[i] = t.Target
+	}
+	return strings.Join(refs, ", ")
+}
+
+func promoteNote(promote bool, l *i18n.Locale) string {
+	if promote {
+		return ", " + l.T("ready to promote")
+	}
+	return ""
+}
@@ -0,0 +1,168 @@
+package report
+
+import (
+	"fmt"
+	"strings"
+	"weeklysec/internal/digest"
+	"weeklysec/internal/i18n"
+	"weeklysec/internal/trivy"
+)
+
+// DigestText renders a digest as plain text, with its fixed strings in l.
+func DigestText(d *digest.Digest, l *i18n.Locale) string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "%s: %s\n", l.T("Security Digest"), l.T("%s to %s", d.PeriodStart.Format("2006-01-02"), d.PeriodEnd.Format("2006-01-02")))
+	fmt.Fprintf(&b, "%s: %.1f / 100\n", l.T("Fleet Risk Score"), d.FleetRiskScore)
+	fmt.Fprintf(&b, "%s: %s\n", l.T("Targets"), l.T("%d scanned, %d not scanned (%d scans)", d.TargetsScanned, d.TargetsMissed, d.Scans))
+	for _, sev := range trivy.Severities {
+		fmt.Fprintf(&b, "- %s: %d\n", sev, d.BySeverity[sev])
+	}
+
+	if len(d.TopIssues) > 0 {
+		fmt.Fprintf(&b, "\n%s:\n", l.T("Top Issues"))
+		for _, iss := range d.TopIssues {
+			fmt.Fprintf(&b, "- %s (%s): %s%s\n", iss.VulnerabilityID, iss.Severity, l.T("%d targets", len(iss.Targets)), fixNote(iss.Fixable, l))
+		}
+	}
+
+	if len(d.FixLeverage) > 0 {
+		fmt.Fprintf(&b, "\n%s:\n", l.T("Biggest Wins"))
+		for _, a := range d.FixLeverage {
+			fmt.Fprintf(&b, "- %s: %s\n", leverageAction(a, l),
+				l.T("%d findings (%d critical, %d high) in %d targets", a.Findings, a.BySeverity["CRITICAL"], a.BySeverity["HIGH"], len(a.Targets)))
+		}
+	}
+
+	if len(d.NewCriticals) > 0 {
+		fmt.Fprintf(&b, "\n%s:\n", l.T("New Criticals"))
+		for _, f := range d.NewCriticals {
+			fmt.Fprintf(&b, "- %s: %s (%s)\n", f.VulnerabilityID, l.T("%s in %s", f.PkgName, f.Target), f.Team)
+		}
+	}
+
+	if len(d.SLABreaches) > 0 {
+		fmt.Fprintf(&b, "\n%s:\n", l.T("SLA Breaches"))
+		for _, br := range d.SLABreaches {
+			fmt.Fprintf(&b, "- %s (%s): %s\n", br.VulnerabilityID, br.Severity, l.T("%s in %s, open %s (SLA %s)", br.PkgName, br.Target, br.OpenFor, br.SLA))
+		}
+	}
+
+	if len(d.Teams) > 0 {
+		fmt.Fprintf(&b, "\n%s:\n", l.T("Teams"))
+		for _, t := range d.Teams {
+			fmt.Fprintf(&b, "- %s: %s%s\n", t.Team,
+				l.T("risk %.1f (%s), %d targets, %d critical, %d high, %.0f%% within SLA, %d fixed",
+					t.RiskScore, trendNote(t, l), t.Targets, t.OpenCriticals, t.BySeverity["HIGH"], t.SLACompliance, t.Fixed),
+				mttrNote(t, l))
+		}
+	}
+
+	return b.String()
+}
+
+// DigestMarkdown renders a digest as GitHub-flavoured Markdown, with its
+// fixed strings in l.
+func DigestMarkdown(d *digest.Digest, l *i18n.Locale) string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "# %s: %s\n\n", l.T("Security digest"), l.T("%s to %s", d.PeriodStart.Format("2006-01-02"), d.PeriodEnd.Format("2006-01-02")))
+	fmt.Fprintf(&b, "**%s:** %.1f / 100 — %s\n\n", l.T("Fleet risk score"), d.FleetRiskScore,
+		l.T("%d targets scanned, %d not scanned, %d scans", d.TargetsScanned, d.TargetsMissed, d.Scans))
+	b.WriteString(header(l, "Severity", "Open"))
+	for _, sev := range trivy.Severities {
+		fmt.Fprintf(&b, "| %s | %d |\n", sev, d.BySeverity[sev])
+	}
+
+	if len(d.TopIssues) > 0 {
+		fmt.Fprintf(&b, "\n## %s\n\n", l.T("Top issues"))
+		b.WriteString(header(l, "ID", "Severity", "CVSS", "Targets", "Fixable"))
+		for _, iss := range d.TopIssues {
+			fmt.Fprintf(&b, "| %s | %s | %.1f | %s | %s |\n",
+				iss.VulnerabilityID, iss.Severity, iss.CVSSScore, strings.Join(iss.Targets, ", "), yesNo(iss.Fixable, l))
+		}
+	}
+
+	if len(d.FixLeverage) > 0 {
+		fmt.Fprintf(&b, "\n## %s\n\n", l.T("Biggest wins"))
+		b.WriteString(header(l, "Action", "Findings", "Critical", "High", "Targets"))
+		for _, a := range d.FixLeverage {
+			fmt.Fprintf(&b, "| %s | %d | %d | %d | %d |\n", leverageAction(a, l), a.Findings, a.BySeverity["CRITICAL"], a.BySeverity["HIGH"], len(a.Targets))
+		}
+	}
+
+	if len(d.NewCriticals) > 0 {
+		fmt.Fprintf(&b, "\n## %s\n\n", l.T("New criticals"))
+		b.WriteString(header(l, "ID", "Package", "Target", "Team", "First seen"))
+		for _, f := range d.NewCriticals {
+			fmt.Fprintf(&b, "| %s | %s | `%s` | %s | %s |\n", f.VulnerabilityID, f.PkgName, f.Target, f.Team, f.FirstSeen.Format("2006-01-02"))
+		}
+	}
+
+	if len(d.SLABreaches) > 0 {
+		fmt.Fprintf(&b, "\n## %s\n\n", l.T("SLA breaches"))
+		b.WriteString(header(l, "ID", "Severity", "Package", "Target", "Team", "Open for", "SLA"))
+		for _, br := range d.SLABreaches {
+			fmt.Fprintf(&b, "| %s | %s | %s | `%s` | %s | %s | %s |\n", br.VulnerabilityID, br.Severity, br.PkgName, br.Target, br.Team, br.OpenFor, br.SLA)
+		}
+	}
+
+	if len(d.Teams) > 0 {
+		fmt.Fprintf(&b, "\n## %s\n\n", l.T("Teams"))
+		b.WriteString(header(l, "Team", "Risk", "Trend", "Targets", "Critical", "High", "SLA breaches", "Within SLA", "Fixed", "MTTR"))
+		for _, t := range d.Teams {
+			fmt.Fprintf(&b, "| %s | %.1f | %s | %d | %d | %d | %d | %.0f%% | %d | %s |\n",
+				t.Team, t.RiskScore, trendNote(t, l), t.Targets, t.OpenCriticals, t.BySeverity["HIGH"], t.SLABreaches, t.SLACompliance, t.Fixed, mttrDays(t, l))
+		}
+	}
+
+	return b.String()
+}
+
+// leverageAction describes a fleet-wide action in a few words.
+func leverageAction(a digest.Leverage, l *i18n.Locale) string {
+	if a.Action == digest.ActionBaseImage {
+		return l.T("Update base image %s", a.Subject)
+	}
+	pkg := a.Subject
+	if a.Ecosystem != "" {
+		pkg += " (" + a.Ecosystem + ")"
+	}
+	return l.T("Upgrade %s to %s", pkg, a.Version)
+}
+
+// trendNote describes a team's trend with its change in risk score.
+func trendNote(t digest.Team, l *i18n.Locale) string {
+	if t.Trend == digest.TrendNew {
+		return l.T(t.Trend)
+	}
+	return fmt.Sprintf("%s, %+.1f", l.T(t.Trend), t.RiskChange)
+}
+
+func mttrNote(t digest.Team, l *i18n.Locale) string {
+	if t.Fixed == 0 {
+		return ""
+	}
+	return ", MTTR " + mttrDays(t, l)
+}
+
+func mttrDays(t digest.Team, l *i18n.Locale) string {
+	if t.Fixed == 0 {
+		return "-"
+	}
+	return l.T("%.1f days", t.MTTRDays)
+}
+
+func fixNote(fixable bool, l *i18n.Locale) string {
+	if fixable {
+		return ", " + l.T("fix available")
+	}
+	return ""
+}
+
+func yesNo(b bool, l *i18n.Locale) string {
+	if b {
+		return l.T("yes")
+	}
+	return l.T("no")
+}
@@ -0,0 +1,99 @@
+package report
+
+import (
+	"bytes"
+	"html/template"
+	"strings"
+	"weeklysec/internal/digest"
+	"weeklysec/internal/i18n"
+	"weeklysec/internal/trivy"
+)
+
+// digestHTML is parsed once; each render clones it with t, yesNo, trend,
+// mttr and action bound to the locale.
+var digestHTML = template.Must(template.New("digest").Funcs(localeFuncs(nil)).Funcs(template.FuncMap{
+	"date":  func(t interface{ Format(string) string }) string { return t.Format("2006-01-02") },
+	"join":  strings.Join,
+	"lower": strings.ToLower,
+}).Parse(`<!DOCTYPE html>
+<html lang="{{.Lang}}"><head><meta charset="utf-8"><title>{{t "Security digest"}}</title>
+<style>
+body{font-family:-apple-system,Segoe UI,Helvetica,Arial,sans-serif;color:#1f2328;max-width:860px;margin:0 auto;padding:16px}
+table{border-collapse:collapse;width:100%;margin:8px 0 20px}
+th,td{border:1px solid #d0d7de;padding:4px 8px;text-align:left;font-size:13px}
+th{background:#f6f8fa}
+.critical{color:#cf222e;font-weight:600}.high{color:#bc4c00;font-weight:600}
+.score{font-size:28px;font-weight:600}
+.classification{background:#cf222e;color:#fff;font-weight:600;text-align:center;padding:2px;letter-spacing:1px}
+.brand{display:flex;align-items:center;gap:12px;margin:12px 0;font-size:20px;font-weight:600}
+.footer{color:#656d76;font-size:12px}
+</style></head><body>
+{{with .Brand.Classification}}<div class="classification">{{.}}</div>{{end}}
+{{if or .Brand.LogoURL .Brand.OrgName}}<div class="brand">{{with .Brand.LogoURL}}<img src="{{.}}" alt="" height="40">{{end}}{{with .Brand.OrgName}}<span>{{.}}</span>{{end}}</div>{{end}}
+<h1>{{t "Security digest"}}: {{t "%s to %s" (date .D.PeriodStart) (date .D.PeriodEnd)}}</h1>
+<p><span class="score">{{printf "%.1f" .D.FleetRiskScore}}</span> / 100 {{t "fleet risk score"}} &mdash;
+{{t "%d targets scanned, %d not scanned, %d scans" .D.TargetsScanned .D.TargetsMissed .D.Scans}}</p>
+<table><tr><th>{{t "Severity"}}</th><th>{{t "Open"}}</th></tr>
+{{range .Severities}}<tr><td class="{{lower .}}">{{.}}</td><td>{{index $.D.BySeverity .}}</td></tr>
+{{end}}</table>
+{{with .D.TopIssues}}<h2>{{t "Top issues"}}</h2>
+<table><tr><th>{{t "ID"}}</th><th>{{t "Severity"}}</th><th>{{t "CVSS"}}</th><th>{{t "Targets"}}</th><th>{{t "Fixable"}}</th></tr>
+{{range .}}<tr><td>{{.VulnerabilityID}}</td><td class="{{lower .Severity}}">{{.Severity}}</td><td>{{printf "%.1f" .CVSSScore}}</td><td>{{join .Targets ", "}}</td><td>{{yesNo .Fixable}}</td></tr>
+{{end}}</table>{{end}}
+{{with .D.FixLeverage}}<h2>{{t "Biggest wins"}}</h2>
+<table><tr><th>{{t "Action"}}</th><th>{{t "Findings"}}</th><th>{{t "Critical"}}</th><th>{{t "High"}}</th><th>{{t "Targets"}}</th></tr>
+{{range .}}<tr><td>{{action .}}</td><td>{{.Findings}}</td><td>{{index .BySeverity "CRITICAL"}}</td><td>{{index .BySeverity "HIGH"}}</td><td>{{len .Targets}}</td></tr>
+{{end}}</table>{{end}}
+{{with .D.NewCriticals}}<h2>{{t "New criticals"}}</h2>
+<table><tr><th>{{t "ID"}}</th><th>{{t "Package"}}</th><th>{{t "Target"}}</th><th>{{t "Team"}}</th><th>{{t "First seen"}}</th></tr>
+{{range .}}<tr><td>{{.VulnerabilityID}}</td><td>{{.PkgName}}</td><td><code>{{.Target}}</code></td><td>{{.Team}}</td><td>{{date .FirstSeen}}</td></tr>
+{{end}}</table>{{end}}
+{{with .D.SLABreaches}}<h2>{{t "SLA breaches"}}</h2>
+<table><tr><th>{{t "ID"}}</th><th>{{t "Severity"}}</th><th>{{t "Package"}}</th><th>{{t "Target"}}</th><th>{{t "Team"}}</th><th>{{t "Open for"}}</th><th>{{t "SLA"}}</th></tr>
+{{range .}}<tr><td>{{.VulnerabilityID}}</td><td class="{{lower .Severity}}">{{.Severity}}</td><td>{{.PkgName}}</td><td><code>{{.Target}}</code></td><td>{{.Team}}</td><td>{{.OpenFor}}</td><td>{{.SLA}}</td></tr>
+{{end}}</table>{{end}}
+{{with .D.Teams}}<h2>{{t "Teams"}}</h2>
+<table><tr><th>{{t "Team"}}</th><th>{{t "Risk"}}</th><th>{{t "Trend"}}</th><th>{{t "Targets"}}</th><th>{{t "Critical"}}</th><th>{{t "High"}}</th><th>{{t "SLA breaches"}}</th><th>{{t "Within SLA"}}</th><th>{{t "Fixed"}}</th><th>{{t "MTTR"}}</th></tr>
+{{range .}}<tr><td>{{.Team}}</td><td>{{printf "%.1f" .RiskScore}}</td><td>{{trend .}}</td><td>{{.Targets}}</td><td>{{.OpenCriticals}}</td><td>{{index .BySeverity "HIGH"}}</td><td>{{.SLABreaches}}</td><td>{{printf "%.0f%%" .SLACompliance}}</td><td>{{.Fixed}}</td><td>{{mttr .}}</td></tr>
+{{end}}</table>{{end}}
+{{with .Link}}<p><a href="{{.}}">{{t "View the digest online"}}</a></p>{{end}}
+{{with .Brand.Footer}}<p class="footer">{{.}}</p>{{end}}
+{{with .Brand.Classification}}<div class="classification">{{.}}</div>{{end}}
+</body></html>
+`))
+
+// localeFuncs are the template functions that translate into l.
+func localeFuncs(l *i18n.Locale) template.FuncMap {
+	return template.FuncMap{
+		"t":      l.T,
+		"yesNo":  func(b bool) string { return yesNo(b, l) },
+		"trend":  func(t digest.Team) string { return trendNote(t, l) },
+		"mttr":   func(t digest.Team) string { return mttrDays(t, l) },
+		"action": func(a digest.Leverage) string { return leverageAction(a, l) },
+	}
+}
+
+// DigestHTML renders a digest as a standalone HTML page, suitable as an
+// email body, with its fixed strings in l and the current branding. link,
+// if set, points to the digest online.
+func DigestHTML(d *digest.Digest, link string, l *i18n.Locale) (string, error) {
+	tmpl, err := digestHTML.Clone()
+	if err != nil {
+		return "", err
+	}
+	var b bytes.Buffer
+	err = tmpl.Funcs(localeFuncs(l)).Execute(&b, struct {
+		D          *digest.Digest
+		Severities []string
+		Link       string
+		Lang       string
+		Brand      Branding
+	}{d, trivy.Severities, link, l.Lang(), CurrentBranding()})
+	return b.String(), err
+}
+
+// DigestPDF renders the plain-text digest as a PDF, with its fixed strings
+// in l and the current branding.
+func DigestPDF(d *digest.Digest, l *i18n.Locale) []byte {
+	return textPDF(DigestText(d, l), CurrentBranding())
+}
@@ -0,0 +1,121 @@
+package report
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"time"
+	"weeklysec/internal/digest"
+	"weeklysec/internal/store"
+)
+
+// linesPerFlush is how many lines a LineWriter writes between flushes.
+const linesPerFlush = 100
+
+// FindingLine is one finding of the JSON Lines export, flattened so a SIEM
+// can index every field without unnesting anything.
+type FindingLine struct {
+	FindingID       string     `json:"finding_id"`
+	Org             string     `json:"org"`
+	Project         string     `json:"project"`
+	TargetID        string     `json:"target_id,omitempty"`
+	Target          string     `json:"target"`
+	Team            string     `json:"team"`
+	VulnerabilityID string     `json:"vulnerability_id"`
+	PkgName         string     `json:"pkg_name"`
+	Severity        string     `json:"severity"`
+	Priority        int        `json:"priority,omitempty"` // given by the latest scan of the target, if it ranked the finding
+	State           string     `json:"state"`
+	FixedVersion    string     `json:"fixed_version,omitempty"`
+	Fixable         bool       `json:"fixable"`
+	Title           string     `json:"title,omitempty"`
+	FirstSeen       time.Time  `json:"first_seen"`
+	LastSeen        time.Time  `json:"last_seen"`
+	FixedAt         *time.Time `json:"fixed_at,omitempty"`
+	SLADueAt        *time.Time `json:"sla_due_at,omitempty"` // open findings of a severity with an SLA
+	SLABreached     bool       `json:"sla_breached"`
+	AgeDays         float64    `json:"age_days"`
+	Reopened        int        `json:"reopened"`
+	ScanID          string     `json:"scan_id"` // the last scan that found it
+	ExportedAt      time.Time  `json:"exported_at"`
+}
+
+// LineContext is what the JSON Lines export needs besides the findings.
+type LineContext struct {
+	GeneratedAt time.Time
+	Scans       []*store.Scan     // latest of each target, for the priorities it gave
+	Teams       map[string]string // owning team by target ID
+	SLA         digest.SLA
+}
+
+// LineWriter writes findings to out as JSON Lines, a FindingLine each, as
+// they are handed to it, so an export never holds more than one finding.
+// It flushes out every so often when out can, so a large export reaches the
+// reader as it is written.
+type LineWriter struct {
+	c          LineContext
+	enc        *json.Encoder
+	flusher    http.Flusher
+	priorities map[string]int
+	n          int
+}
+
+// NewLineWriter returns a LineWriter writing to out.
+func NewLineWriter(out io.Writer, c LineContext) *LineWriter {
+	priorities := map[string]int{}
+	for _, s := range c.Scans {
+		if s.Response == nil {
+			continue
+		}
+		for _, p := range s.Response.Prioritized {
+			priorities[s.ID+"|"+p.VulnerabilityID+"|"+p.PkgName] = p.Priority
+		}
+	}
+	flusher, _ := out.(http.Flusher)
+	return &LineWriter{c: c, enc: json.NewEncoder(out), flusher: flusher, priorities: priorities}
+}
+
+// Write writes the line of f.
+func (lw *LineWriter) Write(f store.Finding) error {
+	line := FindingLine{
+		FindingID:       f.ID,
+		Org:             f.Org,
+		Project:         f.Project,
+		TargetID:        f.TargetID,
+		Target:          f.Target,
+		Team:            team(lw.c.Teams, f),
+		VulnerabilityID: f.VulnerabilityID,
+		PkgName:         f.PkgName,
+		Severity:        f.Severity,
+		Priority:        lw.priorities[f.LastScanID+"|"+f.VulnerabilityID+"|"+f.PkgName],
+		State:           f.State,
+		FixedVersion:    f.FixedVersion,
+		Fixable:         f.FixedVersion != "",
+		Title:           f.Title,
+		FirstSeen:       f.FirstSeen,
+		LastSeen:        f.LastSeen,
+		FixedAt:         f.FixedAt,
+		AgeDays:         age(f, lw.c.GeneratedAt),
+		Reopened:        f.Reopened,
+		ScanID:          f.LastScanID,
+		ExportedAt:      lw.c.GeneratedAt,
+	}
+	if limit, ok := lw.c.SLA[f.Severity]; ok && f.Open() {
+		due := f.FirstSeen.Add(limit)
+		line.SLADueAt, line.SLABreached = &due, lw.c.GeneratedAt.After(due)
+	}
+	if err := lw.enc.Encode(line); err != nil {
+		return err
+	}
+	if lw.n++; lw.n%linesPerFlush == 0 {
+		lw.Flush()
+	}
+	return nil
+}
+
+// Flush sends what was written so far to the reader when out can.
+func (lw *LineWriter) Flush() {
+	if lw.flusher != nil {
+		lw.flusher.Flush()
+	}
+}
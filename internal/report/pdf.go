@@ -0,0 +1,156 @@
+package report
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// Page layout of textPDF, in points on A4 paper.
+const (
+	pdfWidth        = 595
+	pdfHeight       = 842
+	pdfMargin       = 50
+	pdfFontSize     = 10
+	pdfLeading      = 14
+	pdfLineChars    = 95 // wrap width at pdfFontSize in Helvetica
+	pdfFontObject   = 3
+	pdfBoldObject   = 4
+	pdfHeaderHeight = 40 // below the top margin, for the logo and organization name
+	pdfLogoHeight   = 28
+	pdfLogoMaxWidth = 160
+)
+
+// textPDF lays text out in Helvetica, wrapping long lines and starting new
+// pages as needed, under the logo and organization name of brand, between
+// its classification banners and above its footer. Characters outside
+// Latin-1 are replaced with '?'.
+func textPDF(text string, brand Branding) []byte {
+	header := 0
+	if brand.logo != nil || brand.OrgName != "" {
+		header = pdfHeaderHeight
+	}
+	pageLines := (pdfHeight - 2*pdfMargin - header) / pdfLeading
+
+	var lines []string
+	for _, line := range strings.Split(strings.TrimRight(text, "\n"), "\n") {
+		for len(line) > pdfLineChars {
+			cut := strings.LastIndex(line[:pdfLineChars], " ")
+			if cut <= 0 {
+				cut = pdfLineChars
+			}
+			lines = append(lines, line[:cut])
+			line = "  " + strings.TrimLeft(line[cut:], " ")
+		}
+		lines = append(lines, line)
+	}
+	var pages [][]string
+	for len(lines) > pageLines {
+		pages = append(pages, lines[:pageLines])
+		lines = lines[pageLines:]
+	}
+	pages = append(pages, lines)
+
+	// Objects: 1 catalog, 2 page tree, 3 font, 4 bold font, 5 the logo if
+	// there is one, then a page and its content stream for every page.
+	first := 5
+	resources := fmt.Sprintf("/Font << /F1 %d 0 R /F2 %d 0 R >>", pdfFontObject, pdfBoldObject)
+	if brand.logo != nil {
+		resources += " /XObject << /Im1 5 0 R >>"
+		first = 6
+	}
+	var objects []string
+	kids := make([]string, len(pages))
+	for i := range pages {
+		kids[i] = fmt.Sprintf("%d 0 R", first+2*i)
+	}
+	objects = append(objects,
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(pages)),
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>",
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>",
+	)
+	if img := brand.logo; img != nil {
+		objects = append(objects, fmt.Sprintf(
+			"<< /Type /XObject /Subtype /Image /Width %d /Height %d /ColorSpace /DeviceRGB /BitsPerComponent 8 /Filter /FlateDecode /Length %d >>\nstream\n%s\nendstream",
+			img.width, img.height, len(img.data), img.data))
+	}
+	decoration := pdfBranding(brand)
+	for i, page := range pages {
+		var s strings.Builder
+		s.WriteString(decoration)
+		fmt.Fprintf(&s, "BT /F1 %d Tf %d TL %d %d Td\n", pdfFontSize, pdfLeading, pdfMargin, pdfHeight-pdfMargin-header)
+		for _, line := range page {
+			fmt.Fprintf(&s, "(%s) '\n", pdfString(line))
+		}
+		s.WriteString("ET")
+		objects = append(objects,
+			fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %d %d] /Resources << %s >> /Contents %d 0 R >>",
+				pdfWidth, pdfHeight, resources, first+1+2*i),
+			fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", s.Len(), s.String()),
+		)
+	}
+
+	var b bytes.Buffer
+	b.WriteString("%PDF-1.4\n")
+	offsets := make([]int, len(objects))
+	for i, obj := range objects {
+		offsets[i] = b.Len()
+		fmt.Fprintf(&b, "%d 0 obj\n%s\nendobj\n", i+1, obj)
+	}
+	xref := b.Len()
+	fmt.Fprintf(&b, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&b, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&b, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+	return b.Bytes()
+}
+
+// pdfBranding draws what b puts on every page: the logo and organization
+// name in the header, the classification centered in the top and bottom
+// margins and the footer above the bottom banner.
+func pdfBranding(b Branding) string {
+	var s strings.Builder
+	x := pdfMargin
+	if img := b.logo; img != nil {
+		w := min(pdfLogoHeight*img.width/max(img.height, 1), pdfLogoMaxWidth)
+		h := w * img.height / max(img.width, 1)
+		fmt.Fprintf(&s, "q %d 0 0 %d %d %d cm /Im1 Do Q\n", w, h, x, pdfHeight-pdfMargin-pdfLogoHeight)
+		x += w + 10
+	}
+	if b.OrgName != "" {
+		fmt.Fprintf(&s, "BT /F2 14 Tf %d %d Td (%s) Tj ET\n", x, pdfHeight-pdfMargin-pdfLogoHeight+8, pdfString(b.OrgName))
+	}
+	if c := b.Classification; c != "" {
+		// Helvetica-Bold capitals are about 0.7 em wide.
+		cx := max((pdfWidth-len(c)*9*7/10)/2, pdfMargin)
+		fmt.Fprintf(&s, "0.8 0 0 rg BT /F2 9 Tf %d %d Td (%s) Tj ET BT /F2 9 Tf %d %d Td (%s) Tj ET 0 g\n",
+			cx, pdfHeight-pdfMargin/2, pdfString(c), cx, pdfMargin/2-6, pdfString(c))
+	}
+	if b.Footer != "" {
+		fmt.Fprintf(&s, "0.4 g BT /F1 8 Tf %d %d Td (%s) Tj ET 0 g\n", pdfMargin, pdfMargin/2+8, pdfString(b.Footer))
+	}
+	return s.String()
+}
+
+// pdfString escapes s for a PDF literal string in WinAnsi encoding.
+func pdfString(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r == '—' || r == '–':
+			b.WriteByte('-')
+		case r >= 0x20 && r < 0x7f:
+			b.WriteRune(r)
+		case r >= 0xa0 && r <= 0xff:
+			fmt.Fprintf(&b, "\\%03o", r)
+		default:
+			b.WriteByte('?')
+		}
+	}
+	return b.String()
+}
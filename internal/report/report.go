@@ -0,0 +1,412 @@
+package report
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"weeklysec/internal/agent"
+	"weeklysec/internal/cosign"
+	"weeklysec/internal/hardening"
+	"weeklysec/internal/i18n"
+	"weeklysec/internal/trivy"
+)
+
+// Text renders a plain-text report suited to terminals, with its fixed
+// strings in l. It follows the same conventions as the LLM summary: no
+// Markdown, dashes and colons only.
+func Text(resp *agent.AgentResponse, l *i18n.Locale) string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "%s: %s (%s)\n", l.T("Target"), resp.Target, resp.TargetType)
+	fmt.Fprintf(&b, "%s: %s\n", l.T("Status"), resp.Status)
+	if resp.Error != "" {
+		fmt.Fprintf(&b, "%s: %s\n", l.T("Error"), resp.Error)
+	}
+	if sig := resp.Signature; sig != nil {
+		fmt.Fprintf(&b, "%s: %s\n", l.T("Signature"), signatureNote(sig, l))
+	}
+	if len(resp.Images) > 0 {
+		fmt.Fprintf(&b, "%s:\n", l.T("Images"))
+		for _, img := range resp.Images {
+			fmt.Fprintf(&b, "- %s: %s\n", img.Image, imageNote(img, l))
+		}
+	}
+
+	if a := resp.Analysis; a != nil {
+		fmt.Fprintf(&b, "\n%s: %.1f / 100\n", l.T("Risk Score"), a.RiskScore)
+		fmt.Fprintf(&b, "%s: %s\n", l.T("Vulnerabilities"), l.T("%d (%d fixable)", a.TotalVulnerabilities, a.Fixable))
+		for _, sev := range trivy.Severities {
+			fmt.Fprintf(&b, "- %s: %d\n", sev, a.BySeverity[sev])
+		}
+		if a.Misconfigurations > 0 {
+			fmt.Fprintf(&b, "%s: %d\n", l.T("Misconfigurations"), a.Misconfigurations)
+		}
+		if a.Secrets > 0 {
+			fmt.Fprintf(&b, "%s: %d\n", l.T("Secrets"), a.Secrets)
+		}
+	}
+
+	if len(resp.Prioritized) > 0 {
+		fmt.Fprintf(&b, "\n%s:\n", l.T("Prioritized Findings"))
+		for _, f := range resp.Prioritized {
+			fmt.Fprintf(&b, "- P%d %s: %s %s", f.Priority, f.VulnerabilityID, f.PkgName, f.InstalledVersion)
+			if f.FixedVersion != "" {
+				fmt.Fprintf(&b, " -> %s", f.FixedVersion)
+			}
+			fmt.Fprintf(&b, " (%s)\n", severityNote(f, l))
+		}
+	}
+
+	if len(resp.Misconfigs) > 0 {
+		fmt.Fprintf(&b, "\n%s:\n", l.T("Misconfigurations"))
+		for _, m := range resp.Misconfigs {
+			fmt.Fprintf(&b, "- P%d %s: %s (%s)\n", m.Priority, m.ID, l.T("%s at %s", m.Check, location(m.File, m.StartLine, m.EndLine)), m.Severity)
+		}
+	}
+
+	if resp.Remediation.Actionable() {
+		fmt.Fprintf(&b, "\n%s:\n", l.T("Fixes"))
+		for _, fix := range resp.Remediation.Fixes {
+			fmt.Fprintf(&b, "- %s%s%s\n", fix.Description, sourceNote(fix), imagesNote(fix, l))
+		}
+		for _, fix := range resp.Remediation.ConfigFixes {
+			fmt.Fprintf(&b, "- %s\n", fix.Description)
+		}
+	}
+
+	if rem := resp.Remediation; rem != nil && len(rem.Runbooks) > 0 {
+		fmt.Fprintf(&b, "\n%s:\n", l.T("Secret Rotation"))
+		for _, rb := range rem.Runbooks {
+			fmt.Fprintf(&b, "- %s %s\n", rb.Severity, l.T("%s in %s", rb.Credential, references(rb.References)))
+			for _, step := range slices.Concat(rb.Rotate, rb.Cleanup, rb.Verify) {
+				fmt.Fprintf(&b, "  - %s\n", step)
+			}
+		}
+	}
+
+	if rem := resp.Remediation; rem != nil && len(rem.Hardening) > 0 {
+		fmt.Fprintf(&b, "\n%s:\n", l.T("Hardening"))
+		for _, rec := range rem.Hardening {
+			fmt.Fprintf(&b, "- %s %s: %s\n", rec.Severity, hardeningSubject(rec, l), strings.Join(rec.Issues, "; "))
+		}
+	}
+
+	if pr := resp.PullRequest; pr != nil {
+		fmt.Fprintf(&b, "\n%s: %s\n", l.T("Pull Request"), pr.URL)
+		for _, r := range pr.Rejected {
+			fmt.Fprintf(&b, "- %s: %s\n", l.T("Left out %s %s", r.PkgName, r.RecommendedVersion), r.Reason)
+		}
+	}
+
+	if ar := resp.AcceptedRisk; ar != nil {
+		fmt.Fprintf(&b, "\n%s: %s\n", l.T("Accepted Risk"), l.T("%d findings (%d rules expiring soon)", ar.Count, ar.Expiring))
+		for _, f := range ar.Findings {
+			fmt.Fprintf(&b, "- %s: %s (%s)%s\n", f.VulnerabilityID, f.PkgName, f.Justification, expiryNote(f, l))
+		}
+	}
+
+	if ln := resp.LearnedNoise; ln != nil {
+		fmt.Fprintf(&b, "\n%s: %s\n", l.T("Learned Noise"), l.T("%d findings triaged as noise before", ln.Count))
+		for _, f := range ln.Findings {
+			fmt.Fprintf(&b, "- %s: %s (%s, %s)\n", f.VulnerabilityID, f.PkgName, noiseReason(f, l), f.TriagedAt.Format("2006-01-02"))
+		}
+	}
+
+	if len(resp.Overridden) > 0 {
+		fmt.Fprintf(&b, "\n%s: %s\n", l.T("Severity Overrides"), l.T("%d findings", len(resp.Overridden)))
+		for _, f := range resp.Overridden {
+			fmt.Fprintf(&b, "- %s: %s %s -> %s (%s)\n", f.VulnerabilityID, f.PkgName, f.OriginalSeverity, f.Severity, f.Reason)
+		}
+	}
+
+	if resp.Summary != "" {
+		fmt.Fprintf(&b, "\n%s:\n", l.T("Summary"))
+		b.WriteString(strings.TrimSpace(resp.Summary))
+		b.WriteString("\n")
+	}
+
+	return b.String()
+}
+
+// Markdown renders the report as GitHub-flavoured Markdown, with its fixed
+// strings in l.
+func Markdown(resp *agent.AgentResponse, l *i18n.Locale) string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "# %s: `%s`\n\n", l.T("Security report"), resp.Target)
+	fmt.Fprintf(&b, "- **%s:** %s\n", l.T("Target type"), resp.TargetType)
+	fmt.Fprintf(&b, "- **%s:** %s\n", l.T("Status"), resp.Status)
+	if !resp.CompletedAt.IsZero() {
+		fmt.Fprintf(&b, "- **%s:** %s\n", l.T("Completed"), resp.CompletedAt.Format("2006-01-02 15:04 MST"))
+	}
+	if resp.Error != "" {
+		fmt.Fprintf(&b, "- **%s:** %s\n", l.T("Error"), resp.Error)
+	}
+	if sig := resp.Signature; sig != nil {
+		fmt.Fprintf(&b, "- **%s:** %s\n", l.T("Signature"), signatureNote(sig, l))
+	}
+
+	if len(resp.Images) > 0 {
+		fmt.Fprintf(&b, "\n## %s\n\n", l.T("Images"))
+		b.WriteString(header(l, "Image", "Status", "Vulnerabilities", "Error"))
+		for _, img := range resp.Images {
+			fmt.Fprintf(&b, "| `%s` | %s | %d | %s |\n", img.Image, img.Status, img.Vulnerabilities, orDash(img.Error))
+		}
+	}
+
+	if a := resp.Analysis; a != nil {
+		fmt.Fprintf(&b, "\n## %s\n\n**%s:** %.1f / 100 — %s\n\n", l.T("Analysis"), l.T("Risk score"), a.RiskScore,
+			l.T("%d vulnerabilities, %d fixable", a.TotalVulnerabilities, a.Fixable))
+		b.WriteString(header(l, "Severity", "Count"))
+		for _, sev := range trivy.Severities {
+			fmt.Fprintf(&b, "| %s | %d |\n", sev, a.BySeverity[sev])
+		}
+		if a.Misconfigurations > 0 {
+			fmt.Fprintf(&b, "\n%s\n", l.T("%d failed configuration checks.", a.Misconfigurations))
+		}
+		if a.Secrets > 0 {
+			fmt.Fprintf(&b, "\n**%s**\n", l.T("%d leaked secrets.", a.Secrets))
+		}
+	}
+
+	if len(resp.Prioritized) > 0 {
+		fmt.Fprintf(&b, "\n## %s\n\n", l.T("Prioritized findings"))
+		b.WriteString(header(l, "Priority", "ID", "Package", "Installed", "Fixed", "Severity"))
+		for _, f := range resp.Prioritized {
+			fmt.Fprintf(&b, "| P%d | %s | %s | %s | %s | %s |\n",
+				f.Priority, f.VulnerabilityID, f.PkgName, f.InstalledVersion, orDash(f.FixedVersion), severityNote(f, l))
+		}
+	}
+
+	if len(resp.Misconfigs) > 0 {
+		fmt.Fprintf(&b, "\n## %s\n\n", l.T("Misconfigurations"))
+		b.WriteString(header(l, "Priority", "ID", "Check", "Location", "Severity", "Resolution"))
+		for _, m := range resp.Misconfigs {
+			fmt.Fprintf(&b, "| P%d | %s | %s | `%s` | %s | %s |\n",
+				m.Priority, m.ID, m.Check, location(m.File, m.StartLine, m.EndLine), m.Severity, orDash(m.Resolution))
+		}
+	}
+
+	if rem := resp.Remediation; rem.Actionable() {
+		fmt.Fprintf(&b, "\n## %s\n\n", l.T("Remediation"))
+		for _, fix := range rem.Fixes {
+			fmt.Fprintf(&b, "- **P%d** %s%s%s\n", fix.Priority, fix.Description, sourceNote(fix), imagesNote(fix, l))
+		}
+		for _, fix := range rem.ConfigFixes {
+			fmt.Fprintf(&b, "- **P%d** %s\n", fix.Priority, fix.Description)
+		}
+		for _, rb := range rem.Runbooks {
+			fmt.Fprintf(&b, "\n### %s\n\n**%s**, %s\n", l.T("Rotate %s", rb.Credential), rb.Severity, l.T("found in %s", references(rb.References)))
+			for _, part := range []struct {
+				title string
+				steps []string
+			}{{"Rotate", rb.Rotate}, {"Clean up", rb.Cleanup}, {"Verify", rb.Verify}} {
+				fmt.Fprintf(&b, "\n%s:\n\n", l.T(part.title))
+				for i, step := range part.steps {
+					fmt.Fprintf(&b, "%d. %s\n", i+1, step)
+				}
+			}
+		}
+		if len(rem.Hardening) > 0 {
+			fmt.Fprintf(&b, "\n### %s\n", l.T("Hardening"))
+			for _, rec := range rem.Hardening {
+				fmt.Fprintf(&b, "\n**%s** `%s` (`%s`)\n\n", rec.Severity, hardeningSubject(rec, l), location(rec.File, rec.Line, 0))
+				for _, is := range rec.Issues {
+					fmt.Fprintf(&b, "- %s\n", is)
+				}
+				fmt.Fprintf(&b, "\n```yaml\n%s\n```\n", rec.Patch)
+			}
+		}
+		if rem.CommitMessage != "" {
+			fmt.Fprintf(&b, "\n### %s\n\n```\n%s\n```\n", l.T("Commit message"), strings.TrimSpace(rem.CommitMessage))
+		}
+	}
+
+	if pr := resp.PullRequest; pr != nil {
+		fmt.Fprintf(&b, "\n**%s:** [%s#%d](%s)\n", l.T("Pull request"), pr.Repo, pr.Number, pr.URL)
+		if len(pr.Rejected) > 0 {
+			fmt.Fprintf(&b, "\n%s\n\n", l.T("Left out because the edited file would not parse:"))
+			for _, r := range pr.Rejected {
+				fmt.Fprintf(&b, "- %s: %s\n", l.T("%s %s in `%s`", r.PkgName, r.RecommendedVersion, r.Path), r.Reason)
+			}
+		}
+	}
+
+	if ar := resp.AcceptedRisk; ar != nil {
+		fmt.Fprintf(&b, "\n## %s\n\n%s", l.T("Accepted risk"), l.T("%d findings are covered by risk-acceptance rules", ar.Count))
+		if ar.Expiring > 0 {
+			fmt.Fprintf(&b, "; **%s**", l.T("%d rules expire soon", ar.Expiring))
+		}
+		b.WriteString(".\n\n")
+		b.WriteString(header(l, "ID", "Package", "Severity", "Justification", "Approver", "Expires"))
+		for _, f := range ar.Findings {
+			expires := "-"
+			if f.ExpiresAt != nil {
+				expires = f.ExpiresAt.Format("2006-01-02")
+			}
+			fmt.Fprintf(&b, "| %s | %s | %s | %s | %s | %s |\n",
+				f.VulnerabilityID, f.PkgName, f.Severity, f.Justification, f.Approver, expires)
+		}
+	}
+
+	if ln := resp.LearnedNoise; ln != nil {
+		fmt.Fprintf(&b, "\n## %s\n\n%s\n\n", l.T("Learned noise"),
+			l.T("%d findings were left out because the team triaged them as noise in earlier scans. "+
+				"Rate one up through the feedback API to have it flagged again.", ln.Count))
+		b.WriteString(header(l, "ID", "Package", "Severity", "Reason", "Triaged"))
+		for _, f := range ln.Findings {
+			fmt.Fprintf(&b, "| %s | %s | %s | %s | %s |\n", f.VulnerabilityID, f.PkgName, f.Severity, noiseReason(f, l), f.TriagedAt.Format("2006-01-02"))
+		}
+	}
+
+	if len(resp.Overridden) > 0 {
+		fmt.Fprintf(&b, "\n## %s\n\n%s\n\n", l.T("Severity overrides"), l.T("%d findings were re-rated by the tenant's severity rules.", len(resp.Overridden)))
+		b.WriteString(header(l, "ID", "Package", "Trivy severity", "Severity", "Reason"))
+		for _, f := range resp.Overridden {
+			fmt.Fprintf(&b, "| %s | %s | %s | %s | %s |\n", f.VulnerabilityID, f.PkgName, f.OriginalSeverity, f.Severity, f.Reason)
+		}
+	}
+
+	if resp.Summary != "" {
+		fmt.Fprintf(&b, "\n## %s\n\n%s\n", l.T("Summary"), strings.TrimSpace(resp.Summary))
+	}
+
+	if len(resp.Explanations) > 0 {
+		fmt.Fprintf(&b, "\n## %s\n", l.T("Rationale"))
+		for _, e := range resp.Explanations {
+			fmt.Fprintf(&b, "\n### %s\n\n", e.Step)
+			if e.Rationale != "" {
+				fmt.Fprintf(&b, "%s\n\n", strings.TrimSpace(e.Rationale))
+			}
+			for _, item := range e.Items {
+				fmt.Fprintf(&b, "- `%s`: %s\n", item.ID, item.Rationale)
+			}
+			if e.Reasoning != "" {
+				fmt.Fprintf(&b, "\n<details><summary>%s</summary>\n\n%s\n\n</details>\n", l.T("Model reasoning"), strings.TrimSpace(e.Reasoning))
+			}
+		}
+	}
+
+	return b.String()
+}
+
+// header renders the header of a Markdown table with the columns cols,
+// translated.
+func header(l *i18n.Locale, cols ...string) string {
+	var b strings.Builder
+	for _, col := range cols {
+		fmt.Fprintf(&b, "| %s ", l.T(col))
+	}
+	b.WriteString("|\n" + strings.Repeat("|---", len(cols)) + "|\n")
+	return b.String()
+}
+
+// signatureNote describes a signature verification outcome in one line.
+func signatureNote(sig *cosign.Result, l *i18n.Locale) string {
+	note := sig.Status
+	switch {
+	case sig.Signer != "":
+		note += " (" + sig.Signer + ")"
+	case sig.Error != "":
+		note += " (" + sig.Error + ")"
+	}
+	if sig.AttestationType != "" {
+		if sig.Attested {
+			note += ", " + l.T("%s attestation verified", sig.AttestationType)
+		} else {
+			note += ", " + l.T("no verified %s attestation", sig.AttestationType)
+		}
+	}
+	return note
+}
+
+// severityNote is f's severity, with the one Trivy reported when a
+// severity override changed it.
+func severityNote(f agent.PrioritizedFinding, l *i18n.Locale) string {
+	if f.OriginalSeverity == "" {
+		return f.Severity
+	}
+	return f.Severity + ", " + l.T("overridden from %s", f.OriginalSeverity)
+}
+
+// sourceNote points at the source line of fix, if it has one.
+func sourceNote(fix agent.Fix) string {
+	if fix.Source == nil {
+		return ""
+	}
+	return fmt.Sprintf(" (%s:%d)", fix.Source.File, fix.Source.Line)
+}
+
+// imageNote is the number of vulnerabilities of one image of an
+// application, or why its scan failed.
+func imageNote(img agent.ImageResult, l *i18n.Locale) string {
+	if img.Status == agent.StatusFailed {
+		return img.Status + ": " + img.Error
+	}
+	return l.T("%d vulnerabilities", img.Vulnerabilities)
+}
+
+// imagesNote names the images of an application fix applies to, if any.
+func imagesNote(fix agent.Fix, l *i18n.Locale) string {
+	if len(fix.Images) == 0 {
+		return ""
+	}
+	return " (" + l.T("found in %s", strings.Join(fix.Images, ", ")) + ")"
+}
+
+// references lists where a leaked secret was found.
+func references(refs []agent.SecretReference) string {
+	out := make([]string, len(refs))
+	for i, ref := range refs {
+		out[i] = "`" + location(ref.File, ref.Line, 0) + "`"
+	}
+	return strings.Join(out, ", ")
+}
+
+// hardeningSubject names the resource, and container, rec applies to.
+func hardeningSubject(rec hardening.Recommendation, l *i18n.Locale) string {
+	if rec.Container == "" {
+		return rec.Resource
+	}
+	return l.T("%s container %s", rec.Resource, rec.Container)
+}
+
+// location is a file with the lines something was found at, if known.
+func location(file string, start, end int) string {
+	switch {
+	case start == 0:
+		return file
+	case end > start:
+		return fmt.Sprintf("%s:%d-%d", file, start, end)
+	}
+	return fmt.Sprintf("%s:%d", file, start)
+}
+
+// noiseReason says why a finding was triaged as noise.
+func noiseReason(f agent.NoiseFinding, l *i18n.Locale) string {
+	if f.Reason != "" {
+		return f.Reason
+	}
+	if f.Source == agent.TriageSuppression {
+		return l.T("not affected")
+	}
+	return l.T("rated as noise")
+}
+
+func expiryNote(f agent.AcceptedFinding, l *i18n.Locale) string {
+	switch {
+	case f.ExpiresAt == nil:
+		return ""
+	case f.ExpiringSoon:
+		return ", " + l.T("expires %s - review soon", f.ExpiresAt.Format("2006-01-02"))
+	default:
+		return ", " + l.T("expires %s", f.ExpiresAt.Format("2006-01-02"))
+	}
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
@@ -0,0 +1,234 @@
+package report
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+	"weeklysec/internal/agent"
+	"weeklysec/internal/digest"
+	"weeklysec/internal/i18n"
+	"weeklysec/internal/trivy"
+)
+
+// What a custom template reports on, by the subdirectory of the template
+// directory it is in.
+const (
+	TemplateScan   = "scan"   // one scan, TemplateData.Scan
+	TemplateDigest = "digest" // the digest of a period, TemplateData.Digest
+)
+
+// TemplateKinds lists the subdirectories templates are read from.
+var TemplateKinds = []string{TemplateScan, TemplateDigest}
+
+// Formats of custom templates, by file extension. HTML templates escape
+// what they print as html/template does; the others print it as is.
+var templateFormats = map[string]string{
+	".html": "html",
+	".md":   "markdown",
+	".txt":  "text",
+}
+
+var templateContentTypes = map[string]string{
+	"html":     "text/html; charset=utf-8",
+	"markdown": "text/markdown; charset=utf-8",
+	"text":     "text/plain; charset=utf-8",
+}
+
+// TemplateData is the dot of a custom template. Scan is the
+// agent.AgentResponse of the scan reported on and Digest the digest.Digest
+// of the period reported on; only the one of the template's kind is set.
+// Fields go by their Go names, such as .Scan.Analysis.RiskScore or
+// .Digest.TopIssues, and pointer fields such as .Scan.Remediation are nil
+// when the scan has none, so guard them with "with".
+//
+// Besides the built-in functions of text/template, templates have:
+//
+//	t      translates a fixed string into the report's language, formatting
+//	       any further arguments into it: {{t "%d targets" 3}}
+//	date   formats a time as 2006-01-02
+//	join   joins strings with a separator: {{join .Resolves ", "}}
+//	lower, upper
+//	json   prints a value as indented JSON
+//	yesNo  prints a bool as a translated yes or no
+//	trend  and mttr describe a digest.Team as the built-in digest does
+//	action describes a digest.Leverage as the built-in digest does
+type TemplateData struct {
+	Scan        *agent.AgentResponse
+	Digest      *digest.Digest
+	Severities  []string // CRITICAL to UNKNOWN, to range over BySeverity maps in order
+	Lang        string   // tag of the report's language
+	GeneratedAt time.Time
+	Branding    Branding // REPORT_ORG_NAME, REPORT_LOGO and the like
+}
+
+// Template is a report layout supplied by the operator.
+type Template struct {
+	Name   string `json:"name"`
+	Kind   string `json:"kind"`   // scan or digest
+	Format string `json:"format"` // html, markdown or text
+
+	html *htmltemplate.Template
+	text *template.Template
+}
+
+// ContentType is the media type of what t renders.
+func (t *Template) ContentType() string {
+	return templateContentTypes[t.Format]
+}
+
+// Render executes t over data with its fixed strings in l and the current
+// branding. A template that fails part way renders nothing.
+func (t *Template) Render(data TemplateData, l *i18n.Locale) ([]byte, error) {
+	data.Severities = trivy.Severities
+	data.Lang = l.Lang()
+	data.Branding = CurrentBranding()
+	var b bytes.Buffer
+	if t.html != nil {
+		tmpl, err := t.html.Clone()
+		if err != nil {
+			return nil, err
+		}
+		err = tmpl.Funcs(templateFuncs(l)).Execute(&b, data)
+		return b.Bytes(), err
+	}
+	tmpl, err := t.text.Clone()
+	if err != nil {
+		return nil, err
+	}
+	err = tmpl.Funcs(templateFuncs(l)).Execute(&b, data)
+	return b.Bytes(), err
+}
+
+// templateFuncs are the functions of custom templates, translating into l.
+func templateFuncs(l *i18n.Locale) template.FuncMap {
+	funcs := template.FuncMap{
+		"date":  func(t time.Time) string { return t.Format("2006-01-02") },
+		"join":  strings.Join,
+		"lower": strings.ToLower,
+		"upper": strings.ToUpper,
+		"json": func(v any) (string, error) {
+			b, err := json.MarshalIndent(v, "", "  ")
+			return string(b), err
+		},
+	}
+	for name, fn := range localeFuncs(l) {
+		funcs[name] = fn
+	}
+	return funcs
+}
+
+// Templates is a set of custom templates by kind and name. The zero value,
+// and a nil Templates, is empty.
+type Templates struct {
+	byKind map[string]map[string]*Template
+}
+
+// LoadTemplates parses the templates of dir: scan/<name>.<ext> and
+// digest/<name>.<ext>, where ext is html, md or txt. A name is selected
+// without its extension, so it may only be used once per kind.
+func LoadTemplates(dir string) (*Templates, error) {
+	if _, err := os.ReadDir(dir); err != nil {
+		return nil, err
+	}
+	s := &Templates{byKind: map[string]map[string]*Template{}}
+	for _, kind := range TemplateKinds {
+		entries, err := os.ReadDir(filepath.Join(dir, kind))
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		s.byKind[kind] = map[string]*Template{}
+		for _, e := range entries {
+			ext := filepath.Ext(e.Name())
+			format, ok := templateFormats[ext]
+			if e.IsDir() || !ok {
+				continue
+			}
+			file := filepath.Join(kind, e.Name())
+			name := strings.TrimSuffix(e.Name(), ext)
+			if prev, ok := s.byKind[kind][name]; ok {
+				return nil, fmt.Errorf("%s: template %q is also defined as %s", file, name, prev.Format)
+			}
+			src, err := os.ReadFile(filepath.Join(dir, file))
+			if err != nil {
+				return nil, err
+			}
+			t := &Template{Name: name, Kind: kind, Format: format}
+			if format == "html" {
+				t.html, err = htmltemplate.New(name).Funcs(templateFuncs(nil)).Parse(string(src))
+			} else {
+				t.text, err = template.New(name).Funcs(templateFuncs(nil)).Parse(string(src))
+			}
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", file, err)
+			}
+			s.byKind[kind][name] = t
+		}
+	}
+	return s, nil
+}
+
+// Lookup returns the template of kind called name.
+func (s *Templates) Lookup(kind, name string) (*Template, bool) {
+	if s == nil {
+		return nil, false
+	}
+	t, ok := s.byKind[kind][name]
+	return t, ok
+}
+
+// Names lists the names of the templates of kind.
+func (s *Templates) Names(kind string) []string {
+	if s == nil {
+		return nil
+	}
+	names := make([]string, 0, len(s.byKind[kind]))
+	for name := range s.byKind[kind] {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// List returns every template, by kind and then name.
+func (s *Templates) List() []*Template {
+	var out []*Template
+	for _, kind := range TemplateKinds {
+		for _, name := range s.Names(kind) {
+			t, _ := s.Lookup(kind, name)
+			out = append(out, t)
+		}
+	}
+	return out
+}
+
+var (
+	templatesMu sync.RWMutex
+	templates   = &Templates{}
+)
+
+// SetTemplates replaces the custom templates used from now on.
+func SetTemplates(s *Templates) {
+	templatesMu.Lock()
+	defer templatesMu.Unlock()
+	templates = s
+}
+
+// CustomTemplates returns the custom templates in use.
+func CustomTemplates() *Templates {
+	templatesMu.RLock()
+	defer templatesMu.RUnlock()
+	return templates
+}
@@ -0,0 +1,245 @@
+package report
+
+import (
+	"cmp"
+	"math"
+	"slices"
+	"strings"
+	"time"
+	"weeklysec/internal/digest"
+	"weeklysec/internal/i18n"
+	"weeklysec/internal/store"
+	"weeklysec/internal/trivy"
+)
+
+// SLA statuses of open findings in the workbook.
+const (
+	slaWithin   = "within SLA"
+	slaBreached = "breached"
+)
+
+// Workbook is what FindingsXLSX lays out: the tracked findings of a scope,
+// the fixes recommended by the latest scan of each target, and the SLAs
+// open findings are held to.
+type Workbook struct {
+	Scope       string
+	GeneratedAt time.Time
+	Findings    []store.Finding
+	Scans       []*store.Scan     // latest of each target, for its fixes
+	Teams       map[string]string // owning team by target ID
+	SLA         digest.SLA
+}
+
+// FindingsXLSX renders w as an Excel workbook with a summary, findings,
+// fixes and SLA status sheet, with its fixed strings in l. Every sheet but
+// the summary is one flat table, ready for filters and pivot tables.
+func FindingsXLSX(w *Workbook, l *i18n.Locale) ([]byte, error) {
+	return XLSX(l.T("Security findings: %s", w.Scope), w.GeneratedAt, []Sheet{
+		w.summarySheet(l),
+		w.findingsSheet(l),
+		w.fixesSheet(l),
+		w.slaSheet(l),
+	})
+}
+
+func (w *Workbook) team(f store.Finding) string {
+	return team(w.Teams, f)
+}
+
+func team(teams map[string]string, f store.Finding) string {
+	return cmp.Or(teams[f.TargetID], digest.Unassigned)
+}
+
+func (w *Workbook) age(f store.Finding) float64 {
+	return age(f, w.GeneratedAt)
+}
+
+// age is how long f has been, or was, open at now in days.
+func age(f store.Finding, now time.Time) float64 {
+	end := now
+	if f.FixedAt != nil && !f.Open() {
+		end = *f.FixedAt
+	}
+	return days(end.Sub(f.FirstSeen))
+}
+
+func (w *Workbook) summarySheet(l *i18n.Locale) Sheet {
+	type counts struct {
+		open, fixed, breached, tracked int
+		fixTimes                       []time.Duration
+	}
+	bySeverity := map[string]*counts{}
+	total := &counts{}
+	for _, sev := range trivy.Severities {
+		bySeverity[sev] = &counts{}
+	}
+	for _, f := range w.Findings {
+		c, ok := bySeverity[f.Severity]
+		if !ok {
+			c = bySeverity[trivy.Severities[len(trivy.Severities)-1]]
+		}
+		for _, c := range []*counts{c, total} {
+			c.fixTimes = append(c.fixTimes, f.FixDurations()...)
+			if !f.Open() {
+				c.fixed++
+				continue
+			}
+			c.open++
+			if limit, ok := w.SLA[f.Severity]; ok {
+				c.tracked++
+				if w.GeneratedAt.Sub(f.FirstSeen) > limit {
+					c.breached++
+				}
+			}
+		}
+	}
+
+	row := func(label string, c *counts, sla any) []any {
+		within := any(nil)
+		if c.tracked > 0 {
+			within = round1(100 * float64(c.tracked-c.breached) / float64(c.tracked))
+		}
+		mttr := any(nil)
+		if len(c.fixTimes) > 0 {
+			var sum time.Duration
+			for _, d := range c.fixTimes {
+				sum += d
+			}
+			mttr = days(sum / time.Duration(len(c.fixTimes)))
+		}
+		return []any{label, c.open, c.fixed, c.breached, within, sla, mttr}
+	}
+	var rows [][]any
+	for _, sev := range trivy.Severities {
+		sla := any(nil)
+		if limit, ok := w.SLA[sev]; ok {
+			sla = days(limit)
+		}
+		rows = append(rows, row(sev, bySeverity[sev], sla))
+	}
+	rows = append(rows, row(l.T("Total"), total, nil))
+
+	return Sheet{
+		Name: l.T("Summary"),
+		Caption: []string{
+			l.T("Security findings: %s", w.Scope),
+			l.T("Generated %s", w.GeneratedAt.UTC().Format("2006-01-02 15:04 MST")),
+			l.T("%d findings in %d targets, %d fixes recommended", len(w.Findings), w.targets(), w.fixCount()),
+		},
+		Header: translate(l, "Severity", "Open", "Fixed", "SLA breaches", "Within SLA (%)", "SLA (days)", "MTTR (days)"),
+		Rows:   rows,
+	}
+}
+
+func (w *Workbook) findingsSheet(l *i18n.Locale) Sheet {
+	rows := make([][]any, 0, len(w.Findings))
+	for _, f := range w.Findings {
+		fixedAt := time.Time{}
+		if f.FixedAt != nil {
+			fixedAt = *f.FixedAt
+		}
+		rows = append(rows, []any{
+			f.Org, f.Project, f.Target, w.team(f), f.VulnerabilityID, f.PkgName, f.Severity, f.State,
+			f.FixedVersion, f.FixedVersion != "", f.FirstSeen, f.LastSeen, fixedAt, w.age(f), f.Reopened, f.Title, f.ID,
+		})
+	}
+	return Sheet{
+		Name: l.T("Findings"),
+		Header: translate(l, "Org", "Project", "Target", "Team", "ID", "Package", "Severity", "State",
+			"Fixed version", "Fixable", "First seen", "Last seen", "Fixed at", "Age (days)", "Reopened", "Title", "Finding"),
+		Rows: rows,
+	}
+}
+
+func (w *Workbook) fixesSheet(l *i18n.Locale) Sheet {
+	var rows [][]any
+	for _, s := range w.Scans {
+		if s.Response == nil || s.Response.Remediation == nil {
+			continue
+		}
+		team := cmp.Or(w.Teams[s.TargetID], digest.Unassigned)
+		for _, fix := range s.Response.Remediation.Fixes {
+			rows = append(rows, []any{
+				s.Org, s.Project, s.Target, team, fix.Priority, fix.PkgName, fix.CurrentVersion, fix.RecommendedVersion,
+				len(fix.Resolves), strings.Join(fix.Resolves, ", "), fix.Description, s.ID, s.CreatedAt,
+			})
+		}
+	}
+	return Sheet{
+		Name: l.T("Fixes"),
+		Header: translate(l, "Org", "Project", "Target", "Team", "Priority", "Package", "Installed", "Recommended",
+			"Resolves", "Vulnerabilities", "Description", "Scan", "Scanned"),
+		Rows: rows,
+	}
+}
+
+// slaSheet lists the open findings with an SLA, most overdue first.
+func (w *Workbook) slaSheet(l *i18n.Locale) Sheet {
+	type entry struct {
+		f         store.Finding
+		due       time.Time
+		remaining float64
+	}
+	var entries []entry
+	for _, f := range w.Findings {
+		limit, ok := w.SLA[f.Severity]
+		if !ok || !f.Open() {
+			continue
+		}
+		due := f.FirstSeen.Add(limit)
+		entries = append(entries, entry{f, due, days(due.Sub(w.GeneratedAt))})
+	}
+	slices.SortStableFunc(entries, func(a, b entry) int { return a.due.Compare(b.due) })
+
+	rows := make([][]any, 0, len(entries))
+	for _, e := range entries {
+		status := slaWithin
+		if e.remaining < 0 {
+			status = slaBreached
+		}
+		rows = append(rows, []any{
+			e.f.Org, e.f.Project, e.f.Target, w.team(e.f), e.f.VulnerabilityID, e.f.PkgName, e.f.Severity, e.f.State,
+			e.f.FirstSeen, days(w.SLA[e.f.Severity]), e.due, e.remaining, l.T(status),
+		})
+	}
+	return Sheet{
+		Name: l.T("SLA status"),
+		Header: translate(l, "Org", "Project", "Target", "Team", "ID", "Package", "Severity", "State",
+			"First seen", "SLA (days)", "Due", "Days left", "Status"),
+		Rows: rows,
+	}
+}
+
+func (w *Workbook) targets() int {
+	seen := map[string]bool{}
+	for _, f := range w.Findings {
+		seen[f.TargetKey] = true
+	}
+	return len(seen)
+}
+
+func (w *Workbook) fixCount() int {
+	n := 0
+	for _, s := range w.Scans {
+		if s.Response != nil && s.Response.Remediation != nil {
+			n += len(s.Response.Remediation.Fixes)
+		}
+	}
+	return n
+}
+
+func translate(l *i18n.Locale, msgs ...string) []string {
+	out := make([]string, len(msgs))
+	for i, msg := range msgs {
+		out[i] = l.T(msg)
+	}
+	return out
+}
+
+func days(d time.Duration) float64 {
+	return round1(d.Hours() / 24)
+}
+
+func round1(v float64) float64 {
+	return math.Round(v*10) / 10
+}
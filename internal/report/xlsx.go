@@ -0,0 +1,311 @@
+package report
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Sheet is one worksheet of a workbook: caption lines, then a table of a
+// header row and rows of cells. A cell is a string, an int, a float64, a
+// bool, a time.Time or nil for an empty cell. The table gets a filter and
+// a frozen header so it can go straight into a pivot table.
+type Sheet struct {
+	Name    string
+	Caption []string
+	Header  []string
+	Rows    [][]any
+}
+
+// Spreadsheet limits.
+const (
+	xlsxMaxCellChars = 32767
+	xlsxMaxNameChars = 31
+)
+
+// Cell styles, indexes into cellXfs of xlsxStyles.
+const (
+	styleDefault = iota
+	styleHeader
+	styleDate
+	styleNumber
+)
+
+const xlsxStyles = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">
+<numFmts count="1"><numFmt numFmtId="164" formatCode="yyyy-mm-dd hh:mm"/></numFmts>
+<fonts count="2"><font><sz val="11"/><name val="Calibri"/></font><font><b/><sz val="11"/><name val="Calibri"/></font></fonts>
+<fills count="2"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill></fills>
+<borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders>
+<cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs>
+<cellXfs count="4">
+<xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/>
+<xf numFmtId="0" fontId="1" fillId="0" borderId="0" xfId="0" applyFont="1"/>
+<xf numFmtId="164" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>
+<xf numFmtId="2" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>
+</cellXfs>
+</styleSheet>`
+
+// XLSX writes sheets as an Office Open XML workbook titled title.
+func XLSX(title string, created time.Time, sheets []Sheet) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	write := func(name, content string) error {
+		w, err := zw.Create(name)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write([]byte(content))
+		return err
+	}
+
+	var types, rels, entries, names strings.Builder
+	seen := map[string]bool{}
+	for i, sh := range sheets {
+		name := sheetName(sh.Name, seen)
+		n := i + 1
+		fmt.Fprintf(&types, `<Override PartName="/xl/worksheets/sheet%d.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>`, n)
+		fmt.Fprintf(&rels, `<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet%d.xml"/>`, n, n)
+		fmt.Fprintf(&entries, `<sheet name="%s" sheetId="%d" r:id="rId%d"/>`, escapeXML(name), n, n)
+		if ref := sh.tableRef(); ref != "" {
+			fmt.Fprintf(&names, `<definedName name="_xlnm._FilterDatabase" localSheetId="%d" hidden="1">'%s'!%s</definedName>`,
+				i, escapeXML(strings.ReplaceAll(name, "'", "''")), absoluteRef(ref))
+		}
+		if err := write(fmt.Sprintf("xl/worksheets/sheet%d.xml", n), sh.xml()); err != nil {
+			return nil, err
+		}
+	}
+	definedNames := ""
+	if names.Len() > 0 {
+		definedNames = "<definedNames>" + names.String() + "</definedNames>"
+	}
+
+	parts := []struct{ name, content string }{
+		{"[Content_Types].xml", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">
+<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>
+<Default Extension="xml" ContentType="application/xml"/>
+<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>
+<Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/>
+<Override PartName="/docProps/core.xml" ContentType="application/vnd.openxmlformats-package.core-properties+xml"/>
+` + types.String() + `
+</Types>`},
+		{"_rels/.rels", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>
+<Relationship Id="rId2" Type="http://schemas.openxmlformats.org/package/2006/relationships/metadata/core-properties" Target="docProps/core.xml"/>
+</Relationships>`},
+		{"docProps/core.xml", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<cp:coreProperties xmlns:cp="http://schemas.openxmlformats.org/package/2006/metadata/core-properties" xmlns:dc="http://purl.org/dc/elements/1.1/" xmlns:dcterms="http://purl.org/dc/terms/" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance">
+<dc:title>` + escapeXML(title) + `</dc:title>
+<dc:creator>weeklysec</dc:creator>
+<dcterms:created xsi:type="dcterms:W3CDTF">` + created.UTC().Format(time.RFC3339) + `</dcterms:created>
+</cp:coreProperties>`},
+		{"xl/workbook.xml", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">
+<sheets>` + entries.String() + `</sheets>` + definedNames + `
+</workbook>`},
+		{"xl/_rels/workbook.xml.rels", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+` + rels.String() + fmt.Sprintf(`<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>`, len(sheets)+1) + `
+</Relationships>`},
+		{"xl/styles.xml", xlsxStyles},
+	}
+	for _, p := range parts {
+		if err := write(p.name, p.content); err != nil {
+			return nil, err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// headerRow is the 1-based row of the table header, below the caption and
+// a blank line.
+func (sh Sheet) headerRow() int {
+	if len(sh.Caption) == 0 {
+		return 1
+	}
+	return len(sh.Caption) + 2
+}
+
+// tableRef is the range of the header and rows, empty without a header.
+func (sh Sheet) tableRef() string {
+	if len(sh.Header) == 0 {
+		return ""
+	}
+	top := sh.headerRow()
+	return fmt.Sprintf("A%d:%s%d", top, column(len(sh.Header)-1), top+len(sh.Rows))
+}
+
+func (sh Sheet) xml() string {
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">`)
+
+	top := sh.headerRow()
+	if len(sh.Header) > 0 {
+		fmt.Fprintf(&b, `<sheetViews><sheetView workbookViewId="0"><pane ySplit="%d" topLeftCell="A%d" activePane="bottomLeft" state="frozen"/></sheetView></sheetViews>`, top, top+1)
+		b.WriteString("<cols>")
+		for i, w := range sh.widths() {
+			fmt.Fprintf(&b, `<col min="%d" max="%d" width="%d" customWidth="1"/>`, i+1, i+1, w)
+		}
+		b.WriteString("</cols>")
+	}
+
+	b.WriteString("<sheetData>")
+	for i, line := range sh.Caption {
+		writeRow(&b, i+1, []any{line}, styleDefault)
+	}
+	if len(sh.Header) > 0 {
+		header := make([]any, len(sh.Header))
+		for i, h := range sh.Header {
+			header[i] = h
+		}
+		writeRow(&b, top, header, styleHeader)
+	}
+	for i, row := range sh.Rows {
+		writeRow(&b, top+1+i, row, styleDefault)
+	}
+	b.WriteString("</sheetData>")
+
+	if ref := sh.tableRef(); ref != "" {
+		fmt.Fprintf(&b, `<autoFilter ref="%s"/>`, ref)
+	}
+	b.WriteString("</worksheet>")
+	return b.String()
+}
+
+// widths sizes each column to its longest value, within reason.
+func (sh Sheet) widths() []int {
+	out := make([]int, len(sh.Header))
+	for i, h := range sh.Header {
+		out[i] = len(h) + 4 // room for the filter button
+	}
+	for _, row := range sh.Rows {
+		for i, v := range row {
+			if i >= len(out) {
+				break
+			}
+			n := 12
+			if s, ok := v.(string); ok {
+				n = len(s) + 2
+			} else if _, ok := v.(time.Time); ok {
+				n = 18
+			}
+			out[i] = max(out[i], min(n, 60))
+		}
+	}
+	return out
+}
+
+func writeRow(b *strings.Builder, r int, cells []any, style int) {
+	fmt.Fprintf(b, `<row r="%d">`, r)
+	for i, v := range cells {
+		ref := column(i) + strconv.Itoa(r)
+		s := ""
+		if style != styleDefault {
+			s = fmt.Sprintf(` s="%d"`, style)
+		}
+		switch v := v.(type) {
+		case nil:
+		case string:
+			if len(v) > xlsxMaxCellChars {
+				v = v[:xlsxMaxCellChars]
+			}
+			fmt.Fprintf(b, `<c r="%s"%s t="inlineStr"><is><t xml:space="preserve">%s</t></is></c>`, ref, s, escapeXML(v))
+		case int:
+			fmt.Fprintf(b, `<c r="%s"%s><v>%d</v></c>`, ref, s, v)
+		case float64:
+			fmt.Fprintf(b, `<c r="%s" s="%d"><v>%s</v></c>`, ref, styleNumber, strconv.FormatFloat(v, 'f', -1, 64))
+		case bool:
+			n := 0
+			if v {
+				n = 1
+			}
+			fmt.Fprintf(b, `<c r="%s"%s t="b"><v>%d</v></c>`, ref, s, n)
+		case time.Time:
+			if v.IsZero() {
+				continue
+			}
+			fmt.Fprintf(b, `<c r="%s" s="%d"><v>%s</v></c>`, ref, styleDate, strconv.FormatFloat(serialDate(v), 'f', 6, 64))
+		default:
+			fmt.Fprintf(b, `<c r="%s"%s t="inlineStr"><is><t>%s</t></is></c>`, ref, s, escapeXML(fmt.Sprint(v)))
+		}
+	}
+	b.WriteString("</row>")
+}
+
+// serialDate is t as a spreadsheet date: days since 1899-12-30, in UTC.
+func serialDate(t time.Time) float64 {
+	return t.UTC().Sub(time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)).Hours() / 24
+}
+
+// column is the letters of the 0-based column i: A, B, ..., Z, AA, ...
+func column(i int) string {
+	s := ""
+	for i++; i > 0; i = (i - 1) / 26 {
+		s = string(rune('A'+(i-1)%26)) + s
+	}
+	return s
+}
+
+// absoluteRef turns A1:B2 into $A$1:$B$2.
+func absoluteRef(ref string) string {
+	var b strings.Builder
+	letters := false
+	for _, r := range ref {
+		switch {
+		case r >= 'A' && r <= 'Z':
+			if !letters {
+				b.WriteByte('$')
+			}
+			letters = true
+		case r >= '0' && r <= '9':
+			if letters {
+				b.WriteByte('$')
+			}
+			letters = false
+		default:
+			letters = false
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// sheetName makes name a valid sheet name, unique among seen.
+func sheetName(name string, seen map[string]bool) string {
+	name = strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`[]:*?/\`, r) {
+			return '-'
+		}
+		return r
+	}, name)
+	if name == "" {
+		name = "Sheet"
+	}
+	if r := []rune(name); len(r) > xlsxMaxNameChars {
+		name = string(r[:xlsxMaxNameChars])
+	}
+	base := name
+	for i := 2; seen[strings.ToLower(name)]; i++ {
+		suffix := fmt.Sprintf(" (%d)", i)
+		r := []rune(base)
+		name = string(r[:min(len(r), xlsxMaxNameChars-len(suffix))]) + suffix
+	}
+	seen[strings.ToLower(name)] = true
+	return name
+}
+
+func escapeXML(s string) string {
+	var b strings.Builder
+	_ = xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
@@ -0,0 +1,152 @@
+// Package retention purges stored data that has outlived its retention
+// period.
+package retention
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+	"weeklysec/internal/requestid"
+	"weeklysec/internal/store"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Policy says how long each kind of data is kept. Zero keeps it forever.
+type Policy struct {
+	RawOutput time.Duration // Trivy JSON, needed only for re-analysis
+	Scans     time.Duration // the scan record with its analysis and summary
+}
+
+// MarshalJSON writes the periods as duration strings, "0s" meaning forever.
+func (p Policy) MarshalJSON() ([]byte, error) {
+	return json.Marshal(map[string]string{
+		"raw_output": p.RawOutput.String(),
+		"scans":      p.Scans.String(),
+	})
+}
+
+// Result describes one purge run.
+type Result struct {
+	StartedAt         time.Time `json:"started_at"`
+	FinishedAt        time.Time `json:"finished_at,omitzero"`
+	Trigger           string    `json:"trigger"` // "schedule" or "admin"
+	ScansChecked      int       `json:"scans_checked"`
+	RawOutputsRemoved int       `json:"raw_outputs_removed"`
+	ScansDeleted      int       `json:"scans_deleted"`
+	Errors            int       `json:"errors"`
+	LastError         string    `json:"last_error,omitempty"`
+}
+
+// Status is what the admin API reports.
+type Status struct {
+	Policy  Policy  `json:"policy"`
+	Running bool    `json:"running"`
+	Last    *Result `json:"last,omitempty"`
+}
+
+// Purger applies a Policy to the store, periodically or on demand. Only one
+// run happens at a time.
+type Purger struct {
+	store  *store.Store
+	policy Policy
+
+	mu      sync.Mutex
+	running bool
+	last    *Result
+}
+
+func New(st *store.Store, policy Policy) *Purger {
+	return &Purger{store: st, policy: policy}
+}
+
+// Run purges every interval until stop is closed.
+func (p *Purger) Run(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		p.Trigger("schedule")
+		select {
+		case <-ticker.C:
+		case <-stop:
+			return
+		}
+	}
+}
+
+// Trigger starts a purge in the background. It returns false if one is
+// already running.
+func (p *Purger) Trigger(trigger string) bool {
+	p.mu.Lock()
+	if p.running {
+		p.mu.Unlock()
+		return false
+	}
+	p.running = true
+	p.mu.Unlock()
+
+	go func() {
+		res := p.purge(trigger, time.Now().UTC())
+		p.mu.Lock()
+		p.running, p.last = false, res
+		p.mu.Unlock()
+	}()
+	return true
+}
+
+// Status reports the policy and the latest run.
+func (p *Purger) Status() Status {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return Status{Policy: p.policy, Running: p.running, Last: p.last}
+}
+
+func (p *Purger) purge(trigger string, now time.Time) *Result {
+	id := requestid.New()
+	logger := log.With().Str("request_id", id).Str("job", "retention").Logger()
+	ctx := logger.WithContext(requestid.NewContext(context.Background(), id))
+
+	res := &Result{StartedAt: now, Trigger: trigger}
+	fail := func(err error) {
+		res.Errors++
+		res.LastError = err.Error()
+		logger.Error().Err(err).Msg("Retention purge error")
+	}
+
+	scans, err := p.store.ListScans(store.ScanFilter{})
+	if err != nil {
+		fail(err)
+		res.FinishedAt = time.Now().UTC()
+		return res
+	}
+
+	for _, scan := range scans {
+		res.ScansChecked++
+		age := now.Sub(scan.CreatedAt)
+
+		if p.policy.Scans > 0 && age > p.policy.Scans {
+			if err := p.store.DeleteScan(ctx, scan); err != nil {
+				fail(err)
+				continue
+			}
+			res.ScansDeleted++
+			continue
+		}
+		if p.policy.RawOutput > 0 && age > p.policy.RawOutput && scan.HasRawOutput() {
+			if err := p.store.DropRawOutput(ctx, scan); err != nil {
+				fail(err)
+				continue
+			}
+			res.RawOutputsRemoved++
+		}
+	}
+
+	res.FinishedAt = time.Now().UTC()
+	logger.Info().
+		Int("raw_outputs_removed", res.RawOutputsRemoved).
+		Int("scans_deleted", res.ScansDeleted).
+		Int("errors", res.Errors).
+		Msg("Retention purge finished")
+	return res
+}
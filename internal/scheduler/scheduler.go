@@ -0,0 +1,320 @@
+// Package scheduler runs scans of registered targets on their cron
+// schedules.
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"weeklysec/internal/labels"
+	"weeklysec/internal/requestid"
+	"weeklysec/internal/store"
+
+	"github.com/robfig/cron/v3"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+// Disabled is the schedule value that opts a target out of scheduled scans.
+const Disabled = "off"
+
+// ScanFunc scans one target on behalf of its owner, storing the results and
+// sending notifications.
+type ScanFunc func(ctx context.Context, t store.Target) error
+
+// Validate reports whether spec is a usable schedule: empty (use the
+// default), Disabled, a five-field cron expression or a descriptor such as
+// "@weekly".
+func Validate(spec string) error {
+	if spec == "" || spec == Disabled {
+		return nil
+	}
+	if _, err := cron.ParseStandard(spec); err != nil {
+		return fmt.Errorf("invalid schedule %q: %w", spec, err)
+	}
+	return nil
+}
+
+// Entry describes when a target is next scanned.
+type Entry struct {
+	TargetID string    `json:"target_id"`
+	Org      string    `json:"org"`
+	Project  string    `json:"project"`
+	Target   string    `json:"target"`
+	Schedule string    `json:"schedule"`
+	NextRun  time.Time `json:"next_run"`
+	LastRun  time.Time `json:"last_run,omitzero"`
+}
+
+// maxRetryDelay caps the delay before a retry.
+const maxRetryDelay = time.Hour
+
+// RetryPolicy retries scheduled scans that failed for a reason a later
+// attempt may get past.
+type RetryPolicy struct {
+	MaxAttempts int           // runs of a scan, the first included; 1 or less disables retries
+	Backoff     time.Duration // before the first retry, doubling after each
+	Retryable   func(error) bool
+}
+
+type job struct {
+	spec    string
+	entryID cron.EntryID
+}
+
+// Scheduler keeps one cron entry per scheduled target, reconciling them with
+// the inventory periodically so edits made through the API take effect
+// without a restart.
+type Scheduler struct {
+	store       *store.Store
+	scan        ScanFunc
+	defaultSpec string
+	selector    labels.Selector
+	slots       chan struct{}
+	cron        *cron.Cron
+
+	mu      sync.Mutex // guards defaultSpec and retry too
+	jobs    map[string]job
+	named   map[string]cron.EntryID // AddJob entries
+	retry   RetryPolicy
+	retries map[string]*time.Timer // pending retries by target ID
+}
+
+// New returns a scheduler that uses defaultSpec for targets without a
+// schedule of their own and runs at most concurrency scans at a time. Only
+// targets whose labels match selector are scheduled; an empty selector
+// matches every target.
+func New(st *store.Store, scan ScanFunc, defaultSpec, selector string, concurrency int) (*Scheduler, error) {
+	if err := Validate(defaultSpec); err != nil {
+		return nil, err
+	}
+	sel, err := labels.Parse(selector)
+	if err != nil {
+		return nil, fmt.Errorf("invalid selector: %w", err)
+	}
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+	return &Scheduler{
+		store:       st,
+		scan:        scan,
+		defaultSpec: defaultSpec,
+		selector:    sel,
+		slots:       make(chan struct{}, concurrency),
+		cron:        cron.New(),
+		jobs:        make(map[string]job),
+		named:       make(map[string]cron.EntryID),
+		retries:     make(map[string]*time.Timer),
+	}, nil
+}
+
+// SetRetry sets how failed scans are retried. Without it they wait for
+// their next scheduled run.
+func (s *Scheduler) SetRetry(p RetryPolicy) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.retry = p
+}
+
+// Start begins running scheduled scans and re-reads the inventory every
+// syncInterval until stop is closed.
+func (s *Scheduler) Start(syncInterval time.Duration, stop <-chan struct{}) {
+	s.Sync()
+	s.cron.Start()
+
+	go func() {
+		ticker := time.NewTicker(syncInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				s.Sync()
+			case <-stop:
+				<-s.cron.Stop().Done()
+				s.mu.Lock()
+				for id, t := range s.retries {
+					t.Stop()
+					delete(s.retries, id)
+				}
+				s.mu.Unlock()
+				return
+			}
+		}
+	}()
+}
+
+// Sync adds, updates and removes cron entries to match the inventory.
+func (s *Scheduler) Sync() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	targets, err := s.store.ListTargets(store.TargetFilter{Selector: s.selector})
+	if err != nil {
+		// Keep the current entries rather than drop every schedule.
+		log.Error().Err(err).Msg("Failed to list targets to schedule")
+		return
+	}
+	seen := make(map[string]bool)
+	for _, t := range targets {
+		spec := s.specFor(t)
+		if spec == Disabled {
+			continue
+		}
+		seen[t.ID] = true
+
+		if j, ok := s.jobs[t.ID]; ok {
+			if j.spec == spec {
+				continue
+			}
+			s.cron.Remove(j.entryID)
+		}
+
+		id, err := s.cron.AddFunc(spec, func() { s.run(t.ID, 1) })
+		if err != nil {
+			log.Warn().Err(err).Str("target_id", t.ID).Msg("Skipping target with invalid schedule")
+			delete(s.jobs, t.ID)
+			continue
+		}
+		s.jobs[t.ID] = job{spec: spec, entryID: id}
+	}
+
+	for id, j := range s.jobs {
+		if !seen[id] {
+			s.cron.Remove(j.entryID)
+			delete(s.jobs, id)
+		}
+	}
+}
+
+// AddJob runs fn on spec alongside the target scans, e.g. to send reports.
+// A job added under an existing name replaces it.
+func (s *Scheduler) AddJob(spec, name string, fn func(ctx context.Context)) error {
+	if err := Validate(spec); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if id, ok := s.named[name]; ok {
+		s.cron.Remove(id)
+		delete(s.named, name)
+	}
+	if spec == Disabled {
+		return nil
+	}
+	id, err := s.cron.AddFunc(spec, func() {
+		ctx, logger := jobContext(log.With().Str("job", name))
+		logger.Info().Msg("Running scheduled job")
+		fn(ctx)
+	})
+	if err != nil {
+		return err
+	}
+	s.named[name] = id
+	return nil
+}
+
+// SetDefault changes the schedule of targets without one of their own.
+func (s *Scheduler) SetDefault(spec string) error {
+	if err := Validate(spec); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.defaultSpec = spec
+	s.mu.Unlock()
+	s.Sync()
+	return nil
+}
+
+// Entries lists the scheduled targets ordered by next run.
+func (s *Scheduler) Entries() []Entry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var out []Entry
+	for id, j := range s.jobs {
+		t, err := s.store.GetTarget(id)
+		if err != nil {
+			continue
+		}
+		e := s.cron.Entry(j.entryID)
+		out = append(out, Entry{
+			TargetID: t.ID,
+			Org:      t.Org,
+			Project:  t.Project,
+			Target:   t.Target,
+			Schedule: j.spec,
+			NextRun:  e.Next,
+			LastRun:  e.Prev,
+		})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].NextRun.Before(out[j].NextRun) })
+	return out
+}
+
+func (s *Scheduler) specFor(t store.Target) string {
+	if spec := strings.TrimSpace(t.Schedule); spec != "" {
+		return spec
+	}
+	if s.defaultSpec == "" {
+		return Disabled
+	}
+	return s.defaultSpec
+}
+
+// run scans a target as its attempt'th try. It looks the target up again
+// so the scan uses its latest definition, and skips it if it was deleted
+// since the last sync. A scan failing for a retryable reason is tried
+// again after a backoff, up to the retry policy's attempts.
+func (s *Scheduler) run(targetID string, attempt int) {
+	t, err := s.store.GetTarget(targetID)
+	if err != nil {
+		return
+	}
+
+	s.slots <- struct{}{}
+	defer func() { <-s.slots }()
+
+	ctx, logger := jobContext(log.With().Str("target_id", t.ID).Str("target", t.Target).Int("attempt", attempt))
+	logger.Info().Msg("Running scheduled scan")
+	err = s.scan(ctx, t)
+	if err == nil {
+		return
+	}
+	logger.Warn().Err(err).Msg("Scheduled scan failed")
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p := s.retry
+	if attempt >= p.MaxAttempts || p.Retryable == nil || !p.Retryable(err) {
+		return
+	}
+	delay := min(p.Backoff<<(attempt-1), maxRetryDelay)
+	if prev, ok := s.retries[targetID]; ok {
+		prev.Stop()
+	}
+	var timer *time.Timer
+	timer = time.AfterFunc(delay, func() {
+		s.mu.Lock()
+		if s.retries[targetID] == timer {
+			delete(s.retries, targetID)
+		}
+		s.mu.Unlock()
+		s.run(targetID, attempt+1)
+	})
+	s.retries[targetID] = timer
+	if err := s.store.ScheduleScanRetry(targetID, time.Now().UTC().Add(delay)); err != nil {
+		logger.Warn().Err(err).Msg("Failed to record scan retry")
+	}
+	logger.Info().Dur("delay", delay).Msg("Retrying scheduled scan")
+}
+
+// jobContext gives a scheduled run its own request ID and a logger that
+// carries it, as an API request would have.
+func jobContext(fields zerolog.Context) (context.Context, *zerolog.Logger) {
+	id := requestid.New()
+	logger := fields.Str("request_id", id).Logger()
+	return logger.WithContext(requestid.NewContext(context.Background(), id)), &logger
+}
@@ -0,0 +1,238 @@
+// Package scoring runs user-defined hooks over prioritized findings during
+// the pipeline. A hook's "when" expression is written in CEL and decides
+// whether the hook applies to a finding; an applying hook can drop the
+// finding, set or adjust its priority, and tag it. Expressions see:
+//
+//	finding  id, package, installed_version, fixed_version, severity,
+//	         cvss, fixable, title, priority (1-4) and tags
+//	target   target, target_type, org, project, environment, team,
+//	         criticality and labels; the inventory fields are empty for
+//	         ad hoc scans
+//
+// For example:
+//
+//	target.environment == "dev" && finding.severity != "CRITICAL"
+//	finding.package.startsWith("golang.org/x/") && finding.fixable
+//	"internet-facing" in target.labels && finding.cvss >= 7.0
+package scoring
+
+import (
+	"fmt"
+	"os"
+	"slices"
+
+	"github.com/google/cel-go/cel"
+	"gopkg.in/yaml.v3"
+)
+
+// maxCost bounds the work of one evaluation.
+const maxCost = 1_000_000
+
+// Hook is one scoring hook. Hooks run in order, each seeing the priority
+// and tags left by the ones before it.
+type Hook struct {
+	Name        string   `json:"name" yaml:"name"`
+	Description string   `json:"description,omitempty" yaml:"description"`
+	When        string   `json:"when" yaml:"when"`                   // CEL; true when the hook applies
+	Drop        bool     `json:"drop,omitempty" yaml:"drop"`         // leave the finding out
+	Priority    int      `json:"priority,omitempty" yaml:"priority"` // set the priority (1-4)
+	Adjust      int      `json:"adjust,omitempty" yaml:"adjust"`     // move the priority, e.g. 1 to lower it a level
+	Tags        []string `json:"tags,omitempty" yaml:"tags"`         // labels added to the finding
+}
+
+// Hooks is a set of hooks as stored and loaded.
+type Hooks struct {
+	Hooks []Hook `json:"hooks" yaml:"hooks"`
+}
+
+// Load reads hooks from a YAML or JSON file.
+func Load(path string) (Hooks, error) {
+	var h Hooks
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return h, err
+	}
+	if err := yaml.Unmarshal(data, &h); err != nil {
+		return h, fmt.Errorf("%s: %w", path, err)
+	}
+	return h, nil
+}
+
+// Target is what hooks know about the scanned target.
+type Target struct {
+	TargetType string
+	Target     string
+	Org        string
+	Project    string
+
+	// Of the registered target, if any.
+	Environment string
+	Team        string
+	Criticality string
+	Labels      map[string]string
+}
+
+// Finding is what hooks know about a finding.
+type Finding struct {
+	ID               string
+	Package          string
+	InstalledVersion string
+	FixedVersion     string
+	Severity         string
+	CVSS             float64
+	Title            string
+	Priority         int
+	Tags             []string
+}
+
+// Outcome is what the hooks made of a finding.
+type Outcome struct {
+	Drop     bool
+	Priority int
+	Tags     []string
+	Applied  []string // names of the hooks that applied
+	Errors   []string // hooks that failed to evaluate, which are skipped
+}
+
+// Engine runs compiled hooks. It is safe for concurrent use; a nil Engine
+// has no hooks.
+type Engine struct {
+	hooks    Hooks
+	programs []cel.Program
+}
+
+var env = mustEnv()
+
+func mustEnv() *cel.Env {
+	e, err := cel.NewEnv(
+		cel.Variable("finding", cel.MapType(cel.StringType, cel.DynType)),
+		cel.Variable("target", cel.MapType(cel.StringType, cel.DynType)),
+		cel.CrossTypeNumericComparisons(true),
+	)
+	if err != nil {
+		panic(err) // the declarations are fixed
+	}
+	return e
+}
+
+// Compile checks and compiles hooks.
+func Compile(h Hooks) (*Engine, error) {
+	e := &Engine{hooks: h}
+	var names []string
+	for i := range h.Hooks {
+		hook := &e.hooks.Hooks[i]
+		switch {
+		case hook.Name == "":
+			return nil, fmt.Errorf("hook %d has no name", i+1)
+		case slices.Contains(names, hook.Name):
+			return nil, fmt.Errorf("hook %q is defined twice", hook.Name)
+		case hook.Priority < 0 || hook.Priority > 4:
+			return nil, fmt.Errorf("hook %q: priority must be between 1 and 4", hook.Name)
+		case hook.Priority != 0 && hook.Adjust != 0:
+			return nil, fmt.Errorf("hook %q: set either priority or adjust", hook.Name)
+		case !hook.Drop && hook.Priority == 0 && hook.Adjust == 0 && len(hook.Tags) == 0:
+			return nil, fmt.Errorf("hook %q does nothing; set drop, priority, adjust or tags", hook.Name)
+		}
+		names = append(names, hook.Name)
+
+		ast, iss := env.Compile(hook.When)
+		if iss.Err() != nil {
+			return nil, fmt.Errorf("hook %q: %w", hook.Name, iss.Err())
+		}
+		if t := ast.OutputType(); t != cel.BoolType && t != cel.DynType {
+			return nil, fmt.Errorf("hook %q: expression is %s, not bool", hook.Name, t)
+		}
+		prg, err := env.Program(ast, cel.CostLimit(maxCost))
+		if err != nil {
+			return nil, fmt.Errorf("hook %q: %w", hook.Name, err)
+		}
+		e.programs = append(e.programs, prg)
+	}
+	return e, nil
+}
+
+// Hooks returns the hooks.
+func (e *Engine) Hooks() Hooks {
+	if e == nil {
+		return Hooks{Hooks: []Hook{}}
+	}
+	return Hooks{Hooks: slices.Clone(e.hooks.Hooks)}
+}
+
+// Apply runs every hook over f. A dropped finding stops the run.
+func (e *Engine) Apply(t Target, f Finding) Outcome {
+	out := Outcome{Priority: f.Priority, Tags: slices.Clone(f.Tags)}
+	if e == nil {
+		return out
+	}
+	target := targetVars(t)
+	for i, prg := range e.programs {
+		hook := e.hooks.Hooks[i]
+		f.Priority, f.Tags = out.Priority, out.Tags
+		val, _, err := prg.Eval(map[string]any{"finding": findingVars(f), "target": target})
+		if err != nil {
+			out.Errors = append(out.Errors, fmt.Sprintf("%s: %v", hook.Name, err))
+			continue
+		}
+		ok, isBool := val.Value().(bool)
+		if !isBool {
+			out.Errors = append(out.Errors, fmt.Sprintf("%s: expression returned %s, not bool", hook.Name, val.Type().TypeName()))
+			continue
+		}
+		if !ok {
+			continue
+		}
+
+		out.Applied = append(out.Applied, hook.Name)
+		if hook.Drop {
+			out.Drop = true
+			return out
+		}
+		if hook.Priority != 0 {
+			out.Priority = hook.Priority
+		}
+		out.Priority = min(max(out.Priority+hook.Adjust, 1), 4)
+		for _, tag := range hook.Tags {
+			if !slices.Contains(out.Tags, tag) {
+				out.Tags = append(out.Tags, tag)
+			}
+		}
+	}
+	return out
+}
+
+func findingVars(f Finding) map[string]any {
+	tags := f.Tags
+	if tags == nil {
+		tags = []string{}
+	}
+	return map[string]any{
+		"id":                f.ID,
+		"package":           f.Package,
+		"installed_version": f.InstalledVersion,
+		"fixed_version":     f.FixedVersion,
+		"severity":          f.Severity,
+		"cvss":              f.CVSS,
+		"fixable":           f.FixedVersion != "",
+		"title":             f.Title,
+		"priority":          f.Priority,
+		"tags":              tags,
+	}
+}
+
+func targetVars(t Target) map[string]any {
+	labels := t.Labels
+	if labels == nil {
+		labels = map[string]string{}
+	}
+	return map[string]any{
+		"target":      t.Target,
+		"target_type": t.TargetType,
+		"org":         t.Org,
+		"project":     t.Project,
+		"environment": t.Environment,
+		"team":        t.Team,
+		"criticality": t.Criticality,
+		"labels":      labels,
+	}
+}
@@ -0,0 +1,120 @@
+package scoring
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestCompile(t *testing.T) {
+	tests := []struct {
+		name    string
+		hooks   []Hook
+		wantErr string
+	}{
+		{"valid", []Hook{{Name: "a", When: "finding.fixable", Adjust: 1}, {Name: "b", When: "true", Tags: []string{"x"}}}, ""},
+		{"no name", []Hook{{When: "true", Drop: true}}, "hook 1 has no name"},
+		{"duplicate name", []Hook{{Name: "a", When: "true", Drop: true}, {Name: "a", When: "true", Drop: true}}, `hook "a" is defined twice`},
+		{"priority out of range", []Hook{{Name: "a", When: "true", Priority: 5}}, "priority must be between 1 and 4"},
+		{"priority and adjust", []Hook{{Name: "a", When: "true", Priority: 2, Adjust: 1}}, "set either priority or adjust"},
+		{"no effect", []Hook{{Name: "a", When: "true"}}, "does nothing"},
+		{"syntax error", []Hook{{Name: "a", When: "finding.cvss >", Drop: true}}, `hook "a"`},
+		{"unknown variable", []Hook{{Name: "a", When: "scan.total > 0", Drop: true}}, "undeclared reference"},
+		{"not bool", []Hook{{Name: "a", When: "finding.priority + 1", Drop: true}}, "not bool"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Compile(Hooks{Hooks: tt.hooks})
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("Compile() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("Compile() error = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestApply(t *testing.T) {
+	target := Target{TargetType: "image", Target: "nginx", Environment: "dev", Labels: map[string]string{"internet-facing": "true"}}
+	finding := Finding{ID: "CVE-2024-1", Package: "golang.org/x/net", FixedVersion: "0.23.0", Severity: "HIGH", CVSS: 7.5, Priority: 2, Tags: []string{"kev"}}
+
+	tests := []struct {
+		name        string
+		hooks       []Hook
+		want        Outcome
+		wantErrors  int
+		wantApplied []string
+	}{
+		{
+			name:  "no hooks apply",
+			hooks: []Hook{{Name: "prod", When: `target.environment == "prod"`, Priority: 1}},
+			want:  Outcome{Priority: 2, Tags: []string{"kev"}},
+		},
+		{
+			name:        "set priority and tag",
+			hooks:       []Hook{{Name: "exposed", When: `"internet-facing" in target.labels && finding.cvss >= 7.0`, Priority: 1, Tags: []string{"exposed", "kev"}}},
+			want:        Outcome{Priority: 1, Tags: []string{"kev", "exposed"}},
+			wantApplied: []string{"exposed"},
+		},
+		{
+			name: "adjustments are clamped and chained",
+			hooks: []Hook{
+				{Name: "dev", When: `target.environment == "dev"`, Adjust: 3},
+				{Name: "lowest", When: `finding.priority == 4`, Tags: []string{"lowest"}},
+			},
+			want:        Outcome{Priority: 4, Tags: []string{"kev", "lowest"}},
+			wantApplied: []string{"dev", "lowest"},
+		},
+		{
+			name: "drop stops the run",
+			hooks: []Hook{
+				{Name: "x", When: `finding.package.startsWith("golang.org/x/") && finding.fixable`, Drop: true},
+				{Name: "never", When: "true", Tags: []string{"never"}},
+			},
+			want:        Outcome{Drop: true, Priority: 2, Tags: []string{"kev"}},
+			wantApplied: []string{"x"},
+		},
+		{
+			name: "failing hooks are skipped",
+			hooks: []Hook{
+				{Name: "missing", When: `target.labels.owner == "x"`, Drop: true},
+				{Name: "dynamic", When: `target.labels["internet-facing"]`, Drop: true},
+				{Name: "tag", When: `"kev" in finding.tags`, Tags: []string{"seen"}},
+			},
+			want:        Outcome{Priority: 2, Tags: []string{"kev", "seen"}},
+			wantErrors:  2,
+			wantApplied: []string{"tag"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, err := Compile(Hooks{Hooks: tt.hooks})
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := e.Apply(target, finding)
+			if got.Drop != tt.want.Drop || got.Priority != tt.want.Priority || !slices.Equal(got.Tags, tt.want.Tags) {
+				t.Fatalf("Apply() = %+v, want %+v", got, tt.want)
+			}
+			if !slices.Equal(got.Applied, tt.wantApplied) || len(got.Errors) != tt.wantErrors {
+				t.Fatalf("Apply() applied %v with errors %v, want %v and %d errors", got.Applied, got.Errors, tt.wantApplied, tt.wantErrors)
+			}
+		})
+	}
+
+	if !slices.Equal(finding.Tags, []string{"kev"}) {
+		t.Fatalf("Apply() changed the finding's tags to %v", finding.Tags)
+	}
+}
+
+func TestApplyNilEngine(t *testing.T) {
+	var e *Engine
+	got := e.Apply(Target{}, Finding{Priority: 3, Tags: []string{"a"}})
+	if got.Drop || got.Priority != 3 || !slices.Equal(got.Tags, []string{"a"}) || got.Applied != nil {
+		t.Fatalf("nil engine Apply() = %+v", got)
+	}
+}
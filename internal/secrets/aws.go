@@ -0,0 +1,30 @@
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// AWS reads secrets from AWS Secrets Manager with the aws CLI, which finds
+// credentials the usual way: environment, shared config, IRSA or the
+// instance profile, and the region from AWS_REGION unless the ID is an ARN.
+type AWS struct{}
+
+func (AWS) Lookup(ctx context.Context, id, f string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	args := []string{"secretsmanager", "get-secret-value", "--secret-id", id, "--query", "SecretString", "--output", "text"}
+	var out, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "aws", args...)
+	cmd.Stdout = &out
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("aws secretsmanager %s: %w: %s", id, err, strings.TrimSpace(stderr.String()))
+	}
+	return field(strings.TrimRight(out.String(), "\n"), f)
+}
@@ -0,0 +1,49 @@
+package secrets
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"weeklysec/internal/kube"
+)
+
+// Kube reads Kubernetes secrets through the API, so a rotated secret is
+// seen without remounting it.
+type Kube struct {
+	Client    *kube.Client
+	Namespace string // for names without one
+}
+
+// KubeNamespace returns the namespace the process runs in, "default"
+// outside a cluster.
+func KubeNamespace() string {
+	b, err := os.ReadFile("/var/run/secrets/kubernetes.io/serviceaccount/namespace")
+	if err != nil {
+		return "default"
+	}
+	return strings.TrimSpace(string(b))
+}
+
+func (k Kube) Lookup(ctx context.Context, name, key string) (string, error) {
+	if key == "" {
+		return "", fmt.Errorf("kubernetes secret %s needs a #key", name)
+	}
+	namespace := k.Namespace
+	if ns, n, ok := strings.Cut(name, "/"); ok {
+		namespace, name = ns, n
+	}
+	var secret struct {
+		Data map[string][]byte `json:"data"`
+	}
+	path := "/api/v1/namespaces/" + url.PathEscape(namespace) + "/secrets/" + url.PathEscape(name)
+	if err := k.Client.Get(ctx, path, &secret); err != nil {
+		return "", err
+	}
+	v, ok := secret.Data[key]
+	if !ok {
+		return "", fmt.Errorf("kubernetes secret %s/%s has no key %q", namespace, name, key)
+	}
+	return string(v), nil
+}
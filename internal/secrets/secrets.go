@@ -0,0 +1,220 @@
+// Package secrets resolves settings that name a secret instead of holding
+// it, so credentials can live in a secrets manager and rotate there. A
+// reference is an environment value of one of the forms
+//
+//	vault:<API path>#<field>          vault:secret/data/weeklysec#openrouter_api_key
+//	aws-sm:<secret ID or ARN>[#<field>]
+//	k8s-secret:[<namespace>/]<name>#<key>
+//	secret-file:<path>
+//
+// A field picks a key of a JSON secret; without one the whole secret is
+// the value.
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Provider reads secrets of one scheme.
+type Provider interface {
+	// Lookup returns the secret name, or its field when field is not empty.
+	Lookup(ctx context.Context, name, field string) (string, error)
+}
+
+// Schemes of the built-in providers.
+const (
+	SchemeVault = "vault"
+	SchemeAWS   = "aws-sm"
+	SchemeKube  = "k8s-secret"
+	SchemeFile  = "secret-file"
+)
+
+var schemes = []string{SchemeVault, SchemeAWS, SchemeKube, SchemeFile}
+
+// Parse splits a reference into its scheme, name and field; ok is false
+// when value is not a reference.
+func Parse(value string) (scheme, name, field string, ok bool) {
+	scheme, rest, found := strings.Cut(value, ":")
+	if !found || !slices.Contains(schemes, scheme) {
+		return "", "", "", false
+	}
+	if i := strings.LastIndex(rest, "#"); i >= 0 {
+		rest, field = rest[:i], rest[i+1:]
+	}
+	return scheme, rest, field, rest != ""
+}
+
+// IsRef reports whether value is a reference.
+func IsRef(value string) bool {
+	_, _, _, ok := Parse(value)
+	return ok
+}
+
+// Resolver replaces references in the environment with the secrets they
+// name, and keeps them current.
+type Resolver struct {
+	providers map[string]Provider
+
+	mu   sync.Mutex
+	refs map[string]string // environment variable -> reference
+}
+
+// NewResolver returns a resolver using providers by scheme. References to
+// schemes without a provider fail to resolve.
+func NewResolver(providers map[string]Provider) *Resolver {
+	return &Resolver{providers: providers, refs: map[string]string{}}
+}
+
+// Resolve returns the secret ref names.
+func (r *Resolver) Resolve(ctx context.Context, ref string) (string, error) {
+	scheme, name, field, ok := Parse(ref)
+	if !ok {
+		return "", fmt.Errorf("not a secret reference: %q", ref)
+	}
+	p := r.providers[scheme]
+	if p == nil {
+		return "", fmt.Errorf("%s secrets are not configured", scheme)
+	}
+	return p.Lookup(ctx, name, field)
+}
+
+// ResolveEnv replaces every environment variable holding a reference with
+// the secret, and remembers the reference for Refresh.
+func (r *Resolver) ResolveEnv(ctx context.Context) error {
+	var errs []error
+	for _, kv := range os.Environ() {
+		key, value, _ := strings.Cut(kv, "=")
+		if !IsRef(value) {
+			continue
+		}
+		if _, err := r.Track(ctx, key, value); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Track sets key in the environment to value, resolved first when it is a
+// reference. Nothing changes when resolving fails.
+func (r *Resolver) Track(ctx context.Context, key, value string) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !IsRef(value) {
+		delete(r.refs, key)
+		return value, os.Setenv(key, value)
+	}
+	secret, err := r.Resolve(ctx, value)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", key, err)
+	}
+	r.refs[key] = value
+	return secret, os.Setenv(key, secret)
+}
+
+// Ref returns the reference key was resolved from, "" for none.
+func (r *Resolver) Ref(key string) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.refs[key]
+}
+
+// Refresh resolves the tracked references again and updates the variables
+// whose secret rotated, returning their names. A reference that fails to
+// resolve keeps its current value.
+func (r *Resolver) Refresh(ctx context.Context) ([]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var changed []string
+	var errs []error
+	for key, ref := range r.refs {
+		secret, err := r.Resolve(ctx, ref)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", key, err))
+			continue
+		}
+		if os.Getenv(key) == secret {
+			continue
+		}
+		if err := os.Setenv(key, secret); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		changed = append(changed, key)
+	}
+	slices.Sort(changed)
+	return changed, errors.Join(errs...)
+}
+
+// Watch refreshes the references every interval and passes the names of
+// rotated variables to onChange. It returns when stop is closed.
+func (r *Resolver) Watch(interval time.Duration, stop <-chan struct{}, onChange func(keys []string)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), interval)
+			changed, err := r.Refresh(ctx)
+			cancel()
+			if err != nil {
+				log.Error().Err(err).Msg("Failed to refresh secrets, keeping their current values")
+			}
+			if len(changed) > 0 {
+				log.Info().Strs("keys", changed).Msg("Secrets rotated")
+				onChange(changed)
+			}
+		}
+	}
+}
+
+// field returns field of the JSON object secret, or secret when field is
+// empty.
+func field(secret, field string) (string, error) {
+	if field == "" {
+		return secret, nil
+	}
+	var values map[string]any
+	if err := json.Unmarshal([]byte(secret), &values); err != nil {
+		return "", fmt.Errorf("secret is not a JSON object: %w", err)
+	}
+	return stringField(values, field)
+}
+
+func stringField(values map[string]any, field string) (string, error) {
+	v, ok := values[field]
+	if !ok {
+		return "", fmt.Errorf("secret has no field %q", field)
+	}
+	if s, ok := v.(string); ok {
+		return s, nil
+	}
+	b, err := json.Marshal(v)
+	return string(b), err
+}
+
+// File reads secrets from files, such as mounted Kubernetes secrets, which
+// the kubelet updates in place when they rotate.
+type File struct{}
+
+func (File) Lookup(_ context.Context, path, f string) (string, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return field(strings.TrimRight(string(b), "\r\n"), f)
+}
@@ -0,0 +1,164 @@
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// VaultOptions configure access to HashiCorp Vault.
+type VaultOptions struct {
+	Addr      string
+	Namespace string // Vault Enterprise namespace; optional
+
+	// Token authenticates directly. Without it the server logs in with
+	// Kubernetes auth as Role, mounted at AuthPath, using the service
+	// account token in JWTFile.
+	Token    string
+	Role     string
+	AuthPath string // defaults to "kubernetes"
+	JWTFile  string // defaults to the mounted service account token
+}
+
+// Vault reads secrets from Vault's KV engines: the field of the data at
+// an API path such as secret/data/weeklysec (KV v2) or secret/weeklysec
+// (KV v1).
+type Vault struct {
+	opts VaultOptions
+	http *http.Client
+
+	mu      sync.Mutex
+	token   string
+	renewAt time.Time // when a login token is replaced; zero for a static token
+}
+
+// NewVault returns a Vault provider.
+func NewVault(opts VaultOptions) (*Vault, error) {
+	if opts.Addr == "" {
+		return nil, errors.New("vault address is required")
+	}
+	if opts.Token == "" && opts.Role == "" {
+		return nil, errors.New("vault needs a token or a Kubernetes auth role")
+	}
+	if opts.AuthPath == "" {
+		opts.AuthPath = "kubernetes"
+	}
+	if opts.JWTFile == "" {
+		opts.JWTFile = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+	}
+	opts.Addr = strings.TrimRight(opts.Addr, "/")
+	return &Vault{opts: opts, http: &http.Client{Timeout: 30 * time.Second}, token: opts.Token}, nil
+}
+
+func (v *Vault) Lookup(ctx context.Context, path, f string) (string, error) {
+	if f == "" {
+		return "", fmt.Errorf("vault reference %s needs a #field", path)
+	}
+	var resp struct {
+		Data map[string]any `json:"data"`
+	}
+	err := v.call(ctx, http.MethodGet, "/v1/"+strings.TrimLeft(path, "/"), nil, &resp)
+	if err != nil {
+		return "", err
+	}
+	data := resp.Data
+	// KV v2 nests the secret under data.data, next to its metadata.
+	if inner, ok := data["data"].(map[string]any); ok && data["metadata"] != nil {
+		data = inner
+	}
+	return stringField(data, f)
+}
+
+// call sends an authenticated request, logging in again once when a login
+// token was rejected.
+func (v *Vault) call(ctx context.Context, method, path string, body, out any) error {
+	token, err := v.currentToken(ctx)
+	if err != nil {
+		return err
+	}
+	status, err := v.send(ctx, method, path, token, body, out)
+	if status == http.StatusForbidden && v.opts.Token == "" {
+		v.mu.Lock()
+		v.token = ""
+		v.mu.Unlock()
+		if token, err = v.currentToken(ctx); err != nil {
+			return err
+		}
+		_, err = v.send(ctx, method, path, token, body, out)
+	}
+	return err
+}
+
+func (v *Vault) currentToken(ctx context.Context) (string, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.token != "" && (v.renewAt.IsZero() || time.Now().Before(v.renewAt)) {
+		return v.token, nil
+	}
+
+	jwt, err := os.ReadFile(v.opts.JWTFile)
+	if err != nil {
+		return "", fmt.Errorf("failed to read service account token: %w", err)
+	}
+	var resp struct {
+		Auth struct {
+			ClientToken   string `json:"client_token"`
+			LeaseDuration int    `json:"lease_duration"`
+		} `json:"auth"`
+	}
+	login := map[string]string{"role": v.opts.Role, "jwt": strings.TrimSpace(string(jwt))}
+	if _, err := v.send(ctx, http.MethodPost, "/v1/auth/"+v.opts.AuthPath+"/login", "", login, &resp); err != nil {
+		return "", fmt.Errorf("vault login: %w", err)
+	}
+	v.token = resp.Auth.ClientToken
+	// Log in again well before the token expires.
+	v.renewAt = time.Now().Add(time.Duration(resp.Auth.LeaseDuration) * time.Second * 2 / 3)
+	return v.token, nil
+}
+
+func (v *Vault) send(ctx context.Context, method, path, token string, body, out any) (int, error) {
+	var r io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return 0, err
+		}
+		r = bytes.NewReader(b)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, v.opts.Addr+path, r)
+	if err != nil {
+		return 0, err
+	}
+	if token != "" {
+		req.Header.Set("X-Vault-Token", token)
+	}
+	if v.opts.Namespace != "" {
+		req.Header.Set("X-Vault-Namespace", v.opts.Namespace)
+	}
+	resp, err := v.http.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("vault: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var e struct {
+			Errors []string `json:"errors"`
+		}
+		_ = json.NewDecoder(io.LimitReader(resp.Body, 1<<16)).Decode(&e)
+		msg := strings.Join(e.Errors, "; ")
+		if msg == "" {
+			msg = http.StatusText(resp.StatusCode)
+		}
+		return resp.StatusCode, fmt.Errorf("vault: %s %s: %d %s", method, path, resp.StatusCode, msg)
+	}
+	return resp.StatusCode, json.NewDecoder(resp.Body).Decode(out)
+}
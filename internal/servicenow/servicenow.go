@@ -0,0 +1,101 @@
+// Package servicenow creates and reads ServiceNow records, such as
+// incidents, security incidents and change requests, through the Table API.
+package servicenow
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"weeklysec/internal/errcode"
+	"weeklysec/internal/jsonapi"
+)
+
+// Client calls one ServiceNow instance. With a user it authenticates with
+// basic auth, otherwise with a bearer OAuth token.
+type Client struct {
+	baseURL string
+	api     *jsonapi.Client
+}
+
+// New returns a client for the instance at baseURL, e.g.
+// https://example.service-now.com.
+func New(baseURL, user, password, token string) *Client {
+	api := jsonapi.New("servicenow", errcode.ServiceNowError, baseURL)
+	api.Header = jsonapi.Auth(user, password, token)
+	api.Message = message
+	return &Client{baseURL: api.BaseURL, api: api}
+}
+
+// message returns the message and detail of a ServiceNow error response.
+func message(body []byte) string {
+	var apiErr struct {
+		Error struct {
+			Message string `json:"message"`
+			Detail  string `json:"detail"`
+		} `json:"error"`
+	}
+	_ = json.Unmarshal(body, &apiErr)
+	msg := apiErr.Error.Message
+	if apiErr.Error.Detail != "" {
+		msg += ": " + apiErr.Error.Detail
+	}
+	return msg
+}
+
+// Record is the part of a task record the integration tracks.
+type Record struct {
+	SysID  string `json:"sys_id"`
+	Number string `json:"number"`
+	State  string `json:"state"`  // display value, e.g. "Resolved"
+	Active string `json:"active"` // "false" once the task is closed
+}
+
+// Closed reports whether the task is no longer being worked on.
+func (r Record) Closed() bool {
+	return r.Active == "false"
+}
+
+// RecordURL returns the web URL of the record with the given number.
+func (c *Client) RecordURL(table, number string) string {
+	return c.baseURL + "/nav_to.do?uri=" + url.QueryEscape(table+".do?sysparm_query=number="+number)
+}
+
+// Create inserts a record and returns it.
+func (c *Client) Create(ctx context.Context, table string, fields map[string]any) (Record, error) {
+	var out struct {
+		Result Record `json:"result"`
+	}
+	err := c.api.Do(ctx, http.MethodPost, "/api/now/table/"+url.PathEscape(table), fields, &out)
+	return out.Result, err
+}
+
+// Update sets fields of the record with the given number.
+func (c *Client) Update(ctx context.Context, table, number string, fields map[string]any) error {
+	rec, err := c.Get(ctx, table, number)
+	if err != nil {
+		return err
+	}
+	return c.api.Do(ctx, http.MethodPatch, "/api/now/table/"+url.PathEscape(table)+"/"+url.PathEscape(rec.SysID), fields, nil)
+}
+
+// Get returns the record with the given number.
+func (c *Client) Get(ctx context.Context, table, number string) (Record, error) {
+	q := url.Values{
+		"sysparm_query":         {"number=" + number},
+		"sysparm_fields":        {"sys_id,number,state,active"},
+		"sysparm_display_value": {"true"},
+		"sysparm_limit":         {"1"},
+	}
+	var out struct {
+		Result []Record `json:"result"`
+	}
+	if err := c.api.Do(ctx, http.MethodGet, "/api/now/table/"+url.PathEscape(table)+"?"+q.Encode(), nil, &out); err != nil {
+		return Record{}, err
+	}
+	if len(out.Result) == 0 {
+		return Record{}, errcode.Wrap(errcode.ServiceNowError, fmt.Errorf("servicenow: %s %s not found", table, number))
+	}
+	return out.Result[0], nil
+}
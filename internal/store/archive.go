@@ -0,0 +1,394 @@
+package store
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+	"weeklysec/internal/agent"
+	"weeklysec/internal/watch"
+)
+
+// ArchiveVersion is the format version written to archive manifests.
+const ArchiveVersion = 1
+
+// Manifest describes an export archive.
+type Manifest struct {
+	Version           int       `json:"version"`
+	CreatedAt         time.Time `json:"created_at"`
+	Scans             int       `json:"scans"`
+	Suppressions      int       `json:"suppressions"`
+	SeverityOverrides int       `json:"severity_overrides"`
+	Watches           int       `json:"watches"`
+	Feedback          int       `json:"feedback"`
+	Targets           int       `json:"targets"`
+	Findings          int       `json:"findings"`
+	Tickets           int       `json:"tickets"`
+	Guidance          int       `json:"guidance"`
+	ReportSchedules   int       `json:"report_schedules"`
+}
+
+// ImportResult counts what an import wrote and skipped.
+type ImportResult struct {
+	Scans             int `json:"scans"`
+	Suppressions      int `json:"suppressions"`
+	SeverityOverrides int `json:"severity_overrides"`
+	Watches           int `json:"watches"`
+	Feedback          int `json:"feedback"`
+	Targets           int `json:"targets"`
+	Findings          int `json:"findings"`
+	Tickets           int `json:"tickets"`
+	Guidance          int `json:"guidance"`
+	ReportSchedules   int `json:"report_schedules"`
+	Skipped           int `json:"skipped"` // records that already existed
+}
+
+// Export writes every scan (with its raw output, even if offloaded to a
+// blob store), suppression, severity override, watch subscription,
+// feedback, target, finding, ticket, tenant guidance and report schedule to
+// w as a gzipped tar.
+func (s *Store) Export(ctx context.Context, w io.Writer) (*Manifest, error) {
+	scans, err := s.ListScans(ScanFilter{})
+	if err != nil {
+		return nil, err
+	}
+	suppressions, err := s.suppressions.list()
+	if err != nil {
+		return nil, err
+	}
+	overrides, err := s.overrides.list()
+	if err != nil {
+		return nil, err
+	}
+	watches, err := s.watches.list()
+	if err != nil {
+		return nil, err
+	}
+	feedback, err := s.feedback.list()
+	if err != nil {
+		return nil, err
+	}
+	targets, err := s.targets.list()
+	if err != nil {
+		return nil, err
+	}
+	findings, err := s.ListFindings(FindingFilter{})
+	if err != nil {
+		return nil, err
+	}
+	tickets, err := s.tickets.list()
+	if err != nil {
+		return nil, err
+	}
+	guidance, err := s.guidance.list()
+	if err != nil {
+		return nil, err
+	}
+	schedules, err := s.reportSchedules.list()
+	if err != nil {
+		return nil, err
+	}
+
+	m := &Manifest{
+		Version:           ArchiveVersion,
+		CreatedAt:         time.Now().UTC(),
+		Scans:             len(scans),
+		Suppressions:      len(suppressions),
+		SeverityOverrides: len(overrides),
+		Watches:           len(watches),
+		Feedback:          len(feedback),
+		Targets:           len(targets),
+		Findings:          len(findings),
+		Tickets:           len(tickets),
+		Guidance:          len(guidance),
+		ReportSchedules:   len(schedules),
+	}
+
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+
+	write := func(name string, v any) error {
+		data, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Errorf("failed to encode %s: %w", name, err)
+		}
+		hdr := &tar.Header{Name: name, Mode: 0o640, Size: int64(len(data)), ModTime: m.CreatedAt}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		_, err = tw.Write(data)
+		return err
+	}
+
+	if err := write("manifest.json", m); err != nil {
+		return nil, err
+	}
+	if err := write("suppressions.json", suppressions); err != nil {
+		return nil, err
+	}
+	if err := write("severity_overrides.json", overrides); err != nil {
+		return nil, err
+	}
+	if err := write("watches.json", watches); err != nil {
+		return nil, err
+	}
+	if err := write("feedback.json", feedback); err != nil {
+		return nil, err
+	}
+	if err := write("targets.json", targets); err != nil {
+		return nil, err
+	}
+	if err := write("findings.json", findings); err != nil {
+		return nil, err
+	}
+	if err := write("tickets.json", tickets); err != nil {
+		return nil, err
+	}
+	if err := write("guidance.json", guidance); err != nil {
+		return nil, err
+	}
+	if err := write("report_schedules.json", schedules); err != nil {
+		return nil, err
+	}
+	for _, scan := range scans {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		raw, err := s.RawOutput(ctx, scan)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read output of scan %s: %w", scan.ID, err)
+		}
+		full := *scan
+		full.RawOutput, full.RawOutputKey = raw, ""
+		if err := write("scans/"+scan.ID+".json", &full); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	if err := gz.Close(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Import reads an archive written by Export. Existing records are kept
+// unless overwrite is set.
+func (s *Store) Import(ctx context.Context, r io.Reader, overwrite bool) (*ImportResult, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("not a gzip archive: %w", err)
+	}
+	defer gz.Close()
+	tr := tar.NewReader(gz)
+
+	res := &ImportResult{}
+	sawManifest := false
+	for {
+		if err := ctx.Err(); err != nil {
+			return res, err
+		}
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return res, fmt.Errorf("failed to read archive: %w", err)
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		dec := json.NewDecoder(tr)
+		name := path.Clean(hdr.Name)
+		switch {
+		case name == "manifest.json":
+			var m Manifest
+			if err := dec.Decode(&m); err != nil {
+				return res, fmt.Errorf("invalid manifest: %w", err)
+			}
+			if m.Version != ArchiveVersion {
+				return res, fmt.Errorf("unsupported archive version %d", m.Version)
+			}
+			sawManifest = true
+		case !sawManifest:
+			return res, fmt.Errorf("archive must start with manifest.json")
+		case name == "suppressions.json":
+			var items []agent.Suppression
+			if err := dec.Decode(&items); err != nil {
+				return res, fmt.Errorf("invalid %s: %w", name, err)
+			}
+			n, err := importItems(s.suppressions, items, func(v agent.Suppression) string { return v.ID }, overwrite)
+			res.Suppressions += n
+			res.Skipped += len(items) - n
+			if err != nil {
+				return res, err
+			}
+		case name == "severity_overrides.json":
+			var items []agent.SeverityOverride
+			if err := dec.Decode(&items); err != nil {
+				return res, fmt.Errorf("invalid %s: %w", name, err)
+			}
+			n, err := importItems(s.overrides, items, func(v agent.SeverityOverride) string { return v.ID }, overwrite)
+			res.SeverityOverrides += n
+			res.Skipped += len(items) - n
+			if err != nil {
+				return res, err
+			}
+		case name == "watches.json":
+			var items []watch.Subscription
+			if err := dec.Decode(&items); err != nil {
+				return res, fmt.Errorf("invalid %s: %w", name, err)
+			}
+			n, err := importItems(s.watches, items, func(v watch.Subscription) string { return v.ID }, overwrite)
+			res.Watches += n
+			res.Skipped += len(items) - n
+			if err != nil {
+				return res, err
+			}
+		case name == "guidance.json":
+			var items []agent.Guidance
+			if err := dec.Decode(&items); err != nil {
+				return res, fmt.Errorf("invalid %s: %w", name, err)
+			}
+			n, err := importItems(s.guidance, items, agent.Guidance.Key, overwrite)
+			res.Guidance += n
+			res.Skipped += len(items) - n
+			if err != nil {
+				return res, err
+			}
+		case name == "report_schedules.json":
+			var items []ReportSchedule
+			if err := dec.Decode(&items); err != nil {
+				return res, fmt.Errorf("invalid %s: %w", name, err)
+			}
+			n, err := importItems(s.reportSchedules, items, func(v ReportSchedule) string { return v.ID }, overwrite)
+			res.ReportSchedules += n
+			res.Skipped += len(items) - n
+			if err != nil {
+				return res, err
+			}
+		case name == "feedback.json":
+			var items []agent.Feedback
+			if err := dec.Decode(&items); err != nil {
+				return res, fmt.Errorf("invalid %s: %w", name, err)
+			}
+			n, err := importItems(s.feedback, items, func(v agent.Feedback) string { return v.ID }, overwrite)
+			res.Feedback += n
+			res.Skipped += len(items) - n
+			if err != nil {
+				return res, err
+			}
+		case name == "targets.json":
+			var items []Target
+			if err := dec.Decode(&items); err != nil {
+				return res, fmt.Errorf("invalid %s: %w", name, err)
+			}
+			n, err := importItems(s.targets, items, func(v Target) string { return v.ID }, overwrite)
+			res.Targets += n
+			res.Skipped += len(items) - n
+			if err != nil {
+				return res, err
+			}
+		case name == "findings.json":
+			var items []Finding
+			if err := dec.Decode(&items); err != nil {
+				return res, fmt.Errorf("invalid %s: %w", name, err)
+			}
+			n, err := s.importFindings(items, overwrite)
+			res.Findings += n
+			res.Skipped += len(items) - n
+			if err != nil {
+				return res, err
+			}
+		case name == "tickets.json":
+			var items []Ticket
+			if err := dec.Decode(&items); err != nil {
+				return res, fmt.Errorf("invalid %s: %w", name, err)
+			}
+			n, err := importItems(s.tickets, items, func(v Ticket) string { return v.ID }, overwrite)
+			res.Tickets += n
+			res.Skipped += len(items) - n
+			if err != nil {
+				return res, err
+			}
+		case strings.HasPrefix(name, "scans/"):
+			var scan Scan
+			if err := dec.Decode(&scan); err != nil {
+				return res, fmt.Errorf("invalid %s: %w", name, err)
+			}
+			if !ValidID(scan.ID) {
+				return res, fmt.Errorf("invalid %s: malformed id %q", name, scan.ID)
+			}
+			// Export inlines the output; a key here could name any blob.
+			scan.RawOutputKey = ""
+			if !overwrite {
+				_, err := s.GetScan(scan.ID)
+				if err == nil {
+					res.Skipped++
+					continue
+				}
+				if !errors.Is(err, ErrNotFound) {
+					return res, err
+				}
+			}
+			if err := s.SaveScan(&scan); err != nil {
+				return res, err
+			}
+			res.Scans++
+		}
+	}
+	if !sawManifest {
+		return res, fmt.Errorf("archive has no manifest.json")
+	}
+	return res, nil
+}
+
+// importItems writes the items that are new, or all of them when
+// overwriting, and returns how many were written.
+// importFindings is importItems for findings, which are not a collection.
+func (s *Store) importFindings(items []Finding, overwrite bool) (int, error) {
+	batch := map[string]Finding{}
+	for _, f := range items {
+		if !overwrite {
+			_, err := s.backend.GetFinding(f.ID)
+			if err == nil {
+				continue
+			}
+			if !errors.Is(err, ErrNotFound) {
+				return 0, err
+			}
+		}
+		batch[f.ID] = f
+	}
+	findings := make([]Finding, 0, len(batch))
+	for _, f := range batch {
+		findings = append(findings, f)
+	}
+	return len(findings), s.backend.PutFindings(findings)
+}
+
+func importItems[T any](c *collection[T], items []T, id func(T) string, overwrite bool) (int, error) {
+	batch := map[string]T{}
+	for _, item := range items {
+		if !overwrite {
+			_, err := c.lookup(id(item))
+			if err == nil {
+				continue
+			}
+			if !errors.Is(err, ErrNotFound) {
+				return 0, err
+			}
+		}
+		batch[id(item)] = item
+	}
+	return len(batch), c.putAll(batch)
+}
@@ -0,0 +1,195 @@
+package store
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+	"weeklysec/internal/agent"
+)
+
+func openTestStore(t *testing.T) *Store {
+	t.Helper()
+	s, err := Open(Options{Dir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+// archive writes files to a gzipped tar in order.
+func archive(t *testing.T, files ...[2]string) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for _, f := range files {
+		if err := tw.WriteHeader(&tar.Header{Name: f[0], Mode: 0o640, Size: int64(len(f[1]))}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(f[1])); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return &buf
+}
+
+func manifest(version int) [2]string {
+	data, _ := json.Marshal(Manifest{Version: version})
+	return [2]string{"manifest.json", string(data)}
+}
+
+func scanFile(scan Scan) [2]string {
+	data, _ := json.Marshal(scan)
+	return [2]string{"scans/scan.json", string(data)}
+}
+
+func TestExportImportRoundTrip(t *testing.T) {
+	src := openTestStore(t)
+	scan := &Scan{Org: "acme", Project: "web", TargetType: "image", Target: "nginx", RawOutput: `{"Results":[]}`}
+	if err := src.SaveScan(scan); err != nil {
+		t.Fatal(err)
+	}
+	if err := src.SaveTarget(Target{ID: "t1", Org: "acme", Project: "web", TargetType: "image", Target: "nginx"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := src.SaveSuppression(agent.Suppression{ID: "s1", Org: "acme", Project: "web", VulnerabilityID: "CVE-2024-1"}); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	m, err := src.Export(context.Background(), &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Scans != 1 || m.Targets != 1 || m.Suppressions != 1 {
+		t.Fatalf("manifest = %+v", m)
+	}
+	archived := buf.Bytes()
+
+	dst := openTestStore(t)
+	tests := []struct {
+		name      string
+		overwrite bool
+		want      ImportResult
+	}{
+		{"into an empty store", false, ImportResult{Scans: 1, Targets: 1, Suppressions: 1}},
+		{"again", false, ImportResult{Skipped: 3}},
+		{"again, overwriting", true, ImportResult{Scans: 1, Targets: 1, Suppressions: 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := dst.Import(context.Background(), bytes.NewReader(archived), tt.overwrite)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if *res != tt.want {
+				t.Fatalf("Import() = %+v, want %+v", *res, tt.want)
+			}
+		})
+	}
+
+	got, err := dst.GetScan(scan.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Target != "nginx" || got.RawOutput != scan.RawOutput {
+		t.Fatalf("imported scan = %+v", got)
+	}
+}
+
+func TestImportRejects(t *testing.T) {
+	valid := NewID()
+	tests := []struct {
+		name    string
+		files   [][2]string
+		wantErr string
+	}{
+		{"no manifest", [][2]string{scanFile(Scan{ID: valid})}, "must start with manifest.json"},
+		{"unsupported version", [][2]string{manifest(ArchiveVersion + 1)}, "unsupported archive version"},
+		{"empty archive", nil, "no manifest.json"},
+		{"missing scan id", [][2]string{manifest(ArchiveVersion), {"scans/x.json", `{"target":"nginx"}`}}, "malformed id"},
+		{"path traversal", [][2]string{manifest(ArchiveVersion), scanFile(Scan{ID: "../../etc/cron.d/x"})}, "malformed id"},
+		{"blob key prefix", [][2]string{manifest(ArchiveVersion), scanFile(Scan{ID: valid + "/trivy.json"})}, "malformed id"},
+		{"upper case", [][2]string{manifest(ArchiveVersion), scanFile(Scan{ID: strings.ToUpper(valid)})}, "malformed id"},
+		{"malformed scan", [][2]string{manifest(ArchiveVersion), {"scans/x.json", `{`}}, "invalid scans/x.json"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := openTestStore(t)
+			res, err := s.Import(context.Background(), archive(t, tt.files...), false)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("Import() error = %v, want it to contain %q", err, tt.wantErr)
+			}
+			if res != nil && res.Scans != 0 {
+				t.Fatalf("Import() stored %d scans", res.Scans)
+			}
+		})
+	}
+}
+
+func TestImportDropsRawOutputKey(t *testing.T) {
+	s := openTestStore(t)
+	scan := Scan{ID: NewID(), Org: "acme", Project: "web", Target: "nginx", CreatedAt: time.Now().UTC(), RawOutputKey: "scans/" + NewID() + "/trivy.json"}
+	if _, err := s.Import(context.Background(), archive(t, manifest(ArchiveVersion), scanFile(scan)), false); err != nil {
+		t.Fatal(err)
+	}
+	got, err := s.GetScan(scan.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.RawOutputKey != "" {
+		t.Fatalf("imported scan kept raw output key %q", got.RawOutputKey)
+	}
+}
+
+func TestArchiveFailsOnReadErrors(t *testing.T) {
+	s := openTestStore(t)
+	b := &flakyBackend{Backend: s.backend, fail: true}
+	s.suppressions = openCollection[agent.Suppression](b, "suppressions")
+
+	if _, err := s.Export(context.Background(), &bytes.Buffer{}); !errors.Is(err, errFlaky) {
+		t.Fatalf("Export() error = %v, want the read error", err)
+	}
+	rules, _ := json.Marshal([]agent.Suppression{{ID: "r1", Org: "acme", Project: "web"}})
+	in := archive(t, manifest(ArchiveVersion), [2]string{"suppressions.json", string(rules)})
+	if _, err := s.Import(context.Background(), in, false); !errors.Is(err, errFlaky) {
+		t.Fatalf("Import() error = %v, want the read error", err)
+	}
+	b.fail = false
+	if _, err := s.GetSuppression("r1"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Import() wrote a rule it could not check: %v", err)
+	}
+}
+
+func TestValidID(t *testing.T) {
+	tests := []struct {
+		id   string
+		want bool
+	}{
+		{NewID(), true},
+		{"0123456789abcdef0123456789abcdef", true},
+		{"", false},
+		{"0123456789abcdef0123456789abcde", false},
+		{"0123456789ABCDEF0123456789ABCDEF", false},
+		{"0123456789abcdef0123456789abcde/", false},
+		{"../0123456789abcdef0123456789abc", false},
+	}
+	for _, tt := range tests {
+		if got := ValidID(tt.id); got != tt.want {
+			t.Errorf("ValidID(%q) = %v, want %v", tt.id, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package store
+
+import (
+	"context"
+	"sort"
+	"time"
+	"weeklysec/internal/quota"
+)
+
+// Backend persists scans, findings, quota usage, and the records of the
+// store's other collections (targets, settings, ...) JSON-encoded by
+// collection and ID. The SQL backends share them between replicas; the
+// file backend keeps them on local disk, which only suits a single
+// replica.
+type Backend interface {
+	PutScan(scan *Scan) error
+	GetScan(id string) (*Scan, error)
+	DeleteScan(id string) error
+	ListScans(f ScanFilter) ([]*Scan, error)
+	Orgs() ([]string, error)
+
+	GetRecord(kind, id string) ([]byte, error)
+	ListRecords(kind string) (map[string][]byte, error)
+	PutRecords(kind string, records map[string][]byte) error // all or none
+	DeleteRecord(kind, id string) error
+
+	// Findings are kept apart from the other records so they can be
+	// looked up by target and tenant.
+	GetFinding(id string) (Finding, error)
+	EachFinding(f FindingFilter, fn func(Finding) error) error // stops at fn's first error
+	PutFindings(findings []Finding) error                      // all or none
+
+	GetUsage(month, scope string) (quota.Usage, error) // zero when there is none
+	ListUsage(month string) ([]quota.Usage, error)
+	AddUsage(month, scope string, scans, tokens int, at time.Time) (quota.Usage, error) // atomic
+
+	Ping(ctx context.Context) error
+	Close() error
+}
+
+// Backend names accepted by Open.
+const (
+	BackendSQLite   = "sqlite"
+	BackendPostgres = "postgres"
+	BackendFile     = "file"
+)
+
+// finishList orders scans newest first and applies the filter's
+// LatestOnly and Limit for backends that cannot do it in their query.
+func finishList(scans []*Scan, f ScanFilter) []*Scan {
+	sort.Slice(scans, func(i, j int) bool { return scans[i].CreatedAt.After(scans[j].CreatedAt) })
+
+	if f.LatestOnly {
+		seen := make(map[string]bool)
+		latest := scans[:0]
+		for _, scan := range scans {
+			key := scan.TargetKey()
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			latest = append(latest, scan)
+		}
+		scans = latest
+	}
+
+	if f.Limit > 0 && len(scans) > f.Limit {
+		scans = scans[:f.Limit]
+	}
+	return scans
+}
@@ -0,0 +1,141 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// BlobStore holds large objects, such as raw Trivy output and rendered
+// reports, outside the scan records.
+type BlobStore interface {
+	Put(ctx context.Context, key string, data []byte, contentType string) error
+	Get(ctx context.Context, key string) ([]byte, error)
+	Delete(ctx context.Context, key string) error
+}
+
+// FileBlobs stores blobs as files under a directory.
+type FileBlobs struct {
+	dir string
+}
+
+func NewFileBlobs(dir string) *FileBlobs {
+	return &FileBlobs{dir: dir}
+}
+
+func (b *FileBlobs) Put(ctx context.Context, key string, data []byte, contentType string) error {
+	p := filepath.Join(b.dir, filepath.FromSlash(key))
+	if err := os.MkdirAll(filepath.Dir(p), 0o750); err != nil {
+		return fmt.Errorf("failed to create blob directory: %w", err)
+	}
+	return writeFileAtomic(p, data)
+}
+
+func (b *FileBlobs) Get(ctx context.Context, key string) ([]byte, error) {
+	data, err := os.ReadFile(filepath.Join(b.dir, filepath.FromSlash(key)))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	return data, err
+}
+
+func (b *FileBlobs) Delete(ctx context.Context, key string) error {
+	err := os.Remove(filepath.Join(b.dir, filepath.FromSlash(key)))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// S3Config locates an S3-compatible bucket. Google Cloud Storage works
+// through its interoperability endpoint (storage.googleapis.com) with HMAC
+// keys.
+type S3Config struct {
+	Endpoint        string // host[:port], e.g. s3.amazonaws.com
+	Region          string
+	Bucket          string
+	Prefix          string
+	AccessKeyID     string
+	SecretAccessKey string
+	Insecure        bool // plain HTTP, for local MinIO
+}
+
+// S3Blobs stores blobs in an S3-compatible bucket.
+type S3Blobs struct {
+	client *minio.Client
+	bucket string
+	prefix string
+}
+
+func NewS3Blobs(cfg S3Config) (*S3Blobs, error) {
+	if cfg.Bucket == "" {
+		return nil, fmt.Errorf("a bucket is required")
+	}
+	creds := credentials.NewStaticV4(cfg.AccessKeyID, cfg.SecretAccessKey, "")
+	if cfg.AccessKeyID == "" {
+		// Fall back to the environment, shared config and instance roles
+		creds = credentials.NewChainCredentials([]credentials.Provider{
+			&credentials.EnvAWS{},
+			&credentials.FileAWSCredentials{},
+			&credentials.IAM{},
+		})
+	}
+	client, err := minio.New(cfg.Endpoint, &minio.Options{
+		Creds:  creds,
+		Secure: !cfg.Insecure,
+		Region: cfg.Region,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create S3 client: %w", err)
+	}
+	return &S3Blobs{client: client, bucket: cfg.Bucket, prefix: strings.Trim(cfg.Prefix, "/")}, nil
+}
+
+func (b *S3Blobs) Put(ctx context.Context, key string, data []byte, contentType string) error {
+	_, err := b.client.PutObject(ctx, b.bucket, b.key(key), bytes.NewReader(data), int64(len(data)),
+		minio.PutObjectOptions{ContentType: contentType})
+	if err != nil {
+		return fmt.Errorf("failed to upload %s: %w", key, err)
+	}
+	return nil
+}
+
+func (b *S3Blobs) Get(ctx context.Context, key string) ([]byte, error) {
+	obj, err := b.client.GetObject(ctx, b.bucket, b.key(key), minio.GetObjectOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to download %s: %w", key, err)
+	}
+	defer obj.Close()
+
+	data, err := io.ReadAll(obj)
+	if err != nil {
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to download %s: %w", key, err)
+	}
+	return data, nil
+}
+
+func (b *S3Blobs) Delete(ctx context.Context, key string) error {
+	if err := b.client.RemoveObject(ctx, b.bucket, b.key(key), minio.RemoveObjectOptions{}); err != nil {
+		return fmt.Errorf("failed to delete %s: %w", key, err)
+	}
+	return nil
+}
+
+func (b *S3Blobs) key(key string) string {
+	if b.prefix == "" {
+		return key
+	}
+	return path.Join(b.prefix, key)
+}
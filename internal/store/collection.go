@@ -0,0 +1,72 @@
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// collection is a small keyed set of records of one kind, kept by the
+// Backend as JSON. Reads go to the backend every time, so replicas sharing
+// a SQL backend see each other's writes. A record that cannot be read is
+// an error, never a missing record.
+type collection[T any] struct {
+	kind    string
+	backend Backend
+}
+
+func openCollection[T any](b Backend, kind string) *collection[T] {
+	return &collection[T]{kind: kind, backend: b}
+}
+
+// lookup returns the record with the given ID, or ErrNotFound.
+func (c *collection[T]) lookup(id string) (T, error) {
+	var item T
+	data, err := c.backend.GetRecord(c.kind, id)
+	if err != nil {
+		return item, err
+	}
+	if err := json.Unmarshal(data, &item); err != nil {
+		return item, fmt.Errorf("failed to decode %s record %s: %w", c.kind, id, err)
+	}
+	return item, nil
+}
+
+func (c *collection[T]) list() ([]T, error) {
+	records, err := c.backend.ListRecords(c.kind)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]T, 0, len(records))
+	for id, data := range records {
+		var item T
+		if err := json.Unmarshal(data, &item); err != nil {
+			return nil, fmt.Errorf("failed to decode %s record %s: %w", c.kind, id, err)
+		}
+		out = append(out, item)
+	}
+	return out, nil
+}
+
+func (c *collection[T]) put(id string, item T) error {
+	return c.putAll(map[string]T{id: item})
+}
+
+// putAll writes several items at once.
+func (c *collection[T]) putAll(items map[string]T) error {
+	if len(items) == 0 {
+		return nil
+	}
+	records := make(map[string][]byte, len(items))
+	for id, item := range items {
+		data, err := json.Marshal(item)
+		if err != nil {
+			return fmt.Errorf("failed to encode %s record: %w", c.kind, err)
+		}
+		records[id] = data
+	}
+	return c.backend.PutRecords(c.kind, records)
+}
+
+func (c *collection[T]) delete(id string) error {
+	return c.backend.DeleteRecord(c.kind, id)
+}
@@ -0,0 +1,76 @@
+package store
+
+import (
+	"errors"
+	"testing"
+	"time"
+	"weeklysec/internal/agent"
+	"weeklysec/internal/trivy"
+)
+
+// flakyBackend fails record reads while fail is set.
+type flakyBackend struct {
+	Backend
+	fail bool
+}
+
+var errFlaky = errors.New("connection reset")
+
+func (b *flakyBackend) GetRecord(kind, id string) ([]byte, error) {
+	if b.fail {
+		return nil, errFlaky
+	}
+	return b.Backend.GetRecord(kind, id)
+}
+
+func (b *flakyBackend) EachFinding(f FindingFilter, fn func(Finding) error) error {
+	if b.fail {
+		return errFlaky
+	}
+	return b.Backend.EachFinding(f, fn)
+}
+
+func (b *flakyBackend) ListRecords(kind string) (map[string][]byte, error) {
+	if b.fail {
+		return nil, errFlaky
+	}
+	return b.Backend.ListRecords(kind)
+}
+
+func TestReadErrorsAreNotMissingRecords(t *testing.T) {
+	s := openTestStore(t)
+	b := &flakyBackend{Backend: s.backend}
+	s.backend = b
+	s.suppressions = openCollection[agent.Suppression](b, "suppressions")
+
+	first := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	scan := &Scan{ID: "s1", Org: "acme", Project: "web", TargetType: "image", Target: "nginx", CreatedAt: first,
+		Vulnerabilities: []trivy.Vulnerability{{VulnerabilityID: "CVE-2024-1", PkgName: "openssl"}}}
+	if err := s.TrackFindings(scan); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SaveSuppression(agent.Suppression{ID: "r1", Org: "acme", Project: "web"}); err != nil {
+		t.Fatal(err)
+	}
+
+	b.fail = true
+	scan.ID, scan.CreatedAt = "s2", first.Add(time.Hour)
+	if err := s.TrackFindings(scan); !errors.Is(err, errFlaky) {
+		t.Fatalf("TrackFindings() error = %v, want the read error", err)
+	}
+	if _, err := s.ListSuppressions("acme", "web", false); !errors.Is(err, errFlaky) {
+		t.Fatalf("ListSuppressions() error = %v, want the read error", err)
+	}
+	if _, err := s.ListFindings(FindingFilter{Org: "acme"}); !errors.Is(err, errFlaky) {
+		t.Fatalf("ListFindings() error = %v, want the read error", err)
+	}
+
+	b.fail = false
+	findings, err := s.ListFindings(FindingFilter{Org: "acme"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(findings) != 1 || !findings[0].FirstSeen.Equal(first) || findings[0].LastScanID != "s1" {
+		t.Fatalf("findings after a failed read = %+v, want the first scan's", findings)
+	}
+}
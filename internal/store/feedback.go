@@ -0,0 +1,53 @@
+package store
+
+import (
+	"sort"
+	"weeklysec/internal/agent"
+)
+
+// FeedbackFilter narrows ListFeedback. Zero values match everything.
+type FeedbackFilter struct {
+	Org     string
+	Project string // empty or "*" matches every project of Org
+	ScanID  string
+	Subject string
+	Rating  string
+}
+
+// SaveFeedback creates or replaces feedback on generated text.
+func (s *Store) SaveFeedback(fb agent.Feedback) error {
+	return s.feedback.put(fb.ID, fb)
+}
+
+// GetFeedback returns the feedback with the given ID.
+func (s *Store) GetFeedback(id string) (agent.Feedback, error) {
+	return s.feedback.lookup(id)
+}
+
+// DeleteFeedback removes feedback.
+func (s *Store) DeleteFeedback(id string) error {
+	return s.feedback.delete(id)
+}
+
+// ListFeedback returns the feedback matching f, oldest first.
+func (s *Store) ListFeedback(f FeedbackFilter) ([]agent.Feedback, error) {
+	all, err := s.feedback.list()
+	if err != nil {
+		return nil, err
+	}
+	tf := ScanFilter{Org: f.Org, Project: f.Project}
+
+	var out []agent.Feedback
+	for _, fb := range all {
+		switch {
+		case !tf.matchesTenant(fb.Org, fb.Project):
+		case f.ScanID != "" && fb.ScanID != f.ScanID:
+		case f.Subject != "" && fb.Subject != f.Subject:
+		case f.Rating != "" && fb.Rating != f.Rating:
+		default:
+			out = append(out, fb)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].CreatedAt.Before(out[j].CreatedAt) })
+	return out, nil
+}
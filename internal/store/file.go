@@ -0,0 +1,404 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+	"weeklysec/internal/quota"
+)
+
+// fileBackend keeps scans in memory and mirrors each one to a JSON file.
+// Each collection of records is one JSON file, rewritten on every write,
+// which is fine for the low-volume metadata kept this way. It suits
+// single-instance deployments and development.
+type fileBackend struct {
+	dir       string // scans
+	recordDir string // a <kind>.json file per collection
+
+	mu    sync.RWMutex
+	scans map[string]*Scan
+
+	recordMu sync.RWMutex
+	records  map[string]map[string]json.RawMessage // by kind, loaded on first use
+
+	usageMu sync.Mutex // serializes AddUsage
+}
+
+func openFileBackend(dir, recordDir string) (*fileBackend, error) {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, fmt.Errorf("failed to create scan directory: %w", err)
+	}
+	scans, err := readScanFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	b := &fileBackend{
+		dir:       dir,
+		recordDir: recordDir,
+		scans:     make(map[string]*Scan, len(scans)),
+		records:   make(map[string]map[string]json.RawMessage),
+	}
+	for _, scan := range scans {
+		b.scans[scan.ID] = scan
+	}
+	return b, nil
+}
+
+// readRecordFile decodes the file of a collection, empty when there is
+// none yet.
+func readRecordFile(dir, kind string) (map[string]json.RawMessage, error) {
+	path := filepath.Join(dir, kind+".json")
+	records := map[string]json.RawMessage{}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return records, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	if err := json.Unmarshal(data, &records); err != nil {
+		return nil, fmt.Errorf("failed to decode %s: %w", path, err)
+	}
+	return records, nil
+}
+
+// readScanFiles decodes every scan file in dir.
+func readScanFiles(dir string) ([]*Scan, error) {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read scan directory: %w", err)
+	}
+
+	var out []*Scan
+	for _, e := range entries {
+		if e.IsDir() || filepath.Ext(e.Name()) != ".json" {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, e.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read scan %s: %w", e.Name(), err)
+		}
+		var scan Scan
+		if err := json.Unmarshal(data, &scan); err != nil {
+			return nil, fmt.Errorf("failed to decode scan %s: %w", e.Name(), err)
+		}
+		if scan.Org == "" {
+			scan.Org, scan.Project = defaultOrg, defaultProject
+		}
+		out = append(out, &scan)
+	}
+	return out, nil
+}
+
+func (b *fileBackend) PutScan(scan *Scan) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if old, ok := b.scans[scan.ID]; ok && scan.rawOmitted {
+		kept := *scan
+		kept.RawOutput, kept.rawOmitted = old.RawOutput, false
+		scan = &kept
+	}
+	data, err := json.Marshal(scan)
+	if err != nil {
+		return fmt.Errorf("failed to encode scan: %w", err)
+	}
+
+	if err := writeFileAtomic(filepath.Join(b.dir, scan.ID+".json"), data); err != nil {
+		return fmt.Errorf("failed to write scan: %w", err)
+	}
+	b.scans[scan.ID] = scan
+	return nil
+}
+
+func (b *fileBackend) GetScan(id string) (*Scan, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	scan, ok := b.scans[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return scan, nil
+}
+
+func (b *fileBackend) DeleteScan(id string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, ok := b.scans[id]; !ok {
+		return ErrNotFound
+	}
+	if err := os.Remove(filepath.Join(b.dir, id+".json")); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to delete scan: %w", err)
+	}
+	delete(b.scans, id)
+	return nil
+}
+
+func (b *fileBackend) ListScans(f ScanFilter) ([]*Scan, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	var out []*Scan
+	for _, scan := range b.scans {
+		if !f.matchesTenant(scan.Org, scan.Project) {
+			continue
+		}
+		if f.Target != "" && scan.Target != f.Target {
+			continue
+		}
+		if !f.Since.IsZero() && scan.CreatedAt.Before(f.Since) {
+			continue
+		}
+		out = append(out, scan)
+	}
+	out = finishList(out, f)
+	for i, scan := range out {
+		if scan.RawOutput != "" {
+			listed := *scan
+			listed.RawOutput, listed.rawOmitted = "", true
+			out[i] = &listed
+		}
+	}
+	return out, nil
+}
+
+func (b *fileBackend) Orgs() ([]string, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	seen := map[string]bool{}
+	for _, scan := range b.scans {
+		seen[scan.Org] = true
+	}
+	out := make([]string, 0, len(seen))
+	for org := range seen {
+		out = append(out, org)
+	}
+	sort.Strings(out)
+	return out, nil
+}
+
+// kind returns the records of a collection, reading its file the first
+// time. It must be called with recordMu held for writing.
+func (b *fileBackend) kind(kind string) (map[string]json.RawMessage, error) {
+	if records, ok := b.records[kind]; ok {
+		return records, nil
+	}
+	records, err := readRecordFile(b.recordDir, kind)
+	if err != nil {
+		return nil, err
+	}
+	b.records[kind] = records
+	return records, nil
+}
+
+func (b *fileBackend) GetRecord(kind, id string) ([]byte, error) {
+	b.recordMu.Lock()
+	defer b.recordMu.Unlock()
+
+	records, err := b.kind(kind)
+	if err != nil {
+		return nil, err
+	}
+	data, ok := records[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return data, nil
+}
+
+func (b *fileBackend) ListRecords(kind string) (map[string][]byte, error) {
+	b.recordMu.Lock()
+	defer b.recordMu.Unlock()
+
+	records, err := b.kind(kind)
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[string][]byte, len(records))
+	for id, data := range records {
+		out[id] = data
+	}
+	return out, nil
+}
+
+func (b *fileBackend) PutRecords(kind string, items map[string][]byte) error {
+	b.recordMu.Lock()
+	defer b.recordMu.Unlock()
+
+	records, err := b.kind(kind)
+	if err != nil {
+		return err
+	}
+	prev := make(map[string]json.RawMessage, len(items))
+	existed := make(map[string]bool, len(items))
+	for id, data := range items {
+		prev[id], existed[id] = records[id]
+		records[id] = data
+	}
+	if err := b.flush(kind, records); err != nil {
+		for id := range items {
+			if existed[id] {
+				records[id] = prev[id]
+			} else {
+				delete(records, id)
+			}
+		}
+		return err
+	}
+	return nil
+}
+
+func (b *fileBackend) DeleteRecord(kind, id string) error {
+	b.recordMu.Lock()
+	defer b.recordMu.Unlock()
+
+	records, err := b.kind(kind)
+	if err != nil {
+		return err
+	}
+	prev, ok := records[id]
+	if !ok {
+		return ErrNotFound
+	}
+	delete(records, id)
+	if err := b.flush(kind, records); err != nil {
+		records[id] = prev
+		return err
+	}
+	return nil
+}
+
+func (b *fileBackend) GetFinding(id string) (Finding, error) {
+	var f Finding
+	data, err := b.GetRecord(findingsKind, id)
+	if err != nil {
+		return f, err
+	}
+	if err := json.Unmarshal(data, &f); err != nil {
+		return f, fmt.Errorf("failed to decode finding %s: %w", id, err)
+	}
+	return f, nil
+}
+
+// EachFinding filters every finding in memory; the file backend is meant
+// for data sets small enough for that.
+func (b *fileBackend) EachFinding(f FindingFilter, fn func(Finding) error) error {
+	records, err := b.ListRecords(findingsKind)
+	if err != nil {
+		return err
+	}
+	for id, data := range records {
+		var fd Finding
+		if err := json.Unmarshal(data, &fd); err != nil {
+			return fmt.Errorf("failed to decode finding %s: %w", id, err)
+		}
+		if !f.matches(fd) {
+			continue
+		}
+		if err := fn(fd); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b *fileBackend) PutFindings(findings []Finding) error {
+	if len(findings) == 0 {
+		return nil
+	}
+	records := make(map[string][]byte, len(findings))
+	for _, f := range findings {
+		data, err := json.Marshal(f)
+		if err != nil {
+			return fmt.Errorf("failed to encode finding: %w", err)
+		}
+		records[f.ID] = data
+	}
+	return b.PutRecords(findingsKind, records)
+}
+
+func (b *fileBackend) GetUsage(month, scope string) (quota.Usage, error) {
+	var u quota.Usage
+	data, err := b.GetRecord(usageKind, quota.Usage{Month: month, Scope: scope}.Key())
+	if errors.Is(err, ErrNotFound) {
+		return quota.Usage{Month: month, Scope: scope}, nil
+	}
+	if err != nil {
+		return u, err
+	}
+	if err := json.Unmarshal(data, &u); err != nil {
+		return u, fmt.Errorf("failed to decode usage of %s: %w", scope, err)
+	}
+	return u, nil
+}
+
+func (b *fileBackend) ListUsage(month string) ([]quota.Usage, error) {
+	records, err := b.ListRecords(usageKind)
+	if err != nil {
+		return nil, err
+	}
+	var out []quota.Usage
+	for id, data := range records {
+		var u quota.Usage
+		if err := json.Unmarshal(data, &u); err != nil {
+			return nil, fmt.Errorf("failed to decode usage %s: %w", id, err)
+		}
+		if u.Month == month {
+			out = append(out, u)
+		}
+	}
+	return out, nil
+}
+
+func (b *fileBackend) AddUsage(month, scope string, scans, tokens int, at time.Time) (quota.Usage, error) {
+	b.usageMu.Lock()
+	defer b.usageMu.Unlock()
+
+	u, err := b.GetUsage(month, scope)
+	if err != nil {
+		return u, err
+	}
+	u.Scans += scans
+	u.Tokens += tokens
+	u.UpdatedAt = at
+	data, err := json.Marshal(u)
+	if err != nil {
+		return u, fmt.Errorf("failed to encode usage: %w", err)
+	}
+	return u, b.PutRecords(usageKind, map[string][]byte{u.Key(): data})
+}
+
+// flush rewrites the file of a collection. It must be called with
+// recordMu held for writing.
+func (b *fileBackend) flush(kind string, records map[string]json.RawMessage) error {
+	path := filepath.Join(b.recordDir, kind+".json")
+	data, err := json.Marshal(records)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s: %w", path, err)
+	}
+	if err := writeFileAtomic(path, data); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return nil
+}
+
+func (b *fileBackend) Ping(ctx context.Context) error {
+	return nil
+}
+
+func (b *fileBackend) Close() error {
+	return nil
+}
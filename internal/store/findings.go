@@ -0,0 +1,242 @@
+package store
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"time"
+	"weeklysec/internal/trivy"
+)
+
+// Finding lifecycle states. New, Fixed and Reopened are set by scans;
+// Acknowledged and InProgress by people.
+const (
+	StateNew          = "new"
+	StateAcknowledged = "acknowledged"
+	StateInProgress   = "in_progress"
+	StateFixed        = "fixed"
+	StateReopened     = "reopened"
+)
+
+// findingsKind names the findings file of the file backend and the
+// records they were kept in before the findings table.
+const findingsKind = "findings"
+
+// ManualStates are the states a finding can be moved to through the API.
+var ManualStates = []string{StateAcknowledged, StateInProgress}
+
+// Finding tracks one vulnerability in one package of one target across
+// scans.
+type Finding struct {
+	ID              string       `json:"id"`
+	Org             string       `json:"org"`
+	Project         string       `json:"project"`
+	TargetKey       string       `json:"target_key"`
+	TargetID        string       `json:"target_id,omitempty"`
+	Target          string       `json:"target"`
+	VulnerabilityID string       `json:"vulnerability_id"`
+	PkgName         string       `json:"pkg_name"`
+	Severity        string       `json:"severity"`
+	Title           string       `json:"title,omitempty"`
+	FixedVersion    string       `json:"fixed_version,omitempty"`
+	State           string       `json:"state"`
+	FirstSeen       time.Time    `json:"first_seen"`
+	LastSeen        time.Time    `json:"last_seen"`
+	FixedAt         *time.Time   `json:"fixed_at,omitempty"`
+	Reopened        int          `json:"reopened"` // times it came back after a fix
+	LastScanID      string       `json:"last_scan_id"`
+	History         []Transition `json:"history"`
+}
+
+// Transition is one state change.
+type Transition struct {
+	State  string    `json:"state"`
+	At     time.Time `json:"at"`
+	By     string    `json:"by,omitempty"` // empty for changes made by scans
+	Note   string    `json:"note,omitempty"`
+	ScanID string    `json:"scan_id,omitempty"`
+}
+
+// Open reports whether the finding still needs fixing.
+func (f Finding) Open() bool {
+	return f.State != StateFixed
+}
+
+// Transition moves the finding to state and records why.
+func (f *Finding) Transition(state string, at time.Time, by, note, scanID string) {
+	f.State = state
+	f.History = append(f.History, Transition{State: state, At: at, By: by, Note: note, ScanID: scanID})
+}
+
+// Fix is one occurrence of a finding that was fixed: from when it was
+// first seen or reopened to when a scan no longer found it.
+type Fix struct {
+	Opened time.Time
+	Fixed  time.Time
+}
+
+// Duration is how long the occurrence was open.
+func (x Fix) Duration() time.Duration {
+	return x.Fixed.Sub(x.Opened)
+}
+
+// Fixes returns each fixed occurrence of the finding, oldest first.
+func (f Finding) Fixes() []Fix {
+	var out []Fix
+	var opened time.Time
+	for _, t := range f.History {
+		switch t.State {
+		case StateNew, StateReopened:
+			opened = t.At
+		case StateFixed:
+			if !opened.IsZero() {
+				out = append(out, Fix{Opened: opened, Fixed: t.At})
+			}
+		}
+	}
+	return out
+}
+
+// FixDurations returns how long each fixed occurrence of the finding was
+// open, from when it was first seen or reopened to when it was fixed.
+func (f Finding) FixDurations() []time.Duration {
+	var out []time.Duration
+	for _, x := range f.Fixes() {
+		out = append(out, x.Duration())
+	}
+	return out
+}
+
+// FindingFilter narrows ListFindings. Zero values match everything.
+type FindingFilter struct {
+	Org       string
+	Project   string // empty or "*" matches every project of Org
+	TargetKey string
+	Target    string
+	State     string
+	Severity  string
+	OpenOnly  bool
+}
+
+func (f FindingFilter) matches(fd Finding) bool {
+	tf := ScanFilter{Org: f.Org, Project: f.Project}
+	switch {
+	case !tf.matchesTenant(fd.Org, fd.Project),
+		f.TargetKey != "" && fd.TargetKey != f.TargetKey,
+		f.Target != "" && fd.Target != f.Target,
+		f.State != "" && fd.State != f.State,
+		f.Severity != "" && fd.Severity != f.Severity,
+		f.OpenOnly && !fd.Open():
+		return false
+	}
+	return true
+}
+
+func findingID(targetKey string, v trivy.Vulnerability) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s\x00%s\x00%s", targetKey, v.VulnerabilityID, v.PkgName)))
+	return hex.EncodeToString(sum[:16])
+}
+
+// TrackFindings updates the lifecycle of every finding of scan's target:
+// findings seen for the first time are new, fixed ones that reappear are
+// reopened, and open ones missing from the scan are fixed. scan must be the
+// target's most recent scan.
+func (s *Store) TrackFindings(scan *Scan) error {
+	key := scan.TargetKey()
+	at := scan.CreatedAt
+	known := map[string]Finding{}
+	err := s.backend.EachFinding(FindingFilter{TargetKey: key}, func(f Finding) error {
+		known[f.ID] = f
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	var changed []Finding
+	seen := map[string]bool{}
+	for _, v := range scan.Vulnerabilities {
+		id := findingID(key, v)
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+
+		f, ok := known[id]
+		switch {
+		case !ok:
+			f = Finding{
+				ID:              id,
+				Org:             scan.Org,
+				Project:         scan.Project,
+				TargetKey:       key,
+				VulnerabilityID: v.VulnerabilityID,
+				PkgName:         v.PkgName,
+				FirstSeen:       at,
+			}
+			f.Transition(StateNew, at, "", "", scan.ID)
+		case f.State == StateFixed:
+			f.Reopened++
+			f.FixedAt = nil
+			f.Transition(StateReopened, at, "", "", scan.ID)
+		}
+		f.TargetID = scan.TargetID
+		f.Target = scan.Target
+		f.Severity = v.Severity
+		f.Title = v.Title
+		f.FixedVersion = v.FixedVersion
+		f.LastSeen = at
+		f.LastScanID = scan.ID
+		changed = append(changed, f)
+	}
+
+	for _, f := range known {
+		if seen[f.ID] || !f.Open() {
+			continue
+		}
+		fixedAt := at
+		f.FixedAt = &fixedAt
+		f.Transition(StateFixed, at, "", "", scan.ID)
+		changed = append(changed, f)
+	}
+
+	return s.backend.PutFindings(changed)
+}
+
+// GetFinding returns the finding with the given ID.
+func (s *Store) GetFinding(id string) (Finding, error) {
+	return s.backend.GetFinding(id)
+}
+
+// SaveFinding replaces a finding, e.g. after a manual transition.
+func (s *Store) SaveFinding(f Finding) error {
+	return s.backend.PutFindings([]Finding{f})
+}
+
+// EachFinding calls fn with every matching finding, in no particular
+// order, without loading them all at once. It stops at fn's first error
+// and returns it.
+func (s *Store) EachFinding(f FindingFilter, fn func(Finding) error) error {
+	return s.backend.EachFinding(f, fn)
+}
+
+// ListFindings returns matching findings, most severe first, then most
+// recently seen.
+func (s *Store) ListFindings(f FindingFilter) ([]Finding, error) {
+	var out []Finding
+	err := s.backend.EachFinding(f, func(fd Finding) error {
+		out = append(out, fd)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if ri, rj := trivy.SeverityRank(out[i].Severity), trivy.SeverityRank(out[j].Severity); ri != rj {
+			return ri < rj
+		}
+		return out[i].LastSeen.After(out[j].LastSeen)
+	})
+	return out, nil
+}
@@ -0,0 +1,46 @@
+package store
+
+import (
+	"sort"
+	"weeklysec/internal/agent"
+	"weeklysec/internal/tenant"
+)
+
+// SaveGuidance creates or replaces a tenant's guidance.
+func (s *Store) SaveGuidance(g agent.Guidance) error {
+	return s.guidance.put(g.Key(), g)
+}
+
+// GetGuidance returns the guidance of org and project, which may be "*"
+// for the org-wide guidance.
+func (s *Store) GetGuidance(org, project string) (agent.Guidance, error) {
+	return s.guidance.lookup(agent.Guidance{Org: org, Project: project}.Key())
+}
+
+// DeleteGuidance removes the guidance of org and project.
+func (s *Store) DeleteGuidance(org, project string) error {
+	return s.guidance.delete(agent.Guidance{Org: org, Project: project}.Key())
+}
+
+// ListGuidance returns the guidance that applies to a project of org:
+// the org-wide guidance, then the project's. A project of "*" lists the
+// guidance of every project.
+func (s *Store) ListGuidance(org, project string) ([]agent.Guidance, error) {
+	all, err := s.guidance.list()
+	if err != nil {
+		return nil, err
+	}
+	var out []agent.Guidance
+	for _, g := range all {
+		if g.Org == org && (project == tenant.AllProjects || g.Project == project || g.Project == tenant.AllProjects) {
+			out = append(out, g)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if a, b := out[i].Project == tenant.AllProjects, out[j].Project == tenant.AllProjects; a != b {
+			return a
+		}
+		return out[i].Project < out[j].Project
+	})
+	return out, nil
+}
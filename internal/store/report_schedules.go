@@ -0,0 +1,125 @@
+package store
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+// ReportSchedule delivers the digest of a tenant or team on a weekly slot
+// of its own, whatever the schedules of the scans it covers: scans may run
+// nightly while the report lands on Monday morning.
+type ReportSchedule struct {
+	ID      string `json:"id"`
+	Org     string `json:"org"`
+	Project string `json:"project"` // "*" for the whole org
+	Team    string `json:"team,omitempty"`
+	Name    string `json:"name,omitempty"`
+
+	// Delivered every Day at Hour in Timezone, covering the PeriodDays
+	// before.
+	Day        string `json:"day"` // e.g. "monday"
+	Hour       int    `json:"hour"`
+	Timezone   string `json:"timezone"`
+	PeriodDays int    `json:"period_days"`
+	Format     string `json:"format"`           // how the emailed report is rendered
+	Locale     string `json:"locale,omitempty"` // of its fixed strings, REPORT_LOCALE when empty
+
+	// Destinations
+	Email         []string `json:"email,omitempty"`
+	WebhookURL    string   `json:"webhook_url,omitempty"`
+	WebhookSecret string   `json:"webhook_secret,omitempty"` // write-only, see Redacted
+	Chat          bool     `json:"chat,omitempty"`           // post to the configured chat notifiers
+
+	Paused     bool      `json:"paused,omitempty"`
+	NextRun    time.Time `json:"next_run"`
+	LastSentAt time.Time `json:"last_sent_at,omitzero"`
+	LastError  string    `json:"last_error,omitempty"`
+	CreatedBy  string    `json:"created_by,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// Redacted returns s without its webhook secret, for API responses and
+// audit records.
+func (s ReportSchedule) Redacted() ReportSchedule {
+	if s.WebhookSecret != "" {
+		s.WebhookSecret = "redacted"
+	}
+	return s
+}
+
+// Next returns the first delivery slot of s after t. An unknown time zone
+// is taken as UTC.
+func (s ReportSchedule) Next(t time.Time) time.Time {
+	loc, err := time.LoadLocation(s.Timezone)
+	if err != nil {
+		loc = time.UTC
+	}
+	day, _ := ParseWeekday(s.Day)
+	local := t.In(loc)
+	next := time.Date(local.Year(), local.Month(), local.Day(), s.Hour, 0, 0, 0, loc)
+	next = next.AddDate(0, 0, (int(day)-int(next.Weekday())+7)%7)
+	if !next.After(t) {
+		next = next.AddDate(0, 0, 7)
+	}
+	return next.UTC()
+}
+
+// ParseWeekday parses a day name, full or abbreviated to three letters,
+// in any case.
+func ParseWeekday(s string) (time.Weekday, bool) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	for d := time.Sunday; d <= time.Saturday; d++ {
+		name := strings.ToLower(d.String())
+		if s == name || len(s) == 3 && strings.HasPrefix(name, s) {
+			return d, true
+		}
+	}
+	return 0, false
+}
+
+// Period is the span each delivery covers.
+func (s ReportSchedule) Period() time.Duration {
+	return time.Duration(max(s.PeriodDays, 1)) * 24 * time.Hour
+}
+
+// SaveReportSchedule creates or replaces a report schedule.
+func (s *Store) SaveReportSchedule(rs ReportSchedule) error {
+	return s.reportSchedules.put(rs.ID, rs)
+}
+
+// GetReportSchedule returns the report schedule with the given ID.
+func (s *Store) GetReportSchedule(id string) (ReportSchedule, error) {
+	return s.reportSchedules.lookup(id)
+}
+
+// DeleteReportSchedule removes a report schedule.
+func (s *Store) DeleteReportSchedule(id string) error {
+	return s.reportSchedules.delete(id)
+}
+
+// ListReportSchedules returns the report schedules of org visible to
+// project ("" or "*" for every project), by next run. An empty org lists
+// every schedule.
+func (s *Store) ListReportSchedules(org, project string) ([]ReportSchedule, error) {
+	all, err := s.reportSchedules.list()
+	if err != nil {
+		return nil, err
+	}
+	f := ScanFilter{Org: org, Project: project}
+
+	var out []ReportSchedule
+	for _, rs := range all {
+		if f.matchesTenant(rs.Org, rs.Project) {
+			out = append(out, rs)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if !out[i].NextRun.Equal(out[j].NextRun) {
+			return out[i].NextRun.Before(out[j].NextRun)
+		}
+		return out[i].ID < out[j].ID
+	})
+	return out, nil
+}
@@ -0,0 +1,97 @@
+package store
+
+import (
+	"errors"
+	"time"
+)
+
+// MaxRecentFailures bounds ScanStatus.RecentFailures.
+const MaxRecentFailures = 20
+
+// ScanStatus records how the scans of a registered target have gone, so a
+// target that stopped being scanned can be told apart from one that is
+// scanned and clean, along with why. Failed scans are not stored, so this
+// is the only trace of them.
+type ScanStatus struct {
+	TargetID      string     `json:"target_id"`
+	LastAttemptAt time.Time  `json:"last_attempt_at"`
+	LastSuccessAt *time.Time `json:"last_success_at,omitempty"`
+	Failures      int        `json:"failures"`                  // consecutive failed attempts, 0 after a success
+	LastErrorCode string     `json:"last_error_code,omitempty"` // of the last attempt, when it failed
+	LastError     string     `json:"last_error,omitempty"`
+	LastClass     string     `json:"last_failure_class,omitempty"`
+	NextRetryAt   *time.Time `json:"next_retry_at,omitempty"` // when the scheduler tries a failed scan again
+
+	// RecentFailures are the latest failed attempts, oldest first.
+	RecentFailures []ScanFailure `json:"recent_failures,omitempty"`
+}
+
+// ScanFailure is one failed scan attempt.
+type ScanFailure struct {
+	At    time.Time `json:"at"`
+	Code  string    `json:"code"`
+	Class string    `json:"class"` // see the failure package
+	Error string    `json:"error"`
+}
+
+// RecordScanAttempt notes a scan of target at at: a success when failure
+// is nil, else the failure.
+func (s *Store) RecordScanAttempt(targetID string, at time.Time, failure *ScanFailure) error {
+	st, err := s.scanStatus.lookup(targetID)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return err
+	}
+	st.TargetID = targetID
+	st.LastAttemptAt = at
+	st.NextRetryAt = nil
+	if failure == nil {
+		st.LastSuccessAt = &at
+		st.Failures, st.LastErrorCode, st.LastError, st.LastClass = 0, "", "", ""
+	} else {
+		failure.At = at
+		st.Failures++
+		st.LastErrorCode, st.LastError, st.LastClass = failure.Code, failure.Error, failure.Class
+		st.RecentFailures = append(st.RecentFailures, *failure)
+		if len(st.RecentFailures) > MaxRecentFailures {
+			st.RecentFailures = st.RecentFailures[len(st.RecentFailures)-MaxRecentFailures:]
+		}
+	}
+	return s.scanStatus.put(targetID, st)
+}
+
+// ScheduleScanRetry notes when a failed scan of target is tried again.
+func (s *Store) ScheduleScanRetry(targetID string, at time.Time) error {
+	st, err := s.scanStatus.lookup(targetID)
+	if err != nil {
+		return err
+	}
+	st.NextRetryAt = &at
+	return s.scanStatus.put(targetID, st)
+}
+
+// GetScanStatus returns the scan status of a target, or ErrNotFound if
+// it was not scanned since statuses were recorded.
+func (s *Store) GetScanStatus(targetID string) (ScanStatus, error) {
+	return s.scanStatus.lookup(targetID)
+}
+
+// ScanStatuses returns the scan status of every target that has one, by
+// target ID.
+func (s *Store) ScanStatuses() (map[string]ScanStatus, error) {
+	all, err := s.scanStatus.list()
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[string]ScanStatus, len(all))
+	for _, st := range all {
+		out[st.TargetID] = st
+	}
+	return out, nil
+}
+
+func (s *Store) deleteScanStatus(targetID string) error {
+	if err := s.scanStatus.delete(targetID); err != nil && !errors.Is(err, ErrNotFound) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,183 @@
+package store
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Record kinds of the settings and the audit log.
+const (
+	settingsKind = "settings"
+	auditKind    = "audit"
+)
+
+// AuditEntry records a change made through the admin API.
+type AuditEntry struct {
+	Time      time.Time       `json:"time"`
+	Actor     string          `json:"actor"`
+	Action    string          `json:"action"`
+	RequestID string          `json:"request_id,omitempty"`
+	Before    json.RawMessage `json:"before,omitempty"`
+	After     json.RawMessage `json:"after,omitempty"`
+}
+
+// GetSetting decodes the setting stored under key into v. It returns
+// ErrNotFound when the setting has never been saved.
+func (s *Store) GetSetting(key string, v any) error {
+	data, err := s.backend.GetRecord(settingsKind, key)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("failed to decode setting %s: %w", key, err)
+	}
+	return nil
+}
+
+// PutSetting stores v under key.
+func (s *Store) PutSetting(key string, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("failed to encode setting %s: %w", key, err)
+	}
+	return s.backend.PutRecords(settingsKind, map[string][]byte{key: data})
+}
+
+// AppendAudit adds an entry to the append-only audit log.
+func (s *Store) AppendAudit(entry AuditEntry) error {
+	if entry.Time.IsZero() {
+		entry.Time = time.Now().UTC()
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to encode audit entry: %w", err)
+	}
+	return s.backend.PutRecords(auditKind, map[string][]byte{auditID(entry.Time): data})
+}
+
+// auditID orders audit entries by time; the random suffix keeps entries of
+// the same instant, possibly from different replicas, apart.
+func auditID(t time.Time) string {
+	return fmt.Sprintf("%020d-%s", t.UnixNano(), NewID())
+}
+
+// ListAudit returns up to limit audit entries, newest first. A limit of zero
+// returns everything.
+func (s *Store) ListAudit(limit int) ([]AuditEntry, error) {
+	records, err := s.backend.ListRecords(auditKind)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]string, 0, len(records))
+	for id := range records {
+		ids = append(ids, id)
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(ids)))
+	if limit > 0 && len(ids) > limit {
+		ids = ids[:limit]
+	}
+
+	entries := make([]AuditEntry, len(ids))
+	for i, id := range ids {
+		if err := json.Unmarshal(records[id], &entries[i]); err != nil {
+			return nil, fmt.Errorf("failed to decode audit entry %s: %w", id, err)
+		}
+	}
+	return entries, nil
+}
+
+// importSettingFiles copies the settings and audit log that earlier
+// versions kept in files under dir into the backend, each when the backend
+// has none yet.
+func importSettingFiles(b Backend, dir string) error {
+	settings, err := readSettingFiles(filepath.Join(dir, "settings"))
+	if err != nil {
+		return err
+	}
+	if err := importRecords(b, settingsKind, settings); err != nil {
+		return err
+	}
+	audit, err := readAuditFile(filepath.Join(dir, "audit.jsonl"))
+	if err != nil {
+		return err
+	}
+	return importRecords(b, auditKind, audit)
+}
+
+func importRecords(b Backend, kind string, records map[string][]byte) error {
+	if len(records) == 0 {
+		return nil
+	}
+	existing, err := b.ListRecords(kind)
+	if err != nil {
+		return fmt.Errorf("failed to list %s records: %w", kind, err)
+	}
+	if len(existing) > 0 {
+		return nil
+	}
+	if err := b.PutRecords(kind, records); err != nil {
+		return fmt.Errorf("failed to import %s: %w", kind, err)
+	}
+	log.Info().Int("records", len(records)).Str("collection", kind).Msg("Imported records from file")
+	return nil
+}
+
+// readSettingFiles reads the settings of dir by key.
+func readSettingFiles(dir string) (map[string][]byte, error) {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read settings directory: %w", err)
+	}
+	out := map[string][]byte{}
+	for _, e := range entries {
+		key, ok := strings.CutSuffix(e.Name(), ".json")
+		if !ok || e.IsDir() {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, e.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read setting %s: %w", key, err)
+		}
+		out[key] = data
+	}
+	return out, nil
+}
+
+// readAuditFile reads a JSON Lines audit log by audit ID.
+func readAuditFile(path string) (map[string][]byte, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log: %w", err)
+	}
+	defer f.Close()
+
+	out := map[string][]byte{}
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 10*1024*1024)
+	for scanner.Scan() {
+		var e AuditEntry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return nil, fmt.Errorf("failed to decode audit entry: %w", err)
+		}
+		out[auditID(e.Time)] = append([]byte(nil), scanner.Bytes()...)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read audit log: %w", err)
+	}
+	return out, nil
+}
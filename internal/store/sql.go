@@ -0,0 +1,680 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"weeklysec/internal/quota"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+	"github.com/rs/zerolog/log"
+	_ "modernc.org/sqlite"
+)
+
+// sqlBackend stores scans in SQLite or Postgres. Each scan is one row: the
+// columns used for filtering plus the JSON-encoded record, with the raw
+// Trivy output in a column of its own so listings do not read it. The
+// findings have a table of their own, filtered by tenant and target, and
+// so has quota usage, counted up in place; the records of the other
+// collections are rows of the records table.
+type sqlBackend struct {
+	db       *sql.DB
+	postgres bool
+}
+
+const sqlSchema = `
+CREATE TABLE IF NOT EXISTS scans (
+	id          TEXT PRIMARY KEY,
+	org         TEXT NOT NULL,
+	project     TEXT NOT NULL,
+	target_type TEXT NOT NULL,
+	target      TEXT NOT NULL,
+	target_key  TEXT NOT NULL DEFAULT '',
+	created_at  BIGINT NOT NULL,
+	data        TEXT NOT NULL,
+	raw_output  TEXT NOT NULL DEFAULT ''
+);
+CREATE INDEX IF NOT EXISTS scans_tenant_created ON scans (org, project, created_at);
+CREATE INDEX IF NOT EXISTS scans_target ON scans (target);
+CREATE TABLE IF NOT EXISTS records (
+	kind TEXT NOT NULL,
+	id   TEXT NOT NULL,
+	data TEXT NOT NULL,
+	PRIMARY KEY (kind, id)
+);
+CREATE TABLE IF NOT EXISTS findings (
+	id         TEXT PRIMARY KEY,
+	org        TEXT NOT NULL,
+	project    TEXT NOT NULL,
+	target_key TEXT NOT NULL,
+	target     TEXT NOT NULL,
+	state      TEXT NOT NULL,
+	severity   TEXT NOT NULL,
+	data       TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS findings_tenant ON findings (org, project, state);
+CREATE INDEX IF NOT EXISTS findings_target_key ON findings (target_key);
+CREATE TABLE IF NOT EXISTS quota_usage (
+	month      TEXT NOT NULL,
+	scope      TEXT NOT NULL,
+	scans      BIGINT NOT NULL,
+	tokens     BIGINT NOT NULL,
+	updated_at BIGINT NOT NULL,
+	PRIMARY KEY (month, scope)
+);
+`
+
+func openSQLBackend(backend, dsn string) (*sqlBackend, error) {
+	driver := "sqlite"
+	if backend == BackendPostgres {
+		driver = "pgx"
+	}
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s database: %w", backend, err)
+	}
+
+	b := &sqlBackend{db: db, postgres: backend == BackendPostgres}
+	if !b.postgres {
+		// SQLite allows one writer; serializing through a single
+		// connection avoids SQLITE_BUSY under concurrent scans.
+		db.SetMaxOpenConns(1)
+		if _, err := db.Exec(`PRAGMA journal_mode=WAL; PRAGMA busy_timeout=5000`); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("failed to configure sqlite: %w", err)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	for _, stmt := range strings.Split(sqlSchema, ";") {
+		if strings.TrimSpace(stmt) == "" {
+			continue
+		}
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("failed to create %s schema: %w", backend, err)
+		}
+	}
+	if err := b.upgradeScans(ctx); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to upgrade %s schema: %w", backend, err)
+	}
+	return b, nil
+}
+
+// upgradeScans adds the target_key and raw_output columns to a scans
+// table created without them, and fills them in.
+func (b *sqlBackend) upgradeScans(ctx context.Context) error {
+	for _, column := range []string{"target_key", "raw_output"} {
+		if _, err := b.db.ExecContext(ctx, `SELECT `+column+` FROM scans WHERE 1 = 0`); err == nil {
+			continue
+		}
+		if _, err := b.db.ExecContext(ctx, `ALTER TABLE scans ADD COLUMN `+column+` TEXT NOT NULL DEFAULT ''`); err != nil {
+			return err
+		}
+	}
+	if _, err := b.db.ExecContext(ctx, `CREATE INDEX IF NOT EXISTS scans_target_key ON scans (target_key, created_at)`); err != nil {
+		return err
+	}
+
+	// Rewriting a scan sets its target key, so each batch is new rows.
+	for {
+		rows, err := b.db.Query(`SELECT data FROM scans WHERE target_key = '' LIMIT 100`)
+		if err != nil {
+			return err
+		}
+		var scans []*Scan
+		for rows.Next() {
+			var data string
+			if err := rows.Scan(&data); err != nil {
+				rows.Close()
+				return err
+			}
+			scan, err := decodeScan(data)
+			if err != nil {
+				rows.Close()
+				return err
+			}
+			scans = append(scans, scan)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		if len(scans) == 0 {
+			return nil
+		}
+		for _, scan := range scans {
+			if err := b.PutScan(scan); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// rebind rewrites ? placeholders as $n for Postgres.
+func (b *sqlBackend) rebind(query string) string {
+	if !b.postgres {
+		return query
+	}
+	var out strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			out.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		out.WriteRune(r)
+	}
+	return out.String()
+}
+
+func (b *sqlBackend) PutScan(scan *Scan) error {
+	record := *scan
+	record.RawOutput = ""
+	data, err := json.Marshal(&record)
+	if err != nil {
+		return fmt.Errorf("failed to encode scan: %w", err)
+	}
+	query := `
+		INSERT INTO scans (id, org, project, target_type, target, target_key, created_at, data, raw_output)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET
+			org = excluded.org, project = excluded.project, target_type = excluded.target_type,
+			target = excluded.target, target_key = excluded.target_key, created_at = excluded.created_at,
+			data = excluded.data`
+	// A listed scan lacks the output it has; keep the stored one.
+	if !scan.rawOmitted {
+		query += `, raw_output = excluded.raw_output`
+	}
+	_, err = b.db.Exec(b.rebind(query),
+		scan.ID, scan.Org, scan.Project, scan.TargetType, scan.Target, scan.TargetKey(), scan.CreatedAt.UnixNano(),
+		string(data), scan.RawOutput)
+	if err != nil {
+		return fmt.Errorf("failed to write scan: %w", err)
+	}
+	return nil
+}
+
+func (b *sqlBackend) GetScan(id string) (*Scan, error) {
+	var data, raw string
+	err := b.db.QueryRow(b.rebind(`SELECT data, raw_output FROM scans WHERE id = ?`), id).Scan(&data, &raw)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read scan: %w", err)
+	}
+	scan, err := decodeScan(data)
+	if err != nil {
+		return nil, err
+	}
+	scan.RawOutput = raw
+	return scan, nil
+}
+
+func (b *sqlBackend) DeleteScan(id string) error {
+	res, err := b.db.Exec(b.rebind(`DELETE FROM scans WHERE id = ?`), id)
+	if err != nil {
+		return fmt.Errorf("failed to delete scan: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (b *sqlBackend) ListScans(f ScanFilter) ([]*Scan, error) {
+	where := `1=1`
+	var args []any
+	if f.Org != "" {
+		where += ` AND org = ?`
+		args = append(args, f.Org)
+		if f.Project != "" && f.Project != "*" {
+			where += ` AND project = ?`
+			args = append(args, f.Project)
+		}
+	}
+	if f.Target != "" {
+		where += ` AND target = ?`
+		args = append(args, f.Target)
+	}
+	if !f.Since.IsZero() {
+		where += ` AND created_at >= ?`
+		args = append(args, f.Since.UnixNano())
+	}
+
+	const columns = `data, CASE WHEN raw_output <> '' THEN 1 ELSE 0 END AS has_raw, created_at, id`
+	query := `SELECT ` + columns + ` FROM scans WHERE ` + where
+	if f.LatestOnly {
+		query = `SELECT data, has_raw, created_at, id FROM (
+			SELECT ` + columns + `, ROW_NUMBER() OVER (PARTITION BY target_key ORDER BY created_at DESC, id DESC) AS n
+			FROM scans WHERE ` + where + `
+		) latest WHERE n = 1`
+	}
+	query += ` ORDER BY created_at DESC, id DESC`
+	if f.Limit > 0 {
+		query += ` LIMIT ` + strconv.Itoa(f.Limit)
+	}
+
+	rows, err := b.db.Query(b.rebind(query), args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list scans: %w", err)
+	}
+	defer rows.Close()
+
+	var out []*Scan
+	for rows.Next() {
+		var (
+			data, id  string
+			hasRaw    int
+			createdAt int64
+		)
+		if err := rows.Scan(&data, &hasRaw, &createdAt, &id); err != nil {
+			return nil, fmt.Errorf("failed to list scans: %w", err)
+		}
+		scan, err := decodeScan(data)
+		if err != nil {
+			return nil, err
+		}
+		scan.rawOmitted = hasRaw == 1
+		out = append(out, scan)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list scans: %w", err)
+	}
+	return out, nil
+}
+
+func (b *sqlBackend) Orgs() ([]string, error) {
+	rows, err := b.db.Query(`SELECT DISTINCT org FROM scans ORDER BY org`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list orgs: %w", err)
+	}
+	defer rows.Close()
+
+	var out []string
+	for rows.Next() {
+		var org string
+		if err := rows.Scan(&org); err != nil {
+			return nil, fmt.Errorf("failed to list orgs: %w", err)
+		}
+		out = append(out, org)
+	}
+	return out, rows.Err()
+}
+
+func (b *sqlBackend) GetRecord(kind, id string) ([]byte, error) {
+	var data string
+	err := b.db.QueryRow(b.rebind(`SELECT data FROM records WHERE kind = ? AND id = ?`), kind, id).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s record: %w", kind, err)
+	}
+	return []byte(data), nil
+}
+
+func (b *sqlBackend) ListRecords(kind string) (map[string][]byte, error) {
+	rows, err := b.db.Query(b.rebind(`SELECT id, data FROM records WHERE kind = ?`), kind)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list %s records: %w", kind, err)
+	}
+	defer rows.Close()
+
+	out := map[string][]byte{}
+	for rows.Next() {
+		var id, data string
+		if err := rows.Scan(&id, &data); err != nil {
+			return nil, fmt.Errorf("failed to list %s records: %w", kind, err)
+		}
+		out[id] = []byte(data)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list %s records: %w", kind, err)
+	}
+	return out, nil
+}
+
+func (b *sqlBackend) PutRecords(kind string, records map[string][]byte) error {
+	tx, err := b.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to write %s records: %w", kind, err)
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(b.rebind(`
+		INSERT INTO records (kind, id, data) VALUES (?, ?, ?)
+		ON CONFLICT (kind, id) DO UPDATE SET data = excluded.data`))
+	if err != nil {
+		return fmt.Errorf("failed to write %s records: %w", kind, err)
+	}
+	defer stmt.Close()
+	for id, data := range records {
+		if _, err := stmt.Exec(kind, id, string(data)); err != nil {
+			return fmt.Errorf("failed to write %s record: %w", kind, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to write %s records: %w", kind, err)
+	}
+	return nil
+}
+
+func (b *sqlBackend) DeleteRecord(kind, id string) error {
+	res, err := b.db.Exec(b.rebind(`DELETE FROM records WHERE kind = ? AND id = ?`), kind, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete %s record: %w", kind, err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (b *sqlBackend) GetFinding(id string) (Finding, error) {
+	var f Finding
+	var data string
+	err := b.db.QueryRow(b.rebind(`SELECT data FROM findings WHERE id = ?`), id).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return f, ErrNotFound
+	}
+	if err != nil {
+		return f, fmt.Errorf("failed to read finding: %w", err)
+	}
+	if err := json.Unmarshal([]byte(data), &f); err != nil {
+		return f, fmt.Errorf("failed to decode finding %s: %w", id, err)
+	}
+	return f, nil
+}
+
+func (b *sqlBackend) EachFinding(f FindingFilter, fn func(Finding) error) error {
+	where := `1=1`
+	var args []any
+	if f.Org != "" {
+		where += ` AND org = ?`
+		args = append(args, f.Org)
+		if f.Project != "" && f.Project != "*" {
+			where += ` AND project = ?`
+			args = append(args, f.Project)
+		}
+	}
+	for column, value := range map[string]string{
+		"target_key": f.TargetKey, "target": f.Target, "state": f.State, "severity": f.Severity,
+	} {
+		if value != "" {
+			where += ` AND ` + column + ` = ?`
+			args = append(args, value)
+		}
+	}
+	if f.OpenOnly {
+		where += ` AND state <> ?`
+		args = append(args, StateFixed)
+	}
+
+	// Pages are read by ID and closed before fn sees them, so a slow
+	// reader never holds the connection, which is the only one with SQLite.
+	after := ""
+	for {
+		page, err := b.findingPage(where, args, after)
+		if err != nil {
+			return err
+		}
+		for _, fd := range page {
+			if err := fn(fd); err != nil {
+				return err
+			}
+		}
+		if len(page) < findingPageSize {
+			return nil
+		}
+		after = page[len(page)-1].ID
+	}
+}
+
+// findingPageSize is how many findings EachFinding reads at a time.
+const findingPageSize = 500
+
+func (b *sqlBackend) findingPage(where string, args []any, after string) ([]Finding, error) {
+	query := `SELECT id, data FROM findings WHERE ` + where + ` AND id > ? ORDER BY id LIMIT ` + strconv.Itoa(findingPageSize)
+	rows, err := b.db.Query(b.rebind(query), append(args[:len(args):len(args)], after)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list findings: %w", err)
+	}
+	defer rows.Close()
+
+	var out []Finding
+	for rows.Next() {
+		var id, data string
+		if err := rows.Scan(&id, &data); err != nil {
+			return nil, fmt.Errorf("failed to list findings: %w", err)
+		}
+		var fd Finding
+		if err := json.Unmarshal([]byte(data), &fd); err != nil {
+			return nil, fmt.Errorf("failed to decode finding %s: %w", id, err)
+		}
+		out = append(out, fd)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list findings: %w", err)
+	}
+	return out, nil
+}
+
+func (b *sqlBackend) PutFindings(findings []Finding) error {
+	if len(findings) == 0 {
+		return nil
+	}
+	tx, err := b.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to write findings: %w", err)
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(b.rebind(`
+		INSERT INTO findings (id, org, project, target_key, target, state, severity, data)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET
+			org = excluded.org, project = excluded.project, target_key = excluded.target_key,
+			target = excluded.target, state = excluded.state, severity = excluded.severity,
+			data = excluded.data`))
+	if err != nil {
+		return fmt.Errorf("failed to write findings: %w", err)
+	}
+	defer stmt.Close()
+	for _, f := range findings {
+		data, err := json.Marshal(f)
+		if err != nil {
+			return fmt.Errorf("failed to encode finding: %w", err)
+		}
+		if _, err := stmt.Exec(f.ID, f.Org, f.Project, f.TargetKey, f.Target, f.State, f.Severity, string(data)); err != nil {
+			return fmt.Errorf("failed to write finding: %w", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to write findings: %w", err)
+	}
+	return nil
+}
+
+func (b *sqlBackend) GetUsage(month, scope string) (quota.Usage, error) {
+	u := quota.Usage{Month: month, Scope: scope}
+	var updatedAt int64
+	err := b.db.QueryRow(b.rebind(`SELECT scans, tokens, updated_at FROM quota_usage WHERE month = ? AND scope = ?`), month, scope).
+		Scan(&u.Scans, &u.Tokens, &updatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return u, nil
+	}
+	if err != nil {
+		return u, fmt.Errorf("failed to read usage: %w", err)
+	}
+	u.UpdatedAt = time.Unix(0, updatedAt).UTC()
+	return u, nil
+}
+
+func (b *sqlBackend) ListUsage(month string) ([]quota.Usage, error) {
+	rows, err := b.db.Query(b.rebind(`SELECT scope, scans, tokens, updated_at FROM quota_usage WHERE month = ?`), month)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list usage: %w", err)
+	}
+	defer rows.Close()
+
+	var out []quota.Usage
+	for rows.Next() {
+		u := quota.Usage{Month: month}
+		var updatedAt int64
+		if err := rows.Scan(&u.Scope, &u.Scans, &u.Tokens, &updatedAt); err != nil {
+			return nil, fmt.Errorf("failed to list usage: %w", err)
+		}
+		u.UpdatedAt = time.Unix(0, updatedAt).UTC()
+		out = append(out, u)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list usage: %w", err)
+	}
+	return out, nil
+}
+
+func (b *sqlBackend) AddUsage(month, scope string, scans, tokens int, at time.Time) (quota.Usage, error) {
+	u := quota.Usage{Month: month, Scope: scope, UpdatedAt: at}
+	err := b.db.QueryRow(b.rebind(`
+		INSERT INTO quota_usage (month, scope, scans, tokens, updated_at) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (month, scope) DO UPDATE SET
+			scans = quota_usage.scans + excluded.scans, tokens = quota_usage.tokens + excluded.tokens,
+			updated_at = excluded.updated_at
+		RETURNING scans, tokens`), month, scope, scans, tokens, at.UnixNano()).Scan(&u.Scans, &u.Tokens)
+	if err != nil {
+		return u, fmt.Errorf("failed to add usage: %w", err)
+	}
+	return u, nil
+}
+
+// legacyRecords returns the records of kind that earlier versions kept in
+// the records table or, failing that, in the file backend's file under
+// dir, and where they came from.
+func (b *sqlBackend) legacyRecords(dir, kind string) (map[string][]byte, string, error) {
+	records, err := b.ListRecords(kind)
+	if err != nil || len(records) > 0 {
+		return records, "records", err
+	}
+	files, err := readRecordFile(dir, kind)
+	if err != nil {
+		return nil, "", err
+	}
+	for id, data := range files {
+		records[id] = data
+	}
+	return records, "file", nil
+}
+
+// importFindings moves the findings earlier versions kept as records into
+// the findings table when it is empty.
+func (b *sqlBackend) importFindings(dir string) error {
+	var n int
+	if err := b.db.QueryRow(`SELECT COUNT(*) FROM findings`).Scan(&n); err != nil {
+		return fmt.Errorf("failed to count findings: %w", err)
+	}
+	if n > 0 {
+		return nil
+	}
+	records, source, err := b.legacyRecords(dir, findingsKind)
+	if err != nil || len(records) == 0 {
+		return err
+	}
+
+	findings := make([]Finding, 0, len(records))
+	for id, data := range records {
+		var f Finding
+		if err := json.Unmarshal(data, &f); err != nil {
+			return fmt.Errorf("failed to decode finding %s: %w", id, err)
+		}
+		findings = append(findings, f)
+	}
+	if err := b.PutFindings(findings); err != nil {
+		return fmt.Errorf("failed to import findings: %w", err)
+	}
+	if _, err := b.db.Exec(b.rebind(`DELETE FROM records WHERE kind = ?`), findingsKind); err != nil {
+		return fmt.Errorf("failed to remove imported findings: %w", err)
+	}
+	log.Info().Int("findings", len(findings)).Str("source", source).Msg("Imported findings")
+	return nil
+}
+
+// importUsage moves the quota usage earlier versions kept as records into
+// the usage table when it is empty.
+func (b *sqlBackend) importUsage(dir string) error {
+	var n int
+	if err := b.db.QueryRow(`SELECT COUNT(*) FROM quota_usage`).Scan(&n); err != nil {
+		return fmt.Errorf("failed to count usage: %w", err)
+	}
+	if n > 0 {
+		return nil
+	}
+	records, source, err := b.legacyRecords(dir, usageKind)
+	if err != nil || len(records) == 0 {
+		return err
+	}
+
+	tx, err := b.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to import usage: %w", err)
+	}
+	defer tx.Rollback()
+	for id, data := range records {
+		var u quota.Usage
+		if err := json.Unmarshal(data, &u); err != nil {
+			return fmt.Errorf("failed to decode usage %s: %w", id, err)
+		}
+		_, err := tx.Exec(b.rebind(`INSERT INTO quota_usage (month, scope, scans, tokens, updated_at) VALUES (?, ?, ?, ?, ?)`),
+			u.Month, u.Scope, u.Scans, u.Tokens, u.UpdatedAt.UnixNano())
+		if err != nil {
+			return fmt.Errorf("failed to import usage: %w", err)
+		}
+	}
+	if _, err := tx.Exec(b.rebind(`DELETE FROM records WHERE kind = ?`), usageKind); err != nil {
+		return fmt.Errorf("failed to remove imported usage: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to import usage: %w", err)
+	}
+	log.Info().Int("scopes", len(records)).Str("source", source).Msg("Imported quota usage")
+	return nil
+}
+
+// countRecords returns the number of stored records of a collection.
+func (b *sqlBackend) countRecords(kind string) (int, error) {
+	var n int
+	err := b.db.QueryRow(b.rebind(`SELECT COUNT(*) FROM records WHERE kind = ?`), kind).Scan(&n)
+	return n, err
+}
+
+// count returns the number of stored scans.
+func (b *sqlBackend) count() (int, error) {
+	var n int
+	err := b.db.QueryRow(`SELECT COUNT(*) FROM scans`).Scan(&n)
+	return n, err
+}
+
+func (b *sqlBackend) Ping(ctx context.Context) error {
+	return b.db.PingContext(ctx)
+}
+
+func (b *sqlBackend) Close() error {
+	return b.db.Close()
+}
+
+func decodeScan(data string) (*Scan, error) {
+	var scan Scan
+	if err := json.Unmarshal([]byte(data), &scan); err != nil {
+		return nil, fmt.Errorf("failed to decode scan: %w", err)
+	}
+	return &scan, nil
+}
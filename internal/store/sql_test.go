@@ -0,0 +1,515 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"weeklysec/internal/trivy"
+)
+
+func openTestSQL(t *testing.T) *sqlBackend {
+	t.Helper()
+	b, err := openSQLBackend(BackendSQLite, filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { b.Close() })
+	return b
+}
+
+func TestSQLBackendPutScanUpdatesColumns(t *testing.T) {
+	b := openTestSQL(t)
+	created := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	scan := &Scan{ID: "s1", Org: "acme", Project: "web", TargetType: "image", Target: "nginx:1.25", CreatedAt: created}
+	if err := b.PutScan(scan); err != nil {
+		t.Fatal(err)
+	}
+	moved := *scan
+	moved.Org, moved.Project, moved.Target, moved.CreatedAt = "globex", "api", "nginx:1.27", created.Add(time.Hour)
+	if err := b.PutScan(&moved); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		filter ScanFilter
+		want   int
+	}{
+		{"old target", ScanFilter{Target: "nginx:1.25"}, 0},
+		{"new target", ScanFilter{Target: "nginx:1.27"}, 1},
+		{"old tenant", ScanFilter{Org: "acme"}, 0},
+		{"new tenant", ScanFilter{Org: "globex", Project: "api"}, 1},
+		{"since the new time", ScanFilter{Since: created.Add(time.Hour)}, 1},
+		{"after the new time", ScanFilter{Since: created.Add(2 * time.Hour)}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scans, err := b.ListScans(tt.filter)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(scans) != tt.want {
+				t.Fatalf("got %d scans, want %d", len(scans), tt.want)
+			}
+		})
+	}
+
+	orgs, err := b.Orgs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(orgs) != 1 || orgs[0] != "globex" {
+		t.Fatalf("Orgs() = %v, want [globex]", orgs)
+	}
+}
+
+func TestSQLBackendRecords(t *testing.T) {
+	b := openTestSQL(t)
+	if err := b.PutRecords("targets", map[string][]byte{"t1": []byte(`{"id":"t1"}`), "t2": []byte(`{"id":"t2"}`)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.PutRecords("targets", map[string][]byte{"t1": []byte(`{"id":"t1","name":"web"}`)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.PutRecords("tickets", map[string][]byte{"t1": []byte(`{"id":"ticket"}`)}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		kind    string
+		id      string
+		want    string
+		wantErr error
+	}{
+		{"updated", "targets", "t1", `{"id":"t1","name":"web"}`, nil},
+		{"untouched", "targets", "t2", `{"id":"t2"}`, nil},
+		{"same ID, other kind", "tickets", "t1", `{"id":"ticket"}`, nil},
+		{"missing", "targets", "t3", "", ErrNotFound},
+		{"missing kind", "watches", "t1", "", ErrNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := b.GetRecord(tt.kind, tt.id)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("GetRecord() error = %v, want %v", err, tt.wantErr)
+			}
+			if string(data) != tt.want {
+				t.Fatalf("GetRecord() = %s, want %s", data, tt.want)
+			}
+		})
+	}
+
+	records, err := b.ListRecords("targets")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("ListRecords() returned %d records, want 2", len(records))
+	}
+	if err := b.DeleteRecord("targets", "t1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.DeleteRecord("targets", "t1"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("second DeleteRecord() error = %v, want ErrNotFound", err)
+	}
+	if _, err := b.GetRecord("tickets", "t1"); err != nil {
+		t.Fatalf("deleting a target removed a ticket: %v", err)
+	}
+}
+
+func TestOpenImportsRecordFiles(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"targets.json": `{"t1":{"id":"t1","org":"acme","project":"web","target_type":"image","target":"nginx"}}`,
+		"tickets.json": `{}`,
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0o640); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, backend := range []string{BackendSQLite, BackendFile} {
+		t.Run(backend, func(t *testing.T) {
+			s, err := Open(Options{Dir: dir, Backend: backend})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer s.Close()
+
+			got, err := s.GetTarget("t1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Org != "acme" || got.Target != "nginx" {
+				t.Fatalf("GetTarget() = %+v", got)
+			}
+			if _, err := s.GetTarget("t2"); !errors.Is(err, ErrNotFound) {
+				t.Fatalf("GetTarget(t2) error = %v, want ErrNotFound", err)
+			}
+			if err := s.SaveTarget(Target{ID: "t2", Org: "acme", Project: "web"}); err != nil {
+				t.Fatal(err)
+			}
+			if got, err := s.ListTargets(TargetFilter{Org: "acme"}); err != nil || len(got) != 2 {
+				t.Fatalf("ListTargets() = %d targets, %v, want 2", len(got), err)
+			}
+			if err := s.DeleteTarget("t2"); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestSettingsAndAuditAreSharedThroughTheDatabase(t *testing.T) {
+	dsn := filepath.Join(t.TempDir(), "shared.db")
+	legacy := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(legacy, "settings"), 0o750); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(legacy, "settings", "policy.json"), []byte(`{"rules":1}`), 0o640); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	if err := os.WriteFile(filepath.Join(legacy, "audit.jsonl"), []byte(`{"time":"`+old.Format(time.RFC3339)+`","actor":"alice","action":"policy.update"}`+"\n"), 0o640); err != nil {
+		t.Fatal(err)
+	}
+
+	a, err := Open(Options{Dir: legacy, DSN: dsn})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+	b, err := Open(Options{Dir: t.TempDir(), DSN: dsn})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	var got struct{ Rules int }
+	if err := b.GetSetting("policy", &got); err != nil || got.Rules != 1 {
+		t.Fatalf("GetSetting() = %+v, %v, want the imported setting", got, err)
+	}
+	if err := a.PutSetting("policy", map[string]int{"rules": 2}); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.GetSetting("policy", &got); err != nil || got.Rules != 2 {
+		t.Fatalf("GetSetting() = %+v, %v, want the other replica's write", got, err)
+	}
+	if err := b.GetSetting("missing", &got); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("GetSetting(missing) error = %v, want ErrNotFound", err)
+	}
+
+	for _, actor := range []string{"bob", "carol"} {
+		if err := a.AppendAudit(AuditEntry{Actor: actor, Action: "scoring.update"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	entries, err := b.ListAudit(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var actors []string
+	for _, e := range entries {
+		actors = append(actors, e.Actor)
+	}
+	if strings.Join(actors, ",") != "carol,bob,alice" {
+		t.Fatalf("ListAudit() actors = %v, want newest first", actors)
+	}
+	if entries, err := b.ListAudit(1); err != nil || len(entries) != 1 || entries[0].Actor != "carol" {
+		t.Fatalf("ListAudit(1) = %+v, %v", entries, err)
+	}
+}
+
+func TestListScansLatestOnly(t *testing.T) {
+	at := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	scans := []*Scan{
+		{ID: strings.Repeat("a", 32), TargetID: "tg1", Org: "acme", Project: "web", TargetType: "image", Target: "nginx:1.25", CreatedAt: at, RawOutput: `{"a":1}`},
+		{ID: strings.Repeat("b", 32), TargetID: "tg1", Org: "acme", Project: "web", TargetType: "image", Target: "nginx:1.27", CreatedAt: at.Add(time.Hour), RawOutput: `{"b":1}`},
+		{ID: strings.Repeat("c", 32), Org: "acme", Project: "web", TargetType: "image", Target: "nginx:1.25", CreatedAt: at.Add(2 * time.Hour)},
+		{ID: strings.Repeat("d", 32), Org: "globex", Project: "api", TargetType: "image", Target: "nginx:1.25", CreatedAt: at.Add(3 * time.Hour), RawOutput: `{"d":1}`},
+	}
+	for _, backend := range []string{BackendSQLite, BackendFile} {
+		t.Run(backend, func(t *testing.T) {
+			s, err := Open(Options{Dir: t.TempDir(), Backend: backend})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer s.Close()
+			for _, scan := range scans {
+				copied := *scan
+				if err := s.SaveScan(&copied); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			tests := []struct {
+				filter ScanFilter
+				want   string
+			}{
+				{ScanFilter{LatestOnly: true}, "d,c,b"},
+				{ScanFilter{LatestOnly: true, Limit: 2}, "d,c"},
+				{ScanFilter{Org: "acme", LatestOnly: true}, "c,b"},
+				{ScanFilter{Limit: 3}, "d,c,b"},
+			}
+			for _, tt := range tests {
+				got, err := s.ListScans(tt.filter)
+				if err != nil {
+					t.Fatal(err)
+				}
+				var ids []string
+				for _, scan := range got {
+					ids = append(ids, scan.ID[:1])
+					if scan.RawOutput != "" {
+						t.Fatalf("ListScans() returned the raw output of %s", scan.ID)
+					}
+				}
+				if strings.Join(ids, ",") != tt.want {
+					t.Errorf("ListScans(%+v) = %v, want %s", tt.filter, ids, tt.want)
+				}
+			}
+
+			listed, err := s.ListScans(ScanFilter{Org: "globex"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !listed[0].HasRawOutput() {
+				t.Fatal("listed scan does not report its raw output")
+			}
+			if raw, err := s.RawOutput(context.Background(), listed[0]); err != nil || raw != `{"d":1}` {
+				t.Fatalf("RawOutput() = %q, %v", raw, err)
+			}
+			listed[0].Summary = "resaved"
+			if err := s.SaveScan(listed[0]); err != nil {
+				t.Fatal(err)
+			}
+			if got, err := s.GetScan(strings.Repeat("d", 32)); err != nil || got.RawOutput != `{"d":1}` || got.Summary != "resaved" {
+				t.Fatalf("GetScan() after saving a listed scan = %+v, %v", got, err)
+			}
+		})
+	}
+}
+
+func TestSQLBackendUpgradesScans(t *testing.T) {
+	dsn := filepath.Join(t.TempDir(), "old.db")
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := json.Marshal(Scan{ID: "s1", TargetID: "tg1", Org: "acme", Project: "web", Target: "nginx", RawOutput: `{"Results":[]}`})
+	for _, stmt := range []string{
+		`CREATE TABLE scans (id TEXT PRIMARY KEY, org TEXT NOT NULL, project TEXT NOT NULL, target_type TEXT NOT NULL,
+			target TEXT NOT NULL, created_at BIGINT NOT NULL, data TEXT NOT NULL)`,
+		`INSERT INTO scans VALUES ('s1', 'acme', 'web', 'image', 'nginx', 1, '` + string(data) + `')`,
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	db.Close()
+
+	b, err := openSQLBackend(BackendSQLite, dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+	var key, raw, stored string
+	if err := b.db.QueryRow(`SELECT target_key, raw_output, data FROM scans WHERE id = 's1'`).Scan(&key, &raw, &stored); err != nil {
+		t.Fatal(err)
+	}
+	if key != "tg1" || raw != `{"Results":[]}` || strings.Contains(stored, "Results") {
+		t.Fatalf("upgraded row: target_key %q, raw_output %q, data %s", key, raw, stored)
+	}
+	if scan, err := b.GetScan("s1"); err != nil || scan.RawOutput != `{"Results":[]}` {
+		t.Fatalf("GetScan() = %+v, %v", scan, err)
+	}
+}
+
+func TestListFindingsFiltersByTenantAndTarget(t *testing.T) {
+	at := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	vulns := []trivy.Vulnerability{
+		{VulnerabilityID: "CVE-2024-1", PkgName: "openssl", Severity: "HIGH"},
+		{VulnerabilityID: "CVE-2024-2", PkgName: "zlib", Severity: "CRITICAL"},
+	}
+	for _, backend := range []string{BackendSQLite, BackendFile} {
+		t.Run(backend, func(t *testing.T) {
+			s, err := Open(Options{Dir: t.TempDir(), Backend: backend})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer s.Close()
+			for _, scan := range []*Scan{
+				{ID: "s1", Org: "acme", Project: "web", TargetType: "image", Target: "nginx", CreatedAt: at, Vulnerabilities: vulns},
+				{ID: "s2", Org: "acme", Project: "api", TargetType: "image", Target: "redis", CreatedAt: at, Vulnerabilities: vulns[:1]},
+				{ID: "s3", Org: "globex", Project: "web", TargetType: "image", Target: "nginx", CreatedAt: at, Vulnerabilities: vulns},
+				{ID: "s4", Org: "acme", Project: "web", TargetType: "image", Target: "nginx", CreatedAt: at.Add(time.Hour), Vulnerabilities: vulns[1:]},
+			} {
+				if err := s.TrackFindings(scan); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			tests := []struct {
+				filter FindingFilter
+				want   int
+			}{
+				{FindingFilter{}, 5},
+				{FindingFilter{Org: "acme"}, 3},
+				{FindingFilter{Org: "acme", Project: "*"}, 3},
+				{FindingFilter{Org: "acme", Project: "web"}, 2},
+				{FindingFilter{Org: "acme", Project: "web", OpenOnly: true}, 1},
+				{FindingFilter{Org: "acme", State: StateFixed}, 1},
+				{FindingFilter{Target: "nginx", Severity: "CRITICAL"}, 2},
+				{FindingFilter{TargetKey: (&Scan{Org: "acme", Project: "api", TargetType: "image", Target: "redis"}).TargetKey()}, 1},
+			}
+			for _, tt := range tests {
+				got, err := s.ListFindings(tt.filter)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(got) != tt.want {
+					t.Errorf("ListFindings(%+v) = %d findings, want %d", tt.filter, len(got), tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestOpenMovesFindingRecordsToTheirTable(t *testing.T) {
+	dsn := filepath.Join(t.TempDir(), "old.db")
+	b, err := openSQLBackend(BackendSQLite, dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := Finding{ID: "f1", Org: "acme", Project: "web", TargetKey: "k1", Target: "nginx", State: StateNew, Severity: "HIGH"}
+	data, err := json.Marshal(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := b.PutRecords(findingsKind, map[string][]byte{f.ID: data}); err != nil {
+		t.Fatal(err)
+	}
+	b.Close()
+
+	s, err := Open(Options{Dir: t.TempDir(), DSN: dsn})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	got, err := s.ListFindings(FindingFilter{Org: "acme", TargetKey: "k1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0].ID != "f1" {
+		t.Fatalf("ListFindings() = %+v, want the imported finding", got)
+	}
+	if n, err := s.backend.(*sqlBackend).countRecords(findingsKind); err != nil || n != 0 {
+		t.Fatalf("%d finding records left, %v", n, err)
+	}
+}
+
+func TestAddUsageCountsConcurrentWrites(t *testing.T) {
+	for _, backend := range []string{BackendSQLite, BackendFile} {
+		t.Run(backend, func(t *testing.T) {
+			s, err := Open(Options{Dir: t.TempDir(), Backend: backend})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer s.Close()
+
+			at := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+			var wg sync.WaitGroup
+			for range 10 {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					if _, err := s.AddUsage("2026-03", "acme", 1, 100, at); err != nil {
+						t.Error(err)
+					}
+				}()
+			}
+			wg.Wait()
+
+			u, err := s.GetUsage("2026-03", "acme")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if u.Scans != 10 || u.Tokens != 1000 || !u.UpdatedAt.Equal(at) {
+				t.Fatalf("GetUsage() = %+v, want 10 scans and 1000 tokens", u)
+			}
+			if u, err := s.GetUsage("2026-03", "globex"); err != nil || u.Scans != 0 || u.Scope != "globex" {
+				t.Fatalf("GetUsage() of an unmetered scope = %+v, %v", u, err)
+			}
+			if all, err := s.ListUsage("2026-03"); err != nil || len(all) != 1 {
+				t.Fatalf("ListUsage() = %+v, %v", all, err)
+			}
+		})
+	}
+}
+
+func TestOpenImportsUsageFile(t *testing.T) {
+	dir := t.TempDir()
+	data := `{"2026-03|acme":{"scope":"acme","month":"2026-03","scans":4,"tokens":2000,"cost":0.04,"updated_at":"2026-03-02T00:00:00Z"}}`
+	if err := os.WriteFile(filepath.Join(dir, "usage.json"), []byte(data), 0o640); err != nil {
+		t.Fatal(err)
+	}
+	s, err := Open(Options{Dir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	u, err := s.AddUsage("2026-03", "acme", 1, 0, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Scans != 5 || u.Tokens != 2000 {
+		t.Fatalf("AddUsage() after the import = %+v, want 5 scans and 2000 tokens", u)
+	}
+}
+
+func TestSQLBackendEachFindingPages(t *testing.T) {
+	b := openTestSQL(t)
+	var findings []Finding
+	for i := range 2*findingPageSize + 1 {
+		org := "acme"
+		if i%2 == 1 {
+			org = "globex"
+		}
+		findings = append(findings, Finding{ID: fmt.Sprintf("f%04d", i), Org: org, Project: "web", TargetKey: "k", Target: "nginx", State: StateNew})
+	}
+	if err := b.PutFindings(findings); err != nil {
+		t.Fatal(err)
+	}
+
+	for filter, want := range map[FindingFilter]int{{}: len(findings), {Org: "acme"}: findingPageSize + 1} {
+		seen := map[string]bool{}
+		err := b.EachFinding(filter, func(f Finding) error {
+			seen[f.ID] = true
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(seen) != want {
+			t.Errorf("EachFinding(%+v) saw %d findings, want %d", filter, len(seen), want)
+		}
+	}
+
+	stop := errors.New("stop")
+	n := 0
+	err := b.EachFinding(FindingFilter{}, func(Finding) error {
+		n++
+		return stop
+	})
+	if !errors.Is(err, stop) || n != 1 {
+		t.Fatalf("EachFinding() = %v after %d findings, want to stop at the first", err, n)
+	}
+}
@@ -0,0 +1,437 @@
+package store
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"time"
+	"weeklysec/internal/agent"
+	"weeklysec/internal/trivy"
+	"weeklysec/internal/watch"
+
+	"github.com/rs/zerolog/log"
+)
+
+// ErrNotFound is returned when a record does not exist.
+var ErrNotFound = errors.New("not found")
+
+// Records saved before multi-tenancy belong to the default tenant.
+const (
+	defaultOrg     = "default"
+	defaultProject = "default"
+)
+
+// Scan is a persisted scan run.
+type Scan struct {
+	ID              string                `json:"id"`
+	TargetID        string                `json:"target_id,omitempty"` // inventory entry that was scanned, if any
+	Org             string                `json:"org"`
+	Project         string                `json:"project"`
+	TargetType      string                `json:"target_type"`
+	Target          string                `json:"target"`
+	CreatedAt       time.Time             `json:"created_at"`
+	Summary         string                `json:"summary,omitempty"`
+	Vulnerabilities []trivy.Vulnerability `json:"vulnerabilities"`
+	RawOutput       string                `json:"raw_output,omitempty"`
+	RawOutputKey    string                `json:"raw_output_key,omitempty"` // blob holding RawOutput once offloaded
+	Response        *agent.AgentResponse  `json:"response,omitempty"`
+	Exchanges       []agent.Exchange      `json:"llm_exchanges,omitempty"` // the LLM calls behind Response
+
+	// History holds earlier analyses of the same raw output, newest last.
+	History []*agent.AgentResponse `json:"history,omitempty"`
+
+	rawOmitted bool // ListScans left out the RawOutput the scan has
+}
+
+// HasRawOutput reports whether the scan kept its Trivy output, including
+// when a listing left it out.
+func (s *Scan) HasRawOutput() bool {
+	return s.RawOutput != "" || s.RawOutputKey != "" || s.rawOmitted
+}
+
+// TargetKey identifies the target a scan belongs to: its inventory entry
+// when it has one, otherwise its owner, type and reference.
+func (s *Scan) TargetKey() string {
+	if s.TargetID != "" {
+		return s.TargetID
+	}
+	return s.Org + "/" + s.Project + "|" + s.TargetType + "|" + s.Target
+}
+
+// MaxHistory bounds Scan.History.
+const MaxHistory = 10
+
+// ReplaceResponse makes resp the scan's current analysis and moves the
+// previous one into the history.
+func (s *Scan) ReplaceResponse(resp *agent.AgentResponse) {
+	if s.Response != nil {
+		s.History = append(slices.Clone(s.History), s.Response)
+		if len(s.History) > MaxHistory {
+			s.History = s.History[len(s.History)-MaxHistory:]
+		}
+	}
+	s.Response = resp
+	s.Exchanges = resp.Exchanges
+	s.Summary = resp.Summary
+	s.Vulnerabilities = resp.Vulnerabilities
+}
+
+// ScanFilter narrows ListScans. Zero values match everything.
+type ScanFilter struct {
+	Org        string
+	Project    string // empty or "*" matches every project of Org
+	Target     string
+	Since      time.Time
+	LatestOnly bool // keep only the most recent scan per target
+	Limit      int
+}
+
+func (f ScanFilter) matchesTenant(org, project string) bool {
+	if f.Org == "" {
+		return true
+	}
+	return org == f.Org && (f.Project == "" || f.Project == "*" || project == f.Project)
+}
+
+// Options configures Open.
+type Options struct {
+	Dir     string    // data directory for metadata, and for scans with the file backend
+	Backend string    // BackendSQLite (default), BackendPostgres or BackendFile
+	DSN     string    // database location; defaults to Dir/weeklysec.db for SQLite
+	Blobs   BlobStore // optional; raw Trivy output and reports go here when set
+}
+
+// Store persists scans, its collections, settings and the audit log
+// through a Backend.
+type Store struct {
+	dir     string
+	backend Backend
+	blobs   BlobStore
+
+	suppressions *collection[agent.Suppression]
+	overrides    *collection[agent.SeverityOverride]
+	watches      *collection[watch.Subscription]
+	feedback     *collection[agent.Feedback]
+	targets      *collection[Target]
+	tickets      *collection[Ticket]
+	guidance     *collection[agent.Guidance]
+
+	reportSchedules *collection[ReportSchedule]
+	scanStatus      *collection[ScanStatus]
+}
+
+// Open opens the configured backend, creating the data directory if needed.
+// A new SQL database is seeded with any scans and collections left by the
+// file backend.
+func Open(opts Options) (*Store, error) {
+	if err := os.MkdirAll(opts.Dir, 0o750); err != nil {
+		return nil, fmt.Errorf("failed to create data directory: %w", err)
+	}
+	scanDir := filepath.Join(opts.Dir, "scans")
+
+	s := &Store{dir: opts.Dir, blobs: opts.Blobs}
+
+	switch opts.Backend {
+	case BackendFile:
+		b, err := openFileBackend(scanDir, opts.Dir)
+		if err != nil {
+			return nil, err
+		}
+		s.backend = b
+	case "", BackendSQLite, BackendPostgres:
+		backend, dsn := opts.Backend, opts.DSN
+		if backend == "" {
+			backend = BackendSQLite
+		}
+		if dsn == "" {
+			if backend == BackendPostgres {
+				return nil, fmt.Errorf("a DSN is required for the postgres backend")
+			}
+			dsn = filepath.Join(opts.Dir, "weeklysec.db")
+		}
+		b, err := openSQLBackend(backend, dsn)
+		if err != nil {
+			return nil, err
+		}
+		if err := importScanFiles(b, scanDir); err != nil {
+			b.Close()
+			return nil, err
+		}
+		if err := importRecordFiles(b, opts.Dir); err != nil {
+			b.Close()
+			return nil, err
+		}
+		if err := b.importFindings(opts.Dir); err != nil {
+			b.Close()
+			return nil, err
+		}
+		if err := b.importUsage(opts.Dir); err != nil {
+			b.Close()
+			return nil, err
+		}
+		s.backend = b
+	default:
+		return nil, fmt.Errorf("unknown store backend %q", opts.Backend)
+	}
+	if err := importSettingFiles(s.backend, opts.Dir); err != nil {
+		s.backend.Close()
+		return nil, err
+	}
+
+	s.suppressions = openCollection[agent.Suppression](s.backend, "suppressions")
+	s.overrides = openCollection[agent.SeverityOverride](s.backend, "severity_overrides")
+	s.watches = openCollection[watch.Subscription](s.backend, "watches")
+	s.feedback = openCollection[agent.Feedback](s.backend, "feedback")
+	s.targets = openCollection[Target](s.backend, "targets")
+	s.tickets = openCollection[Ticket](s.backend, "tickets")
+	s.guidance = openCollection[agent.Guidance](s.backend, "guidance")
+	s.reportSchedules = openCollection[ReportSchedule](s.backend, "report_schedules")
+	s.scanStatus = openCollection[ScanStatus](s.backend, "scan_status")
+	return s, nil
+}
+
+// importScanFiles copies file-backend scans into an empty database.
+func importScanFiles(b *sqlBackend, dir string) error {
+	n, err := b.count()
+	if err != nil {
+		return fmt.Errorf("failed to count scans: %w", err)
+	}
+	if n > 0 {
+		return nil
+	}
+	scans, err := readScanFiles(dir)
+	if err != nil {
+		return err
+	}
+	for _, scan := range scans {
+		if err := b.PutScan(scan); err != nil {
+			return fmt.Errorf("failed to import scan %s: %w", scan.ID, err)
+		}
+	}
+	if len(scans) > 0 {
+		log.Info().Int("scans", len(scans)).Str("dir", dir).Msg("Imported scans from files")
+	}
+	return nil
+}
+
+// recordKinds are the collections of the store, named after the files the
+// file backend keeps them in.
+var recordKinds = []string{
+	"suppressions", "severity_overrides", "watches", "feedback", "targets",
+	"tickets", "guidance", "report_schedules", "scan_status",
+}
+
+// importRecordFiles copies the collections left by the file backend into
+// the database, each one whose table rows are still empty.
+func importRecordFiles(b *sqlBackend, dir string) error {
+	for _, kind := range recordKinds {
+		n, err := b.countRecords(kind)
+		if err != nil {
+			return fmt.Errorf("failed to count %s records: %w", kind, err)
+		}
+		if n > 0 {
+			continue
+		}
+		records, err := readRecordFile(dir, kind)
+		if err != nil {
+			return err
+		}
+		if len(records) == 0 {
+			continue
+		}
+		batch := make(map[string][]byte, len(records))
+		for id, data := range records {
+			batch[id] = data
+		}
+		if err := b.PutRecords(kind, batch); err != nil {
+			return fmt.Errorf("failed to import %s: %w", kind, err)
+		}
+		log.Info().Int("records", len(records)).Str("collection", kind).Msg("Imported records from file")
+	}
+	return nil
+}
+
+// Close releases the backend.
+func (s *Store) Close() error {
+	return s.backend.Close()
+}
+
+// SaveScan persists scan, assigning an ID and timestamp when missing. With
+// a blob store, the raw Trivy output is uploaded there and the record only
+// keeps its key.
+func (s *Store) SaveScan(scan *Scan) error {
+	if scan.ID == "" {
+		scan.ID = NewID()
+	}
+	if !ValidID(scan.ID) {
+		return fmt.Errorf("invalid scan id %q", scan.ID)
+	}
+	if scan.CreatedAt.IsZero() {
+		scan.CreatedAt = time.Now().UTC()
+	}
+
+	record := scan
+	if s.blobs != nil && scan.RawOutput != "" {
+		key := "scans/" + scan.ID + "/trivy.json"
+		if err := s.blobs.Put(context.Background(), key, []byte(scan.RawOutput), "application/json"); err != nil {
+			return err
+		}
+		copied := *scan
+		copied.RawOutput, copied.RawOutputKey = "", key
+		record = &copied
+	}
+	return s.backend.PutScan(record)
+}
+
+// GetScan returns the scan with the given ID.
+func (s *Store) GetScan(id string) (*Scan, error) {
+	return s.backend.GetScan(id)
+}
+
+// ListScans returns matching scans, newest first. Their RawOutput is left
+// out; RawOutput reads it.
+func (s *Store) ListScans(f ScanFilter) ([]*Scan, error) {
+	return s.backend.ListScans(f)
+}
+
+// DeleteScan removes a scan and its blobs.
+func (s *Store) DeleteScan(ctx context.Context, scan *Scan) error {
+	if s.blobs != nil {
+		for _, name := range []string{"trivy.json", "report.md", "sbom.cdx.json"} {
+			if err := s.blobs.Delete(ctx, "scans/"+scan.ID+"/"+name); err != nil {
+				return err
+			}
+		}
+	}
+	return s.backend.DeleteScan(scan.ID)
+}
+
+// DropRawOutput removes a scan's Trivy output, keeping the analysis.
+func (s *Store) DropRawOutput(ctx context.Context, scan *Scan) error {
+	if scan.RawOutputKey != "" && s.blobs != nil {
+		if err := s.blobs.Delete(ctx, scan.RawOutputKey); err != nil {
+			return err
+		}
+	}
+	stripped := *scan
+	stripped.RawOutput, stripped.RawOutputKey, stripped.rawOmitted = "", "", false
+	return s.backend.PutScan(&stripped)
+}
+
+// RawOutput returns a scan's Trivy JSON, fetching it from the blob store if
+// it was offloaded. It is empty for scans stored without it.
+func (s *Store) RawOutput(ctx context.Context, scan *Scan) (string, error) {
+	if scan.rawOmitted {
+		full, err := s.backend.GetScan(scan.ID)
+		if err != nil {
+			return "", err
+		}
+		scan = full
+	}
+	if scan.RawOutput != "" || scan.RawOutputKey == "" {
+		return scan.RawOutput, nil
+	}
+	if s.blobs == nil {
+		return "", fmt.Errorf("scan %s output is in a blob store that is not configured", scan.ID)
+	}
+	data, err := s.blobs.Get(ctx, scan.RawOutputKey)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// ArchiveReport uploads a rendered report of a scan to the blob store, if
+// there is one.
+func (s *Store) ArchiveReport(ctx context.Context, scanID, name, contentType string, data []byte) error {
+	if s.blobs == nil {
+		return nil
+	}
+	return s.blobs.Put(ctx, "scans/"+scanID+"/"+name, data, contentType)
+}
+
+// ArchivedReport returns a report archived by ArchiveReport, ErrNotFound
+// without a blob store.
+func (s *Store) ArchivedReport(ctx context.Context, scanID, name string) ([]byte, error) {
+	if s.blobs == nil {
+		return nil, ErrNotFound
+	}
+	return s.blobs.Get(ctx, "scans/"+scanID+"/"+name)
+}
+
+// Orgs returns every org that owns a scan or a target, sorted.
+func (s *Store) Orgs() ([]string, error) {
+	orgs, err := s.backend.Orgs()
+	if err != nil {
+		return nil, err
+	}
+	seen := map[string]bool{}
+	for _, org := range orgs {
+		seen[org] = true
+	}
+	targets, err := s.targets.list()
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range targets {
+		seen[t.Org] = true
+	}
+
+	out := make([]string, 0, len(seen))
+	for org := range seen {
+		out = append(out, org)
+	}
+	sort.Strings(out)
+	return out, nil
+}
+
+// Ping verifies the data directory is still writable and the backend
+// reachable.
+func (s *Store) Ping(ctx context.Context) error {
+	probe := filepath.Join(s.dir, ".ping")
+	if err := os.WriteFile(probe, []byte(time.Now().UTC().Format(time.RFC3339)), 0o640); err != nil {
+		return fmt.Errorf("data directory is not writable: %w", err)
+	}
+	if err := os.Remove(probe); err != nil {
+		return err
+	}
+	if err := s.backend.Ping(ctx); err != nil {
+		return fmt.Errorf("scan backend is unreachable: %w", err)
+	}
+	return nil
+}
+
+// NewID returns a random 16-byte hex identifier.
+func NewID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// ValidID reports whether id has the form NewID gives it. Scan IDs name
+// files and blob keys, so no other form is stored.
+func ValidID(id string) bool {
+	if len(id) != 32 {
+		return false
+	}
+	for _, ch := range id {
+		if (ch < '0' || ch > '9') && (ch < 'a' || ch > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+func writeFileAtomic(path string, data []byte) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o640); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,81 @@
+package store
+
+import (
+	"sort"
+	"time"
+	"weeklysec/internal/agent"
+)
+
+// SaveSuppression creates or replaces a suppression rule.
+func (s *Store) SaveSuppression(rule agent.Suppression) error {
+	return s.suppressions.put(rule.ID, rule)
+}
+
+// GetSuppression returns the rule with the given ID.
+func (s *Store) GetSuppression(id string) (agent.Suppression, error) {
+	return s.suppressions.lookup(id)
+}
+
+// DeleteSuppression removes a rule.
+func (s *Store) DeleteSuppression(id string) error {
+	return s.suppressions.delete(id)
+}
+
+// ListSuppressions returns the rules of org visible to project ("" or "*"
+// for every project), newest first. Expired rules are dropped unless
+// includeExpired is set.
+func (s *Store) ListSuppressions(org, project string, includeExpired bool) ([]agent.Suppression, error) {
+	all, err := s.suppressions.list()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	f := ScanFilter{Org: org, Project: project}
+
+	var out []agent.Suppression
+	for _, rule := range all {
+		if !f.matchesTenant(rule.Org, rule.Project) {
+			continue
+		}
+		if !includeExpired && !rule.Active(now) {
+			continue
+		}
+		out = append(out, rule)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].CreatedAt.After(out[j].CreatedAt) })
+	return out, nil
+}
+
+// SaveSeverityOverride creates or replaces a severity override.
+func (s *Store) SaveSeverityOverride(rule agent.SeverityOverride) error {
+	return s.overrides.put(rule.ID, rule)
+}
+
+// GetSeverityOverride returns the override with the given ID.
+func (s *Store) GetSeverityOverride(id string) (agent.SeverityOverride, error) {
+	return s.overrides.lookup(id)
+}
+
+// DeleteSeverityOverride removes an override.
+func (s *Store) DeleteSeverityOverride(id string) error {
+	return s.overrides.delete(id)
+}
+
+// ListSeverityOverrides returns the overrides of org visible to project (""
+// or "*" for every project), newest first.
+func (s *Store) ListSeverityOverrides(org, project string) ([]agent.SeverityOverride, error) {
+	all, err := s.overrides.list()
+	if err != nil {
+		return nil, err
+	}
+	f := ScanFilter{Org: org, Project: project}
+
+	var out []agent.SeverityOverride
+	for _, rule := range all {
+		if f.matchesTenant(rule.Org, rule.Project) {
+			out = append(out, rule)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].CreatedAt.After(out[j].CreatedAt) })
+	return out, nil
+}
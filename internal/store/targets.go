@@ -0,0 +1,104 @@
+package store
+
+import (
+	"sort"
+	"time"
+	"weeklysec/internal/labels"
+)
+
+// Unassigned is the team of targets without one.
+const Unassigned = "unassigned"
+
+// Criticality levels a target can be tagged with.
+var Criticalities = []string{"low", "medium", "high", "critical"}
+
+// Target is a registered scan target with the ownership metadata used to
+// select it for scans.
+type Target struct {
+	ID          string            `json:"id"`
+	Org         string            `json:"org"`
+	Project     string            `json:"project"`
+	Name        string            `json:"name,omitempty"`
+	TargetType  string            `json:"target_type"`
+	Target      string            `json:"target"`
+	Team        string            `json:"team,omitempty"`
+	Environment string            `json:"environment,omitempty"`
+	Criticality string            `json:"criticality,omitempty"`
+	Schedule    string            `json:"schedule,omitempty"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	CreatedAt   time.Time         `json:"created_at"`
+	UpdatedAt   time.Time         `json:"updated_at"`
+}
+
+// TargetFilter narrows ListTargets. Zero values match everything.
+type TargetFilter struct {
+	Org         string
+	Project     string // empty or "*" matches every project of Org
+	Team        string
+	Environment string
+	Criticality string
+	Selector    labels.Selector
+}
+
+func (f TargetFilter) matches(t Target) bool {
+	tf := ScanFilter{Org: f.Org, Project: f.Project}
+	return tf.matchesTenant(t.Org, t.Project) &&
+		(f.Team == "" || t.Team == f.Team) &&
+		(f.Environment == "" || t.Environment == f.Environment) &&
+		(f.Criticality == "" || t.Criticality == f.Criticality) &&
+		f.Selector.Matches(t.Labels)
+}
+
+// SaveTarget creates or replaces a target.
+func (s *Store) SaveTarget(t Target) error {
+	return s.targets.put(t.ID, t)
+}
+
+// GetTarget returns the target with the given ID.
+func (s *Store) GetTarget(id string) (Target, error) {
+	return s.targets.lookup(id)
+}
+
+// DeleteTarget removes a target and its scan status. Scans of it are kept.
+func (s *Store) DeleteTarget(id string) error {
+	if err := s.targets.delete(id); err != nil {
+		return err
+	}
+	return s.deleteScanStatus(id)
+}
+
+// ListTargets returns the matching targets ordered by name, then target.
+func (s *Store) ListTargets(f TargetFilter) ([]Target, error) {
+	all, err := s.targets.list()
+	if err != nil {
+		return nil, err
+	}
+	var out []Target
+	for _, t := range all {
+		if f.matches(t) {
+			out = append(out, t)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Name != out[j].Name {
+			return out[i].Name < out[j].Name
+		}
+		return out[i].Target < out[j].Target
+	})
+	return out, nil
+}
+
+// FindTarget returns the target of org/project registered for the given
+// type and reference, or ErrNotFound.
+func (s *Store) FindTarget(org, project, targetType, target string) (Target, error) {
+	all, err := s.targets.list()
+	if err != nil {
+		return Target{}, err
+	}
+	for _, t := range all {
+		if t.Org == org && t.Project == project && t.TargetType == targetType && t.Target == target {
+			return t, nil
+		}
+	}
+	return Target{}, ErrNotFound
+}
@@ -0,0 +1,82 @@
+package store
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Ticket trackers.
+const (
+	TrackerGitHub     = "github"
+	TrackerJira       = "jira"
+	TrackerServiceNow = "servicenow"
+
+	// Pagers record the alerts they raised as tickets too.
+	TrackerPagerDuty = "pagerduty"
+	TrackerOpsgenie  = "opsgenie"
+)
+
+// Ticket records an issue opened in an external tracker for a
+// vulnerability of a target, so the same finding is not filed twice.
+type Ticket struct {
+	ID              string    `json:"id"`
+	Tracker         string    `json:"tracker"`
+	Org             string    `json:"org"`
+	Project         string    `json:"project"`
+	TargetKey       string    `json:"target_key"`
+	Target          string    `json:"target"`
+	VulnerabilityID string    `json:"vulnerability_id"`
+	Key             string    `json:"key"` // the tracker's reference, e.g. "owner/repo#12"
+	URL             string    `json:"url"`
+	ScanID          string    `json:"scan_id"` // last scan that filed or refreshed it
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+
+	// Status is the tracker's state of the issue, for trackers that are
+	// synced back; ClosedAt is when the sync found it closed.
+	Status   string     `json:"status,omitempty"`
+	ClosedAt *time.Time `json:"closed_at,omitempty"`
+}
+
+// TicketID identifies the ticket of a vulnerability of a target in a
+// tracker.
+func TicketID(tracker, targetKey, vulnID string) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s\x00%s\x00%s", tracker, targetKey, vulnID)))
+	return hex.EncodeToString(sum[:16])
+}
+
+// GetTicket returns the ticket with the given ID.
+func (s *Store) GetTicket(id string) (Ticket, error) {
+	return s.tickets.lookup(id)
+}
+
+// SaveTicket creates or replaces a ticket.
+func (s *Store) SaveTicket(t Ticket) error {
+	return s.tickets.put(t.ID, t)
+}
+
+// DeleteTicket removes a ticket.
+func (s *Store) DeleteTicket(id string) error {
+	return s.tickets.delete(id)
+}
+
+// ListTickets returns the tickets of org/project, newest first. An empty
+// tracker matches every tracker.
+func (s *Store) ListTickets(org, project, tracker string) ([]Ticket, error) {
+	all, err := s.tickets.list()
+	if err != nil {
+		return nil, err
+	}
+	f := ScanFilter{Org: org, Project: project}
+	var out []Ticket
+	for _, t := range all {
+		if f.matchesTenant(t.Org, t.Project) && (tracker == "" || t.Tracker == tracker) {
+			out = append(out, t)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].CreatedAt.After(out[j].CreatedAt) })
+	return out, nil
+}
@@ -0,0 +1,26 @@
+package store
+
+import (
+	"time"
+	"weeklysec/internal/quota"
+)
+
+// usageKind names the usage file of the file backend and the records
+// usage was kept in before the usage table.
+const usageKind = "usage"
+
+// GetUsage returns what scope used in month, zero when it used nothing.
+func (s *Store) GetUsage(month, scope string) (quota.Usage, error) {
+	return s.backend.GetUsage(month, scope)
+}
+
+// ListUsage returns the usage of every scope in month.
+func (s *Store) ListUsage(month string) ([]quota.Usage, error) {
+	return s.backend.ListUsage(month)
+}
+
+// AddUsage adds scans and tokens to a month's usage of a scope in one
+// atomic step and returns the sum.
+func (s *Store) AddUsage(month, scope string, scans, tokens int, at time.Time) (quota.Usage, error) {
+	return s.backend.AddUsage(month, scope, scans, tokens, at)
+}
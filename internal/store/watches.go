@@ -0,0 +1,40 @@
+package store
+
+import (
+	"sort"
+	"weeklysec/internal/watch"
+)
+
+// SaveWatch creates or replaces a watch subscription.
+func (s *Store) SaveWatch(sub watch.Subscription) error {
+	return s.watches.put(sub.ID, sub)
+}
+
+// GetWatch returns the subscription with the given ID.
+func (s *Store) GetWatch(id string) (watch.Subscription, error) {
+	return s.watches.lookup(id)
+}
+
+// DeleteWatch removes a subscription.
+func (s *Store) DeleteWatch(id string) error {
+	return s.watches.delete(id)
+}
+
+// ListWatches returns the subscriptions of org visible to project ("" or
+// "*" for every project), newest first.
+func (s *Store) ListWatches(org, project string) ([]watch.Subscription, error) {
+	all, err := s.watches.list()
+	if err != nil {
+		return nil, err
+	}
+	f := ScanFilter{Org: org, Project: project}
+
+	var out []watch.Subscription
+	for _, sub := range all {
+		if f.matchesTenant(sub.Org, sub.Project) {
+			out = append(out, sub)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].CreatedAt.After(out[j].CreatedAt) })
+	return out, nil
+}
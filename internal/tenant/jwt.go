@@ -0,0 +1,116 @@
+package tenant
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// JWTVerifier validates HS256 tokens whose claims carry the tenant:
+//
+//	{"sub": "alice", "org": "acme", "project": "payments", "exp": 1700000000}
+//
+// A missing project claim grants access to every project of the org.
+type JWTVerifier struct {
+	secret   []byte
+	issuer   string
+	audience string
+	now      func() time.Time
+}
+
+func NewJWTVerifier(secret, issuer, audience string) *JWTVerifier {
+	return &JWTVerifier{secret: []byte(secret), issuer: issuer, audience: audience, now: time.Now}
+}
+
+type jwtClaims struct {
+	Subject   string   `json:"sub"`
+	Issuer    string   `json:"iss"`
+	Audience  audience `json:"aud"`
+	ExpiresAt int64    `json:"exp"`
+	NotBefore int64    `json:"nbf"`
+	Org       string   `json:"org"`
+	Project   string   `json:"project"`
+}
+
+// audience accepts both the string and array forms of "aud".
+type audience []string
+
+func (a *audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = audience{single}
+		return nil
+	}
+	var many []string
+	if err := json.Unmarshal(data, &many); err != nil {
+		return err
+	}
+	*a = many
+	return nil
+}
+
+// Verify checks the signature and standard claims and returns the principal.
+func (v *JWTVerifier) Verify(token string) (Principal, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return Principal{}, ErrInvalidCredentials
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil || header.Alg != "HS256" {
+		return Principal{}, fmt.Errorf("%w: unsupported token algorithm", ErrInvalidCredentials)
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return Principal{}, ErrInvalidCredentials
+	}
+	mac := hmac.New(sha256.New, v.secret)
+	mac.Write([]byte(parts[0] + "." + parts[1]))
+	if !hmac.Equal(sig, mac.Sum(nil)) {
+		return Principal{}, fmt.Errorf("%w: bad token signature", ErrInvalidCredentials)
+	}
+
+	var claims jwtClaims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return Principal{}, ErrInvalidCredentials
+	}
+
+	now := v.now().Unix()
+	switch {
+	case claims.ExpiresAt == 0 || now >= claims.ExpiresAt:
+		return Principal{}, fmt.Errorf("%w: token expired", ErrInvalidCredentials)
+	case claims.NotBefore != 0 && now < claims.NotBefore:
+		return Principal{}, fmt.Errorf("%w: token not yet valid", ErrInvalidCredentials)
+	case v.issuer != "" && claims.Issuer != v.issuer:
+		return Principal{}, fmt.Errorf("%w: unexpected issuer", ErrInvalidCredentials)
+	case v.audience != "" && !slices.Contains(claims.Audience, v.audience):
+		return Principal{}, fmt.Errorf("%w: unexpected audience", ErrInvalidCredentials)
+	}
+
+	scope := claims.Org
+	if claims.Project != "" {
+		scope += "/" + claims.Project
+	}
+	t, err := Parse(scope)
+	if err != nil {
+		return Principal{}, fmt.Errorf("%w: %v", ErrInvalidCredentials, err)
+	}
+
+	return Principal{Subject: "jwt:" + claims.Subject, Tenant: t}, nil
+}
+
+func decodeSegment(seg string, v any) error {
+	data, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
@@ -0,0 +1,95 @@
+package tenant
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testSecret = "s3cret"
+
+var testNow = time.Unix(1_700_000_000, 0)
+
+// sign returns an HS256-style token over header and claims, signed with
+// secret.
+func sign(t *testing.T, secret string, header, claims map[string]any) string {
+	t.Helper()
+	seg := func(v any) string {
+		data, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return base64.RawURLEncoding.EncodeToString(data)
+	}
+	unsigned := seg(header) + "." + seg(claims)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(unsigned))
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func claims(extra map[string]any) map[string]any {
+	c := map[string]any{"sub": "alice", "org": "acme", "project": "payments", "exp": testNow.Add(time.Hour).Unix()}
+	for k, v := range extra {
+		if v == nil {
+			delete(c, k)
+		} else {
+			c[k] = v
+		}
+	}
+	return c
+}
+
+func TestJWTVerifier(t *testing.T) {
+	hs256 := map[string]any{"alg": "HS256", "typ": "JWT"}
+	valid := sign(t, testSecret, hs256, claims(nil))
+	forged := sign(t, "other", hs256, claims(map[string]any{"org": "evil"}))
+	tampered := forged[:strings.LastIndex(forged, ".")] + valid[strings.LastIndex(valid, "."):]
+
+	tests := []struct {
+		name     string
+		issuer   string
+		audience string
+		token    string
+		want     Principal
+		wantErr  bool
+	}{
+		{name: "valid", token: valid, want: Principal{Subject: "jwt:alice", Tenant: Tenant{Org: "acme", Project: "payments"}}},
+		{name: "no project claim grants the org", token: sign(t, testSecret, hs256, claims(map[string]any{"project": nil})), want: Principal{Subject: "jwt:alice", Tenant: Tenant{Org: "acme", Project: AllProjects}}},
+		{name: "issuer and audience string", issuer: "idp", audience: "weeklysec", token: sign(t, testSecret, hs256, claims(map[string]any{"iss": "idp", "aud": "weeklysec"})), want: Principal{Subject: "jwt:alice", Tenant: Tenant{Org: "acme", Project: "payments"}}},
+		{name: "audience array", audience: "weeklysec", token: sign(t, testSecret, hs256, claims(map[string]any{"aud": []string{"other", "weeklysec"}})), want: Principal{Subject: "jwt:alice", Tenant: Tenant{Org: "acme", Project: "payments"}}},
+		{name: "wrong secret", token: sign(t, "other", hs256, claims(nil)), wantErr: true},
+		{name: "tampered claims", token: tampered, wantErr: true},
+		{name: "alg none", token: sign(t, testSecret, map[string]any{"alg": "none"}, claims(nil)), wantErr: true},
+		{name: "alg HS512", token: sign(t, testSecret, map[string]any{"alg": "HS512"}, claims(nil)), wantErr: true},
+		{name: "unsigned", token: valid[:len(valid)-43] + ".", wantErr: true},
+		{name: "two segments", token: "a.b", wantErr: true},
+		{name: "expired", token: sign(t, testSecret, hs256, claims(map[string]any{"exp": testNow.Unix()})), wantErr: true},
+		{name: "no expiry", token: sign(t, testSecret, hs256, claims(map[string]any{"exp": nil})), wantErr: true},
+		{name: "not yet valid", token: sign(t, testSecret, hs256, claims(map[string]any{"nbf": testNow.Add(time.Minute).Unix()})), wantErr: true},
+		{name: "wrong issuer", issuer: "idp", token: sign(t, testSecret, hs256, claims(map[string]any{"iss": "other"})), wantErr: true},
+		{name: "missing audience", audience: "weeklysec", token: valid, wantErr: true},
+		{name: "invalid org", token: sign(t, testSecret, hs256, claims(map[string]any{"org": "acme/../x"})), wantErr: true},
+		{name: "no org", token: sign(t, testSecret, hs256, claims(map[string]any{"org": nil})), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := NewJWTVerifier(testSecret, tt.issuer, tt.audience)
+			v.now = func() time.Time { return testNow }
+			got, err := v.Verify(tt.token)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidCredentials) {
+					t.Fatalf("Verify() = %+v, %v, want ErrInvalidCredentials", got, err)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Fatalf("Verify() = %+v, %v, want %+v", got, err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,143 @@
+// Package tenant resolves the organization and project a request acts for.
+package tenant
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// AllProjects in Tenant.Project grants access to every project of the org.
+const AllProjects = "*"
+
+// Tenant scopes data to an organization and, optionally, one of its projects.
+type Tenant struct {
+	Org     string `json:"org"`
+	Project string `json:"project"`
+}
+
+// Default is used for unauthenticated requests when auth is optional, and for
+// records created before multi-tenancy.
+var Default = Tenant{Org: "default", Project: "default"}
+
+func (t Tenant) String() string {
+	return t.Org + "/" + t.Project
+}
+
+// AllowsProject reports whether t may access project within its org.
+func (t Tenant) AllowsProject(project string) bool {
+	return t.Project == AllProjects || t.Project == project
+}
+
+// Allows reports whether t may access records owned by org/project.
+func (t Tenant) Allows(org, project string) bool {
+	return t.Org == org && t.AllowsProject(project)
+}
+
+// Parse parses "org/project"; "org" alone or "org/*" means every project.
+func Parse(s string) (Tenant, error) {
+	org, project, found := strings.Cut(strings.TrimSpace(s), "/")
+	if !found || project == "" {
+		project = AllProjects
+	}
+	if !validName(org) || (project != AllProjects && !validName(project)) {
+		return Tenant{}, fmt.Errorf("invalid tenant %q", s)
+	}
+	return Tenant{Org: org, Project: project}, nil
+}
+
+func validName(s string) bool {
+	if s == "" || len(s) > 64 {
+		return false
+	}
+	for _, ch := range s {
+		switch {
+		case ch >= 'a' && ch <= 'z', ch >= 'A' && ch <= 'Z', ch >= '0' && ch <= '9', ch == '-', ch == '_', ch == '.':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+type contextKey struct{}
+
+// NewContext returns a copy of ctx carrying t.
+func NewContext(ctx context.Context, t Tenant) context.Context {
+	return context.WithValue(ctx, contextKey{}, t)
+}
+
+// FromContext returns the tenant stored in ctx, or Default.
+func FromContext(ctx context.Context) Tenant {
+	if t, ok := ctx.Value(contextKey{}).(Tenant); ok {
+		return t
+	}
+	return Default
+}
+
+// Principal is an authenticated caller.
+type Principal struct {
+	Subject string // e.g. "apikey:ci" or "jwt:alice"
+	Tenant  Tenant
+}
+
+// ErrInvalidCredentials is returned for unknown keys and bad tokens.
+var ErrInvalidCredentials = errors.New("invalid credentials")
+
+// Resolver maps API keys and JWTs to principals.
+type Resolver struct {
+	keys []apiKey
+	jwt  *JWTVerifier
+}
+
+type apiKey struct {
+	name   string
+	key    string
+	tenant Tenant
+}
+
+// NewResolver builds a resolver. Each API key spec has the form
+// "name:key=org/project"; the name is optional. jwt may be nil.
+func NewResolver(keySpecs []string, jwt *JWTVerifier) (*Resolver, error) {
+	r := &Resolver{jwt: jwt}
+	for i, spec := range keySpecs {
+		cred, scope, ok := strings.Cut(spec, "=")
+		if !ok {
+			return nil, fmt.Errorf("API key %d: expected [name:]key=org/project", i+1)
+		}
+		t, err := Parse(scope)
+		if err != nil {
+			return nil, fmt.Errorf("API key %d: %w", i+1, err)
+		}
+		name, key, hasName := strings.Cut(cred, ":")
+		if !hasName {
+			name, key = fmt.Sprintf("key%d", i+1), cred
+		}
+		if key == "" {
+			return nil, fmt.Errorf("API key %d: empty key", i+1)
+		}
+		r.keys = append(r.keys, apiKey{name: name, key: key, tenant: t})
+	}
+	return r, nil
+}
+
+// Enabled reports whether any credential source is configured.
+func (r *Resolver) Enabled() bool {
+	return len(r.keys) > 0 || r.jwt != nil
+}
+
+// Resolve returns the principal for a bearer credential. Tokens that look like
+// JWTs are verified as such; anything else is treated as an API key.
+func (r *Resolver) Resolve(credential string) (Principal, error) {
+	if r.jwt != nil && strings.Count(credential, ".") == 2 {
+		return r.jwt.Verify(credential)
+	}
+	for _, k := range r.keys {
+		if subtle.ConstantTimeCompare([]byte(k.key), []byte(credential)) == 1 {
+			return Principal{Subject: "apikey:" + k.name, Tenant: k.tenant}, nil
+		}
+	}
+	return Principal{}, ErrInvalidCredentials
+}
@@ -0,0 +1,109 @@
+package tenant
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Tenant
+		wantErr bool
+	}{
+		{in: "acme/web", want: Tenant{Org: "acme", Project: "web"}},
+		{in: " acme ", want: Tenant{Org: "acme", Project: AllProjects}},
+		{in: "acme/", want: Tenant{Org: "acme", Project: AllProjects}},
+		{in: "acme/*", want: Tenant{Org: "acme", Project: AllProjects}},
+		{in: "a.b-c_d/x1", want: Tenant{Org: "a.b-c_d", Project: "x1"}},
+		{in: "", wantErr: true},
+		{in: "/web", wantErr: true},
+		{in: "*/web", wantErr: true},
+		{in: "acme/web/extra", wantErr: true},
+		{in: "acme/we b", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := Parse(tt.in)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("Parse(%q) = %+v, %v, want %+v (error %v)", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestAllows(t *testing.T) {
+	tests := []struct {
+		tenant       Tenant
+		org, project string
+		want         bool
+	}{
+		{Tenant{Org: "acme", Project: "web"}, "acme", "web", true},
+		{Tenant{Org: "acme", Project: "web"}, "acme", "api", false},
+		{Tenant{Org: "acme", Project: "web"}, "other", "web", false},
+		{Tenant{Org: "acme", Project: AllProjects}, "acme", "api", true},
+		{Tenant{Org: "acme", Project: AllProjects}, "other", "api", false},
+		{Tenant{Org: "acme", Project: "web"}, "acme", AllProjects, false},
+	}
+	for _, tt := range tests {
+		if got := tt.tenant.Allows(tt.org, tt.project); got != tt.want {
+			t.Errorf("%s.Allows(%q, %q) = %v, want %v", tt.tenant, tt.org, tt.project, got, tt.want)
+		}
+	}
+}
+
+func TestNewResolver(t *testing.T) {
+	tests := []struct {
+		name  string
+		specs []string
+	}{
+		{"no scope", []string{"ci:key"}},
+		{"empty key", []string{"ci:=acme/web"}},
+		{"invalid tenant", []string{"ci:key=acme/web/x"}},
+	}
+	for _, tt := range tests {
+		if _, err := NewResolver(tt.specs, nil); err == nil {
+			t.Errorf("%s: NewResolver(%q) succeeded", tt.name, tt.specs)
+		}
+	}
+}
+
+func TestResolve(t *testing.T) {
+	jwt := NewJWTVerifier(testSecret, "", "")
+	jwt.now = func() time.Time { return testNow }
+	r, err := NewResolver([]string{"ci:k1=acme/web", "k2=acme", "a.b.c=other/x"}, jwt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token := sign(t, testSecret, map[string]any{"alg": "HS256"}, claims(nil))
+
+	tests := []struct {
+		name       string
+		resolver   *Resolver
+		credential string
+		want       Principal
+		wantErr    bool
+	}{
+		{name: "named key", resolver: r, credential: "k1", want: Principal{Subject: "apikey:ci", Tenant: Tenant{Org: "acme", Project: "web"}}},
+		{name: "unnamed key", resolver: r, credential: "k2", want: Principal{Subject: "apikey:key2", Tenant: Tenant{Org: "acme", Project: AllProjects}}},
+		{name: "jwt", resolver: r, credential: token, want: Principal{Subject: "jwt:alice", Tenant: Tenant{Org: "acme", Project: "payments"}}},
+		{name: "dotted key is verified as a jwt", resolver: r, credential: "a.b.c", wantErr: true},
+		{name: "unknown key", resolver: r, credential: "k3", wantErr: true},
+		{name: "key prefix", resolver: r, credential: "k", wantErr: true},
+		{name: "empty", resolver: r, credential: "", wantErr: true},
+		{name: "jwt without a verifier", resolver: &Resolver{}, credential: token, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.resolver.Resolve(tt.credential)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidCredentials) {
+					t.Fatalf("Resolve(%q) = %+v, %v, want ErrInvalidCredentials", tt.credential, got, err)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Fatalf("Resolve(%q) = %+v, %v, want %+v", tt.credential, got, err, tt.want)
+			}
+		})
+	}
+}
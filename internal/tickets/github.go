@@ -0,0 +1,31 @@
+package tickets
+
+import (
+	"context"
+	"fmt"
+	"weeklysec/internal/github"
+	"weeklysec/internal/store"
+)
+
+// GitHub opens issues in one repository.
+type GitHub struct {
+	Client    *github.Client
+	Repo      string // owner/name
+	Labels    []string
+	Assignees []string
+}
+
+func (g *GitHub) Name() string { return store.TrackerGitHub }
+
+func (g *GitHub) Create(ctx context.Context, issue Issue) (string, string, error) {
+	created, err := g.Client.CreateIssue(ctx, g.Repo, github.Issue{
+		Title:     issue.Title,
+		Body:      issue.Body,
+		Labels:    g.Labels,
+		Assignees: g.Assignees,
+	})
+	if err != nil {
+		return "", "", err
+	}
+	return fmt.Sprintf("%s#%d", g.Repo, created.Number), created.URL, nil
+}
@@ -0,0 +1,72 @@
+package tickets
+
+import (
+	"context"
+	"maps"
+	"strings"
+	"weeklysec/internal/jira"
+	"weeklysec/internal/store"
+)
+
+// maxSummary is Jira's limit on issue summaries.
+const maxSummary = 255
+
+// DefaultJiraPriorities maps severities to Jira's default priority scheme.
+var DefaultJiraPriorities = map[string]string{
+	"CRITICAL": "Highest",
+	"HIGH":     "High",
+	"MEDIUM":   "Medium",
+	"LOW":      "Low",
+}
+
+// Jira creates issues in one Jira project and keeps their description and
+// priority current.
+type Jira struct {
+	Client       *jira.Client
+	Project      string            // project key
+	IssueType    string            // e.g. "Bug"
+	Priorities   map[string]string // severity to priority name; unmapped severities set none
+	Labels       []string
+	CustomFields map[string]any // merged into the fields of new issues
+}
+
+func (j *Jira) Name() string { return store.TrackerJira }
+
+func (j *Jira) Create(ctx context.Context, issue Issue) (string, string, error) {
+	fields := maps.Clone(j.CustomFields)
+	if fields == nil {
+		fields = map[string]any{}
+	}
+	maps.Copy(fields, j.fields(issue))
+	fields["project"] = map[string]string{"key": j.Project}
+	fields["issuetype"] = map[string]string{"name": j.IssueType}
+	if len(j.Labels) > 0 {
+		fields["labels"] = j.Labels
+	}
+	key, err := j.Client.CreateIssue(ctx, fields)
+	if err != nil {
+		return "", "", err
+	}
+	return key, j.Client.BrowseURL(key), nil
+}
+
+// Update refreshes the summary, description and priority. Fields people
+// are likely to have changed, like the assignee or status, are left alone.
+func (j *Jira) Update(ctx context.Context, key string, issue Issue) error {
+	return j.Client.UpdateIssue(ctx, key, j.fields(issue))
+}
+
+func (j *Jira) fields(issue Issue) map[string]any {
+	summary := issue.Title
+	if len(summary) > maxSummary {
+		summary = summary[:maxSummary-3] + "..."
+	}
+	fields := map[string]any{
+		"summary":     summary,
+		"description": issue.Body,
+	}
+	if p := j.Priorities[strings.ToUpper(issue.Severity)]; p != "" {
+		fields["priority"] = map[string]string{"name": p}
+	}
+	return fields
+}
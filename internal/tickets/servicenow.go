@@ -0,0 +1,84 @@
+package tickets
+
+import (
+	"context"
+	"maps"
+	"strconv"
+	"weeklysec/internal/servicenow"
+	"weeklysec/internal/store"
+)
+
+// maxShortDescription is ServiceNow's default limit on short descriptions.
+const maxShortDescription = 160
+
+// Levels are a record's urgency and impact, from 1 (high) to 3 (low).
+// ServiceNow derives the priority from them.
+type Levels struct {
+	Urgency int
+	Impact  int
+}
+
+// DefaultServiceNowLevels maps finding priorities to the urgency and impact
+// that give the same ServiceNow priority under its default matrix.
+var DefaultServiceNowLevels = map[int]Levels{
+	1: {Urgency: 1, Impact: 1},
+	2: {Urgency: 1, Impact: 2},
+	3: {Urgency: 2, Impact: 2},
+	4: {Urgency: 2, Impact: 3},
+	5: {Urgency: 3, Impact: 3},
+}
+
+// ServiceNow creates records in one table, such as incident, sn_si_incident
+// or change_request, keeps their description and levels current, and
+// reports when they close.
+type ServiceNow struct {
+	Client *servicenow.Client
+	Table  string
+	Levels map[int]Levels // finding priority to urgency and impact; unmapped priorities set none
+	Fields map[string]any // merged into the fields of new records
+}
+
+func (s *ServiceNow) Name() string { return store.TrackerServiceNow }
+
+func (s *ServiceNow) Create(ctx context.Context, issue Issue) (string, string, error) {
+	fields := maps.Clone(s.Fields)
+	if fields == nil {
+		fields = map[string]any{}
+	}
+	maps.Copy(fields, s.fields(issue))
+	rec, err := s.Client.Create(ctx, s.Table, fields)
+	if err != nil {
+		return "", "", err
+	}
+	return rec.Number, s.Client.RecordURL(s.Table, rec.Number), nil
+}
+
+// Update refreshes the short description, description, urgency and impact.
+func (s *ServiceNow) Update(ctx context.Context, key string, issue Issue) error {
+	return s.Client.Update(ctx, s.Table, key, s.fields(issue))
+}
+
+// Status returns the record's state and whether it is closed.
+func (s *ServiceNow) Status(ctx context.Context, key string) (string, bool, error) {
+	rec, err := s.Client.Get(ctx, s.Table, key)
+	if err != nil {
+		return "", false, err
+	}
+	return rec.State, rec.Closed(), nil
+}
+
+func (s *ServiceNow) fields(issue Issue) map[string]any {
+	short := issue.Title
+	if len(short) > maxShortDescription {
+		short = short[:maxShortDescription-3] + "..."
+	}
+	fields := map[string]any{
+		"short_description": short,
+		"description":       issue.Body,
+	}
+	if l, ok := s.Levels[issue.Priority]; ok {
+		fields["urgency"] = strconv.Itoa(l.Urgency)
+		fields["impact"] = strconv.Itoa(l.Impact)
+	}
+	return fields
+}
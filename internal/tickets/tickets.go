@@ -0,0 +1,274 @@
+// Package tickets files an issue in an external tracker for every urgent
+// prioritized finding, once per vulnerability and target. Trackers that
+// support it get the issue refreshed by later scans instead, and have its
+// status synced back so a finding outliving a closed issue is filed again.
+package tickets
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+	"weeklysec/internal/agent"
+	"weeklysec/internal/store"
+
+	"github.com/rs/zerolog"
+)
+
+// DefaultTitle is the title template used when none is configured.
+const DefaultTitle = "[{{.Finding.Severity}}] {{.Finding.VulnerabilityID}} in {{.Finding.PkgName}} ({{.Target}})"
+
+// DefaultBody is the body template used when none is configured.
+const DefaultBody = `**{{.Finding.VulnerabilityID}}** affects ` + "`{{.Finding.PkgName}}` {{.Finding.InstalledVersion}}" + ` in ` + "`{{.Target}}`" + ` ({{.TargetType}}).
+
+| Priority | Severity | CVSS | Fixed in |
+|---|---|---|---|
+| P{{.Finding.Priority}} | {{.Finding.Severity}} | {{if .Finding.CVSSScore}}{{printf "%.1f" .Finding.CVSSScore}}{{else}}-{{end}} | {{or .Finding.FixedVersion "-"}} |
+{{with .Finding.Title}}
+{{.}}
+{{end}}
+**Why now:** {{.Finding.Reason}}
+{{with .Fix}}
+**Fix:** {{.Description}}.
+{{end}}
+Found by scan ` + "`{{.ScanID}}`" + ` of {{.Org}}/{{.Project}}.
+`
+
+// Data is what the title and body templates are executed with.
+type Data struct {
+	Finding    agent.PrioritizedFinding
+	Fix        *agent.Fix // the fix resolving the finding, if any
+	Org        string
+	Project    string
+	TargetType string
+	Target     string
+	ScanID     string
+}
+
+// Issue is a rendered ticket.
+type Issue struct {
+	Title    string
+	Body     string
+	Severity string
+	Priority int
+}
+
+// Tracker opens issues in an external system.
+type Tracker interface {
+	// Name is the store.Ticket tracker name.
+	Name() string
+	// Create opens the issue and returns its reference and URL.
+	Create(ctx context.Context, issue Issue) (key, url string, err error)
+}
+
+// Updater is implemented by trackers whose issues are refreshed with the
+// latest scan's details.
+type Updater interface {
+	Update(ctx context.Context, key string, issue Issue) error
+}
+
+// Syncer is implemented by trackers that report the status of issues.
+type Syncer interface {
+	Status(ctx context.Context, key string) (status string, closed bool, err error)
+}
+
+// Options tune which findings are filed and how issues read.
+type Options struct {
+	MaxPriority  int    // findings with a priority number above it are skipped
+	Title        string // text/template; DefaultTitle when empty
+	BodyTemplate string // path to a text/template file; DefaultBody when empty
+}
+
+// Filer files issues for scans.
+type Filer struct {
+	store       *store.Store
+	tracker     Tracker
+	maxPriority int
+	title       *template.Template
+	body        *template.Template
+
+	mu sync.Mutex // serializes File so concurrent scans do not file twice
+}
+
+// New parses the templates and returns a Filer for tracker.
+func New(st *store.Store, tracker Tracker, opts Options) (*Filer, error) {
+	title, body := opts.Title, DefaultBody
+	if title == "" {
+		title = DefaultTitle
+	}
+	if opts.BodyTemplate != "" {
+		b, err := os.ReadFile(opts.BodyTemplate)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read issue template: %w", err)
+		}
+		body = string(b)
+	}
+	f := &Filer{store: st, tracker: tracker, maxPriority: opts.MaxPriority}
+	var err error
+	if f.title, err = template.New("title").Parse(title); err != nil {
+		return nil, fmt.Errorf("invalid issue title template: %w", err)
+	}
+	if f.body, err = template.New("body").Parse(body); err != nil {
+		return nil, fmt.Errorf("invalid issue body template: %w", err)
+	}
+	return f, nil
+}
+
+// Tracker returns the name of the filer's tracker.
+func (f *Filer) Tracker() string {
+	return f.tracker.Name()
+}
+
+// File opens an issue for every finding of scan at or above the priority
+// threshold that has none yet, updates the existing ones if the tracker
+// supports it, and returns how many it opened. It stops at the first
+// tracker error.
+func (f *Filer) File(ctx context.Context, scan *store.Scan) (int, error) {
+	if scan.Response == nil {
+		return 0, nil
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	logger := zerolog.Ctx(ctx)
+	targetKey := scan.TargetKey()
+
+	opened := 0
+	for _, p := range scan.Response.Prioritized {
+		if p.Priority > f.maxPriority {
+			continue
+		}
+		id := store.TicketID(f.tracker.Name(), targetKey, p.VulnerabilityID)
+		existing, err := f.store.GetTicket(id)
+		if existing.ClosedAt != nil {
+			// The issue was closed while the finding is still there.
+			existing, err = store.Ticket{}, store.ErrNotFound
+		}
+		updater, canUpdate := f.tracker.(Updater)
+		if err == nil && (!canUpdate || existing.ScanID == scan.ID) {
+			continue
+		}
+
+		issue, err := f.render(Data{
+			Finding:    p,
+			Fix:        fixFor(scan.Response, p),
+			Org:        scan.Org,
+			Project:    scan.Project,
+			TargetType: scan.TargetType,
+			Target:     scan.Target,
+			ScanID:     scan.ID,
+		})
+		if err != nil {
+			return opened, err
+		}
+		issue.Severity = p.Severity
+		issue.Priority = p.Priority
+
+		if existing.ID != "" {
+			if err := updater.Update(ctx, existing.Key, issue); err != nil {
+				return opened, err
+			}
+			existing.ScanID = scan.ID
+			existing.UpdatedAt = time.Now().UTC()
+			if err := f.store.SaveTicket(existing); err != nil {
+				return opened, err
+			}
+			continue
+		}
+
+		key, url, err := f.tracker.Create(ctx, issue)
+		if err != nil {
+			return opened, err
+		}
+		opened++
+		now := time.Now().UTC()
+		logger.Info().Str("tracker", f.tracker.Name()).Str("key", key).Str("vulnerability_id", p.VulnerabilityID).Msg("Opened issue")
+
+		if err := f.store.SaveTicket(store.Ticket{
+			ID:              id,
+			Tracker:         f.tracker.Name(),
+			Org:             scan.Org,
+			Project:         scan.Project,
+			TargetKey:       targetKey,
+			Target:          scan.Target,
+			VulnerabilityID: p.VulnerabilityID,
+			Key:             key,
+			URL:             url,
+			ScanID:          scan.ID,
+			CreatedAt:       now,
+			UpdatedAt:       now,
+		}); err != nil {
+			return opened, err
+		}
+	}
+	return opened, nil
+}
+
+// Sync refreshes the status of the open issues of trackers that report it,
+// and returns how many it found closed. It stops at the first tracker
+// error.
+func (f *Filer) Sync(ctx context.Context) (int, error) {
+	syncer, ok := f.tracker.(Syncer)
+	if !ok {
+		return 0, nil
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	tickets, err := f.store.ListTickets("", "", f.tracker.Name())
+	if err != nil {
+		return 0, err
+	}
+	closed := 0
+	for _, t := range tickets {
+		if t.ClosedAt != nil {
+			continue
+		}
+		status, done, err := syncer.Status(ctx, t.Key)
+		if err != nil {
+			return closed, err
+		}
+		if status == t.Status && !done {
+			continue
+		}
+		now := time.Now().UTC()
+		t.Status = status
+		t.UpdatedAt = now
+		if done {
+			t.ClosedAt = &now
+			closed++
+			zerolog.Ctx(ctx).Info().Str("tracker", f.tracker.Name()).Str("key", t.Key).Str("status", status).Msg("Issue closed")
+		}
+		if err := f.store.SaveTicket(t); err != nil {
+			return closed, err
+		}
+	}
+	return closed, nil
+}
+
+func (f *Filer) render(d Data) (Issue, error) {
+	var title, body bytes.Buffer
+	if err := f.title.Execute(&title, d); err != nil {
+		return Issue{}, fmt.Errorf("failed to render issue title: %w", err)
+	}
+	if err := f.body.Execute(&body, d); err != nil {
+		return Issue{}, fmt.Errorf("failed to render issue body: %w", err)
+	}
+	return Issue{Title: strings.TrimSpace(title.String()), Body: body.String()}, nil
+}
+
+func fixFor(resp *agent.AgentResponse, p agent.PrioritizedFinding) *agent.Fix {
+	if resp.Remediation == nil {
+		return nil
+	}
+	for i, fix := range resp.Remediation.Fixes {
+		if fix.PkgName == p.PkgName {
+			return &resp.Remediation.Fixes[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,211 @@
+// Package trends turns stored scan history into time series.
+package trends
+
+import (
+	"cmp"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+	"weeklysec/internal/digest"
+	"weeklysec/internal/mttr"
+	"weeklysec/internal/store"
+)
+
+// Metrics.
+const (
+	MetricRiskScore     = "risk_score"     // mean risk score of the group's targets
+	MetricOpenCriticals = "open_criticals" // open critical findings across the group
+	MetricMTTR          = "mttr_days"      // mean days to remediate findings fixed in each interval
+)
+
+// Groupings.
+const (
+	GroupTarget = "target"
+	GroupTeam   = "team"
+	GroupAll    = "all"
+)
+
+// MaxPoints bounds the number of intervals a query may span.
+const MaxPoints = 1000
+
+// Query selects a metric over [Since, Until] sampled every Interval.
+type Query struct {
+	Metric   string
+	GroupBy  string
+	Since    time.Time
+	Until    time.Time
+	Interval time.Duration
+}
+
+// Validate checks the query and fills in its defaults.
+func (q *Query) Validate() error {
+	q.Metric = cmp.Or(q.Metric, MetricRiskScore)
+	q.GroupBy = cmp.Or(q.GroupBy, GroupTarget)
+
+	switch q.Metric {
+	case MetricRiskScore, MetricOpenCriticals, MetricMTTR:
+	default:
+		return fmt.Errorf("'metric' must be one of %s, %s or %s", MetricRiskScore, MetricOpenCriticals, MetricMTTR)
+	}
+	switch q.GroupBy {
+	case GroupTarget, GroupTeam, GroupAll:
+	default:
+		return fmt.Errorf("'group_by' must be one of %s, %s or %s", GroupTarget, GroupTeam, GroupAll)
+	}
+	if q.Interval <= 0 {
+		return fmt.Errorf("'interval' must be positive")
+	}
+	if !q.Since.Before(q.Until) {
+		return fmt.Errorf("'since' must be before 'until'")
+	}
+	if q.Until.Sub(q.Since)/q.Interval > MaxPoints {
+		return fmt.Errorf("the query spans more than %d intervals; widen 'interval' or narrow the range", MaxPoints)
+	}
+	return nil
+}
+
+// Point is one sample. T is the end of the interval it covers.
+type Point struct {
+	T time.Time `json:"t"`
+	V float64   `json:"v"`
+}
+
+// Series is the samples of one group.
+type Series struct {
+	Name   string  `json:"name"`
+	Points []Point `json:"points"`
+}
+
+// timeline is one target's scans, oldest first.
+type timeline struct {
+	name  string
+	team  string
+	scans []*store.Scan
+}
+
+// Compute evaluates q over scans, or over the lifecycles of findings for
+// MTTR, using targets to resolve teams. Groups are omitted until they have
+// data; MTTR only has points for intervals in which something was fixed.
+func Compute(q Query, scans []*store.Scan, targets []store.Target, findings []store.Finding) []Series {
+	teams := make(map[string]string, len(targets))
+	for _, t := range targets {
+		teams[t.ID] = t.Team
+	}
+
+	byKey := map[string]*timeline{}
+	for _, s := range scans {
+		k := s.TargetKey()
+		tl, ok := byKey[k]
+		if !ok {
+			tl = &timeline{name: s.Target, team: cmp.Or(teams[s.TargetID], digest.Unassigned)}
+			byKey[k] = tl
+		}
+		tl.scans = append(tl.scans, s)
+	}
+
+	// The last interval is cut short at Until so recent scans are included.
+	var ends []time.Time
+	for t := q.Since.Add(q.Interval); t.Before(q.Until); t = t.Add(q.Interval) {
+		ends = append(ends, t)
+	}
+	ends = append(ends, q.Until)
+
+	type acc struct {
+		sum float64
+		n   int
+	}
+	groups := map[string][]acc{}
+	add := func(group string, i int, v float64, n int) {
+		g, ok := groups[group]
+		if !ok {
+			g = make([]acc, len(ends))
+			groups[group] = g
+		}
+		g[i].sum += v
+		g[i].n += n
+	}
+
+	if q.Metric == MetricMTTR {
+		mttr.Each(findings, teams, q.Since, q.Until, func(f store.Finding, team string, x store.Fix) {
+			if i := bucket(ends, q.Interval, x.Fixed); i >= 0 {
+				add(groupName(q.GroupBy, f.Target, team), i, x.Duration().Hours()/24, 1)
+			}
+		})
+	} else {
+		for _, tl := range byKey {
+			sort.Slice(tl.scans, func(i, j int) bool { return tl.scans[i].CreatedAt.Before(tl.scans[j].CreatedAt) })
+			group := groupName(q.GroupBy, tl.name, tl.team)
+
+			j := -1
+			for i, end := range ends {
+				for j+1 < len(tl.scans) && !tl.scans[j+1].CreatedAt.After(end) {
+					j++
+				}
+				if j < 0 {
+					continue
+				}
+				latest := tl.scans[j]
+				if q.Metric == MetricRiskScore {
+					add(group, i, digest.RiskScore(latest), 1)
+				} else {
+					add(group, i, float64(openCriticals(latest)), 1)
+				}
+			}
+		}
+	}
+
+	out := []Series{}
+	for name, g := range groups {
+		s := Series{Name: name, Points: []Point{}}
+		for i, a := range g {
+			if a.n == 0 {
+				continue
+			}
+			v := a.sum
+			if q.Metric != MetricOpenCriticals {
+				v = float64(int(a.sum/float64(a.n)*10+0.5)) / 10
+			}
+			s.Points = append(s.Points, Point{T: ends[i], V: v})
+		}
+		out = append(out, s)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+func openCriticals(s *store.Scan) int {
+	n := 0
+	for _, v := range digest.Open(s) {
+		if strings.EqualFold(v.Severity, "CRITICAL") {
+			n++
+		}
+	}
+	return n
+}
+
+func groupName(groupBy, target, team string) string {
+	switch groupBy {
+	case GroupTeam:
+		return team
+	case GroupAll:
+		return GroupAll
+	default:
+		return target
+	}
+}
+
+// bucket returns the index of the interval ending at ends[i] that holds t,
+// or -1.
+func bucket(ends []time.Time, interval time.Duration, t time.Time) int {
+	for i, end := range ends {
+		start := end.Add(-interval)
+		if i > 0 {
+			start = ends[i-1]
+		}
+		if t.After(start) && !t.After(end) {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,175 @@
+package trivy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	// cacheDir is the Trivy cache every command shares; empty leaves it to
+	// Trivy.
+	cacheDir string
+
+	// dbMu is held for reading by commands that use the DB and for writing
+	// while a downloaded DB replaces the current one.
+	dbMu sync.RWMutex
+
+	// dbFresh is set once a DB was downloaded into cacheDir, after which
+	// scans stop checking for updates on their own.
+	dbFresh atomic.Bool
+)
+
+// SetCacheDir makes every command use dir as Trivy's cache, so scans share
+// one vulnerability DB. It must be called before the first scan.
+func SetCacheDir(dir string) {
+	cacheDir = dir
+}
+
+// CacheDir returns the Trivy cache commands use, "" for Trivy's default.
+func CacheDir() string {
+	return cacheDir
+}
+
+// globalArgs returns the flags every command takes.
+func globalArgs() []string {
+	if cacheDir == "" {
+		return nil
+	}
+	return []string{"--cache-dir", cacheDir}
+}
+
+// dbArgs returns the flags of commands that read the vulnerability DB.
+func dbArgs() []string {
+	args := globalArgs()
+	if dbFresh.Load() {
+		args = append(args, "--skip-db-update")
+	}
+	return args
+}
+
+// DownloadDB fetches the vulnerability DB, so scans do not have to. With a
+// cache directory the DB is downloaded next to the current one and swapped
+// in once complete, so scans never see half a DB.
+func DownloadDB(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Minute)
+	defer cancel()
+
+	if cacheDir == "" {
+		dbMu.Lock()
+		defer dbMu.Unlock()
+		return downloadDB(ctx, "")
+	}
+
+	if err := os.MkdirAll(cacheDir, 0o755); err != nil {
+		return err
+	}
+	staging, err := os.MkdirTemp(cacheDir, ".db-download-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(staging)
+	if err := downloadDB(ctx, staging); err != nil {
+		return err
+	}
+
+	dbMu.Lock()
+	defer dbMu.Unlock()
+	current := filepath.Join(cacheDir, "db")
+	old := filepath.Join(staging, "db.old")
+	if err := os.Rename(current, old); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	if err := os.Rename(filepath.Join(staging, "db"), current); err != nil {
+		// Put the previous DB back rather than leave none.
+		_ = os.Rename(old, current)
+		return err
+	}
+	dbFresh.Store(true)
+	// Findings matched against the previous DB are stale now.
+	_ = os.RemoveAll(filepath.Join(cacheDir, stacksDir))
+	return nil
+}
+
+func downloadDB(ctx context.Context, dir string) error {
+	args := []string{"image", "--download-db-only"}
+	if dir != "" {
+		args = append(args, "--cache-dir", dir)
+	}
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, binary, args...)
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("failed to download trivy DB: %w\n%s", err, stderr.String())
+	}
+	return nil
+}
+
+// currentDB returns when the DB scans use was built, or zero when scans
+// still update it themselves.
+func currentDB() time.Time {
+	if !dbFresh.Load() {
+		return time.Time{}
+	}
+	info, err := cachedDB()
+	if err != nil {
+		return time.Time{}
+	}
+	return info.UpdatedAt
+}
+
+// cachedDB reads the metadata of the DB in the cache directory.
+func cachedDB() (*DBInfo, error) {
+	data, err := os.ReadFile(filepath.Join(cacheDir, "db", "metadata.json"))
+	if err != nil {
+		return nil, err
+	}
+	var info DBInfo
+	if err := json.Unmarshal(data, &info); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+// RefreshDB keeps the DB in the cache directory fresh: it downloads it
+// unless the cached one is still current, then again every interval until
+// stop is closed. Failures are logged; scans then fetch the DB themselves.
+func RefreshDB(interval time.Duration, stop <-chan struct{}) {
+	if info, err := cachedDB(); err == nil && time.Now().Before(info.NextUpdate) {
+		dbFresh.Store(true)
+		log.Info().Time("updated_at", info.UpdatedAt).Msg("Trivy DB in the cache is up to date")
+	} else {
+		refreshDB()
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			refreshDB()
+		case <-stop:
+			return
+		}
+	}
+}
+
+func refreshDB() {
+	start := time.Now()
+	if err := DownloadDB(context.Background()); err != nil {
+		log.Warn().Err(err).Msg("Failed to refresh the Trivy DB")
+		return
+	}
+	log.Info().Dur("duration", time.Since(start)).Msg("Trivy DB refreshed")
+}
@@ -0,0 +1,95 @@
+package trivy
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"time"
+	"weeklysec/internal/errcode"
+)
+
+// fixtures, when set, stands in for Trivy: scans replay stored reports.
+var fixtures *fixtureSet
+
+type fixtureSet struct {
+	paths   []string
+	latency time.Duration
+	next    atomic.Uint64
+}
+
+// SetFixtures puts scans in synthetic mode: instead of running Trivy they
+// replay the JSON reports in dir, each after latency, so the pipeline can
+// be load tested without Trivy or a registry. A target naming a fixture,
+// with or without its .json extension, replays that one; other targets go
+// through the fixtures in turn. It must be called before the first scan.
+func SetFixtures(dir string, latency time.Duration) error {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return err
+	}
+	if len(paths) == 0 {
+		return fmt.Errorf("no .json Trivy reports in %s", dir)
+	}
+	slices.Sort(paths)
+	fixtures = &fixtureSet{paths: paths, latency: latency}
+	return nil
+}
+
+// Fixtures returns the names of the replayed reports, nil unless scans are
+// synthetic.
+func Fixtures() []string {
+	if fixtures == nil {
+		return nil
+	}
+	names := make([]string, len(fixtures.paths))
+	for i, p := range fixtures.paths {
+		names[i] = strings.TrimSuffix(filepath.Base(p), ".json")
+	}
+	return names
+}
+
+// pick returns the fixture target names, or the next one in turn.
+func (f *fixtureSet) pick(target string) string {
+	name := strings.TrimSuffix(filepath.Base(target), ".json")
+	for _, p := range f.paths {
+		if strings.TrimSuffix(filepath.Base(p), ".json") == name {
+			return p
+		}
+	}
+	return f.paths[(f.next.Add(1)-1)%uint64(len(f.paths))]
+}
+
+// scan replays a fixture the way RunScanContext reads Trivy's output.
+func (f *fixtureSet) scan(ctx context.Context, target string) (*ScanResult, error) {
+	select {
+	case <-time.After(f.latency):
+	case <-ctx.Done():
+		return nil, errcode.Wrap(errcode.Timeout, ctx.Err())
+	}
+
+	file, err := os.Open(f.pick(target))
+	if err != nil {
+		return nil, errcode.Wrap(errcode.ScanFailed, err)
+	}
+	defer file.Close()
+
+	l := limits
+	raw := &headBuffer{max: l.MaxRawOutputBytes}
+	report, err := DecodeReport(io.TeeReader(&limitReader{r: file, max: l.MaxOutputBytes}, raw))
+	if err != nil {
+		return nil, err
+	}
+
+	result := &ScanResult{Report: report}
+	if raw.Truncated() {
+		result.RawOutput = report.JSON()
+	} else {
+		result.RawOutput = raw.String()
+	}
+	return result, nil
+}
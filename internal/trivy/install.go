@@ -0,0 +1,185 @@
+package trivy
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"cmp"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// DefaultVersion is the Trivy release Install downloads unless told
+// otherwise. Scans are tested against it.
+const DefaultVersion = "0.58.1"
+
+// DefaultDownloadURL is where Trivy releases are published.
+const DefaultDownloadURL = "https://github.com/aquasecurity/trivy/releases/download"
+
+// binary is the Trivy executable every command runs.
+var binary = "trivy"
+
+// SetBinary makes commands run the Trivy executable at path instead of the
+// one in PATH. It must be called before the first scan.
+func SetBinary(path string) {
+	binary = path
+}
+
+// Binary returns the Trivy executable commands run.
+func Binary() string {
+	return binary
+}
+
+// InstallOptions configures Install.
+type InstallOptions struct {
+	Dir         string // releases go to Dir/<version>/trivy
+	Version     string // defaults to DefaultVersion
+	DownloadURL string // defaults to DefaultDownloadURL; set for a mirror
+	SHA256      string // expected archive checksum; the release's checksum file is used when empty
+	HTTPClient  *http.Client
+}
+
+// Install returns the path of the Trivy binary of opts.Version in opts.Dir,
+// downloading the release archive and verifying its checksum first when it
+// is not there yet.
+func Install(ctx context.Context, opts InstallOptions) (string, error) {
+	version := strings.TrimPrefix(cmp.Or(opts.Version, DefaultVersion), "v")
+	dir := filepath.Join(opts.Dir, version)
+	bin := filepath.Join(dir, "trivy")
+	if info, err := os.Stat(bin); err == nil && info.Mode().IsRegular() {
+		return bin, nil
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return "", err
+	}
+
+	platform, err := releasePlatform(runtime.GOOS, runtime.GOARCH)
+	if err != nil {
+		return "", err
+	}
+	hc := opts.HTTPClient
+	if hc == nil {
+		hc = &http.Client{Timeout: 10 * time.Minute}
+	}
+	base := strings.TrimRight(cmp.Or(opts.DownloadURL, DefaultDownloadURL), "/") + "/v" + version + "/"
+	archive := fmt.Sprintf("trivy_%s_%s.tar.gz", version, platform)
+
+	want := strings.ToLower(opts.SHA256)
+	if want == "" {
+		sums, err := download(ctx, hc, base+fmt.Sprintf("trivy_%s_checksums.txt", version))
+		if err != nil {
+			return "", err
+		}
+		if want, err = findChecksum(sums, archive); err != nil {
+			return "", err
+		}
+	}
+
+	data, err := download(ctx, hc, base+archive)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	if got := hex.EncodeToString(sum[:]); got != want {
+		return "", fmt.Errorf("checksum mismatch for %s: got %s, want %s", archive, got, want)
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+	// Extract next to the final path and rename, so a crash never leaves a
+	// partial binary behind that the next start would trust.
+	tmp, err := os.CreateTemp(dir, ".trivy-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+	if err := extractBinary(data, tmp); err != nil {
+		tmp.Close()
+		return "", fmt.Errorf("%s: %w", archive, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return "", err
+	}
+	if err := os.Chmod(tmp.Name(), 0o755); err != nil {
+		return "", err
+	}
+	if err := os.Rename(tmp.Name(), bin); err != nil {
+		return "", err
+	}
+	return bin, nil
+}
+
+// releasePlatform names GOOS/GOARCH the way Trivy release archives do.
+func releasePlatform(goos, goarch string) (string, error) {
+	oses := map[string]string{"linux": "Linux", "darwin": "macOS", "freebsd": "FreeBSD"}
+	arches := map[string]string{"amd64": "64bit", "arm64": "ARM64", "386": "32bit", "arm": "ARM", "ppc64le": "PPC64LE", "s390x": "s390x"}
+	o, ok1 := oses[goos]
+	a, ok2 := arches[goarch]
+	if !ok1 || !ok2 {
+		return "", fmt.Errorf("no Trivy release for %s/%s; install Trivy in PATH", goos, goarch)
+	}
+	return o + "-" + a, nil
+}
+
+// findChecksum looks name up in a sha256sum-style checksum file.
+func findChecksum(sums []byte, name string) (string, error) {
+	sc := bufio.NewScanner(bytes.NewReader(sums))
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) == 2 && strings.TrimPrefix(fields[1], "*") == name {
+			return strings.ToLower(fields[0]), nil
+		}
+	}
+	return "", fmt.Errorf("%s is not in the release checksums", name)
+}
+
+func extractBinary(archive []byte, dst io.Writer) error {
+	gz, err := gzip.NewReader(bytes.NewReader(archive))
+	if err != nil {
+		return err
+	}
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return errors.New("no trivy binary in the archive")
+		}
+		if err != nil {
+			return err
+		}
+		if hdr.Typeflag == tar.TypeReg && path.Base(hdr.Name) == "trivy" {
+			_, err := io.Copy(dst, tr)
+			return err
+		}
+	}
+}
+
+func download(ctx context.Context, hc *http.Client, url string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := hc.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+	// Release archives are around 50 MB.
+	return io.ReadAll(io.LimitReader(resp.Body, 512<<20))
+}
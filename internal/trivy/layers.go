@@ -0,0 +1,160 @@
+package trivy
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Directories under the cache directory: layers holds a marker per layer
+// ever scanned, stacks the findings of each scanned layer stack.
+const (
+	layersDir = "layers"
+	stacksDir = "stacks"
+)
+
+var diffIDPattern = regexp.MustCompile(`^sha256:[0-9a-f]{64}$`)
+
+// ImageLayers identifies an image by the layers its registry lists.
+type ImageLayers struct {
+	ImageID    string   // digest of the image config
+	RepoDigest string   // repository@sha256:... of the manifest
+	DiffIDs    []string // base layer first
+}
+
+// LayerStats tells how much of an image earlier scans had seen.
+type LayerStats struct {
+	Layers int `json:"layers"`
+	// Known layers were in an earlier scan; Trivy reuses its analysis of
+	// them from the cache and only unpacks the rest.
+	Known int `json:"known"`
+	// Reused is set when an earlier scan covered every layer against the
+	// current DB, so its findings were used and Trivy did not run.
+	Reused bool `json:"reused"`
+}
+
+// stack is what SaveLayers keeps of a scan.
+type stack struct {
+	DB     time.Time `json:"db"`
+	Report *Report   `json:"report"`
+}
+
+// CachedScan returns the result of an earlier scan of the same layers as
+// img against the current DB, relabeled as a scan of target, or nil when
+// there is none. The stats tell how many of the layers were seen before.
+// Without a cache directory nothing is kept.
+func CachedScan(target string, img ImageLayers) (*ScanResult, LayerStats) {
+	stats := LayerStats{Layers: len(img.DiffIDs)}
+	if cacheDir == "" || !validDiffIDs(img.DiffIDs) {
+		return nil, stats
+	}
+	for _, id := range img.DiffIDs {
+		if _, err := os.Stat(layerPath(id)); err == nil {
+			stats.Known++
+		}
+	}
+	if stats.Known < stats.Layers {
+		return nil, stats
+	}
+
+	dbMu.RLock()
+	defer dbMu.RUnlock()
+	db := currentDB()
+	if db.IsZero() {
+		return nil, stats
+	}
+	data, err := os.ReadFile(stackPath(img.DiffIDs))
+	if err != nil {
+		return nil, stats
+	}
+	var s stack
+	if err := json.Unmarshal(data, &s); err != nil || !s.DB.Equal(db) || s.Report == nil {
+		return nil, stats
+	}
+
+	report := s.Report
+	report.ArtifactName = target
+	report.Metadata.ImageID = img.ImageID
+	report.Metadata.RepoDigests = nil
+	if img.RepoDigest != "" {
+		report.Metadata.RepoDigests = []string{img.RepoDigest}
+	}
+	stats.Reused = true
+	return &ScanResult{RawOutput: report.JSON(), Report: report, DB: db}, stats
+}
+
+// SaveLayers records the layers of a scanned image, and keeps its findings
+// for CachedScan when the DB they were matched against is known.
+func SaveLayers(result *ScanResult) error {
+	ids := result.Report.Metadata.DiffIDs
+	if cacheDir == "" || len(ids) == 0 || !validDiffIDs(ids) {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Join(cacheDir, layersDir), 0o755); err != nil {
+		return err
+	}
+	for _, id := range ids {
+		if err := os.WriteFile(layerPath(id), nil, 0o644); err != nil {
+			return err
+		}
+	}
+	if result.DB.IsZero() {
+		return nil
+	}
+
+	data, err := json.Marshal(stack{DB: result.DB, Report: result.Report})
+	if err != nil {
+		return err
+	}
+	dbMu.RLock()
+	defer dbMu.RUnlock()
+	if !currentDB().Equal(result.DB) {
+		// The DB changed since the scan; its findings are already stale.
+		return nil
+	}
+	path := stackPath(ids)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	// Write next to the final path and rename, so readers never see half
+	// a file.
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".stack-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func validDiffIDs(ids []string) bool {
+	for _, id := range ids {
+		if !diffIDPattern.MatchString(id) {
+			return false
+		}
+	}
+	return len(ids) > 0
+}
+
+func layerPath(diffID string) string {
+	return filepath.Join(cacheDir, layersDir, strings.TrimPrefix(diffID, "sha256:"))
+}
+
+// stackPath names the findings of a layer stack after a hash of its diff
+// IDs in order. Findings are kept per stack rather than per layer because
+// Trivy attributes OS packages by looking at every layer together.
+func stackPath(diffIDs []string) string {
+	sum := sha256.Sum256([]byte(strings.Join(diffIDs, "\n")))
+	return filepath.Join(cacheDir, stacksDir, hex.EncodeToString(sum[:])+".json")
+}
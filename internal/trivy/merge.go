@@ -0,0 +1,40 @@
+package trivy
+
+import "slices"
+
+// Merge combines the reports of several artifacts, such as the images of
+// one application, into one report named name. Each report's
+// ArtifactName must be set. A vulnerability of the same package version
+// found in several artifacts, typically through a shared base image, is
+// kept once, in the result it was first found in, with every artifact it
+// was found in listed in its Artifacts.
+func Merge(name string, reports []*Report) *Report {
+	out := &Report{ArtifactName: name}
+	type position struct{ result, vuln int }
+	seen := map[string]position{}
+	for _, r := range reports {
+		if out.ArtifactType == "" {
+			out.ArtifactType = r.ArtifactType
+		}
+		for _, res := range r.Results {
+			vulns := res.Vulnerabilities
+			res.Vulnerabilities = nil
+			out.Results = append(out.Results, res)
+			merged := &out.Results[len(out.Results)-1]
+			for _, v := range vulns {
+				key := v.VulnerabilityID + "|" + v.PkgName + "|" + v.InstalledVersion
+				if p, ok := seen[key]; ok {
+					first := &out.Results[p.result].Vulnerabilities[p.vuln]
+					if !slices.Contains(first.Artifacts, r.ArtifactName) {
+						first.Artifacts = append(first.Artifacts, r.ArtifactName)
+					}
+					continue
+				}
+				seen[key] = position{len(out.Results) - 1, len(merged.Vulnerabilities)}
+				v.Artifacts = []string{r.ArtifactName}
+				merged.Vulnerabilities = append(merged.Vulnerabilities, v)
+			}
+		}
+	}
+	return out
+}
@@ -0,0 +1,344 @@
+package trivy
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"weeklysec/internal/errcode"
+)
+
+// Report mirrors the subset of Trivy's JSON output that we rely on.
+type Report struct {
+	ArtifactName string   `json:"ArtifactName"`
+	ArtifactType string   `json:"ArtifactType"`
+	Metadata     Metadata `json:"Metadata,omitzero"`
+	Results      []Result `json:"Results"`
+}
+
+// Metadata describes the scanned artifact.
+type Metadata struct {
+	ImageID     string   `json:"ImageID,omitempty"`
+	RepoDigests []string `json:"RepoDigests,omitempty"` // repository@sha256:... the image was pulled as
+	DiffIDs     []string `json:"DiffIDs,omitempty"`     // uncompressed layer digests, base layer first
+}
+
+type Result struct {
+	Target            string             `json:"Target"`
+	Class             string             `json:"Class"`
+	Type              string             `json:"Type"`
+	Vulnerabilities   []Vulnerability    `json:"Vulnerabilities"`
+	Misconfigurations []Misconfiguration `json:"Misconfigurations,omitempty"`
+	Secrets           []Secret           `json:"Secrets,omitempty"`
+}
+
+// Secret is a credential found in a file of the target. Trivy's masked
+// match is not decoded, so the secret never leaves the raw report.
+type Secret struct {
+	RuleID    string      `json:"RuleID"`   // e.g. aws-access-key-id
+	Category  string      `json:"Category"` // e.g. AWS, GitHub
+	Severity  string      `json:"Severity"`
+	Title     string      `json:"Title"`
+	StartLine int         `json:"StartLine,omitempty"`
+	EndLine   int         `json:"EndLine,omitempty"`
+	Layer     SecretLayer `json:"Layer,omitzero"`
+
+	// File is the Target of the result the secret was found in, set by
+	// Report.Secrets.
+	File string `json:"-"`
+}
+
+// SecretLayer is the image layer that added a secret.
+type SecretLayer struct {
+	DiffID    string `json:"DiffID,omitempty"`
+	CreatedBy string `json:"CreatedBy,omitempty"` // the Dockerfile instruction
+}
+
+// Misconfiguration is a failed configuration check of a config scan, such
+// as a Dockerfile running as root. Its ID is Trivy's check ID and AVDID
+// the Aqua vulnerability database ID, e.g. DS002 and AVD-DS-0002.
+type Misconfiguration struct {
+	Type          string        `json:"Type,omitempty"` // e.g. "Dockerfile Security Check"
+	ID            string        `json:"ID"`
+	AVDID         string        `json:"AVDID,omitempty"`
+	Title         string        `json:"Title,omitempty"`
+	Description   string        `json:"Description,omitempty"`
+	Message       string        `json:"Message,omitempty"`
+	Resolution    string        `json:"Resolution,omitempty"`
+	Severity      string        `json:"Severity"`
+	PrimaryURL    string        `json:"PrimaryURL,omitempty"`
+	Status        string        `json:"Status,omitempty"` // FAIL; passed checks are dropped when decoding
+	CauseMetadata CauseMetadata `json:"CauseMetadata,omitzero"`
+
+	// File is the Target of the result the check failed in, set by
+	// Report.Misconfigurations.
+	File string `json:"-"`
+}
+
+// CauseMetadata locates a misconfiguration in its file.
+type CauseMetadata struct {
+	Resource  string `json:"Resource,omitempty"`
+	StartLine int    `json:"StartLine,omitempty"`
+	EndLine   int    `json:"EndLine,omitempty"`
+}
+
+// CheckID returns the AVD ID of m, falling back to its check ID.
+func (m Misconfiguration) CheckID() string {
+	if m.AVDID != "" {
+		return m.AVDID
+	}
+	return m.ID
+}
+
+type Vulnerability struct {
+	VulnerabilityID  string          `json:"VulnerabilityID"`
+	PkgName          string          `json:"PkgName"`
+	PkgIdentifier    PkgIdentifier   `json:"PkgIdentifier,omitzero"`
+	InstalledVersion string          `json:"InstalledVersion"`
+	FixedVersion     string          `json:"FixedVersion,omitempty"`
+	Severity         string          `json:"Severity"`
+	Title            string          `json:"Title,omitempty"`
+	Description      string          `json:"Description,omitempty"`
+	PrimaryURL       string          `json:"PrimaryURL,omitempty"`
+	CVSS             map[string]CVSS `json:"CVSS,omitempty"`
+	Layer            Layer           `json:"Layer,omitzero"` // image layer that added the package
+
+	// Artifacts are the artifacts of a merged report the vulnerability was
+	// found in; Trivy does not set it. See Merge.
+	Artifacts []string `json:"Artifacts,omitempty"`
+}
+
+// Layer identifies an image layer.
+type Layer struct {
+	Digest string `json:"Digest,omitempty"`
+	DiffID string `json:"DiffID,omitempty"`
+}
+
+// PkgIdentifier identifies the vulnerable package across tools.
+type PkgIdentifier struct {
+	PURL string `json:"PURL,omitempty"`
+}
+
+type CVSS struct {
+	V2Score float64 `json:"V2Score,omitempty"`
+	V3Score float64 `json:"V3Score,omitempty"`
+}
+
+// Score returns the highest CVSS v3 score reported by any source, falling
+// back to v2 when no v3 score is present.
+func (v Vulnerability) Score() float64 {
+	var v3, v2 float64
+	for _, c := range v.CVSS {
+		v3 = max(v3, c.V3Score)
+		v2 = max(v2, c.V2Score)
+	}
+	if v3 > 0 {
+		return v3
+	}
+	return v2
+}
+
+// Severities in descending order of importance.
+var Severities = []string{"CRITICAL", "HIGH", "MEDIUM", "LOW", "UNKNOWN"}
+
+// SeverityRank orders severities so that CRITICAL sorts first.
+func SeverityRank(severity string) int {
+	for i, s := range Severities {
+		if strings.EqualFold(s, severity) {
+			return i
+		}
+	}
+	return len(Severities) - 1
+}
+
+// ParseReport decodes Trivy's JSON output.
+func ParseReport(raw []byte) (*Report, error) {
+	return DecodeReport(bytes.NewReader(raw))
+}
+
+// DecodeReport reads Trivy's JSON output from r one vulnerability at a time,
+// keeping only the fields of Report, so the whole output is never held in
+// memory at once.
+func DecodeReport(r io.Reader) (*Report, error) {
+	dec := json.NewDecoder(r)
+	var report Report
+	err := decodeObject(dec, func(key string) error {
+		switch key {
+		case "ArtifactName":
+			return dec.Decode(&report.ArtifactName)
+		case "ArtifactType":
+			return dec.Decode(&report.ArtifactType)
+		case "Metadata":
+			return dec.Decode(&report.Metadata)
+		case "Results":
+			return decodeArray(dec, func() error {
+				res, err := decodeResult(dec)
+				report.Results = append(report.Results, res)
+				return err
+			})
+		}
+		return skipValue(dec)
+	})
+	var coded *errcode.Error
+	if errors.As(err, &coded) {
+		return nil, err
+	}
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, errcode.Wrap(errcode.InvalidReport, fmt.Errorf("failed to parse trivy report: %w", err))
+	}
+	return &report, nil
+}
+
+func decodeResult(dec *json.Decoder) (Result, error) {
+	var res Result
+	err := decodeObject(dec, func(key string) error {
+		switch key {
+		case "Target":
+			return dec.Decode(&res.Target)
+		case "Class":
+			return dec.Decode(&res.Class)
+		case "Type":
+			return dec.Decode(&res.Type)
+		case "Vulnerabilities":
+			return decodeArray(dec, func() error {
+				var v Vulnerability
+				if err := dec.Decode(&v); err != nil {
+					return err
+				}
+				res.Vulnerabilities = append(res.Vulnerabilities, v)
+				return nil
+			})
+		case "Misconfigurations":
+			return decodeArray(dec, func() error {
+				var m Misconfiguration
+				if err := dec.Decode(&m); err != nil {
+					return err
+				}
+				if m.Status == "" || m.Status == "FAIL" {
+					res.Misconfigurations = append(res.Misconfigurations, m)
+				}
+				return nil
+			})
+		case "Secrets":
+			return decodeArray(dec, func() error {
+				var s Secret
+				if err := dec.Decode(&s); err != nil {
+					return err
+				}
+				res.Secrets = append(res.Secrets, s)
+				return nil
+			})
+		}
+		return skipValue(dec)
+	})
+	return res, err
+}
+
+// decodeObject calls fn with each key of the object next in dec; fn must
+// consume the value. A null object has no keys.
+func decodeObject(dec *json.Decoder, fn func(key string) error) error {
+	tok, err := dec.Token()
+	if err != nil || tok == nil {
+		return err
+	}
+	if tok != json.Delim('{') {
+		return fmt.Errorf("expected an object, got %v", tok)
+	}
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		if err := fn(tok.(string)); err != nil {
+			return err
+		}
+	}
+	_, err = dec.Token()
+	return err
+}
+
+// decodeArray calls fn for each element of the array next in dec; fn must
+// consume the element. A null array has no elements.
+func decodeArray(dec *json.Decoder, fn func() error) error {
+	tok, err := dec.Token()
+	if err != nil || tok == nil {
+		return err
+	}
+	if tok != json.Delim('[') {
+		return fmt.Errorf("expected an array, got %v", tok)
+	}
+	for dec.More() {
+		if err := fn(); err != nil {
+			return err
+		}
+	}
+	_, err = dec.Token()
+	return err
+}
+
+// skipValue consumes the value next in dec without keeping it.
+func skipValue(dec *json.Decoder) error {
+	depth := 0
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		switch tok {
+		case json.Delim('{'), json.Delim('['):
+			depth++
+		case json.Delim('}'), json.Delim(']'):
+			depth--
+		}
+		if depth == 0 {
+			return nil
+		}
+	}
+}
+
+// JSON encodes the report in Trivy's format, without the fields Report
+// leaves out.
+func (r *Report) JSON() string {
+	data, _ := json.Marshal(r)
+	return string(data)
+}
+
+// Misconfigurations flattens the misconfigurations of every result, each
+// with the file it was found in.
+func (r *Report) Misconfigurations() []Misconfiguration {
+	var out []Misconfiguration
+	for _, res := range r.Results {
+		for _, m := range res.Misconfigurations {
+			m.File = res.Target
+			out = append(out, m)
+		}
+	}
+	return out
+}
+
+// Secrets flattens the secrets of every result, each with the file it was
+// found in.
+func (r *Report) Secrets() []Secret {
+	var out []Secret
+	for _, res := range r.Results {
+		for _, s := range res.Secrets {
+			s.File = res.Target
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// Vulnerabilities flattens the vulnerabilities of every result.
+func (r *Report) Vulnerabilities() []Vulnerability {
+	var vulns []Vulnerability
+	for _, res := range r.Results {
+		vulns = append(vulns, res.Vulnerabilities...)
+	}
+	return vulns
+}
@@ -0,0 +1,117 @@
+package trivy
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+	"time"
+	"weeklysec/internal/childenv"
+)
+
+// Sandbox confines the Trivy processes that scan targets, so a hostile
+// manifest or registry response that takes over Trivy cannot exhaust the
+// host, read the server's secrets or, for config scans, reach the network.
+type Sandbox struct {
+	// User runs Trivy as a user name or "uid[:gid]". The server has to
+	// run as root, and the user needs write access to the cache directory.
+	User string
+
+	MaxMemoryBytes int64         // address space; 0 is unlimited
+	MaxCPUTime     time.Duration // 0 is unlimited
+	MaxOpenFiles   int           // 0 keeps the server's limit
+	MaxFileBytes   int64         // largest file Trivy may write; 0 is unlimited
+
+	// Isolate runs Trivy in its own PID, IPC and UTS namespaces, and
+	// config scans, which need no network, without one. Linux only; an
+	// unprivileged server gets a user namespace mapping it to itself.
+	Isolate bool
+
+	// Env lists the variables Trivy inherits, with "PREFIX_*" matching
+	// every variable starting with PREFIX_; nil passes them all.
+	Env []string
+}
+
+// DefaultSandboxEnv passes Trivy what it needs to reach registries and DB
+// mirrors, and none of the server's own credentials: the cloud ones it
+// uses for blob storage and secrets stay behind, so registries take
+// TRIVY_USERNAME, TRIVY_PASSWORD or TRIVY_REGISTRY_TOKEN.
+var DefaultSandboxEnv = slices.Concat(childenv.Base, []string{"DOCKER_HOST", "TRIVY_*"})
+
+// DefaultSandbox is in effect until SetSandbox is called.
+var DefaultSandbox = Sandbox{
+	MaxMemoryBytes: 4 << 30,
+	MaxOpenFiles:   4096,
+	Env:            DefaultSandboxEnv,
+}
+
+// ids are the resolved user and group of Sandbox.User.
+type ids struct {
+	uid, gid uint32
+}
+
+var (
+	sandbox     = DefaultSandbox
+	sandboxUser *ids
+)
+
+// SetSandbox confines later scans to s. It must be called before the first
+// scan.
+func SetSandbox(s Sandbox) error {
+	var u *ids
+	if s.User != "" {
+		if os.Geteuid() != 0 {
+			return fmt.Errorf("running trivy as %s needs the server to run as root", s.User)
+		}
+		var err error
+		if u, err = lookupUser(s.User); err != nil {
+			return err
+		}
+	}
+	if err := checkPlatform(s); err != nil {
+		return err
+	}
+	sandbox, sandboxUser = s, u
+	return nil
+}
+
+// command returns a sandboxed Trivy command; network says whether it has
+// to reach registries or DB mirrors.
+func command(ctx context.Context, network bool, args ...string) *exec.Cmd {
+	s := sandbox
+	name := binary
+	// Limits are set by a shell that then becomes Trivy, so they are in
+	// place before Trivy reads anything.
+	if ulimit := s.ulimit(); ulimit != "" {
+		args = append([]string{"-c", ulimit + ` && exec "$@"`, "trivy", binary}, args...)
+		name = "/bin/sh"
+	}
+	cmd := exec.CommandContext(ctx, name, args...)
+	if s.Env != nil {
+		cmd.Env = childenv.Environ(s.Env)
+	}
+	confine(cmd, s, sandboxUser, network)
+	return cmd
+}
+
+// ulimit returns the shell commands setting the resource limits, "" with
+// none.
+func (s Sandbox) ulimit() string {
+	var cmds []string
+	if s.MaxMemoryBytes > 0 {
+		cmds = append(cmds, fmt.Sprintf("ulimit -v %d", max(s.MaxMemoryBytes>>10, 1)))
+	}
+	if s.MaxCPUTime > 0 {
+		cmds = append(cmds, fmt.Sprintf("ulimit -t %d", max(int64(s.MaxCPUTime/time.Second), 1)))
+	}
+	if s.MaxOpenFiles > 0 {
+		cmds = append(cmds, fmt.Sprintf("ulimit -n %d", s.MaxOpenFiles))
+	}
+	if s.MaxFileBytes > 0 {
+		cmds = append(cmds, fmt.Sprintf("ulimit -f %d", max(s.MaxFileBytes>>10, 1)))
+	}
+	// Some shells take one limit per ulimit.
+	return strings.Join(cmds, " && ")
+}
@@ -0,0 +1,59 @@
+package trivy
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"os/user"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+func checkPlatform(Sandbox) error { return nil }
+
+// lookupUser resolves a user name or "uid[:gid]".
+func lookupUser(name string) (*ids, error) {
+	uidStr, gidStr, hasGID := strings.Cut(name, ":")
+	if uid, err := strconv.ParseUint(uidStr, 10, 32); err == nil {
+		gid := uid
+		if hasGID {
+			if gid, err = strconv.ParseUint(gidStr, 10, 32); err != nil {
+				return nil, fmt.Errorf("invalid trivy group %q", gidStr)
+			}
+		}
+		return &ids{uid: uint32(uid), gid: uint32(gid)}, nil
+	}
+	u, err := user.Lookup(name)
+	if err != nil {
+		return nil, err
+	}
+	uid, _ := strconv.ParseUint(u.Uid, 10, 32)
+	gid, _ := strconv.ParseUint(u.Gid, 10, 32)
+	return &ids{uid: uint32(uid), gid: uint32(gid)}, nil
+}
+
+// confine applies the user and namespaces of s to cmd. Trivy runs in its
+// own process group, killed as a whole on cancel so helpers it started do
+// not outlive it, and dies with the server.
+func confine(cmd *exec.Cmd, s Sandbox, u *ids, network bool) {
+	attr := &syscall.SysProcAttr{Setpgid: true, Pdeathsig: syscall.SIGKILL}
+	if u != nil {
+		attr.Credential = &syscall.Credential{Uid: u.uid, Gid: u.gid, NoSetGroups: true}
+	}
+	if s.Isolate {
+		attr.Cloneflags = syscall.CLONE_NEWPID | syscall.CLONE_NEWIPC | syscall.CLONE_NEWUTS
+		if !network {
+			attr.Cloneflags |= syscall.CLONE_NEWNET
+		}
+		if euid := os.Geteuid(); euid != 0 {
+			attr.Cloneflags |= syscall.CLONE_NEWUSER
+			attr.UidMappings = []syscall.SysProcIDMap{{ContainerID: euid, HostID: euid, Size: 1}}
+			attr.GidMappings = []syscall.SysProcIDMap{{ContainerID: os.Getegid(), HostID: os.Getegid(), Size: 1}}
+		}
+	}
+	cmd.SysProcAttr = attr
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+}
@@ -0,0 +1,21 @@
+//go:build !linux
+
+package trivy
+
+import (
+	"errors"
+	"os/exec"
+)
+
+func checkPlatform(s Sandbox) error {
+	if s.Isolate {
+		return errors.New("isolating trivy in namespaces needs Linux")
+	}
+	return nil
+}
+
+func lookupUser(string) (*ids, error) {
+	return nil, errors.New("running trivy as another user needs Linux")
+}
+
+func confine(*exec.Cmd, Sandbox, *ids, bool) {}
@@ -3,38 +3,296 @@ package trivy
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"os"
 	"os/exec"
+	"strings"
 	"time"
+	"weeklysec/internal/errcode"
+	"weeklysec/internal/tracing"
+
+	"go.opentelemetry.io/otel/attribute"
 )
 
 type ScanResult struct {
+	// RawOutput is Trivy's JSON output, or the compact encoding of Report
+	// when the output was larger than Limits.MaxRawOutputBytes.
 	RawOutput string
+	Report    *Report
+
+	// DB is when the vulnerability DB the scan matched against was built;
+	// zero when scans update the DB themselves and it is not known.
+	DB time.Time
 }
 
+// Limits bounds the memory a scan's output may take.
+type Limits struct {
+	MaxOutputBytes    int64 // scans printing more fail; 0 is unlimited
+	MaxRawOutputBytes int64 // larger outputs are kept in compact form only
+}
+
+// DefaultLimits are the limits in effect until SetLimits is called.
+var DefaultLimits = Limits{MaxOutputBytes: 1 << 30, MaxRawOutputBytes: 32 << 20}
+
+var limits = DefaultLimits
+
+// SetLimits changes the limits of later scans. It must be called before the
+// first scan.
+func SetLimits(l Limits) {
+	limits = l
+}
+
+// maxStderr bounds the Trivy logs kept for error messages.
+const maxStderr = 64 << 10
+
 func RunScan(targetType, target string) (*ScanResult, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	return RunScanContext(context.Background(), targetType, target)
+}
+
+// RunScanContext is RunScan bound to ctx; the scan is still capped at 30s.
+// The output is parsed as Trivy prints it rather than buffered first.
+func RunScanContext(ctx context.Context, targetType, target string) (_ *ScanResult, err error) {
+	ctx, span := tracing.Start(ctx, "trivy.scan",
+		attribute.String("scan.target_type", targetType),
+		attribute.String("scan.target", target),
+	)
+	defer func() { tracing.End(span, err) }()
+
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
 	defer cancel()
 
-	var cmd *exec.Cmd
+	if f := fixtures; f != nil {
+		return f.scan(ctx, target)
+	}
+
+	var args []string
 	if targetType == "file" {
-		cmd = exec.CommandContext(ctx, "trivy", "config", "--format", "json", target)
+		args = append([]string{"config", "--format", "json"}, globalArgs()...)
+		if sandbox.Isolate {
+			// Without a network the embedded checks are all there is.
+			args = append(args, "--skip-check-update")
+		}
 	} else if targetType == "image" {
-		cmd = exec.CommandContext(ctx, "trivy", "image", "--format", "json", target)
+		args = append([]string{"image", "--format", "json"}, dbArgs()...)
+	} else if targetType == "fs" {
+		// Lockfiles and other dependency manifests on disk.
+		args = append([]string{"fs", "--scanners", "vuln", "--format", "json"}, dbArgs()...)
 	} else {
-		return nil, fmt.Errorf("invalid target type: %s", targetType)
+		return nil, errcode.Wrap(errcode.InvalidRequest, fmt.Errorf("invalid target type: %s", targetType))
 	}
+	// Filesystem scans only need the network to update the DB.
+	network := targetType == "image" || targetType == "fs" && !dbFresh.Load()
+	cmd := command(ctx, network, append(args, target)...)
 
-	var out bytes.Buffer
-	cmd.Stdout = &out
-	cmd.Stderr = &out
+	// Keep the DB in place until the scan is done with it.
+	dbMu.RLock()
+	defer dbMu.RUnlock()
 
-	err := cmd.Run()
+	// Keep stderr apart so progress logs don't corrupt the JSON report.
+	stderr := &headBuffer{max: maxStderr}
+	cmd.Stderr = stderr
+	stdout, err := cmd.StdoutPipe()
 	if err != nil {
-		return nil, fmt.Errorf("failed to run trivy scan: %w\n%s", err, out.String())
+		return nil, err
 	}
+	if err := cmd.Start(); err != nil {
+		return nil, classifyError(ctx, fmt.Errorf("failed to run trivy scan: %w", err), "")
+	}
+
+	l := limits
+	out := &limitReader{r: stdout, max: l.MaxOutputBytes}
+	raw := &headBuffer{max: l.MaxRawOutputBytes}
+	report, decodeErr := DecodeReport(io.TeeReader(out, raw))
+	// The decoder may finish a report it already read before seeing the
+	// read error, so the count decides.
+	tooLarge := out.exceeded()
+	if tooLarge {
+		cancel()
+	}
+	// Let Trivy finish; anything after the report is ignored.
+	_, _ = io.Copy(io.Discard, stdout)
+	waitErr := cmd.Wait()
 
-	return &ScanResult{
-		RawOutput: out.String(),
-	}, nil
+	switch {
+	case tooLarge:
+		return nil, errcode.Wrap(errcode.ScanFailed, fmt.Errorf("trivy output exceeds the %d byte limit", l.MaxOutputBytes))
+	case waitErr != nil:
+		return nil, classifyError(ctx, fmt.Errorf("failed to run trivy scan: %w\n%s", waitErr, stderr.String()), stderr.String())
+	case decodeErr != nil:
+		return nil, decodeErr
+	}
+
+	result := &ScanResult{Report: report, DB: currentDB()}
+	if raw.Truncated() {
+		result.RawOutput = report.JSON()
+	} else {
+		result.RawOutput = raw.String()
+	}
+	return result, nil
+}
+
+var errOutputTooLarge = errors.New("trivy output too large")
+
+// limitReader fails reads past max bytes, unless max is 0.
+type limitReader struct {
+	r   io.Reader
+	max int64
+	n   int64
+}
+
+func (l *limitReader) Read(p []byte) (int, error) {
+	n, err := l.r.Read(p)
+	l.n += int64(n)
+	if l.exceeded() {
+		return n, errOutputTooLarge
+	}
+	return n, err
+}
+
+func (l *limitReader) exceeded() bool {
+	return l.max > 0 && l.n > l.max
+}
+
+// headBuffer keeps the first max bytes written to it, or all of them when
+// max is 0, and drops the rest.
+type headBuffer struct {
+	buf       bytes.Buffer
+	max       int64
+	truncated bool
+}
+
+func (b *headBuffer) Write(p []byte) (int, error) {
+	if room := b.max - int64(b.buf.Len()); b.max > 0 && int64(len(p)) > room {
+		b.buf.Write(p[:max(room, 0)])
+		b.truncated = true
+		return len(p), nil
+	}
+	return b.buf.Write(p)
+}
+
+func (b *headBuffer) String() string { return b.buf.String() }
+
+// Truncated reports whether anything was dropped.
+func (b *headBuffer) Truncated() bool { return b.truncated }
+
+// unreachableMarkers are stderr fragments Trivy prints when it cannot fetch
+// the target at all, as opposed to failing while analyzing it.
+var unreachableMarkers = []string{
+	"no such file or directory",
+	"no such host",
+	"connection refused",
+	"unable to inspect the image",
+	"could not find",
+	"manifest unknown",
+	"unauthorized",
+	"denied",
+}
+
+func classifyError(ctx context.Context, err error, stderr string) error {
+	var exitErr *exec.ExitError
+	switch {
+	case errors.Is(err, exec.ErrNotFound):
+		return errcode.Wrap(errcode.TrivyNotFound, err)
+	case errors.As(err, &exitErr) && exitErr.ExitCode() == 127 && sandbox.ulimit() != "":
+		// The shell setting the limits could not find Trivy.
+		return errcode.Wrap(errcode.TrivyNotFound, err)
+	case ctx.Err() == context.DeadlineExceeded:
+		return errcode.Wrap(errcode.Timeout, err)
+	}
+
+	lower := strings.ToLower(stderr)
+	for _, marker := range unreachableMarkers {
+		if strings.Contains(lower, marker) {
+			return errcode.Wrap(errcode.TargetUnreachable, err)
+		}
+	}
+	return errcode.Wrap(errcode.ScanFailed, err)
+}
+
+// GenerateSBOM returns a CycloneDX JSON SBOM of the target.
+func GenerateSBOM(ctx context.Context, targetType, target string) (_ []byte, err error) {
+	ctx, span := tracing.Start(ctx, "trivy.sbom",
+		attribute.String("scan.target_type", targetType),
+		attribute.String("scan.target", target),
+	)
+	defer func() { tracing.End(span, err) }()
+
+	ctx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+
+	var args []string
+	switch targetType {
+	case "file":
+		args = []string{"fs", "--format", "cyclonedx"}
+	case "image":
+		args = []string{"image", "--format", "cyclonedx"}
+	default:
+		return nil, errcode.Wrap(errcode.InvalidRequest, fmt.Errorf("invalid target type: %s", targetType))
+	}
+	args = append(append(args, dbArgs()...), target)
+	cmd := command(ctx, true, args...)
+
+	dbMu.RLock()
+	defer dbMu.RUnlock()
+
+	out := &headBuffer{max: limits.MaxOutputBytes}
+	stderr := &headBuffer{max: maxStderr}
+	cmd.Stdout = out
+	cmd.Stderr = stderr
+	if err := cmd.Run(); err != nil {
+		return nil, classifyError(ctx, fmt.Errorf("failed to generate SBOM: %w\n%s", err, stderr.String()), stderr.String())
+	}
+	if out.Truncated() {
+		return nil, errcode.Wrap(errcode.ScanFailed, fmt.Errorf("SBOM exceeds the %d byte limit", limits.MaxOutputBytes))
+	}
+	return out.buf.Bytes(), nil
+}
+
+// ScanSBOM matches a CycloneDX SBOM against the current vulnerability DB,
+// so advisories published since the target was scanned show up without
+// scanning it again.
+func ScanSBOM(ctx context.Context, bom []byte) (_ *Report, err error) {
+	ctx, span := tracing.Start(ctx, "trivy.sbom_scan")
+	defer func() { tracing.End(span, err) }()
+
+	ctx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+
+	f, err := os.CreateTemp("", "weeklysec-sbom-*.cdx.json")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(f.Name())
+	_, err = f.Write(bom)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return nil, err
+	}
+	// The sandbox user must be able to read it.
+	if err := os.Chmod(f.Name(), 0o644); err != nil {
+		return nil, err
+	}
+
+	args := append(append([]string{"sbom", "--format", "json"}, dbArgs()...), f.Name())
+	// Without a fresh DB of its own Trivy downloads one.
+	cmd := command(ctx, !dbFresh.Load(), args...)
+
+	dbMu.RLock()
+	defer dbMu.RUnlock()
+
+	out := &headBuffer{max: limits.MaxOutputBytes}
+	stderr := &headBuffer{max: maxStderr}
+	cmd.Stdout = out
+	cmd.Stderr = stderr
+	if err := cmd.Run(); err != nil {
+		return nil, classifyError(ctx, fmt.Errorf("failed to scan SBOM: %w\n%s", err, stderr.String()), stderr.String())
+	}
+	if out.Truncated() {
+		return nil, errcode.Wrap(errcode.ScanFailed, fmt.Errorf("trivy output exceeds the %d byte limit", limits.MaxOutputBytes))
+	}
+	return ParseReport(out.buf.Bytes())
 }
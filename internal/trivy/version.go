@@ -0,0 +1,48 @@
+package trivy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"time"
+)
+
+// VersionInfo is the output of `trivy version --format json`.
+type VersionInfo struct {
+	Version         string  `json:"Version"`
+	VulnerabilityDB *DBInfo `json:"VulnerabilityDB,omitempty"`
+}
+
+type DBInfo struct {
+	Version      int       `json:"Version"`
+	UpdatedAt    time.Time `json:"UpdatedAt"`
+	NextUpdate   time.Time `json:"NextUpdate"`
+	DownloadedAt time.Time `json:"DownloadedAt"`
+}
+
+// Version reports the installed Trivy version and vulnerability DB metadata.
+func Version(ctx context.Context) (*VersionInfo, error) {
+	if fixtures != nil {
+		return &VersionInfo{Version: "synthetic"}, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	var out, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, binary, append([]string{"version", "--format", "json"}, globalArgs()...)...)
+	cmd.Stdout = &out
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("failed to run trivy version: %w\n%s", err, stderr.String())
+	}
+
+	var info VersionInfo
+	if err := json.Unmarshal(out.Bytes(), &info); err != nil {
+		return nil, fmt.Errorf("failed to parse trivy version: %w", err)
+	}
+	return &info, nil
+}
@@ -0,0 +1,189 @@
+package vex
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// cvePattern matches the IDs CSAF accepts in a vulnerability's cve field.
+var cvePattern = regexp.MustCompile(`^CVE-[0-9]{4}-[0-9]{4,}$`)
+
+// CSAFDocument is a CSAF 2.0 document of the VEX profile.
+type CSAFDocument struct {
+	Document        CSAFMeta            `json:"document"`
+	ProductTree     CSAFProductTree     `json:"product_tree"`
+	Vulnerabilities []CSAFVulnerability `json:"vulnerabilities"`
+}
+
+type CSAFMeta struct {
+	Category    string        `json:"category"`
+	CSAFVersion string        `json:"csaf_version"`
+	Publisher   CSAFPublisher `json:"publisher"`
+	Title       string        `json:"title"`
+	Tracking    CSAFTracking  `json:"tracking"`
+}
+
+type CSAFPublisher struct {
+	Category  string `json:"category"`
+	Name      string `json:"name"`
+	Namespace string `json:"namespace"`
+}
+
+type CSAFTracking struct {
+	ID                 string         `json:"id"`
+	Status             string         `json:"status"`
+	Version            string         `json:"version"`
+	InitialReleaseDate time.Time      `json:"initial_release_date"`
+	CurrentReleaseDate time.Time      `json:"current_release_date"`
+	RevisionHistory    []CSAFRevision `json:"revision_history"`
+}
+
+type CSAFRevision struct {
+	Date    time.Time `json:"date"`
+	Number  string    `json:"number"`
+	Summary string    `json:"summary"`
+}
+
+type CSAFProductTree struct {
+	FullProductNames []CSAFProduct `json:"full_product_names"`
+}
+
+type CSAFProduct struct {
+	Name                        string             `json:"name"`
+	ProductID                   string             `json:"product_id"`
+	ProductIdentificationHelper *CSAFProductHelper `json:"product_identification_helper,omitempty"`
+}
+
+type CSAFProductHelper struct {
+	PURL string `json:"purl"`
+}
+
+type CSAFVulnerability struct {
+	CVE           string            `json:"cve,omitempty"`
+	IDs           []CSAFID          `json:"ids,omitempty"` // for IDs other than CVEs
+	Title         string            `json:"title,omitempty"`
+	ProductStatus CSAFProductStatus `json:"product_status"`
+	Flags         []CSAFGroup       `json:"flags,omitempty"`
+	Threats       []CSAFGroup       `json:"threats,omitempty"`
+	Remediations  []CSAFGroup       `json:"remediations,omitempty"`
+}
+
+type CSAFID struct {
+	SystemName string `json:"system_name"`
+	Text       string `json:"text"`
+}
+
+type CSAFProductStatus struct {
+	KnownAffected    []string `json:"known_affected,omitempty"`
+	KnownNotAffected []string `json:"known_not_affected,omitempty"`
+	Fixed            []string `json:"fixed,omitempty"`
+}
+
+// CSAFGroup is a flag, threat or remediation: a label or category with
+// details, for some products.
+type CSAFGroup struct {
+	Label      string   `json:"label,omitempty"`
+	Category   string   `json:"category,omitempty"`
+	Details    string   `json:"details,omitempty"`
+	ProductIDs []string `json:"product_ids"`
+}
+
+// CSAF renders statements about a product as a CSAF VEX document. Each
+// vulnerable package of the product is a product of the tree.
+func CSAF(m Meta, product Product, statements []Statement) *CSAFDocument {
+	doc := &CSAFDocument{
+		Document: CSAFMeta{
+			Category:    "csaf_vex",
+			CSAFVersion: "2.0",
+			Publisher:   CSAFPublisher{Category: "vendor", Name: m.Author, Namespace: m.Namespace},
+			Title:       m.Title,
+			Tracking: CSAFTracking{
+				ID:                 m.ID,
+				Status:             "final",
+				Version:            "1",
+				InitialReleaseDate: m.Timestamp,
+				CurrentReleaseDate: m.Timestamp,
+				RevisionHistory:    []CSAFRevision{{Date: m.Timestamp, Number: "1", Summary: "Initial version."}},
+			},
+		},
+		ProductTree:     CSAFProductTree{FullProductNames: []CSAFProduct{}},
+		Vulnerabilities: []CSAFVulnerability{},
+	}
+
+	productIDs := map[string]string{}
+	productOf := func(p Package) string {
+		if id, ok := productIDs[p.ID()]; ok {
+			return id
+		}
+		id := fmt.Sprintf("CSAFPID-%04d", len(productIDs)+1)
+		productIDs[p.ID()] = id
+		entry := CSAFProduct{Name: product.Name + " " + p.ID(), ProductID: id}
+		if p.PURL != "" {
+			entry.ProductIdentificationHelper = &CSAFProductHelper{PURL: p.PURL}
+		}
+		doc.ProductTree.FullProductNames = append(doc.ProductTree.FullProductNames, entry)
+		return id
+	}
+
+	// Statements come sorted by vulnerability, so each one's run of
+	// statements becomes one entry.
+	var cur *CSAFVulnerability
+	for _, s := range statements {
+		if cur == nil || vulnerabilityID(*cur) != s.VulnerabilityID {
+			doc.Vulnerabilities = append(doc.Vulnerabilities, newCSAFVulnerability(s))
+			cur = &doc.Vulnerabilities[len(doc.Vulnerabilities)-1]
+		}
+		id := productOf(s.Package)
+		switch s.Status {
+		case StatusAffected:
+			cur.ProductStatus.KnownAffected = append(cur.ProductStatus.KnownAffected, id)
+			category := "none_available"
+			switch {
+			case s.Accepted:
+				category = "no_fix_planned"
+			case s.FixedVersion != "":
+				category = "vendor_fix"
+			}
+			cur.Remediations = append(cur.Remediations, CSAFGroup{Category: category, Details: s.ActionStatement, ProductIDs: []string{id}})
+		case StatusNotAffected:
+			cur.ProductStatus.KnownNotAffected = append(cur.ProductStatus.KnownNotAffected, id)
+			cur.Flags = append(cur.Flags, CSAFGroup{Label: s.Justification, ProductIDs: []string{id}})
+			cur.Threats = append(cur.Threats, CSAFGroup{Category: "impact", Details: s.ImpactStatement, ProductIDs: []string{id}})
+		case StatusFixed:
+			cur.ProductStatus.Fixed = append(cur.ProductStatus.Fixed, id)
+		}
+	}
+	return doc
+}
+
+func newCSAFVulnerability(s Statement) CSAFVulnerability {
+	v := CSAFVulnerability{Title: s.Title}
+	if cvePattern.MatchString(s.VulnerabilityID) {
+		v.CVE = s.VulnerabilityID
+	} else {
+		v.IDs = []CSAFID{{SystemName: idSystem(s.VulnerabilityID), Text: s.VulnerabilityID}}
+	}
+	return v
+}
+
+func vulnerabilityID(v CSAFVulnerability) string {
+	if v.CVE != "" {
+		return v.CVE
+	}
+	return v.IDs[0].Text
+}
+
+// idSystem names the database an advisory ID comes from.
+func idSystem(id string) string {
+	switch {
+	case strings.HasPrefix(id, "GHSA-"):
+		return "GitHub Security Advisories"
+	case strings.HasPrefix(id, "GO-"):
+		return "Go Vulnerability Database"
+	case strings.HasPrefix(id, "RUSTSEC-"):
+		return "RustSec Advisory Database"
+	}
+	return "Trivy"
+}
@@ -0,0 +1,69 @@
+package vex
+
+import "time"
+
+// OpenVEXContext is the OpenVEX specification version documents follow.
+const OpenVEXContext = "https://openvex.dev/ns/v0.2.0"
+
+// OpenVEXDocument is an OpenVEX document.
+type OpenVEXDocument struct {
+	Context    string             `json:"@context"`
+	ID         string             `json:"@id"`
+	Author     string             `json:"author"`
+	Timestamp  time.Time          `json:"timestamp"`
+	Version    int                `json:"version"`
+	Tooling    string             `json:"tooling,omitempty"`
+	Statements []OpenVEXStatement `json:"statements"`
+}
+
+type OpenVEXStatement struct {
+	Vulnerability   OpenVEXVulnerability `json:"vulnerability"`
+	Products        []OpenVEXProduct     `json:"products"`
+	Status          string               `json:"status"`
+	Justification   string               `json:"justification,omitempty"`
+	ImpactStatement string               `json:"impact_statement,omitempty"`
+	ActionStatement string               `json:"action_statement,omitempty"`
+	Timestamp       time.Time            `json:"timestamp"`
+}
+
+type OpenVEXVulnerability struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+}
+
+type OpenVEXProduct struct {
+	ID            string             `json:"@id"`
+	Subcomponents []OpenVEXComponent `json:"subcomponents,omitempty"`
+}
+
+type OpenVEXComponent struct {
+	ID string `json:"@id"`
+}
+
+// OpenVEX renders statements about a product as an OpenVEX document.
+func OpenVEX(m Meta, product Product, statements []Statement) *OpenVEXDocument {
+	doc := &OpenVEXDocument{
+		Context:    OpenVEXContext,
+		ID:         m.ID,
+		Author:     m.Author,
+		Timestamp:  m.Timestamp,
+		Version:    1,
+		Tooling:    "weeklysec",
+		Statements: []OpenVEXStatement{},
+	}
+	for _, s := range statements {
+		doc.Statements = append(doc.Statements, OpenVEXStatement{
+			Vulnerability: OpenVEXVulnerability{Name: s.VulnerabilityID, Description: s.Title},
+			Products: []OpenVEXProduct{{
+				ID:            product.ID,
+				Subcomponents: []OpenVEXComponent{{ID: s.Package.ID()}},
+			}},
+			Status:          s.Status,
+			Justification:   s.Justification,
+			ImpactStatement: s.ImpactStatement,
+			ActionStatement: s.ActionStatement,
+			Timestamp:       s.Timestamp,
+		})
+	}
+	return doc
+}
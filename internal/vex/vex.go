@@ -0,0 +1,185 @@
+// Package vex states what a scan means for its target as VEX
+// (Vulnerability Exploitability eXchange) statements: which findings
+// affect it, which are fixed and which do not apply. They render as OpenVEX
+// or CSAF VEX documents, which downstream consumers and scanners (Trivy's
+// --vex, for one) can read.
+package vex
+
+import (
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+	"time"
+	"weeklysec/internal/agent"
+	"weeklysec/internal/digest"
+	"weeklysec/internal/registry"
+	"weeklysec/internal/store"
+	"weeklysec/internal/trivy"
+)
+
+// Statuses a product can have for a vulnerability.
+const (
+	StatusAffected    = "affected"
+	StatusNotAffected = "not_affected"
+	StatusFixed       = "fixed"
+)
+
+// Justifications are the reasons a product can be not_affected. OpenVEX and
+// CSAF name them alike.
+var Justifications = []string{
+	"component_not_present",
+	"vulnerable_code_not_present",
+	"vulnerable_code_not_in_execute_path",
+	"vulnerable_code_cannot_be_controlled_by_adversary",
+	"inline_mitigations_already_exist",
+}
+
+// Meta describes a document.
+type Meta struct {
+	ID        string // IRI of the document
+	Author    string
+	Namespace string // URL of the publisher, for CSAF
+	Title     string
+	Timestamp time.Time
+}
+
+// Product is a scanned target.
+type Product struct {
+	ID   string // package URL for images, the path for files
+	Name string
+}
+
+// Package is the vulnerable component of a product.
+type Package struct {
+	Name    string
+	Version string
+	PURL    string
+}
+
+// ID identifies the package: its package URL when Trivy reported one.
+func (p Package) ID() string {
+	switch {
+	case p.PURL != "":
+		return p.PURL
+	case p.Version != "":
+		return p.Name + "@" + p.Version
+	}
+	return p.Name
+}
+
+// Statement is the status of one vulnerability in one package.
+type Statement struct {
+	VulnerabilityID string
+	Title           string
+	Package         Package
+	Status          string
+	Justification   string // why it is not_affected
+	ImpactStatement string // free-text detail on the status
+	ActionStatement string // what to do when affected
+	FixedVersion    string
+	Accepted        bool // affected, with the risk accepted
+	Timestamp       time.Time
+}
+
+// ProductOf identifies the target of a scan.
+func ProductOf(scan *store.Scan) Product {
+	if scan.TargetType != "image" {
+		return Product{ID: scan.Target, Name: scan.Target}
+	}
+	ref := registry.Parse(scan.Target)
+	q := url.Values{"repository_url": {ref.Repository}}
+	if ref.Tag != "" {
+		q.Set("tag", ref.Tag)
+	}
+	id := "pkg:oci/" + path.Base(ref.Repository)
+	if ref.Digest != "" {
+		id += "@" + strings.ReplaceAll(ref.Digest, ":", "%3A")
+	}
+	return Product{ID: id + "?" + q.Encode(), Name: scan.Target}
+}
+
+// Statements describes a scan. Open findings are affected. Accepted risks
+// are not_affected when their suppression gives a VEX justification and
+// affected otherwise, with the acceptance as the action. Findings of the
+// target the lifecycle had marked fixed by the time of the scan are fixed.
+func Statements(scan *store.Scan, findings []store.Finding) []Statement {
+	var out []Statement
+	for _, v := range digest.Open(scan) {
+		s := statement(scan, v, StatusAffected)
+		if v.FixedVersion != "" {
+			s.ActionStatement = "Upgrade " + v.PkgName + " to " + v.FixedVersion + " or later."
+		} else {
+			s.ActionStatement = "No fixed version is available yet; mitigate or accept the risk."
+		}
+		out = append(out, s)
+	}
+
+	if scan.Response != nil && scan.Response.AcceptedRisk != nil {
+		vulns := map[string]trivy.Vulnerability{}
+		for _, v := range scan.Vulnerabilities {
+			vulns[digest.FindingKey(v)] = v
+		}
+		for _, a := range scan.Response.AcceptedRisk.Findings {
+			v := trivy.Vulnerability{VulnerabilityID: a.VulnerabilityID, PkgName: a.PkgName}
+			if found, ok := vulns[digest.FindingKey(v)]; ok {
+				v = found
+			}
+			out = append(out, accepted(scan, v, a))
+		}
+	}
+
+	key := scan.TargetKey()
+	for _, f := range findings {
+		if f.TargetKey != key || f.State != store.StateFixed || f.FixedAt == nil || f.FixedAt.After(scan.CreatedAt) {
+			continue
+		}
+		out = append(out, Statement{
+			VulnerabilityID: f.VulnerabilityID,
+			Title:           f.Title,
+			Package:         Package{Name: f.PkgName},
+			Status:          StatusFixed,
+			ImpactStatement: "No longer found since " + f.FixedAt.UTC().Format(time.DateOnly) + ".",
+			Timestamp:       f.FixedAt.UTC(),
+		})
+	}
+
+	sort.SliceStable(out, func(i, j int) bool {
+		if out[i].VulnerabilityID != out[j].VulnerabilityID {
+			return out[i].VulnerabilityID < out[j].VulnerabilityID
+		}
+		return out[i].Package.ID() < out[j].Package.ID()
+	})
+	return out
+}
+
+func statement(scan *store.Scan, v trivy.Vulnerability, status string) Statement {
+	return Statement{
+		VulnerabilityID: v.VulnerabilityID,
+		Title:           v.Title,
+		Package:         Package{Name: v.PkgName, Version: v.InstalledVersion, PURL: v.PkgIdentifier.PURL},
+		Status:          status,
+		FixedVersion:    v.FixedVersion,
+		Timestamp:       scan.CreatedAt.UTC(),
+	}
+}
+
+// accepted describes a finding covered by a suppression.
+func accepted(scan *store.Scan, v trivy.Vulnerability, a agent.AcceptedFinding) Statement {
+	decision := a.Justification + " (approved by " + a.Approver
+	if a.ExpiresAt != nil {
+		decision += " until " + a.ExpiresAt.UTC().Format(time.DateOnly)
+	}
+	decision += ")"
+
+	if a.VEXJustification != "" {
+		s := statement(scan, v, StatusNotAffected)
+		s.Justification = a.VEXJustification
+		s.ImpactStatement = decision
+		return s
+	}
+	s := statement(scan, v, StatusAffected)
+	s.ActionStatement = "Risk accepted: " + decision
+	s.Accepted = true
+	return s
+}
@@ -0,0 +1,144 @@
+// Package watch matches changes in a target's findings against CVE and
+// package subscriptions: a fix released for a finding that had none, or a
+// new advisory affecting a package already deployed.
+package watch
+
+import (
+	"fmt"
+	"path"
+	"slices"
+	"time"
+	"weeklysec/internal/trivy"
+)
+
+// Change kinds.
+const (
+	KindFixAvailable = "fix_available" // a finding without a fix now has one
+	KindNewAdvisory  = "new_advisory"  // a stored SBOM matches a vulnerability it did not before
+)
+
+// Kinds lists the change kinds a subscription can ask for.
+var Kinds = []string{KindFixAvailable, KindNewAdvisory}
+
+// Subscription asks to be told about changes to the findings of one CVE or
+// package in the tenant's targets.
+type Subscription struct {
+	ID              string    `json:"id"`
+	Org             string    `json:"org"`
+	Project         string    `json:"project"`
+	VulnerabilityID string    `json:"vulnerability_id,omitempty"` // empty matches all
+	Package         string    `json:"package,omitempty"`          // exact name or glob; empty matches all
+	Target          string    `json:"target,omitempty"`           // exact target or glob; empty matches all
+	Kinds           []string  `json:"kinds,omitempty"`            // empty is every kind
+	WebhookURL      string    `json:"webhook_url,omitempty"`
+	WebhookSecret   string    `json:"webhook_secret,omitempty"` // signs deliveries; write-only, see Redacted
+	Email           []string  `json:"email,omitempty"`
+	CreatedBy       string    `json:"created_by,omitempty"`
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+// Redacted returns s without its webhook secret, for API responses and
+// audit records.
+func (s Subscription) Redacted() Subscription {
+	if s.WebhookSecret != "" {
+		s.WebhookSecret = "redacted"
+	}
+	return s
+}
+
+// Matches reports whether the subscription covers change c.
+func (s Subscription) Matches(c Change) bool {
+	if len(s.Kinds) > 0 && !slices.Contains(s.Kinds, c.Kind) {
+		return false
+	}
+	if s.VulnerabilityID != "" && s.VulnerabilityID != c.VulnerabilityID {
+		return false
+	}
+	return globMatch(s.Package, c.PkgName) && globMatch(s.Target, c.Target)
+}
+
+func globMatch(pattern, s string) bool {
+	if pattern == "" || pattern == s {
+		return true
+	}
+	ok, _ := path.Match(pattern, s)
+	return ok
+}
+
+// Change is one finding that changed in a way subscribers care about.
+type Change struct {
+	Kind             string  `json:"kind"`
+	ScanID           string  `json:"scan_id"` // the scan whose SBOM or findings changed
+	Target           string  `json:"target"`
+	VulnerabilityID  string  `json:"vulnerability_id"`
+	PkgName          string  `json:"pkg_name"`
+	InstalledVersion string  `json:"installed_version"`
+	FixedVersion     string  `json:"fixed_version,omitempty"`
+	Severity         string  `json:"severity"`
+	CVSSScore        float64 `json:"cvss_score,omitempty"`
+	Title            string  `json:"title,omitempty"`
+}
+
+// Summary describes c in one line.
+func (c Change) Summary() string {
+	switch c.Kind {
+	case KindFixAvailable:
+		return fmt.Sprintf("%s in %s %s: fixed in %s", c.VulnerabilityID, c.PkgName, c.InstalledVersion, c.FixedVersion)
+	default:
+		return fmt.Sprintf("%s (%s) affects %s %s", c.VulnerabilityID, c.Severity, c.PkgName, c.InstalledVersion)
+	}
+}
+
+// Key identifies c for deduplication, per target.
+func (c Change) Key(targetKey string) string {
+	return c.Kind + "|" + targetKey + "|" + c.VulnerabilityID + "|" + c.PkgName
+}
+
+// Known is what was last recorded of a target's open findings: the fixed
+// version of each, by vulnerability ID and package.
+type Known map[string]string
+
+// KnownKey is the key of v in Known.
+func KnownKey(vulnerabilityID, pkgName string) string {
+	return vulnerabilityID + "|" + pkgName
+}
+
+// Diff returns the changes between known and vulns found in target by
+// scanID. New findings are only reported when newAdvisories is set: in a
+// regular scan they may just as well come from a changed target.
+func Diff(known Known, scanID, target string, vulns []trivy.Vulnerability, newAdvisories bool) []Change {
+	var out []Change
+	seen := map[string]bool{}
+	for _, v := range vulns {
+		k := KnownKey(v.VulnerabilityID, v.PkgName)
+		if seen[k] {
+			continue
+		}
+		seen[k] = true
+
+		fixed, ok := known[k]
+		kind := ""
+		switch {
+		case !ok && newAdvisories:
+			kind = KindNewAdvisory
+		case ok && fixed == "" && v.FixedVersion != "":
+			kind = KindFixAvailable
+		default:
+			continue
+		}
+		out = append(out, Change{
+			Kind:             kind,
+			ScanID:           scanID,
+			Target:           target,
+			VulnerabilityID:  v.VulnerabilityID,
+			PkgName:          v.PkgName,
+			InstalledVersion: v.InstalledVersion,
+			FixedVersion:     v.FixedVersion,
+			Severity:         v.Severity,
+			CVSSScore:        v.Score(),
+			Title:            v.Title,
+		})
+	}
+	return out
+}
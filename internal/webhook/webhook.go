@@ -0,0 +1,336 @@
+package webhook
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+	"weeklysec/internal/agent"
+	"weeklysec/internal/digest"
+	"weeklysec/internal/store"
+	"weeklysec/internal/watch"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Event types.
+const (
+	EventScanCompleted = "scan.completed"
+	EventScanFailed    = "scan.failed"
+	EventDigest        = "digest.created"
+	EventWatch         = "watch.triggered"
+)
+
+// Headers set on every delivery.
+const (
+	HeaderEvent     = "X-Weeklysec-Event"
+	HeaderDelivery  = "X-Weeklysec-Delivery"
+	HeaderTimestamp = "X-Weeklysec-Timestamp"
+	HeaderSignature = "X-Weeklysec-Signature"
+)
+
+// Event is the JSON body POSTed to webhook endpoints.
+type Event struct {
+	ID        string               `json:"id"`
+	Type      string               `json:"type"`
+	Timestamp time.Time            `json:"timestamp"`
+	ScanID    string               `json:"scan_id,omitempty"`
+	Target    string               `json:"target,omitempty"`
+	Status    string               `json:"status,omitempty"`
+	Error     string               `json:"error,omitempty"`
+	Analysis  *agent.Analysis      `json:"analysis,omitempty"`
+	Response  *agent.AgentResponse `json:"response,omitempty"` // omitted in summary mode
+	Digest    *digest.Digest       `json:"digest,omitempty"`
+
+	// Set on watch events.
+	SubscriptionID string         `json:"subscription_id,omitempty"`
+	Changes        []watch.Change `json:"changes,omitempty"`
+}
+
+// Config controls delivery.
+type Config struct {
+	URLs        []string          // receive every event
+	Secret      string            // HMAC-SHA256 key; unsigned when empty
+	Secrets     map[string]string // per-URL keys replacing Secret
+	SummaryOnly bool              // send the analysis instead of the full response
+	MaxRetries  int               // attempts after the first one
+	Timeout     time.Duration     // per attempt
+}
+
+// Endpoint is a URL events are sent to, with the key that signs them there.
+// An empty Secret falls back to the dispatcher's keys.
+type Endpoint struct {
+	URL    string
+	Secret string
+
+	configured bool // one of Config.URLs, trusted to be internal
+}
+
+// ParseSecrets parses "url=secret" pairs. The secret is what follows the
+// last "=", so the URL may have a query string but the secret may not
+// contain "=".
+func ParseSecrets(pairs []string) (map[string]string, error) {
+	secrets := make(map[string]string, len(pairs))
+	for _, p := range pairs {
+		i := strings.LastIndex(p, "=")
+		if i <= 0 || i == len(p)-1 {
+			return nil, fmt.Errorf("invalid webhook secret %q, want url=secret", p)
+		}
+		u := strings.TrimSpace(p[:i])
+		if err := ValidateURL(u); err != nil {
+			return nil, fmt.Errorf("invalid webhook secret URL %q", u)
+		}
+		secrets[u] = strings.TrimSpace(p[i+1:])
+	}
+	return secrets, nil
+}
+
+// Dispatcher delivers events asynchronously with retries.
+type Dispatcher struct {
+	cfg    Config
+	client *http.Client // for the configured URLs
+	public *http.Client // for URLs given by callers; see publicDialer
+}
+
+func NewDispatcher(cfg Config) *Dispatcher {
+	return &Dispatcher{
+		cfg:    cfg,
+		client: &http.Client{Timeout: cfg.Timeout},
+		public: &http.Client{Timeout: cfg.Timeout, Transport: &http.Transport{
+			// No proxy: the dialer must see the receiver's address.
+			DialContext:         publicDialer.DialContext,
+			TLSHandshakeTimeout: 10 * time.Second,
+			MaxIdleConnsPerHost: 2,
+		}},
+	}
+}
+
+// NewEvent builds the event for a finished agent run.
+func (d *Dispatcher) NewEvent(resp *agent.AgentResponse) Event {
+	ev := Event{
+		ID:        store.NewID(),
+		Type:      EventScanCompleted,
+		Timestamp: time.Now().UTC(),
+		ScanID:    resp.ScanID,
+		Target:    resp.Target,
+		Status:    resp.Status,
+		Error:     resp.Error,
+		Analysis:  resp.Analysis,
+	}
+	if resp.Status == agent.StatusFailed {
+		ev.Type = EventScanFailed
+	}
+	if !d.cfg.SummaryOnly {
+		ev.Response = resp
+	}
+	return ev
+}
+
+// NewDigestEvent builds the event carrying a periodic digest.
+func (d *Dispatcher) NewDigestEvent(dg *digest.Digest) Event {
+	return Event{
+		ID:        store.NewID(),
+		Type:      EventDigest,
+		Timestamp: time.Now().UTC(),
+		Digest:    dg,
+	}
+}
+
+// NewWatchEvent builds the event telling a subscriber about changes to
+// the findings it watches.
+func (d *Dispatcher) NewWatchEvent(sub watch.Subscription, changes []watch.Change) Event {
+	return Event{
+		ID:             store.NewID(),
+		Type:           EventWatch,
+		Timestamp:      time.Now().UTC(),
+		SubscriptionID: sub.ID,
+		Changes:        changes,
+	}
+}
+
+// Notify sends ev to every global URL plus extra in the background.
+func (d *Dispatcher) Notify(ev Event, extra ...Endpoint) {
+	endpoints := make([]Endpoint, 0, len(d.cfg.URLs)+len(extra))
+	for _, u := range d.cfg.URLs {
+		endpoints = append(endpoints, Endpoint{URL: u, configured: true})
+	}
+	d.Send(ev, append(endpoints, extra...)...)
+}
+
+// Send sends ev to endpoints only, in the background. Endpoints other than
+// the configured URLs may only resolve to public addresses.
+func (d *Dispatcher) Send(ev Event, endpoints ...Endpoint) {
+	if len(endpoints) == 0 {
+		return
+	}
+
+	body, err := json.Marshal(ev)
+	if err != nil {
+		log.Error().Err(err).Str("event", ev.Type).Msg("Failed to encode webhook event")
+		return
+	}
+
+	for _, e := range endpoints {
+		if e.Secret == "" {
+			e.Secret = cmp.Or(d.cfg.Secrets[e.URL], d.cfg.Secret)
+		}
+		go d.deliver(e, ev, body)
+	}
+}
+
+func (d *Dispatcher) deliver(e Endpoint, ev Event, body []byte) {
+	target := e.URL
+	backoff := time.Second
+	for attempt := 0; ; attempt++ {
+		err := d.post(e, ev, body)
+		if err == nil {
+			return
+		}
+		if attempt >= d.cfg.MaxRetries {
+			log.Error().Err(err).Str("url", target).Str("event", ev.Type).Str("delivery", ev.ID).
+				Int("attempts", attempt+1).Msg("Webhook delivery failed")
+			return
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+func (d *Dispatcher) post(e Endpoint, ev Event, body []byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), d.cfg.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.URL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	ts := strconv.FormatInt(ev.Timestamp.Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "weekly-sec-ai-webhook")
+	req.Header.Set(HeaderEvent, ev.Type)
+	req.Header.Set(HeaderDelivery, ev.ID)
+	req.Header.Set(HeaderTimestamp, ts)
+	if e.Secret != "" {
+		req.Header.Set(HeaderSignature, "sha256="+Sign(e.Secret, ts, body))
+	}
+
+	client := d.public
+	if e.configured {
+		client = d.client
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// Sign returns the hex HMAC-SHA256 of "<timestamp>.<body>". Including the
+// timestamp lets receivers reject replayed deliveries.
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks a signature header value ("sha256=<hex>") against body
+// and its timestamp header, rejecting timestamps more than tolerance away
+// from now; 0 skips that check. Receivers written in Go can use it as is.
+func Verify(secret, timestamp, signature string, body []byte, tolerance time.Duration) error {
+	if tolerance > 0 {
+		sec, err := strconv.ParseInt(timestamp, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid timestamp %q", timestamp)
+		}
+		if d := time.Since(time.Unix(sec, 0)); d > tolerance || d < -tolerance {
+			return fmt.Errorf("timestamp is %s off", d.Round(time.Second))
+		}
+	}
+	got, err := hex.DecodeString(strings.TrimPrefix(signature, "sha256="))
+	if err != nil {
+		return fmt.Errorf("malformed signature")
+	}
+	want, _ := hex.DecodeString(Sign(secret, timestamp, body))
+	if !hmac.Equal(got, want) {
+		return fmt.Errorf("signature mismatch")
+	}
+	return nil
+}
+
+// ValidateURL checks that a webhook URL is an absolute http(s) URL.
+func ValidateURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("'webhook_url' must be an absolute http or https URL")
+	}
+	return nil
+}
+
+// ValidateEndpoint checks a webhook URL given by a caller: ValidateURL,
+// and a host that is not localhost nor a non-public address. A name
+// resolving to one is refused when delivering, since it may resolve
+// differently by then.
+func ValidateEndpoint(raw string) error {
+	if err := ValidateURL(raw); err != nil {
+		return err
+	}
+	u, _ := url.Parse(raw)
+	host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return fmt.Errorf("'webhook_url' must not point at localhost")
+	}
+	if ip, err := netip.ParseAddr(host); err == nil && !Public(ip) {
+		return fmt.Errorf("'webhook_url' must not point at a private, loopback or link-local address")
+	}
+	return nil
+}
+
+// Public reports whether ip is a public unicast address, one a webhook
+// given by a caller may be delivered to.
+func Public(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	return ip.IsGlobalUnicast() && !ip.IsPrivate() && !sharedAddressSpace.Contains(ip)
+}
+
+// sharedAddressSpace is the carrier-grade NAT range, RFC 6598, which
+// netip.Addr.IsPrivate leaves out.
+var sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+
+// publicDialer refuses to connect to a non-public address. The check runs
+// on the address actually dialled, after resolution and on every redirect,
+// so a name rebound to an internal address after validation is still
+// refused.
+var publicDialer = &net.Dialer{
+	Timeout:   10 * time.Second,
+	KeepAlive: 30 * time.Second,
+	Control: func(network, address string, _ syscall.RawConn) error {
+		ap, err := netip.ParseAddrPort(address)
+		if err != nil {
+			return err
+		}
+		if !Public(ap.Addr()) {
+			return fmt.Errorf("webhook address %s is not public", ap.Addr())
+		}
+		return nil
+	},
+}
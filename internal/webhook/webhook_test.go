@@ -0,0 +1,95 @@
+package webhook
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidateEndpoint(t *testing.T) {
+	tests := []struct {
+		url     string
+		wantErr string
+	}{
+		{"https://hooks.example.com/scan", ""},
+		{"http://93.184.216.34:8080/hook", ""},
+		{"https://[2606:4700::1111]/hook", ""},
+		{"ftp://hooks.example.com/scan", "absolute http or https URL"},
+		{"/relative", "absolute http or https URL"},
+		{"http://localhost:8080/hook", "localhost"},
+		{"http://LOCALHOST./hook", "localhost"},
+		{"http://api.localhost/hook", "localhost"},
+		{"http://127.0.0.1/hook", "private, loopback or link-local"},
+		{"http://10.0.0.5/hook", "private, loopback or link-local"},
+		{"http://192.168.1.1/hook", "private, loopback or link-local"},
+		{"http://169.254.169.254/latest/meta-data", "private, loopback or link-local"},
+		{"http://100.64.0.1/hook", "private, loopback or link-local"},
+		{"http://0.0.0.0/hook", "private, loopback or link-local"},
+		{"http://[::1]/hook", "private, loopback or link-local"},
+		{"http://[fd00::1]/hook", "private, loopback or link-local"},
+		{"http://[::ffff:127.0.0.1]/hook", "private, loopback or link-local"},
+	}
+	for _, tt := range tests {
+		err := ValidateEndpoint(tt.url)
+		if tt.wantErr == "" {
+			if err != nil {
+				t.Errorf("ValidateEndpoint(%q) = %v", tt.url, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("ValidateEndpoint(%q) = %v, want it to mention %q", tt.url, err, tt.wantErr)
+		}
+	}
+}
+
+func TestPublic(t *testing.T) {
+	for addr, want := range map[string]bool{
+		"8.8.8.8":         true,
+		"2001:4860::8888": true,
+		"127.0.0.1":       false,
+		"10.1.2.3":        false,
+		"172.16.0.1":      false,
+		"100.127.255.255": false,
+		"169.254.1.1":     false,
+		"224.0.0.1":       false,
+		"::ffff:10.0.0.1": false,
+		"::ffff:8.8.4.4":  true,
+		"fe80::1":         false,
+		"255.255.255.255": false,
+	} {
+		if got := Public(netip.MustParseAddr(addr)); got != want {
+			t.Errorf("Public(%s) = %v, want %v", addr, got, want)
+		}
+	}
+}
+
+func TestPublicDialerRefusesInternalAddresses(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	// The test server listens on loopback, as an internal service would.
+	conn, err := publicDialer.DialContext(ctx, "tcp", srv.Listener.Addr().String())
+	if err == nil {
+		conn.Close()
+		t.Fatal("publicDialer connected to a loopback address")
+	}
+	if !strings.Contains(err.Error(), "is not public") {
+		t.Fatalf("DialContext() error = %v, want the address refused", err)
+	}
+
+	d := NewDispatcher(Config{Timeout: 5 * time.Second})
+	ev := Event{ID: "1", Type: "scan.completed", Timestamp: time.Now()}
+	if err := d.post(Endpoint{URL: srv.URL}, ev, []byte("{}")); err == nil || !strings.Contains(err.Error(), "is not public") {
+		t.Fatalf("post() to a caller's loopback URL = %v, want it refused", err)
+	}
+	if err := d.post(Endpoint{URL: srv.URL, configured: true}, ev, []byte("{}")); err != nil {
+		t.Fatalf("post() to a configured loopback URL = %v, want it delivered", err)
+	}
+}
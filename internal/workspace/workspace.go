@@ -0,0 +1,335 @@
+// Package workspace gives each scan a private directory for what it
+// produces: working copies with fixes applied along with their diffs. A workspace is bounded in size and
+// removed once it expires; until then its artifacts can be downloaded.
+//
+// Workspaces live on disk only, each described by its own metadata file,
+// so every replica sharing the directory sees the same ones and nothing is
+// lost on restart.
+package workspace
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	"weeklysec/internal/errcode"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Artifact kinds, each a directory of a workspace.
+const (
+	KindPatched = "patched" // working copies with fixes applied
+	KindDiff    = "diffs"
+)
+
+// Kinds lists the artifact kinds.
+var Kinds = []string{KindPatched, KindDiff}
+
+// metaFile describes a workspace, next to its kind directories.
+const metaFile = "workspace.json"
+
+var (
+	// ErrNotFound is returned for workspaces and artifacts that do not
+	// exist or have expired.
+	ErrNotFound = errcode.New(errcode.NotFound, "workspace or artifact not found")
+
+	// ErrFull is returned by writes that would take a workspace over its
+	// quota.
+	ErrFull = errcode.New(errcode.RequestTooLarge, "workspace quota exceeded")
+)
+
+var validID = regexp.MustCompile(`^[A-Za-z0-9_-]{1,128}$`)
+
+// Manager creates, finds and expires the workspaces under one directory.
+// A nil Manager keeps no workspaces.
+type Manager struct {
+	root     string
+	ttl      time.Duration
+	maxBytes int64
+}
+
+// New returns a manager of the workspaces under root, each kept for ttl
+// and limited to maxBytes; 0 is unlimited.
+func New(root string, ttl time.Duration, maxBytes int64) (*Manager, error) {
+	if err := os.MkdirAll(root, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create workspace directory: %w", err)
+	}
+	return &Manager{root: root, ttl: ttl, maxBytes: maxBytes}, nil
+}
+
+// Workspace is the directory of one scan.
+type Workspace struct {
+	ID        string    `json:"id"` // the scan's ID
+	Org       string    `json:"org"`
+	Project   string    `json:"project"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+	MaxBytes  int64     `json:"max_bytes,omitempty"`
+
+	dir string
+}
+
+// Artifact is a file of a workspace.
+type Artifact struct {
+	Kind       string    `json:"kind"`
+	Path       string    `json:"path"` // relative to its kind's directory
+	Size       int64     `json:"size"`
+	ModifiedAt time.Time `json:"modified_at"`
+}
+
+// Open returns the workspace of id, creating it for org and project when
+// there is none. An expired workspace is replaced by a fresh one.
+func (m *Manager) Open(id, org, project string) (*Workspace, error) {
+	if m == nil {
+		return nil, nil
+	}
+	if w, err := m.Get(id); err == nil {
+		return w, nil
+	} else if !errors.Is(err, ErrNotFound) {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	w := &Workspace{
+		ID:        id,
+		Org:       org,
+		Project:   project,
+		CreatedAt: now,
+		ExpiresAt: now.Add(m.ttl),
+		MaxBytes:  m.maxBytes,
+		dir:       filepath.Join(m.root, id),
+	}
+	if err := os.MkdirAll(w.dir, 0o700); err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(w)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(filepath.Join(w.dir, metaFile), data, 0o600); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// Get returns the workspace of id if it exists and has not expired.
+func (m *Manager) Get(id string) (*Workspace, error) {
+	if m == nil || !validID.MatchString(id) {
+		return nil, ErrNotFound
+	}
+	dir := filepath.Join(m.root, id)
+	data, err := os.ReadFile(filepath.Join(dir, metaFile))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	var w Workspace
+	if err := json.Unmarshal(data, &w); err != nil {
+		return nil, fmt.Errorf("workspace %s: %w", id, err)
+	}
+	w.dir = dir
+	if !time.Now().Before(w.ExpiresAt) {
+		_ = os.RemoveAll(dir)
+		return nil, ErrNotFound
+	}
+	return &w, nil
+}
+
+// Sweep removes the workspaces that expired by now, and any directory
+// without readable metadata, returning how many it removed.
+func (m *Manager) Sweep(now time.Time) (int, error) {
+	if m == nil {
+		return 0, nil
+	}
+	entries, err := os.ReadDir(m.root)
+	if err != nil {
+		return 0, err
+	}
+	removed := 0
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		dir := filepath.Join(m.root, e.Name())
+		var w Workspace
+		data, err := os.ReadFile(filepath.Join(dir, metaFile))
+		if err == nil {
+			err = json.Unmarshal(data, &w)
+		}
+		if err == nil && now.Before(w.ExpiresAt) {
+			continue
+		}
+		if err := os.RemoveAll(dir); err != nil {
+			return removed, err
+		}
+		removed++
+	}
+	return removed, nil
+}
+
+// Run sweeps every interval until stop is closed.
+func (m *Manager) Run(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		n, err := m.Sweep(time.Now())
+		if err != nil {
+			log.Error().Err(err).Msg("Failed to sweep workspaces")
+		} else if n > 0 {
+			log.Info().Int("removed", n).Msg("Expired workspaces removed")
+		}
+		select {
+		case <-ticker.C:
+		case <-stop:
+			return
+		}
+	}
+}
+
+// Write stores data as the artifact name of kind, replacing any file of
+// that name.
+func (w *Workspace) Write(kind, name string, data []byte) error {
+	if w == nil {
+		return nil
+	}
+	p, err := w.path(kind, name)
+	if err != nil {
+		return err
+	}
+	if w.MaxBytes > 0 {
+		size, err := w.Size()
+		if err != nil {
+			return err
+		}
+		if info, err := os.Stat(p); err == nil {
+			size -= info.Size()
+		}
+		if size+int64(len(data)) > w.MaxBytes {
+			return fmt.Errorf("%w: %s would exceed %d bytes", ErrFull, w.ID, w.MaxBytes)
+		}
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0o700); err != nil {
+		return err
+	}
+	return os.WriteFile(p, data, 0o600)
+}
+
+// Size is the total size of the workspace's artifacts.
+func (w *Workspace) Size() (int64, error) {
+	var size int64
+	for _, a := range w.walk() {
+		size += a.Size
+	}
+	return size, nil
+}
+
+// Artifacts lists the files of the workspace by kind and path.
+func (w *Workspace) Artifacts() []Artifact {
+	out := w.walk()
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Kind != out[j].Kind {
+			return out[i].Kind < out[j].Kind
+		}
+		return out[i].Path < out[j].Path
+	})
+	return out
+}
+
+// Open opens the artifact name of kind for reading. A symlink anywhere on
+// the way is not followed but reported as ErrNotFound, and the file is
+// opened through an os.Root, so nothing outside the kind's directory can be
+// read even if a link appears meanwhile.
+func (w *Workspace) Open(kind, name string) (*os.File, error) {
+	p, err := w.path(kind, name)
+	if err != nil {
+		return nil, ErrNotFound
+	}
+	root, err := os.OpenRoot(filepath.Join(w.dir, kind))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer root.Close()
+
+	rel, _ := filepath.Rel(root.Name(), p)
+	parts := strings.Split(rel, string(filepath.Separator))
+	for i := range parts {
+		info, err := root.Lstat(filepath.Join(parts[:i+1]...))
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, ErrNotFound
+		}
+		if err != nil {
+			return nil, err
+		}
+		if info.Mode()&fs.ModeSymlink != 0 {
+			return nil, ErrNotFound
+		}
+	}
+	f, err := root.Open(rel)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if info, err := f.Stat(); err != nil || !info.Mode().IsRegular() {
+		f.Close()
+		return nil, ErrNotFound
+	}
+	return f, nil
+}
+
+// path resolves name inside the directory of kind, rejecting anything that
+// would leave it.
+func (w *Workspace) path(kind, name string) (string, error) {
+	if !validKind(kind) {
+		return "", fmt.Errorf("unknown artifact kind %q", kind)
+	}
+	clean := filepath.Clean("/" + filepath.FromSlash(name))[1:]
+	if clean == "" || strings.HasPrefix(clean, "..") {
+		return "", fmt.Errorf("invalid artifact path %q", name)
+	}
+	return filepath.Join(w.dir, kind, clean), nil
+}
+
+// walk returns the regular files under every kind's directory; symlinks
+// that tools leave behind are neither followed nor listed.
+func (w *Workspace) walk() []Artifact {
+	var out []Artifact
+	for _, kind := range Kinds {
+		root := filepath.Join(w.dir, kind)
+		_ = filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+			if err != nil || !d.Type().IsRegular() {
+				return nil
+			}
+			info, err := d.Info()
+			if err != nil {
+				return nil
+			}
+			rel, _ := filepath.Rel(root, p)
+			out = append(out, Artifact{Kind: kind, Path: filepath.ToSlash(rel), Size: info.Size(), ModifiedAt: info.ModTime().UTC()})
+			return nil
+		})
+	}
+	return out
+}
+
+func validKind(kind string) bool {
+	for _, k := range Kinds {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
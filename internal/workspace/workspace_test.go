@@ -0,0 +1,117 @@
+package workspace
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func openTestWorkspace(t *testing.T, maxBytes int64) *Workspace {
+	t.Helper()
+	m, err := New(t.TempDir(), time.Hour, maxBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := m.Open("scan1", "acme", "web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return w
+}
+
+func TestPath(t *testing.T) {
+	w := &Workspace{dir: "/ws"}
+	tests := []struct {
+		kind, name string
+		want       string
+		wantErr    bool
+	}{
+		{KindPatched, "go.mod", "/ws/patched/go.mod", false},
+		{KindDiff, "app/go.mod.diff", "/ws/diffs/app/go.mod.diff", false},
+		{KindPatched, "/etc/passwd", "/ws/patched/etc/passwd", false},
+		{KindPatched, "a/../../b", "/ws/patched/b", false},
+		{KindPatched, "../../etc/passwd", "/ws/patched/etc/passwd", false},
+		{KindPatched, "", "", true},
+		{KindPatched, "..", "", true},
+		{KindPatched, "/", "", true},
+		{"clones", "go.mod", "", true},
+		{"../patched", "go.mod", "", true},
+	}
+	for _, tt := range tests {
+		got, err := w.path(tt.kind, tt.name)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("path(%q, %q) error = %v, want error %v", tt.kind, tt.name, err, tt.wantErr)
+			continue
+		}
+		if got != filepath.FromSlash(tt.want) {
+			t.Errorf("path(%q, %q) = %q, want %q", tt.kind, tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestWriteAndOpen(t *testing.T) {
+	w := openTestWorkspace(t, 10)
+	if err := w.Write(KindPatched, "app/go.mod", []byte("module x")); err != nil {
+		t.Fatal(err)
+	}
+	f, err := w.Open(KindPatched, "app/go.mod")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(f)
+	f.Close()
+	if err != nil || string(data) != "module x" {
+		t.Fatalf("Open() read %q, %v", data, err)
+	}
+
+	if err := w.Write(KindDiff, "go.mod.diff", []byte("+++")); !errors.Is(err, ErrFull) {
+		t.Fatalf("Write() over the quota error = %v, want ErrFull", err)
+	}
+	if err := w.Write(KindPatched, "app/go.mod", []byte("module yz")); err != nil {
+		t.Fatalf("replacing a file within the quota: %v", err)
+	}
+	for _, name := range []string{"app", "missing", "../workspace.json"} {
+		if _, err := w.Open(KindPatched, name); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Open(%q) error = %v, want ErrNotFound", name, err)
+		}
+	}
+}
+
+func TestOpenDoesNotFollowSymlinks(t *testing.T) {
+	w := openTestWorkspace(t, 0)
+	outside := filepath.Join(t.TempDir(), "secret")
+	if err := os.WriteFile(outside, []byte("secret"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Write(KindPatched, "real/go.mod", []byte("module x")); err != nil {
+		t.Fatal(err)
+	}
+	dir := filepath.Join(w.dir, KindPatched)
+	links := map[string]string{
+		"file":   outside,
+		"dir":    filepath.Dir(outside),
+		"inside": filepath.Join(dir, "real"),
+	}
+	for name, target := range links {
+		if err := os.Symlink(target, filepath.Join(dir, name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, name := range []string{"file", "dir/secret", "inside/go.mod"} {
+		if f, err := w.Open(KindPatched, name); !errors.Is(err, ErrNotFound) {
+			if f != nil {
+				f.Close()
+			}
+			t.Errorf("Open(%q) error = %v, want ErrNotFound", name, err)
+		}
+	}
+	for _, a := range w.Artifacts() {
+		if a.Path != "real/go.mod" {
+			t.Errorf("Artifacts() lists %s", a.Path)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package client
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+	"weeklysec/internal/agent"
+	"weeklysec/internal/experiment"
+	"weeklysec/internal/store"
+)
+
+type (
+	AgentConfig      = agent.AgentConfig
+	ImportResult     = store.ImportResult
+	Experiments      = experiment.Config
+	ExperimentResult = experiment.Result
+)
+
+// AgentConfig returns the agent configuration in use. Admin only.
+func (c *Client) AgentConfig(ctx context.Context) (*AgentConfig, error) {
+	var ac AgentConfig
+	if err := c.do(ctx, request{method: http.MethodGet, path: "/api/v1/admin/config"}, &ac); err != nil {
+		return nil, err
+	}
+	return &ac, nil
+}
+
+// SetAgentConfig replaces the agent configuration and returns it as
+// applied. Admin only.
+func (c *Client) SetAgentConfig(ctx context.Context, ac AgentConfig) (*AgentConfig, error) {
+	var out AgentConfig
+	if err := c.do(ctx, request{method: http.MethodPut, path: "/api/v1/admin/config", body: ac}, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Experiments returns the prompt experiments in effect. Admin only.
+func (c *Client) Experiments(ctx context.Context) (*Experiments, error) {
+	var out Experiments
+	if err := c.do(ctx, request{method: http.MethodGet, path: "/api/v1/admin/experiments"}, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// SetExperiments replaces the prompt experiments; an empty set stops them.
+// Admin only.
+func (c *Client) SetExperiments(ctx context.Context, e Experiments) (*Experiments, error) {
+	var out Experiments
+	if err := c.do(ctx, request{method: http.MethodPut, path: "/api/v1/admin/experiments", body: e}, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ExperimentResults compares the variants of each experiment over the
+// given period; zero uses the server's default of 30 days. Admin only.
+func (c *Client) ExperimentResults(ctx context.Context, period time.Duration) ([]ExperimentResult, error) {
+	q := url.Values{}
+	if period > 0 {
+		q.Set("period", period.String())
+	}
+	var out struct {
+		Results []ExperimentResult `json:"results"`
+	}
+	if err := c.do(ctx, request{method: http.MethodGet, path: "/api/v1/admin/experiments/results", query: q}, &out); err != nil {
+		return nil, err
+	}
+	return out.Results, nil
+}
+
+// Export streams a gzipped tar archive of the store. The caller closes it.
+// Admin only.
+func (c *Client) Export(ctx context.Context) (io.ReadCloser, error) {
+	resp, err := c.send(ctx, request{method: http.MethodGet, path: "/api/v1/admin/export", accept: "application/gzip"})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// Import loads an archive written by Export. Existing records are skipped
+// unless overwrite is set. Admin only.
+func (c *Client) Import(ctx context.Context, archive io.Reader, overwrite bool) (*ImportResult, error) {
+	q := url.Values{}
+	if overwrite {
+		q.Set("overwrite", "true")
+	}
+	var res ImportResult
+	if err := c.do(ctx, request{method: http.MethodPost, path: "/api/v1/admin/import", query: q, stream: archive}, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
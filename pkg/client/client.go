@@ -0,0 +1,262 @@
+// Package client is a Go client for the weeklysec API. Requests and
+// responses are typed, errors carry the server's error code, and requests
+// the server did not act on are retried with backoff.
+//
+//	c := client.New("https://weeklysec.example.com", client.WithToken(key))
+//	resp, err := c.Scan(ctx, client.ScanRequest{TargetType: "image", Target: "alpine:3.19"})
+package client
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"weeklysec/internal/errcode"
+)
+
+// Client calls one weeklysec server. It is safe for concurrent use.
+type Client struct {
+	baseURL   string
+	token     string
+	userAgent string
+	http      *http.Client
+	retries   int
+	backoff   time.Duration
+}
+
+// Option configures a Client.
+type Option func(*Client)
+
+// WithToken authenticates with an API key or JWT.
+func WithToken(token string) Option {
+	return func(c *Client) { c.token = token }
+}
+
+// WithHTTPClient replaces the HTTP client. Scans run synchronously, so its
+// timeout should allow for a full scan.
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Client) { c.http = hc }
+}
+
+// WithRetries sets how many times a request is retried and the delay before
+// the first retry, which doubles on each attempt. 0 retries disables them.
+func WithRetries(n int, backoff time.Duration) Option {
+	return func(c *Client) { c.retries, c.backoff = n, backoff }
+}
+
+// WithUserAgent identifies the calling service in the server's logs.
+func WithUserAgent(ua string) Option {
+	return func(c *Client) { c.userAgent = ua }
+}
+
+// New returns a client for the server at baseURL.
+func New(baseURL string, opts ...Option) *Client {
+	c := &Client{
+		baseURL:   strings.TrimRight(baseURL, "/"),
+		userAgent: "weeklysec-client",
+		http:      &http.Client{Timeout: 15 * time.Minute},
+		retries:   3,
+		backoff:   500 * time.Millisecond,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// maxBackoff caps the delay between retries.
+const maxBackoff = 30 * time.Second
+
+// Error is an error answer from the server.
+type Error struct {
+	StatusCode int
+	Code       errcode.Code // e.g. "NOT_FOUND"; empty when the body was not the error envelope
+	Message    string
+	Details    any
+	RequestID  string
+}
+
+func (e *Error) Error() string {
+	if e.Code == "" {
+		return fmt.Sprintf("HTTP %d: %s", e.StatusCode, e.Message)
+	}
+	msg := fmt.Sprintf("%s (%s)", e.Message, e.Code)
+	if e.Details != nil {
+		msg += fmt.Sprintf(": %v", e.Details)
+	}
+	return msg
+}
+
+// IsNotFound reports whether err is a 404 from the server.
+func IsNotFound(err error) bool {
+	var e *Error
+	return errors.As(err, &e) && e.StatusCode == http.StatusNotFound
+}
+
+// request describes one API call.
+type request struct {
+	method string
+	path   string
+	query  url.Values
+	body   any       // encoded as JSON
+	stream io.Reader // sent as is instead of body; never retried
+	accept string    // defaults to application/json
+
+	idempotent bool // safe to repeat whatever the method
+}
+
+// do sends req and decodes a JSON answer into out, when out is not nil.
+func (c *Client) do(ctx context.Context, req request, out any) error {
+	resp, err := c.send(ctx, req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if out == nil {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("decoding %s %s: %w", req.method, req.path, err)
+	}
+	return nil
+}
+
+// send sends req, retrying as the policy allows, and returns a successful
+// response for the caller to read and close.
+func (c *Client) send(ctx context.Context, req request) (*http.Response, error) {
+	var payload []byte
+	if req.body != nil {
+		var err error
+		if payload, err = json.Marshal(req.body); err != nil {
+			return nil, err
+		}
+	}
+
+	for attempt := 0; ; attempt++ {
+		hreq, err := c.newRequest(ctx, req, payload)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := c.http.Do(hreq)
+		if err == nil && resp.StatusCode < 300 {
+			return resp, nil
+		}
+
+		var apiErr error
+		var retryAfter time.Duration
+		if err != nil {
+			apiErr = err
+		} else {
+			apiErr = decodeError(resp)
+			retryAfter = parseRetryAfter(resp.Header.Get("Retry-After"))
+			resp.Body.Close()
+		}
+		if attempt >= c.retries || req.stream != nil || !retryable(req, resp, err) {
+			return nil, apiErr
+		}
+
+		delay := max(c.backoff<<attempt, retryAfter)
+		delay = min(delay+rand.N(delay/4+1), maxBackoff)
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+}
+
+func (c *Client) newRequest(ctx context.Context, req request, payload []byte) (*http.Request, error) {
+	u := c.baseURL + req.path
+	if len(req.query) > 0 {
+		u += "?" + req.query.Encode()
+	}
+	var body io.Reader
+	switch {
+	case req.stream != nil:
+		body = req.stream
+	case payload != nil:
+		body = bytes.NewReader(payload)
+	}
+	hreq, err := http.NewRequestWithContext(ctx, req.method, u, body)
+	if err != nil {
+		return nil, err
+	}
+	hreq.Header.Set("Accept", cmp.Or(req.accept, "application/json"))
+	hreq.Header.Set("User-Agent", c.userAgent)
+	switch {
+	case req.stream != nil:
+		hreq.Header.Set("Content-Type", "application/octet-stream")
+	case payload != nil:
+		hreq.Header.Set("Content-Type", "application/json")
+	}
+	if c.token != "" {
+		hreq.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	return hreq, nil
+}
+
+// retryable reports whether a failed attempt can be repeated safely. A
+// rate-limited request was never processed; other failures are retried
+// only for methods that may be repeated.
+func retryable(req request, resp *http.Response, err error) bool {
+	if err != nil {
+		if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+			return false
+		}
+		return req.repeatable()
+	}
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests:
+		return true
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return req.repeatable()
+	}
+	return false
+}
+
+func (r request) repeatable() bool {
+	switch r.method {
+	case http.MethodGet, http.MethodHead, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return r.idempotent
+}
+
+// decodeError reads the error envelope, falling back to the status text.
+func decodeError(resp *http.Response) error {
+	var body struct {
+		Error struct {
+			Code      errcode.Code `json:"code"`
+			Message   string       `json:"message"`
+			Details   any          `json:"details"`
+			RequestID string       `json:"request_id"`
+		} `json:"error"`
+	}
+	e := &Error{StatusCode: resp.StatusCode}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&body); err == nil && body.Error.Message != "" {
+		e.Code, e.Message, e.Details, e.RequestID = body.Error.Code, body.Error.Message, body.Error.Details, body.Error.RequestID
+	} else {
+		e.Message = http.StatusText(resp.StatusCode)
+	}
+	return e
+}
+
+func parseRetryAfter(v string) time.Duration {
+	if secs, err := strconv.Atoi(v); err == nil && secs > 0 {
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return time.Until(t)
+	}
+	return 0
+}
@@ -0,0 +1,629 @@
+package client
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+	"weeklysec/internal/agent"
+	"weeklysec/internal/digest"
+	"weeklysec/internal/envcompare"
+	"weeklysec/internal/failure"
+	"weeklysec/internal/freshness"
+	"weeklysec/internal/mttr"
+	"weeklysec/internal/posture"
+	"weeklysec/internal/report"
+	"weeklysec/internal/store"
+	"weeklysec/internal/watch"
+)
+
+type (
+	Target           = store.Target
+	Finding          = store.Finding
+	Suppression      = agent.Suppression
+	SeverityOverride = agent.SeverityOverride
+	Guidance         = agent.Guidance
+	Watch            = watch.Subscription
+	Service          = posture.Service
+	Comparison       = envcompare.Report
+	Team             = digest.Team
+	ReportSchedule   = store.ReportSchedule
+	ReportTemplate   = report.Template
+	MTTRReport       = mttr.Report
+	StaleReport      = freshness.Report
+	FailureSummary   = failure.Summary
+	FindingLine      = report.FindingLine
+)
+
+// TargetRequest registers a target or replaces its settings.
+type TargetRequest struct {
+	Name        string            `json:"name"`
+	TargetType  string            `json:"target_type"`
+	Target      string            `json:"target"`
+	Team        string            `json:"team,omitempty"`
+	Environment string            `json:"environment,omitempty"`
+	Criticality string            `json:"criticality,omitempty"`
+	Schedule    string            `json:"schedule,omitempty"` // cron spec; empty uses the server default
+	Labels      map[string]string `json:"labels,omitempty"`
+	Project     string            `json:"project,omitempty"`
+}
+
+// TargetFilter selects targets. Empty fields match everything.
+type TargetFilter struct {
+	Team        string `json:"team,omitempty"`
+	Environment string `json:"environment,omitempty"`
+	Criticality string `json:"criticality,omitempty"`
+	Selector    string `json:"selector,omitempty"` // label selector, e.g. "tier=web,region!=eu"
+}
+
+func (f TargetFilter) query() url.Values {
+	q := url.Values{}
+	setQuery(q, "team", f.Team)
+	setQuery(q, "environment", f.Environment)
+	setQuery(q, "criticality", f.Criticality)
+	setQuery(q, "selector", f.Selector)
+	return q
+}
+
+// ListTargets lists the registered targets matching f.
+func (c *Client) ListTargets(ctx context.Context, f TargetFilter) ([]Target, error) {
+	var resp struct {
+		Targets []Target `json:"targets"`
+	}
+	if err := c.do(ctx, request{method: http.MethodGet, path: "/api/v1/targets", query: f.query()}, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Targets, nil
+}
+
+// StaleTargets lists the registered targets matching f not scanned
+// successfully within slo, grouped by why. A zero slo uses the server's
+// FRESHNESS_SLO.
+func (c *Client) StaleTargets(ctx context.Context, f TargetFilter, slo time.Duration) (*StaleReport, error) {
+	q := f.query()
+	if slo > 0 {
+		q.Set("slo", slo.String())
+	}
+	var r StaleReport
+	if err := c.do(ctx, request{method: http.MethodGet, path: "/api/v1/targets/stale", query: q}, &r); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// ScanFailures sums up how the scans of the registered targets matching f
+// failed since since, by failure class. A zero since uses the server's
+// default of a week ago.
+func (c *Client) ScanFailures(ctx context.Context, f TargetFilter, since time.Time) (*FailureSummary, error) {
+	q := f.query()
+	if !since.IsZero() {
+		q.Set("since", since.UTC().Format(time.RFC3339))
+	}
+	var s FailureSummary
+	if err := c.do(ctx, request{method: http.MethodGet, path: "/api/v1/targets/failures", query: q}, &s); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// GetTarget returns one registered target.
+func (c *Client) GetTarget(ctx context.Context, id string) (*Target, error) {
+	var t Target
+	if err := c.do(ctx, request{method: http.MethodGet, path: targetPath(id)}, &t); err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// CreateTarget registers a target for scheduled scans.
+func (c *Client) CreateTarget(ctx context.Context, req TargetRequest) (*Target, error) {
+	var t Target
+	if err := c.do(ctx, request{method: http.MethodPost, path: "/api/v1/targets", body: req}, &t); err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// UpdateTarget replaces the settings of a registered target.
+func (c *Client) UpdateTarget(ctx context.Context, id string, req TargetRequest) (*Target, error) {
+	var t Target
+	if err := c.do(ctx, request{method: http.MethodPut, path: targetPath(id), body: req}, &t); err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// DeleteTarget unregisters a target. Its past scans are kept.
+func (c *Client) DeleteTarget(ctx context.Context, id string) error {
+	return c.do(ctx, request{method: http.MethodDelete, path: targetPath(id)}, nil)
+}
+
+// ScanTarget scans a registered target now.
+func (c *Client) ScanTarget(ctx context.Context, id string) (*ScanResponse, error) {
+	var resp ScanResponse
+	if err := c.do(ctx, request{method: http.MethodPost, path: targetPath(id) + "/scan"}, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// ScanTargets starts background scans of every target matching f and
+// returns the IDs of the targets selected.
+func (c *Client) ScanTargets(ctx context.Context, f TargetFilter) ([]string, error) {
+	var resp struct {
+		TargetIDs []string `json:"target_ids"`
+	}
+	if err := c.do(ctx, request{method: http.MethodPost, path: "/api/v1/targets/scan", body: f}, &resp); err != nil {
+		return nil, err
+	}
+	return resp.TargetIDs, nil
+}
+
+// FindingFilter selects findings. Empty fields match everything.
+type FindingFilter struct {
+	Target   string
+	State    string
+	Severity string
+	Open     bool // only findings still present in the latest scan
+	Limit    int
+}
+
+// ListFindings lists tracked findings matching f.
+func (c *Client) ListFindings(ctx context.Context, f FindingFilter) ([]Finding, error) {
+	q := url.Values{}
+	setQuery(q, "target", f.Target)
+	setQuery(q, "state", f.State)
+	setQuery(q, "severity", f.Severity)
+	if f.Open {
+		q.Set("open", "true")
+	}
+	if f.Limit > 0 {
+		q.Set("limit", strconv.Itoa(f.Limit))
+	}
+	var resp struct {
+		Findings []Finding `json:"findings"`
+	}
+	if err := c.do(ctx, request{method: http.MethodGet, path: "/api/v1/findings", query: q}, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Findings, nil
+}
+
+// ExportFindings streams the findings matching f as an Excel workbook, with
+// the recommended fixes and SLA status, its headers in lang when it is not
+// empty. The caller closes it.
+func (c *Client) ExportFindings(ctx context.Context, f FindingFilter, lang string) (io.ReadCloser, error) {
+	q := url.Values{}
+	setQuery(q, "target", f.Target)
+	setQuery(q, "state", f.State)
+	setQuery(q, "severity", f.Severity)
+	setQuery(q, "lang", lang)
+	if f.Open {
+		q.Set("open", "true")
+	}
+	resp, err := c.send(ctx, request{method: http.MethodGet, path: "/api/v1/findings/export", query: q, accept: "*/*"})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// ExportFindingLines streams the findings matching f as JSON Lines, one
+// FindingLine per line, for SIEMs and other bulk consumers. The caller
+// decodes and closes it.
+func (c *Client) ExportFindingLines(ctx context.Context, f FindingFilter) (io.ReadCloser, error) {
+	q := url.Values{"format": {"ndjson"}}
+	setQuery(q, "target", f.Target)
+	setQuery(q, "state", f.State)
+	setQuery(q, "severity", f.Severity)
+	if f.Open {
+		q.Set("open", "true")
+	}
+	resp, err := c.send(ctx, request{method: http.MethodGet, path: "/api/v1/findings/export", query: q, accept: "application/x-ndjson"})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// MTTROptions selects the fixes MTTR measures. Empty fields match
+// everything; zero times default to the last 90 days.
+type MTTROptions struct {
+	Target   string
+	Team     string
+	Severity string
+	Since    time.Time
+	Until    time.Time
+}
+
+// MTTR returns the mean and percentile time to remediate findings, overall
+// and by severity, team and target.
+func (c *Client) MTTR(ctx context.Context, opts MTTROptions) (*MTTRReport, error) {
+	q := url.Values{}
+	setQuery(q, "target", opts.Target)
+	setQuery(q, "team", opts.Team)
+	setQuery(q, "severity", opts.Severity)
+	if !opts.Since.IsZero() {
+		q.Set("since", opts.Since.Format(time.RFC3339))
+	}
+	if !opts.Until.IsZero() {
+		q.Set("until", opts.Until.Format(time.RFC3339))
+	}
+	var r MTTRReport
+	if err := c.do(ctx, request{method: http.MethodGet, path: "/api/v1/findings/mttr", query: q}, &r); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// GetFinding returns one tracked finding.
+func (c *Client) GetFinding(ctx context.Context, id string) (*Finding, error) {
+	var f Finding
+	if err := c.do(ctx, request{method: http.MethodGet, path: findingPath(id)}, &f); err != nil {
+		return nil, err
+	}
+	return &f, nil
+}
+
+// UpdateFinding moves a finding to "acknowledged" or "in_progress", with a
+// note kept in its history.
+func (c *Client) UpdateFinding(ctx context.Context, id, state, note string) (*Finding, error) {
+	body := map[string]string{"state": state, "note": note}
+	var f Finding
+	if err := c.do(ctx, request{method: http.MethodPatch, path: findingPath(id), body: body}, &f); err != nil {
+		return nil, err
+	}
+	return &f, nil
+}
+
+// SuppressionRequest creates a suppression rule or replaces one.
+type SuppressionRequest struct {
+	VulnerabilityID string     `json:"vulnerability_id"`
+	Target          string     `json:"target,omitempty"`  // empty matches every target
+	Package         string     `json:"package,omitempty"` // empty matches every package
+	Justification   string     `json:"justification"`
+	Approver        string     `json:"approver"`
+	ExpiresAt       *time.Time `json:"expires_at,omitempty"`
+	Project         string     `json:"project,omitempty"`
+
+	VEXJustification string `json:"vex_justification,omitempty"`
+}
+
+// ListSuppressions lists suppression rules, with expired ones when
+// includeExpired is set.
+func (c *Client) ListSuppressions(ctx context.Context, includeExpired bool) ([]Suppression, error) {
+	q := url.Values{}
+	if includeExpired {
+		q.Set("include_expired", "true")
+	}
+	var resp struct {
+		Suppressions []Suppression `json:"suppressions"`
+	}
+	if err := c.do(ctx, request{method: http.MethodGet, path: "/api/v1/suppressions", query: q}, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Suppressions, nil
+}
+
+// GetSuppression returns one suppression rule.
+func (c *Client) GetSuppression(ctx context.Context, id string) (*Suppression, error) {
+	var s Suppression
+	if err := c.do(ctx, request{method: http.MethodGet, path: suppressionPath(id)}, &s); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// CreateSuppression adds a suppression rule.
+func (c *Client) CreateSuppression(ctx context.Context, req SuppressionRequest) (*Suppression, error) {
+	var s Suppression
+	if err := c.do(ctx, request{method: http.MethodPost, path: "/api/v1/suppressions", body: req}, &s); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// UpdateSuppression replaces a suppression rule.
+func (c *Client) UpdateSuppression(ctx context.Context, id string, req SuppressionRequest) (*Suppression, error) {
+	var s Suppression
+	if err := c.do(ctx, request{method: http.MethodPut, path: suppressionPath(id), body: req}, &s); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// DeleteSuppression removes a suppression rule.
+func (c *Client) DeleteSuppression(ctx context.Context, id string) error {
+	return c.do(ctx, request{method: http.MethodDelete, path: suppressionPath(id)}, nil)
+}
+
+// SeverityOverrideRequest creates a severity override or replaces one.
+type SeverityOverrideRequest struct {
+	VulnerabilityID string `json:"vulnerability_id,omitempty"` // empty matches every vulnerability
+	Package         string `json:"package,omitempty"`          // name or glob; empty matches every package
+	Target          string `json:"target,omitempty"`           // empty matches every target
+	Severity        string `json:"severity"`
+	Reason          string `json:"reason"`
+	Project         string `json:"project,omitempty"`
+}
+
+// ListSeverityOverrides lists severity overrides.
+func (c *Client) ListSeverityOverrides(ctx context.Context) ([]SeverityOverride, error) {
+	var resp struct {
+		SeverityOverrides []SeverityOverride `json:"severity_overrides"`
+	}
+	if err := c.do(ctx, request{method: http.MethodGet, path: "/api/v1/severity-overrides"}, &resp); err != nil {
+		return nil, err
+	}
+	return resp.SeverityOverrides, nil
+}
+
+// CreateSeverityOverride adds a severity override.
+func (c *Client) CreateSeverityOverride(ctx context.Context, req SeverityOverrideRequest) (*SeverityOverride, error) {
+	var o SeverityOverride
+	if err := c.do(ctx, request{method: http.MethodPost, path: "/api/v1/severity-overrides", body: req}, &o); err != nil {
+		return nil, err
+	}
+	return &o, nil
+}
+
+// UpdateSeverityOverride replaces a severity override.
+func (c *Client) UpdateSeverityOverride(ctx context.Context, id string, req SeverityOverrideRequest) (*SeverityOverride, error) {
+	var o SeverityOverride
+	if err := c.do(ctx, request{method: http.MethodPut, path: severityOverridePath(id), body: req}, &o); err != nil {
+		return nil, err
+	}
+	return &o, nil
+}
+
+// DeleteSeverityOverride removes a severity override.
+func (c *Client) DeleteSeverityOverride(ctx context.Context, id string) error {
+	return c.do(ctx, request{method: http.MethodDelete, path: severityOverridePath(id)}, nil)
+}
+
+// GuidanceRequest sets a tenant's guidance for generated fixes.
+type GuidanceRequest struct {
+	Conventions         string   `json:"conventions,omitempty"`
+	ForbiddenBaseImages []string `json:"forbidden_base_images,omitempty"`
+	PatchingPolicy      string   `json:"patching_policy,omitempty"`
+	Instructions        string   `json:"instructions,omitempty"`
+}
+
+// ListGuidance lists the guidance applied to the caller's scans.
+func (c *Client) ListGuidance(ctx context.Context) ([]Guidance, error) {
+	var resp struct {
+		Guidance []Guidance `json:"guidance"`
+	}
+	if err := c.do(ctx, request{method: http.MethodGet, path: "/api/v1/guidance"}, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Guidance, nil
+}
+
+// SetGuidance sets the guidance of a project, or of the whole org for
+// project "*".
+func (c *Client) SetGuidance(ctx context.Context, project string, req GuidanceRequest) (*Guidance, error) {
+	var g Guidance
+	if err := c.do(ctx, request{method: http.MethodPut, path: guidancePath(project), body: req}, &g); err != nil {
+		return nil, err
+	}
+	return &g, nil
+}
+
+// DeleteGuidance removes the guidance of a project.
+func (c *Client) DeleteGuidance(ctx context.Context, project string) error {
+	return c.do(ctx, request{method: http.MethodDelete, path: guidancePath(project)}, nil)
+}
+
+// WatchRequest creates a watch subscription or replaces one.
+type WatchRequest struct {
+	VulnerabilityID string   `json:"vulnerability_id,omitempty"`
+	Package         string   `json:"package,omitempty"` // name or glob
+	Target          string   `json:"target,omitempty"`  // empty matches every target
+	Kinds           []string `json:"kinds,omitempty"`   // fix_available, new_advisory; empty is both
+	WebhookURL      string   `json:"webhook_url,omitempty"`
+	WebhookSecret   string   `json:"webhook_secret,omitempty"` // signs deliveries to WebhookURL
+	Email           []string `json:"email,omitempty"`
+	Project         string   `json:"project,omitempty"`
+}
+
+// ListWatches lists watch subscriptions.
+func (c *Client) ListWatches(ctx context.Context) ([]Watch, error) {
+	var resp struct {
+		Watches []Watch `json:"watches"`
+	}
+	if err := c.do(ctx, request{method: http.MethodGet, path: "/api/v1/watches"}, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Watches, nil
+}
+
+// CreateWatch subscribes to changes in the findings of a CVE or package.
+func (c *Client) CreateWatch(ctx context.Context, req WatchRequest) (*Watch, error) {
+	var w Watch
+	if err := c.do(ctx, request{method: http.MethodPost, path: "/api/v1/watches", body: req}, &w); err != nil {
+		return nil, err
+	}
+	return &w, nil
+}
+
+// UpdateWatch replaces a watch subscription.
+func (c *Client) UpdateWatch(ctx context.Context, id string, req WatchRequest) (*Watch, error) {
+	var w Watch
+	if err := c.do(ctx, request{method: http.MethodPut, path: watchPath(id), body: req}, &w); err != nil {
+		return nil, err
+	}
+	return &w, nil
+}
+
+// DeleteWatch removes a watch subscription.
+func (c *Client) DeleteWatch(ctx context.Context, id string) error {
+	return c.do(ctx, request{method: http.MethodDelete, path: watchPath(id)}, nil)
+}
+
+// ReportScheduleRequest creates a report schedule or replaces one.
+type ReportScheduleRequest struct {
+	Name          string   `json:"name,omitempty"`
+	Project       string   `json:"project,omitempty"` // "*" for the whole org
+	Team          string   `json:"team,omitempty"`
+	Day           string   `json:"day"`                   // e.g. "monday"
+	Hour          int      `json:"hour"`                  // 0-23
+	Timezone      string   `json:"timezone,omitempty"`    // IANA name; UTC when empty
+	PeriodDays    int      `json:"period_days,omitempty"` // 7 when 0
+	Format        string   `json:"format,omitempty"`      // html, text, markdown, pdf or json
+	Locale        string   `json:"locale,omitempty"`      // of the report's fixed strings, e.g. "de"
+	Email         []string `json:"email,omitempty"`
+	WebhookURL    string   `json:"webhook_url,omitempty"`
+	WebhookSecret string   `json:"webhook_secret,omitempty"`
+	Chat          bool     `json:"chat,omitempty"`
+	Paused        bool     `json:"paused,omitempty"`
+}
+
+// ListReportSchedules lists report schedules by next run.
+func (c *Client) ListReportSchedules(ctx context.Context) ([]ReportSchedule, error) {
+	var resp struct {
+		Schedules []ReportSchedule `json:"report_schedules"`
+	}
+	if err := c.do(ctx, request{method: http.MethodGet, path: "/api/v1/report-schedules"}, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Schedules, nil
+}
+
+// CreateReportSchedule schedules weekly delivery of a digest.
+func (c *Client) CreateReportSchedule(ctx context.Context, req ReportScheduleRequest) (*ReportSchedule, error) {
+	var rs ReportSchedule
+	if err := c.do(ctx, request{method: http.MethodPost, path: "/api/v1/report-schedules", body: req}, &rs); err != nil {
+		return nil, err
+	}
+	return &rs, nil
+}
+
+// UpdateReportSchedule replaces a report schedule.
+func (c *Client) UpdateReportSchedule(ctx context.Context, id string, req ReportScheduleRequest) (*ReportSchedule, error) {
+	var rs ReportSchedule
+	if err := c.do(ctx, request{method: http.MethodPut, path: reportSchedulePath(id), body: req}, &rs); err != nil {
+		return nil, err
+	}
+	return &rs, nil
+}
+
+// DeleteReportSchedule removes a report schedule.
+func (c *Client) DeleteReportSchedule(ctx context.Context, id string) error {
+	return c.do(ctx, request{method: http.MethodDelete, path: reportSchedulePath(id)}, nil)
+}
+
+// SendReportSchedule delivers a scheduled report now.
+func (c *Client) SendReportSchedule(ctx context.Context, id string) (*ReportSchedule, error) {
+	var rs ReportSchedule
+	if err := c.do(ctx, request{method: http.MethodPost, path: reportSchedulePath(id) + "/send"}, &rs); err != nil {
+		return nil, err
+	}
+	return &rs, nil
+}
+
+// ListReportTemplates lists the custom report templates of the server.
+func (c *Client) ListReportTemplates(ctx context.Context) ([]ReportTemplate, error) {
+	var resp struct {
+		Templates []ReportTemplate `json:"report_templates"`
+	}
+	if err := c.do(ctx, request{method: http.MethodGet, path: "/api/v1/report-templates"}, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Templates, nil
+}
+
+// Services returns the posture of every service, riskiest first.
+func (c *Client) Services(ctx context.Context) ([]*Service, error) {
+	var resp struct {
+		Services []*Service `json:"services"`
+	}
+	if err := c.do(ctx, request{method: http.MethodGet, path: "/api/v1/services"}, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Services, nil
+}
+
+// Service returns the posture of one service.
+func (c *Client) Service(ctx context.Context, name string) (*Service, error) {
+	var s Service
+	if err := c.do(ctx, request{method: http.MethodGet, path: "/api/v1/services/" + url.PathEscape(name)}, &s); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// Teams returns the scorecard of every team for the last digest period,
+// riskiest first.
+func (c *Client) Teams(ctx context.Context) ([]Team, error) {
+	var resp struct {
+		Teams []Team `json:"teams"`
+	}
+	if err := c.do(ctx, request{method: http.MethodGet, path: "/api/v1/teams"}, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Teams, nil
+}
+
+// Team returns the scorecard of one team.
+func (c *Client) Team(ctx context.Context, name string) (*Team, error) {
+	var resp struct {
+		Team Team `json:"team"`
+	}
+	if err := c.do(ctx, request{method: http.MethodGet, path: "/api/v1/teams/" + url.PathEscape(name)}, &resp); err != nil {
+		return nil, err
+	}
+	return &resp.Team, nil
+}
+
+// CompareOptions selects the environments to compare. By is "environment"
+// when empty, or "label:<key>".
+type CompareOptions struct {
+	From        string
+	To          string
+	By          string
+	Application string
+	Selector    string
+}
+
+// Compare compares the applications deployed to two environments or
+// clusters, listing the findings open in To that From has already fixed.
+func (c *Client) Compare(ctx context.Context, opts CompareOptions) (*Comparison, error) {
+	q := url.Values{"from": {opts.From}, "to": {opts.To}}
+	for k, v := range map[string]string{"by": opts.By, "application": opts.Application, "selector": opts.Selector} {
+		if v != "" {
+			q.Set(k, v)
+		}
+	}
+	var r Comparison
+	if err := c.do(ctx, request{method: http.MethodGet, path: "/api/v1/compare", query: q}, &r); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+func targetPath(id string) string      { return "/api/v1/targets/" + url.PathEscape(id) }
+func findingPath(id string) string     { return "/api/v1/findings/" + url.PathEscape(id) }
+func suppressionPath(id string) string { return "/api/v1/suppressions/" + url.PathEscape(id) }
+
+func watchPath(id string) string { return "/api/v1/watches/" + url.PathEscape(id) }
+
+func reportSchedulePath(id string) string {
+	return "/api/v1/report-schedules/" + url.PathEscape(id)
+}
+
+func severityOverridePath(id string) string {
+	return "/api/v1/severity-overrides/" + url.PathEscape(id)
+}
+
+func guidancePath(project string) string {
+	return "/api/v1/guidance/" + url.PathEscape(project)
+}
+
+func setQuery(q url.Values, key, value string) {
+	if value != "" {
+		q.Set(key, value)
+	}
+}
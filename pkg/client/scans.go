@@ -0,0 +1,325 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+	"weeklysec/internal/agent"
+	"weeklysec/internal/gate"
+	"weeklysec/internal/github"
+	"weeklysec/internal/workspace"
+)
+
+// Response types are the server's own, so they cannot drift from the API.
+type (
+	ScanResponse = agent.AgentResponse
+	Fix          = agent.Fix
+	Feedback     = agent.Feedback
+	PullRequest  = agent.PullRequest
+	Verdict      = gate.Verdict
+	Policy       = gate.Policy
+	Artifact     = workspace.Artifact
+)
+
+// Report formats accepted by Report.
+const (
+	FormatText     = "text"
+	FormatMarkdown = "markdown"
+	FormatJSON     = "json"
+)
+
+// ScanRequest asks for a scan of one target.
+type ScanRequest struct {
+	TargetType string `json:"target_type"` // "image" or "file"
+	Target     string `json:"target"`
+	Summarize  bool   `json:"summarize,omitempty"`
+	WebhookURL string `json:"webhook_url,omitempty"`
+	// WebhookSecret signs deliveries to WebhookURL; see webhook.Verify.
+	WebhookSecret string              `json:"webhook_secret,omitempty"`
+	Project       string              `json:"project,omitempty"` // for org-wide credentials
+	Explain       bool                `json:"explain,omitempty"` // record the rationale of each step
+	Source        string              `json:"source,omitempty"`  // Dockerfile or manifest of an image target
+	PullRequest   *PullRequestRequest `json:"pull_request,omitempty"`
+}
+
+// PullRequestRequest asks for a pull request with a scan's fixes.
+type PullRequestRequest struct {
+	Repo   string   `json:"repo"`             // owner/name
+	Paths  []string `json:"paths,omitempty"`  // manifests to patch; found in the repo when empty
+	Base   string   `json:"base,omitempty"`   // defaults to the repo's default branch
+	Branch string   `json:"branch,omitempty"` // defaults to weeklysec/fix-<scan id>
+	Token  string   `json:"token,omitempty"`  // defaults to the server's GITHUB_TOKEN
+
+	// Fixes replaces the scan's fixes with a reviewed subset.
+	Fixes []Fix `json:"fixes,omitempty"`
+}
+
+// RepoPullRequestRequest asks for one pull request with the fixes of
+// several scans of targets in the same repository, a commit per target.
+type RepoPullRequestRequest struct {
+	Repo   string                `json:"repo"`             // owner/name
+	Base   string                `json:"base,omitempty"`   // defaults to the repo's default branch
+	Branch string                `json:"branch,omitempty"` // defaults to weeklysec/fix-<new id>
+	Token  string                `json:"token,omitempty"`  // defaults to the server's GITHUB_TOKEN
+	Scans  []RepoPullRequestScan `json:"scans"`
+}
+
+// RepoPullRequestScan names a scan and the manifests its fixes apply to.
+type RepoPullRequestScan struct {
+	ScanID string   `json:"scan_id"`
+	Paths  []string `json:"paths,omitempty"`
+}
+
+// AppScanRequest asks for one scan over the images of an application.
+type AppScanRequest struct {
+	Name          string   `json:"name"` // the application, the target of the scan
+	Images        []string `json:"images"`
+	Project       string   `json:"project,omitempty"` // for org-wide credentials
+	Explain       bool     `json:"explain,omitempty"`
+	WebhookURL    string   `json:"webhook_url,omitempty"`
+	WebhookSecret string   `json:"webhook_secret,omitempty"`
+}
+
+// GateRequest scans a target and judges it against a policy.
+type GateRequest struct {
+	ScanRequest
+
+	BaselineScanID string           `json:"baseline_scan_id,omitempty"`
+	BaselineTarget string           `json:"baseline_target,omitempty"`
+	Policy         *Policy          `json:"policy,omitempty"` // defaults to the server's GATE_* settings
+	CheckRun       *CheckRunRequest `json:"check_run,omitempty"`
+}
+
+// CheckRunRequest publishes a gate verdict as a GitHub check run.
+type CheckRunRequest struct {
+	Repo    string `json:"repo"`
+	HeadSHA string `json:"head_sha"`
+	Name    string `json:"name,omitempty"`
+	Token   string `json:"token,omitempty"`
+}
+
+// GateResponse is a verdict and the outcome of publishing it.
+type GateResponse struct {
+	*Verdict
+	CheckRun      *github.CreatedCheckRun `json:"check_run,omitempty"`
+	CheckRunError string                  `json:"check_run_error,omitempty"`
+}
+
+// Scan runs the agent pipeline on a target and stores the result. It is
+// not retried on server errors, since the scan may have run.
+func (c *Client) Scan(ctx context.Context, req ScanRequest) (*ScanResponse, error) {
+	var resp ScanResponse
+	if err := c.do(ctx, request{method: http.MethodPost, path: "/api/v1/scans", body: req}, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// ScanApp scans the images of an application at once and analyzes their
+// merged findings as one run, with one remediation package.
+func (c *Client) ScanApp(ctx context.Context, req AppScanRequest) (*ScanResponse, error) {
+	var resp ScanResponse
+	if err := c.do(ctx, request{method: http.MethodPost, path: "/api/v1/app-scans", body: req}, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// GetScan returns a stored scan.
+func (c *Client) GetScan(ctx context.Context, id string) (*ScanResponse, error) {
+	var resp ScanResponse
+	if err := c.do(ctx, request{method: http.MethodGet, path: scanPath(id)}, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// Report streams a stored scan rendered as text, markdown or JSON. The
+// caller closes it.
+func (c *Client) Report(ctx context.Context, id, format string) (io.ReadCloser, error) {
+	resp, err := c.send(ctx, request{
+		method: http.MethodGet,
+		path:   scanPath(id),
+		query:  url.Values{"format": {format}},
+		accept: "*/*",
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// TemplateReport streams a stored scan rendered with the server's custom
+// scan template called name. The caller closes it.
+func (c *Client) TemplateReport(ctx context.Context, id, name string) (io.ReadCloser, error) {
+	resp, err := c.send(ctx, request{
+		method: http.MethodGet,
+		path:   scanPath(id),
+		query:  url.Values{"template": {name}},
+		accept: "*/*",
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// Gate scans a target and returns the policy verdict. A failing verdict is
+// not an error.
+func (c *Client) Gate(ctx context.Context, req GateRequest) (*GateResponse, error) {
+	var resp GateResponse
+	if err := c.do(ctx, request{method: http.MethodPost, path: "/api/v1/gate", body: req}, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// OpenPullRequest opens a pull request with the fixes of a stored scan.
+func (c *Client) OpenPullRequest(ctx context.Context, scanID string, req PullRequestRequest) (*PullRequest, error) {
+	var pr PullRequest
+	if err := c.do(ctx, request{method: http.MethodPost, path: scanPath(scanID) + "/pull-request", body: req}, &pr); err != nil {
+		return nil, err
+	}
+	return &pr, nil
+}
+
+// OpenRepoPullRequest opens one pull request with the fixes of several
+// stored scans.
+func (c *Client) OpenRepoPullRequest(ctx context.Context, req RepoPullRequestRequest) (*PullRequest, error) {
+	var pr PullRequest
+	if err := c.do(ctx, request{method: http.MethodPost, path: "/api/v1/pull-requests", body: req}, &pr); err != nil {
+		return nil, err
+	}
+	return &pr, nil
+}
+
+// FeedbackRequest rates a scan's summary, one of its fixes or one of its
+// findings.
+type FeedbackRequest struct {
+	Subject         string `json:"subject"`                    // "summary", "fix" or "finding"
+	PkgName         string `json:"pkg_name,omitempty"`         // the fix rated, or the finding's package
+	VulnerabilityID string `json:"vulnerability_id,omitempty"` // the finding rated; down marks it as noise
+	Rating          string `json:"rating,omitempty"`           // "up" or "down"
+	Comment         string `json:"comment,omitempty"`
+}
+
+// SendFeedback records feedback on a stored scan's summary or fixes.
+func (c *Client) SendFeedback(ctx context.Context, scanID string, req FeedbackRequest) (*Feedback, error) {
+	var fb Feedback
+	if err := c.do(ctx, request{method: http.MethodPost, path: scanPath(scanID) + "/feedback", body: req}, &fb); err != nil {
+		return nil, err
+	}
+	return &fb, nil
+}
+
+// ScanQuery filters Scans.
+type ScanQuery struct {
+	Target string // exact target; empty lists every target
+	Limit  int    // 0 uses the server default
+}
+
+// ScanSummary is one entry of the scan history.
+type ScanSummary struct {
+	ID             string         `json:"id"`
+	TargetType     string         `json:"targetType"`
+	Target         string         `json:"target"`
+	CreatedAt      time.Time      `json:"createdAt"`
+	RiskScore      float64        `json:"riskScore"`
+	SeverityCounts SeverityCounts `json:"severityCounts"`
+}
+
+// SeverityCounts counts a scan's open findings.
+type SeverityCounts struct {
+	Critical int `json:"critical"`
+	High     int `json:"high"`
+	Medium   int `json:"medium"`
+	Low      int `json:"low"`
+	Unknown  int `json:"unknown"`
+}
+
+const scansQuery = `query Scans($target: String, $limit: Int) {
+  scans(target: $target, limit: $limit) {
+    id targetType target createdAt riskScore
+    severityCounts { critical high medium low unknown }
+  }
+}`
+
+// Scans lists past scans, newest first.
+func (c *Client) Scans(ctx context.Context, q ScanQuery) ([]ScanSummary, error) {
+	vars := map[string]any{}
+	if q.Target != "" {
+		vars["target"] = q.Target
+	}
+	if q.Limit > 0 {
+		vars["limit"] = q.Limit
+	}
+	var out struct {
+		Scans []ScanSummary `json:"scans"`
+	}
+	if err := c.GraphQL(ctx, scansQuery, vars, &out); err != nil {
+		return nil, err
+	}
+	return out.Scans, nil
+}
+
+// GraphQL runs a query and decodes its data into out. The first error the
+// server reports is returned.
+func (c *Client) GraphQL(ctx context.Context, query string, vars map[string]any, out any) error {
+	var resp struct {
+		Data   json.RawMessage `json:"data"`
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	// The schema has no mutations, so queries are safe to retry.
+	body := map[string]any{"query": query, "variables": vars}
+	if err := c.do(ctx, request{method: http.MethodPost, path: "/graphql", body: body, idempotent: true}, &resp); err != nil {
+		return err
+	}
+	if len(resp.Errors) > 0 {
+		return fmt.Errorf("graphql: %s", resp.Errors[0].Message)
+	}
+	return json.Unmarshal(resp.Data, out)
+}
+
+// Workspace lists the artifacts kept for a scan, such as the patched files
+// and diffs of its pull requests, until ExpiresAt.
+type Workspace struct {
+	ScanID    string     `json:"scan_id"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	Size      int64      `json:"size"`
+	MaxBytes  int64      `json:"max_bytes,omitempty"`
+	Artifacts []Artifact `json:"artifacts"`
+}
+
+// Workspace returns the workspace of a stored scan.
+func (c *Client) Workspace(ctx context.Context, scanID string) (*Workspace, error) {
+	var ws Workspace
+	if err := c.do(ctx, request{method: http.MethodGet, path: scanPath(scanID) + "/workspace"}, &ws); err != nil {
+		return nil, err
+	}
+	return &ws, nil
+}
+
+// Artifact streams one artifact of a scan's workspace. The caller closes it.
+func (c *Client) Artifact(ctx context.Context, scanID string, a Artifact) (io.ReadCloser, error) {
+	p := scanPath(scanID) + "/workspace/" + url.PathEscape(a.Kind)
+	for _, part := range strings.Split(a.Path, "/") {
+		p += "/" + url.PathEscape(part)
+	}
+	resp, err := c.send(ctx, request{method: http.MethodGet, path: p, accept: "*/*"})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+func scanPath(id string) string {
+	return "/api/v1/scans/" + url.PathEscape(id)
+}